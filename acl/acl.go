@@ -0,0 +1,538 @@
+// Package acl controls which commands and keys each user may access, following the rules of redis ACLs.
+//
+// Each user is described by a list of rules:
+//
+//	on, off          enable or disable the user
+//	>password        add a password, stored only as its SHA-256 hash
+//	<password        remove a password
+//	#hash, !hash     add or remove a password by its hex encoded SHA-256 hash
+//	nopass           allow any password, removing all passwords
+//	resetpass        remove all passwords and nopass
+//	+@category       allow commands of a category: read, write, admin, pubsub or all
+//	-@category       disallow commands of a category
+//	allcommands      same as +@all
+//	nocommands       same as -@all
+//	~pattern         allow keys matching a glob pattern, such as ~session:*
+//	allkeys          same as ~*
+//	resetkeys        remove all key patterns
+//	reset            remove everything from the user, disabling it
+//
+// A new ACL has a "default" user that is enabled with nopass, allkeys and allcommands, so that connections are
+// authenticated as the default user until it is restricted or disabled.
+package acl
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wspowell/datkey/internal/glob"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type AccessErr errors.Cause
+
+const (
+	AccessErrInternal = AccessErr(iota + 1)
+	// AccessErrInvalidRule is returned when a rule or ACL file cannot be parsed.
+	AccessErrInvalidRule
+	// AccessErrWrongPass is returned when a user does not exist, is disabled or the password does not match.
+	AccessErrWrongPass
+	// AccessErrNoPermission is returned when a user may not run a command or access a key.
+	AccessErrNoPermission
+)
+
+// DefaultUser that connections are authenticated as before they authenticate as another user.
+const DefaultUser = "default"
+
+// Category of commands.
+type Category string
+
+const (
+	// CategoryRead commands read keys.
+	CategoryRead Category = "read"
+	// CategoryWrite commands modify keys.
+	CategoryWrite Category = "write"
+	// CategoryAdmin commands manage the server, such as ACL SETUSER and INFO.
+	CategoryAdmin Category = "admin"
+	// CategoryPubSub commands publish or subscribe to channels.
+	CategoryPubSub Category = "pubsub"
+)
+
+// categories in the order they are described.
+var categories = []Category{CategoryRead, CategoryWrite, CategoryAdmin, CategoryPubSub} //nolint:gochecknoglobals // reason: constant list
+
+// UserInfo describes the rules of a user.
+type UserInfo struct {
+	Name string
+	// Passwords as hex encoded SHA-256 hashes.
+	Passwords   []string
+	Categories  []Category
+	KeyPatterns []string
+	Enabled     bool
+	NoPass      bool
+}
+
+// Rules describing the user, which recreate the user when given to SetUser.
+func (self UserInfo) Rules() []string {
+	rules := []string{"off"}
+	if self.Enabled {
+		rules[0] = "on"
+	}
+
+	if self.NoPass {
+		rules = append(rules, "nopass")
+	}
+	for _, password := range self.Passwords {
+		rules = append(rules, "#"+password)
+	}
+
+	for _, pattern := range self.KeyPatterns {
+		rules = append(rules, "~"+pattern)
+	}
+	if len(self.KeyPatterns) == 0 {
+		rules = append(rules, "resetkeys")
+	}
+
+	switch len(self.Categories) {
+	case 0:
+		rules = append(rules, "-@all")
+	case len(categories):
+		rules = append(rules, "+@all")
+	default:
+		for _, category := range self.Categories {
+			rules = append(rules, "+@"+string(category))
+		}
+	}
+
+	return rules
+}
+
+type user struct {
+	categories  map[Category]bool
+	passwords   []string
+	keyPatterns []string
+	enabled     bool
+	noPass      bool
+}
+
+func newUser() *user {
+	return &user{
+		categories:  map[Category]bool{},
+		passwords:   nil,
+		keyPatterns: nil,
+		enabled:     false,
+		noPass:      false,
+	}
+}
+
+func (self *user) clone() *user {
+	categories := make(map[Category]bool, len(self.categories))
+	for category, allowed := range self.categories {
+		categories[category] = allowed
+	}
+
+	return &user{
+		categories:  categories,
+		passwords:   slices.Clone(self.passwords),
+		keyPatterns: slices.Clone(self.keyPatterns),
+		enabled:     self.enabled,
+		noPass:      self.noPass,
+	}
+}
+
+func (self *user) info(name string) UserInfo {
+	var allowed []Category
+	for _, category := range categories {
+		if self.categories[category] {
+			allowed = append(allowed, category)
+		}
+	}
+
+	return UserInfo{
+		Name:        name,
+		Passwords:   slices.Clone(self.passwords),
+		Categories:  allowed,
+		KeyPatterns: slices.Clone(self.keyPatterns),
+		Enabled:     self.enabled,
+		NoPass:      self.noPass,
+	}
+}
+
+//nolint:cyclop // reason: one case per rule
+func (self *user) applyRule(rule string) *errors.Error[AccessErr] {
+	switch lower := strings.ToLower(rule); {
+	case lower == "on":
+		self.enabled = true
+	case lower == "off":
+		self.enabled = false
+	case lower == "nopass":
+		self.noPass = true
+		self.passwords = nil
+	case lower == "resetpass":
+		self.noPass = false
+		self.passwords = nil
+	case lower == "allkeys":
+		self.keyPatterns = []string{"*"}
+	case lower == "resetkeys":
+		self.keyPatterns = nil
+	case lower == "allcommands":
+		return self.applyRule("+@all")
+	case lower == "nocommands":
+		return self.applyRule("-@all")
+	case lower == "reset":
+		*self = *newUser()
+	case strings.HasPrefix(rule, ">"):
+		self.addPassword(hashPassword(rule[1:]))
+	case strings.HasPrefix(rule, "<"):
+		return self.removePassword(hashPassword(rule[1:]))
+	case strings.HasPrefix(rule, "#"):
+		hash := strings.ToLower(rule[1:])
+		if !validHash(hash) {
+			return errors.New(AccessErrInvalidRule, "invalid password hash: %s", rule)
+		}
+		self.addPassword(hash)
+	case strings.HasPrefix(rule, "!"):
+		hash := strings.ToLower(rule[1:])
+		if !validHash(hash) {
+			return errors.New(AccessErrInvalidRule, "invalid password hash: %s", rule)
+		}
+		return self.removePassword(hash)
+	case strings.HasPrefix(rule, "~"):
+		if !slices.Contains(self.keyPatterns, rule[1:]) {
+			self.keyPatterns = append(self.keyPatterns, rule[1:])
+		}
+	case strings.HasPrefix(lower, "+@"), strings.HasPrefix(lower, "-@"):
+		allowed := lower[0] == '+'
+		category := Category(lower[2:])
+		if category == "all" {
+			for _, category := range categories {
+				self.categories[category] = allowed
+			}
+			return nil
+		}
+		if !slices.Contains(categories, category) {
+			return errors.New(AccessErrInvalidRule, "unknown command category: %s", rule)
+		}
+		self.categories[category] = allowed
+	default:
+		return errors.New(AccessErrInvalidRule, "syntax error in rule: %s", rule)
+	}
+
+	return nil
+}
+
+func (self *user) addPassword(hash string) {
+	self.noPass = false
+	if !slices.Contains(self.passwords, hash) {
+		self.passwords = append(self.passwords, hash)
+	}
+}
+
+func (self *user) removePassword(hash string) *errors.Error[AccessErr] {
+	index := slices.Index(self.passwords, hash)
+	if index < 0 {
+		return errors.New(AccessErrInvalidRule, "no such password")
+	}
+	self.passwords = slices.Delete(self.passwords, index, index+1)
+	return nil
+}
+
+// checkPassword in constant time against every password of the user.
+func (self *user) checkPassword(password string) bool {
+	if self.noPass {
+		return true
+	}
+
+	hash := []byte(hashPassword(password))
+	var matched bool
+	for _, stored := range self.passwords {
+		if subtle.ConstantTimeCompare(hash, []byte(stored)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func (self *user) allowsKey(key string) bool {
+	for _, pattern := range self.keyPatterns {
+		if glob.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
+
+func validHash(hash string) bool {
+	decoded, err := hex.DecodeString(hash)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// ACL of every user. Safe for concurrent use.
+type ACL struct {
+	users map[string]*user
+	// path of the file last loaded by LoadFile, which Reload and SaveFile use.
+	path  string
+	mutex sync.RWMutex
+}
+
+// New ACL with only the default user.
+func New() *ACL {
+	return &ACL{
+		users: map[string]*user{
+			DefaultUser: defaultUser(),
+		},
+		path:  "",
+		mutex: sync.RWMutex{},
+	}
+}
+
+func defaultUser() *user {
+	defaultUser := newUser()
+	for _, rule := range []string{"on", "nopass", "allkeys", "allcommands"} {
+		_ = defaultUser.applyRule(rule)
+	}
+	return defaultUser
+}
+
+// SetUser applies rules to a user, creating the user if it does not exist.
+// Either every rule is applied or, if any rule is invalid, none are.
+func (self *ACL) SetUser(name string, rules ...string) *errors.Error[AccessErr] {
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return errors.New(AccessErrInvalidRule, "invalid user name: %q", name)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	updated := newUser()
+	if existing, exists := self.users[name]; exists {
+		updated = existing.clone()
+	}
+	for _, rule := range rules {
+		if err := updated.applyRule(rule); err != nil {
+			return err
+		}
+	}
+
+	self.users[name] = updated
+	return nil
+}
+
+// DeleteUsers that exist, returning the number deleted. The default user cannot be deleted.
+func (self *ACL) DeleteUsers(names ...string) (int, *errors.Error[AccessErr]) {
+	if slices.Contains(names, DefaultUser) {
+		return 0, errors.New(AccessErrInvalidRule, "the 'default' user cannot be removed")
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var deleted int
+	for _, name := range names {
+		if _, exists := self.users[name]; exists {
+			delete(self.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// User rules by name.
+func (self *ACL) User(name string) (UserInfo, bool) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	user, exists := self.users[name]
+	if !exists {
+		return UserInfo{}, false //nolint:exhaustruct // reason: zero value for a user that does not exist
+	}
+	return user.info(name), true
+}
+
+// Users names, sorted.
+func (self *ACL) Users() []string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	names := make([]string, 0, len(self.users))
+	for name := range self.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List every user as a line of an ACL file, sorted by name.
+func (self *ACL) List() []string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	lines := make([]string, 0, len(self.users))
+	for name, user := range self.users {
+		lines = append(lines, "user "+name+" "+strings.Join(user.info(name).Rules(), " "))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Authenticate a user by password.
+// The same error is returned whether the user does not exist, is disabled or the password is wrong.
+func (self *ACL) Authenticate(name string, password string) *errors.Error[AccessErr] {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	user, exists := self.users[name]
+	if !exists || !user.enabled || !user.checkPassword(password) {
+		return errors.New(AccessErrWrongPass, "invalid username-password pair or user is disabled.")
+	}
+	return nil
+}
+
+// AuthenticateVerified user whose identity was verified by other means than a password, such as a client certificate.
+// Fails if the user does not exist or is disabled.
+func (self *ACL) AuthenticateVerified(name string) *errors.Error[AccessErr] {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	user, exists := self.users[name]
+	if !exists || !user.enabled {
+		return errors.New(AccessErrWrongPass, "invalid username or user is disabled.")
+	}
+	return nil
+}
+
+// Check that a user may run a command of a category on the keys.
+// The user is looked up on every check, so changes to a user apply to connections that are already authenticated.
+func (self *ACL) Check(name string, category Category, keys ...string) *errors.Error[AccessErr] {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	user, exists := self.users[name]
+	if !exists || !user.enabled {
+		return errors.New(AccessErrNoPermission, "user %s does not exist or is disabled", name)
+	}
+	if !user.categories[category] {
+		return errors.New(AccessErrNoPermission, "user %s has no permissions to run %s commands", name, category)
+	}
+	for _, key := range keys {
+		if !user.allowsKey(key) {
+			return errors.New(AccessErrNoPermission, "user %s has no permissions to access the '%s' key", name, key)
+		}
+	}
+	return nil
+}
+
+// AllowsKey returns true if the user exists, is enabled and may access the key.
+// This filters keys that are listed rather than named by a command, such as by SCAN.
+func (self *ACL) AllowsKey(name string, key string) bool {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	user, exists := self.users[name]
+	return exists && user.enabled && user.allowsKey(key)
+}
+
+// Load users from an ACL file, replacing every user. Each line is "user <name> <rules...>".
+// Empty lines and lines beginning with "#" are ignored. If the default user is not defined, it is created with its
+// usual rules. Either every user is loaded or, if any line is invalid, the users are left unchanged.
+func (self *ACL) Load(reader io.Reader) *errors.Error[AccessErr] {
+	users := map[string]*user{}
+
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 { //nolint:mnd // reason: user and name
+			return errors.New(AccessErrInvalidRule, "line %d: expected 'user <name> <rules...>'", lineNumber)
+		}
+
+		name := fields[1]
+		if _, exists := users[name]; exists {
+			return errors.New(AccessErrInvalidRule, "line %d: duplicate user '%s'", lineNumber, name)
+		}
+		loaded := newUser()
+		for _, rule := range fields[2:] {
+			if err := loaded.applyRule(rule); err != nil {
+				return errors.New(AccessErrInvalidRule, "line %d: %s", lineNumber, err.Error())
+			}
+		}
+		users[name] = loaded
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.NewFromError(AccessErrInternal, err)
+	}
+
+	if _, exists := users[DefaultUser]; !exists {
+		users[DefaultUser] = defaultUser()
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.users = users
+	return nil
+}
+
+// LoadFile of users, remembering the path for Reload and SaveFile.
+func (self *ACL) LoadFile(path string) *errors.Error[AccessErr] {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.NewFromError(AccessErrInternal, err)
+	}
+	defer file.Close()
+
+	if err := self.Load(file); err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.path = path
+	return nil
+}
+
+// Reload users from the file last loaded by LoadFile.
+func (self *ACL) Reload() *errors.Error[AccessErr] {
+	self.mutex.RLock()
+	path := self.path
+	self.mutex.RUnlock()
+
+	if path == "" {
+		return errors.New(AccessErrInternal, "no ACL file was loaded")
+	}
+	return self.LoadFile(path)
+}
+
+// SaveFile of every user to the file last loaded by LoadFile. The file is replaced atomically.
+func (self *ACL) SaveFile() *errors.Error[AccessErr] {
+	self.mutex.RLock()
+	path := self.path
+	self.mutex.RUnlock()
+
+	if path == "" {
+		return errors.New(AccessErrInternal, "no ACL file was loaded")
+	}
+
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, []byte(strings.Join(self.List(), "\n")+"\n"), 0o600); err != nil { //nolint:mnd // reason: file mode
+		return errors.NewFromError(AccessErrInternal, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return errors.NewFromError(AccessErrInternal, err)
+	}
+	return nil
+}
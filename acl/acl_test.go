@@ -0,0 +1,162 @@
+package acl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey/acl"
+)
+
+func Test_ACL_default(t *testing.T) {
+	t.Parallel()
+
+	users := acl.New()
+	assert.Equal(t, []string{"default"}, users.Users())
+	assert.Equal(t, []string{"user default on nopass ~* +@all"}, users.List())
+	require.Nil(t, users.Authenticate(acl.DefaultUser, "anything"))
+	require.Nil(t, users.Check(acl.DefaultUser, acl.CategoryAdmin, "any:key"))
+
+	_, err := users.DeleteUsers(acl.DefaultUser)
+	require.NotNil(t, err)
+	assert.Equal(t, acl.AccessErrInvalidRule, err.Cause)
+}
+
+func Test_ACL_SetUser(t *testing.T) {
+	t.Parallel()
+
+	users := acl.New()
+	require.Nil(t, users.SetUser("alice", "on", ">secret", "~session:*", "~cache:*", "+@read"))
+
+	{
+		err := users.Authenticate("alice", "wrong")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrWrongPass, err.Cause)
+		require.Nil(t, users.Authenticate("alice", "secret"))
+
+		err = users.Authenticate("bob", "secret")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrWrongPass, err.Cause)
+
+		require.Nil(t, users.AuthenticateVerified("alice"))
+		err = users.AuthenticateVerified("bob")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrWrongPass, err.Cause)
+	}
+
+	{
+		require.Nil(t, users.Check("alice", acl.CategoryRead, "session:1", "cache:2"))
+
+		err := users.Check("alice", acl.CategoryRead, "session:1", "other:1")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrNoPermission, err.Cause)
+		assert.Contains(t, err.Error(), "'other:1'")
+
+		err = users.Check("alice", acl.CategoryWrite, "session:1")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrNoPermission, err.Cause)
+
+		assert.True(t, users.AllowsKey("alice", "session:1"))
+		assert.False(t, users.AllowsKey("alice", "other:1"))
+	}
+
+	{
+		user, exists := users.User("alice")
+		require.True(t, exists)
+		assert.True(t, user.Enabled)
+		assert.False(t, user.NoPass)
+		assert.Len(t, user.Passwords, 1)
+		assert.NotContains(t, user.Passwords[0], "secret")
+		assert.Equal(t, []acl.Category{acl.CategoryRead}, user.Categories)
+		assert.Equal(t, []string{"session:*", "cache:*"}, user.KeyPatterns)
+	}
+
+	// Invalid rules leave the user unchanged.
+	{
+		err := users.SetUser("alice", "+@write", "+@unknown")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrInvalidRule, err.Cause)
+		require.NotNil(t, users.Check("alice", acl.CategoryWrite, "session:1"))
+
+		err = users.SetUser("alice", "<wrong")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrInvalidRule, err.Cause)
+
+		err = users.SetUser("alice", "#nothex")
+		require.NotNil(t, err)
+		assert.Equal(t, acl.AccessErrInvalidRule, err.Cause)
+	}
+
+	// Changes apply to users that are already authenticated.
+	{
+		require.Nil(t, users.SetUser("alice", "off"))
+		require.NotNil(t, users.Check("alice", acl.CategoryRead, "session:1"))
+		require.NotNil(t, users.Authenticate("alice", "secret"))
+		require.NotNil(t, users.AuthenticateVerified("alice"))
+
+		require.Nil(t, users.SetUser("alice", "on", "<secret", ">other", "+@all", "-@admin", "allkeys"))
+		require.NotNil(t, users.Authenticate("alice", "secret"))
+		require.Nil(t, users.Authenticate("alice", "other"))
+		require.Nil(t, users.Check("alice", acl.CategoryWrite, "other:1"))
+		require.NotNil(t, users.Check("alice", acl.CategoryAdmin))
+
+		require.Nil(t, users.SetUser("alice", "reset"))
+		user, exists := users.User("alice")
+		require.True(t, exists)
+		assert.Equal(t, []string{"off", "resetkeys", "-@all"}, user.Rules())
+	}
+
+	{
+		deleted, err := users.DeleteUsers("alice", "bob")
+		require.Nil(t, err)
+		assert.Equal(t, 1, deleted)
+		_, exists := users.User("alice")
+		assert.False(t, exists)
+	}
+}
+
+func Test_ACL_LoadFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "users.acl")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join([]string{
+		"# Teams may only access their own keys.",
+		"user default off",
+		"",
+		"user alice on >secret ~team-a:* +@read +@write",
+		"user admin on >admin ~* +@all",
+	}, "\n")), 0o600))
+
+	users := acl.New()
+	require.Nil(t, users.LoadFile(path))
+	assert.Equal(t, []string{"admin", "alice", "default"}, users.Users())
+	require.NotNil(t, users.Authenticate(acl.DefaultUser, ""))
+	require.Nil(t, users.Authenticate("alice", "secret"))
+	require.Nil(t, users.Check("alice", acl.CategoryWrite, "team-a:1"))
+	require.NotNil(t, users.Check("alice", acl.CategoryRead, "team-b:1"))
+
+	// Saved users are loaded the same.
+	require.Nil(t, users.SetUser("bob", "on", "nopass", "~team-b:*", "+@read"))
+	require.Nil(t, users.SaveFile())
+	expected := users.List()
+	require.Nil(t, users.SetUser("carol", "on"))
+	require.Nil(t, users.Reload())
+	assert.Equal(t, expected, users.List())
+	require.Nil(t, users.Authenticate("alice", "secret"))
+
+	// An invalid file leaves the users unchanged.
+	require.NoError(t, os.WriteFile(path, []byte("user alice on\nuser bob +@nothing\n"), 0o600))
+	err := users.Reload()
+	require.NotNil(t, err)
+	assert.Equal(t, acl.AccessErrInvalidRule, err.Cause)
+	assert.Contains(t, err.Error(), "line 2")
+	assert.Equal(t, expected, users.List())
+
+	// The default user keeps its usual rules if the file does not define it.
+	require.Nil(t, users.Load(strings.NewReader("user alice on nopass\n")))
+	require.Nil(t, users.Check(acl.DefaultUser, acl.CategoryAdmin))
+}
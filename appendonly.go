@@ -0,0 +1,551 @@
+package datkey
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// The append only file is a snapshot followed by a record of every modification since the snapshot was taken:
+//
+//	record:  record type (byte) | payload length (uvarint) | payload | crc32 of payload (uint32)
+//
+// Records hold the effect of a command rather than the command itself, so that replaying them does not depend on
+// when they are replayed. Every deadline is absolute and every record is idempotent:
+//
+//	put:       the full value of a key, encoded as a snapshot entry
+//	delete:    key length (uvarint) | key
+//	expireAt:  key length (uvarint) | key | expiresAt in unix nanoseconds, 0 if none (varint)
+//
+// Since a put holds the full value, large values that are modified often grow the log quickly until it is rewritten.
+
+type AppendFsyncMode string
+
+const (
+	// AppendFsyncAlways syncs the log to disk before each command returns.
+	AppendFsyncAlways = AppendFsyncMode("always")
+	// AppendFsyncEverySec syncs the log to disk once per second, so at most a second of commands may be lost.
+	AppendFsyncEverySec = AppendFsyncMode("everysec")
+	// AppendFsyncNo leaves syncing the log to disk to the operating system.
+	AppendFsyncNo = AppendFsyncMode("no")
+)
+
+const (
+	appendOnlyRecordPut      = 0x01
+	appendOnlyRecordDelete   = 0x02
+	appendOnlyRecordExpireAt = 0x03
+
+	appendOnlyDefaultRewriteMinBytes = 64 * 1024 * 1024
+	// appendOnlyRewriteGrowth of the log since the last rewrite that triggers a rewrite.
+	appendOnlyRewriteGrowth = 2
+)
+
+type commandReplayAppendOnly struct {
+	Resp   empty
+	Record appendOnlyRecord
+	// Raw encoding of a record received from a primary, which is logged as is once applied. Nil on replay.
+	Raw []byte
+}
+
+type appendOnlyRecord struct {
+	expiresAt  time.Time
+	key        string
+	data       keyStorage
+	recordType byte
+}
+
+// RewriteAppendOnly compacts the append only file into a snapshot of the current keys.
+// Rewrites also happen automatically as the log grows.
+func (self *Datkey) RewriteAppendOnly() *errors.Error[DbWriteErr] {
+	if self.appendOnly == nil {
+		return errors.New(DbWriteInvalidArgument, "append only file is not enabled")
+	}
+	return self.appendOnly.rewrite()
+}
+
+// appendOnlyFile logs modifications to the file at path. All methods are safe to call concurrently.
+type appendOnlyFile struct {
+	file         *os.File
+	cache        cacheStorage
+	errorHandler func(err error)
+	path         string
+	fsync        AppendFsyncMode
+	// rewriteBuffer holds the records logged while a rewrite is in progress, which must also be added to the rewritten log.
+	rewriteBuffer []byte
+	size          int64
+	// rewriteSize is the size of the log that triggers the next automatic rewrite.
+	rewriteSize     int64
+	rewriteMinBytes int64
+	rewrites        sync.WaitGroup
+	// rewriteMutex allows only one rewrite at a time.
+	rewriteMutex sync.Mutex
+	mutex        sync.Mutex
+	rewriting    bool
+	unsynced     bool
+}
+
+// openAppendOnlyFile replays the log at the configured path, if it exists, and then rewrites it to start a new log.
+func openAppendOnlyFile(config Config, cache cacheStorage) *appendOnlyFile {
+	self := &appendOnlyFile{
+		file:            nil,
+		cache:           cache,
+		errorHandler:    config.PersistenceErrorHandler,
+		path:            config.AppendOnlyPath,
+		fsync:           config.AppendFsync,
+		rewriteBuffer:   nil,
+		size:            0,
+		rewriteSize:     0,
+		rewriteMinBytes: config.AppendOnlyRewriteMinBytes,
+		rewrites:        sync.WaitGroup{},
+		rewriteMutex:    sync.Mutex{},
+		mutex:           sync.Mutex{},
+		rewriting:       false,
+		unsynced:        false,
+	}
+
+	if err := replayAppendOnlyFile(config.AppendOnlyPath, cache); err != nil {
+		self.errorHandler(err)
+		// Keep the corrupt log for inspection since the rewrite replaces it with only what could be replayed.
+		if renameErr := os.Rename(config.AppendOnlyPath, config.AppendOnlyPath+".corrupt"); renameErr != nil {
+			self.errorHandler(renameErr)
+		}
+	}
+
+	if err := self.rewrite(); err != nil {
+		self.errorHandler(err)
+	}
+
+	return self
+}
+
+// replayAppendOnlyFile at path into the cache, if it exists.
+// A record cut short at the end of the log is expected after a crash and is ignored.
+func replayAppendOnlyFile(path string, cache cacheStorage) *errors.Error[DbWriteErr] {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if err := readSnapshotSections(reader, snapshotFormatFull, cache, nil); err != nil {
+		return err
+	}
+
+	for {
+		record, _, err := readAppendOnlyRecord(reader)
+		if err == io.EOF { //nolint:errorlint // reason: io.EOF is returned unwrapped
+			return nil
+		}
+		var recordErr *errors.Error[DbWriteErr]
+		if errors.As(err, &recordErr) {
+			return recordErr
+		} else if err != nil {
+			return nil //nolint:nilerr // reason: the last record was cut short
+		}
+
+		cache.runCommand(cache.slotOf(record.key), commandReplayAppendOnly{
+			Resp:   empty{},
+			Record: record,
+			Raw:    nil,
+		})
+	}
+}
+
+// readAppendOnlyRecord from the reader, returning the record and the length of its encoding. Returns io.EOF if the
+// reader ends before the record, an *errors.Error if the record is corrupt, and any other error if the record was cut short.
+func readAppendOnlyRecord(reader *bufio.Reader) (appendOnlyRecord, int, error) {
+	recordType, payload, length, err := readAppendOnlyFrame(reader)
+	if err != nil {
+		return appendOnlyRecord{}, 0, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	record, decodeErr := decodeAppendOnlyRecord(recordType, payload)
+	if decodeErr != nil {
+		return appendOnlyRecord{}, 0, decodeErr //nolint:exhaustruct // reason: zero value on error
+	}
+	return record, length, nil
+}
+
+// readAppendOnlyFrame of a record from the reader, verifying its checksum, and returning the record type, the payload
+// and the length of the frame. Returns io.EOF if the reader ends before the frame.
+func readAppendOnlyFrame(reader *bufio.Reader) (byte, []byte, int, error) {
+	recordType, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, 0, err //nolint:wrapcheck // reason: io.EOF is returned unwrapped
+	}
+
+	payloadLength, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, nil, 0, cutShort(err)
+	}
+
+	payload := make([]byte, 0, min(payloadLength, uint64(reader.Size())))
+	payload, err = readAppendOnlyPayload(reader, payload, payloadLength)
+	if err != nil {
+		return 0, nil, 0, cutShort(err)
+	}
+
+	checksum := make([]byte, 4) //nolint:mnd // reason: size of a crc32
+	if _, err := io.ReadFull(reader, checksum); err != nil {
+		return 0, nil, 0, cutShort(err)
+	}
+	if binary.BigEndian.Uint32(checksum) != crc32.ChecksumIEEE(payload) {
+		return 0, nil, 0, errors.New(DbWriteInvalidArgument, "append only record checksum mismatch")
+	}
+
+	length := 1 + len(binary.AppendUvarint(nil, payloadLength)) + len(payload) + len(checksum)
+	return recordType, payload, length, nil
+}
+
+// cutShort as io.ErrUnexpectedEOF if the reader ended within a record.
+func cutShort(err error) error {
+	if err == io.EOF { //nolint:errorlint // reason: io.EOF is returned unwrapped
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readAppendOnlyPayload of the given length, growing the buffer as data is read so that a corrupt length cannot allocate more than the log holds.
+func readAppendOnlyPayload(reader io.Reader, payload []byte, length uint64) ([]byte, error) {
+	for uint64(len(payload)) < length {
+		chunk := min(length-uint64(len(payload)), uint64(bufio.MaxScanTokenSize))
+		start := len(payload)
+		payload = append(payload, make([]byte, chunk)...)
+		if _, err := io.ReadFull(reader, payload[start:]); err != nil {
+			return nil, err //nolint:wrapcheck // reason: only used to detect the end of the log
+		}
+	}
+	return payload, nil
+}
+
+func decodeAppendOnlyRecord(recordType byte, payload []byte) (appendOnlyRecord, *errors.Error[DbWriteErr]) {
+	decoder := &snapshotDecoder{
+		err:     nil,
+		payload: payload,
+	}
+
+	record := appendOnlyRecord{
+		expiresAt:  time.Time{},
+		key:        "",
+		data:       keyStorage{}, //nolint:exhaustruct // reason: only set for puts
+		recordType: recordType,
+	}
+
+	switch recordType {
+	case appendOnlyRecordPut:
+		entry := decodeSnapshotEntry(decoder, snapshotFormatFull)
+		record.key = entry.key
+		record.data = entry.data
+	case appendOnlyRecordDelete:
+		record.key = string(decoder.bytes())
+	case appendOnlyRecordExpireAt:
+		record.key = string(decoder.bytes())
+		if unixNano := decoder.varint(); unixNano != 0 {
+			record.expiresAt = time.Unix(0, unixNano)
+		}
+	default:
+		decoder.fail()
+	}
+
+	if decoder.err == nil && len(decoder.payload) != 0 {
+		decoder.fail()
+	}
+
+	return record, decoder.err
+}
+
+func (self *slotStorage) handleCommandReplayAppendOnly(cmd commandReplayAppendOnly) {
+	record := cmd.Record
+	previousData, exists := self.storage[record.key]
+
+	switch record.recordType {
+	case appendOnlyRecordPut:
+		self.sizeInBytes += record.data.sizeInBytes() - previousData.sizeInBytes()
+		self.storage[record.key] = record.data
+	case appendOnlyRecordDelete:
+		if exists {
+			self.sizeInBytes -= previousData.sizeInBytes()
+			delete(self.storage, record.key)
+		}
+	case appendOnlyRecordExpireAt:
+		if exists {
+			previousData.expiresAt = record.expiresAt
+			self.storage[record.key] = previousData
+		}
+	}
+
+	if cmd.Raw != nil {
+		self.logReplicated(cmd.Raw)
+		self.notifyRecord(record, exists)
+	}
+}
+
+// notifyRecord of a record received from a primary, as the command that made the change would have.
+func (self *slotStorage) notifyRecord(record appendOnlyRecord, exists bool) {
+	switch record.recordType {
+	case appendOnlyRecordPut:
+		self.notifier.notify(KeyspaceEventSet, record.key)
+	case appendOnlyRecordDelete:
+		if exists {
+			self.notifier.notify(KeyspaceEventDel, record.key)
+		}
+	case appendOnlyRecordExpireAt:
+		if !exists {
+			return
+		}
+		if record.expiresAt.IsZero() {
+			self.notifier.notify(KeyspaceEventPersist, record.key)
+		} else {
+			self.notifier.notify(KeyspaceEventExpire, record.key)
+		}
+	}
+}
+
+// logging of modifications, if the append only file is enabled or modifications are recorded for replicas.
+func (self *slotStorage) logging() bool {
+	return self.appendOnly != nil || self.backlog.recording()
+}
+
+// logPut of the full value of a key, if logging is enabled.
+func (self *slotStorage) logPut(key string, data keyStorage) {
+	if !self.logging() {
+		return
+	}
+	self.log(encodeAppendOnlyRecord(appendOnlyRecordPut, appendSnapshotEntry(nil, key, data, snapshotFormatFull)))
+}
+
+// logDelete of a key, if logging is enabled.
+func (self *slotStorage) logDelete(key string) {
+	if !self.logging() {
+		return
+	}
+	self.log(encodeAppendOnlyRecord(appendOnlyRecordDelete, appendSnapshotBytes(nil, []byte(key))))
+}
+
+// logExpireAt of a key, if logging is enabled. A zero expiresAt persists the key.
+func (self *slotStorage) logExpireAt(key string, expiresAt time.Time) {
+	if !self.logging() {
+		return
+	}
+
+	var unixNano int64
+	if !expiresAt.IsZero() {
+		unixNano = expiresAt.UnixNano()
+	}
+	self.log(encodeAppendOnlyRecord(appendOnlyRecordExpireAt, binary.AppendVarint(appendSnapshotBytes(nil, []byte(key)), unixNano)))
+}
+
+// log a record of a modification made by a command to the append only file and the replication backlog.
+func (self *slotStorage) log(record []byte) {
+	if self.appendOnly != nil {
+		self.appendOnly.append(record)
+	}
+	if self.backlog.recording() {
+		self.backlog.append(record)
+	}
+}
+
+// logReplicated record received from a primary to the append only file and the replication backlog, so that the
+// backlog of a replica matches the backlog of its primary.
+func (self *slotStorage) logReplicated(record []byte) {
+	if self.appendOnly != nil {
+		self.appendOnly.append(record)
+	}
+	self.backlog.append(record)
+}
+
+// encodeAppendOnlyRecord with its type, length and checksum.
+func encodeAppendOnlyRecord(recordType byte, payload []byte) []byte {
+	record := []byte{recordType}
+	record = binary.AppendUvarint(record, uint64(len(payload)))
+	record = append(record, payload...)
+	return binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+}
+
+// append a record to the log. Records are appended under the slot lock, so records for each key are in order.
+func (self *appendOnlyFile) append(record []byte) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.file == nil {
+		return
+	}
+
+	if self.rewriting {
+		self.rewriteBuffer = append(self.rewriteBuffer, record...)
+	}
+
+	written, err := self.file.Write(record)
+	self.size += int64(written)
+	if err != nil {
+		self.errorHandler(err)
+		return
+	}
+
+	if self.fsync == AppendFsyncAlways {
+		if err := self.file.Sync(); err != nil {
+			self.errorHandler(err)
+		}
+	} else {
+		self.unsynced = true
+	}
+
+	if !self.rewriting && self.size >= self.rewriteSize {
+		// Mark the rewrite as started now so that only one is started.
+		self.rewriting = true
+		self.rewrites.Add(1)
+		go func() {
+			defer self.rewrites.Done()
+			if err := self.rewrite(); err != nil {
+				self.errorHandler(err)
+			}
+		}()
+	}
+}
+
+// rewrite the log as a snapshot of the current keys followed by the records logged while the snapshot was taken.
+// Records logged during the snapshot may already be in the snapshot, but records are idempotent so replaying them again is safe.
+func (self *appendOnlyFile) rewrite() *errors.Error[DbWriteErr] {
+	self.rewriteMutex.Lock()
+	defer self.rewriteMutex.Unlock()
+
+	self.mutex.Lock()
+	self.rewriting = true
+	self.rewriteBuffer = nil
+	self.mutex.Unlock()
+
+	file, err := os.CreateTemp(filepath.Dir(self.path), filepath.Base(self.path)+".tmp*")
+	if err != nil {
+		self.abortRewrite()
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+	defer os.Remove(file.Name()) //nolint:errcheck // reason: the file no longer exists once renamed
+
+	if snapshotErr := writeSnapshot(file, snapshotFormatFull, self.cache.allSlots(), self.cache); snapshotErr != nil {
+		_ = file.Close()
+		self.abortRewrite()
+		return errors.New(DbWriteInternal, "%s", snapshotErr)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.rewriting = false
+	rewriteBuffer := self.rewriteBuffer
+	self.rewriteBuffer = nil
+
+	if _, err := file.Write(rewriteBuffer); err != nil {
+		_ = file.Close()
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+	if err := file.Chmod(snapshotFileMode); err != nil {
+		_ = file.Close()
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+	if err := os.Rename(file.Name(), self.path); err != nil {
+		_ = file.Close()
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+
+	if self.file != nil {
+		_ = self.file.Close()
+	}
+	self.file = file
+
+	info, err := file.Stat()
+	if err != nil {
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+	self.size = info.Size()
+	self.rewriteSize = max(self.size*appendOnlyRewriteGrowth, self.rewriteMinBytes)
+	self.unsynced = false
+
+	return nil
+}
+
+func (self *appendOnlyFile) abortRewrite() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.rewriting = false
+	self.rewriteBuffer = nil
+}
+
+func (self *appendOnlyFile) sync() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.file == nil || !self.unsynced {
+		return
+	}
+	if err := self.file.Sync(); err != nil {
+		self.errorHandler(err)
+		return
+	}
+	self.unsynced = false
+}
+
+// close the log once any rewrite has finished, syncing any remaining records.
+func (self *appendOnlyFile) close() {
+	self.rewrites.Wait()
+
+	self.rewriteMutex.Lock()
+	defer self.rewriteMutex.Unlock()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.file == nil {
+		return
+	}
+	if err := self.file.Sync(); err != nil {
+		self.errorHandler(err)
+	}
+	if err := self.file.Close(); err != nil {
+		self.errorHandler(err)
+	}
+	self.file = nil
+}
+
+func startAppendOnlyWorker(ctx context.Context, config Config, appendOnly *appendOnlyFile) <-chan struct{} {
+	done := make(chan struct{})
+	if appendOnly == nil {
+		close(done)
+		return done
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				appendOnly.close()
+				close(done)
+				return
+			case <-ticker.C:
+				if config.AppendFsync == AppendFsyncEverySec {
+					appendOnly.sync()
+				}
+			}
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,202 @@
+package datkey_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func appendOnlyConfig(t *testing.T, fsync datkey.AppendFsyncMode) datkey.Config {
+	t.Helper()
+
+	var config datkey.Config
+	config.AppendOnlyPath = filepath.Join(t.TempDir(), "datkey.aof")
+	config.AppendFsync = fsync
+	config.PersistenceErrorHandler = func(err error) {
+		t.Error(err)
+	}
+	return config
+}
+
+func TestDatkey_AppendOnly_replay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	for _, fsync := range []datkey.AppendFsyncMode{datkey.AppendFsyncAlways, datkey.AppendFsyncEverySec, datkey.AppendFsyncNo} {
+		t.Run(string(fsync), func(t *testing.T) {
+			t.Parallel()
+
+			config := appendOnlyConfig(t, fsync)
+
+			client := datkey.New(config)
+			client.Set(ctx, "string", []byte("value"), 0)
+			client.Set(ctx, "ttl", []byte("value"), time.Hour)
+			client.Set(ctx, "deleted", []byte("value"), 0)
+			client.Delete(ctx, "deleted")
+			client.Set(ctx, "persisted", []byte("value"), time.Hour)
+			client.Persist(ctx, "persisted")
+			client.Set(ctx, "expired", []byte("value"), 0)
+			client.Expire(ctx, "expired", 50*time.Millisecond)
+			_, err := client.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1}, datkey.ZMember{Member: "b", Score: 2})
+			require.Nil(t, err)
+			_, err = client.ZRem(ctx, "zset", "a")
+			require.Nil(t, err)
+			_, err = client.JSONSet(ctx, "json", "$", []byte(`{"count":1}`), datkey.JSONSetAlways)
+			require.Nil(t, err)
+			_, err = client.JSONNumIncrBy(ctx, "json", "$.count", 2)
+			require.Nil(t, err)
+			_, err = client.SetBit(ctx, "bits", 7, true)
+			require.Nil(t, err)
+			client.Close()
+
+			time.Sleep(100 * time.Millisecond)
+
+			restored := datkey.New(config)
+			defer restored.Close()
+
+			{
+				result, err := restored.Get(ctx, "string")
+				require.Nil(t, err)
+				assert.Equal(t, []byte("value"), result.Value)
+			}
+
+			{
+				// Deadlines are absolute, so the remaining ttl does not restart on replay.
+				result, err := restored.Ttl(ctx, "ttl")
+				require.Nil(t, err)
+				assert.True(t, result.Exists)
+				assert.Less(t, result.Ttl, time.Hour)
+				assert.Greater(t, result.Ttl, 59*time.Minute)
+			}
+
+			{
+				result, err := restored.Ttl(ctx, "persisted")
+				require.Nil(t, err)
+				assert.True(t, result.Exists)
+				assert.Equal(t, time.Duration(0), result.Ttl)
+			}
+
+			assert.False(t, typeOf(t, restored, "deleted").Exists)
+			assert.False(t, typeOf(t, restored, "expired").Exists)
+
+			{
+				result, err := restored.ZRangeByScore(ctx, "zset", datkey.ScoreRange{Min: 0, Max: 10, MinExclusive: false, MaxExclusive: false})
+				require.Nil(t, err)
+				assert.Equal(t, []datkey.ZMember{{Member: "b", Score: 2}}, result.Members)
+			}
+
+			{
+				result, err := restored.JSONGet(ctx, "json")
+				require.Nil(t, err)
+				assert.JSONEq(t, `[{"count":3}]`, string(result.Value))
+			}
+
+			{
+				result, err := restored.Get(ctx, "bits")
+				require.Nil(t, err)
+				assert.Equal(t, []byte{1}, result.Value)
+			}
+		})
+	}
+}
+
+func TestDatkey_AppendOnly_rewrite(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	config := appendOnlyConfig(t, datkey.AppendFsyncNo)
+	config.AppendOnlyRewriteMinBytes = 4096
+
+	client := datkey.New(config)
+	for index := range 10000 {
+		client.Set(ctx, "counter", []byte(strconv.Itoa(index)), 0)
+	}
+
+	// The log is rewritten automatically as it grows, and is compacted to only the current keys.
+	require.Nil(t, client.RewriteAppendOnly())
+	info, err := os.Stat(config.AppendOnlyPath)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(64))
+
+	client.Set(ctx, "after", []byte("value"), 0)
+	client.Close()
+
+	restored := datkey.New(config)
+	defer restored.Close()
+
+	{
+		result, err := restored.Get(ctx, "counter")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("9999"), result.Value)
+	}
+
+	{
+		result, err := restored.Get(ctx, "after")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("value"), result.Value)
+	}
+}
+
+func TestDatkey_AppendOnly_truncated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	config := appendOnlyConfig(t, datkey.AppendFsyncAlways)
+
+	client := datkey.New(config)
+	client.Set(ctx, "first", []byte("value"), 0)
+	client.Set(ctx, "second", []byte("value"), 0)
+	client.Close()
+
+	// A crash while appending leaves the last record cut short.
+	info, err := os.Stat(config.AppendOnlyPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(config.AppendOnlyPath, info.Size()-3))
+
+	restored := datkey.New(config)
+	defer restored.Close()
+
+	assert.True(t, typeOf(t, restored, "first").Exists)
+	assert.False(t, typeOf(t, restored, "second").Exists)
+}
+
+func TestDatkey_AppendOnly_corrupt(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	config := appendOnlyConfig(t, datkey.AppendFsyncAlways)
+
+	client := datkey.New(config)
+	client.Set(ctx, "first", []byte("value"), 0)
+	client.Set(ctx, "second", []byte("value"), 0)
+	client.Close()
+
+	contents, err := os.ReadFile(config.AppendOnlyPath)
+	require.NoError(t, err)
+	// Corrupt the value of the last record.
+	contents[len(contents)-6] ^= 0xff
+	require.NoError(t, os.WriteFile(config.AppendOnlyPath, contents, 0o600))
+
+	var errs []error
+	config.PersistenceErrorHandler = func(err error) {
+		errs = append(errs, err)
+	}
+
+	restored := datkey.New(config)
+	defer restored.Close()
+
+	require.Len(t, errs, 1)
+	assert.True(t, typeOf(t, restored, "first").Exists)
+	assert.False(t, typeOf(t, restored, "second").Exists)
+
+	_, err = os.Stat(config.AppendOnlyPath + ".corrupt")
+	require.NoError(t, err)
+}
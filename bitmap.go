@@ -0,0 +1,798 @@
+package datkey
+
+import (
+	"context"
+	"math/big"
+	"math/bits"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+const (
+	bitsPerByte = 8
+	// maxBitOffset limits bitmaps to 512MB, the same as redis.
+	maxBitOffset = 1<<32 - 1
+	// maxBitFieldBits is the widest signed integer field. Unsigned fields are limited to one less bit so they fit in an int64.
+	maxBitFieldBits = 64
+)
+
+type BitRangeUnit string
+
+const (
+	BitRangeByte = BitRangeUnit("byte")
+	BitRangeBit  = BitRangeUnit("bit")
+)
+
+// BitRange of a value, inclusive on both ends.
+// Negative positions count backwards from the end of the value, where -1 is the last byte (or bit).
+type BitRange struct {
+	// Unit of Start and End.
+	// Default: BitRangeByte
+	Unit  BitRangeUnit
+	Start int64
+	End   int64
+}
+
+type BitOperation string
+
+const (
+	BitOpAnd = BitOperation("and")
+	BitOpOr  = BitOperation("or")
+	BitOpXor = BitOperation("xor")
+	BitOpNot = BitOperation("not")
+)
+
+type BitFieldOpKind string
+
+const (
+	BitFieldGet    = BitFieldOpKind("get")
+	BitFieldSet    = BitFieldOpKind("set")
+	BitFieldIncrBy = BitFieldOpKind("incrby")
+)
+
+type BitFieldOverflow string
+
+const (
+	// BitFieldWrap wraps around on overflow, like normal integer arithmetic.
+	BitFieldWrap = BitFieldOverflow("wrap")
+	// BitFieldSat saturates at the minimum or maximum value of the field.
+	BitFieldSat = BitFieldOverflow("sat")
+	// BitFieldFail leaves the field unchanged and reports the failure in the result.
+	BitFieldFail = BitFieldOverflow("fail")
+)
+
+// BitFieldType of an integer field. Signed fields may be 1 to 64 bits and unsigned fields 1 to 63 bits.
+type BitFieldType struct {
+	Bits   uint8
+	Signed bool
+}
+
+type BitFieldOp struct {
+	Kind BitFieldOpKind
+	// Overflow behavior of set and incrby operations.
+	// Default: BitFieldWrap
+	Overflow BitFieldOverflow
+	Type     BitFieldType
+	// Offset, in bits, of the field.
+	Offset int64
+	// Value to set, or increment by.
+	Value int64
+}
+
+type commandSetBit struct {
+	Resp   *integerResponse
+	Key    string
+	Offset int64
+	Value  bool
+}
+
+type SetBitResponse struct {
+	PreviousValue bool
+	Exists        bool
+}
+
+type commandGetBit struct {
+	Resp   *integerResponse
+	Key    string
+	Offset int64
+}
+
+type GetBitResponse struct {
+	Value  bool
+	Exists bool
+}
+
+type commandBitCount struct {
+	Resp  *integerResponse
+	Range *BitRange
+	Key   string
+}
+
+type BitCountResponse struct {
+	Count  int64
+	Exists bool
+}
+
+type commandBitPos struct {
+	Resp  *integerResponse
+	Range *BitRange
+	Key   string
+	Bit   bool
+}
+
+type BitPosResponse struct {
+	// Position of the first matching bit, or -1 if there is none.
+	Position int64
+	Exists   bool
+}
+
+type BitOpResponse struct {
+	// Size, in bytes, of the value stored at the destination key.
+	Size int64
+}
+
+type commandBitField struct {
+	Resp *bitFieldResponse
+	Key  string
+	Ops  []BitFieldOp
+}
+
+type bitFieldResponse struct {
+	Results   []BitFieldResult
+	WrongType bool
+}
+
+type BitFieldResult struct {
+	Value int64
+	// Failed is true when the operation overflowed with BitFieldFail and the field was left unchanged.
+	Failed bool
+}
+
+type BitFieldResponse struct {
+	Results []BitFieldResult
+}
+
+// SetBit at offset in the value of a key, growing the value as needed.
+func (self *Datkey) SetBit(ctx context.Context, key string, offset int64, value bool) (SetBitResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return SetBitResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return setBitKey(key, offset, value, self.cache.forContext(ctx))
+}
+
+// GetBit at offset in the value of a key. Bits beyond the end of the value are zero.
+func (self *Datkey) GetBit(ctx context.Context, key string, offset int64) (GetBitResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return GetBitResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return getBitKey(key, offset, self.cache.forContext(ctx))
+}
+
+// BitCount of the set bits in the value of a key.
+func (self *Datkey) BitCount(ctx context.Context, key string) (BitCountResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return BitCountResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return bitCountKey(key, nil, self.cache.forContext(ctx))
+}
+
+// BitCountRange of the set bits in a range of the value of a key.
+func (self *Datkey) BitCountRange(ctx context.Context, key string, bitRange BitRange) (BitCountResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return BitCountResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	if err := validateBitRange(bitRange); err != nil {
+		return BitCountResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return bitCountKey(key, &bitRange, self.cache.forContext(ctx))
+}
+
+// BitPos of the first bit set to bit in the value of a key.
+// When searching for a clear bit in a value that has none, the position just past the end of the value is returned.
+func (self *Datkey) BitPos(ctx context.Context, key string, bit bool) (BitPosResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return BitPosResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return bitPosKey(key, bit, nil, self.cache.forContext(ctx))
+}
+
+// BitPosRange of the first bit set to bit within a range of the value of a key.
+func (self *Datkey) BitPosRange(ctx context.Context, key string, bit bool, bitRange BitRange) (BitPosResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return BitPosResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	if err := validateBitRange(bitRange); err != nil {
+		return BitPosResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return bitPosKey(key, bit, &bitRange, self.cache.forContext(ctx))
+}
+
+// BitOp performs a bitwise operation across the values of the source keys and stores the result in destKey.
+// Shorter values are treated as zero padded. BitOpNot takes exactly one source key.
+// The source keys are read before the destination is written, so the operation is not atomic across keys.
+func (self *Datkey) BitOp(ctx context.Context, op BitOperation, destKey string, srcKeys ...string) (BitOpResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return BitOpResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return bitOpKeys(op, destKey, srcKeys, self.cache.forContext(ctx))
+}
+
+// BitField runs get, set, and incrby operations on integer fields in the value of a key.
+// All operations are run atomically and there is one result per operation.
+func (self *Datkey) BitField(ctx context.Context, key string, ops ...BitFieldOp) (BitFieldResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return BitFieldResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return bitFieldKey(key, ops, self.cache.forContext(ctx))
+}
+
+func validateBitOffset(offset int64) bool {
+	return 0 <= offset && offset <= maxBitOffset
+}
+
+func validateBitRange(bitRange BitRange) *errors.Error[DbReadErr] {
+	switch bitRange.Unit {
+	case "", BitRangeByte, BitRangeBit:
+		return nil
+	default:
+		return errors.New(DbReadInvalidArgument, "invalid bit range unit: %s", bitRange.Unit)
+	}
+}
+
+func validateBitFieldOp(op BitFieldOp) *errors.Error[DbWriteErr] {
+	switch op.Kind {
+	case BitFieldGet, BitFieldSet, BitFieldIncrBy:
+	default:
+		return errors.New(DbWriteInvalidArgument, "invalid bitfield operation: %s", op.Kind)
+	}
+
+	switch op.Overflow {
+	case "", BitFieldWrap, BitFieldSat, BitFieldFail:
+	default:
+		return errors.New(DbWriteInvalidArgument, "invalid bitfield overflow: %s", op.Overflow)
+	}
+
+	maxBits := uint8(maxBitFieldBits)
+	if !op.Type.Signed {
+		maxBits--
+	}
+	if op.Type.Bits == 0 || op.Type.Bits > maxBits {
+		return errors.New(DbWriteInvalidArgument, "invalid bitfield type: signed=%t bits=%d", op.Type.Signed, op.Type.Bits)
+	}
+
+	if op.Offset < 0 || !validateBitOffset(op.Offset+int64(op.Type.Bits)-1) {
+		return errors.New(DbWriteInvalidArgument, "bitfield offset is out of range: %d", op.Offset)
+	}
+
+	return nil
+}
+
+func setBitKey(key string, offset int64, value bool, cache cacheStorage) (SetBitResponse, *errors.Error[DbWriteErr]) {
+	if !validateBitOffset(offset) {
+		return SetBitResponse{}, errors.New(DbWriteInvalidArgument, "bit offset is out of range: %d", offset) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandSetBit{
+		Key:    key,
+		Offset: offset,
+		Value:  value,
+		Resp:   resp,
+	})
+	if redirect != nil {
+		return SetBitResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return SetBitResponse{}, errors.New(DbWriteWrongType, "key does not hold a string value: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return SetBitResponse{
+		PreviousValue: resp.Value == 1,
+		Exists:        resp.Exists,
+	}, nil
+}
+
+func getBitKey(key string, offset int64, cache cacheStorage) (GetBitResponse, *errors.Error[DbReadErr]) {
+	if !validateBitOffset(offset) {
+		return GetBitResponse{}, errors.New(DbReadInvalidArgument, "bit offset is out of range: %d", offset) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandGetBit{
+		Key:    key,
+		Offset: offset,
+		Resp:   resp,
+	})
+	if redirect != nil {
+		return GetBitResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return GetBitResponse{}, errors.New(DbReadWrongType, "key does not hold a string value: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return GetBitResponse{
+		Value:  resp.Value == 1,
+		Exists: resp.Exists,
+	}, nil
+}
+
+func bitCountKey(key string, bitRange *BitRange, cache cacheStorage) (BitCountResponse, *errors.Error[DbReadErr]) {
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandBitCount{
+		Key:   key,
+		Range: bitRange,
+		Resp:  resp,
+	})
+	if redirect != nil {
+		return BitCountResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return BitCountResponse{}, errors.New(DbReadWrongType, "key does not hold a string value: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BitCountResponse{
+		Count:  resp.Value,
+		Exists: resp.Exists,
+	}, nil
+}
+
+func bitPosKey(key string, bit bool, bitRange *BitRange, cache cacheStorage) (BitPosResponse, *errors.Error[DbReadErr]) {
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandBitPos{
+		Key:   key,
+		Bit:   bit,
+		Range: bitRange,
+		Resp:  resp,
+	})
+	if redirect != nil {
+		return BitPosResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return BitPosResponse{}, errors.New(DbReadWrongType, "key does not hold a string value: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BitPosResponse{
+		Position: resp.Value,
+		Exists:   resp.Exists,
+	}, nil
+}
+
+func bitOpKeys(op BitOperation, destKey string, srcKeys []string, cache cacheStorage) (BitOpResponse, *errors.Error[DbWriteErr]) {
+	switch op {
+	case BitOpAnd, BitOpOr, BitOpXor:
+		if len(srcKeys) == 0 {
+			return BitOpResponse{}, errors.New(DbWriteInvalidArgument, "bitop %s requires at least one source key", op) //nolint:exhaustruct // reason: zero value on error
+		}
+	case BitOpNot:
+		if len(srcKeys) != 1 {
+			return BitOpResponse{}, errors.New(DbWriteInvalidArgument, "bitop not requires exactly one source key") //nolint:exhaustruct // reason: zero value on error
+		}
+	default:
+		return BitOpResponse{}, errors.New(DbWriteInvalidArgument, "invalid bit operation: %s", op) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	srcValues := make([][]byte, len(srcKeys))
+	var maxLen int
+	for index, srcKey := range srcKeys {
+		result, err := getKey(srcKey, cache)
+		if err != nil {
+			if err.Cause == DbReadRedirect {
+				return BitOpResponse{}, errors.NewFromError(DbWriteRedirect, err) //nolint:exhaustruct // reason: zero value on error
+			}
+			return BitOpResponse{}, errors.New(DbWriteWrongType, "key does not hold a string value: %s", srcKey) //nolint:exhaustruct // reason: zero value on error
+		}
+		srcValues[index] = result.Value
+		maxLen = max(maxLen, len(srcValues[index]))
+	}
+
+	if maxLen == 0 {
+		if _, err := deleteKey(destKey, cache); err != nil {
+			return BitOpResponse{}, err //nolint:exhaustruct // reason: zero value on error
+		}
+		return BitOpResponse{
+			Size: 0,
+		}, nil
+	}
+
+	result := make([]byte, maxLen)
+	copy(result, srcValues[0])
+	for _, srcValue := range srcValues[1:] {
+		for index := range result {
+			var srcByte byte
+			if index < len(srcValue) {
+				srcByte = srcValue[index]
+			}
+
+			switch op {
+			case BitOpAnd:
+				result[index] &= srcByte
+			case BitOpOr:
+				result[index] |= srcByte
+			case BitOpXor:
+				result[index] ^= srcByte
+			case BitOpNot:
+				// Only one source key.
+			}
+		}
+	}
+	if op == BitOpNot {
+		for index := range result {
+			result[index] = ^result[index]
+		}
+	}
+
+	if _, err := setKey(destKey, result, 0, cache); err != nil {
+		return BitOpResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BitOpResponse{
+		Size: int64(len(result)),
+	}, nil
+}
+
+func bitFieldKey(key string, ops []BitFieldOp, cache cacheStorage) (BitFieldResponse, *errors.Error[DbWriteErr]) {
+	for _, op := range ops {
+		if err := validateBitFieldOp(op); err != nil {
+			return BitFieldResponse{}, err //nolint:exhaustruct // reason: zero value on error
+		}
+	}
+
+	resp := &bitFieldResponse{
+		Results:   nil,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandBitField{
+		Key:  key,
+		Ops:  ops,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return BitFieldResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return BitFieldResponse{}, errors.New(DbWriteWrongType, "key does not hold a string value: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BitFieldResponse{
+		Results: resp.Results,
+	}, nil
+}
+
+func (self *slotStorage) handleCommandSetBit(cmd commandSetBit) {
+	data, exists := self.lookupKey(cmd.Key)
+	if exists && data.object != nil {
+		cmd.Resp.WrongType = true
+		return
+	}
+	previousSize := data.sizeInBytes()
+
+	byteIndex := int(cmd.Offset / bitsPerByte)
+	value := growValue(&data, byteIndex+1)
+
+	mask := byte(1) << (bitsPerByte - 1 - cmd.Offset%bitsPerByte)
+	if value[byteIndex]&mask != 0 {
+		cmd.Resp.Value = 1
+	}
+	if cmd.Value {
+		value[byteIndex] |= mask
+	} else {
+		value[byteIndex] &^= mask
+	}
+
+	if !exists {
+		data.lastAccessTime = time.Now()
+	}
+	self.storeKey(cmd.Key, previousSize, data)
+	cmd.Resp.Exists = exists
+}
+
+func (self *slotStorage) handleCommandGetBit(cmd commandGetBit) {
+	data, exists := self.lookupKey(cmd.Key)
+	if exists && data.object != nil {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if exists {
+		data.lastAccessTime = time.Now()
+		self.storage[cmd.Key] = data
+	}
+
+	if getBit(data.value, cmd.Offset) {
+		cmd.Resp.Value = 1
+	}
+	cmd.Resp.Exists = exists
+}
+
+func (self *slotStorage) handleCommandBitCount(cmd commandBitCount) {
+	data, exists := self.lookupKey(cmd.Key)
+	if !exists {
+		return
+	}
+	if data.object != nil {
+		cmd.Resp.WrongType = true
+		return
+	}
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+
+	firstBit, lastBit, ok := bitRangeToBits(cmd.Range, int64(len(data.value)))
+	if ok {
+		cmd.Resp.Value = countBits(data.value, firstBit, lastBit)
+	}
+	cmd.Resp.Exists = exists
+}
+
+func (self *slotStorage) handleCommandBitPos(cmd commandBitPos) {
+	data, exists := self.lookupKey(cmd.Key)
+	if exists && data.object != nil {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if exists {
+		data.lastAccessTime = time.Now()
+		self.storage[cmd.Key] = data
+	}
+	cmd.Resp.Exists = exists
+
+	if !exists {
+		// A missing key is an empty string, so only a clear bit can be found.
+		cmd.Resp.Value = -1
+		if !cmd.Bit {
+			cmd.Resp.Value = 0
+		}
+		return
+	}
+
+	firstBit, lastBit, ok := bitRangeToBits(cmd.Range, int64(len(data.value)))
+	if !ok {
+		cmd.Resp.Value = -1
+		return
+	}
+
+	cmd.Resp.Value = findBit(data.value, cmd.Bit, firstBit, lastBit)
+	if cmd.Resp.Value == -1 && !cmd.Bit && cmd.Range == nil {
+		// Without an explicit range, the value is considered to be padded with clear bits.
+		cmd.Resp.Value = int64(len(data.value)) * bitsPerByte
+	}
+}
+
+func (self *slotStorage) handleCommandBitField(cmd commandBitField) {
+	data, exists := self.lookupKey(cmd.Key)
+	if exists && data.object != nil {
+		cmd.Resp.WrongType = true
+		return
+	}
+	previousSize := data.sizeInBytes()
+
+	var writes bool
+	requiredLen := len(data.value)
+	for _, op := range cmd.Ops {
+		if op.Kind != BitFieldGet {
+			writes = true
+			requiredLen = max(requiredLen, int((op.Offset+int64(op.Type.Bits)+bitsPerByte-1)/bitsPerByte))
+		}
+	}
+
+	value := data.value
+	if writes {
+		value = growValue(&data, requiredLen)
+	}
+
+	cmd.Resp.Results = make([]BitFieldResult, len(cmd.Ops))
+	for index, op := range cmd.Ops {
+		current := readBitField(value, op.Type, op.Offset)
+
+		switch op.Kind {
+		case BitFieldGet:
+			cmd.Resp.Results[index].Value = current
+		case BitFieldSet:
+			newValue, ok := bitFieldOverflow(big.NewInt(op.Value), op.Type, op.Overflow)
+			if !ok {
+				cmd.Resp.Results[index].Failed = true
+				continue
+			}
+			writeBitField(value, op.Type, op.Offset, newValue)
+			cmd.Resp.Results[index].Value = current
+		case BitFieldIncrBy:
+			sum := new(big.Int).Add(big.NewInt(current), big.NewInt(op.Value))
+			newValue, ok := bitFieldOverflow(sum, op.Type, op.Overflow)
+			if !ok {
+				cmd.Resp.Results[index].Failed = true
+				continue
+			}
+			writeBitField(value, op.Type, op.Offset, newValue)
+			cmd.Resp.Results[index].Value = newValue
+		}
+	}
+
+	if writes {
+		if !exists {
+			data.lastAccessTime = time.Now()
+		}
+		self.storeKey(cmd.Key, previousSize, data)
+	} else if exists {
+		data.lastAccessTime = time.Now()
+		self.storage[cmd.Key] = data
+	}
+}
+
+// growValue to at least length bytes, zero padded, and returns the value which is safe to modify.
+func growValue(data *keyStorage, length int) []byte {
+	value := data.ownedValue()
+	if len(value) < length {
+		value = append(value, make([]byte, length-len(value))...)
+		data.value = value
+	}
+	return value
+}
+
+func getBit(value []byte, offset int64) bool {
+	byteIndex := offset / bitsPerByte
+	if byteIndex >= int64(len(value)) {
+		return false
+	}
+	return value[byteIndex]&(byte(1)<<(bitsPerByte-1-offset%bitsPerByte)) != 0
+}
+
+// bitRangeToBits converts a range into the first and last bit positions (inclusive) within a value of length bytes.
+// Returns false if the range is empty.
+func bitRangeToBits(bitRange *BitRange, length int64) (int64, int64, bool) {
+	if bitRange == nil {
+		return 0, length*bitsPerByte - 1, length != 0
+	}
+
+	unitLength := length
+	if bitRange.Unit == BitRangeBit {
+		unitLength = length * bitsPerByte
+	}
+
+	start, end := bitRange.Start, bitRange.End
+	if start < 0 {
+		start += unitLength
+	}
+	if end < 0 {
+		end += unitLength
+	}
+	start = max(start, 0)
+	end = max(end, 0)
+	end = min(end, unitLength-1)
+	if start > end {
+		return 0, 0, false
+	}
+
+	if bitRange.Unit == BitRangeBit {
+		return start, end, true
+	}
+	return start * bitsPerByte, end*bitsPerByte + bitsPerByte - 1, true
+}
+
+func countBits(value []byte, firstBit int64, lastBit int64) int64 {
+	firstByte, lastByte := firstBit/bitsPerByte, lastBit/bitsPerByte
+	firstMask := byte(0xff) >> (firstBit % bitsPerByte)
+	lastMask := byte(0xff) << (bitsPerByte - 1 - lastBit%bitsPerByte)
+
+	if firstByte == lastByte {
+		return int64(bits.OnesCount8(value[firstByte] & firstMask & lastMask))
+	}
+
+	count := bits.OnesCount8(value[firstByte]&firstMask) + bits.OnesCount8(value[lastByte]&lastMask)
+	for _, middle := range value[firstByte+1 : lastByte] {
+		count += bits.OnesCount8(middle)
+	}
+	return int64(count)
+}
+
+// findBit returns the position of the first bit matching bit within the first and last bit positions, or -1 if none match.
+func findBit(value []byte, bit bool, firstBit int64, lastBit int64) int64 {
+	// Bytes that cannot contain a match are skipped entirely.
+	skipByte := byte(0x00)
+	if !bit {
+		skipByte = 0xff
+	}
+
+	for position := firstBit; position <= lastBit; {
+		byteIndex := position / bitsPerByte
+		if position%bitsPerByte == 0 && position+bitsPerByte-1 <= lastBit && value[byteIndex] == skipByte {
+			position += bitsPerByte
+			continue
+		}
+		if getBit(value, position) == bit {
+			return position
+		}
+		position++
+	}
+
+	return -1
+}
+
+func readBitField(value []byte, fieldType BitFieldType, offset int64) int64 {
+	var raw uint64
+	for index := range int64(fieldType.Bits) {
+		raw <<= 1
+		if getBit(value, offset+index) {
+			raw |= 1
+		}
+	}
+
+	if fieldType.Signed && fieldType.Bits < maxBitFieldBits && raw&(uint64(1)<<(fieldType.Bits-1)) != 0 {
+		// Sign extend.
+		raw |= ^uint64(0) << fieldType.Bits
+	}
+	return int64(raw)
+}
+
+func writeBitField(value []byte, fieldType BitFieldType, offset int64, fieldValue int64) {
+	raw := uint64(fieldValue)
+	for index := int64(fieldType.Bits) - 1; index >= 0; index-- {
+		position := offset + index
+		mask := byte(1) << (bitsPerByte - 1 - position%bitsPerByte)
+		if raw&1 != 0 {
+			value[position/bitsPerByte] |= mask
+		} else {
+			value[position/bitsPerByte] &^= mask
+		}
+		raw >>= 1
+	}
+}
+
+// bitFieldOverflow fits value into the field type according to the overflow behavior.
+// Returns false if the value overflowed with BitFieldFail.
+func bitFieldOverflow(value *big.Int, fieldType BitFieldType, overflow BitFieldOverflow) (int64, bool) {
+	var minValue, maxValue *big.Int
+	if fieldType.Signed {
+		minValue = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(fieldType.Bits-1)))
+		maxValue = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(fieldType.Bits-1)), big.NewInt(1))
+	} else {
+		minValue = big.NewInt(0)
+		maxValue = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(fieldType.Bits)), big.NewInt(1))
+	}
+
+	if value.Cmp(minValue) >= 0 && value.Cmp(maxValue) <= 0 {
+		return value.Int64(), true
+	}
+
+	switch overflow {
+	case BitFieldFail:
+		return 0, false
+	case BitFieldSat:
+		if value.Cmp(minValue) < 0 {
+			return minValue.Int64(), true
+		}
+		return maxValue.Int64(), true
+	case "", BitFieldWrap:
+	}
+
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(fieldType.Bits))
+	wrapped := new(big.Int).Mod(value, modulus)
+	if wrapped.Cmp(maxValue) > 0 {
+		wrapped.Sub(wrapped, modulus)
+	}
+	return wrapped.Int64(), true
+}
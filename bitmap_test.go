@@ -0,0 +1,333 @@
+package datkey_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_SetBit_GetBit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.GetBit(ctx, "test", 7)
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+		assert.False(t, result.Value)
+	}
+
+	{
+		result, err := client.SetBit(ctx, "test", 7, true)
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+		assert.False(t, result.PreviousValue)
+	}
+
+	{
+		result, err := client.SetBit(ctx, "test", 7, true)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.True(t, result.PreviousValue)
+	}
+
+	{
+		result, err := client.GetBit(ctx, "test", 7)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.True(t, result.Value)
+	}
+
+	{
+		result, err := client.GetBit(ctx, "test", 100)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.False(t, result.Value)
+	}
+
+	{
+		result, err := client.Get(ctx, "test")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, []byte{0x01}, result.Value)
+	}
+
+	{
+		_, err := client.SetBit(ctx, "test", -1, true)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+}
+
+func TestDatkey_SetBit_does_not_modify_shared_value(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	value := []byte{0x00}
+	_, _ = client.Set(ctx, "test", value, 0)
+	getResult, err := client.Get(ctx, "test")
+	require.Nil(t, err)
+	getValue := getResult.Value
+
+	{
+		result, err := client.SetBit(ctx, "test", 0, true)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.False(t, result.PreviousValue)
+	}
+
+	assert.Equal(t, []byte{0x00}, value)
+	assert.Equal(t, []byte{0x00}, getValue)
+
+	{
+		result, err := client.Get(ctx, "test")
+		require.Nil(t, err)
+		assert.Equal(t, []byte{0x80}, result.Value)
+	}
+}
+
+func TestDatkey_BitCount(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.BitCount(ctx, "test")
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+		assert.Zero(t, result.Count)
+	}
+
+	_, _ = client.Set(ctx, "test", []byte("foobar"), 0)
+
+	{
+		result, err := client.BitCount(ctx, "test")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, int64(26), result.Count)
+	}
+
+	testCases := []struct {
+		bitRange      datkey.BitRange
+		expectedCount int64
+	}{
+		{bitRange: datkey.BitRange{Unit: datkey.BitRangeByte, Start: 0, End: 0}, expectedCount: 4},
+		{bitRange: datkey.BitRange{Unit: datkey.BitRangeByte, Start: 1, End: 1}, expectedCount: 6},
+		{bitRange: datkey.BitRange{Unit: "", Start: -2, End: -1}, expectedCount: 7},
+		{bitRange: datkey.BitRange{Unit: datkey.BitRangeByte, Start: 3, End: 1}, expectedCount: 0},
+		{bitRange: datkey.BitRange{Unit: datkey.BitRangeByte, Start: 0, End: 100}, expectedCount: 26},
+		{bitRange: datkey.BitRange{Unit: datkey.BitRangeBit, Start: 5, End: 30}, expectedCount: 17},
+		{bitRange: datkey.BitRange{Unit: datkey.BitRangeBit, Start: 1, End: 2}, expectedCount: 2},
+	}
+	for _, testCase := range testCases {
+		result, err := client.BitCountRange(ctx, "test", testCase.bitRange)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, testCase.expectedCount, result.Count, "%+v", testCase.bitRange)
+	}
+
+	{
+		_, err := client.BitCountRange(ctx, "test", datkey.BitRange{Unit: "word", Start: 0, End: 0})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadInvalidArgument, err.Cause)
+	}
+}
+
+func TestDatkey_BitPos(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.BitPos(ctx, "test", true)
+		require.Nil(t, err)
+		assert.Equal(t, int64(-1), result.Position)
+	}
+
+	{
+		result, err := client.BitPos(ctx, "test", false)
+		require.Nil(t, err)
+		assert.Equal(t, int64(0), result.Position)
+	}
+
+	_, _ = client.Set(ctx, "test", []byte{0xff, 0xf0, 0x00}, 0)
+
+	{
+		result, err := client.BitPos(ctx, "test", false)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, int64(12), result.Position)
+	}
+
+	{
+		result, err := client.BitPosRange(ctx, "test", true, datkey.BitRange{Unit: datkey.BitRangeByte, Start: 2, End: -1})
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, int64(-1), result.Position)
+	}
+
+	{
+		result, err := client.BitPosRange(ctx, "test", true, datkey.BitRange{Unit: datkey.BitRangeBit, Start: 7, End: 15})
+		require.Nil(t, err)
+		assert.Equal(t, int64(7), result.Position)
+	}
+
+	_, _ = client.Set(ctx, "test", []byte{0xff, 0xff}, 0)
+
+	{
+		// Clear bits past the end of the value are considered without an explicit range.
+		result, err := client.BitPos(ctx, "test", false)
+		require.Nil(t, err)
+		assert.Equal(t, int64(16), result.Position)
+	}
+
+	{
+		result, err := client.BitPosRange(ctx, "test", false, datkey.BitRange{Unit: datkey.BitRangeByte, Start: 0, End: -1})
+		require.Nil(t, err)
+		assert.Equal(t, int64(-1), result.Position)
+	}
+}
+
+func TestDatkey_BitOp(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, _ = client.Set(ctx, "a", []byte{0xf0, 0x0f}, 0)
+	_, _ = client.Set(ctx, "b", []byte{0xff}, 0)
+
+	testCases := []struct {
+		op            datkey.BitOperation
+		srcKeys       []string
+		expectedValue []byte
+	}{
+		{op: datkey.BitOpAnd, srcKeys: []string{"a", "b"}, expectedValue: []byte{0xf0, 0x00}},
+		{op: datkey.BitOpOr, srcKeys: []string{"a", "b"}, expectedValue: []byte{0xff, 0x0f}},
+		{op: datkey.BitOpXor, srcKeys: []string{"a", "b"}, expectedValue: []byte{0x0f, 0x0f}},
+		{op: datkey.BitOpNot, srcKeys: []string{"a"}, expectedValue: []byte{0x0f, 0xf0}},
+		{op: datkey.BitOpOr, srcKeys: []string{"a", "missing"}, expectedValue: []byte{0xf0, 0x0f}},
+	}
+	for _, testCase := range testCases {
+		result, err := client.BitOp(ctx, testCase.op, "dest", testCase.srcKeys...)
+		require.Nil(t, err)
+		assert.Equal(t, int64(len(testCase.expectedValue)), result.Size)
+
+		getResult, getErr := client.Get(ctx, "dest")
+		require.Nil(t, getErr)
+		assert.Equal(t, testCase.expectedValue, getResult.Value, "%s %v", testCase.op, testCase.srcKeys)
+	}
+
+	{
+		result, err := client.BitOp(ctx, datkey.BitOpAnd, "dest", "missing")
+		require.Nil(t, err)
+		assert.Zero(t, result.Size)
+
+		getResult, getErr := client.Get(ctx, "dest")
+		require.Nil(t, getErr)
+		assert.False(t, getResult.Exists)
+	}
+
+	{
+		_, err := client.BitOp(ctx, datkey.BitOpNot, "dest", "a", "b")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+}
+
+func TestDatkey_BitField(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	u8 := datkey.BitFieldType{Bits: 8, Signed: false}
+	i8 := datkey.BitFieldType{Bits: 8, Signed: true}
+	u2 := datkey.BitFieldType{Bits: 2, Signed: false}
+
+	{
+		// Reads do not create the key.
+		result, err := client.BitField(ctx, "test", datkey.BitFieldOp{Kind: datkey.BitFieldGet, Overflow: "", Type: u8, Offset: 0, Value: 0})
+		require.Nil(t, err)
+		assert.Equal(t, []datkey.BitFieldResult{{Value: 0, Failed: false}}, result.Results)
+
+		getResult, getErr := client.Get(ctx, "test")
+		require.Nil(t, getErr)
+		assert.False(t, getResult.Exists)
+	}
+
+	{
+		result, err := client.BitField(ctx, "test",
+			datkey.BitFieldOp{Kind: datkey.BitFieldSet, Overflow: "", Type: u8, Offset: 0, Value: 255},
+			datkey.BitFieldOp{Kind: datkey.BitFieldGet, Overflow: "", Type: i8, Offset: 0, Value: 0},
+			datkey.BitFieldOp{Kind: datkey.BitFieldIncrBy, Overflow: datkey.BitFieldWrap, Type: u8, Offset: 0, Value: 2},
+			datkey.BitFieldOp{Kind: datkey.BitFieldIncrBy, Overflow: datkey.BitFieldSat, Type: i8, Offset: 8, Value: 200},
+			datkey.BitFieldOp{Kind: datkey.BitFieldIncrBy, Overflow: datkey.BitFieldFail, Type: u2, Offset: 16, Value: 4},
+			datkey.BitFieldOp{Kind: datkey.BitFieldIncrBy, Overflow: datkey.BitFieldWrap, Type: i8, Offset: 24, Value: -129},
+		)
+		require.Nil(t, err)
+		assert.Equal(t, []datkey.BitFieldResult{
+			{Value: 0, Failed: false},
+			{Value: -1, Failed: false},
+			{Value: 1, Failed: false},
+			{Value: 127, Failed: false},
+			{Value: 0, Failed: true},
+			{Value: 127, Failed: false},
+		}, result.Results)
+	}
+
+	{
+		result, err := client.Get(ctx, "test")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, []byte{0x01, 0x7f, 0x00, 0x7f}, result.Value)
+	}
+
+	{
+		_, err := client.BitField(ctx, "test", datkey.BitFieldOp{Kind: datkey.BitFieldGet, Overflow: "", Type: datkey.BitFieldType{Bits: 64, Signed: false}, Offset: 0, Value: 0})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+}
+
+func TestDatkey_SetBit_preserves_ttl(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, _ = client.Set(ctx, "test", []byte{0x00}, time.Hour)
+
+	_, err := client.SetBit(ctx, "test", 3, true)
+	require.Nil(t, err)
+
+	result, readErr := client.Ttl(ctx, "test")
+	require.Nil(t, readErr)
+	assert.True(t, result.Exists)
+	assert.NotZero(t, result.Ttl)
+}
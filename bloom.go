@@ -0,0 +1,479 @@
+package datkey
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+const (
+	bloomDefaultErrorRate = 0.01
+	bloomDefaultCapacity  = 100
+	bloomDefaultExpansion = 2
+	// bloomTighteningRatio of the error rate for each new layer so the compound error rate stays within the configured rate.
+	bloomTighteningRatio = 0.5
+	bloomMinBits         = 64
+	// bloomMaxExpansion is the limit of RedisBloom, and bloomMaxCapacity and bloomMaxBits bound the memory of each
+	// layer to 2GiB.
+	bloomMaxExpansion   = 32768
+	bloomMaxCapacity    = 1 << 30
+	bloomMaxBits        = 1 << 34
+	bloomHashSeed       = 0x5f61767a
+	bloomHashSeedSecond = 0xc6a4a793
+	// bloomLayerOverhead is the approximate size, in bytes, of each layer besides its bits.
+	bloomLayerOverhead = 32
+)
+
+// BloomConfig for a scalable bloom filter.
+type BloomConfig struct {
+	// ErrorRate is the desired probability of false positives, between 0 and 1 exclusive.
+	// Default: 0.01
+	ErrorRate float64
+
+	// Capacity is the number of items expected to be added before the filter scales, up to 2^30. The capacity and
+	// error rate of the filter may not need more than 2^34 bits.
+	// Default: 100
+	Capacity int64
+
+	// Expansion is the factor by which the capacity grows each time the filter scales, up to 32768.
+	// Default: 2
+	Expansion int64
+
+	// NonScaling filters return DbWriteFilterFull instead of scaling once Capacity items have been added.
+	NonScaling bool
+}
+
+type commandBFReserve struct {
+	Resp   *bfReserveResponse
+	Key    string
+	Config BloomConfig
+}
+
+type bfReserveResponse struct {
+	Exists bool
+}
+
+type commandBFAdd struct {
+	Resp  *bfAddResponse
+	Key   string
+	Items [][]byte
+}
+
+type bfAddResponse struct {
+	Added     []bool
+	WrongType bool
+	Full      bool
+}
+
+type BFAddResponse struct {
+	// Added is false if the item may have already been added.
+	Added bool
+}
+
+type BFMAddResponse struct {
+	// Added for each item, in order. False if the item may have already been added.
+	Added []bool
+}
+
+type commandBFExists struct {
+	Resp  *bfExistsResponse
+	Key   string
+	Items [][]byte
+}
+
+type bfExistsResponse struct {
+	Exists    []bool
+	WrongType bool
+}
+
+type BFExistsResponse struct {
+	// Exists is false if the item has definitely not been added, and true if it may have been added.
+	Exists bool
+}
+
+type BFMExistsResponse struct {
+	// Exists for each item, in order. False if the item has definitely not been added, and true if it may have been added.
+	Exists []bool
+}
+
+// BFReserve creates an empty bloom filter at key. Fails with DbWriteKeyExists if the key already exists.
+func (self *Datkey) BFReserve(ctx context.Context, key string, config BloomConfig) *errors.Error[DbWriteErr] {
+	if err := self.writeAllowed(ctx); err != nil {
+		return err
+	}
+	return bfReserveKey(key, config, self.cache.forContext(ctx))
+}
+
+// BFAdd an item to the bloom filter at key, creating the filter with the default config if it does not exist.
+func (self *Datkey) BFAdd(ctx context.Context, key string, item []byte) (BFAddResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return BFAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	added, err := bfAddKey(key, [][]byte{item}, self.cache.forContext(ctx))
+	if err != nil {
+		return BFAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BFAddResponse{
+		Added: added[0],
+	}, nil
+}
+
+// BFMAdd items to the bloom filter at key, creating the filter with the default config if it does not exist.
+// If a non scaling filter becomes full, items before the failing item remain added.
+func (self *Datkey) BFMAdd(ctx context.Context, key string, items ...[]byte) (BFMAddResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return BFMAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	added, err := bfAddKey(key, items, self.cache.forContext(ctx))
+	if err != nil {
+		return BFMAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BFMAddResponse{
+		Added: added,
+	}, nil
+}
+
+// BFExists checks if an item may have been added to the bloom filter at key.
+func (self *Datkey) BFExists(ctx context.Context, key string, item []byte) (BFExistsResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return BFExistsResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	exists, err := bfExistsKey(key, [][]byte{item}, self.cache.forContext(ctx))
+	if err != nil {
+		return BFExistsResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BFExistsResponse{
+		Exists: exists[0],
+	}, nil
+}
+
+// BFMExists checks if items may have been added to the bloom filter at key.
+func (self *Datkey) BFMExists(ctx context.Context, key string, items ...[]byte) (BFMExistsResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return BFMExistsResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	exists, err := bfExistsKey(key, items, self.cache.forContext(ctx))
+	if err != nil {
+		return BFMExistsResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return BFMExistsResponse{
+		Exists: exists,
+	}, nil
+}
+
+func bfReserveKey(key string, config BloomConfig, cache cacheStorage) *errors.Error[DbWriteErr] {
+	if config.ErrorRate == 0 {
+		config.ErrorRate = bloomDefaultErrorRate
+	}
+	if config.Capacity == 0 {
+		config.Capacity = bloomDefaultCapacity
+	}
+	if config.Expansion == 0 {
+		config.Expansion = bloomDefaultExpansion
+	}
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	resp := &bfReserveResponse{
+		Exists: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandBFReserve{
+		Key:    key,
+		Config: config,
+		Resp:   resp,
+	})
+	if redirect != nil {
+		return redirect.writeErr()
+	}
+
+	if resp.Exists {
+		return errors.New(DbWriteKeyExists, "key already exists: %s", key)
+	}
+
+	return nil
+}
+
+// validate the config once the defaults are set.
+func (self BloomConfig) validate() *errors.Error[DbWriteErr] {
+	if !(0 < self.ErrorRate && self.ErrorRate < 1) {
+		return errors.New(DbWriteInvalidArgument, "error rate must be between 0 and 1: %f", self.ErrorRate)
+	}
+	if self.Capacity < 1 || self.Capacity > bloomMaxCapacity {
+		return errors.New(DbWriteInvalidArgument, "capacity must be from 1 up to %d: %d", bloomMaxCapacity, self.Capacity)
+	}
+	if self.Expansion < 1 || self.Expansion > bloomMaxExpansion {
+		return errors.New(DbWriteInvalidArgument, "expansion must be from 1 up to %d: %d", bloomMaxExpansion, self.Expansion)
+	}
+	if bloomBits(self.Capacity, self.ErrorRate) > bloomMaxBits {
+		return errors.New(DbWriteInvalidArgument, "capacity %d with error rate %f needs more than %d bits", self.Capacity, self.ErrorRate, bloomMaxBits)
+	}
+	return nil
+}
+
+func bfAddKey(key string, items [][]byte, cache cacheStorage) ([]bool, *errors.Error[DbWriteErr]) {
+	resp := &bfAddResponse{
+		Added:     make([]bool, 0, len(items)),
+		WrongType: false,
+		Full:      false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandBFAdd{
+		Key:   key,
+		Items: items,
+		Resp:  resp,
+	})
+	if redirect != nil {
+		return nil, redirect.writeErr()
+	}
+
+	if resp.WrongType {
+		return nil, errors.New(DbWriteWrongType, "key does not hold a bloom filter: %s", key)
+	}
+	if resp.Full {
+		return nil, errors.New(DbWriteFilterFull, "bloom filter is full: %s", key)
+	}
+
+	return resp.Added, nil
+}
+
+func bfExistsKey(key string, items [][]byte, cache cacheStorage) ([]bool, *errors.Error[DbReadErr]) {
+	resp := &bfExistsResponse{
+		Exists:    make([]bool, len(items)),
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandBFExists{
+		Key:   key,
+		Items: items,
+		Resp:  resp,
+	})
+	if redirect != nil {
+		return nil, redirect.readErr()
+	}
+
+	if resp.WrongType {
+		return nil, errors.New(DbReadWrongType, "key does not hold a bloom filter: %s", key)
+	}
+
+	return resp.Exists, nil
+}
+
+// lookupBloomFilter returns the stored data and bloom filter for a key.
+// Returns false for wrongType if the key exists but is not a bloom filter.
+func (self *slotStorage) lookupBloomFilter(key string) (keyStorage, *bloomFilter, bool, bool) {
+	data, exists := self.lookupKey(key)
+	if !exists {
+		return data, nil, false, false
+	}
+
+	filter, ok := data.object.(*bloomFilter)
+	if !ok {
+		return data, nil, true, true
+	}
+
+	return data, filter, true, false
+}
+
+func (self *slotStorage) handleCommandBFReserve(cmd commandBFReserve) {
+	if _, exists := self.lookupKey(cmd.Key); exists {
+		cmd.Resp.Exists = true
+		return
+	}
+
+	self.storeKey(cmd.Key, 0, keyStorage{
+		lastAccessTime: time.Now(),
+		expiresAt:      time.Time{},
+		value:          nil,
+		object:         newBloomFilter(cmd.Config),
+		valueShared:    false,
+	})
+}
+
+func (self *slotStorage) handleCommandBFAdd(cmd commandBFAdd) {
+	data, filter, exists, wrongType := self.lookupBloomFilter(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+
+	previousSize := data.sizeInBytes()
+	if !exists {
+		filter = newBloomFilter(BloomConfig{
+			ErrorRate:  bloomDefaultErrorRate,
+			Capacity:   bloomDefaultCapacity,
+			Expansion:  bloomDefaultExpansion,
+			NonScaling: false,
+		})
+		data = keyStorage{
+			lastAccessTime: time.Now(),
+			expiresAt:      time.Time{},
+			value:          nil,
+			object:         filter,
+			valueShared:    false,
+		}
+	}
+
+	changed := !exists
+	for _, item := range cmd.Items {
+		added, ok := filter.add(item)
+		if !ok {
+			cmd.Resp.Full = true
+			break
+		}
+		cmd.Resp.Added = append(cmd.Resp.Added, added)
+		changed = changed || added
+	}
+
+	data.lastAccessTime = time.Now()
+	if changed {
+		self.storeKey(cmd.Key, previousSize, data)
+	} else {
+		self.storage[cmd.Key] = data
+	}
+}
+
+func (self *slotStorage) handleCommandBFExists(cmd commandBFExists) {
+	data, filter, exists, wrongType := self.lookupBloomFilter(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+	for index, item := range cmd.Items {
+		cmd.Resp.Exists[index] = filter.contains(bloomHashes(item))
+	}
+}
+
+// bloomFilter that scales by adding a new, larger layer with a tighter error rate each time the last layer fills up.
+type bloomFilter struct {
+	layers []*bloomLayer
+	config BloomConfig
+}
+
+func newBloomFilter(config BloomConfig) *bloomFilter {
+	// The error rates of all layers form a geometric series, so starting at a fraction of the
+	// error rate keeps the compound error rate of a scalable filter within the configured rate.
+	errorRate := config.ErrorRate
+	if !config.NonScaling {
+		errorRate *= 1 - bloomTighteningRatio
+	}
+
+	return &bloomFilter{
+		layers: []*bloomLayer{newBloomLayer(config.Capacity, errorRate)},
+		config: config,
+	}
+}
+
+func (self *bloomFilter) valueType() ValueType {
+	return ValueTypeBloomFilter
+}
+
+func (self *bloomFilter) sizeInBytes() int64 {
+	var size int64
+	for _, layer := range self.layers {
+		size += int64(len(layer.bits))*8 + bloomLayerOverhead
+	}
+	return size
+}
+
+func (self *bloomFilter) contains(hash1 uint64, hash2 uint64) bool {
+	for _, layer := range self.layers {
+		if layer.contains(hash1, hash2) {
+			return true
+		}
+	}
+	return false
+}
+
+// add the item to the filter. Returns false for added if the item may already exist,
+// and false for ok if the filter is full and cannot scale.
+func (self *bloomFilter) add(item []byte) (bool, bool) {
+	hash1, hash2 := bloomHashes(item)
+	if self.contains(hash1, hash2) {
+		return false, true
+	}
+
+	layer := self.layers[len(self.layers)-1]
+	if layer.count >= layer.capacity {
+		if self.config.NonScaling {
+			return false, false
+		}
+		capacity := min(layer.capacity*self.config.Expansion, bloomMaxCapacity)
+		errorRate := layer.errorRate * bloomTighteningRatio
+		if bloomBits(capacity, errorRate) > bloomMaxBits {
+			// The layer would be too large, so the filter is as full as a filter that does not scale.
+			return false, false
+		}
+		layer = newBloomLayer(capacity, errorRate)
+		self.layers = append(self.layers, layer)
+	}
+
+	layer.add(hash1, hash2)
+	return true, true
+}
+
+type bloomLayer struct {
+	bits      []uint64
+	numBits   uint64
+	hashes    uint64
+	capacity  int64
+	count     int64
+	errorRate float64
+}
+
+func newBloomLayer(capacity int64, errorRate float64) *bloomLayer {
+	bitsPerItem := -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+	numBits := uint64(bloomBits(capacity, errorRate))
+
+	return &bloomLayer{
+		bits:      make([]uint64, (numBits+63)/64),
+		numBits:   numBits,
+		hashes:    uint64(math.Ceil(math.Ln2 * bitsPerItem)),
+		capacity:  capacity,
+		count:     0,
+		errorRate: errorRate,
+	}
+}
+
+// bloomBits of a layer holding capacity items with the error rate, as a float so that it cannot overflow.
+func bloomBits(capacity int64, errorRate float64) float64 {
+	bitsPerItem := -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+	return max(math.Ceil(float64(capacity)*bitsPerItem), bloomMinBits)
+}
+
+// bloomHashes of an item, combined with double hashing to derive the index of each bit.
+func bloomHashes(item []byte) (uint64, uint64) {
+	return murmurHash64A(item, bloomHashSeed), murmurHash64A(item, bloomHashSeedSecond) | 1
+}
+
+func (self *bloomLayer) contains(hash1 uint64, hash2 uint64) bool {
+	for index := range self.hashes {
+		bit := (hash1 + index*hash2) % self.numBits
+		if self.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (self *bloomLayer) add(hash1 uint64, hash2 uint64) {
+	for index := range self.hashes {
+		bit := (hash1 + index*hash2) % self.numBits
+		self.bits[bit/64] |= 1 << (bit % 64)
+	}
+	self.count++
+}
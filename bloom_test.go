@@ -0,0 +1,149 @@
+package datkey_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_BFAdd_BFExists(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.BFExists(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+
+	{
+		result, err := client.BFAdd(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.True(t, result.Added)
+		assert.Equal(t, datkey.ValueTypeBloomFilter, typeOf(t, client, "test").Type)
+	}
+
+	{
+		result, err := client.BFAdd(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.False(t, result.Added)
+	}
+
+	{
+		result, err := client.BFMAdd(ctx, "test", []byte("b"), []byte("a"), []byte("c"))
+		require.Nil(t, err)
+		assert.Equal(t, []bool{true, false, true}, result.Added)
+	}
+
+	{
+		result, err := client.BFMExists(ctx, "test", []byte("a"), []byte("b"), []byte("c"), []byte("d"))
+		require.Nil(t, err)
+		assert.Equal(t, []bool{true, true, true, false}, result.Exists)
+	}
+
+	{
+		client.Set(ctx, "string", []byte("value"), 0)
+
+		_, err := client.BFAdd(ctx, "string", []byte("a"))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteWrongType, err.Cause)
+	}
+}
+
+func TestDatkey_BFReserve(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		err := client.BFReserve(ctx, "test", datkey.BloomConfig{ErrorRate: 2, Capacity: 10, Expansion: 0, NonScaling: false})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	// Filters too large to allocate are rejected.
+	for _, invalid := range []datkey.BloomConfig{
+		{ErrorRate: 0.01, Capacity: 1<<30 + 1, Expansion: 0, NonScaling: false},
+		{ErrorRate: 0.01, Capacity: 10, Expansion: 32769, NonScaling: false},
+		{ErrorRate: 1e-300, Capacity: 1 << 30, Expansion: 0, NonScaling: false},
+	} {
+		err := client.BFReserve(ctx, "test", invalid)
+		require.NotNil(t, err, invalid)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause, invalid)
+	}
+
+	{
+		err := client.BFReserve(ctx, "test", datkey.BloomConfig{ErrorRate: 0.001, Capacity: 10, Expansion: 0, NonScaling: true})
+		require.Nil(t, err)
+	}
+
+	{
+		err := client.BFReserve(ctx, "test", datkey.BloomConfig{ErrorRate: 0, Capacity: 0, Expansion: 0, NonScaling: false})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteKeyExists, err.Cause)
+	}
+
+	{
+		items := make([][]byte, 10)
+		for index := range items {
+			items[index] = []byte(strconv.Itoa(index))
+		}
+		_, err := client.BFMAdd(ctx, "test", items...)
+		require.Nil(t, err)
+
+		// The non scaling filter is now at capacity.
+		_, err = client.BFAdd(ctx, "test", []byte("full"))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteFilterFull, err.Cause)
+	}
+}
+
+func TestDatkey_BFAdd_scaling(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	const errorRate = 0.01
+	const items = 10000
+
+	err := client.BFReserve(ctx, "test", datkey.BloomConfig{ErrorRate: errorRate, Capacity: 100, Expansion: 2, NonScaling: false})
+	require.Nil(t, err)
+
+	for index := range items {
+		_, err := client.BFAdd(ctx, "test", []byte("item:"+strconv.Itoa(index)))
+		require.Nil(t, err)
+	}
+
+	// No false negatives.
+	for index := range items {
+		result, err := client.BFExists(ctx, "test", []byte("item:"+strconv.Itoa(index)))
+		require.Nil(t, err)
+		require.True(t, result.Exists)
+	}
+
+	var falsePositives int
+	for index := range items {
+		result, err := client.BFExists(ctx, "test", []byte("other:"+strconv.Itoa(index)))
+		require.Nil(t, err)
+		if result.Exists {
+			falsePositives++
+		}
+	}
+	// Allow some margin since the false positive rate is only expected to be within the error rate.
+	assert.Less(t, float64(falsePositives)/items, 1.5*errorRate)
+}
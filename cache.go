@@ -1,6 +1,7 @@
 package datkey
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -12,16 +13,29 @@ import (
 
 type cacheStorage struct {
 	workerPool *pond.WorkerPool
+	notifier   *keyspaceNotifier
 	slots      []*slotStorage
+	// partitioner of keys into the slots.
+	partitioner hash.Partitioner
+	// asking commands are sent after an ASK redirect, see Asking.
+	asking bool
 }
 
-func newCacheStorage(maxConcurrency int) cacheStorage {
-	hashSlotStorage := make([]*slotStorage, hash.MaxHashSlot)
+func newCacheStorage(maxConcurrency int, partitioner hash.Partitioner, notifier *keyspaceNotifier) cacheStorage {
+	hashSlotStorage := make([]*slotStorage, partitioner.SlotCount())
 	for index := range hashSlotStorage {
 		hashSlotStorage[index] = &slotStorage{
 			sizeInBytes: 0,
 			storage:     map[string]keyStorage{},
-			mutex:       sync.Mutex{},
+			appendOnly:  nil,
+			backlog:     nil,
+			notifier:    notifier,
+			migration: slotMigration{
+				state: SlotStable,
+				node:  "",
+				owner: "",
+			},
+			mutex: sync.Mutex{},
 		}
 	}
 
@@ -33,42 +47,104 @@ func newCacheStorage(maxConcurrency int) cacheStorage {
 	}
 
 	return cacheStorage{
-		workerPool: workerPool,
-		slots:      hashSlotStorage,
+		workerPool:  workerPool,
+		notifier:    notifier,
+		slots:       hashSlotStorage,
+		partitioner: partitioner,
+		asking:      false,
 	}
 }
 
-func (self cacheStorage) runCommand(hashSlot hash.Slot, cmd command) {
+// slotOf a key, as partitioned by the partitioner of the database.
+func (self cacheStorage) slotOf(key string) hash.Slot {
+	return self.partitioner.Slot(key)
+}
+
+// slotCount of the storage. Slots from the count up to hash.MaxHashSlot store no keys.
+func (self cacheStorage) slotCount() hash.Slot {
+	return hash.Slot(len(self.slots))
+}
+
+// allSlots of the storage.
+func (self cacheStorage) allSlots() hash.Range {
+	return hash.Range{Begin: 0, End: self.slotCount() - 1}
+}
+
+// setAppendOnly file to log every modification to. This must be set before any commands are run.
+func (self cacheStorage) setAppendOnly(appendOnly *appendOnlyFile) {
+	for _, hashSlotStorage := range self.slots {
+		hashSlotStorage.appendOnly = appendOnly
+	}
+}
+
+// setBacklog of the records kept for replicas. This must be set before any commands are run.
+func (self cacheStorage) setBacklog(backlog *replicationBacklog) {
+	for _, hashSlotStorage := range self.slots {
+		hashSlotStorage.backlog = backlog
+	}
+}
+
+// forContext of the commands of a request, which are run as asked by the context, such as after an ASK redirect.
+func (self cacheStorage) forContext(ctx context.Context) cacheStorage {
+	self.asking = isAsking(ctx)
+	return self
+}
+
+// runCommand on the storage of a slot. If the slot is owned by another node or is being migrated and does not serve
+// the command, it is not run and a redirect is returned.
+func (self cacheStorage) runCommand(hashSlot hash.Slot, cmd command) *Redirect {
+	var redirect *Redirect
 	if self.workerPool != nil {
 		self.workerPool.SubmitAndWait(func() {
 			hashSlotStorage := self.slots[hashSlot]
-			hashSlotStorage.processCommand(cmd)
+			redirect = hashSlotStorage.processCommand(cmd, self.asking)
 		})
 	} else {
 		hashSlotStorage := self.slots[hashSlot]
-		hashSlotStorage.processCommand(cmd)
+		redirect = hashSlotStorage.processCommand(cmd, self.asking)
 	}
+
+	if redirect != nil {
+		redirect.Slot = hashSlot
+	}
+	return redirect
 }
 
 type slotStorage struct {
-	storage     map[string]keyStorage
+	storage map[string]keyStorage
+	// appendOnly logs every modification, if enabled.
+	appendOnly *appendOnlyFile
+	// backlog of the records kept for replicas.
+	backlog *replicationBacklog
+	// notifier of changes to keys.
+	notifier *keyspaceNotifier
+	// migration state of the slot, which decides which commands are redirected to another node.
+	migration   slotMigration
 	mutex       sync.Mutex
 	sizeInBytes int64
 }
 
-func (self *slotStorage) processCommand(command command) {
+func (self *slotStorage) processCommand(command command, asking bool) *Redirect {
 	self.mutex.Lock()
 
+	if redirect := self.redirect(command, asking); redirect != nil {
+		self.mutex.Unlock()
+		return redirect
+	}
+
 	switch cmd := command.(type) {
 	case commandSet:
 		previousData, exists := self.storage[cmd.Key]
-		self.sizeInBytes += int64(-len(previousData.value))
+		self.sizeInBytes -= previousData.sizeInBytes()
 		if previousData.isExpired() {
 			exists = false
 			previousData.value = nil
+			self.notifier.notify(KeyspaceEventExpired, cmd.Key)
 		}
 		self.storage[cmd.Key] = cmd.data
-		self.sizeInBytes += int64(len(cmd.data.value))
+		self.sizeInBytes += cmd.data.sizeInBytes()
+		self.logPut(cmd.Key, cmd.data)
+		self.notifier.notify(KeyspaceEventSet, cmd.Key)
 		cmd.Resp.Exists = exists
 		cmd.Resp.Value = previousData.value
 
@@ -76,16 +152,17 @@ func (self *slotStorage) processCommand(command command) {
 	case commandGet:
 		data, exists := self.storage[cmd.Key]
 		if data.isExpired() {
-			self.sizeInBytes += int64(-len(data.value))
 			exists = false
+			self.expireKey(cmd.Key, data)
 			data.value = nil
-			delete(self.storage, cmd.Key)
 		} else if exists {
 			data.lastAccessTime = time.Now()
+			data.valueShared = true
 			self.storage[cmd.Key] = data
 		}
 		cmd.Resp.Exists = exists
 		cmd.Resp.Value = data.value
+		cmd.Resp.WrongType = exists && data.object != nil
 
 		self.mutex.Unlock()
 	case commandDelete:
@@ -95,13 +172,14 @@ func (self *slotStorage) processCommand(command command) {
 	case commandExpire:
 		previousData, exists := self.storage[cmd.Key]
 		if previousData.isExpired() {
-			self.sizeInBytes += int64(-len(previousData.value))
 			exists = false
+			self.expireKey(cmd.Key, previousData)
 			previousData.value = nil
-			delete(self.storage, cmd.Key)
 		} else if exists {
 			previousData.expiresAt = cmd.ExpiresAt
 			self.storage[cmd.Key] = previousData
+			self.logExpireAt(cmd.Key, cmd.ExpiresAt)
+			self.notifier.notify(KeyspaceEventExpire, cmd.Key)
 		}
 		cmd.Resp.Exists = exists
 		cmd.Resp.Value = previousData.value
@@ -110,35 +188,188 @@ func (self *slotStorage) processCommand(command command) {
 	case commandPersist:
 		previousData, exists := self.storage[cmd.Key]
 		if previousData.isExpired() {
-			self.sizeInBytes += int64(-len(previousData.value))
 			exists = false
-			delete(self.storage, cmd.Key)
-		} else if exists {
+			self.expireKey(cmd.Key, previousData)
+		} else if exists && !previousData.expiresAt.IsZero() {
 			previousData.expiresAt = time.Time{}
 			self.storage[cmd.Key] = previousData
+			self.logExpireAt(cmd.Key, time.Time{})
+			self.notifier.notify(KeyspaceEventPersist, cmd.Key)
+			cmd.Resp.Persisted = true
 		}
 		cmd.Resp.Exists = exists
-		cmd.Resp.Value = previousData.value
 
 		self.mutex.Unlock()
 	case commandTtl:
 		previousData, exists := self.storage[cmd.Key]
 		var ttl time.Duration
 		if previousData.isExpired() {
-			self.sizeInBytes += int64(-len(previousData.value))
 			exists = false
-			delete(self.storage, cmd.Key)
+			self.expireKey(cmd.Key, previousData)
 		} else if exists && !previousData.expiresAt.IsZero() {
 			ttl = time.Until(previousData.expiresAt)
 		}
 		cmd.Resp.Exists = exists
 		cmd.Resp.Ttl = ttl
 
+		self.mutex.Unlock()
+	case commandSetBit:
+		self.handleCommandSetBit(cmd)
+
+		self.mutex.Unlock()
+	case commandGetBit:
+		self.handleCommandGetBit(cmd)
+
+		self.mutex.Unlock()
+	case commandBitCount:
+		self.handleCommandBitCount(cmd)
+
+		self.mutex.Unlock()
+	case commandBitPos:
+		self.handleCommandBitPos(cmd)
+
+		self.mutex.Unlock()
+	case commandBitField:
+		self.handleCommandBitField(cmd)
+
+		self.mutex.Unlock()
+	case commandPFAdd:
+		self.handleCommandPFAdd(cmd)
+
+		self.mutex.Unlock()
+	case commandPFCount:
+		self.handleCommandPFCount(cmd)
+
+		self.mutex.Unlock()
+	case commandPFMerge:
+		self.handleCommandPFMerge(cmd)
+
+		self.mutex.Unlock()
+	case commandZAdd:
+		self.handleCommandZAdd(cmd)
+
+		self.mutex.Unlock()
+	case commandZRem:
+		self.handleCommandZRem(cmd)
+
+		self.mutex.Unlock()
+	case commandZScore:
+		self.handleCommandZScore(cmd)
+
+		self.mutex.Unlock()
+	case commandZCard:
+		self.handleCommandZCard(cmd)
+
+		self.mutex.Unlock()
+	case commandZRangeByScore:
+		self.handleCommandZRangeByScore(cmd)
+
+		self.mutex.Unlock()
+	case commandZScores:
+		self.handleCommandZScores(cmd)
+
+		self.mutex.Unlock()
+	case commandGeoSearch:
+		self.handleCommandGeoSearch(cmd)
+
+		self.mutex.Unlock()
+	case commandJSONSet:
+		self.handleCommandJSONSet(cmd)
+
+		self.mutex.Unlock()
+	case commandJSONGet:
+		self.handleCommandJSONGet(cmd)
+
+		self.mutex.Unlock()
+	case commandJSONDel:
+		self.handleCommandJSONDel(cmd)
+
+		self.mutex.Unlock()
+	case commandJSONArrAppend:
+		self.handleCommandJSONArrAppend(cmd)
+
+		self.mutex.Unlock()
+	case commandJSONNumIncrBy:
+		self.handleCommandJSONNumIncrBy(cmd)
+
+		self.mutex.Unlock()
+	case commandJSONType:
+		self.handleCommandJSONType(cmd)
+
+		self.mutex.Unlock()
+	case commandBFReserve:
+		self.handleCommandBFReserve(cmd)
+
+		self.mutex.Unlock()
+	case commandBFAdd:
+		self.handleCommandBFAdd(cmd)
+
+		self.mutex.Unlock()
+	case commandBFExists:
+		self.handleCommandBFExists(cmd)
+
+		self.mutex.Unlock()
+	case commandCFReserve:
+		self.handleCommandCFReserve(cmd)
+
+		self.mutex.Unlock()
+	case commandCFAdd:
+		self.handleCommandCFAdd(cmd)
+
+		self.mutex.Unlock()
+	case commandCFDel:
+		self.handleCommandCFDel(cmd)
+
+		self.mutex.Unlock()
+	case commandCFExists:
+		self.handleCommandCFExists(cmd)
+
+		self.mutex.Unlock()
+	case commandType:
+		self.handleCommandType(cmd)
+
+		self.mutex.Unlock()
+	case commandScanSlot:
+		self.handleCommandScanSlot(cmd)
+
+		self.mutex.Unlock()
+	case commandSnapshotSlot:
+		self.handleCommandSnapshotSlot(cmd)
+
+		self.mutex.Unlock()
+	case commandRestoreSlot:
+		self.handleCommandRestoreSlot(cmd)
+
+		self.mutex.Unlock()
+	case commandReplaceSlot:
+		self.handleCommandReplaceSlot(cmd)
+
+		self.mutex.Unlock()
+	case commandReplayAppendOnly:
+		self.handleCommandReplayAppendOnly(cmd)
+
+		self.mutex.Unlock()
+	case commandSetSlotState:
+		self.handleCommandSetSlotState(cmd)
+
+		self.mutex.Unlock()
+	case commandSlotState:
+		self.handleCommandSlotState(cmd)
+
+		self.mutex.Unlock()
+	case commandSetSlotOwner:
+		self.handleCommandSetSlotOwner(cmd)
+
+		self.mutex.Unlock()
+	case commandDeleteSlot:
+		self.handleCommandDeleteSlot(cmd)
+
 		self.mutex.Unlock()
 	case commandPing:
 		self.mutex.Unlock()
 	case commandStats:
 		cmd.Resp.sizeInBytes = self.sizeInBytes
+		cmd.Resp.keys = int64(len(self.storage))
 
 		self.mutex.Unlock()
 	case commandDeleteExpired:
@@ -146,8 +377,7 @@ func (self *slotStorage) processCommand(command command) {
 			// Prune expired keys.
 			// TODO: This could be non-performant for large caches and might need to be works a bit smarter with sampling or other strategy.
 			if self.storage[key].isExpired() {
-				self.sizeInBytes += int64(-len(self.storage[key].value))
-				delete(self.storage, key)
+				self.expireKey(key, self.storage[key])
 			}
 		}
 		cmd.Resp.Exists = false
@@ -163,10 +393,15 @@ func (self *slotStorage) processCommand(command command) {
 				lruAccessTime = self.storage[key].lastAccessTime
 			}
 		}
-		self.handleCommandDelete(commandDelete{
-			Key:  lruKey,
-			Resp: cmd.Resp,
-		})
+		data, exists := self.lookupKey(lruKey)
+		if exists {
+			self.sizeInBytes -= data.sizeInBytes()
+			delete(self.storage, lruKey)
+			self.logDelete(lruKey)
+			self.notifier.notify(KeyspaceEventEvicted, lruKey)
+		}
+		cmd.Resp.Exists = exists
+		cmd.Resp.Value = data.value
 
 		self.mutex.Unlock()
 	default:
@@ -175,16 +410,62 @@ func (self *slotStorage) processCommand(command command) {
 		// This should never be hit and would indicate an internal library issue, so trigger a panic.
 		panic(fmt.Sprintf("unexpected command type: %T, %+v", command, command))
 	}
+
+	return nil
+}
+
+// lookupKey returns the stored data for a key, lazily deleting the key if it has expired.
+func (self *slotStorage) lookupKey(key string) (keyStorage, bool) {
+	data, exists := self.storage[key]
+	if exists && data.isExpired() {
+		self.expireKey(key, data)
+		return keyStorage{}, false //nolint:exhaustruct // reason: zero value for a key that does not exist
+	}
+	return data, exists
+}
+
+// expireKey that has expired, which is deleted once it is accessed or by the expire worker.
+func (self *slotStorage) expireKey(key string, data keyStorage) {
+	self.sizeInBytes -= data.sizeInBytes()
+	delete(self.storage, key)
+	self.notifier.notify(KeyspaceEventExpired, key)
+}
+
+// storeKey writes the data for a key and updates the slot size from the previous size of the data.
+// The previous size must be taken before any modification since objects are modified in place.
+func (self *slotStorage) storeKey(key string, previousSize int64, data keyStorage) {
+	self.sizeInBytes += data.sizeInBytes() - previousSize
+	self.storage[key] = data
+	self.logPut(key, data)
+	self.notifier.notify(KeyspaceEventSet, key)
+}
+
+// removeKey deletes a key that exists and updates the slot size from the previous size of the data.
+func (self *slotStorage) removeKey(key string, previousSize int64) {
+	self.sizeInBytes -= previousSize
+	delete(self.storage, key)
+	self.logDelete(key)
+	self.notifier.notify(KeyspaceEventDel, key)
 }
 
 func (self *slotStorage) handleCommandDelete(cmd commandDelete) {
 	previousData, exists := self.storage[cmd.Key]
-	self.sizeInBytes += int64(-len(previousData.value))
+	if cmd.StringOnly && exists && !previousData.isExpired() && previousData.object != nil {
+		cmd.Resp.Exists = true
+		cmd.Resp.WrongType = true
+		return
+	}
+	self.sizeInBytes -= previousData.sizeInBytes()
 	if previousData.isExpired() {
 		exists = false
 		previousData.value = nil
+		self.notifier.notify(KeyspaceEventExpired, cmd.Key)
 	}
 	delete(self.storage, cmd.Key)
+	if exists {
+		self.logDelete(cmd.Key)
+		self.notifier.notify(KeyspaceEventDel, cmd.Key)
+	}
 	cmd.Resp.Exists = exists
 	cmd.Resp.Value = previousData.value
 }
@@ -0,0 +1,497 @@
+// Package client connects to datkey servers over the Redis serialization protocol.
+//
+// The Client has the same commands as the embedded datkey.Datkey, so that either can be used through datkey.KeyValue.
+// Connections are pooled per node, commands that fail to reach a node are retried, and keys are routed to the node
+// serving their slot in cluster mode, learned from the MOVED redirects of the nodes.
+//
+// Independent servers that are not in cluster mode can shard keys between them with a consistent hash ring, see
+// Config.Ring, which routes each key to the node of the ring serving it instead.
+//
+// Values read by Get can be cached locally for keys that are read far more often than they change, see
+// Config.NearCacheSize. The nodes send invalidation messages for the keys cached once they change, to a connection the
+// client keeps subscribed to them on each node.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/hash/ring"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// maxRedirects of a command before giving up, which only happens while the cluster is being reconfigured.
+const maxRedirects = 5
+
+type requestErr errors.Cause
+
+const (
+	// requestErrConnection is a failure to reach a node, after which the command is retried.
+	requestErrConnection = requestErr(iota + 1)
+	requestErrTimeout
+	requestErrProtocol
+	requestErrAuth
+	requestErrClosed
+	requestErrRedirect
+	requestErrNoNode
+	// requestErrWrongType and requestErrReply are errors replied by the node.
+	requestErrWrongType
+	requestErrReply
+)
+
+type Config struct {
+	// Addresses of the nodes to connect to. In cluster mode, the other nodes are discovered from redirects.
+	// Required, unless Ring is set.
+	Addresses []string
+
+	// Username to authenticate as. Requires Password.
+	// Default: None (authenticate as the default user)
+	Username string
+
+	// Password to authenticate with.
+	// Default: None (do not authenticate)
+	Password string
+
+	// TLSConfig to encrypt connections with.
+	// Default: None (connections are not encrypted)
+	TLSConfig *tls.Config
+
+	// PoolSize is the maximum number of connections to each node.
+	// Default: 10
+	PoolSize int
+
+	// PoolTimeout to wait for a connection when all connections to a node are in use.
+	// Default: 1s
+	PoolTimeout time.Duration
+
+	// DialTimeout to connect to a node.
+	// Default: 5s
+	DialTimeout time.Duration
+
+	// CommandTimeout for each round trip to a node.
+	// Default: 1s
+	CommandTimeout time.Duration
+
+	// MaxRetries of a command that failed to reach a node. Commands that timed out are not retried, since the node may
+	// have run them. Negative disables retries.
+	// Default: 3
+	MaxRetries int
+
+	// RetryBackoff before the first retry, which doubles for every retry after it.
+	// Default: 10ms
+	RetryBackoff time.Duration
+
+	// Partitioner of keys into slots, which must be the partitioner of the servers so that commands are sent to the
+	// node serving their slot rather than redirected.
+	// Default: hash.NewCRC16Partitioner(hash.MaxHashSlot), as Redis Cluster
+	Partitioner hash.Partitioner
+
+	// Ring of independent nodes to shard keys between, which are not in cluster mode. Each key is sent to the node of
+	// the ring serving it, and nodes can be added to or removed from the ring while the client is in use. Keys move
+	// between the nodes as they change, so they are not found on the node they were written to until written again.
+	// Default: None (keys are routed by slot, as in cluster mode)
+	Ring *ring.Ring
+
+	// NearCacheSize is the number of values read by Get that are cached locally, which saves a round trip for keys
+	// that are read far more often than they change. The nodes track the keys read and send an invalidation message
+	// once any of them changes, as by Redis CLIENT TRACKING, so a value may be read from the cache for a moment after
+	// it changed, but not after a write by the same client. A key that expires is only invalidated once the node
+	// deletes it. Entries are evicted at random once the cache is full. Pipelined reads are not cached.
+	// Default: 0 (values are not cached)
+	NearCacheSize int
+
+	// NearCachePrefixes of the keys to cache. The nodes send an invalidation message for every change to a key with
+	// one of the prefixes, rather than remembering the keys read by the client, which saves memory on the nodes when
+	// the client reads many keys. Requires NearCacheSize.
+	// Default: None (every key is cached, and the nodes remember the keys read)
+	NearCachePrefixes []string
+}
+
+// Client of datkey servers. Safe for concurrent use.
+type Client struct {
+	config     Config
+	slots      *slotMap
+	pools      map[string]*pool
+	poolsMutex sync.Mutex
+	refreshing atomic.Bool
+	nearCache  *nearCache
+	// trackers of each node, sent the invalidation messages of the near cache.
+	trackers       map[string]*tracker
+	trackersClosed bool
+	trackersMutex  sync.Mutex
+}
+
+var _ datkey.KeyValue = (*Client)(nil)
+
+// New client of the nodes at the config addresses. Connections are opened as they are needed.
+func New(config Config) *Client {
+	if len(config.Addresses) == 0 && config.Ring == nil {
+		panic("client requires at least one address or a ring")
+	}
+
+	if config.PoolSize == 0 {
+		config.PoolSize = 10
+	}
+
+	if config.PoolTimeout == 0 {
+		config.PoolTimeout = time.Second
+	}
+
+	if config.DialTimeout == 0 {
+		config.DialTimeout = 5 * time.Second //nolint:mnd // reason: default value
+	}
+
+	if config.CommandTimeout == 0 {
+		config.CommandTimeout = time.Second
+	}
+
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = 10 * time.Millisecond //nolint:mnd // reason: default value
+	}
+
+	if len(config.NearCachePrefixes) != 0 && config.NearCacheSize == 0 {
+		panic("near cache prefixes require a near cache size")
+	}
+
+	if config.Partitioner == nil {
+		config.Partitioner = hash.NewCRC16Partitioner(int(hash.MaxHashSlot))
+	}
+
+	return &Client{
+		config:         config,
+		slots:          &slotMap{}, //nolint:exhaustruct // reason: every slot starts with no known node
+		pools:          map[string]*pool{},
+		poolsMutex:     sync.Mutex{},
+		refreshing:     atomic.Bool{},
+		nearCache:      newNearCache(config),
+		trackers:       map[string]*tracker{},
+		trackersClosed: false,
+		trackersMutex:  sync.Mutex{},
+	}
+}
+
+// Close every connection. Commands in progress fail.
+func (self *Client) Close() {
+	self.poolsMutex.Lock()
+	defer self.poolsMutex.Unlock()
+
+	for _, pool := range self.pools {
+		pool.close()
+	}
+	self.closeTrackers()
+}
+
+// Set a key.
+// If ttl=0, then the key will never expire. A negative ttl returns DbWriteInvalidArgument.
+func (self *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (datkey.SetResponse, *errors.Error[datkey.DbWriteErr]) {
+	if ttl < 0 {
+		return datkey.SetResponse{}, errors.New(datkey.DbWriteInvalidArgument, "ttl must not be negative: %s", ttl) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	replies, err := self.do(ctx, key, setCommand(key, value, ttl, true))
+	return self.setResult(ctx, key, value, ttl, replies, err)
+}
+
+// Delete a key.
+func (self *Client) Delete(ctx context.Context, key string) (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+	replies, err := self.do(ctx, key, command("GETDEL", key))
+	return self.deleteResult(ctx, key, replies, err)
+}
+
+// Get a key.
+// Returns DbReadWrongType if the key does not hold a string value.
+// Values are read from the near cache, if configured.
+func (self *Client) Get(ctx context.Context, key string) (datkey.GetResponse, *errors.Error[datkey.DbReadErr]) {
+	response, entry, cached := self.nearCache.get(key)
+	if cached {
+		return response, nil
+	}
+
+	replies, err := self.do(ctx, key, command("GET", key))
+	response, getErr := getResult(replies, err)
+	if getErr != nil {
+		self.nearCache.abandon(key, entry)
+		return response, getErr
+	}
+	self.nearCache.store(key, entry, response)
+	return response, nil
+}
+
+// Expire a key in a given TTL. A ttl that is not positive deletes the key.
+func (self *Client) Expire(ctx context.Context, key string, ttl time.Duration) (datkey.ExpireResponse, *errors.Error[datkey.DbWriteErr]) {
+	replies, err := self.do(ctx, key, expireCommand(key, ttl))
+	self.nearCache.invalidate(key)
+	return expireResult(replies, err)
+}
+
+// Persist a key by removing any TTL.
+func (self *Client) Persist(ctx context.Context, key string) (datkey.PersistResponse, *errors.Error[datkey.DbWriteErr]) {
+	replies, err := self.do(ctx, key, command("EXISTS", key), command("PERSIST", key))
+	self.nearCache.invalidate(key)
+	return persistResult(replies, err)
+}
+
+// Ttl of a key.
+func (self *Client) Ttl(ctx context.Context, key string) (datkey.TtlResponse, *errors.Error[datkey.DbReadErr]) {
+	replies, err := self.do(ctx, key, command("PTTL", key))
+	return ttlResult(replies, err)
+}
+
+// Ping every known node.
+func (self *Client) Ping(ctx context.Context) *errors.Error[datkey.DbReadErr] {
+	for _, address := range self.addresses() {
+		replies, err := self.roundTrip(ctx, address, [][][]byte{command("PING")})
+		if err == nil {
+			err = replyErr(replies[0])
+		}
+		if err != nil {
+			return readErr(err)
+		}
+	}
+	return nil
+}
+
+// Stats summed over every known node. Nodes that cannot be reached are not counted.
+func (self *Client) Stats(ctx context.Context) datkey.StatsResponse {
+	stats := datkey.StatsResponse{
+		DbSizeInBytes: 0,
+		Replication:   datkey.ReplicationStats{}, //nolint:exhaustruct // reason: replication is per node, see INFO replication
+	}
+
+	for _, address := range self.addresses() {
+		replies, err := self.roundTrip(ctx, address, [][][]byte{command("INFO", "memory")})
+		if err != nil || replies[0].kind != replyBulk {
+			continue
+		}
+
+		for _, line := range strings.Split(string(replies[0].bulk), "\r\n") {
+			if value, found := strings.CutPrefix(line, "used_memory_dataset:"); found {
+				size, _ := strconv.ParseInt(value, 10, 64)
+				stats.DbSizeInBytes += size
+			}
+		}
+	}
+
+	return stats
+}
+
+// do the commands on the node serving the key, in a single round trip. Commands are sent again if the node redirects
+// any of them or if the node cannot be reached, so the commands must be safe to repeat.
+func (self *Client) do(ctx context.Context, key string, commands ...[][]byte) ([]reply, *errors.Error[requestErr]) {
+	slot := self.config.Partitioner.Slot(key)
+
+	var ask string
+	var retries, redirects int
+	for {
+		address := ask
+		send := commands
+		if ask != "" {
+			send = append([][][]byte{command("ASKING")}, commands...)
+		} else if address = self.node(key); address == "" {
+			return nil, errors.New(requestErrNoNode, "no node serves key %s", key)
+		}
+
+		replies, err := self.roundTrip(ctx, address, send)
+		if err == nil && ask != "" {
+			replies = replies[1:]
+		}
+		ask = ""
+
+		if err == nil {
+			if redirect, isRedirect := firstRedirect(replies); isRedirect {
+				if redirects >= maxRedirects {
+					return nil, errors.New(requestErrRedirect, "too many redirects for slot %d, last to %s", slot, redirect.address)
+				}
+				redirects++
+
+				if redirect.ask {
+					ask = redirect.address
+				} else {
+					self.slots.set(hash.Range{Begin: redirect.slot, End: redirect.slot}, redirect.address)
+					if self.config.Ring == nil {
+						self.refreshSlots()
+					}
+				}
+				continue
+			}
+
+			if !retryableReply(replies) {
+				return replies, nil
+			}
+			err = replyErr(firstError(replies))
+		} else if err.Cause != requestErrConnection {
+			return nil, err
+		} else if self.config.Ring == nil {
+			// The node may have failed, so refresh where the slot is served.
+			self.refreshSlots()
+		}
+
+		if retries >= self.config.MaxRetries {
+			if err.Cause == requestErrConnection {
+				return nil, err
+			}
+			// The node kept replying with an error to try again later.
+			return replies, nil
+		}
+		backoff := time.NewTimer(self.config.RetryBackoff << retries)
+		select {
+		case <-ctx.Done():
+			backoff.Stop()
+			return nil, errors.NewFromError(requestErrTimeout, ctx.Err())
+		case <-backoff.C:
+		}
+		retries++
+	}
+}
+
+// roundTrip the commands to a node on a pooled connection.
+func (self *Client) roundTrip(ctx context.Context, address string, commands [][][]byte) ([]reply, *errors.Error[requestErr]) {
+	pool := self.pool(address)
+
+	connection, err := pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	trackerID, tracking := self.tracking(ctx, address, connection)
+	if tracking != nil {
+		commands = append([][][]byte{tracking}, commands...)
+	}
+
+	replies, err := connection.roundTrip(ctx, commands, self.config.CommandTimeout)
+	if err == nil && tracking != nil {
+		if replies[0].kind == replyError {
+			// The node cannot track the keys read, so reads in progress must not be cached.
+			self.nearCache.flush()
+		} else {
+			connection.trackingID = trackerID
+		}
+		replies = replies[1:]
+	}
+	pool.put(connection, err != nil)
+	return replies, err
+}
+
+func (self *Client) pool(address string) *pool {
+	self.poolsMutex.Lock()
+	defer self.poolsMutex.Unlock()
+
+	nodePool, exists := self.pools[address]
+	if !exists {
+		nodePool = newPool(address, self.config)
+		self.pools[address] = nodePool
+	}
+	return nodePool
+}
+
+// node serving the key: the node of the ring, or else the node known to serve its slot, or else the first address.
+// Empty if the ring has no nodes.
+func (self *Client) node(key string) string {
+	if self.config.Ring != nil {
+		return self.config.Ring.Node(key)
+	}
+	if address := self.slots.node(self.config.Partitioner.Slot(key)); address != "" {
+		return address
+	}
+	return self.config.Addresses[0]
+}
+
+// addresses of every node the client knows of.
+func (self *Client) addresses() []string {
+	addresses := self.slots.addresses()
+	configured := self.config.Addresses
+	if self.config.Ring != nil {
+		configured = append(self.config.Ring.Nodes(), configured...)
+	}
+	for _, address := range configured {
+		known := false
+		for _, knownAddress := range addresses {
+			known = known || knownAddress == address
+		}
+		if !known {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+func firstRedirect(replies []reply) (redirect, bool) {
+	for _, value := range replies {
+		if redirect, isRedirect := parseRedirect(value); isRedirect {
+			return redirect, true
+		}
+	}
+	return redirect{}, false //nolint:exhaustruct // reason: zero value on error
+}
+
+func firstError(replies []reply) reply {
+	for _, value := range replies {
+		if value.kind == replyError {
+			return value
+		}
+	}
+	return reply{} //nolint:exhaustruct // reason: no error
+}
+
+// retryableReply if a node replied that it cannot run a command yet, such as while it loads its data.
+func retryableReply(replies []reply) bool {
+	switch firstError(replies).errorPrefix() {
+	case "TRYAGAIN", "LOADING", "CLUSTERDOWN":
+		return true
+	default:
+		return false
+	}
+}
+
+// replyErr of an error reply, or nil if the reply is not an error.
+func replyErr(value reply) *errors.Error[requestErr] {
+	switch {
+	case value.kind != replyError:
+		return nil
+	case value.errorPrefix() == "WRONGTYPE":
+		return errors.New(requestErrWrongType, "%s", value.bulk)
+	default:
+		return errors.New(requestErrReply, "%s", value.bulk)
+	}
+}
+
+func readErr(err *errors.Error[requestErr]) *errors.Error[datkey.DbReadErr] {
+	switch err.Cause {
+	case requestErrTimeout:
+		return errors.NewFromError(datkey.DbReadCanceled, err)
+	case requestErrRedirect:
+		return errors.NewFromError(datkey.DbReadRedirect, err)
+	case requestErrWrongType:
+		return errors.NewFromError(datkey.DbReadWrongType, err)
+	case requestErrConnection, requestErrProtocol, requestErrAuth, requestErrClosed, requestErrNoNode, requestErrReply:
+		return errors.NewFromError(datkey.DbReadInternal, err)
+	default:
+		return errors.NewFromError(datkey.DbReadInternal, err)
+	}
+}
+
+func writeErr(err *errors.Error[requestErr]) *errors.Error[datkey.DbWriteErr] {
+	switch err.Cause {
+	case requestErrTimeout:
+		return errors.NewFromError(datkey.DbWriteCanceled, err)
+	case requestErrRedirect:
+		return errors.NewFromError(datkey.DbWriteRedirect, err)
+	case requestErrWrongType:
+		return errors.NewFromError(datkey.DbWriteWrongType, err)
+	case requestErrConnection, requestErrProtocol, requestErrAuth, requestErrClosed, requestErrNoNode, requestErrReply:
+		return errors.NewFromError(datkey.DbWriteInternal, err)
+	default:
+		return errors.NewFromError(datkey.DbWriteInternal, err)
+	}
+}
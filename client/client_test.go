@@ -0,0 +1,685 @@
+package client_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/client"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/hash/ring"
+	"github.com/wspowell/datkey/lib/errors"
+	"github.com/wspowell/datkey/server"
+)
+
+func newDb(t *testing.T) *datkey.Datkey {
+	t.Helper()
+
+	var config datkey.Config
+	db := datkey.New(config)
+	t.Cleanup(db.Close)
+	return db
+}
+
+// serve the database on the address, returning the server and the address it listens on.
+func serve(t *testing.T, db datkey.Store, address string) (*server.Server, string) {
+	t.Helper()
+
+	srv := server.New(db, server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     nil,
+		ACL:              nil,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+	t.Cleanup(srv.Close)
+
+	listener, err := net.Listen("tcp", address)
+	require.NoError(t, err)
+
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+
+	return srv, listener.Addr().String()
+}
+
+func newClient(t *testing.T, addresses ...string) *client.Client {
+	t.Helper()
+
+	keyValue := client.New(client.Config{
+		Addresses:         addresses,
+		Username:          "",
+		Password:          "",
+		TLSConfig:         nil,
+		PoolSize:          0,
+		PoolTimeout:       0,
+		DialTimeout:       0,
+		CommandTimeout:    0,
+		MaxRetries:        0,
+		RetryBackoff:      0,
+		Partitioner:       nil,
+		Ring:              nil,
+		NearCacheSize:     0,
+		NearCachePrefixes: nil,
+	})
+	t.Cleanup(keyValue.Close)
+	return keyValue
+}
+
+// fakeNode replying to every command with the reply of the handler, which is given the command arguments.
+func fakeNode(t *testing.T, handler func(args []string) string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					args := make([]string, count)
+					for index := range args {
+						// Skip the length of the bulk string.
+						if _, err := reader.ReadString('\n'); err != nil {
+							return
+						}
+						arg, err := reader.ReadString('\n')
+						if err != nil {
+							return
+						}
+						args[index] = strings.TrimSuffix(arg, "\r\n")
+					}
+					if _, err := conn.Write([]byte(handler(args))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// Test_Client_KeyValue runs the same commands on the embedded database and the client of a server.
+func Test_Client_KeyValue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, address := serve(t, newDb(t), "127.0.0.1:0")
+
+	for name, keyValue := range map[string]datkey.KeyValue{
+		"embedded": newDb(t),
+		"client":   newClient(t, address),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Nil(t, keyValue.Ping(ctx))
+
+			setResp, setErr := keyValue.Set(ctx, "key", []byte("value"), 0)
+			require.Nil(t, setErr)
+			assert.False(t, setResp.Exists)
+
+			setResp, setErr = keyValue.Set(ctx, "key", []byte("new"), time.Hour)
+			require.Nil(t, setErr)
+			assert.True(t, setResp.Exists)
+			assert.Equal(t, []byte("value"), setResp.PreviousValue)
+
+			getResp, getErr := keyValue.Get(ctx, "key")
+			require.Nil(t, getErr)
+			assert.True(t, getResp.Exists)
+			assert.Equal(t, []byte("new"), getResp.Value)
+
+			ttlResp, ttlErr := keyValue.Ttl(ctx, "key")
+			require.Nil(t, ttlErr)
+			assert.True(t, ttlResp.Exists)
+			assert.InDelta(t, time.Hour, ttlResp.Ttl, float64(time.Second))
+
+			persistResp, persistErr := keyValue.Persist(ctx, "key")
+			require.Nil(t, persistErr)
+			assert.Equal(t, datkey.PersistResponse{Exists: true, Persisted: true}, persistResp)
+			persistResp, persistErr = keyValue.Persist(ctx, "key")
+			require.Nil(t, persistErr)
+			assert.Equal(t, datkey.PersistResponse{Exists: true, Persisted: false}, persistResp)
+			persistResp, persistErr = keyValue.Persist(ctx, "missing")
+			require.Nil(t, persistErr)
+			assert.Equal(t, datkey.PersistResponse{Exists: false, Persisted: false}, persistResp)
+
+			ttlResp, ttlErr = keyValue.Ttl(ctx, "key")
+			require.Nil(t, ttlErr)
+			assert.Equal(t, datkey.TtlResponse{Ttl: 0, Exists: true}, ttlResp)
+
+			expireResp, expireErr := keyValue.Expire(ctx, "key", time.Minute)
+			require.Nil(t, expireErr)
+			assert.True(t, expireResp.Exists)
+			expireResp, expireErr = keyValue.Expire(ctx, "missing", time.Minute)
+			require.Nil(t, expireErr)
+			assert.False(t, expireResp.Exists)
+
+			deleteResp, deleteErr := keyValue.Delete(ctx, "key")
+			require.Nil(t, deleteErr)
+			assert.True(t, deleteResp.Exists)
+			assert.Equal(t, []byte("new"), deleteResp.DeletedValue)
+
+			getResp, getErr = keyValue.Get(ctx, "key")
+			require.Nil(t, getErr)
+			assert.False(t, getResp.Exists)
+
+			ttlResp, ttlErr = keyValue.Ttl(ctx, "key")
+			require.Nil(t, ttlErr)
+			assert.False(t, ttlResp.Exists)
+
+			assert.GreaterOrEqual(t, keyValue.Stats(ctx).DbSizeInBytes, int64(0))
+		})
+	}
+}
+
+func Test_Client_wrongType(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := newDb(t)
+	_, address := serve(t, db, "127.0.0.1:0")
+	keyValue := newClient(t, address)
+
+	_, zaddErr := db.ZAdd(ctx, "zset", datkey.ZMember{Member: "member", Score: 1})
+	require.Nil(t, zaddErr)
+
+	_, getErr := keyValue.Get(ctx, "zset")
+	require.NotNil(t, getErr)
+	assert.Equal(t, datkey.DbReadWrongType, getErr.Cause)
+
+	deleteResp, deleteErr := keyValue.Delete(ctx, "zset")
+	require.Nil(t, deleteErr)
+	assert.True(t, deleteResp.Exists)
+	assert.Nil(t, deleteResp.DeletedValue)
+
+	_, zaddErr = db.ZAdd(ctx, "zset", datkey.ZMember{Member: "member", Score: 1})
+	require.Nil(t, zaddErr)
+
+	setResp, setErr := keyValue.Set(ctx, "zset", []byte("value"), 0)
+	require.Nil(t, setErr)
+	assert.True(t, setResp.Exists)
+
+	getResp, getErr := keyValue.Get(ctx, "zset")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+
+	_, setErr = keyValue.Set(ctx, "key", []byte("value"), -time.Second)
+	require.NotNil(t, setErr)
+	assert.Equal(t, datkey.DbWriteInvalidArgument, setErr.Cause)
+}
+
+func Test_Client_Pipeline(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, address := serve(t, newDb(t), "127.0.0.1:0")
+	keyValue := newClient(t, address)
+
+	pipeline := keyValue.Pipeline()
+	sets := make([]*client.Result[datkey.SetResponse, datkey.DbWriteErr], 100)
+	for index := range sets {
+		sets[index] = pipeline.Set(fmt.Sprintf("key:%d", index), []byte(strconv.Itoa(index)), 0)
+	}
+	expire := pipeline.Expire("key:0", time.Hour)
+	ttl := pipeline.Ttl("key:0")
+	deleted := pipeline.Delete("key:1")
+	persist := pipeline.Persist("key:0")
+	get := pipeline.Get("key:1")
+	pipeline.Exec(ctx)
+
+	for _, set := range sets {
+		_, err := set.Result()
+		require.Nil(t, err)
+	}
+
+	expireResp, expireErr := expire.Result()
+	require.Nil(t, expireErr)
+	assert.True(t, expireResp.Exists)
+
+	ttlResp, ttlErr := ttl.Result()
+	require.Nil(t, ttlErr)
+	assert.InDelta(t, time.Hour, ttlResp.Ttl, float64(time.Second))
+
+	deleteResp, deleteErr := deleted.Result()
+	require.Nil(t, deleteErr)
+	assert.Equal(t, []byte("1"), deleteResp.DeletedValue)
+
+	persistResp, persistErr := persist.Result()
+	require.Nil(t, persistErr)
+	assert.True(t, persistResp.Exists)
+
+	getResp, getErr := get.Result()
+	require.Nil(t, getErr)
+	assert.False(t, getResp.Exists)
+
+	// The pipeline is reused once executed.
+	get = pipeline.Get("key:99")
+	pipeline.Exec(ctx)
+	getResp, getErr = get.Result()
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("99"), getResp.Value)
+}
+
+func Test_Client_retry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := newDb(t)
+	srv, address := serve(t, db, "127.0.0.1:0")
+	keyValue := newClient(t, address)
+
+	_, setErr := keyValue.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, setErr)
+
+	// The pooled connection is closed by the server, so the command is retried on a new connection.
+	srv.Close()
+	serve(t, db, address)
+
+	getResp, getErr := keyValue.Get(ctx, "key")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+}
+
+func Test_Client_unreachable(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	keyValue := newClient(t, address)
+
+	_, getErr := keyValue.Get(ctx, "key")
+	require.NotNil(t, getErr)
+	assert.Equal(t, datkey.DbReadInternal, getErr.Cause)
+	require.NotNil(t, keyValue.Ping(ctx))
+}
+
+func Test_Client_redirect(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := newDb(t)
+	_, address := serve(t, db, "127.0.0.1:0")
+
+	var commands atomic.Int64
+	redirecting := fakeNode(t, func(args []string) string {
+		if strings.EqualFold(args[0], "CLUSTER") {
+			return "-ERR unknown command 'CLUSTER'\r\n"
+		}
+		commands.Add(1)
+
+		key := args[1]
+		if strings.HasPrefix(key, "ask:") {
+			return fmt.Sprintf("-ASK %d %s\r\n", hash.ToSlot(key), address)
+		}
+		return fmt.Sprintf("-MOVED %d %s\r\n", hash.ToSlot(key), address)
+	})
+
+	// The node imports the slot of the asked keys from the redirecting node, which still owns it.
+	askSlots := hash.Range{Begin: hash.ToSlot("ask:key"), End: hash.ToSlot("ask:key")}
+	require.NotEqual(t, askSlots.Begin, hash.ToSlot("key"))
+	db.SetSlotsOwner(askSlots, redirecting)
+	db.SetSlotsImporting(askSlots, redirecting)
+
+	keyValue := newClient(t, redirecting)
+
+	// MOVED redirects are remembered for the slot.
+	_, setErr := keyValue.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, setErr)
+	assert.Equal(t, int64(1), commands.Load())
+
+	getResp, getErr := keyValue.Get(ctx, "key")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+	assert.Equal(t, int64(1), commands.Load())
+
+	// ASK redirects are followed once.
+	_, setErr = keyValue.Set(ctx, "ask:key", []byte("value"), 0)
+	require.Nil(t, setErr)
+	getResp, getErr = keyValue.Get(ctx, "ask:key")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+	assert.Equal(t, int64(3), commands.Load())
+
+	// Pipelined commands are redirected on their own.
+	pipeline := keyValue.Pipeline()
+	get := pipeline.Get("key")
+	askGet := pipeline.Get("ask:key")
+	pipeline.Exec(ctx)
+	getResp, getErr = get.Result()
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+	getResp, getErr = askGet.Result()
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+}
+
+func Test_Client_cluster(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sourceDb, targetDb := newDb(t), newDb(t)
+	_, source := serve(t, sourceDb, "127.0.0.1:0")
+	_, target := serve(t, targetDb, "127.0.0.1:0")
+
+	_, err := targetDb.Set(ctx, "{a}moved", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = targetDb.Set(ctx, "{b}owned", []byte("value"), 0)
+	require.Nil(t, err)
+
+	aSlots := hash.Range{Begin: hash.ToSlot("{a}"), End: hash.ToSlot("{a}")}
+	sourceDb.SetSlotsMigrating(aSlots, target)
+	targetDb.SetSlotsImporting(aSlots, source)
+	bSlots := hash.Range{Begin: hash.ToSlot("{b}"), End: hash.ToSlot("{b}")}
+	sourceDb.SetSlotsOwner(bSlots, target)
+
+	keyValue := newClient(t, source)
+
+	// Keys that have migrated are asked of the target.
+	getResp, getErr := keyValue.Get(ctx, "{a}moved")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+
+	// Keys of slots owned by the target are read from it.
+	getResp, getErr = keyValue.Get(ctx, "{b}owned")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("value"), getResp.Value)
+}
+
+func Test_Client_tooManyRedirects(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var redirecting string
+	redirecting = fakeNode(t, func(args []string) string {
+		return fmt.Sprintf("-ASK %d %s\r\n", hash.ToSlot(args[len(args)-1]), redirecting)
+	})
+
+	keyValue := newClient(t, redirecting)
+
+	_, getErr := keyValue.Get(ctx, "key")
+	require.NotNil(t, getErr)
+	assert.Equal(t, datkey.DbReadRedirect, getErr.Cause)
+}
+
+func Test_Client_ring(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dbs := map[string]*datkey.Datkey{}
+	for range 3 {
+		db := newDb(t)
+		_, address := serve(t, db, "127.0.0.1:0")
+		dbs[address] = db
+	}
+	var ringConfig ring.Config
+	keyRing := ring.New(ringConfig)
+	for address := range dbs {
+		keyRing.Add(address)
+	}
+
+	keyValue := client.New(client.Config{
+		Addresses:         nil,
+		Username:          "",
+		Password:          "",
+		TLSConfig:         nil,
+		PoolSize:          0,
+		PoolTimeout:       0,
+		DialTimeout:       0,
+		CommandTimeout:    0,
+		MaxRetries:        0,
+		RetryBackoff:      0,
+		Partitioner:       nil,
+		Ring:              keyRing,
+		NearCacheSize:     0,
+		NearCachePrefixes: nil,
+	})
+	t.Cleanup(keyValue.Close)
+	require.Nil(t, keyValue.Ping(ctx))
+
+	// Keys are stored only on the node of the ring serving them, and every node serves some of the keys.
+	pipeline := keyValue.Pipeline()
+	for index := range 300 {
+		key := fmt.Sprintf("key-%d", index)
+		if index%2 == 0 {
+			_, err := keyValue.Set(ctx, key, []byte("value"), 0)
+			require.Nil(t, err)
+		} else {
+			pipeline.Set(key, []byte("value"), 0)
+		}
+	}
+	pipeline.Exec(ctx)
+
+	for index := range 300 {
+		key := fmt.Sprintf("key-%d", index)
+		for address, db := range dbs {
+			getResp, getErr := db.Get(ctx, key)
+			require.Nil(t, getErr)
+			assert.Equal(t, address == keyRing.Node(key), getResp.Exists, key)
+		}
+
+		getResp, getErr := keyValue.Get(ctx, key)
+		require.Nil(t, getErr)
+		assert.Equal(t, []byte("value"), getResp.Value)
+	}
+	// Stats are summed across the nodes of the ring.
+	var size int64
+	for address, db := range dbs {
+		assert.Positive(t, db.Stats(ctx).DbSizeInBytes, address)
+		size += db.Stats(ctx).DbSizeInBytes
+	}
+	assert.Equal(t, size, keyValue.Stats(ctx).DbSizeInBytes)
+
+	// Keys of a removed node are served by the other nodes.
+	for address := range dbs {
+		keyRing.Remove(address)
+		break
+	}
+	_, err := keyValue.Set(ctx, "key-0", []byte("value"), 0)
+	require.Nil(t, err)
+
+	// Keys are not served by any node of an empty ring.
+	keyRing.Remove(keyRing.Nodes()...)
+	_, getErr := keyValue.Get(ctx, "key-0")
+	require.NotNil(t, getErr)
+	assert.Equal(t, datkey.DbReadInternal, getErr.Cause)
+}
+
+// countingDb counts the values read from the database.
+type countingDb struct {
+	*datkey.Datkey
+	gets atomic.Int64
+}
+
+func (self *countingDb) Get(ctx context.Context, key string) (datkey.GetResponse, *errors.Error[datkey.DbReadErr]) {
+	self.gets.Add(1)
+	return self.Datkey.Get(ctx, key)
+}
+
+func Test_Client_nearCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := &countingDb{Datkey: newDb(t), gets: atomic.Int64{}}
+	_, address := serve(t, db, "127.0.0.1:0")
+	other := newClient(t, address)
+
+	keyValue := client.New(client.Config{
+		Addresses:         []string{address},
+		Username:          "",
+		Password:          "",
+		TLSConfig:         nil,
+		PoolSize:          0,
+		PoolTimeout:       0,
+		DialTimeout:       0,
+		CommandTimeout:    0,
+		MaxRetries:        0,
+		RetryBackoff:      0,
+		Partitioner:       nil,
+		Ring:              nil,
+		NearCacheSize:     10,
+		NearCachePrefixes: nil,
+	})
+	t.Cleanup(keyValue.Close)
+
+	// Values read are cached, including keys that do not exist.
+	for range 3 {
+		getResp, getErr := keyValue.Get(ctx, "key")
+		require.Nil(t, getErr)
+		assert.False(t, getResp.Exists)
+	}
+	assert.Equal(t, int64(1), db.gets.Load())
+
+	// Keys written by another client are invalidated once the node sends an invalidation message.
+	_, setErr := other.Set(ctx, "key", []byte("first"), 0)
+	require.Nil(t, setErr)
+	assert.Eventually(t, func() bool {
+		getResp, getErr := keyValue.Get(ctx, "key")
+		return getErr == nil && string(getResp.Value) == "first"
+	}, 5*time.Second, time.Millisecond)
+	gets := db.gets.Load()
+	getResp, getErr := keyValue.Get(ctx, "key")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("first"), getResp.Value)
+	assert.Equal(t, gets, db.gets.Load())
+
+	// Values read from the cache are copies.
+	getResp.Value[0] = 'F'
+	getResp, getErr = keyValue.Get(ctx, "key")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("first"), getResp.Value)
+
+	// The client reads its own writes at once.
+	_, setErr = keyValue.Set(ctx, "key", []byte("second"), 0)
+	require.Nil(t, setErr)
+	getResp, getErr = keyValue.Get(ctx, "key")
+	require.Nil(t, getErr)
+	assert.Equal(t, []byte("second"), getResp.Value)
+	_, expireErr := keyValue.Expire(ctx, "key", 0)
+	require.Nil(t, expireErr)
+	getResp, getErr = keyValue.Get(ctx, "key")
+	require.Nil(t, getErr)
+	assert.False(t, getResp.Exists)
+
+	// Keys changed in the database by any means are invalidated.
+	_, setErr = db.Set(ctx, "key", []byte("third"), 0)
+	require.Nil(t, setErr)
+	assert.Eventually(t, func() bool {
+		getResp, getErr := keyValue.Get(ctx, "key")
+		return getErr == nil && string(getResp.Value) == "third"
+	}, 5*time.Second, time.Millisecond)
+
+	// The cache holds at most NearCacheSize values.
+	for index := range 20 {
+		_, getErr := keyValue.Get(ctx, fmt.Sprintf("key-%d", index))
+		require.Nil(t, getErr)
+	}
+	gets = db.gets.Load()
+	for index := range 20 {
+		_, getErr := keyValue.Get(ctx, fmt.Sprintf("key-%d", index))
+		require.Nil(t, getErr)
+	}
+	assert.GreaterOrEqual(t, db.gets.Load()-gets, int64(10))
+}
+
+func Test_Client_nearCache_prefixes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := &countingDb{Datkey: newDb(t), gets: atomic.Int64{}}
+	srv, address := serve(t, db, "127.0.0.1:0")
+
+	keyValue := client.New(client.Config{
+		Addresses:         []string{address},
+		Username:          "",
+		Password:          "",
+		TLSConfig:         nil,
+		PoolSize:          0,
+		PoolTimeout:       0,
+		DialTimeout:       0,
+		CommandTimeout:    0,
+		MaxRetries:        0,
+		RetryBackoff:      0,
+		Partitioner:       nil,
+		Ring:              nil,
+		NearCacheSize:     10,
+		NearCachePrefixes: []string{"config:"},
+	})
+	t.Cleanup(keyValue.Close)
+
+	// Only keys with a prefix are cached.
+	for range 3 {
+		_, getErr := keyValue.Get(ctx, "config:flag")
+		require.Nil(t, getErr)
+		_, getErr = keyValue.Get(ctx, "other")
+		require.Nil(t, getErr)
+	}
+	assert.Equal(t, int64(4), db.gets.Load())
+
+	// Keys with a prefix are invalidated whether or not they were read.
+	_, setErr := db.Set(ctx, "config:flag", []byte("on"), 0)
+	require.Nil(t, setErr)
+	assert.Eventually(t, func() bool {
+		getResp, getErr := keyValue.Get(ctx, "config:flag")
+		return getErr == nil && string(getResp.Value) == "on"
+	}, 5*time.Second, time.Millisecond)
+
+	// Invalidation messages may be missed once the connection to the node is lost, so nothing cached is read after.
+	srv.Close()
+	assert.Eventually(t, func() bool {
+		_, getErr := keyValue.Get(ctx, "config:flag")
+		return getErr != nil
+	}, 5*time.Second, time.Millisecond)
+
+	assert.Panics(t, func() {
+		client.New(client.Config{
+			Addresses:         []string{address},
+			Username:          "",
+			Password:          "",
+			TLSConfig:         nil,
+			PoolSize:          0,
+			PoolTimeout:       0,
+			DialTimeout:       0,
+			CommandTimeout:    0,
+			MaxRetries:        0,
+			RetryBackoff:      0,
+			Partitioner:       nil,
+			Ring:              nil,
+			NearCacheSize:     0,
+			NearCachePrefixes: []string{"config:"},
+		})
+	})
+}
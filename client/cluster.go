@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wspowell/datkey/hash"
+)
+
+// redirect of a command to the node that serves its slot, replied by a node in cluster mode as either:
+//
+//	MOVED <slot> <address>: the slot is served by the other node from now on.
+//	ASK <slot> <address>: the slot is being migrated and the key may already be on the other node, which is asked once.
+type redirect struct {
+	address string
+	slot    hash.Slot
+	ask     bool
+}
+
+func parseRedirect(value reply) (redirect, bool) {
+	if value.kind != replyError {
+		return redirect{}, false //nolint:exhaustruct // reason: zero value on error
+	}
+
+	fields := strings.Fields(string(value.bulk))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") { //nolint:mnd // reason: MOVED, slot and address
+		return redirect{}, false //nolint:exhaustruct // reason: zero value on error
+	}
+	slot, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil || hash.Slot(slot) >= hash.MaxHashSlot {
+		return redirect{}, false //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return redirect{
+		address: fields[2],
+		slot:    hash.Slot(slot),
+		ask:     fields[0] == "ASK",
+	}, true
+}
+
+// slotMap of the node address serving each slot, as last learned from the cluster. Slots with no known node are
+// sent to any node, which redirects the command if the node does not serve the slot.
+type slotMap struct {
+	nodes [hash.MaxHashSlot]string
+	mutex sync.RWMutex
+}
+
+func (self *slotMap) node(slot hash.Slot) string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.nodes[slot]
+}
+
+func (self *slotMap) set(slots hash.Range, address string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for slot := slots.Begin; slot <= slots.End && slot < hash.MaxHashSlot; slot++ {
+		self.nodes[slot] = address
+	}
+}
+
+// addresses of every node serving a slot.
+func (self *slotMap) addresses() []string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	var addresses []string
+	seen := map[string]bool{}
+	for _, address := range self.nodes {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// refreshSlots from CLUSTER SLOTS in the background, unless a refresh is already running.
+// Nodes that do not run in cluster mode reply with an error and the map is left as is.
+func (self *Client) refreshSlots() {
+	if !self.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer self.refreshing.Store(false)
+
+		for _, address := range self.addresses() {
+			replies, err := self.roundTrip(context.Background(), address, [][][]byte{{[]byte("CLUSTER"), []byte("SLOTS")}})
+			if err != nil {
+				continue
+			}
+			if replies[0].kind != replyArray {
+				return
+			}
+
+			for _, slotRange := range replies[0].elements {
+				slots, address, ok := parseSlotRange(slotRange)
+				if ok {
+					self.slots.set(slots, address)
+				}
+			}
+			return
+		}
+	}()
+}
+
+// parseSlotRange of a CLUSTER SLOTS reply: [begin, end, [host, port, ...], replicas...].
+func parseSlotRange(value reply) (hash.Range, string, bool) {
+	if value.kind != replyArray || len(value.elements) < 3 { //nolint:mnd // reason: begin, end and primary
+		return hash.Range{}, "", false //nolint:exhaustruct // reason: zero value on error
+	}
+
+	begin, end, primary := value.elements[0], value.elements[1], value.elements[2]
+	if begin.kind != replyInteger || end.kind != replyInteger || primary.kind != replyArray || len(primary.elements) < 2 {
+		return hash.Range{}, "", false //nolint:exhaustruct // reason: zero value on error
+	}
+
+	host, port := primary.elements[0], primary.elements[1]
+	if port.kind != replyInteger {
+		return hash.Range{}, "", false //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return hash.Range{
+		Begin: hash.Slot(begin.integer),
+		End:   hash.Slot(end.integer),
+	}, net.JoinHostPort(string(host.bulk), strconv.FormatInt(port.integer, 10)), true
+}
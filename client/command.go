@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+func command(args ...string) [][]byte {
+	command := make([][]byte, len(args))
+	for index, arg := range args {
+		command[index] = []byte(arg)
+	}
+	return command
+}
+
+// milliseconds of a ttl, rounded up so that a ttl shorter than a millisecond does not become 0.
+func milliseconds(ttl time.Duration) string {
+	return strconv.FormatInt(int64((ttl+time.Millisecond-1)/time.Millisecond), 10)
+}
+
+// setCommand that replies with the previous value, if get is set.
+func setCommand(key string, value []byte, ttl time.Duration, get bool) [][]byte {
+	args := [][]byte{[]byte("SET"), []byte(key), value}
+	if ttl != 0 {
+		args = append(args, []byte("PX"), []byte(milliseconds(ttl)))
+	}
+	if get {
+		args = append(args, []byte("GET"))
+	}
+	return args
+}
+
+func expireCommand(key string, ttl time.Duration) [][]byte {
+	if ttl <= 0 {
+		return command("DEL", key)
+	}
+	return command("PEXPIRE", key, milliseconds(ttl))
+}
+
+func (self *Client) setResult(ctx context.Context, key string, value []byte, ttl time.Duration, replies []reply, err *errors.Error[requestErr]) (datkey.SetResponse, *errors.Error[datkey.DbWriteErr]) {
+	// The key is invalidated as soon as it is written, rather than once the node sends an invalidation message, so
+	// that the client reads its own writes. The same goes for every command that changes a key.
+	self.nearCache.invalidate(key)
+	if err == nil {
+		err = replyErr(replies[0])
+	}
+	if err != nil && err.Cause == requestErrWrongType {
+		// The previous value is not a string, so it cannot be replied. Like the embedded database, it is replaced.
+		replies, err = self.do(ctx, key, setCommand(key, value, ttl, false))
+		if err == nil {
+			err = replyErr(replies[0])
+		}
+		if err != nil {
+			return datkey.SetResponse{}, writeErr(err) //nolint:exhaustruct // reason: zero value on error
+		}
+		return datkey.SetResponse{
+			PreviousValue: nil,
+			Exists:        true,
+		}, nil
+	}
+	if err != nil {
+		return datkey.SetResponse{}, writeErr(err) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return datkey.SetResponse{
+		PreviousValue: replies[0].bulk,
+		Exists:        replies[0].kind == replyBulk,
+	}, nil
+}
+
+func (self *Client) deleteResult(ctx context.Context, key string, replies []reply, err *errors.Error[requestErr]) (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+	self.nearCache.invalidate(key)
+	if err == nil {
+		err = replyErr(replies[0])
+	}
+	if err != nil && err.Cause == requestErrWrongType {
+		// The value is not a string, so it cannot be replied, but the key is still deleted.
+		replies, err = self.do(ctx, key, command("DEL", key))
+		if err == nil {
+			err = replyErr(replies[0])
+		}
+		if err != nil {
+			return datkey.DeleteResponse{}, writeErr(err) //nolint:exhaustruct // reason: zero value on error
+		}
+		return datkey.DeleteResponse{
+			DeletedValue: nil,
+			Exists:       replies[0].integer > 0,
+		}, nil
+	}
+	if err != nil {
+		return datkey.DeleteResponse{}, writeErr(err) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return datkey.DeleteResponse{
+		DeletedValue: replies[0].bulk,
+		Exists:       replies[0].kind == replyBulk,
+	}, nil
+}
+
+func getResult(replies []reply, err *errors.Error[requestErr]) (datkey.GetResponse, *errors.Error[datkey.DbReadErr]) {
+	if err == nil {
+		err = replyErr(replies[0])
+	}
+	if err != nil {
+		return datkey.GetResponse{}, readErr(err) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return datkey.GetResponse{
+		Value:  replies[0].bulk,
+		Exists: replies[0].kind == replyBulk,
+	}, nil
+}
+
+func expireResult(replies []reply, err *errors.Error[requestErr]) (datkey.ExpireResponse, *errors.Error[datkey.DbWriteErr]) {
+	if err == nil {
+		err = replyErr(replies[0])
+	}
+	if err != nil {
+		return datkey.ExpireResponse{}, writeErr(err) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return datkey.ExpireResponse{
+		Exists: replies[0].integer > 0,
+	}, nil
+}
+
+// persistResult of EXISTS followed by PERSIST, since PERSIST does not tell a key without a ttl from a missing key.
+func persistResult(replies []reply, err *errors.Error[requestErr]) (datkey.PersistResponse, *errors.Error[datkey.DbWriteErr]) {
+	if err == nil {
+		err = replyErr(firstError(replies))
+	}
+	if err != nil {
+		return datkey.PersistResponse{}, writeErr(err) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return datkey.PersistResponse{
+		Exists:    replies[0].integer > 0,
+		Persisted: replies[1].integer > 0,
+	}, nil
+}
+
+func ttlResult(replies []reply, err *errors.Error[requestErr]) (datkey.TtlResponse, *errors.Error[datkey.DbReadErr]) {
+	if err == nil {
+		err = replyErr(replies[0])
+	}
+	if err != nil {
+		return datkey.TtlResponse{}, readErr(err) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	switch milliseconds := replies[0].integer; {
+	case milliseconds == -2: //nolint:mnd // reason: key does not exist
+		return datkey.TtlResponse{
+			Ttl:    0,
+			Exists: false,
+		}, nil
+	case milliseconds < 0:
+		return datkey.TtlResponse{
+			Ttl:    0,
+			Exists: true,
+		}, nil
+	default:
+		return datkey.TtlResponse{
+			Ttl:    time.Duration(milliseconds) * time.Millisecond,
+			Exists: true,
+		}, nil
+	}
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// conn to a single node.
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	// trackingID of the tracker that is sent the invalidation messages of the keys read on the connection, or 0 if
+	// they are not tracked.
+	trackingID int64
+}
+
+// dial a node, authenticating if the config has a password.
+func dial(ctx context.Context, address string, config Config) (*conn, *errors.Error[requestErr]) {
+	dialer := &net.Dialer{ //nolint:exhaustruct // reason: defaults for every other setting
+		Timeout: config.DialTimeout,
+	}
+
+	var netConn net.Conn
+	var err error
+	if config.TLSConfig != nil {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    config.TLSConfig,
+		}
+		netConn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, errors.NewFromError(requestErrConnection, err)
+	}
+
+	connection := &conn{
+		netConn:    netConn,
+		reader:     bufio.NewReader(netConn),
+		writer:     bufio.NewWriter(netConn),
+		trackingID: 0,
+	}
+
+	if config.Password != "" {
+		args := [][]byte{[]byte("AUTH"), []byte(config.Password)}
+		if config.Username != "" {
+			args = [][]byte{[]byte("AUTH"), []byte(config.Username), []byte(config.Password)}
+		}
+
+		replies, err := connection.roundTrip(ctx, [][][]byte{args}, config.CommandTimeout)
+		if err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+		if replies[0].kind == replyError {
+			_ = netConn.Close()
+			return nil, errors.New(requestErrAuth, "authenticate with %s: %s", address, replies[0].bulk)
+		}
+	}
+
+	return connection, nil
+}
+
+// roundTrip the commands in a single write, reading a reply for each, within the timeout or until the context is done.
+// The connection cannot be used after an error.
+func (self *conn) roundTrip(ctx context.Context, commands [][][]byte, timeout time.Duration) ([]reply, *errors.Error[requestErr]) {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, hasDeadline := ctx.Deadline(); hasDeadline && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := self.netConn.SetDeadline(deadline); err != nil {
+		return nil, errors.NewFromError(requestErrConnection, err)
+	}
+
+	// Interrupt reads and writes in progress once the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = self.netConn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	for _, args := range commands {
+		if err := writeCommand(self.writer, args); err != nil {
+			return nil, connectionErr(err)
+		}
+	}
+	if err := self.writer.Flush(); err != nil {
+		return nil, connectionErr(err)
+	}
+
+	replies := make([]reply, len(commands))
+	for index := range replies {
+		reply, err := readReply(self.reader)
+		if err != nil {
+			return nil, err
+		}
+		replies[index] = reply
+	}
+	return replies, nil
+}
+
+func (self *conn) close() {
+	_ = self.netConn.Close()
+}
+
+// connectionErr for an error writing to or reading from a connection.
+func connectionErr(err error) *errors.Error[requestErr] {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errors.NewFromError(requestErrTimeout, err)
+	}
+	return errors.NewFromError(requestErrConnection, err)
+}
+
+// pool of connections to a single node.
+type pool struct {
+	address string
+	config  Config
+	// idle connections ready to be used.
+	idle chan *conn
+	// open connections, idle or in use, limited to the pool size.
+	open   chan struct{}
+	closed bool
+	mutex  sync.Mutex
+}
+
+func newPool(address string, config Config) *pool {
+	return &pool{
+		address: address,
+		config:  config,
+		idle:    make(chan *conn, config.PoolSize),
+		open:    make(chan struct{}, config.PoolSize),
+		closed:  false,
+		mutex:   sync.Mutex{},
+	}
+}
+
+// get an idle connection, dialing a new one if the pool is not full, or waiting up to PoolTimeout for one to be put back.
+func (self *pool) get(ctx context.Context) (*conn, *errors.Error[requestErr]) {
+	self.mutex.Lock()
+	closed := self.closed
+	self.mutex.Unlock()
+	if closed {
+		return nil, errors.New(requestErrClosed, "client closed")
+	}
+
+	select {
+	case connection := <-self.idle:
+		return connection, nil
+	default:
+	}
+
+	timeout := time.NewTimer(self.config.PoolTimeout)
+	defer timeout.Stop()
+
+	select {
+	case connection := <-self.idle:
+		return connection, nil
+	case self.open <- struct{}{}:
+		connection, err := dial(ctx, self.address, self.config)
+		if err != nil {
+			<-self.open
+			return nil, err
+		}
+		return connection, nil
+	case <-timeout.C:
+		return nil, errors.New(requestErrTimeout, "no connection to %s available within %s", self.address, self.config.PoolTimeout)
+	case <-ctx.Done():
+		return nil, errors.NewFromError(requestErrTimeout, ctx.Err())
+	}
+}
+
+// put a connection back in the pool. Connections that failed are closed, making room for a new one.
+func (self *pool) put(connection *conn, failed bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if failed || self.closed {
+		connection.close()
+		<-self.open
+		return
+	}
+	self.idle <- connection
+}
+
+// close idle connections. Connections in use are closed when they are put back.
+func (self *pool) close() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.closed = true
+	for {
+		select {
+		case connection := <-self.idle:
+			connection.close()
+			<-self.open
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey"
+)
+
+// invalidateChannel that the nodes send the invalidation messages of the keys read by the client to.
+const invalidateChannel = "__redis__:invalidate"
+
+// nearCache of the values read by Get, which are invalidated by the messages of the nodes once they change.
+// A nil cache caches nothing.
+type nearCache struct {
+	size int
+	// prefixes of the keys cached, which the nodes broadcast invalidation messages for. Empty to cache every key.
+	prefixes []string
+	mutex    sync.Mutex
+	entries  map[string]*nearCacheEntry
+}
+
+// nearCacheEntry of a key, which is pending until the value read is stored.
+type nearCacheEntry struct {
+	pending bool
+	value   datkey.GetResponse
+}
+
+func newNearCache(config Config) *nearCache {
+	if config.NearCacheSize == 0 {
+		return nil
+	}
+	return &nearCache{
+		size:     config.NearCacheSize,
+		prefixes: config.NearCachePrefixes,
+		mutex:    sync.Mutex{},
+		entries:  map[string]*nearCacheEntry{},
+	}
+}
+
+// get the cached value of the key, or else the pending entry to store the value read in once the node replies.
+// The entry is nil if the key is not cached.
+func (self *nearCache) get(key string) (datkey.GetResponse, *nearCacheEntry, bool) {
+	if self == nil || !hasAnyPrefix(key, self.prefixes) {
+		return datkey.GetResponse{}, nil, false //nolint:exhaustruct // reason: not cached
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	entry, exists := self.entries[key]
+	if exists && !entry.pending {
+		return datkey.GetResponse{
+			Value:  bytes.Clone(entry.value.Value),
+			Exists: entry.value.Exists,
+		}, nil, true
+	}
+	if !exists {
+		if len(self.entries) >= self.size {
+			// Evict any entry to make room, which is as good as any other without tracking how often each is read.
+			for evicted := range self.entries {
+				delete(self.entries, evicted)
+				break
+			}
+		}
+		// Reads of the key are pending until one of them stores its value, and the entry is removed if the key is
+		// invalidated meanwhile, so that a value read before a change is never stored after it.
+		entry = &nearCacheEntry{
+			pending: true,
+			value:   datkey.GetResponse{}, //nolint:exhaustruct // reason: set once stored
+		}
+		self.entries[key] = entry
+	}
+	return datkey.GetResponse{}, entry, false //nolint:exhaustruct // reason: not cached
+}
+
+// store the value read into the pending entry, unless the key was invalidated since the entry was created.
+func (self *nearCache) store(key string, entry *nearCacheEntry, value datkey.GetResponse) {
+	if self == nil || entry == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.entries[key] != entry || !entry.pending {
+		return
+	}
+	entry.pending = false
+	entry.value = datkey.GetResponse{
+		Value:  bytes.Clone(value.Value),
+		Exists: value.Exists,
+	}
+}
+
+// abandon the pending entry of a read that failed.
+func (self *nearCache) abandon(key string, entry *nearCacheEntry) {
+	if self == nil || entry == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.entries[key] == entry && entry.pending {
+		delete(self.entries, key)
+	}
+}
+
+// invalidate the key, including any pending reads of it.
+func (self *nearCache) invalidate(key string) {
+	if self == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	delete(self.entries, key)
+}
+
+// flush every key, including pending reads, for when invalidation messages may have been missed.
+func (self *nearCache) flush() {
+	if self == nil {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	clear(self.entries)
+}
+
+// trackingCommand enabling tracking of the keys read on a connection, redirecting the invalidation messages to the
+// tracker. Only keys with a prefix are tracked if there are any, but without the node remembering the keys read.
+func (self *nearCache) trackingCommand(trackerID int64) [][]byte {
+	args := command("CLIENT", "TRACKING", "ON", "REDIRECT", strconv.FormatInt(trackerID, 10))
+	if self.broadcasts() {
+		args = append(args, []byte("BCAST"))
+		for _, prefix := range self.prefixes {
+			args = append(args, []byte("PREFIX"), []byte(prefix))
+		}
+	}
+	return args
+}
+
+// broadcasts if the nodes broadcast the invalidation messages of the prefixes cached, which is enabled once per node
+// by its tracker rather than on every connection.
+func (self *nearCache) broadcasts() bool {
+	return len(self.prefixes) != 0
+}
+
+// tracking command to send before the commands on the connection so that the keys they read are tracked, or nil if
+// they already are or nothing is cached. Returns the id of the tracker to set on the connection once it succeeds.
+func (self *Client) tracking(ctx context.Context, address string, connection *conn) (int64, [][]byte) {
+	if self.nearCache == nil {
+		return 0, nil
+	}
+
+	trackerID, isTracking := self.tracker(ctx, address)
+	if !isTracking {
+		// Keys read from the node would never be invalidated, so reads in progress must not be cached.
+		self.nearCache.flush()
+		return 0, nil
+	}
+	if self.nearCache.broadcasts() || connection.trackingID == trackerID {
+		return 0, nil
+	}
+	return trackerID, self.nearCache.trackingCommand(trackerID)
+}
+
+// hasAnyPrefix if the key starts with any of the prefixes, or there are none.
+func hasAnyPrefix(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tracker of a node, which is a connection subscribed to the invalidation messages of the keys read on the other
+// connections to the node.
+type tracker struct {
+	id         int64
+	connection *conn
+}
+
+// tracker of the node, dialing one if there is none. Returns false if the node cannot be reached, or does not support
+// tracking.
+func (self *Client) tracker(ctx context.Context, address string) (int64, bool) {
+	self.trackersMutex.Lock()
+	nodeTracker, exists := self.trackers[address]
+	closed := self.trackersClosed
+	self.trackersMutex.Unlock()
+	if exists {
+		return nodeTracker.id, true
+	}
+	if closed {
+		return 0, false
+	}
+
+	// The tracker is dialed without holding the mutex, so that an unreachable node does not delay the others.
+	nodeTracker = self.dialTracker(ctx, address)
+	if nodeTracker == nil {
+		return 0, false
+	}
+
+	self.trackersMutex.Lock()
+	defer self.trackersMutex.Unlock()
+
+	if existing, exists := self.trackers[address]; exists || self.trackersClosed {
+		// Another request dialed a tracker of the node meanwhile, or the client was closed.
+		nodeTracker.connection.close()
+		if exists {
+			return existing.id, true
+		}
+		return 0, false
+	}
+	self.trackers[address] = nodeTracker
+	go self.readInvalidations(address, nodeTracker)
+	return nodeTracker.id, true
+}
+
+// dialTracker of the node, subscribed to the invalidation messages. When broadcasting, the tracker enables tracking
+// of the prefixes itself, so that each invalidation message is sent once per node rather than once per connection.
+// Returns nil if the node cannot be reached, or does not support tracking.
+func (self *Client) dialTracker(ctx context.Context, address string) *tracker {
+	connection, err := dial(ctx, address, self.config)
+	if err != nil {
+		return nil
+	}
+	replies, err := connection.roundTrip(ctx, [][][]byte{command("CLIENT", "ID")}, self.config.CommandTimeout)
+	if err != nil || replies[0].kind != replyInteger {
+		connection.close()
+		return nil
+	}
+	trackerID := replies[0].integer
+
+	var commands [][][]byte
+	if self.nearCache.broadcasts() {
+		commands = append(commands, self.nearCache.trackingCommand(trackerID))
+	}
+	commands = append(commands, command("SUBSCRIBE", invalidateChannel))
+	replies, err = connection.roundTrip(ctx, commands, self.config.CommandTimeout)
+	if err != nil || replies[0].kind == replyError || replies[len(replies)-1].kind != replyArray {
+		connection.close()
+		return nil
+	}
+	// Invalidation messages are waited for indefinitely.
+	_ = connection.netConn.SetDeadline(time.Time{})
+
+	return &tracker{
+		id:         trackerID,
+		connection: connection,
+	}
+}
+
+// readInvalidations of the tracker until its connection is closed, invalidating the keys in the near cache.
+func (self *Client) readInvalidations(address string, nodeTracker *tracker) {
+	for {
+		message, err := readReply(nodeTracker.connection.reader)
+		if err != nil {
+			break
+		}
+		if message.kind != replyArray || len(message.elements) != 3 || string(message.elements[0].bulk) != "message" { //nolint:mnd // reason: kind, channel and keys
+			continue
+		}
+
+		keys := message.elements[2]
+		if keys.kind != replyArray {
+			// The node lost track of the keys read, so any of them may have changed.
+			self.nearCache.flush()
+			continue
+		}
+		for _, key := range keys.elements {
+			self.nearCache.invalidate(string(key.bulk))
+		}
+	}
+
+	// The tracker is replaced before flushing, so that keys read once flushed are tracked by the new tracker.
+	self.trackersMutex.Lock()
+	if self.trackers[address] == nodeTracker {
+		delete(self.trackers, address)
+	}
+	self.trackersMutex.Unlock()
+	nodeTracker.connection.close()
+
+	// Invalidation messages may have been missed, so nothing cached can be trusted.
+	self.nearCache.flush()
+}
+
+// closeTrackers of every node, after which no more are dialed.
+func (self *Client) closeTrackers() {
+	self.trackersMutex.Lock()
+	defer self.trackersMutex.Unlock()
+
+	self.trackersClosed = true
+	for _, nodeTracker := range self.trackers {
+		nodeTracker.connection.close()
+	}
+}
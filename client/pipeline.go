@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Pipeline of commands that are sent together by Exec, in a single round trip to each node.
+//
+//	pipeline := client.Pipeline()
+//	get := pipeline.Get("user:1")
+//	pipeline.Expire("user:1", time.Minute)
+//	pipeline.Exec(ctx)
+//	result, err := get.Result()
+type Pipeline struct {
+	client   *Client
+	requests []*pipelineRequest
+}
+
+// pipelineRequest of the commands of one pipelined call, which are sent to the node serving the key.
+type pipelineRequest struct {
+	key      string
+	commands [][][]byte
+	replies  []reply
+	err      *errors.Error[requestErr]
+	// result of the replies, set on the Result of the call.
+	result func(ctx context.Context, replies []reply, err *errors.Error[requestErr])
+}
+
+// Result of a pipelined command, which is the zero value until the pipeline is executed.
+type Result[T any, E errors.Causer] struct {
+	value T
+	err   *errors.Error[E]
+}
+
+// Result of the command, as returned by the Client method of the same name.
+func (self *Result[T, E]) Result() (T, *errors.Error[E]) {
+	return self.value, self.err
+}
+
+// Pipeline commands to send together.
+func (self *Client) Pipeline() *Pipeline {
+	return &Pipeline{
+		client:   self,
+		requests: nil,
+	}
+}
+
+// Set a key. See Client.Set.
+func (self *Pipeline) Set(key string, value []byte, ttl time.Duration) *Result[datkey.SetResponse, datkey.DbWriteErr] {
+	result := &Result[datkey.SetResponse, datkey.DbWriteErr]{} //nolint:exhaustruct // reason: set by Exec
+	if ttl < 0 {
+		result.err = errors.New(datkey.DbWriteInvalidArgument, "ttl must not be negative: %s", ttl)
+		return result
+	}
+
+	self.add(key, func(ctx context.Context, replies []reply, err *errors.Error[requestErr]) {
+		result.value, result.err = self.client.setResult(ctx, key, value, ttl, replies, err)
+	}, setCommand(key, value, ttl, true))
+	return result
+}
+
+// Delete a key. See Client.Delete.
+func (self *Pipeline) Delete(key string) *Result[datkey.DeleteResponse, datkey.DbWriteErr] {
+	result := &Result[datkey.DeleteResponse, datkey.DbWriteErr]{} //nolint:exhaustruct // reason: set by Exec
+	self.add(key, func(ctx context.Context, replies []reply, err *errors.Error[requestErr]) {
+		result.value, result.err = self.client.deleteResult(ctx, key, replies, err)
+	}, command("GETDEL", key))
+	return result
+}
+
+// Get a key. See Client.Get.
+func (self *Pipeline) Get(key string) *Result[datkey.GetResponse, datkey.DbReadErr] {
+	result := &Result[datkey.GetResponse, datkey.DbReadErr]{} //nolint:exhaustruct // reason: set by Exec
+	self.add(key, func(_ context.Context, replies []reply, err *errors.Error[requestErr]) {
+		result.value, result.err = getResult(replies, err)
+	}, command("GET", key))
+	return result
+}
+
+// Expire a key in a given TTL. See Client.Expire.
+func (self *Pipeline) Expire(key string, ttl time.Duration) *Result[datkey.ExpireResponse, datkey.DbWriteErr] {
+	result := &Result[datkey.ExpireResponse, datkey.DbWriteErr]{} //nolint:exhaustruct // reason: set by Exec
+	self.add(key, func(_ context.Context, replies []reply, err *errors.Error[requestErr]) {
+		self.client.nearCache.invalidate(key)
+		result.value, result.err = expireResult(replies, err)
+	}, expireCommand(key, ttl))
+	return result
+}
+
+// Persist a key. See Client.Persist.
+func (self *Pipeline) Persist(key string) *Result[datkey.PersistResponse, datkey.DbWriteErr] {
+	result := &Result[datkey.PersistResponse, datkey.DbWriteErr]{} //nolint:exhaustruct // reason: set by Exec
+	self.add(key, func(_ context.Context, replies []reply, err *errors.Error[requestErr]) {
+		self.client.nearCache.invalidate(key)
+		result.value, result.err = persistResult(replies, err)
+	}, command("EXISTS", key), command("PERSIST", key))
+	return result
+}
+
+// Ttl of a key. See Client.Ttl.
+func (self *Pipeline) Ttl(key string) *Result[datkey.TtlResponse, datkey.DbReadErr] {
+	result := &Result[datkey.TtlResponse, datkey.DbReadErr]{} //nolint:exhaustruct // reason: set by Exec
+	self.add(key, func(_ context.Context, replies []reply, err *errors.Error[requestErr]) {
+		result.value, result.err = ttlResult(replies, err)
+	}, command("PTTL", key))
+	return result
+}
+
+func (self *Pipeline) add(key string, result func(ctx context.Context, replies []reply, err *errors.Error[requestErr]), commands ...[][]byte) {
+	self.requests = append(self.requests, &pipelineRequest{
+		key:      key,
+		commands: commands,
+		replies:  nil,
+		err:      nil,
+		result:   result,
+	})
+}
+
+// Exec the pipelined commands, sending the commands for each node in a single round trip to the nodes concurrently.
+// Commands that are redirected or fail to reach their node are sent again on their own, as by the Client methods.
+// The pipeline is empty afterwards and can be reused.
+func (self *Pipeline) Exec(ctx context.Context) {
+	requests := self.requests
+	self.requests = nil
+
+	nodes := map[string][]*pipelineRequest{}
+	for _, request := range requests {
+		address := self.client.node(request.key)
+		if address == "" {
+			request.err = errors.New(requestErrNoNode, "no node serves key %s", request.key)
+			continue
+		}
+		nodes[address] = append(nodes[address], request)
+	}
+
+	var wait sync.WaitGroup
+	for address, nodeRequests := range nodes {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			self.client.roundTripRequests(ctx, address, nodeRequests)
+		}()
+	}
+	wait.Wait()
+
+	for _, request := range requests {
+		_, isRedirect := firstRedirect(request.replies)
+		if (request.err != nil && request.err.Cause == requestErrConnection) || isRedirect || retryableReply(request.replies) {
+			request.replies, request.err = self.client.do(ctx, request.key, request.commands...)
+		}
+		request.result(ctx, request.replies, request.err)
+	}
+}
+
+// roundTripRequests to a node in a single round trip, setting the replies of each request.
+func (self *Client) roundTripRequests(ctx context.Context, address string, requests []*pipelineRequest) {
+	var commands [][][]byte
+	for _, request := range requests {
+		commands = append(commands, request.commands...)
+	}
+
+	replies, err := self.roundTrip(ctx, address, commands)
+	for _, request := range requests {
+		if err != nil {
+			request.err = err
+			continue
+		}
+		request.replies, replies = replies[:len(request.commands)], replies[len(request.commands):]
+	}
+}
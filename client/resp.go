@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type replyKind int
+
+const (
+	replySimpleString replyKind = iota + 1
+	replyError
+	replyInteger
+	replyBulk
+	replyNull
+	replyArray
+)
+
+// reply read from a server. Simple strings and errors are held in bulk.
+type reply struct {
+	kind     replyKind
+	bulk     []byte
+	integer  int64
+	elements []reply
+}
+
+// errorPrefix of an error reply, such as "WRONGTYPE" or "MOVED".
+func (self reply) errorPrefix() string {
+	prefix, _, _ := strings.Cut(string(self.bulk), " ")
+	return prefix
+}
+
+func writeCommand(writer *bufio.Writer, args [][]byte) error {
+	if _, err := fmt.Fprintf(writer, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(writer, "$%d\r\n", len(arg)); err != nil {
+			return err
+		}
+		if _, err := writer.Write(arg); err != nil {
+			return err
+		}
+		if _, err := writer.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply of the RESP2 protocol. The RESP3 null is also accepted.
+func readReply(reader *bufio.Reader) (reply, *errors.Error[requestErr]) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return reply{}, errors.NewFromError(requestErrConnection, err) //nolint:exhaustruct // reason: zero value on error
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return reply{}, errors.New(requestErrProtocol, "empty reply") //nolint:exhaustruct // reason: zero value on error
+	}
+
+	prefix, text := line[0], line[1:]
+	switch prefix {
+	case '+':
+		return reply{kind: replySimpleString, bulk: []byte(text), integer: 0, elements: nil}, nil
+	case '-':
+		return reply{kind: replyError, bulk: []byte(text), integer: 0, elements: nil}, nil
+	case ':':
+		integer, parseErr := strconv.ParseInt(text, 10, 64)
+		if parseErr != nil {
+			return reply{}, errors.New(requestErrProtocol, "invalid integer reply: %q", text) //nolint:exhaustruct // reason: zero value on error
+		}
+		return reply{kind: replyInteger, bulk: nil, integer: integer, elements: nil}, nil
+	case '_':
+		return reply{kind: replyNull, bulk: nil, integer: 0, elements: nil}, nil
+	case '$':
+		length, parseErr := strconv.Atoi(text)
+		if parseErr != nil {
+			return reply{}, errors.New(requestErrProtocol, "invalid bulk length: %q", text) //nolint:exhaustruct // reason: zero value on error
+		}
+		if length < 0 {
+			return reply{kind: replyNull, bulk: nil, integer: 0, elements: nil}, nil
+		}
+		bulk := make([]byte, length+2) //nolint:mnd // reason: size of the trailing \r\n
+		if _, err := io.ReadFull(reader, bulk); err != nil {
+			return reply{}, errors.NewFromError(requestErrConnection, err) //nolint:exhaustruct // reason: zero value on error
+		}
+		return reply{kind: replyBulk, bulk: bulk[:length], integer: 0, elements: nil}, nil
+	case '*':
+		length, parseErr := strconv.Atoi(text)
+		if parseErr != nil {
+			return reply{}, errors.New(requestErrProtocol, "invalid array length: %q", text) //nolint:exhaustruct // reason: zero value on error
+		}
+		if length < 0 {
+			return reply{kind: replyNull, bulk: nil, integer: 0, elements: nil}, nil
+		}
+		elements := make([]reply, length)
+		for index := range elements {
+			element, err := readReply(reader)
+			if err != nil {
+				return reply{}, err //nolint:exhaustruct // reason: zero value on error
+			}
+			elements[index] = element
+		}
+		return reply{kind: replyArray, bulk: nil, integer: 0, elements: elements}, nil
+	default:
+		return reply{}, errors.New(requestErrProtocol, "unexpected reply type: %q", prefix) //nolint:exhaustruct // reason: zero value on error
+	}
+}
@@ -0,0 +1,140 @@
+package datkey
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Redirect of a command to the node that serves its slot. Errors with the DbReadRedirect and DbWriteRedirect causes
+// are created from a *Redirect, which is found with errors.As.
+type Redirect struct {
+	// Node that serves the slot, as given to SetSlotsOwner, SetSlotsMigrating or SetSlotsImporting.
+	Node string
+	Slot hash.Slot
+	// Ask is set if the slot is migrating to the node and the key may already be there. Only this command is sent to
+	// the node, with an Asking context, and later commands for the slot are still sent to this node.
+	Ask bool
+}
+
+func (self *Redirect) Error() string {
+	if self.Ask {
+		return fmt.Sprintf("slot %d is migrating to %s", self.Slot, self.Node)
+	}
+	return fmt.Sprintf("slot %d is served by %s", self.Slot, self.Node)
+}
+
+func (self *Redirect) readErr() *errors.Error[DbReadErr] {
+	return errors.NewFromError(DbReadRedirect, self)
+}
+
+func (self *Redirect) writeErr() *errors.Error[DbWriteErr] {
+	return errors.NewFromError(DbWriteRedirect, self)
+}
+
+type askingKey struct{}
+
+// Asking marks the commands run with the context as sent after an ASK redirect, which a node importing the slot serves.
+func Asking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, askingKey{}, true)
+}
+
+func isAsking(ctx context.Context) bool {
+	asking, _ := ctx.Value(askingKey{}).(bool)
+	return asking
+}
+
+// SlotOwner of a range of slots.
+type SlotOwner struct {
+	Slots hash.Range
+	// Node that owns the slots. Empty if this node owns the slots.
+	Node string
+}
+
+type commandSetSlotOwner struct {
+	Resp empty
+	Node string
+}
+
+// SetSlotsOwner to the node that serves them, such as "10.0.0.2:6379". Commands for slots owned by another node are
+// redirected to it with a MOVED redirect. An empty node gives the slots to this node, which owns every slot by
+// default. The slots are marked as stable, which completes a migration.
+func (self *Datkey) SetSlotsOwner(slots hash.Range, node string) {
+	for hashSlot := slots.Begin; hashSlot <= slots.End && hashSlot < self.cache.slotCount(); hashSlot++ {
+		self.cache.runCommand(hashSlot, commandSetSlotOwner{
+			Resp: empty{},
+			Node: node,
+		})
+	}
+}
+
+// SlotOwners of every slot, in order of the slots, with adjacent slots of the same owner in a single range.
+func (self *Datkey) SlotOwners() []SlotOwner {
+	var owners []SlotOwner
+	for hashSlot := range self.cache.slotCount() {
+		resp := &SlotStateResponse{
+			State: SlotStable,
+			Node:  "",
+			Owner: "",
+		}
+		self.cache.runCommand(hashSlot, commandSlotState{
+			Resp: resp,
+		})
+
+		if len(owners) != 0 && owners[len(owners)-1].Node == resp.Owner {
+			owners[len(owners)-1].Slots.End = hashSlot
+			continue
+		}
+		owners = append(owners, SlotOwner{
+			Slots: hash.Range{Begin: hashSlot, End: hashSlot},
+			Node:  resp.Owner,
+		})
+	}
+	return owners
+}
+
+// KeySlot of a key, as partitioned by the Partitioner of the config.
+func (self *Datkey) KeySlot(key string) hash.Slot {
+	return self.cache.slotOf(key)
+}
+
+// SlotStats of the keys stored in a slot.
+type SlotStats struct {
+	Slot hash.Slot
+	// Keys in the slot, including expired keys that have not been deleted yet.
+	Keys        int64
+	SizeInBytes int64
+}
+
+// SlotStats of every slot in a range that stores at least one key, in order of the slots.
+func (self *Datkey) SlotStats(slots hash.Range) []SlotStats {
+	var stats []SlotStats
+	for hashSlot := slots.Begin; hashSlot <= slots.End && hashSlot < self.cache.slotCount(); hashSlot++ {
+		resp := &statsResponse{
+			sizeInBytes: 0,
+			keys:        0,
+		}
+		self.cache.runCommand(hashSlot, commandStats{
+			Resp: resp,
+		})
+
+		if resp.keys != 0 {
+			stats = append(stats, SlotStats{
+				Slot:        hashSlot,
+				Keys:        resp.keys,
+				SizeInBytes: resp.sizeInBytes,
+			})
+		}
+	}
+	return stats
+}
+
+func (self *slotStorage) handleCommandSetSlotOwner(cmd commandSetSlotOwner) {
+	self.migration = slotMigration{
+		state: SlotStable,
+		node:  "",
+		owner: cmd.Node,
+	}
+}
@@ -0,0 +1,253 @@
+package datkey_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+func requireRedirect(t *testing.T, err error, expected datkey.Redirect) {
+	t.Helper()
+
+	var redirect *datkey.Redirect
+	require.ErrorAs(t, err, &redirect)
+	assert.Equal(t, expected, *redirect)
+}
+
+func TestDatkey_SetSlotsOwner(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	db := datkey.New(config)
+	defer db.Close()
+
+	_, err := db.Set(ctx, "{a}key", []byte("value"), 0)
+	require.Nil(t, err)
+
+	slot := hash.ToSlot("{a}")
+	require.NotEqual(t, slot, hash.ToSlot("{b}"))
+	slots := hash.Range{Begin: slot, End: slot}
+	db.SetSlotsOwner(slots, "other:6379")
+	assert.Equal(t, datkey.SlotStateResponse{State: datkey.SlotStable, Node: "", Owner: "other:6379"}, db.SlotState(slot))
+
+	moved := datkey.Redirect{Node: "other:6379", Slot: slot, Ask: false}
+	{
+		_, err := db.Get(ctx, "{a}key")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadRedirect, err.Cause)
+		requireRedirect(t, err, moved)
+	}
+	{
+		_, err := db.Set(ctx, "{a}key", []byte("value"), 0)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteRedirect, err.Cause)
+		requireRedirect(t, err, moved)
+	}
+	{
+		// Commands across keys are redirected if any of the keys is.
+		err := db.PFMerge(ctx, "{b}dest", "{a}key")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteRedirect, err.Cause)
+		requireRedirect(t, err, moved)
+	}
+	{
+		// Asking does not serve slots that are not being imported.
+		_, err := db.Get(datkey.Asking(ctx), "{a}key")
+		require.NotNil(t, err)
+		requireRedirect(t, err, moved)
+	}
+	{
+		_, err := db.Set(ctx, "{b}key", []byte("value"), 0)
+		require.Nil(t, err)
+	}
+
+	owners := db.SlotOwners()
+	require.Len(t, owners, 3)
+	assert.Equal(t, datkey.SlotOwner{Slots: hash.Range{Begin: 0, End: slot - 1}, Node: ""}, owners[0])
+	assert.Equal(t, datkey.SlotOwner{Slots: slots, Node: "other:6379"}, owners[1])
+	assert.Equal(t, datkey.SlotOwner{Slots: hash.Range{Begin: slot + 1, End: hash.MaxHashSlot - 1}, Node: ""}, owners[2])
+
+	db.SetSlotsOwner(slots, "")
+	assert.Equal(t, []datkey.SlotOwner{{Slots: hash.Range{Begin: 0, End: hash.MaxHashSlot - 1}, Node: ""}}, db.SlotOwners())
+	{
+		result, err := db.Get(ctx, "{a}key")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("value"), result.Value)
+	}
+}
+
+func TestDatkey_SetSlotsMigrating_ask(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	source := datkey.New(config)
+	defer source.Close()
+	target := datkey.New(config)
+	defer target.Close()
+
+	_, err := source.Set(ctx, "{a}kept", []byte("value"), 0)
+	require.Nil(t, err)
+	_, zaddErr := source.ZAdd(ctx, "{a}zset", datkey.ZMember{Member: "a", Score: 1})
+	require.Nil(t, zaddErr)
+
+	slot := hash.ToSlot("{a}")
+	slots := hash.Range{Begin: slot, End: slot}
+	source.SetSlotsMigrating(slots, "target:6379")
+	target.SetSlotsImporting(slots, "source:6379")
+
+	// Keys still on the source are read from it.
+	{
+		result, err := source.Get(ctx, "{a}kept")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("value"), result.Value)
+	}
+	{
+		_, err := source.ZScore(ctx, "{a}zset", "a")
+		require.Nil(t, err)
+	}
+
+	// Keys that are not on the source may have moved, so they are asked of the target.
+	ask := datkey.Redirect{Node: "target:6379", Slot: slot, Ask: true}
+	{
+		_, err := source.Get(ctx, "{a}moved")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadRedirect, err.Cause)
+		requireRedirect(t, err, ask)
+	}
+	{
+		_, err := source.Set(ctx, "{a}moved", []byte("new"), 0)
+		require.NotNil(t, err)
+		requireRedirect(t, err, ask)
+	}
+
+	// Keys still on the source are written on it.
+	{
+		_, err := source.Set(ctx, "{a}kept", []byte("new"), 0)
+		require.Nil(t, err)
+	}
+
+	// The target serves the asked read, but redirects other reads to the source.
+	{
+		_, err := target.Get(ctx, "{a}moved")
+		require.NotNil(t, err)
+		requireRedirect(t, err, datkey.Redirect{Node: "source:6379", Slot: slot, Ask: false})
+	}
+	{
+		result, err := target.Get(datkey.Asking(ctx), "{a}moved")
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+
+	// The migration completes once every node agrees on the owner.
+	target.SetSlotsOwner(slots, "")
+	source.SetSlotsOwner(slots, "target:6379")
+	{
+		_, err := source.Get(ctx, "{a}kept")
+		require.NotNil(t, err)
+		requireRedirect(t, err, datkey.Redirect{Node: "target:6379", Slot: slot, Ask: false})
+	}
+	{
+		_, err := target.Get(ctx, "{a}moved")
+		require.Nil(t, err)
+	}
+}
+
+func TestDatkey_SlotStats(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	db := datkey.New(config)
+	defer db.Close()
+
+	assert.Empty(t, db.SlotStats(hash.Range{Begin: 0, End: hash.MaxHashSlot - 1}))
+
+	for _, key := range []string{"{a}1", "{a}2", "{b}1"} {
+		_, err := db.Set(ctx, key, []byte("value"), 0)
+		require.Nil(t, err)
+	}
+
+	stats := db.SlotStats(hash.Range{Begin: 0, End: hash.MaxHashSlot - 1})
+	require.Len(t, stats, 2)
+	statsOf := map[hash.Slot]datkey.SlotStats{}
+	for _, slotStats := range stats {
+		statsOf[slotStats.Slot] = slotStats
+		assert.Positive(t, slotStats.SizeInBytes)
+	}
+	assert.Equal(t, int64(2), statsOf[hash.ToSlot("{a}")].Keys)
+	assert.Equal(t, int64(1), statsOf[hash.ToSlot("{b}")].Keys)
+	assert.Greater(t, statsOf[hash.ToSlot("{a}")].SizeInBytes, statsOf[hash.ToSlot("{b}")].SizeInBytes)
+
+	slot := hash.ToSlot("{b}")
+	assert.Equal(t, []datkey.SlotStats{statsOf[slot]}, db.SlotStats(hash.Range{Begin: slot, End: slot}))
+}
+
+func TestDatkey_Partitioner(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.Partitioner = hash.NewFuncPartitioner(16, func(key string) uint64 {
+		return uint64(len(hash.Tag(key)))
+	})
+	db := datkey.New(config)
+	defer db.Close()
+
+	for _, key := range []string{"", "a", "{a}b", "abc", "0123456789abcdefghij"} {
+		_, err := db.Set(ctx, key, []byte("value"), 0)
+		require.Nil(t, err)
+	}
+	assert.Equal(t, hash.Slot(3), db.KeySlot("abc"))
+	assert.Equal(t, hash.Slot(4), db.KeySlot("0123456789abcdefghij"))
+
+	// The empty key is always in the same slot.
+	assert.Equal(t, hash.Slot(0), db.KeySlot(""))
+	{
+		result, err := db.Get(ctx, "")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+	}
+
+	stats := db.SlotStats(hash.Range{Begin: 0, End: hash.MaxHashSlot - 1})
+	assert.Equal(t, []datkey.SlotStats{
+		{Slot: 0, Keys: 1, SizeInBytes: stats[0].SizeInBytes},
+		{Slot: 1, Keys: 2, SizeInBytes: stats[1].SizeInBytes},
+		{Slot: 3, Keys: 1, SizeInBytes: stats[2].SizeInBytes},
+		{Slot: 4, Keys: 1, SizeInBytes: stats[3].SizeInBytes},
+	}, stats)
+
+	// Only the slots of the partitioner are owned, and slots past them are ignored.
+	db.SetSlotsOwner(hash.Range{Begin: 10, End: hash.MaxHashSlot - 1}, "other:6379")
+	assert.Equal(t, []datkey.SlotOwner{
+		{Slots: hash.Range{Begin: 0, End: 9}, Node: ""},
+		{Slots: hash.Range{Begin: 10, End: 15}, Node: "other:6379"},
+	}, db.SlotOwners())
+	assert.Equal(t, "other:6379", db.SlotState(15).Owner)
+	assert.Equal(t, datkey.SlotStateResponse{State: datkey.SlotStable, Node: "", Owner: ""}, db.SlotState(16))
+	assert.Equal(t, datkey.SlotStateResponse{State: datkey.SlotStable, Node: "", Owner: ""}, db.SlotState(hash.MaxHashSlot))
+
+	scanned, err := db.Scan(ctx, 0, datkey.ScanQuery{Match: "", Type: "", Count: 100})
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{"", "a", "{a}b", "abc", "0123456789abcdefghij"}, scanned.Keys)
+	assert.Equal(t, uint64(0), scanned.Cursor)
+	_, err = db.Scan(ctx, 16, datkey.ScanQuery{Match: "", Type: "", Count: 100})
+	require.NotNil(t, err)
+}
+
+func TestRedirect_Error(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "slot 10 is served by node:6379", (&datkey.Redirect{Node: "node:6379", Slot: 10, Ask: false}).Error())
+	assert.Equal(t, "slot 10 is migrating to node:6379", (&datkey.Redirect{Node: "node:6379", Slot: 10, Ask: true}).Error())
+
+	var redirect *datkey.Redirect
+	assert.False(t, errors.As(errors.New(datkey.DbReadInternal, "internal"), &redirect))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const maxHistory = 1000
+
+// Keys read from a terminal in raw mode.
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// lineEditor reads lines from a terminal with editing, history and tab completion.
+// If the input is not a terminal, lines are read as they are.
+type lineEditor struct {
+	input    *bufio.Reader
+	output   io.Writer
+	complete func(prefix string) []string
+	history  []string
+	fd       int
+}
+
+func newLineEditor(input *os.File, output io.Writer, complete func(prefix string) []string) *lineEditor {
+	return &lineEditor{
+		input:    bufio.NewReader(input),
+		output:   output,
+		complete: complete,
+		history:  nil,
+		fd:       int(input.Fd()),
+	}
+}
+
+// loadHistory from a file of one line per entry. A missing file is not an error.
+func (self *lineEditor) loadHistory(path string) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		self.addHistory(line)
+	}
+}
+
+func (self *lineEditor) saveHistory(path string) error {
+	return os.WriteFile(path, []byte(strings.Join(self.history, "\n")+"\n"), 0o600) //nolint:mnd // reason: file mode
+}
+
+func (self *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(self.history) != 0 && self.history[len(self.history)-1] == line {
+		return
+	}
+	self.history = append(self.history, line)
+	if len(self.history) > maxHistory {
+		self.history = self.history[len(self.history)-maxHistory:]
+	}
+}
+
+// readLine after writing the prompt. Returns io.EOF once the input is closed or Ctrl-D is pressed on an empty line.
+func (self *lineEditor) readLine(prompt string) (string, error) {
+	restore, isTerminal := makeRaw(self.fd)
+	if !isTerminal {
+		return self.readPlainLine(prompt)
+	}
+	defer restore()
+
+	state := &editState{
+		prompt:       prompt,
+		line:         nil,
+		cursor:       0,
+		historyIndex: len(self.history),
+		pending:      nil,
+	}
+	self.refresh(state)
+
+	for {
+		key, _, err := self.input.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(self.output, "\r\n")
+			return string(state.line), nil
+		case keyCtrlC:
+			fmt.Fprint(self.output, "^C\r\n")
+			return "", nil
+		case keyCtrlD:
+			if len(state.line) == 0 {
+				fmt.Fprint(self.output, "\r\n")
+				return "", io.EOF
+			}
+			state.deleteForward()
+		case keyBackspace, keyDelete:
+			state.deleteBackward()
+		case keyCtrlA:
+			state.cursor = 0
+		case keyCtrlE:
+			state.cursor = len(state.line)
+		case keyCtrlK:
+			state.line = state.line[:state.cursor]
+		case keyCtrlU:
+			state.line = state.line[state.cursor:]
+			state.cursor = 0
+		case keyCtrlL:
+			fmt.Fprint(self.output, "\x1b[H\x1b[2J")
+		case keyTab:
+			self.completeLine(state)
+		case keyEscape:
+			self.readEscape(state)
+		default:
+			if key >= ' ' {
+				state.insert(key)
+			}
+		}
+
+		self.refresh(state)
+	}
+}
+
+func (self *lineEditor) readPlainLine(prompt string) (string, error) {
+	fmt.Fprint(self.output, prompt)
+	line, err := self.input.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readEscape sequence for the arrow, home, end and delete keys.
+func (self *lineEditor) readEscape(state *editState) {
+	if next, _ := self.input.ReadByte(); next != '[' && next != 'O' {
+		return
+	}
+
+	key, _ := self.input.ReadByte()
+	switch key {
+	case 'A':
+		state.historyMove(self.history, -1)
+	case 'B':
+		state.historyMove(self.history, 1)
+	case 'C':
+		state.cursor = min(state.cursor+1, len(state.line))
+	case 'D':
+		state.cursor = max(state.cursor-1, 0)
+	case 'H':
+		state.cursor = 0
+	case 'F':
+		state.cursor = len(state.line)
+	case '3':
+		if next, _ := self.input.ReadByte(); next == '~' {
+			state.deleteForward()
+		}
+	}
+}
+
+// completeLine of the command name being typed, listing the candidates if there is more than one.
+func (self *lineEditor) completeLine(state *editState) {
+	prefix := string(state.line[:state.cursor])
+	if strings.ContainsAny(prefix, " \t") {
+		return
+	}
+
+	candidates := self.complete(prefix)
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		state.replacePrefix(candidates[0] + " ")
+	default:
+		if common := commonPrefix(candidates); len(common) > len(prefix) {
+			state.replacePrefix(common)
+			return
+		}
+		fmt.Fprint(self.output, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+func (self *lineEditor) refresh(state *editState) {
+	fmt.Fprint(self.output, "\r"+state.prompt+string(state.line)+"\x1b[K")
+	if back := len(state.line) - state.cursor; back > 0 {
+		fmt.Fprintf(self.output, "\x1b[%dD", back)
+	}
+}
+
+// editState of the line being edited.
+type editState struct {
+	prompt string
+	line   []rune
+	// pending line that was being typed before moving through the history.
+	pending      []rune
+	cursor       int
+	historyIndex int
+}
+
+func (self *editState) insert(key rune) {
+	self.line = append(self.line[:self.cursor], append([]rune{key}, self.line[self.cursor:]...)...)
+	self.cursor++
+}
+
+func (self *editState) deleteBackward() {
+	if self.cursor == 0 {
+		return
+	}
+	self.line = append(self.line[:self.cursor-1], self.line[self.cursor:]...)
+	self.cursor--
+}
+
+func (self *editState) deleteForward() {
+	if self.cursor == len(self.line) {
+		return
+	}
+	self.line = append(self.line[:self.cursor], self.line[self.cursor+1:]...)
+}
+
+func (self *editState) replacePrefix(prefix string) {
+	self.line = append([]rune(prefix), self.line[self.cursor:]...)
+	self.cursor = len([]rune(prefix))
+}
+
+func (self *editState) historyMove(history []string, offset int) {
+	index := self.historyIndex + offset
+	if index < 0 || index > len(history) {
+		return
+	}
+
+	if self.historyIndex == len(history) {
+		self.pending = self.line
+	}
+	self.historyIndex = index
+
+	if index == len(history) {
+		self.line = self.pending
+	} else {
+		self.line = []rune(history[index])
+	}
+	self.cursor = len(self.line)
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
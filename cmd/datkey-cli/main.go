@@ -0,0 +1,228 @@
+// Command datkey-cli runs commands against a datkey server, or against an embedded database opened from a snapshot file.
+//
+// Usage:
+//
+//	datkey-cli [-h host] [-p port] [-s socket] [-user username] [-a password] [-tls [-cacert path] [-cert path -key path]]
+//	           [-snapshot path] [-raw | -json] [-pipe] [-3] [command [arg ...]]
+//
+// With a command, the command is run and its reply printed. Without one, an interactive prompt is started with
+// line editing, history and tab completion of command names. With -pipe, each line of stdin is sent as a command
+// and only errors are printed, for bulk loading.
+//
+// An embedded database is restored from the snapshot and discarded on exit, so that production snapshots can be
+// inspected without modifying them.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/server"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	host := flag.String("h", "127.0.0.1", "server hostname")
+	port := flag.Int("p", 6379, "server port") //nolint:mnd // reason: default port
+	socket := flag.String("s", "", "server Unix socket, overrides -h and -p")
+	snapshotPath := flag.String("snapshot", "", "open an embedded database from a snapshot file instead of connecting to a server")
+	raw := flag.Bool("raw", false, "print replies as raw values")
+	jsonOutput := flag.Bool("json", false, "print replies as JSON")
+	pipe := flag.Bool("pipe", false, "send each line of stdin as a command, printing only errors")
+	resp3 := flag.Bool("3", false, "use the RESP3 protocol")
+	user := flag.String("user", "", "user to authenticate as, the default user if empty")
+	password := flag.String("a", "", "password to authenticate with, empty to not authenticate")
+	useTLS := flag.Bool("tls", false, "connect with TLS")
+	caCert := flag.String("cacert", "", "PEM CA certificate file to verify the server with, instead of the system roots")
+	clientCert := flag.String("cert", "", "PEM client certificate file to authenticate with")
+	clientKey := flag.String("key", "", "PEM private key file of -cert")
+	flag.Parse()
+
+	format := outputText
+	switch {
+	case *raw && *jsonOutput:
+		fmt.Fprintln(os.Stderr, "only one of -raw or -json may be set")
+		return 1
+	case *raw:
+		format = outputRaw
+	case *jsonOutput:
+		format = outputJSON
+	}
+
+	var conn net.Conn
+	var prompt string
+	if *snapshotPath != "" {
+		embedded, closeEmbedded, err := openEmbedded(*snapshotPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open %s: %v\n", *snapshotPath, err)
+			return 1
+		}
+		defer closeEmbedded()
+		conn = embedded
+		prompt = "datkey(" + filepath.Base(*snapshotPath) + ")> "
+	} else {
+		network, address := "tcp", net.JoinHostPort(*host, strconv.Itoa(*port))
+		if *socket != "" {
+			network, address = "unix", *socket
+		}
+
+		var err error
+		if *useTLS {
+			var tlsConfig *tls.Config
+			if tlsConfig, err = newTLSConfig(*host, *caCert, *clientCert, *clientKey); err == nil {
+				conn, err = tls.Dial(network, address, tlsConfig)
+			}
+		} else {
+			conn, err = net.Dial(network, address)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not connect to %s: %v\n", address, err)
+			return 1
+		}
+		defer conn.Close()
+		prompt = address + "> "
+	}
+
+	connection := newConnection(conn)
+
+	if *password != "" {
+		args := []string{"AUTH", *password}
+		if *user != "" {
+			args = []string{"AUTH", *user, *password}
+		}
+		result, err := connection.do(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not authenticate: %v\n", err)
+			return 1
+		}
+		if result.kind == replyError {
+			fmt.Fprintf(os.Stderr, "could not authenticate: %s\n", result.text)
+			return 1
+		}
+	}
+
+	if *resp3 {
+		result, err := connection.do([]string{"HELLO", "3"})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not switch to RESP3: %v\n", err)
+			return 1
+		}
+		if result.kind == replyError {
+			fmt.Fprintf(os.Stderr, "could not switch to RESP3: %s\n", result.text)
+			return 1
+		}
+	}
+
+	switch {
+	case *pipe:
+		if err := runPipe(connection, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case flag.NArg() != 0:
+		result, err := connection.do(flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintln(os.Stdout, formatReply(result, format))
+		if result.kind == replyError {
+			return 1
+		}
+	default:
+		editor := newLineEditor(os.Stdin, os.Stdout, completeCommand)
+		historyPath := ""
+		if home, err := os.UserHomeDir(); err == nil {
+			historyPath = filepath.Join(home, ".datkey_history")
+			editor.loadHistory(historyPath)
+		}
+
+		err := runRepl(connection, editor, os.Stdout, prompt, format)
+		if historyPath != "" {
+			_ = editor.saveHistory(historyPath)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func newTLSConfig(serverName string, caCertFile string, certFile string, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{ //nolint:exhaustruct // reason: defaults for every other setting
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if caCertFile != "" {
+		caCert, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", caCertFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// openEmbedded database restored from a snapshot, served over an in-memory connection.
+func openEmbedded(snapshotPath string) (net.Conn, func(), error) {
+	if _, err := os.Stat(snapshotPath); err != nil {
+		return nil, nil, err
+	}
+
+	var restoreErr error
+	var config datkey.Config
+	config.SnapshotPath = snapshotPath
+	config.PersistenceErrorHandler = func(err error) {
+		restoreErr = err
+	}
+
+	db := datkey.New(config)
+	if restoreErr != nil {
+		db.Close()
+		return nil, nil, restoreErr
+	}
+
+	srv := server.New(db, server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     nil,
+		ACL:              nil,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+	clientConn, serverConn := net.Pipe()
+	go srv.ServeConn(serverConn)
+
+	return clientConn, func() {
+		_ = clientConn.Close()
+		srv.Close()
+		db.Close()
+	}, nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// commandNames offered by tab completion.
+var commandNames = []string{ //nolint:gochecknoglobals // reason: constant list
+	"acl", "auth", "bitcount", "client", "command", "del", "echo", "exists", "exit", "expire", "get", "getbit", "getdel", "hello",
+	"info", "mget", "mset", "persist", "pexpire", "pfadd", "pfcount", "pfmerge", "ping", "psetex", "pttl", "quit",
+	"select", "set", "setbit", "setex", "ttl", "type", "unlink", "zadd", "zcard", "zrangebyscore", "zrem", "zscore",
+}
+
+// completeCommand names that begin with the prefix, matching the case of the prefix.
+func completeCommand(prefix string) []string {
+	upper := prefix != "" && prefix == strings.ToUpper(prefix) && prefix != strings.ToLower(prefix)
+
+	var candidates []string
+	for _, name := range commandNames {
+		if strings.HasPrefix(name, strings.ToLower(prefix)) {
+			if upper {
+				name = strings.ToUpper(name)
+			}
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// connection to a server, either over the network or to an embedded server.
+type connection struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func newConnection(conn net.Conn) *connection {
+	return &connection{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+}
+
+func (self *connection) do(args []string) (reply, error) {
+	if err := writeCommand(self.writer, args); err != nil {
+		return reply{}, err
+	}
+	if err := self.writer.Flush(); err != nil {
+		return reply{}, err
+	}
+	return readReply(self.reader)
+}
+
+// runRepl reading commands from the editor until the input is closed or the user quits.
+func runRepl(connection *connection, editor *lineEditor, output io.Writer, prompt string, format outputFormat) error {
+	for {
+		line, err := editor.readLine(prompt)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintf(output, "Invalid argument(s): %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		editor.addHistory(line)
+
+		if strings.EqualFold(args[0], "exit") || strings.EqualFold(args[0], "quit") {
+			return nil
+		}
+
+		result, err := connection.do(args)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(output, formatReply(result, format))
+	}
+}
+
+// runPipe sends every line of the input as a command without waiting for replies, then waits for all replies.
+// Only errors are printed, followed by a summary.
+func runPipe(connection *connection, input io.Reader, output io.Writer) error {
+	marker := make([]byte, 20) //nolint:mnd // reason: long enough to not be sent by the input
+	if _, err := rand.Read(marker); err != nil {
+		return err
+	}
+	endMarker := hex.EncodeToString(marker)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		// Closing the connection on an error stops the wait for replies that will never arrive.
+		fail := func(err error) {
+			writeErr <- err
+			_ = connection.conn.Close()
+		}
+
+		scanner := bufio.NewScanner(input)
+		scanner.Buffer(nil, 512*1024*1024) //nolint:mnd // reason: maximum size of a bulk string
+		for scanner.Scan() {
+			args, err := splitArgs(scanner.Text())
+			if err != nil {
+				fail(fmt.Errorf("invalid line %q: %w", scanner.Text(), err))
+				return
+			}
+			if len(args) == 0 {
+				continue
+			}
+			if err := writeCommand(connection.writer, args); err != nil {
+				fail(err)
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fail(err)
+			return
+		}
+
+		// The reply to the marker is the last reply, so once it is read every command has been answered.
+		if err := writeCommand(connection.writer, []string{"ECHO", endMarker}); err != nil {
+			fail(err)
+			return
+		}
+		if err := connection.writer.Flush(); err != nil {
+			fail(err)
+			return
+		}
+		writeErr <- nil
+	}()
+
+	var replies, errs int
+	for {
+		result, err := readReply(connection.reader)
+		if err != nil {
+			select {
+			case err := <-writeErr:
+				if err != nil {
+					return err
+				}
+			default:
+			}
+			return err
+		}
+		if result.kind == replyBulk && result.text == endMarker {
+			break
+		}
+
+		replies++
+		if result.kind == replyError {
+			errs++
+			fmt.Fprintln(output, formatReply(result, outputText))
+		}
+	}
+
+	if err := <-writeErr; err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "All data transferred. errors: %d, replies: %d\n", errs, replies)
+	return nil
+}
+
+// splitArgs of a command line. Arguments are separated by spaces and may be quoted.
+// Double quoted arguments support the escapes \n, \r, \t, \", \\ and \xHH. Single quoted arguments only support \'.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	runes := []rune(line)
+	for index := 0; index < len(runes); {
+		if runes[index] == ' ' || runes[index] == '\t' {
+			index++
+			continue
+		}
+
+		var arg strings.Builder
+		var quote rune
+	scan:
+		for ; index < len(runes); index++ {
+			char := runes[index]
+			switch {
+			case quote == 0 && (char == ' ' || char == '\t'):
+				break scan
+			case quote == 0 && (char == '"' || char == '\''):
+				quote = char
+			case quote != 0 && char == quote:
+				quote = 0
+				if index+1 < len(runes) && runes[index+1] != ' ' && runes[index+1] != '\t' {
+					return nil, fmt.Errorf("closing quote must be followed by a space")
+				}
+			case quote == '"' && char == '\\' && index+1 < len(runes):
+				index++
+				escaped, size, err := unescape(runes[index:])
+				if err != nil {
+					return nil, err
+				}
+				arg.WriteString(escaped)
+				index += size - 1
+			case quote == '\'' && char == '\\' && index+1 < len(runes) && runes[index+1] == '\'':
+				index++
+				arg.WriteRune('\'')
+			default:
+				arg.WriteRune(char)
+			}
+		}
+		if quote != 0 {
+			return nil, fmt.Errorf("unbalanced quotes")
+		}
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// unescape the sequence following a backslash, returning the value and number of runes consumed.
+func unescape(runes []rune) (string, int, error) {
+	switch runes[0] {
+	case 'n':
+		return "\n", 1, nil
+	case 'r':
+		return "\r", 1, nil
+	case 't':
+		return "\t", 1, nil
+	case 'x':
+		if len(runes) < 3 { //nolint:mnd // reason: x and two hex digits
+			return "", 0, fmt.Errorf("invalid hex escape")
+		}
+		value, err := strconv.ParseUint(string(runes[1:3]), 16, 8)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid hex escape: %w", err)
+		}
+		return string([]byte{byte(value)}), 3, nil //nolint:mnd // reason: x and two hex digits
+	default:
+		return string(runes[0]), 1, nil
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func Test_splitArgs(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string][]string{
+		"":                            nil,
+		"  get   key ":                {"get", "key"},
+		`set key "hello world"`:       {"set", "key", "hello world"},
+		`set key "a\"b\n\x41"`:        {"set", "key", "a\"b\nA"},
+		`set key 'it\'s'`:             {"set", "key", "it's"},
+		`set key ""`:                  {"set", "key", ""},
+		"set key\tvalue":              {"set", "key", "value"},
+		`set "quoted key" 'single'  `: {"set", "quoted key", "single"},
+	}
+	for line, expected := range testCases {
+		args, err := splitArgs(line)
+		require.NoError(t, err, line)
+		assert.Equal(t, expected, args, line)
+	}
+
+	for _, line := range []string{`set key "unbalanced`, `set key "a"b`, `set key 'x`, `set key "\x4"`} {
+		_, err := splitArgs(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func Test_completeCommand(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"zadd", "zcard", "zrangebyscore", "zrem", "zscore"}, completeCommand("z"))
+	assert.Equal(t, []string{"ZRANGEBYSCORE"}, completeCommand("ZRA"))
+	assert.Empty(t, completeCommand("unknown"))
+	assert.Equal(t, "zr", commonPrefix([]string{"zrangebyscore", "zrem"}))
+}
+
+func Test_formatReply(t *testing.T) {
+	t.Parallel()
+
+	value := reply{kind: replyArray, text: "", integer: 0, elements: []reply{
+		{kind: replyBulk, text: "a\"b", integer: 0, elements: nil},
+		{kind: replyInteger, text: "", integer: 7, elements: nil},
+		{kind: replyNull, text: "", integer: 0, elements: nil},
+		{kind: replyArray, text: "", integer: 0, elements: []reply{
+			{kind: replyDouble, text: "1.5", integer: 0, elements: nil},
+			{kind: replyError, text: "ERR bad", integer: 0, elements: nil},
+		}},
+	}}
+
+	assert.Equal(t, "1) \"a\\\"b\"\n2) (integer) 7\n3) (nil)\n4) 1) (double) 1.5\n   2) (error) ERR bad", formatReply(value, outputText))
+	assert.Equal(t, "a\"b\n7\n\n1.5\nERR bad", formatReply(value, outputRaw))
+	assert.JSONEq(t, `["a\"b",7,null,[1.5,{"error":"ERR bad"}]]`, formatReply(value, outputJSON))
+
+	hello := reply{kind: replyMap, text: "", integer: 0, elements: []reply{
+		{kind: replyBulk, text: "proto", integer: 0, elements: nil},
+		{kind: replyInteger, text: "", integer: 3, elements: nil},
+	}}
+	assert.Equal(t, "1# \"proto\" => (integer) 3", formatReply(hello, outputText))
+	assert.JSONEq(t, `{"proto":3}`, formatReply(hello, outputJSON))
+}
+
+func Test_readReply(t *testing.T) {
+	t.Parallel()
+
+	reader := bufio.NewReader(strings.NewReader("%1\r\n+key\r\n*2\r\n$3\r\nabc\r\n_\r\n=8\r\ntxt:info\r\n#t\r\n"))
+
+	result, err := readReply(reader)
+	require.NoError(t, err)
+	assert.Equal(t, `{"key":["abc",null]}`, formatReply(result, outputJSON))
+
+	result, err = readReply(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "info", formatReply(result, outputText))
+
+	result, err = readReply(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "(true)", formatReply(result, outputText))
+}
+
+func Test_embedded(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	snapshotPath := filepath.Join(t.TempDir(), "datkey.snapshot")
+	{
+		var config datkey.Config
+		config.SnapshotPath = snapshotPath
+		config.SnapshotInterval = time.Hour
+		db := datkey.New(config)
+		_, err := db.Set(ctx, "key", []byte("value"), 0)
+		require.Nil(t, err)
+		db.Close()
+	}
+
+	conn, closeEmbedded, err := openEmbedded(snapshotPath)
+	require.NoError(t, err)
+	defer closeEmbedded()
+	connection := newConnection(conn)
+
+	{
+		result, err := connection.do([]string{"GET", "key"})
+		require.NoError(t, err)
+		assert.Equal(t, `"value"`, formatReply(result, outputText))
+	}
+
+	{
+		var output bytes.Buffer
+		input := strings.NewReader("SET a 1\nSET b 2\n\nZADD a 1 x\nSET c \"with space\"\n")
+		require.NoError(t, runPipe(connection, input, &output))
+		assert.Equal(t, "(error) WRONGTYPE Operation against a key holding the wrong kind of value\nAll data transferred. errors: 1, replies: 4\n", output.String())
+	}
+
+	{
+		result, err := connection.do([]string{"MGET", "a", "b", "c"})
+		require.NoError(t, err)
+		assert.Equal(t, "1\n2\nwith space", formatReply(result, outputRaw))
+	}
+
+	_, _, err = openEmbedded(filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
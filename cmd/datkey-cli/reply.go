@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type replyKind int
+
+const (
+	replySimpleString replyKind = iota
+	replyError
+	replyInteger
+	replyBulk
+	replyNull
+	replyArray
+	replyMap
+	replyDouble
+	replyBoolean
+	replyVerbatim
+)
+
+// reply from the server. Map elements are stored as key and value pairs.
+type reply struct {
+	text     string
+	elements []reply
+	integer  int64
+	kind     replyKind
+}
+
+// writeCommand as an array of bulk strings. The command is buffered until the writer is flushed.
+func writeCommand(writer *bufio.Writer, args []string) error {
+	if _, err := fmt.Fprintf(writer, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply of any RESP2 or RESP3 type.
+func readReply(reader *bufio.Reader) (reply, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return reply{}, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return reply{}, fmt.Errorf("empty reply")
+	}
+
+	prefix, text := line[0], line[1:]
+	switch prefix {
+	case '+':
+		return reply{kind: replySimpleString, text: text, elements: nil, integer: 0}, nil
+	case '-':
+		return reply{kind: replyError, text: text, elements: nil, integer: 0}, nil
+	case ':':
+		integer, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return reply{}, fmt.Errorf("invalid integer reply: %q", text)
+		}
+		return reply{kind: replyInteger, text: "", elements: nil, integer: integer}, nil
+	case ',':
+		return reply{kind: replyDouble, text: text, elements: nil, integer: 0}, nil
+	case '#':
+		return reply{kind: replyBoolean, text: "", elements: nil, integer: boolInteger(text == "t")}, nil
+	case '_':
+		return reply{kind: replyNull, text: "", elements: nil, integer: 0}, nil
+	case '$', '=':
+		length, err := strconv.Atoi(text)
+		if err != nil {
+			return reply{}, fmt.Errorf("invalid bulk length: %q", text)
+		}
+		if length < 0 {
+			return reply{kind: replyNull, text: "", elements: nil, integer: 0}, nil
+		}
+		bulk := make([]byte, length+2) //nolint:mnd // reason: size of the trailing \r\n
+		if _, err := io.ReadFull(reader, bulk); err != nil {
+			return reply{}, err
+		}
+		if prefix == '=' {
+			// Verbatim strings begin with a three letter format, such as "txt:".
+			return reply{kind: replyVerbatim, text: string(bulk[min(4, length):length]), elements: nil, integer: 0}, nil
+		}
+		return reply{kind: replyBulk, text: string(bulk[:length]), elements: nil, integer: 0}, nil
+	case '*', '%', '~', '>':
+		length, err := strconv.Atoi(text)
+		if err != nil {
+			return reply{}, fmt.Errorf("invalid aggregate length: %q", text)
+		}
+		if length < 0 {
+			return reply{kind: replyNull, text: "", elements: nil, integer: 0}, nil
+		}
+
+		kind := replyArray
+		if prefix == '%' {
+			kind = replyMap
+			length *= 2
+		}
+		elements := make([]reply, length)
+		for index := range elements {
+			if elements[index], err = readReply(reader); err != nil {
+				return reply{}, err
+			}
+		}
+		return reply{kind: kind, text: "", elements: elements, integer: 0}, nil
+	default:
+		return reply{}, fmt.Errorf("unexpected reply type: %q", prefix)
+	}
+}
+
+// outputFormat of replies printed by the client.
+type outputFormat string
+
+const (
+	// outputText formats replies like redis-cli, with types and quoted strings.
+	outputText = outputFormat("text")
+	// outputRaw prints values as they are, one per line.
+	outputRaw = outputFormat("raw")
+	// outputJSON prints each reply as a JSON value on its own line.
+	outputJSON = outputFormat("json")
+)
+
+func formatReply(value reply, format outputFormat) string {
+	switch format {
+	case outputRaw:
+		return formatRaw(value)
+	case outputJSON:
+		encoded, err := json.Marshal(jsonReply(value))
+		if err != nil {
+			return fmt.Sprintf(`{"error":%q}`, err.Error())
+		}
+		return string(encoded)
+	case outputText:
+		return formatText(value, "")
+	default:
+		return formatText(value, "")
+	}
+}
+
+func formatText(value reply, indent string) string {
+	switch value.kind {
+	case replySimpleString, replyVerbatim:
+		return value.text
+	case replyError:
+		return "(error) " + value.text
+	case replyInteger:
+		return "(integer) " + strconv.FormatInt(value.integer, 10)
+	case replyBulk:
+		return strconv.Quote(value.text)
+	case replyNull:
+		return "(nil)"
+	case replyDouble:
+		return "(double) " + value.text
+	case replyBoolean:
+		if value.integer != 0 {
+			return "(true)"
+		}
+		return "(false)"
+	case replyArray:
+		if len(value.elements) == 0 {
+			return "(empty array)"
+		}
+		var builder strings.Builder
+		width := len(strconv.Itoa(len(value.elements)))
+		for index, element := range value.elements {
+			if index != 0 {
+				builder.WriteString("\n" + indent)
+			}
+			label := fmt.Sprintf("%*d) ", width, index+1)
+			builder.WriteString(label)
+			builder.WriteString(formatText(element, indent+strings.Repeat(" ", len(label))))
+		}
+		return builder.String()
+	case replyMap:
+		if len(value.elements) == 0 {
+			return "(empty hash)"
+		}
+		var builder strings.Builder
+		pairs := len(value.elements) / 2 //nolint:mnd // reason: key and value
+		width := len(strconv.Itoa(pairs))
+		for index := range pairs {
+			if index != 0 {
+				builder.WriteString("\n" + indent)
+			}
+			label := fmt.Sprintf("%*d# ", width, index+1)
+			key := formatText(value.elements[2*index], "")
+			builder.WriteString(label + key + " => ")
+			builder.WriteString(formatText(value.elements[2*index+1], indent+strings.Repeat(" ", len(label)+len(key)+4))) //nolint:mnd // reason: size of " => "
+		}
+		return builder.String()
+	default:
+		return value.text
+	}
+}
+
+func formatRaw(value reply) string {
+	switch value.kind {
+	case replySimpleString, replyError, replyBulk, replyDouble, replyVerbatim:
+		return value.text
+	case replyInteger, replyBoolean:
+		return strconv.FormatInt(value.integer, 10)
+	case replyNull:
+		return ""
+	case replyArray, replyMap:
+		lines := make([]string, len(value.elements))
+		for index, element := range value.elements {
+			lines[index] = formatRaw(element)
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return value.text
+	}
+}
+
+// jsonReply converts a reply to a value that encodes as JSON. Errors are encoded as an object with an "error" field.
+func jsonReply(value reply) any {
+	switch value.kind {
+	case replySimpleString, replyBulk, replyVerbatim:
+		return value.text
+	case replyError:
+		return map[string]string{"error": value.text}
+	case replyInteger:
+		return value.integer
+	case replyNull:
+		return nil
+	case replyDouble:
+		double, err := strconv.ParseFloat(value.text, 64)
+		if err != nil || math.IsInf(double, 0) || math.IsNaN(double) {
+			return value.text
+		}
+		return double
+	case replyBoolean:
+		return value.integer != 0
+	case replyArray:
+		elements := make([]any, len(value.elements))
+		for index, element := range value.elements {
+			elements[index] = jsonReply(element)
+		}
+		return elements
+	case replyMap:
+		object := make(map[string]any, len(value.elements)/2) //nolint:mnd // reason: key and value
+		for index := 0; index+1 < len(value.elements); index += 2 {
+			object[formatRaw(value.elements[index])] = jsonReply(value.elements[index+1])
+		}
+		return object
+	default:
+		return value.text
+	}
+}
+
+func boolInteger(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,8 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+// makeRaw is not supported, so lines are read without editing, history or completion.
+func makeRaw(int) (func(), bool) {
+	return nil, false
+}
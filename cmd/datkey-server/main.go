@@ -0,0 +1,375 @@
+// Command datkey-server serves a datkey database over the Redis serialization protocol.
+//
+// Usage:
+//
+//	datkey-server [-addr :6379] [-unix /run/datkey.sock] [-admin-addr 127.0.0.1:6380] [-snapshot path] [-aof path] [-aclfile path]
+//	              [-tls-cert path -tls-key path [-tls-ca-cert path [-tls-require-client-cert]]]
+//	              [-replicaof host:port [-primary-user name] [-primary-password password] [-replica-writable]]
+//	              [-cluster-address host:port [-gossip-addr :7946 [-gossip-seeds host:port,...] [-cluster-id id]
+//	              [-cluster-slots 0-8191,...] [-cluster-primary id]]] [-partitioner crc16|xxhash|jump] [-slot-count 16384]
+//	              [-pubsub-buffer 1024] [-pubsub-overflow drop|block] [-notify-keyspace-events set,del,expired,...]
+//
+// With -tls-cert and -tls-key, connections to -addr are encrypted with TLS. The certificate is reloaded on SIGHUP and
+// whenever the files change. With -tls-ca-cert, client certificates signed by the CA are verified and the clients are
+// authenticated as the ACL user named by the common name of their certificate.
+//
+// The -admin-addr listener is never encrypted and must be bound to a loopback address, for local tooling.
+//
+// With -replicaof, the server replicates every key from the primary and rejects writes unless -replica-writable is
+// set. REPLICAOF host port changes the primary at runtime and REPLICAOF NO ONE promotes the replica to a primary.
+//
+// The server owns every slot until CLUSTER SETSLOT gives slots to other nodes, named by their address. Commands for
+// the slots of other nodes are redirected with MOVED, and commands for keys that have already migrated with ASK.
+// -cluster-address is the address of the server replied in CLUSTER SLOTS.
+//
+// With -gossip-addr, the server gossips with the other nodes of the cluster over UDP to learn the slots each owns,
+// starting with the slots of -cluster-slots, or as a replica of the node with the ID -cluster-primary. A replica takes
+// over the slots of its primary once the primary fails.
+//
+// Keys are partitioned into -slot-count slots by the CRC16 of their hash tag, as in Redis Cluster. -partitioner xxhash
+// spreads similar keys more evenly, and -partitioner jump moves fewer keys when -slot-count changes, but clients must
+// partition keys the same way to send commands to the node that serves them.
+//
+// Messages published to a subscriber whose -pubsub-buffer is full are dropped, or with -pubsub-overflow block, the
+// publisher waits for the subscriber to read them.
+//
+// With -notify-keyspace-events, changes to keys of the listed types are published to the channels
+// __keyspace@0__:<key> and __keyevent@0__:<type>, as in Redis. The types are set, del, expire, persist, expired and
+// evicted.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/gossip"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":6379", "TCP address to listen on, empty to disable")
+	unixSocket := flag.String("unix", "", "Unix socket path to listen on, empty to disable")
+	snapshotPath := flag.String("snapshot", "", "snapshot file to restore from and write to")
+	snapshotInterval := flag.Duration("snapshot-interval", 0, "time between snapshots, 0 to only snapshot on shutdown")
+	appendOnlyPath := flag.String("aof", "", "append only file to log every modification to")
+	appendFsync := flag.String("appendfsync", string(datkey.AppendFsyncEverySec), "how often the append only file is synced: always, everysec or no")
+	maxMemory := flag.Int64("maxmemory", 0, "bytes of data after which keys are evicted, 0 to never evict")
+	maxConcurrency := flag.Int("max-concurrency", 1, "number of commands run on the database concurrently")
+	idleTimeout := flag.Duration("idle-timeout", 0, "close connections idle for this long, 0 to never close")
+	aclFile := flag.String("aclfile", "", "ACL file of users to authenticate clients as, empty to allow every client every command")
+	adminAddr := flag.String("admin-addr", "", "plaintext TCP address on a loopback interface to listen on, empty to disable")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file to encrypt connections to -addr with")
+	tlsKey := flag.String("tls-key", "", "PEM private key file of -tls-cert")
+	tlsCACert := flag.String("tls-ca-cert", "", "PEM CA certificate file to verify client certificates with")
+	tlsRequireClientCert := flag.Bool("tls-require-client-cert", false, "reject clients without a certificate signed by -tls-ca-cert")
+	replicaOf := flag.String("replicaof", "", "address of a primary to replicate from, empty to run as a primary")
+	primaryUser := flag.String("primary-user", "", "ACL user to authenticate with the primary as")
+	primaryPassword := flag.String("primary-password", "", "password to authenticate with the primary with")
+	replicaWritable := flag.Bool("replica-writable", false, "allow writes while replicating from a primary")
+	replicationBacklog := flag.Int("repl-backlog-size", 0, "bytes of recent writes kept for replicas that reconnect, 0 for 1MiB")
+	clusterAddress := flag.String("cluster-address", "", "address clients and other nodes reach the server at, empty for the address each client connected to")
+	gossipAddr := flag.String("gossip-addr", "", "UDP address to gossip with the other nodes of the cluster on, empty to disable")
+	gossipSeeds := flag.String("gossip-seeds", "", "comma separated gossip addresses of nodes to join the cluster through")
+	clusterID := flag.String("cluster-id", "", "ID of the node in the cluster, empty for -cluster-address")
+	clusterSlots := flag.String("cluster-slots", "", "comma separated slot ranges the node owns when it starts as a primary, such as 0-8191")
+	clusterPrimary := flag.String("cluster-primary", "", "ID of the node to replicate from, empty to start as a primary")
+	partitionerName := flag.String("partitioner", "crc16", "hash function keys are partitioned into slots by: crc16, xxhash or jump")
+	slotCount := flag.Int("slot-count", int(hash.MaxHashSlot), "slots keys are partitioned into, up to 16384")
+	pubSubBuffer := flag.Int("pubsub-buffer", 0, "messages buffered for each subscriber, 0 for 1024")
+	pubSubOverflow := flag.String("pubsub-overflow", string(datkey.PubSubDrop), "what publishing to a subscriber with a full buffer does: drop or block")
+	notifyKeyspaceEvents := flag.String("notify-keyspace-events", "", "comma separated types of changes to keys to publish: set, del, expire, persist, expired or evicted")
+	tlsReloadInterval := flag.Duration("tls-reload-interval", 10*time.Second, "time between checks of the certificate files for changes") //nolint:mnd // reason: default value
+	flag.Parse()
+
+	if *addr == "" && *unixSocket == "" && *adminAddr == "" {
+		log.Fatal("at least one of -addr, -unix or -admin-addr is required")
+	}
+
+	partitioner, err := newPartitioner(*partitionerName, *slotCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var users *acl.ACL
+	if *aclFile != "" {
+		users = acl.New()
+		if err := users.LoadFile(*aclFile); err != nil {
+			log.Fatalf("load ACL file %s: %v", *aclFile, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tlsConfig, reloader := loadTLSConfig(*tlsCert, *tlsKey, *tlsCACert, *tlsRequireClientCert)
+
+	var listeners []net.Listener
+	if *addr != "" {
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			log.Fatalf("listen on %s: %v", *addr, err)
+		}
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		listeners = append(listeners, listener)
+	}
+	if *adminAddr != "" {
+		listener, err := net.Listen("tcp", *adminAddr)
+		if err != nil {
+			log.Fatalf("listen on %s: %v", *adminAddr, err)
+		}
+		if tcpAddr, isTCP := listener.Addr().(*net.TCPAddr); !isTCP || !tcpAddr.IP.IsLoopback() {
+			log.Fatalf("-admin-addr must be a loopback address: %s", listener.Addr())
+		}
+		listeners = append(listeners, listener)
+	}
+	if *unixSocket != "" {
+		// Remove a socket left behind by a previous process that did not shut down cleanly.
+		_ = os.Remove(*unixSocket)
+		listener, err := net.Listen("unix", *unixSocket)
+		if err != nil {
+			log.Fatalf("listen on %s: %v", *unixSocket, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	db := datkey.New(datkey.Config{
+		EvictStrategy:             datkey.EvictByLRU,
+		DbBytesEvictThreshold:     *maxMemory,
+		CommandTimeout:            0,
+		MaxConcurrency:            *maxConcurrency,
+		EvictionFrequency:         0,
+		ExpirationFrequency:       0,
+		SnapshotPath:              *snapshotPath,
+		SnapshotInterval:          *snapshotInterval,
+		AppendOnlyPath:            *appendOnlyPath,
+		AppendFsync:               datkey.AppendFsyncMode(*appendFsync),
+		AppendOnlyRewriteMinBytes: 0,
+		PersistenceErrorHandler: func(err error) {
+			log.Printf("persistence error: %v", err)
+		},
+		ReplicationBacklogBytes:      *replicationBacklog,
+		ReplicationHeartbeatInterval: 0,
+		ReplicaWritable:              *replicaWritable,
+		ReplicationErrorHandler: func(err error) {
+			log.Printf("replication error: %v", err)
+		},
+		Partitioner:          partitioner,
+		PubSubBufferSize:     *pubSubBuffer,
+		PubSubOverflow:       datkey.PubSubOverflow(*pubSubOverflow),
+		NotifyKeyspaceEvents: parseKeyspaceEvents(*notifyKeyspaceEvents),
+	})
+
+	srv := server.New(db, server.Config{
+		MaxBulkLength: 0,
+		IdleTimeout:   *idleTimeout,
+		ErrorHandler: func(err error) {
+			log.Printf("server error: %v", err)
+		},
+		ACL:              users,
+		PrimaryUsername:  *primaryUser,
+		PrimaryPassword:  *primaryPassword,
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   *clusterAddress,
+	})
+
+	if *replicaOf != "" {
+		if err := srv.ReplicaOf(*replicaOf); err != nil {
+			log.Fatalf("replicate from %s: %v", *replicaOf, err)
+		}
+	}
+
+	if reloader != nil {
+		watchCertificate(ctx, reloader, *tlsReloadInterval)
+	}
+
+	var membership *gossip.Membership
+	if *gossipAddr != "" {
+		if *clusterAddress == "" {
+			log.Fatal("-gossip-addr requires -cluster-address")
+		}
+		slots, err := hash.ParseRangeSet(*clusterSlots)
+		if err != nil {
+			log.Fatalf("parse -cluster-slots: %v", err)
+		}
+		if !slots.Subtract(hash.AllSlots(partitioner.SlotCount())).IsEmpty() {
+			log.Fatalf("-cluster-slots must be below -slot-count %d: %s", partitioner.SlotCount(), slots)
+		}
+		membership = joinCluster(db, srv, *gossipAddr, *gossipSeeds, *clusterID, *clusterAddress, slots.Ranges(), partitioner.SlotCount(), *clusterPrimary)
+	}
+
+	serveErrs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		log.Printf("listening on %s %s", listener.Addr().Network(), listener.Addr())
+		go func() {
+			if err := srv.Serve(listener); err.Cause != server.ServeErrClosed {
+				serveErrs <- err
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Print("shutting down")
+	case err := <-serveErrs:
+		log.Printf("serve error: %v", err)
+	}
+
+	shutdownStart := time.Now()
+	if membership != nil {
+		membership.Close()
+	}
+	srv.Close()
+	db.Close()
+	log.Printf("shut down in %s", time.Since(shutdownStart))
+}
+
+// loadTLSConfig for the certificate files, or nil if TLS is not enabled.
+// joinCluster by gossiping over UDP on the address, applying the slot owners to the database and the primary to the server.
+func joinCluster(
+	db *datkey.Datkey, srv *server.Server, gossipAddr string, seeds string, id string, address string, slots []hash.Range, slotCount int,
+	primaryID string,
+) *gossip.Membership {
+	transport, err := gossip.ListenUDP(gossipAddr)
+	if err != nil {
+		log.Fatalf("listen on %s: %v", gossipAddr, err)
+	}
+
+	var seedAddresses []string
+	if seeds != "" {
+		seedAddresses = strings.Split(seeds, ",")
+	}
+
+	return gossip.New(gossip.Config{
+		ID:        id,
+		Address:   address,
+		Transport: transport,
+		Seeds:     seedAddresses,
+		Slots:     slots,
+		PrimaryID: primaryID,
+		Database:  db,
+		SlotCount: slotCount,
+		ReplicaOfHandler: func(address string) {
+			if err := srv.ReplicaOf(address); err != nil {
+				log.Printf("replicate from %s: %v", address, err)
+			}
+		},
+		Interval:       0,
+		Fanout:         0,
+		SuspectTimeout: 0,
+		FailTimeout:    0,
+		ErrorHandler: func(err error) {
+			log.Printf("gossip error: %v", err)
+		},
+	})
+}
+
+// newPartitioner of keys by the hash function with the name.
+func newPartitioner(name string, slotCount int) (hash.Partitioner, error) {
+	if slotCount < 1 || slotCount > int(hash.MaxHashSlot) {
+		return nil, fmt.Errorf("-slot-count must be from 1 up to %d: %d", hash.MaxHashSlot, slotCount)
+	}
+
+	switch name {
+	case "crc16":
+		return hash.NewCRC16Partitioner(slotCount), nil
+	case "xxhash":
+		return hash.NewXXHashPartitioner(slotCount), nil
+	case "jump":
+		return hash.NewJumpPartitioner(slotCount), nil
+	default:
+		return nil, fmt.Errorf("unknown -partitioner: %s", name)
+	}
+}
+
+// parseKeyspaceEvents of a comma separated list of event types.
+func parseKeyspaceEvents(value string) []datkey.KeyspaceEventType {
+	var eventTypes []datkey.KeyspaceEventType
+	for _, eventType := range strings.Split(value, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			eventTypes = append(eventTypes, datkey.KeyspaceEventType(eventType))
+		}
+	}
+	return eventTypes
+}
+
+func loadTLSConfig(certFile string, keyFile string, caCertFile string, requireClientCert bool) (*tls.Config, *server.CertificateReloader) {
+	if certFile == "" && keyFile == "" {
+		if caCertFile != "" || requireClientCert {
+			log.Fatal("-tls-ca-cert and -tls-require-client-cert require -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		log.Fatal("both -tls-cert and -tls-key are required")
+	}
+
+	reloader, err := server.NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("load TLS certificate: %v", err)
+	}
+
+	config := &tls.Config{ //nolint:exhaustruct // reason: defaults for every other setting
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if caCertFile != "" {
+		caCert, err := os.ReadFile(caCertFile)
+		if err != nil {
+			log.Fatalf("read -tls-ca-cert: %v", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caCert) {
+			log.Fatalf("no certificates found in %s", caCertFile)
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if requireClientCert {
+		log.Fatal("-tls-require-client-cert requires -tls-ca-cert")
+	}
+
+	return config, reloader
+}
+
+// watchCertificate files for changes and reload them on SIGHUP, until the context is done.
+func watchCertificate(ctx context.Context, reloader *server.CertificateReloader, interval time.Duration) {
+	reloader.Watch(ctx, interval, func(err error) {
+		log.Printf("reload TLS certificate: %v", err)
+	})
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				if err := reloader.Reload(); err != nil {
+					log.Printf("reload TLS certificate: %v", err)
+					continue
+				}
+				log.Print("reloaded TLS certificate")
+			}
+		}
+	}()
+}
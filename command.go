@@ -1,12 +1,14 @@
 package datkey
 
 import (
+	"bytes"
 	"sync"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
 )
 
 type empty = struct{}
@@ -23,10 +25,12 @@ type commandStats struct {
 
 type statsResponse struct {
 	sizeInBytes int64
+	keys        int64
 }
 
 type StatsResponse struct {
 	DbSizeInBytes int64
+	Replication   ReplicationStats
 }
 
 type commandSet struct {
@@ -53,6 +57,8 @@ type GetResponse struct {
 type commandDelete struct {
 	Resp *valueResponse
 	Key  string
+	// StringOnly keeps a key that does not hold a string and reports it as the wrong type.
+	StringOnly bool
 }
 
 type DeleteResponse struct {
@@ -75,12 +81,14 @@ type ExpireResponse struct {
 }
 
 type commandPersist struct {
-	Resp *valueResponse
+	Resp *persistResponse
 	Key  string
 }
 
 type PersistResponse struct {
 	Exists bool
+	// Persisted is true if the key had a TTL that was removed.
+	Persisted bool
 }
 
 type commandTtl struct {
@@ -94,8 +102,14 @@ type TtlResponse struct {
 }
 
 type valueResponse struct {
-	Value  []byte
-	Exists bool
+	Value     []byte
+	Exists    bool
+	WrongType bool
+}
+
+type persistResponse struct {
+	Exists    bool
+	Persisted bool
 }
 
 type ttlResponse struct {
@@ -103,10 +117,21 @@ type ttlResponse struct {
 	Exists bool
 }
 
+type integerResponse struct {
+	Value     int64
+	Exists    bool
+	WrongType bool
+}
+
 type keyStorage struct {
 	lastAccessTime time.Time
 	expiresAt      time.Time
 	value          []byte
+	// object holds any value that is not a string. Only one of value or object is set.
+	object storedObject
+	// valueShared is true when value may be referenced outside of the storage (ie it was given by or handed back to a caller).
+	// Commands that modify a value in place must copy it first if it is shared.
+	valueShared bool
 }
 
 type commandDeleteLru struct {
@@ -117,7 +142,30 @@ func (self keyStorage) isExpired() bool {
 	return !self.expiresAt.IsZero() && self.expiresAt.Before(time.Now())
 }
 
-func setKey(key string, value []byte, ttl time.Duration, cache cacheStorage) SetResponse {
+func (self keyStorage) sizeInBytes() int64 {
+	if self.object != nil {
+		return self.object.sizeInBytes()
+	}
+	return int64(len(self.value))
+}
+
+func (self keyStorage) valueType() ValueType {
+	if self.object != nil {
+		return self.object.valueType()
+	}
+	return ValueTypeString
+}
+
+// ownedValue returns the value such that it is safe to modify in place.
+func (self *keyStorage) ownedValue() []byte {
+	if self.valueShared {
+		self.value = bytes.Clone(self.value)
+		self.valueShared = false
+	}
+	return self.value
+}
+
+func setKey(key string, value []byte, ttl time.Duration, cache cacheStorage) (SetResponse, *errors.Error[DbWriteErr]) {
 	var expiresAt time.Time
 	if ttl != 0 {
 		expiresAt = time.Now().Add(ttl)
@@ -127,123 +175,181 @@ func setKey(key string, value []byte, ttl time.Duration, cache cacheStorage) Set
 		lastAccessTime: time.Now(),
 		value:          value,
 		expiresAt:      expiresAt,
+		object:         nil,
+		valueShared:    true,
 	}
 
 	resp := &valueResponse{
-		Value:  nil,
-		Exists: false,
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
 	}
 
-	cache.runCommand(hash.ToSlot(key), commandSet{
+	redirect := cache.runCommand(cache.slotOf(key), commandSet{
 		Key:  key,
 		data: data,
 		Resp: resp,
 	})
+	if redirect != nil {
+		return SetResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
 
 	return SetResponse{
 		PreviousValue: resp.Value,
 		Exists:        resp.Exists,
-	}
+	}, nil
 }
 
-func getKey(key string, cache cacheStorage) GetResponse {
+func getKey(key string, cache cacheStorage) (GetResponse, *errors.Error[DbReadErr]) {
 	resp := &valueResponse{
-		Value:  nil,
-		Exists: false,
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
 	}
 
-	cache.runCommand(hash.ToSlot(key), commandGet{
+	redirect := cache.runCommand(cache.slotOf(key), commandGet{
 		Key:  key,
 		Resp: resp,
 	})
+	if redirect != nil {
+		return GetResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return GetResponse{}, errors.New(DbReadWrongType, "key does not hold a string value: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
 
 	return GetResponse{
 		Value:  resp.Value,
 		Exists: resp.Exists,
-	}
+	}, nil
 }
 
-func deleteKey(key string, cache cacheStorage) DeleteResponse {
+func deleteKey(key string, cache cacheStorage) (DeleteResponse, *errors.Error[DbWriteErr]) {
 	resp := &valueResponse{
-		Value:  nil,
-		Exists: false,
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
 	}
 
-	cache.runCommand(hash.ToSlot(key), commandDelete{
-		Key:  key,
-		Resp: resp,
+	redirect := cache.runCommand(cache.slotOf(key), commandDelete{
+		Key:        key,
+		StringOnly: false,
+		Resp:       resp,
 	})
+	if redirect != nil {
+		return DeleteResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
 
 	return DeleteResponse{
 		DeletedValue: resp.Value,
 		Exists:       resp.Exists,
+	}, nil
+}
+
+func getDelKey(key string, cache cacheStorage) (DeleteResponse, *errors.Error[DbWriteErr]) {
+	resp := &valueResponse{
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
 	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandDelete{
+		Key:        key,
+		StringOnly: true,
+		Resp:       resp,
+	})
+	if redirect != nil {
+		return DeleteResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return DeleteResponse{}, errors.New(DbWriteWrongType, "key does not hold a string value: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return DeleteResponse{
+		DeletedValue: resp.Value,
+		Exists:       resp.Exists,
+	}, nil
 }
 
-func expireKey(key string, ttl time.Duration, cache cacheStorage) ExpireResponse {
+func expireKey(key string, ttl time.Duration, cache cacheStorage) (ExpireResponse, *errors.Error[DbWriteErr]) {
 	expiresAt := time.Now().Add(ttl)
 
 	resp := &valueResponse{
-		Value:  nil,
-		Exists: false,
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
 	}
 
-	cache.runCommand(hash.ToSlot(key), commandExpire{
+	redirect := cache.runCommand(cache.slotOf(key), commandExpire{
 		Key:       key,
 		ExpiresAt: expiresAt,
 		Resp:      resp,
 	})
+	if redirect != nil {
+		return ExpireResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
 
 	return ExpireResponse{
 		Exists: resp.Exists,
-	}
+	}, nil
 }
 
-func persistKey(key string, cache cacheStorage) PersistResponse {
-	resp := &valueResponse{
-		Value:  nil,
-		Exists: false,
+func persistKey(key string, cache cacheStorage) (PersistResponse, *errors.Error[DbWriteErr]) {
+	resp := &persistResponse{
+		Exists:    false,
+		Persisted: false,
 	}
 
-	cache.runCommand(hash.ToSlot(key), commandPersist{
+	redirect := cache.runCommand(cache.slotOf(key), commandPersist{
 		Key:  key,
 		Resp: resp,
 	})
+	if redirect != nil {
+		return PersistResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
 
 	return PersistResponse{
-		Exists: resp.Exists,
-	}
+		Exists:    resp.Exists,
+		Persisted: resp.Persisted,
+	}, nil
 }
 
-func ttlKey(key string, cache cacheStorage) TtlResponse {
+func ttlKey(key string, cache cacheStorage) (TtlResponse, *errors.Error[DbReadErr]) {
 	resp := &ttlResponse{
 		Ttl:    0,
 		Exists: false,
 	}
 
-	cache.runCommand(hash.ToSlot(key), commandTtl{
+	redirect := cache.runCommand(cache.slotOf(key), commandTtl{
 		Key:  key,
 		Resp: resp,
 	})
+	if redirect != nil {
+		return TtlResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
 
 	return TtlResponse{
 		Ttl:    resp.Ttl,
 		Exists: resp.Exists,
-	}
+	}, nil
 }
 
 func getDbStats(cache cacheStorage) StatsResponse {
 	mutex := &sync.Mutex{}
 	dbStats := StatsResponse{
 		DbSizeInBytes: 0,
+		Replication:   ReplicationStats{}, //nolint:exhaustruct // reason: set by Stats
 	}
 
 	group := errgroup.Group{}
 
-	for hashSlot := range hash.MaxHashSlot {
+	for hashSlot := range cache.slotCount() {
 		group.Go(func() error {
 			resp := &statsResponse{
 				sizeInBytes: 0,
+				keys:        0,
 			}
 
 			cache.runCommand(hashSlot, commandStats{
@@ -265,8 +371,9 @@ func getDbStats(cache cacheStorage) StatsResponse {
 
 func deleteExpired(hashSlot hash.Slot, cache cacheStorage) {
 	resp := &valueResponse{
-		Value:  nil,
-		Exists: false,
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
 	}
 
 	cache.runCommand(hashSlot, commandDeleteExpired{
@@ -277,7 +384,7 @@ func deleteExpired(hashSlot hash.Slot, cache cacheStorage) {
 func deleteLru(cache cacheStorage) {
 	group := errgroup.Group{}
 
-	for hashSlot := range hash.MaxHashSlot {
+	for hashSlot := range cache.slotCount() {
 		group.Go(func() error {
 			resp := &valueResponse{
 				Value:  nil,
@@ -0,0 +1,534 @@
+package datkey
+
+import (
+	"context"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+const (
+	cuckooDefaultErrorRate     = 0.01
+	cuckooDefaultCapacity      = 1024
+	cuckooDefaultBucketSize    = 2
+	cuckooDefaultMaxIterations = 20
+	cuckooDefaultExpansion     = 1
+	cuckooMaxFingerprintBits   = 16
+	// cuckooMaxBucketSize, cuckooMaxIterations and cuckooMaxExpansion are the limits of RedisBloom, and
+	// cuckooMaxCapacity bounds the memory of each layer to 2GiB.
+	cuckooMaxBucketSize = 255
+	cuckooMaxIterations = 65535
+	cuckooMaxExpansion  = 32768
+	cuckooMaxCapacity   = 1 << 30
+	cuckooHashSeed      = 0x2c1b3c6d
+	// cuckooFingerprintMultiplier scatters a fingerprint to find the alternate bucket of an item.
+	cuckooFingerprintMultiplier = 0x5bd1e995
+	// cuckooLayerOverhead is the approximate size, in bytes, of each layer besides its fingerprints.
+	cuckooLayerOverhead = 24
+)
+
+// CuckooConfig for a scalable cuckoo filter.
+type CuckooConfig struct {
+	// ErrorRate is the desired probability of false positives, between 0 and 1 exclusive.
+	// This determines the size of the fingerprint stored for each item.
+	// Default: 0.01
+	ErrorRate float64
+
+	// Capacity is the number of items expected to be added before the filter scales, up to 2^30.
+	// Default: 1024
+	Capacity int64
+
+	// BucketSize is the number of items in each bucket, up to 255. Larger buckets fill up more before scaling but
+	// increase the error rate.
+	// Default: 2
+	BucketSize int64
+
+	// MaxIterations is the number of times items are moved to make room for a new item before the filter scales, up to
+	// 65535.
+	// Default: 20
+	MaxIterations int64
+
+	// Expansion is the factor by which the capacity grows each time the filter scales, up to 32768.
+	// Default: 1
+	Expansion int64
+}
+
+type commandCFReserve struct {
+	Resp   *bfReserveResponse
+	Key    string
+	Config CuckooConfig
+}
+
+type commandCFAdd struct {
+	Resp *cfAddResponse
+	Key  string
+	Item []byte
+}
+
+type cfAddResponse struct {
+	WrongType bool
+}
+
+type commandCFDel struct {
+	Resp *cfDelResponse
+	Key  string
+	Item []byte
+}
+
+type cfDelResponse struct {
+	Deleted   bool
+	WrongType bool
+}
+
+type CFDelResponse struct {
+	// Deleted is true if an occurrence of the item was found and deleted.
+	Deleted bool
+}
+
+type commandCFExists struct {
+	Resp *cfExistsResponse
+	Key  string
+	Item []byte
+}
+
+type cfExistsResponse struct {
+	Exists    bool
+	WrongType bool
+}
+
+type CFExistsResponse struct {
+	// Exists is false if the item has definitely not been added, and true if it may have been added.
+	Exists bool
+}
+
+// CFReserve creates an empty cuckoo filter at key. Fails with DbWriteKeyExists if the key already exists.
+func (self *Datkey) CFReserve(ctx context.Context, key string, config CuckooConfig) *errors.Error[DbWriteErr] {
+	if err := self.writeAllowed(ctx); err != nil {
+		return err
+	}
+	return cfReserveKey(key, config, self.cache.forContext(ctx))
+}
+
+// CFAdd an item to the cuckoo filter at key, creating the filter with the default config if it does not exist.
+// An item may be added more than once, and must then be deleted as many times.
+func (self *Datkey) CFAdd(ctx context.Context, key string, item []byte) *errors.Error[DbWriteErr] {
+	if err := self.writeAllowed(ctx); err != nil {
+		return err
+	}
+	return cfAddKey(key, item, self.cache.forContext(ctx))
+}
+
+// CFDel one occurrence of an item from the cuckoo filter at key.
+// Only items that have been added may be deleted, otherwise other items may be deleted by mistake.
+func (self *Datkey) CFDel(ctx context.Context, key string, item []byte) (CFDelResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return CFDelResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return cfDelKey(key, item, self.cache.forContext(ctx))
+}
+
+// CFExists checks if an item may have been added to the cuckoo filter at key.
+func (self *Datkey) CFExists(ctx context.Context, key string, item []byte) (CFExistsResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return CFExistsResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return cfExistsKey(key, item, self.cache.forContext(ctx))
+}
+
+func cfReserveKey(key string, config CuckooConfig, cache cacheStorage) *errors.Error[DbWriteErr] {
+	if config.ErrorRate == 0 {
+		config.ErrorRate = cuckooDefaultErrorRate
+	}
+	if config.Capacity == 0 {
+		config.Capacity = cuckooDefaultCapacity
+	}
+	if config.BucketSize == 0 {
+		config.BucketSize = cuckooDefaultBucketSize
+	}
+	if config.MaxIterations == 0 {
+		config.MaxIterations = cuckooDefaultMaxIterations
+	}
+	if config.Expansion == 0 {
+		config.Expansion = cuckooDefaultExpansion
+	}
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	resp := &bfReserveResponse{
+		Exists: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandCFReserve{
+		Key:    key,
+		Config: config,
+		Resp:   resp,
+	})
+	if redirect != nil {
+		return redirect.writeErr()
+	}
+
+	if resp.Exists {
+		return errors.New(DbWriteKeyExists, "key already exists: %s", key)
+	}
+
+	return nil
+}
+
+func cfAddKey(key string, item []byte, cache cacheStorage) *errors.Error[DbWriteErr] {
+	resp := &cfAddResponse{
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandCFAdd{
+		Key:  key,
+		Item: item,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return redirect.writeErr()
+	}
+
+	if resp.WrongType {
+		return errors.New(DbWriteWrongType, "key does not hold a cuckoo filter: %s", key)
+	}
+
+	return nil
+}
+
+func cfDelKey(key string, item []byte, cache cacheStorage) (CFDelResponse, *errors.Error[DbWriteErr]) {
+	resp := &cfDelResponse{
+		Deleted:   false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandCFDel{
+		Key:  key,
+		Item: item,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return CFDelResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return CFDelResponse{}, errors.New(DbWriteWrongType, "key does not hold a cuckoo filter: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return CFDelResponse{
+		Deleted: resp.Deleted,
+	}, nil
+}
+
+func cfExistsKey(key string, item []byte, cache cacheStorage) (CFExistsResponse, *errors.Error[DbReadErr]) {
+	resp := &cfExistsResponse{
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandCFExists{
+		Key:  key,
+		Item: item,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return CFExistsResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return CFExistsResponse{}, errors.New(DbReadWrongType, "key does not hold a cuckoo filter: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return CFExistsResponse{
+		Exists: resp.Exists,
+	}, nil
+}
+
+// lookupCuckooFilter returns the stored data and cuckoo filter for a key.
+// Returns false for wrongType if the key exists but is not a cuckoo filter.
+func (self *slotStorage) lookupCuckooFilter(key string) (keyStorage, *cuckooFilter, bool, bool) {
+	data, exists := self.lookupKey(key)
+	if !exists {
+		return data, nil, false, false
+	}
+
+	filter, ok := data.object.(*cuckooFilter)
+	if !ok {
+		return data, nil, true, true
+	}
+
+	return data, filter, true, false
+}
+
+func (self *slotStorage) handleCommandCFReserve(cmd commandCFReserve) {
+	if _, exists := self.lookupKey(cmd.Key); exists {
+		cmd.Resp.Exists = true
+		return
+	}
+
+	self.storeKey(cmd.Key, 0, keyStorage{
+		lastAccessTime: time.Now(),
+		expiresAt:      time.Time{},
+		value:          nil,
+		object:         newCuckooFilter(cmd.Config),
+		valueShared:    false,
+	})
+}
+
+// validate the config once the defaults are set.
+func (self CuckooConfig) validate() *errors.Error[DbWriteErr] {
+	if !(0 < self.ErrorRate && self.ErrorRate < 1) {
+		return errors.New(DbWriteInvalidArgument, "error rate must be between 0 and 1: %f", self.ErrorRate)
+	}
+	if self.Capacity < 1 || self.BucketSize < 1 || self.MaxIterations < 1 || self.Expansion < 1 {
+		return errors.New(DbWriteInvalidArgument, "capacity, bucket size, max iterations, and expansion must be positive")
+	}
+	if self.Capacity > cuckooMaxCapacity {
+		return errors.New(DbWriteInvalidArgument, "capacity must be at most %d: %d", cuckooMaxCapacity, self.Capacity)
+	}
+	if self.BucketSize > cuckooMaxBucketSize {
+		return errors.New(DbWriteInvalidArgument, "bucket size must be at most %d: %d", cuckooMaxBucketSize, self.BucketSize)
+	}
+	if self.MaxIterations > cuckooMaxIterations {
+		return errors.New(DbWriteInvalidArgument, "max iterations must be at most %d: %d", cuckooMaxIterations, self.MaxIterations)
+	}
+	if self.Expansion > cuckooMaxExpansion {
+		return errors.New(DbWriteInvalidArgument, "expansion must be at most %d: %d", cuckooMaxExpansion, self.Expansion)
+	}
+	return nil
+}
+
+func (self *slotStorage) handleCommandCFAdd(cmd commandCFAdd) {
+	data, filter, exists, wrongType := self.lookupCuckooFilter(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+
+	previousSize := data.sizeInBytes()
+	if !exists {
+		filter = newCuckooFilter(CuckooConfig{
+			ErrorRate:     cuckooDefaultErrorRate,
+			Capacity:      cuckooDefaultCapacity,
+			BucketSize:    cuckooDefaultBucketSize,
+			MaxIterations: cuckooDefaultMaxIterations,
+			Expansion:     cuckooDefaultExpansion,
+		})
+		data = keyStorage{
+			lastAccessTime: time.Now(),
+			expiresAt:      time.Time{},
+			value:          nil,
+			object:         filter,
+			valueShared:    false,
+		}
+	}
+
+	filter.add(cmd.Item)
+
+	data.lastAccessTime = time.Now()
+	self.storeKey(cmd.Key, previousSize, data)
+}
+
+func (self *slotStorage) handleCommandCFDel(cmd commandCFDel) {
+	data, filter, exists, wrongType := self.lookupCuckooFilter(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	cmd.Resp.Deleted = filter.delete(cmd.Item)
+
+	data.lastAccessTime = time.Now()
+	if cmd.Resp.Deleted {
+		self.storeKey(cmd.Key, data.sizeInBytes(), data)
+	} else {
+		self.storage[cmd.Key] = data
+	}
+}
+
+func (self *slotStorage) handleCommandCFExists(cmd commandCFExists) {
+	data, filter, exists, wrongType := self.lookupCuckooFilter(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+	cmd.Resp.Exists = filter.contains(cmd.Item)
+}
+
+// cuckooFilter that scales by adding a new layer each time an item cannot be placed in the last layer.
+// A fingerprint of zero marks an empty entry.
+type cuckooFilter struct {
+	layers          []*cuckooLayer
+	config          CuckooConfig
+	fingerprintBits int
+}
+
+func newCuckooFilter(config CuckooConfig) *cuckooFilter {
+	// The false positive rate is about 2 * bucketSize / 2^fingerprintBits.
+	fingerprintBits := int(math.Ceil(math.Log2(2 * float64(config.BucketSize) / config.ErrorRate)))
+
+	return &cuckooFilter{
+		layers:          []*cuckooLayer{newCuckooLayer(config.Capacity, config.BucketSize)},
+		config:          config,
+		fingerprintBits: min(max(fingerprintBits, 1), cuckooMaxFingerprintBits),
+	}
+}
+
+func (self *cuckooFilter) valueType() ValueType {
+	return ValueTypeCuckooFilter
+}
+
+func (self *cuckooFilter) sizeInBytes() int64 {
+	var size int64
+	for _, layer := range self.layers {
+		size += int64(len(layer.fingerprints))*2 + cuckooLayerOverhead
+	}
+	return size
+}
+
+// hashItem into its fingerprint and the hash used to find its primary bucket.
+func (self *cuckooFilter) hashItem(item []byte) (uint16, uint64) {
+	itemHash := murmurHash64A(item, cuckooHashSeed)
+	fingerprint := uint16((itemHash>>32)%((1<<self.fingerprintBits)-1)) + 1 //nolint:gosec // reason: fingerprint is at most 16 bits
+	return fingerprint, itemHash
+}
+
+func (self *cuckooFilter) contains(item []byte) bool {
+	fingerprint, itemHash := self.hashItem(item)
+	for _, layer := range self.layers {
+		if layer.find(fingerprint, itemHash) != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *cuckooFilter) add(item []byte) {
+	fingerprint, itemHash := self.hashItem(item)
+	if self.layers[len(self.layers)-1].insert(fingerprint, itemHash, self.config.MaxIterations) {
+		return
+	}
+
+	layer := self.layers[len(self.layers)-1]
+	// Layers stop growing at the largest capacity, so that the filter keeps scaling in layers of bounded size.
+	capacity := min(int64(len(layer.fingerprints))*self.config.Expansion, cuckooMaxCapacity)
+	layer = newCuckooLayer(capacity, self.config.BucketSize)
+	self.layers = append(self.layers, layer)
+	layer.insert(fingerprint, itemHash, self.config.MaxIterations)
+}
+
+// delete one occurrence of the item, searching the newest layers first.
+func (self *cuckooFilter) delete(item []byte) bool {
+	fingerprint, itemHash := self.hashItem(item)
+	for index := len(self.layers) - 1; index >= 0; index-- {
+		if entry := self.layers[index].find(fingerprint, itemHash); entry != -1 {
+			self.layers[index].fingerprints[entry] = 0
+			return true
+		}
+	}
+	return false
+}
+
+type cuckooLayer struct {
+	fingerprints []uint16
+	bucketMask   uint64
+	bucketSize   uint64
+}
+
+func newCuckooLayer(capacity int64, bucketSize int64) *cuckooLayer {
+	// The number of buckets is a power of two so that the alternate bucket can be found from either bucket.
+	numBuckets := uint64(1) << bits.Len64(uint64((capacity+bucketSize-1)/bucketSize)-1) //nolint:gosec // reason: capacity and bucket size are positive
+
+	return &cuckooLayer{
+		fingerprints: make([]uint16, numBuckets*uint64(bucketSize)), //nolint:gosec // reason: bucket size is positive
+		bucketMask:   numBuckets - 1,
+		bucketSize:   uint64(bucketSize), //nolint:gosec // reason: bucket size is positive
+	}
+}
+
+func (self *cuckooLayer) buckets(fingerprint uint16, itemHash uint64) (uint64, uint64) {
+	bucket := itemHash & self.bucketMask
+	return bucket, self.alternateBucket(bucket, fingerprint)
+}
+
+func (self *cuckooLayer) alternateBucket(bucket uint64, fingerprint uint16) uint64 {
+	return (bucket ^ (uint64(fingerprint) * cuckooFingerprintMultiplier)) & self.bucketMask
+}
+
+// find the entry index of the fingerprint, or -1 if it does not exist.
+func (self *cuckooLayer) find(fingerprint uint16, itemHash uint64) int {
+	bucket1, bucket2 := self.buckets(fingerprint, itemHash)
+	for _, bucket := range []uint64{bucket1, bucket2} {
+		for entry := bucket * self.bucketSize; entry < (bucket+1)*self.bucketSize; entry++ {
+			if self.fingerprints[entry] == fingerprint {
+				return int(entry) //nolint:gosec // reason: entry is within the fingerprints slice
+			}
+		}
+	}
+	return -1
+}
+
+// insertIntoBucket returns false if the bucket is full.
+func (self *cuckooLayer) insertIntoBucket(bucket uint64, fingerprint uint16) bool {
+	for entry := bucket * self.bucketSize; entry < (bucket+1)*self.bucketSize; entry++ {
+		if self.fingerprints[entry] == 0 {
+			self.fingerprints[entry] = fingerprint
+			return true
+		}
+	}
+	return false
+}
+
+// insert the fingerprint, moving existing fingerprints to their alternate buckets to make room if necessary.
+// Returns false if there is no room, in which case the layer is left unchanged.
+func (self *cuckooLayer) insert(fingerprint uint16, itemHash uint64, maxIterations int64) bool {
+	bucket1, bucket2 := self.buckets(fingerprint, itemHash)
+	if self.insertIntoBucket(bucket1, fingerprint) || self.insertIntoBucket(bucket2, fingerprint) {
+		return true
+	}
+
+	type kick struct {
+		entry       uint64
+		fingerprint uint16
+	}
+	kicks := make([]kick, 0, maxIterations)
+
+	bucket := bucket1
+	if rand.IntN(2) == 0 { //nolint:gosec // reason: randomness does not need to be secure
+		bucket = bucket2
+	}
+
+	for range maxIterations {
+		entry := bucket*self.bucketSize + rand.Uint64N(self.bucketSize) //nolint:gosec // reason: randomness does not need to be secure
+		kicks = append(kicks, kick{
+			entry:       entry,
+			fingerprint: self.fingerprints[entry],
+		})
+		fingerprint, self.fingerprints[entry] = self.fingerprints[entry], fingerprint
+
+		bucket = self.alternateBucket(bucket, fingerprint)
+		if self.insertIntoBucket(bucket, fingerprint) {
+			return true
+		}
+	}
+
+	// Undo the moves so that no fingerprint is lost.
+	for index := len(kicks) - 1; index >= 0; index-- {
+		self.fingerprints[kicks[index].entry] = kicks[index].fingerprint
+	}
+
+	return false
+}
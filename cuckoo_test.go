@@ -0,0 +1,134 @@
+package datkey_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_CFAdd_CFExists_CFDel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.CFExists(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+
+	{
+		require.Nil(t, client.CFAdd(ctx, "test", []byte("a")))
+		require.Nil(t, client.CFAdd(ctx, "test", []byte("a")))
+		assert.Equal(t, datkey.ValueTypeCuckooFilter, typeOf(t, client, "test").Type)
+	}
+
+	{
+		result, err := client.CFExists(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+	}
+
+	{
+		// Each occurrence must be deleted.
+		result, err := client.CFDel(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.True(t, result.Deleted)
+
+		exists, existsErr := client.CFExists(ctx, "test", []byte("a"))
+		require.Nil(t, existsErr)
+		assert.True(t, exists.Exists)
+
+		result, err = client.CFDel(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.True(t, result.Deleted)
+
+		exists, existsErr = client.CFExists(ctx, "test", []byte("a"))
+		require.Nil(t, existsErr)
+		assert.False(t, exists.Exists)
+	}
+
+	{
+		result, err := client.CFDel(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.False(t, result.Deleted)
+	}
+
+	{
+		client.Set(ctx, "string", []byte("value"), 0)
+
+		_, err := client.CFExists(ctx, "string", []byte("a"))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadWrongType, err.Cause)
+	}
+}
+
+func TestDatkey_CFReserve(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		err := client.CFReserve(ctx, "test", datkey.CuckooConfig{ErrorRate: 0, Capacity: -1, BucketSize: 0, MaxIterations: 0, Expansion: 0})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	// Filters too large to allocate are rejected.
+	for _, invalid := range []datkey.CuckooConfig{
+		{ErrorRate: 0, Capacity: 1<<30 + 1, BucketSize: 0, MaxIterations: 0, Expansion: 0},
+		{ErrorRate: 0, Capacity: 0, BucketSize: 256, MaxIterations: 0, Expansion: 0},
+		{ErrorRate: 0, Capacity: 0, BucketSize: 0, MaxIterations: 65536, Expansion: 0},
+		{ErrorRate: 0, Capacity: 0, BucketSize: 0, MaxIterations: 0, Expansion: 32769},
+	} {
+		err := client.CFReserve(ctx, "test", invalid)
+		require.NotNil(t, err, invalid)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause, invalid)
+	}
+
+	{
+		err := client.CFReserve(ctx, "test", datkey.CuckooConfig{ErrorRate: 0.001, Capacity: 64, BucketSize: 4, MaxIterations: 0, Expansion: 2})
+		require.Nil(t, err)
+	}
+
+	{
+		err := client.CFReserve(ctx, "test", datkey.CuckooConfig{ErrorRate: 0, Capacity: 0, BucketSize: 0, MaxIterations: 0, Expansion: 0})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteKeyExists, err.Cause)
+	}
+
+	const items = 5000
+
+	// Adding well past the capacity scales the filter.
+	for index := range items {
+		require.Nil(t, client.CFAdd(ctx, "test", []byte("item:"+strconv.Itoa(index))))
+	}
+
+	for index := range items {
+		result, err := client.CFExists(ctx, "test", []byte("item:"+strconv.Itoa(index)))
+		require.Nil(t, err)
+		require.True(t, result.Exists)
+	}
+
+	var falsePositives int
+	for index := range items {
+		result, err := client.CFExists(ctx, "test", []byte("other:"+strconv.Itoa(index)))
+		require.Nil(t, err)
+		if result.Exists {
+			falsePositives++
+		}
+	}
+	// Each layer adds to the error rate, so allow for the number of layers.
+	assert.Less(t, float64(falsePositives)/items, 0.01)
+}
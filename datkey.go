@@ -2,8 +2,11 @@ package datkey
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"time"
 
+	"github.com/wspowell/datkey/hash"
 	"github.com/wspowell/datkey/lib/errors"
 )
 
@@ -20,6 +23,12 @@ type DbWriteErr errors.Cause
 const (
 	DbWriteInternal = DbWriteErr(iota)
 	DbWriteCanceled
+	DbWriteInvalidArgument
+	DbWriteWrongType
+	DbWriteKeyExists
+	DbWriteFilterFull
+	DbWriteRedirect
+	DbWriteReadOnly
 )
 
 type DbReadErr errors.Cause
@@ -27,6 +36,9 @@ type DbReadErr errors.Cause
 const (
 	DbReadInternal = DbReadErr(iota)
 	DbReadCanceled
+	DbReadInvalidArgument
+	DbReadWrongType
+	DbReadRedirect
 )
 
 type Config struct {
@@ -53,15 +65,85 @@ type Config struct {
 	// ExpirationFrequency time between iterations of checking for expired keys and freeing their memory.
 	// Default: 30s
 	ExpirationFrequency time.Duration
+
+	// SnapshotPath of the file keys are restored from on New and, if SnapshotInterval is set, periodically snapshotted to.
+	// Default: None (snapshots disabled)
+	SnapshotPath string
+
+	// SnapshotInterval time between snapshots to SnapshotPath. A final snapshot is taken on Close.
+	// Default: None (0, no periodic snapshots)
+	SnapshotInterval time.Duration
+
+	// AppendOnlyPath of the file every modification is logged to and replayed from on New.
+	// If the file exists, keys are restored from it instead of from SnapshotPath.
+	// Default: None (append only file disabled)
+	AppendOnlyPath string
+
+	// AppendFsync is how often the append only file is synced to disk.
+	// Default: AppendFsyncEverySec
+	AppendFsync AppendFsyncMode
+
+	// AppendOnlyRewriteMinBytes is the minimum size of the append only file before it is automatically rewritten.
+	// The file is rewritten once it doubles in size since the last rewrite.
+	// Default: 64MiB
+	AppendOnlyRewriteMinBytes int64
+
+	// PersistenceErrorHandler is called with any error restoring or writing the snapshot or append only file.
+	// Default: errors are ignored
+	PersistenceErrorHandler func(err error)
+
+	// ReplicationBacklogBytes of the most recent writes kept for replicas, so that a replica that reconnects within
+	// this many bytes of writes continues from where it left off rather than syncing every key again.
+	// Default: 1MiB
+	ReplicationBacklogBytes int
+
+	// ReplicationHeartbeatInterval between heartbeats sent to replicas, which replicas acknowledge with their offset.
+	// Replicas also wait this long before reconnecting to their primary.
+	// Default: 1s
+	ReplicationHeartbeatInterval time.Duration
+
+	// ReplicaWritable allows writes while the database replicates from a primary. Writes are not sent to the
+	// replicas of the replica and are overwritten by the primary.
+	// Default: false (writes fail with the ReadOnly cause)
+	ReplicaWritable bool
+
+	// ReplicationErrorHandler is called with any error replicating from a primary, after which the replica reconnects.
+	// Default: errors are ignored
+	ReplicationErrorHandler func(err error)
+
+	// Partitioner of keys into slots, which decides the slot count. Every node of a cluster, and its clients, must use
+	// the same partitioner. Slots from the slot count up to hash.MaxHashSlot store no keys.
+	// Default: hash.NewCRC16Partitioner(hash.MaxHashSlot), as Redis Cluster
+	Partitioner hash.Partitioner
+
+	// PubSubBufferSize of the messages buffered for each subscription, see Subscribe, before PubSubOverflow applies.
+	// Default: 1024
+	PubSubBufferSize int
+
+	// PubSubOverflow policy for messages published to a subscription whose buffer is full.
+	// Default: PubSubDrop
+	PubSubOverflow PubSubOverflow
+
+	// NotifyKeyspaceEvents of the types published to pub/sub, as notify-keyspace-events does in Redis. Each event is
+	// published to the channel "__keyspace@0__:<key>" with the event type as the message, and to the channel
+	// "__keyevent@0__:<type>" with the key as the message. Events are dropped for subscriptions whose buffer is full,
+	// whatever the PubSubOverflow.
+	// Default: None (events are not published, see WatchKeyspace)
+	NotifyKeyspaceEvents []KeyspaceEventType
 }
 
 type Datkey struct {
-	waitForEvictionWorker <-chan struct{}
-	waitForExpireWorker   <-chan struct{}
-
-	cache      cacheStorage
-	cancelFunc context.CancelFunc
-	config     Config
+	waitForEvictionWorker   <-chan struct{}
+	waitForExpireWorker     <-chan struct{}
+	waitForSnapshotWorker   <-chan struct{}
+	waitForAppendOnlyWorker <-chan struct{}
+
+	appendOnly  *appendOnlyFile
+	replication *replication
+	pubSub      *pubSub
+	cache       cacheStorage
+	cancelFunc  context.CancelFunc
+	config      Config
 }
 
 func New(config Config) *Datkey {
@@ -85,59 +167,202 @@ func New(config Config) *Datkey {
 		config.ExpirationFrequency = 30 * time.Second //nolint:mnd // reason: default value
 	}
 
-	cache := newCacheStorage(config.MaxConcurrency)
+	if config.AppendFsync == "" {
+		config.AppendFsync = AppendFsyncEverySec
+	}
+
+	switch config.AppendFsync {
+	case AppendFsyncAlways, AppendFsyncEverySec, AppendFsyncNo:
+	default:
+		panic(fmt.Sprintf("invalid append fsync mode: %s", config.AppendFsync))
+	}
+
+	if config.AppendOnlyRewriteMinBytes == 0 {
+		config.AppendOnlyRewriteMinBytes = appendOnlyDefaultRewriteMinBytes
+	}
+
+	if config.PersistenceErrorHandler == nil {
+		config.PersistenceErrorHandler = func(error) {}
+	}
+
+	if config.ReplicationBacklogBytes == 0 {
+		config.ReplicationBacklogBytes = replicationDefaultBacklogBytes
+	}
+
+	if config.ReplicationHeartbeatInterval == 0 {
+		config.ReplicationHeartbeatInterval = time.Second
+	}
+
+	if config.ReplicationErrorHandler == nil {
+		config.ReplicationErrorHandler = func(error) {}
+	}
+
+	if config.Partitioner == nil {
+		config.Partitioner = hash.NewCRC16Partitioner(int(hash.MaxHashSlot))
+	}
+
+	if config.PubSubBufferSize == 0 {
+		config.PubSubBufferSize = pubSubDefaultBufferSize
+	}
+
+	if config.PubSubOverflow == "" {
+		config.PubSubOverflow = PubSubDrop
+	}
+
+	switch config.PubSubOverflow {
+	case PubSubDrop, PubSubBlock:
+	default:
+		panic(fmt.Sprintf("invalid pub/sub overflow policy: %s", config.PubSubOverflow))
+	}
+
+	for _, eventType := range config.NotifyKeyspaceEvents {
+		if !validKeyspaceEventType(eventType) {
+			panic(fmt.Sprintf("invalid keyspace event type: %s", eventType))
+		}
+	}
+
+	pubSub := newPubSub(config)
+	cache := newCacheStorage(config.MaxConcurrency, config.Partitioner, newKeyspaceNotifier(pubSub, config.NotifyKeyspaceEvents))
+
+	var appendOnlyExists bool
+	if config.AppendOnlyPath != "" {
+		_, err := os.Stat(config.AppendOnlyPath)
+		appendOnlyExists = err == nil
+	}
+
+	if config.SnapshotPath != "" && !appendOnlyExists {
+		if err := readSnapshotFile(config.SnapshotPath, cache); err != nil {
+			config.PersistenceErrorHandler(err)
+		}
+	}
+
+	var appendOnly *appendOnlyFile
+	if config.AppendOnlyPath != "" {
+		appendOnly = openAppendOnlyFile(config, cache)
+		cache.setAppendOnly(appendOnly)
+	}
+
+	replication := newReplication(config)
+	cache.setBacklog(replication.backlog)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Datkey{
-		config:                config,
-		cache:                 cache,
-		cancelFunc:            cancel,
-		waitForEvictionWorker: startEvictionWorker(ctx, config, cache),
-		waitForExpireWorker:   startExpireWorker(ctx, config, cache),
+		config:                  config,
+		appendOnly:              appendOnly,
+		replication:             replication,
+		pubSub:                  pubSub,
+		cache:                   cache,
+		cancelFunc:              cancel,
+		waitForEvictionWorker:   startEvictionWorker(ctx, config, cache, replication),
+		waitForExpireWorker:     startExpireWorker(ctx, config, cache),
+		waitForSnapshotWorker:   startSnapshotWorker(ctx, config, cache),
+		waitForAppendOnlyWorker: startAppendOnlyWorker(ctx, config, appendOnly),
 	}
 }
 
+// Close stops all background workers. If periodic snapshots are enabled, this waits for the final snapshot to be written.
+// If the append only file is enabled, this waits for it to be synced and closed. A replica stops replicating.
 func (self *Datkey) Close() {
+	self.replication.stop()
 	self.cancelFunc()
+	<-self.waitForSnapshotWorker
+	<-self.waitForAppendOnlyWorker
 }
 
 // Set a key in the database.
 // If ttl=0, then the key will never expire.
-func (self *Datkey) Set(key string, value []byte, ttl time.Duration) SetResponse {
-	return setKey(key, value, ttl, self.cache)
+func (self *Datkey) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (SetResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return SetResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return setKey(key, value, ttl, self.cache.forContext(ctx))
 }
 
 // Delete a key in the database.
-func (self *Datkey) Delete(key string) DeleteResponse {
-	return deleteKey(key, self.cache)
+func (self *Datkey) Delete(ctx context.Context, key string) (DeleteResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return DeleteResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return deleteKey(key, self.cache.forContext(ctx))
+}
+
+// GetDel deletes a key from the database and returns its value.
+// Returns DbWriteWrongType, without deleting the key, if the key does not hold a string value.
+func (self *Datkey) GetDel(ctx context.Context, key string) (DeleteResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return DeleteResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return getDelKey(key, self.cache.forContext(ctx))
 }
 
 // Get a key from the database.
-func (self *Datkey) Get(key string) GetResponse {
-	return getKey(key, self.cache)
+// Returns DbReadWrongType if the key does not hold a string value.
+func (self *Datkey) Get(ctx context.Context, key string) (GetResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return GetResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return getKey(key, self.cache.forContext(ctx))
 }
 
 // Expire a key in the database in a given TTL.
-func (self *Datkey) Expire(key string, ttl time.Duration) ExpireResponse {
-	return expireKey(key, ttl, self.cache)
+func (self *Datkey) Expire(ctx context.Context, key string, ttl time.Duration) (ExpireResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return ExpireResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return expireKey(key, ttl, self.cache.forContext(ctx))
 }
 
 // Persist a key in the database by removing any TTL.
-func (self *Datkey) Persist(key string) PersistResponse {
-	return persistKey(key, self.cache)
+func (self *Datkey) Persist(ctx context.Context, key string) (PersistResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return PersistResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return persistKey(key, self.cache.forContext(ctx))
 }
 
 // Ttl value of a key in the database.
-func (self *Datkey) Ttl(key string) TtlResponse {
-	return ttlKey(key, self.cache)
+func (self *Datkey) Ttl(ctx context.Context, key string) (TtlResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return TtlResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return ttlKey(key, self.cache.forContext(ctx))
 }
 
 // Ping the database.
-func (_ *Datkey) Ping() *errors.Error[DbReadErr] {
+func (_ *Datkey) Ping(ctx context.Context) *errors.Error[DbReadErr] {
+	return readCanceled(ctx)
+}
+
+func (self *Datkey) Stats(_ context.Context) StatsResponse {
+	stats := getDbStats(self.cache)
+	stats.Replication = self.replication.stats()
+	return stats
+}
+
+// readCanceled if the context is done before a read is run.
+func readCanceled(ctx context.Context) *errors.Error[DbReadErr] {
+	if err := ctx.Err(); err != nil {
+		return errors.NewFromError(DbReadCanceled, err)
+	}
 	return nil
 }
 
-func (self *Datkey) Stats() StatsResponse {
-	return getDbStats(self.cache)
+// writeAllowed if the context is not done and the database is not a read-only replica.
+func (self *Datkey) writeAllowed(ctx context.Context) *errors.Error[DbWriteErr] {
+	if err := writeCanceled(ctx); err != nil {
+		return err
+	}
+	if self.replication.readOnly() {
+		return errors.New(DbWriteReadOnly, "write against a read-only replica")
+	}
+	return nil
+}
+
+// writeCanceled if the context is done before a write is run.
+func writeCanceled(ctx context.Context) *errors.Error[DbWriteErr] {
+	if err := ctx.Err(); err != nil {
+		return errors.NewFromError(DbWriteCanceled, err)
+	}
+	return nil
 }
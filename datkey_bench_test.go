@@ -1,6 +1,7 @@
 package datkey_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -28,6 +29,7 @@ func generateGuids() []string {
 }
 
 func BenchmarkDatKeySet_sync(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -37,13 +39,14 @@ func BenchmarkDatKeySet_sync(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_ = client.Set("test", data, 0)
+		_, _ = client.Set(ctx, "test", data, 0)
 	}
 
 	b.StopTimer()
 }
 
 func BenchmarkDatKeySet_async(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -54,7 +57,7 @@ func BenchmarkDatKeySet_async(b *testing.B) {
 
 	b.RunParallel(func(p *testing.PB) {
 		for p.Next() {
-			_ = client.Set("test", data, 0)
+			_, _ = client.Set(ctx, "test", data, 0)
 		}
 	})
 
@@ -62,6 +65,7 @@ func BenchmarkDatKeySet_async(b *testing.B) {
 }
 
 func BenchmarkDatKeySet_multikey_sync(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -72,7 +76,7 @@ func BenchmarkDatKeySet_multikey_sync(b *testing.B) {
 
 	var idIndex int
 	for i := 0; i < b.N; i++ {
-		_ = client.Set(guids[idIndex], data, 0)
+		_, _ = client.Set(ctx, guids[idIndex], data, 0)
 		idIndex++
 	}
 
@@ -80,6 +84,7 @@ func BenchmarkDatKeySet_multikey_sync(b *testing.B) {
 }
 
 func BenchmarkDatKeySet_multikey_async(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -91,7 +96,7 @@ func BenchmarkDatKeySet_multikey_async(b *testing.B) {
 	b.RunParallel(func(p *testing.PB) {
 		var idIndex int
 		for p.Next() {
-			_ = client.Set(guids[idIndex], data, 0)
+			_, _ = client.Set(ctx, guids[idIndex], data, 0)
 			idIndex++
 		}
 	})
@@ -100,33 +105,35 @@ func BenchmarkDatKeySet_multikey_async(b *testing.B) {
 }
 
 func BenchmarkDatKeyGet_sync(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
-	_ = client.Set("test", []byte("value"), 0)
+	_, _ = client.Set(ctx, "test", []byte("value"), 0)
 
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_ = client.Get("test")
+		_, _ = client.Get(ctx, "test")
 	}
 
 	b.StopTimer()
 }
 
 func BenchmarkDatKeyGet_async(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
-	_ = client.Set("test", []byte("value"), 0)
+	_, _ = client.Set(ctx, "test", []byte("value"), 0)
 
 	b.ResetTimer()
 
 	b.RunParallel(func(p *testing.PB) {
 		for p.Next() {
-			_ = client.Get("test")
+			_, _ = client.Get(ctx, "test")
 		}
 	})
 
@@ -134,19 +141,20 @@ func BenchmarkDatKeyGet_async(b *testing.B) {
 }
 
 func BenchmarkDatKeyGet_multikey_sync(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	for index := range guids {
-		_ = client.Set(guids[index], []byte("value"), 0)
+		_, _ = client.Set(ctx, guids[index], []byte("value"), 0)
 	}
 
 	b.ResetTimer()
 
 	var idIndex int
 	for i := 0; i < b.N; i++ {
-		_ = client.Get(guids[idIndex])
+		_, _ = client.Get(ctx, guids[idIndex])
 		idIndex++
 	}
 
@@ -154,12 +162,13 @@ func BenchmarkDatKeyGet_multikey_sync(b *testing.B) {
 }
 
 func BenchmarkDatKeyGet_multikey_async(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	for index := range guids {
-		_ = client.Set(guids[index], []byte("value"), 0)
+		_, _ = client.Set(ctx, guids[index], []byte("value"), 0)
 	}
 
 	b.ResetTimer()
@@ -167,7 +176,7 @@ func BenchmarkDatKeyGet_multikey_async(b *testing.B) {
 	b.RunParallel(func(p *testing.PB) {
 		var idIndex int
 		for p.Next() {
-			_ = client.Get(guids[idIndex])
+			_, _ = client.Get(ctx, guids[idIndex])
 			idIndex++
 		}
 	})
@@ -176,6 +185,7 @@ func BenchmarkDatKeyGet_multikey_async(b *testing.B) {
 }
 
 func BenchmarkDatKeySet_sync_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -185,13 +195,14 @@ func BenchmarkDatKeySet_sync_with_TTL(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_ = client.Set("test", data, time.Second)
+		_, _ = client.Set(ctx, "test", data, time.Second)
 	}
 
 	b.StopTimer()
 }
 
 func BenchmarkDatKeySet_async_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -202,7 +213,7 @@ func BenchmarkDatKeySet_async_with_TTL(b *testing.B) {
 
 	b.RunParallel(func(p *testing.PB) {
 		for p.Next() {
-			_ = client.Set("test", data, time.Second)
+			_, _ = client.Set(ctx, "test", data, time.Second)
 		}
 	})
 
@@ -210,6 +221,7 @@ func BenchmarkDatKeySet_async_with_TTL(b *testing.B) {
 }
 
 func BenchmarkDatKeySet_multikey_sync_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -220,7 +232,7 @@ func BenchmarkDatKeySet_multikey_sync_with_TTL(b *testing.B) {
 
 	var idIndex int
 	for i := 0; i < b.N; i++ {
-		_ = client.Set(guids[idIndex], data, time.Second)
+		_, _ = client.Set(ctx, guids[idIndex], data, time.Second)
 		idIndex++
 	}
 
@@ -228,6 +240,7 @@ func BenchmarkDatKeySet_multikey_sync_with_TTL(b *testing.B) {
 }
 
 func BenchmarkDatKeySet_multikey_async_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -239,7 +252,7 @@ func BenchmarkDatKeySet_multikey_async_with_TTL(b *testing.B) {
 	b.RunParallel(func(p *testing.PB) {
 		var idIndex int
 		for p.Next() {
-			_ = client.Set(guids[idIndex], data, time.Second)
+			_, _ = client.Set(ctx, guids[idIndex], data, time.Second)
 			idIndex++
 		}
 	})
@@ -248,33 +261,35 @@ func BenchmarkDatKeySet_multikey_async_with_TTL(b *testing.B) {
 }
 
 func BenchmarkDatKeyGet_sync_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
-	_ = client.Set("test", []byte("value"), time.Second)
+	_, _ = client.Set(ctx, "test", []byte("value"), time.Second)
 
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_ = client.Get("test")
+		_, _ = client.Get(ctx, "test")
 	}
 
 	b.StopTimer()
 }
 
 func BenchmarkDatKeyGet_async_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
-	_ = client.Set("test", []byte("value"), time.Second)
+	_, _ = client.Set(ctx, "test", []byte("value"), time.Second)
 
 	b.ResetTimer()
 
 	b.RunParallel(func(p *testing.PB) {
 		for p.Next() {
-			_ = client.Get("test")
+			_, _ = client.Get(ctx, "test")
 		}
 	})
 
@@ -282,19 +297,20 @@ func BenchmarkDatKeyGet_async_with_TTL(b *testing.B) {
 }
 
 func BenchmarkDatKeyGet_multikey_sync_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	for index := range guids {
-		_ = client.Set(guids[index], []byte("value"), time.Second)
+		_, _ = client.Set(ctx, guids[index], []byte("value"), time.Second)
 	}
 
 	b.ResetTimer()
 
 	var idIndex int
 	for i := 0; i < b.N; i++ {
-		_ = client.Get(guids[idIndex])
+		_, _ = client.Get(ctx, guids[idIndex])
 		idIndex++
 	}
 
@@ -302,12 +318,13 @@ func BenchmarkDatKeyGet_multikey_sync_with_TTL(b *testing.B) {
 }
 
 func BenchmarkDatKeyGet_multikey_async_with_TTL(b *testing.B) {
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	for index := range guids {
-		_ = client.Set(guids[index], []byte("value"), time.Second)
+		_, _ = client.Set(ctx, guids[index], []byte("value"), time.Second)
 	}
 
 	b.ResetTimer()
@@ -315,7 +332,7 @@ func BenchmarkDatKeyGet_multikey_async_with_TTL(b *testing.B) {
 	b.RunParallel(func(p *testing.PB) {
 		var idIndex int
 		for p.Next() {
-			_ = client.Get(guids[idIndex])
+			_, _ = client.Get(ctx, guids[idIndex])
 			idIndex++
 		}
 	})
@@ -1,43 +1,86 @@
 package datkey_test
 
 import (
+	"context"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/wspowell/datkey"
 )
 
+func typeOf(t *testing.T, client *datkey.Datkey, key string) datkey.TypeResponse {
+	t.Helper()
+
+	ctx := context.Background()
+	result, err := client.Type(ctx, key)
+	require.Nil(t, err)
+	return result
+}
+
 func TestDatkey_Ping(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	{
-		err := client.Ping()
+		err := client.Ping(ctx)
 		assert.Nil(t, err)
 	}
 }
 
+func TestDatkey_canceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		_, err := client.Set(ctx, "test", []byte("value"), 0)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteCanceled, err.Cause)
+	}
+
+	{
+		_, err := client.Get(ctx, "test")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadCanceled, err.Cause)
+	}
+
+	{
+		result, err := client.Get(context.Background(), "test")
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+}
+
 func TestDatkey_Set_Get(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	{
-		result := client.Set("test", []byte("value"), 0)
+		result, err := client.Set(ctx, "test", []byte("value"), 0)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Get("test")
+		result, err := client.Get(ctx, "test")
+		assert.Nil(t, err)
 		assert.True(t, result.Exists)
 		assert.Equal(t, []byte("value"), result.Value)
 	}
@@ -46,19 +89,22 @@ func TestDatkey_Set_Get(t *testing.T) {
 func TestDatkey_Set_ttl_Get(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	ttl := time.Second
 	{
-		result := client.Set("test", []byte("value"), ttl)
+		result, err := client.Set(ctx, "test", []byte("value"), ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Get("test")
+		result, err := client.Get(ctx, "test")
+		assert.Nil(t, err)
 		assert.True(t, result.Exists)
 		assert.Equal(t, []byte("value"), result.Value)
 	}
@@ -67,13 +113,15 @@ func TestDatkey_Set_ttl_Get(t *testing.T) {
 func TestDatkey_Set_ttl_Expire(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	ttl := time.Second
 	{
-		result := client.Set("test", []byte("value"), ttl)
+		result, err := client.Set(ctx, "test", []byte("value"), ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -81,7 +129,8 @@ func TestDatkey_Set_ttl_Expire(t *testing.T) {
 	time.Sleep(ttl)
 
 	{
-		result := client.Expire("test", ttl)
+		result, err := client.Expire(ctx, "test", ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 	}
 }
@@ -89,6 +138,7 @@ func TestDatkey_Set_ttl_Expire(t *testing.T) {
 func TestDatkey_Set_ttl_Expire_race(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -96,7 +146,8 @@ func TestDatkey_Set_ttl_Expire_race(t *testing.T) {
 	value := []byte("value")
 	ttl := time.Second
 	{
-		result := client.Set("test", value, ttl)
+		result, err := client.Set(ctx, "test", value, ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -107,7 +158,8 @@ func TestDatkey_Set_ttl_Expire_race(t *testing.T) {
 		case <-done:
 			return
 		default:
-			result := client.Get("test")
+			result, err := client.Get(ctx, "test")
+			assert.Nil(t, err)
 			if result.Exists {
 				assert.Equal(t, value, result.Value)
 			} else {
@@ -120,13 +172,15 @@ func TestDatkey_Set_ttl_Expire_race(t *testing.T) {
 func TestDatkey_Set_ttl_Get_expired(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	ttl := time.Second
 	{
-		result := client.Set("test", []byte("value"), ttl)
+		result, err := client.Set(ctx, "test", []byte("value"), ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -135,7 +189,8 @@ func TestDatkey_Set_ttl_Get_expired(t *testing.T) {
 	time.Sleep(ttl)
 
 	{
-		result := client.Get("test")
+		result, err := client.Get(ctx, "test")
+		assert.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.Value)
 	}
@@ -144,24 +199,28 @@ func TestDatkey_Set_ttl_Get_expired(t *testing.T) {
 func TestDatkey_Set_Expire_Get_expired(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	ttl := time.Second
 	{
-		result := client.Set("test", []byte("value"), 0)
+		result, err := client.Set(ctx, "test", []byte("value"), 0)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Expire("test", ttl)
+		result, err := client.Expire(ctx, "test", ttl)
+		require.Nil(t, err)
 		assert.True(t, result.Exists)
 	}
 
 	{
-		result := client.Get("test")
+		result, err := client.Get(ctx, "test")
+		assert.Nil(t, err)
 		assert.True(t, result.Exists)
 		assert.Equal(t, []byte("value"), result.Value)
 	}
@@ -170,7 +229,8 @@ func TestDatkey_Set_Expire_Get_expired(t *testing.T) {
 	time.Sleep(ttl)
 
 	{
-		result := client.Get("test")
+		result, err := client.Get(ctx, "test")
+		assert.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.Value)
 	}
@@ -179,23 +239,27 @@ func TestDatkey_Set_Expire_Get_expired(t *testing.T) {
 func TestDatkey_Set_Expire0_Get_expired(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	{
-		result := client.Set("test", []byte("value"), 0)
+		result, err := client.Set(ctx, "test", []byte("value"), 0)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Expire("test", 0)
+		result, err := client.Expire(ctx, "test", 0)
+		require.Nil(t, err)
 		assert.True(t, result.Exists)
 	}
 
 	{
-		result := client.Get("test")
+		result, err := client.Get(ctx, "test")
+		assert.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.Value)
 	}
@@ -204,13 +268,15 @@ func TestDatkey_Set_Expire0_Get_expired(t *testing.T) {
 func TestDatkey_Set_ttl_Set_expired(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	ttl := time.Second
 	{
-		result := client.Set("test", []byte("value"), ttl)
+		result, err := client.Set(ctx, "test", []byte("value"), ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -218,7 +284,8 @@ func TestDatkey_Set_ttl_Set_expired(t *testing.T) {
 	time.Sleep(ttl)
 
 	{
-		result := client.Set("test", []byte("value"), ttl)
+		result, err := client.Set(ctx, "test", []byte("value"), ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -227,26 +294,37 @@ func TestDatkey_Set_ttl_Set_expired(t *testing.T) {
 func TestDatkey_Set_ttl_Persist(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	ttl := time.Second
 	{
-		result := client.Set("test", []byte("value"), ttl)
+		result, err := client.Set(ctx, "test", []byte("value"), ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Persist("test")
-		assert.True(t, result.Exists)
+		result, err := client.Persist(ctx, "test")
+		require.Nil(t, err)
+		assert.Equal(t, datkey.PersistResponse{Exists: true, Persisted: true}, result)
+	}
+
+	{
+		// A key without a TTL is not persisted again.
+		result, err := client.Persist(ctx, "test")
+		require.Nil(t, err)
+		assert.Equal(t, datkey.PersistResponse{Exists: true, Persisted: false}, result)
 	}
 
 	time.Sleep(ttl)
 
 	{
-		result := client.Get("test")
+		result, err := client.Get(ctx, "test")
+		assert.Nil(t, err)
 		assert.True(t, result.Exists)
 	}
 }
@@ -254,43 +332,50 @@ func TestDatkey_Set_ttl_Persist(t *testing.T) {
 func TestDatkey_Set_ttl_Persist_Ttl(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	ttl := time.Second
 	{
-		result := client.Set("test", []byte("value"), ttl)
+		result, err := client.Set(ctx, "test", []byte("value"), ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Ttl("test")
+		result, err := client.Ttl(ctx, "test")
+		require.Nil(t, err)
 		assert.True(t, result.Exists)
 		assert.NotZero(t, result.Ttl)
 	}
 
 	{
-		result := client.Persist("test")
+		result, err := client.Persist(ctx, "test")
+		require.Nil(t, err)
 		assert.True(t, result.Exists)
 	}
 
 	{
-		result := client.Ttl("test")
+		result, err := client.Ttl(ctx, "test")
+		require.Nil(t, err)
 		assert.True(t, result.Exists)
 		assert.Zero(t, result.Ttl)
 	}
 
 	{
-		result := client.Expire("test", time.Second)
+		result, err := client.Expire(ctx, "test", time.Second)
+		require.Nil(t, err)
 		assert.True(t, result.Exists)
 	}
 
 	time.Sleep(time.Second)
 
 	{
-		result := client.Ttl("test")
+		result, err := client.Ttl(ctx, "test")
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Zero(t, result.Ttl)
 	}
@@ -299,33 +384,39 @@ func TestDatkey_Set_ttl_Persist_Ttl(t *testing.T) {
 func TestDatkey_Delete(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
 
 	{
-		result := client.Delete("test")
+		result, err := client.Delete(ctx, "test")
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 	}
 
 	{
-		result := client.Set("test", []byte("value"), 0)
+		result, err := client.Set(ctx, "test", []byte("value"), 0)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Delete("test")
+		result, err := client.Delete(ctx, "test")
+		require.Nil(t, err)
 		assert.True(t, result.Exists)
 	}
 
 	{
-		result := client.Delete("test")
+		result, err := client.Delete(ctx, "test")
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 	}
 
 	{
-		result := client.Set("test", []byte("value"), time.Second)
+		result, err := client.Set(ctx, "test", []byte("value"), time.Second)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -333,14 +424,50 @@ func TestDatkey_Delete(t *testing.T) {
 	time.Sleep(time.Second)
 
 	{
-		result := client.Delete("test")
+		result, err := client.Delete(ctx, "test")
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 	}
 }
 
+func TestDatkey_GetDel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.GetDel(ctx, "test")
+		require.Nil(t, err)
+		assert.Equal(t, datkey.DeleteResponse{DeletedValue: nil, Exists: false}, result)
+	}
+
+	{
+		_, err := client.Set(ctx, "test", []byte("value"), 0)
+		require.Nil(t, err)
+		result, getDelErr := client.GetDel(ctx, "test")
+		require.Nil(t, getDelErr)
+		assert.Equal(t, datkey.DeleteResponse{DeletedValue: []byte("value"), Exists: true}, result)
+		assert.False(t, typeOf(t, client, "test").Exists)
+	}
+
+	{
+		// Keys that do not hold a string are kept.
+		_, err := client.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1})
+		require.Nil(t, err)
+		_, getDelErr := client.GetDel(ctx, "zset")
+		require.NotNil(t, getDelErr)
+		assert.Equal(t, datkey.DbWriteWrongType, getDelErr.Cause)
+		assert.True(t, typeOf(t, client, "zset").Exists)
+	}
+}
+
 func TestDatkey_deleteExpired(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	config.ExpirationFrequency = time.Second
 	client := datkey.New(config)
@@ -349,20 +476,21 @@ func TestDatkey_deleteExpired(t *testing.T) {
 	value := []byte("value")
 	ttl := time.Second
 	{
-		result := client.Set("test", value, ttl)
+		result, err := client.Set(ctx, "test", value, ttl)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
 
 	{
-		result := client.Stats()
+		result := client.Stats(ctx)
 		assert.Equal(t, int64(len(value)), result.DbSizeInBytes)
 	}
 
 	time.Sleep(ttl + 5*time.Second)
 
 	{
-		result := client.Stats()
+		result := client.Stats(ctx)
 		assert.Zero(t, result.DbSizeInBytes)
 	}
 }
@@ -370,6 +498,7 @@ func TestDatkey_deleteExpired(t *testing.T) {
 func TestDatkey_Stats(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	var config datkey.Config
 	client := datkey.New(config)
 	defer client.Close()
@@ -377,29 +506,29 @@ func TestDatkey_Stats(t *testing.T) {
 	var expectedDbSizeBytes int64
 
 	{
-		result := client.Stats()
+		result := client.Stats(ctx)
 		assert.Equal(t, expectedDbSizeBytes, result.DbSizeInBytes)
 	}
 
 	{
 		value := []byte("value")
 		expectedDbSizeBytes += int64(len(value))
-		_ = client.Set("test", value, 0)
+		_, _ = client.Set(ctx, "test", value, 0)
 	}
 
 	{
-		result := client.Stats()
+		result := client.Stats(ctx)
 		assert.Equal(t, expectedDbSizeBytes, result.DbSizeInBytes)
 	}
 
 	{
 		value := []byte("updatedValue")
 		expectedDbSizeBytes += int64(len(value) - len([]byte("value")))
-		_ = client.Set("test", value, 0)
+		_, _ = client.Set(ctx, "test", value, 0)
 	}
 
 	{
-		result := client.Stats()
+		result := client.Stats(ctx)
 		assert.Equal(t, expectedDbSizeBytes, result.DbSizeInBytes)
 	}
 }
@@ -407,6 +536,7 @@ func TestDatkey_Stats(t *testing.T) {
 func TestDatkey_No_Eviction(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	config := datkey.Config{
 		EvictStrategy:         datkey.EvictDisabled,
 		DbBytesEvictThreshold: 50,
@@ -419,7 +549,8 @@ func TestDatkey_No_Eviction(t *testing.T) {
 	defer client.Close()
 
 	for i := range 10 {
-		result := client.Set(strconv.Itoa(i), []byte("1234567890"), 0)
+		result, err := client.Set(ctx, strconv.Itoa(i), []byte("1234567890"), 0)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -427,13 +558,14 @@ func TestDatkey_No_Eviction(t *testing.T) {
 	// Give the LRU worker some time to process.
 	time.Sleep(5 * time.Second)
 
-	result := client.Stats()
+	result := client.Stats(ctx)
 	assert.Equal(t, int64(100), result.DbSizeInBytes)
 }
 
 func TestDatkey_LRU_Eviction(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
 	config := datkey.Config{
 		EvictStrategy:         datkey.EvictByLRU,
 		DbBytesEvictThreshold: 50,
@@ -446,7 +578,8 @@ func TestDatkey_LRU_Eviction(t *testing.T) {
 	defer client.Close()
 
 	for i := range 10 {
-		result := client.Set(strconv.Itoa(i), []byte("1234567890"), 0)
+		result, err := client.Set(ctx, strconv.Itoa(i), []byte("1234567890"), 0)
+		require.Nil(t, err)
 		assert.False(t, result.Exists)
 		assert.Nil(t, result.PreviousValue)
 	}
@@ -454,6 +587,6 @@ func TestDatkey_LRU_Eviction(t *testing.T) {
 	// Give the LRU worker some time to process.
 	time.Sleep(config.EvictionFrequency * 2)
 
-	result := client.Stats()
+	result := client.Stats(ctx)
 	assert.LessOrEqual(t, result.DbSizeInBytes, config.DbBytesEvictThreshold)
 }
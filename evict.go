@@ -8,7 +8,7 @@ import (
 	"github.com/wspowell/datkey/hash"
 )
 
-func startEvictionWorker(ctx context.Context, config Config, cache cacheStorage) <-chan struct{} {
+func startEvictionWorker(ctx context.Context, config Config, cache cacheStorage, replication *replication) <-chan struct{} {
 	if config.DbBytesEvictThreshold == 0 {
 		// Do not run any eviction worker.
 		done := make(chan struct{})
@@ -18,7 +18,7 @@ func startEvictionWorker(ctx context.Context, config Config, cache cacheStorage)
 
 	switch config.EvictStrategy {
 	case EvictByLRU:
-		return lruEviction(ctx, config, cache)
+		return lruEviction(ctx, config, cache, replication)
 	case EvictByTTL:
 		panic("EvictByTTL is not implemented")
 	case EvictDisabled:
@@ -43,7 +43,7 @@ func startExpireWorker(ctx context.Context, config Config, cache cacheStorage) <
 			}
 
 			nextHashSlot++
-			if nextHashSlot >= hash.MaxHashSlot {
+			if nextHashSlot >= cache.slotCount() {
 				nextHashSlot = 0
 			}
 
@@ -60,7 +60,9 @@ func startExpireWorker(ctx context.Context, config Config, cache cacheStorage) <
 	return done
 }
 
-func lruEviction(ctx context.Context, config Config, cache cacheStorage) <-chan struct{} {
+// lruEviction of keys while the database is over the threshold. Replicas do not evict keys, since the keys are deleted
+// by the primary once it evicts them.
+func lruEviction(ctx context.Context, config Config, cache cacheStorage, replication *replication) <-chan struct{} {
 	done := make(chan struct{})
 
 	go func() {
@@ -73,6 +75,9 @@ func lruEviction(ctx context.Context, config Config, cache cacheStorage) <-chan
 				close(done)
 				return
 			default:
+				if replication.isReplica() {
+					continue
+				}
 				dbStats := getDbStats(cache)
 				if dbStats.DbSizeInBytes > config.DbBytesEvictThreshold {
 					deleteLru(cache)
@@ -0,0 +1,455 @@
+package datkey
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wspowell/datkey/internal/geohash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type GeoUnit string
+
+const (
+	GeoMeters     = GeoUnit("m")
+	GeoKilometers = GeoUnit("km")
+	GeoMiles      = GeoUnit("mi")
+	GeoFeet       = GeoUnit("ft")
+)
+
+// meters in one unit. Returns false if the unit is invalid.
+func (self GeoUnit) meters() (float64, bool) {
+	switch self {
+	case "", GeoMeters:
+		return 1, true
+	case GeoKilometers:
+		return 1000, true //nolint:mnd // reason: unit conversion
+	case GeoMiles:
+		return 1609.34, true //nolint:mnd // reason: unit conversion
+	case GeoFeet:
+		return 0.3048, true //nolint:mnd // reason: unit conversion
+	default:
+		return 0, false
+	}
+}
+
+type GeoSort string
+
+const (
+	GeoSortNone = GeoSort("")
+	GeoSortAsc  = GeoSort("asc")
+	GeoSortDesc = GeoSort("desc")
+)
+
+type GeoCoordinate struct {
+	Longitude float64
+	Latitude  float64
+}
+
+type GeoLocation struct {
+	Member    string
+	Longitude float64
+	Latitude  float64
+}
+
+type GeoSearchQuery struct {
+	// FromPosition to search around. Takes precedence over FromMember.
+	FromPosition *GeoCoordinate
+	// FromMember to search around, using the position of the member.
+	FromMember string
+	// Unit of Radius, Width, and Height, as well as the distances in the results.
+	// Default: GeoMeters
+	Unit GeoUnit
+	// Sort results by distance.
+	// Default: GeoSortNone
+	Sort GeoSort
+	// Radius of a circle to search within. Either Radius, or Width and Height, must be set.
+	Radius float64
+	// Width of a box to search within.
+	Width float64
+	// Height of a box to search within.
+	Height float64
+	// Count limits the number of results to the closest members. Zero is unlimited.
+	Count int
+	// Any returns as soon as Count results are found, instead of the closest results.
+	Any bool
+}
+
+type GeoPosition struct {
+	Longitude float64
+	Latitude  float64
+	Exists    bool
+}
+
+type GeoSearchResult struct {
+	Member string
+	// Distance from the center of the search, in the unit of the query.
+	Distance  float64
+	Longitude float64
+	Latitude  float64
+	// Hash is the 52 bit geohash score of the member.
+	Hash int64
+}
+
+type GeoAddResponse struct {
+	// Added is the number of new members.
+	Added int64
+}
+
+type GeoPosResponse struct {
+	// Positions of each requested member, in order.
+	Positions []GeoPosition
+}
+
+type GeoDistResponse struct {
+	Distance float64
+	// Exists is true if both members exist.
+	Exists bool
+}
+
+type GeoHashResponse struct {
+	// Hashes are standard 11 character geohash strings of each requested member, in order. Missing members are empty.
+	Hashes []string
+}
+
+type GeoSearchResponse struct {
+	Results []GeoSearchResult
+}
+
+type commandZScores struct {
+	Resp    *zScoresResponse
+	Key     string
+	Members []string
+}
+
+type zScoresResponse struct {
+	Scores    []float64
+	Exists    []bool
+	WrongType bool
+}
+
+type commandGeoSearch struct {
+	Resp  *geoSearchResponse
+	Key   string
+	Query GeoSearchQuery
+}
+
+type geoSearchResponse struct {
+	Results        []GeoSearchResult
+	MemberNotFound bool
+	WrongType      bool
+}
+
+// GeoAdd locations to the sorted set stored at key, creating it if it does not exist.
+// Positions are stored as geohash scores, so the sorted set commands may be used on the key.
+// Returns DbWriteInvalidArgument if no locations are given.
+func (self *Datkey) GeoAdd(ctx context.Context, key string, locations ...GeoLocation) (GeoAddResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return GeoAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return geoAddKey(key, locations, self.cache.forContext(ctx))
+}
+
+// GeoPos returns the positions of members. Positions are accurate to within about 0.6 meters.
+func (self *Datkey) GeoPos(ctx context.Context, key string, members ...string) (GeoPosResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return GeoPosResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return geoPosKey(key, members, self.cache.forContext(ctx))
+}
+
+// GeoDist between two members, in the given unit.
+func (self *Datkey) GeoDist(ctx context.Context, key string, member1 string, member2 string, unit GeoUnit) (GeoDistResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return GeoDistResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return geoDistKey(key, member1, member2, unit, self.cache.forContext(ctx))
+}
+
+// GeoHash returns standard geohash strings of members.
+func (self *Datkey) GeoHash(ctx context.Context, key string, members ...string) (GeoHashResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return GeoHashResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return geoHashKey(key, members, self.cache.forContext(ctx))
+}
+
+// GeoSearch members within a radius or box around a position or member.
+func (self *Datkey) GeoSearch(ctx context.Context, key string, query GeoSearchQuery) (GeoSearchResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return GeoSearchResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return geoSearchKey(key, query, self.cache.forContext(ctx))
+}
+
+func geoAddKey(key string, locations []GeoLocation, cache cacheStorage) (GeoAddResponse, *errors.Error[DbWriteErr]) {
+	members := make([]ZMember, len(locations))
+	for index, location := range locations {
+		if !geohash.Valid(location.Longitude, location.Latitude) {
+			return GeoAddResponse{}, errors.New(DbWriteInvalidArgument, "invalid position: %f,%f", location.Longitude, location.Latitude) //nolint:exhaustruct // reason: zero value on error
+		}
+		members[index] = ZMember{
+			Member: location.Member,
+			Score:  geohash.EncodeScore(location.Longitude, location.Latitude),
+		}
+	}
+
+	result, err := zAddKey(key, members, cache)
+	if err != nil {
+		return GeoAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return GeoAddResponse{
+		Added: result.Added,
+	}, nil
+}
+
+func zScoresKey(key string, members []string, cache cacheStorage) (*zScoresResponse, *errors.Error[DbReadErr]) {
+	resp := &zScoresResponse{
+		Scores:    make([]float64, len(members)),
+		Exists:    make([]bool, len(members)),
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandZScores{
+		Key:     key,
+		Members: members,
+		Resp:    resp,
+	})
+	if redirect != nil {
+		return nil, redirect.readErr()
+	}
+
+	if resp.WrongType {
+		return nil, errors.New(DbReadWrongType, "key does not hold a sorted set: %s", key)
+	}
+
+	return resp, nil
+}
+
+func geoPosKey(key string, members []string, cache cacheStorage) (GeoPosResponse, *errors.Error[DbReadErr]) {
+	resp, err := zScoresKey(key, members, cache)
+	if err != nil {
+		return GeoPosResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	positions := make([]GeoPosition, len(members))
+	for index := range members {
+		if resp.Exists[index] {
+			positions[index].Longitude, positions[index].Latitude = geohash.DecodeScore(resp.Scores[index])
+			positions[index].Exists = true
+		}
+	}
+
+	return GeoPosResponse{
+		Positions: positions,
+	}, nil
+}
+
+func geoDistKey(key string, member1 string, member2 string, unit GeoUnit, cache cacheStorage) (GeoDistResponse, *errors.Error[DbReadErr]) {
+	metersPerUnit, ok := unit.meters()
+	if !ok {
+		return GeoDistResponse{}, errors.New(DbReadInvalidArgument, "invalid unit: %s", unit) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	result, err := geoPosKey(key, []string{member1, member2}, cache)
+	if err != nil {
+		return GeoDistResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	position1, position2 := result.Positions[0], result.Positions[1]
+	if !position1.Exists || !position2.Exists {
+		return GeoDistResponse{
+			Distance: 0,
+			Exists:   false,
+		}, nil
+	}
+
+	return GeoDistResponse{
+		Distance: geohash.Distance(position1.Longitude, position1.Latitude, position2.Longitude, position2.Latitude) / metersPerUnit,
+		Exists:   true,
+	}, nil
+}
+
+func geoHashKey(key string, members []string, cache cacheStorage) (GeoHashResponse, *errors.Error[DbReadErr]) {
+	result, err := geoPosKey(key, members, cache)
+	if err != nil {
+		return GeoHashResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	hashes := make([]string, len(members))
+	for index, position := range result.Positions {
+		if position.Exists {
+			hashes[index] = geohash.Standard(position.Longitude, position.Latitude)
+		}
+	}
+
+	return GeoHashResponse{
+		Hashes: hashes,
+	}, nil
+}
+
+func geoSearchKey(key string, query GeoSearchQuery, cache cacheStorage) (GeoSearchResponse, *errors.Error[DbReadErr]) {
+	if _, ok := query.Unit.meters(); !ok {
+		return GeoSearchResponse{}, errors.New(DbReadInvalidArgument, "invalid unit: %s", query.Unit) //nolint:exhaustruct // reason: zero value on error
+	}
+	if query.Radius <= 0 && (query.Width <= 0 || query.Height <= 0) {
+		return GeoSearchResponse{}, errors.New(DbReadInvalidArgument, "search requires a radius or a width and height") //nolint:exhaustruct // reason: zero value on error
+	}
+	if query.FromPosition != nil && !geohash.Valid(query.FromPosition.Longitude, query.FromPosition.Latitude) {
+		return GeoSearchResponse{}, errors.New(DbReadInvalidArgument, "invalid position: %f,%f", query.FromPosition.Longitude, query.FromPosition.Latitude) //nolint:exhaustruct // reason: zero value on error
+	}
+	switch query.Sort {
+	case GeoSortNone, GeoSortAsc, GeoSortDesc:
+	default:
+		return GeoSearchResponse{}, errors.New(DbReadInvalidArgument, "invalid sort: %s", query.Sort) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	resp := &geoSearchResponse{
+		Results:        nil,
+		MemberNotFound: false,
+		WrongType:      false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandGeoSearch{
+		Key:   key,
+		Query: query,
+		Resp:  resp,
+	})
+	if redirect != nil {
+		return GeoSearchResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return GeoSearchResponse{}, errors.New(DbReadWrongType, "key does not hold a sorted set: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+	if resp.MemberNotFound {
+		return GeoSearchResponse{}, errors.New(DbReadInvalidArgument, "member does not exist: %s", query.FromMember) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return GeoSearchResponse{
+		Results: resp.Results,
+	}, nil
+}
+
+func (self *slotStorage) handleCommandZScores(cmd commandZScores) {
+	data, set, exists, wrongType := self.lookupSortedSet(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+	for index, member := range cmd.Members {
+		cmd.Resp.Scores[index], cmd.Resp.Exists[index] = set.score(member)
+	}
+}
+
+func (self *slotStorage) handleCommandGeoSearch(cmd commandGeoSearch) {
+	data, set, exists, wrongType := self.lookupSortedSet(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+
+	query := cmd.Query
+	var longitude, latitude float64
+	if query.FromPosition != nil {
+		longitude, latitude = query.FromPosition.Longitude, query.FromPosition.Latitude
+	} else {
+		var score float64
+		var memberExists bool
+		if exists {
+			score, memberExists = set.score(query.FromMember)
+		}
+		if !memberExists {
+			cmd.Resp.MemberNotFound = true
+			return
+		}
+		longitude, latitude = geohash.DecodeScore(score)
+	}
+
+	if !exists {
+		return
+	}
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+
+	metersPerUnit, _ := query.Unit.meters()
+	radius := query.Radius * metersPerUnit
+	halfWidth, halfHeight := radius, radius
+	if query.Radius <= 0 {
+		halfWidth, halfHeight = query.Width*metersPerUnit/2, query.Height*metersPerUnit/2 //nolint:mnd // reason: half of the box
+		radius = math.Hypot(halfWidth, halfHeight)
+	}
+
+	// With Any, the search can stop as soon as enough results are found.
+	// Otherwise, the closest results are returned.
+	stopAtCount := query.Count > 0 && query.Any
+	if query.Count > 0 && !query.Any && query.Sort == GeoSortNone {
+		query.Sort = GeoSortAsc
+	}
+
+	var results []GeoSearchResult
+	for _, area := range geohash.SearchAreas(longitude, latitude, halfWidth, halfHeight, radius) {
+		minScore, maxScore := area.ScoreRange()
+		scoreRange := ScoreRange{
+			Min:          float64(minScore),
+			Max:          float64(maxScore),
+			MinExclusive: false,
+			MaxExclusive: true,
+		}
+
+		set.rangeByScore(scoreRange, func(member string, score float64) bool {
+			memberLongitude, memberLatitude := geohash.DecodeScore(score)
+
+			var distance float64
+			if query.Radius > 0 {
+				distance = geohash.Distance(longitude, latitude, memberLongitude, memberLatitude)
+				if distance > radius {
+					return true
+				}
+			} else {
+				// The point must be within the height and width of the box, measured from the center.
+				if geohash.LatitudeDistance(latitude, memberLatitude) > halfHeight ||
+					geohash.Distance(longitude, memberLatitude, memberLongitude, memberLatitude) > halfWidth {
+					return true
+				}
+				distance = geohash.Distance(longitude, latitude, memberLongitude, memberLatitude)
+			}
+
+			results = append(results, GeoSearchResult{
+				Member:    member,
+				Distance:  distance / metersPerUnit,
+				Longitude: memberLongitude,
+				Latitude:  memberLatitude,
+				Hash:      int64(score),
+			})
+
+			return !stopAtCount || len(results) < query.Count
+		})
+
+		if stopAtCount && len(results) >= query.Count {
+			break
+		}
+	}
+
+	switch query.Sort {
+	case GeoSortAsc:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Distance < results[j].Distance })
+	case GeoSortDesc:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Distance > results[j].Distance })
+	case GeoSortNone:
+	}
+
+	if query.Count > 0 && len(results) > query.Count {
+		results = results[:query.Count]
+	}
+	cmd.Resp.Results = results
+}
@@ -0,0 +1,202 @@
+package datkey_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+//nolint:gochecknoglobals // reason: shared test fixture
+var sicily = []datkey.GeoLocation{
+	{Member: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+	{Member: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+}
+
+func TestDatkey_GeoAdd_GeoPos(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.GeoAdd(ctx, "test", sicily...)
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), result.Added)
+	}
+
+	{
+		result, err := client.GeoPos(ctx, "test", "Palermo", "missing")
+		require.Nil(t, err)
+		require.Len(t, result.Positions, 2)
+		assert.True(t, result.Positions[0].Exists)
+		assert.InDelta(t, 13.361389, result.Positions[0].Longitude, 0.00001)
+		assert.InDelta(t, 38.115556, result.Positions[0].Latitude, 0.00001)
+		assert.False(t, result.Positions[1].Exists)
+	}
+
+	{
+		// Positions are stored as sorted set scores.
+		result, err := client.ZScore(ctx, "test", "Palermo")
+		require.Nil(t, err)
+		assert.InDelta(t, 3479099956230698.0, result.Score, 0)
+	}
+
+	{
+		_, err := client.GeoAdd(ctx, "test", datkey.GeoLocation{Member: "pole", Longitude: 0, Latitude: 90})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	{
+		_, err := client.GeoAdd(ctx, "empty")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+		assert.False(t, typeOf(t, client, "empty").Exists)
+	}
+}
+
+func TestDatkey_GeoDist(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.GeoAdd(ctx, "test", sicily...)
+	require.Nil(t, err)
+
+	{
+		result, err := client.GeoDist(ctx, "test", "Palermo", "Catania", datkey.GeoMeters)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.InDelta(t, 166274.1516, result.Distance, 0.001)
+	}
+
+	{
+		result, err := client.GeoDist(ctx, "test", "Palermo", "Catania", datkey.GeoKilometers)
+		require.Nil(t, err)
+		assert.InDelta(t, 166.2742, result.Distance, 0.0001)
+	}
+
+	{
+		result, err := client.GeoDist(ctx, "test", "Palermo", "missing", datkey.GeoMeters)
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+}
+
+func TestDatkey_GeoHash(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.GeoAdd(ctx, "test", sicily...)
+	require.Nil(t, err)
+
+	result, geoErr := client.GeoHash(ctx, "test", "Palermo", "Catania", "missing")
+	require.Nil(t, geoErr)
+	assert.Equal(t, []string{"sqc8b49rny0", "sqdtr74hyu0", ""}, result.Hashes)
+}
+
+func TestDatkey_GeoSearch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.GeoAdd(ctx, "test", sicily...)
+	require.Nil(t, err)
+	_, err = client.GeoAdd(ctx, "test",
+		datkey.GeoLocation{Member: "edge1", Longitude: 12.758489, Latitude: 38.788135},
+		datkey.GeoLocation{Member: "edge2", Longitude: 17.241510, Latitude: 38.788135},
+	)
+	require.Nil(t, err)
+
+	members := func(results []datkey.GeoSearchResult) []string {
+		names := make([]string, len(results))
+		for index := range results {
+			names[index] = results[index].Member
+		}
+		return names
+	}
+
+	{
+		result, err := client.GeoSearch(ctx, "test", datkey.GeoSearchQuery{
+			FromPosition: &datkey.GeoCoordinate{Longitude: 15, Latitude: 37},
+			FromMember:   "",
+			Unit:         datkey.GeoKilometers,
+			Sort:         datkey.GeoSortAsc,
+			Radius:       200,
+			Width:        0,
+			Height:       0,
+			Count:        0,
+			Any:          false,
+		})
+		require.Nil(t, err)
+		assert.Equal(t, []string{"Catania", "Palermo"}, members(result.Results))
+		assert.InDelta(t, 56.4413, result.Results[0].Distance, 0.0001)
+		assert.InDelta(t, 190.4424, result.Results[1].Distance, 0.0001)
+	}
+
+	{
+		result, err := client.GeoSearch(ctx, "test", datkey.GeoSearchQuery{
+			FromPosition: &datkey.GeoCoordinate{Longitude: 15, Latitude: 37},
+			FromMember:   "",
+			Unit:         datkey.GeoKilometers,
+			Sort:         datkey.GeoSortDesc,
+			Radius:       0,
+			Width:        400,
+			Height:       400,
+			Count:        0,
+			Any:          false,
+		})
+		require.Nil(t, err)
+		assert.Equal(t, []string{"edge1", "edge2", "Palermo", "Catania"}, members(result.Results))
+	}
+
+	{
+		// Count returns the closest members.
+		result, err := client.GeoSearch(ctx, "test", datkey.GeoSearchQuery{
+			FromPosition: nil,
+			FromMember:   "Palermo",
+			Unit:         datkey.GeoKilometers,
+			Sort:         datkey.GeoSortNone,
+			Radius:       500,
+			Width:        0,
+			Height:       0,
+			Count:        2,
+			Any:          false,
+		})
+		require.Nil(t, err)
+		assert.Equal(t, []string{"Palermo", "edge1"}, members(result.Results))
+		assert.Zero(t, result.Results[0].Distance)
+	}
+
+	{
+		_, err := client.GeoSearch(ctx, "test", datkey.GeoSearchQuery{
+			FromPosition: nil,
+			FromMember:   "missing",
+			Unit:         datkey.GeoMeters,
+			Sort:         datkey.GeoSortNone,
+			Radius:       1,
+			Width:        0,
+			Height:       0,
+			Count:        0,
+			Any:          false,
+		})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadInvalidArgument, err.Cause)
+	}
+}
@@ -0,0 +1,623 @@
+// Package gossip discovers the nodes of a cluster and the slots each owns by exchanging heartbeats between the nodes,
+// detects nodes that have failed, and promotes a replica of a failed primary to take over its slots, without an
+// external coordinator.
+//
+// Every interval, each node sends the records of every member it knows of to a few other nodes. A member that has not
+// sent a newer heartbeat within the suspect timeout is suspected, and failed after the fail timeout. Each primary
+// claims its slots with an epoch, and the claim with the highest epoch owns a slot, so that the claims of a replica
+// that took over a failed primary replace those of the primary once it returns.
+package gossip
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type GossipErr errors.Cause
+
+const (
+	GossipErrInternal = GossipErr(iota + 1)
+	// GossipErrClosed is returned by a transport once it is closed.
+	GossipErrClosed
+	// GossipErrTransport is returned when a message cannot be sent or received.
+	GossipErrTransport
+	// GossipErrInvalidMessage is returned when a message received is not a gossip message.
+	GossipErrInvalidMessage
+)
+
+const (
+	defaultInterval = time.Second
+	defaultFanout   = 3
+	// defaultSuspectIntervals and defaultFailIntervals without a heartbeat after which a member is suspected or failed.
+	defaultSuspectIntervals = 5
+	defaultFailIntervals    = 15
+)
+
+// MemberState of a member, as detected by this node.
+type MemberState string
+
+const (
+	// MemberAlive has sent a heartbeat within the suspect timeout.
+	MemberAlive MemberState = "alive"
+	// MemberSuspect has not sent a heartbeat within the suspect timeout, but may still be slow rather than down.
+	MemberSuspect MemberState = "suspect"
+	// MemberFailed has not sent a heartbeat within the fail timeout. Its replicas take over its slots.
+	MemberFailed MemberState = "failed"
+)
+
+// Member of the cluster.
+type Member struct {
+	ID string
+	// Address clients reach the member at.
+	Address string
+	// GossipAddress of the transport of the member.
+	GossipAddress string
+	// PrimaryID of the member the member replicates from. Empty if the member is a primary.
+	PrimaryID string
+	// Slots the member owns, which are the slots it claims that no other member claims with a higher epoch.
+	Slots []hash.Range
+	Epoch uint64
+	State MemberState
+}
+
+// Database the slots owners are applied to, such as *datkey.Datkey, so that it redirects commands for the slots of
+// other members to them.
+type Database interface {
+	SetSlotsOwner(slots hash.Range, node string)
+}
+
+type Config struct {
+	// ID of the node, which must be unique in the cluster and kept across restarts.
+	// Default: Address
+	ID string
+
+	// Address clients reach the node at, such as "10.0.0.1:6379", which other nodes redirect commands to. Required.
+	Address string
+
+	// Transport to gossip with other nodes over. It is not closed by the membership. Required.
+	Transport Transport
+
+	// Seeds are the gossip addresses of nodes to join the cluster through.
+	// Default: None (the node waits for other nodes to gossip with it)
+	Seeds []string
+
+	// Slots the node owns when it starts as a primary.
+	// Default: None
+	Slots []hash.Range
+
+	// PrimaryID of the node the node replicates from.
+	// Default: None (the node is a primary)
+	PrimaryID string
+
+	// Database the owner of every slot is applied to whenever it changes.
+	// Default: None (nil, slot owners are only gossiped)
+	Database Database
+
+	// SlotCount keys are partitioned into, which must be the slot count of the partitioner of the database. Claims of
+	// slots from the slot count up are rejected.
+	// Default: hash.MaxHashSlot
+	SlotCount int
+
+	// ReplicaOfHandler is called with the address of the primary once the node learns of it or follows another primary,
+	// and with an empty address once the node is promoted to a primary, such as (*server.Server).ReplicaOf.
+	// Default: None (the role of the node is only gossiped)
+	ReplicaOfHandler func(address string)
+
+	// Interval between gossip rounds, each of which sends a heartbeat to Fanout members.
+	// Default: 1s
+	Interval time.Duration
+
+	// Fanout of each gossip round.
+	// Default: 3
+	Fanout int
+
+	// SuspectTimeout without a newer heartbeat from a member after which it is suspected.
+	// Default: 5 × Interval
+	SuspectTimeout time.Duration
+
+	// FailTimeout without a newer heartbeat from a member after which it is failed.
+	// Default: 15 × Interval
+	FailTimeout time.Duration
+
+	// ErrorHandler is called with any error sending or receiving a message.
+	// Default: errors are ignored
+	ErrorHandler func(err error)
+}
+
+// Membership of the node in the cluster, which gossips with the other members in the background until it is closed.
+type Membership struct {
+	config Config
+	// members by ID, including the node itself.
+	members map[string]*member
+	self    *member
+	mutex   sync.Mutex
+
+	// ownership of every slot, computed from the claims of the members on first use after they change.
+	ownership []*member
+	// version of the claims, which is incremented whenever the claims of a member change.
+	version uint64
+
+	// appliedOwners of every slot and appliedPrimary, as last applied to the database and the replica of handler.
+	appliedOwners  []string
+	appliedVersion uint64
+	appliedPrimary string
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// member and the time this node last received a newer heartbeat from it.
+type member struct {
+	record
+	lastSeen time.Time
+}
+
+func New(config Config) *Membership {
+	if config.Address == "" || config.Transport == nil {
+		panic("gossip requires an address and a transport")
+	}
+
+	if config.ID == "" {
+		config.ID = config.Address
+	}
+
+	if config.Interval == 0 {
+		config.Interval = defaultInterval
+	}
+
+	if config.Fanout == 0 {
+		config.Fanout = defaultFanout
+	}
+
+	if config.SuspectTimeout == 0 {
+		config.SuspectTimeout = defaultSuspectIntervals * config.Interval
+	}
+
+	if config.FailTimeout == 0 {
+		config.FailTimeout = defaultFailIntervals * config.Interval
+	}
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(error) {}
+	}
+
+	if config.SlotCount == 0 {
+		config.SlotCount = int(hash.MaxHashSlot)
+	}
+	if config.SlotCount < 1 || config.SlotCount > int(hash.MaxHashSlot) {
+		panic(fmt.Sprintf("gossip slot count %d is not from 1 up to %d", config.SlotCount, hash.MaxHashSlot))
+	}
+	for _, slots := range config.Slots {
+		requireSlots(slots, config.SlotCount)
+	}
+
+	var slots []hash.Range
+	if config.PrimaryID == "" {
+		slots = slices.Clone(config.Slots)
+	}
+
+	self := &member{
+		record: record{
+			id:            config.ID,
+			address:       config.Address,
+			gossipAddress: config.Transport.Address(),
+			primaryID:     config.PrimaryID,
+			heartbeat:     1,
+			epoch:         0,
+			slots:         slots,
+		},
+		lastSeen: time.Now(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	membership := &Membership{
+		config:         config,
+		members:        map[string]*member{self.id: self},
+		self:           self,
+		mutex:          sync.Mutex{},
+		ownership:      nil,
+		version:        1,
+		appliedOwners:  make([]string, config.SlotCount),
+		appliedVersion: 0,
+		appliedPrimary: "",
+		cancel:         cancel,
+		done:           sync.WaitGroup{},
+	}
+
+	membership.done.Add(2) //nolint:mnd // reason: receive and gossip workers
+	go func() {
+		defer membership.done.Done()
+		membership.receive(ctx)
+	}()
+	go func() {
+		defer membership.done.Done()
+		membership.gossip(ctx)
+	}()
+
+	return membership
+}
+
+// Close stops gossiping, waiting for the background workers to stop.
+func (self *Membership) Close() {
+	self.cancel()
+	self.done.Wait()
+}
+
+// Members of the cluster known to this node, including itself, in order of their IDs.
+func (self *Membership) Members() []Member {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	now := time.Now()
+	owners := self.owners()
+
+	members := make([]Member, 0, len(self.members))
+	for _, member := range self.members {
+		members = append(members, Member{
+			ID:            member.id,
+			Address:       member.address,
+			GossipAddress: member.gossipAddress,
+			PrimaryID:     member.primaryID,
+			Slots:         ownedSlots(owners, member),
+			Epoch:         member.epoch,
+			State:         self.state(member, now),
+		})
+	}
+	slices.SortFunc(members, func(a Member, b Member) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return members
+}
+
+// ClaimSlots for this node with an epoch higher than any other member, taking them from the members that own them,
+// such as once the slots have been migrated to this node. The node must be a primary.
+// Panics if the slots are not below the slot count.
+func (self *Membership) ClaimSlots(slots hash.Range) {
+	requireSlots(slots, self.config.SlotCount)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	owners := slices.Clone(self.owners())
+	for slot := slots.Begin; slot <= slots.End; slot++ {
+		owners[slot] = self.self
+	}
+	self.self.slots = ownedSlots(owners, self.self)
+	self.self.epoch = self.maxEpoch() + 1
+	self.self.heartbeat++
+	self.claimsChanged()
+}
+
+// receive and merge the messages of other nodes until the context is done.
+func (self *Membership) receive(ctx context.Context) {
+	for {
+		message, err := self.config.Transport.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			self.config.ErrorHandler(err)
+			continue
+		}
+
+		records, decodeErr := decodeMessage(message, self.config.SlotCount)
+		if decodeErr != nil {
+			self.config.ErrorHandler(decodeErr)
+			continue
+		}
+		self.merge(records)
+	}
+}
+
+// gossip with other nodes every interval until the context is done.
+func (self *Membership) gossip(ctx context.Context) {
+	ticker := time.NewTicker(self.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		message, targets := self.round()
+		self.apply()
+
+		for _, target := range targets {
+			sendCtx, cancel := context.WithTimeout(ctx, self.config.Interval)
+			if err := self.config.Transport.Send(sendCtx, target, message); err != nil && ctx.Err() == nil {
+				self.config.ErrorHandler(err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// merge records received from another node, keeping the record with the highest heartbeat of each member.
+func (self *Membership) merge(records []record) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	now := time.Now()
+	for _, record := range records {
+		if record.id == self.self.id {
+			// A record of this node from before it restarted must not replace its newer records.
+			self.self.heartbeat = max(self.self.heartbeat, record.heartbeat+1)
+			continue
+		}
+
+		existing, exists := self.members[record.id]
+		if !exists {
+			self.members[record.id] = &member{
+				record:   record,
+				lastSeen: now,
+			}
+			self.claimsChanged()
+			continue
+		}
+		if record.heartbeat <= existing.heartbeat {
+			continue
+		}
+
+		if record.epoch != existing.epoch || !slices.Equal(record.slots, existing.slots) {
+			self.claimsChanged()
+		}
+		existing.record = record
+		existing.lastSeen = now
+	}
+}
+
+// round of gossip, which updates the records of this node from the records of the other members and returns the
+// message to send and the gossip addresses to send it to.
+func (self *Membership) round() ([]byte, []string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.self.heartbeat++
+	self.updateSlots()
+	self.failover()
+	self.followPrimary()
+
+	records := make([]record, 0, len(self.members))
+	var targets []string
+	known := map[string]bool{}
+	for _, member := range self.members {
+		records = append(records, member.record)
+		known[member.gossipAddress] = true
+		if member != self.self {
+			targets = append(targets, member.gossipAddress)
+		}
+	}
+
+	rand.Shuffle(len(targets), func(i int, j int) { //nolint:gosec // reason: gossip targets need not be unpredictable
+		targets[i], targets[j] = targets[j], targets[i]
+	})
+	targets = targets[:min(len(targets), self.config.Fanout)]
+
+	// Seeds are gossiped with until they are known, so that a node joins, or rejoins after a partition, through them.
+	for _, seed := range self.config.Seeds {
+		if !known[seed] {
+			targets = append(targets, seed)
+		}
+	}
+
+	return encodeMessage(records), targets
+}
+
+// updateSlots of this node to the slots it still owns, following the member that took every slot of this node.
+func (self *Membership) updateSlots() {
+	if len(self.self.slots) == 0 {
+		return
+	}
+
+	owners := self.owners()
+	owned := ownedSlots(owners, self.self)
+	if slices.Equal(owned, self.self.slots) {
+		return
+	}
+	if len(owned) == 0 {
+		// A replica took over the slots while this node was failed.
+		self.self.primaryID = owners[self.self.slots[0].Begin].id
+	}
+	self.self.slots = owned
+	self.claimsChanged()
+}
+
+// failover to this node if it is the replica with the lowest ID that has not failed of a failed primary, and this node
+// sees a majority of the primaries alive, so that a replica cut off from the cluster does not take over.
+func (self *Membership) failover() {
+	primary, exists := self.members[self.self.primaryID]
+	if !exists {
+		return
+	}
+
+	now := time.Now()
+	if self.state(primary, now) != MemberFailed {
+		return
+	}
+
+	owners := self.owners()
+	slots := ownedSlots(owners, primary)
+	if len(slots) == 0 {
+		return
+	}
+
+	for _, member := range self.members {
+		if member.primaryID == primary.id && member.id < self.self.id && self.state(member, now) != MemberFailed {
+			return
+		}
+	}
+
+	primaries := map[*member]bool{}
+	for _, owner := range owners {
+		if owner != nil {
+			primaries[owner] = true
+		}
+	}
+	var alive int
+	for owner := range primaries {
+		if self.state(owner, now) == MemberAlive {
+			alive++
+		}
+	}
+	if alive*2 <= len(primaries) {
+		return
+	}
+
+	self.self.primaryID = ""
+	self.self.slots = slots
+	self.self.epoch = self.maxEpoch() + 1
+	self.claimsChanged()
+}
+
+// followPrimary of this node once its primary replicates from another node, or once another node takes over the slots
+// of its primary.
+func (self *Membership) followPrimary() {
+	primary, exists := self.members[self.self.primaryID]
+	if !exists {
+		return
+	}
+
+	if primary.primaryID != "" {
+		if primary.primaryID != self.self.id {
+			self.self.primaryID = primary.primaryID
+		}
+		return
+	}
+
+	if len(primary.slots) != 0 {
+		if owner := self.owners()[primary.slots[0].Begin]; owner != primary {
+			self.self.primaryID = owner.id
+		}
+	}
+}
+
+// apply the owner of every slot to the database and the primary of this node to the replica of handler.
+func (self *Membership) apply() {
+	self.mutex.Lock()
+	var primary string
+	if member, exists := self.members[self.self.primaryID]; exists {
+		primary = member.address
+	}
+
+	var owners []string
+	changed := self.version != self.appliedVersion
+	if changed {
+		owners = make([]string, self.config.SlotCount)
+		for slot, owner := range self.owners() {
+			if owner != nil && owner != self.self {
+				owners[slot] = owner.address
+			}
+		}
+		self.appliedVersion = self.version
+	}
+	self.mutex.Unlock()
+
+	if changed && self.config.Database != nil {
+		for slot := 0; slot < len(owners); {
+			if owners[slot] == self.appliedOwners[slot] {
+				slot++
+				continue
+			}
+
+			end := slot
+			for end+1 < len(owners) && owners[end+1] == owners[slot] && owners[end+1] != self.appliedOwners[end+1] {
+				end++
+			}
+			self.config.Database.SetSlotsOwner(hash.Range{Begin: hash.Slot(slot), End: hash.Slot(end)}, owners[slot])
+			slot = end + 1
+		}
+	}
+	if changed {
+		self.appliedOwners = owners
+	}
+
+	if primary != self.appliedPrimary && self.config.ReplicaOfHandler != nil {
+		self.config.ReplicaOfHandler(primary)
+	}
+	self.appliedPrimary = primary
+}
+
+// claimsChanged of a member, after which the owners of the slots are computed again.
+func (self *Membership) claimsChanged() {
+	self.ownership = nil
+	self.version++
+}
+
+// owners of every slot, which is the member that claims the slot with the highest epoch, or the lowest ID if the
+// epochs are equal. Slots that no member claims have no owner.
+func (self *Membership) owners() []*member {
+	if self.ownership != nil {
+		return self.ownership
+	}
+
+	owners := make([]*member, self.config.SlotCount)
+	for _, member := range self.members {
+		for _, slots := range member.slots {
+			for slot := slots.Begin; slot <= slots.End && int(slot) < len(owners); slot++ {
+				owner := owners[slot]
+				if owner == nil || member.epoch > owner.epoch || (member.epoch == owner.epoch && member.id < owner.id) {
+					owners[slot] = member
+				}
+			}
+		}
+	}
+	self.ownership = owners
+	return owners
+}
+
+func (self *Membership) maxEpoch() uint64 {
+	var epoch uint64
+	for _, member := range self.members {
+		epoch = max(epoch, member.epoch)
+	}
+	return epoch
+}
+
+func (self *Membership) state(member *member, now time.Time) MemberState {
+	if member == self.self {
+		return MemberAlive
+	}
+
+	switch since := now.Sub(member.lastSeen); {
+	case since < self.config.SuspectTimeout:
+		return MemberAlive
+	case since < self.config.FailTimeout:
+		return MemberSuspect
+	default:
+		return MemberFailed
+	}
+}
+
+// ownedSlots of a member, as ranges of adjacent slots.
+func ownedSlots(owners []*member, owner *member) []hash.Range {
+	var slots []hash.Range
+	for slot, member := range owners {
+		if member != owner {
+			continue
+		}
+		if len(slots) != 0 && slots[len(slots)-1].End == hash.Slot(slot-1) {
+			slots[len(slots)-1].End = hash.Slot(slot)
+			continue
+		}
+		slots = append(slots, hash.Range{Begin: hash.Slot(slot), End: hash.Slot(slot)})
+	}
+	return slots
+}
+
+// requireSlots to be below the slot count.
+func requireSlots(slots hash.Range, slotCount int) {
+	if slots.Begin > slots.End || int(slots.End) >= slotCount {
+		panic(fmt.Sprintf("slots %d-%d are not below the slot count %d", slots.Begin, slots.End, slotCount))
+	}
+}
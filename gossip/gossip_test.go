@@ -0,0 +1,397 @@
+package gossip_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/gossip"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+var _ gossip.Database = (*datkey.Datkey)(nil)
+
+const (
+	interval       = 10 * time.Millisecond
+	suspectTimeout = 100 * time.Millisecond
+	failTimeout    = 400 * time.Millisecond
+	waitFor        = 5 * time.Second
+)
+
+var (
+	firstThird  = hash.Range{Begin: 0, End: 5460}
+	secondThird = hash.Range{Begin: 5461, End: 10922}
+	lastThird   = hash.Range{Begin: 10923, End: hash.MaxHashSlot - 1}
+)
+
+// node of a test cluster, which records the primary it is told to replicate from.
+type node struct {
+	*gossip.Membership
+	db      *datkey.Datkey
+	mutex   sync.Mutex
+	primary []string
+}
+
+func (self *node) primaries() []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return append([]string(nil), self.primary...)
+}
+
+// startNode named id, with the client address "id:6379" and the gossip address "id", seeded by the first node "a".
+func startNode(t *testing.T, network *gossip.MemoryNetwork, id string, primaryID string, slots ...hash.Range) *node {
+	t.Helper()
+
+	var config datkey.Config
+	db := datkey.New(config)
+	t.Cleanup(db.Close)
+
+	node := &node{
+		Membership: nil,
+		db:         db,
+		mutex:      sync.Mutex{},
+		primary:    nil,
+	}
+	node.Membership = gossip.New(gossip.Config{
+		ID:        id,
+		Address:   id + ":6379",
+		Transport: network.Transport(id),
+		Seeds:     []string{"a"},
+		Slots:     slots,
+		PrimaryID: primaryID,
+		Database:  db,
+		SlotCount: 0,
+		ReplicaOfHandler: func(address string) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			node.primary = append(node.primary, address)
+		},
+		Interval:       interval,
+		Fanout:         0,
+		SuspectTimeout: suspectTimeout,
+		FailTimeout:    failTimeout,
+		ErrorHandler:   nil,
+	})
+	t.Cleanup(node.Close)
+	return node
+}
+
+func member(t *testing.T, membership *gossip.Membership, id string) gossip.Member {
+	t.Helper()
+
+	for _, member := range membership.Members() {
+		if member.ID == id {
+			return member
+		}
+	}
+	return gossip.Member{} //nolint:exhaustruct // reason: zero value for a member that is not known
+}
+
+func requireMember(t *testing.T, membership *gossip.Membership, expected gossip.Member) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		actual := member(t, membership, expected.ID)
+		return actual.State == expected.State &&
+			actual.PrimaryID == expected.PrimaryID &&
+			assert.ObjectsAreEqual(expected.Slots, actual.Slots)
+	}, waitFor, interval, "member %s", expected.ID)
+}
+
+func alive(id string, primaryID string, slots ...hash.Range) gossip.Member {
+	return gossip.Member{
+		ID:            id,
+		Address:       id + ":6379",
+		GossipAddress: id,
+		PrimaryID:     primaryID,
+		Slots:         slots,
+		Epoch:         0,
+		State:         gossip.MemberAlive,
+	}
+}
+
+func TestMembership_join(t *testing.T) {
+	t.Parallel()
+
+	network := gossip.NewMemoryNetwork()
+	a := startNode(t, network, "a", "", firstThird)
+	b := startNode(t, network, "b", "", secondThird)
+	c := startNode(t, network, "c", "", lastThird)
+	replica := startNode(t, network, "replica", "a")
+
+	for _, node := range []*node{a, b, c, replica} {
+		requireMember(t, node.Membership, alive("a", "", firstThird))
+		requireMember(t, node.Membership, alive("b", "", secondThird))
+		requireMember(t, node.Membership, alive("c", "", lastThird))
+		requireMember(t, node.Membership, alive("replica", "a"))
+	}
+	assert.Equal(t, alive("b", "", secondThird), member(t, a.Membership, "b"))
+
+	// Slots of other members are redirected to them.
+	require.Eventually(t, func() bool {
+		return b.db.SlotState(firstThird.End).Owner == "a:6379" && b.db.SlotState(lastThird.Begin).Owner == "c:6379"
+	}, waitFor, interval)
+	assert.Empty(t, b.db.SlotState(secondThird.Begin).Owner)
+	assert.Equal(t, "a:6379", replica.db.SlotState(firstThird.Begin).Owner)
+
+	// The replica is told to replicate from its primary once it learns of it.
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"a:6379"}, replica.primaries())
+	}, waitFor, interval)
+	assert.Empty(t, a.primaries())
+}
+
+func TestMembership_failover(t *testing.T) {
+	t.Parallel()
+
+	network := gossip.NewMemoryNetwork()
+	a := startNode(t, network, "a", "", firstThird)
+	b := startNode(t, network, "b", "", secondThird)
+	startNode(t, network, "c", "", lastThird)
+	replica := startNode(t, network, "replica", "a")
+	otherReplica := startNode(t, network, "s-replica", "a")
+
+	requireMember(t, b.Membership, alive("s-replica", "a"))
+	requireMember(t, a.Membership, alive("s-replica", "a"))
+
+	// The primary is cut off from the rest of the cluster.
+	network.Partition([]string{"a"})
+
+	requireMember(t, b.Membership, gossip.Member{
+		ID:            "a",
+		Address:       "a:6379",
+		GossipAddress: "a",
+		PrimaryID:     "",
+		Slots:         nil,
+		Epoch:         0,
+		State:         gossip.MemberFailed,
+	})
+
+	// The replica with the lowest ID takes over the slots of the primary, with a newer epoch.
+	requireMember(t, b.Membership, alive("replica", "", firstThird))
+	assert.Equal(t, uint64(1), member(t, b.Membership, "replica").Epoch)
+	requireMember(t, b.Membership, alive("s-replica", "replica"))
+	require.Eventually(t, func() bool {
+		return b.db.SlotState(firstThird.Begin).Owner == "replica:6379"
+	}, waitFor, interval)
+	assert.Empty(t, replica.db.SlotState(firstThird.Begin).Owner)
+	assert.Equal(t, []string{"a:6379", ""}, replica.primaries())
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"a:6379", "replica:6379"}, otherReplica.primaries())
+	}, waitFor, interval)
+
+	// Once the partition heals, the former primary gives up its slots and replicates from the new primary.
+	network.Heal()
+
+	requireMember(t, a.Membership, alive("a", "replica"))
+	requireMember(t, b.Membership, alive("a", "replica"))
+	require.Eventually(t, func() bool {
+		return a.db.SlotState(firstThird.Begin).Owner == "replica:6379"
+	}, waitFor, interval)
+	assert.Equal(t, []string{"replica:6379"}, a.primaries())
+}
+
+func TestMembership_partition(t *testing.T) {
+	t.Parallel()
+
+	network := gossip.NewMemoryNetwork()
+	a := startNode(t, network, "a", "", firstThird)
+	startNode(t, network, "b", "", secondThird)
+	startNode(t, network, "c", "", lastThird)
+	replica := startNode(t, network, "replica", "a")
+
+	requireMember(t, replica.Membership, alive("c", "", lastThird))
+
+	// A replica cut off from the cluster suspects, then fails, every other member.
+	network.Partition([]string{"replica"})
+
+	require.Eventually(t, func() bool {
+		return member(t, replica.Membership, "a").State == gossip.MemberSuspect
+	}, waitFor, time.Millisecond)
+	require.Eventually(t, func() bool {
+		return member(t, replica.Membership, "a").State == gossip.MemberFailed &&
+			member(t, a.Membership, "replica").State == gossip.MemberFailed
+	}, waitFor, interval)
+
+	// It does not see a majority of the primaries, so it does not take over the slots of its primary.
+	time.Sleep(failTimeout)
+	assert.Equal(t, "a", member(t, replica.Membership, "replica").PrimaryID)
+	assert.Equal(t, []hash.Range{firstThird}, member(t, a.Membership, "a").Slots)
+
+	network.Heal()
+	requireMember(t, replica.Membership, alive("a", "", firstThird))
+	requireMember(t, a.Membership, alive("replica", "a"))
+}
+
+func TestMembership_ClaimSlots(t *testing.T) {
+	t.Parallel()
+
+	network := gossip.NewMemoryNetwork()
+	a := startNode(t, network, "a", "", hash.Range{Begin: 0, End: 10922})
+	b := startNode(t, network, "b", "", lastThird)
+
+	requireMember(t, a.Membership, alive("b", "", lastThird))
+
+	b.ClaimSlots(secondThird)
+
+	for _, node := range []*node{a, b} {
+		requireMember(t, node.Membership, alive("a", "", firstThird))
+		requireMember(t, node.Membership, alive("b", "", hash.Range{Begin: secondThird.Begin, End: lastThird.End}))
+	}
+	require.Eventually(t, func() bool {
+		return a.db.SlotState(secondThird.Begin).Owner == "b:6379"
+	}, waitFor, interval)
+	assert.Empty(t, b.db.SlotState(secondThird.Begin).Owner)
+}
+
+func TestMembership_invalidMessage(t *testing.T) {
+	t.Parallel()
+
+	network := gossip.NewMemoryNetwork()
+	errs := make(chan error, 10)
+	membership := gossip.New(gossip.Config{
+		ID:               "",
+		Address:          "a:6379",
+		Transport:        network.Transport("a"),
+		Seeds:            nil,
+		Slots:            nil,
+		PrimaryID:        "",
+		Database:         nil,
+		SlotCount:        0,
+		ReplicaOfHandler: nil,
+		Interval:         interval,
+		Fanout:           0,
+		SuspectTimeout:   0,
+		FailTimeout:      0,
+		ErrorHandler: func(err error) {
+			errs <- err
+		},
+	})
+	defer membership.Close()
+
+	sender := network.Transport("sender")
+	for _, message := range [][]byte{{}, {2}, {1, 1}, {1, 0, 0}} {
+		require.NoError(t, sender.Send(context.Background(), "a", message))
+
+		select {
+		case err := <-errs:
+			var gossipErr *errors.Error[gossip.GossipErr]
+			require.ErrorAs(t, err, &gossipErr)
+			assert.Equal(t, gossip.GossipErrInvalidMessage, gossipErr.Cause)
+		case <-time.After(waitFor):
+			require.Fail(t, "no error for message", "%v", message)
+		}
+	}
+
+	require.Error(t, sender.Send(context.Background(), "missing", []byte{1}))
+
+	// The ID defaults to the address.
+	assert.Equal(t, []gossip.Member{{
+		ID:            "a:6379",
+		Address:       "a:6379",
+		GossipAddress: "a",
+		PrimaryID:     "",
+		Slots:         nil,
+		Epoch:         0,
+		State:         gossip.MemberAlive,
+	}}, membership.Members())
+}
+
+func TestMembership_slotCount(t *testing.T) {
+	t.Parallel()
+
+	network := gossip.NewMemoryNetwork()
+	errs := make(chan error, 10)
+	newMembership := func(id string, slotCount int, slots ...hash.Range) *gossip.Membership {
+		membership := gossip.New(gossip.Config{
+			ID:               id,
+			Address:          id + ":6379",
+			Transport:        network.Transport(id),
+			Seeds:            []string{"a"},
+			Slots:            slots,
+			PrimaryID:        "",
+			Database:         nil,
+			SlotCount:        slotCount,
+			ReplicaOfHandler: nil,
+			Interval:         interval,
+			Fanout:           0,
+			SuspectTimeout:   0,
+			FailTimeout:      0,
+			ErrorHandler: func(err error) {
+				errs <- err
+			},
+		})
+		t.Cleanup(membership.Close)
+		return membership
+	}
+	a := newMembership("a", 1024, hash.Range{Begin: 0, End: 1023})
+
+	// Claims of slots from the slot count up are rejected.
+	assert.Panics(t, func() {
+		a.ClaimSlots(hash.Range{Begin: 1000, End: 1024})
+	})
+	assert.Panics(t, func() {
+		newMembership("b", 1024, hash.Range{Begin: 1024, End: 1024})
+	})
+	newMembership("b", int(hash.MaxHashSlot), hash.Range{Begin: 2000, End: 2000})
+	select {
+	case err := <-errs:
+		var gossipErr *errors.Error[gossip.GossipErr]
+		require.ErrorAs(t, err, &gossipErr)
+		assert.Equal(t, gossip.GossipErrInvalidMessage, gossipErr.Cause)
+	case <-time.After(waitFor):
+		require.Fail(t, "no error for a claim above the slot count")
+	}
+	assert.Equal(t, []hash.Range{{Begin: 0, End: 1023}}, member(t, a, "a").Slots)
+}
+
+func TestUDPTransport(t *testing.T) {
+	t.Parallel()
+
+	var transports []*gossip.UDPTransport
+	for range 2 {
+		transport, err := gossip.ListenUDP("127.0.0.1:0")
+		require.Nil(t, err)
+		t.Cleanup(func() {
+			_ = transport.Close()
+		})
+		transports = append(transports, transport)
+	}
+
+	var memberships []*gossip.Membership
+	for index, transport := range transports {
+		var slots []hash.Range
+		if index == 0 {
+			slots = []hash.Range{{Begin: 0, End: hash.MaxHashSlot - 1}}
+		}
+		membership := gossip.New(gossip.Config{
+			ID:               "",
+			Address:          transport.Address(),
+			Transport:        transport,
+			Seeds:            []string{transports[0].Address()},
+			Slots:            slots,
+			PrimaryID:        "",
+			Database:         nil,
+			SlotCount:        0,
+			ReplicaOfHandler: nil,
+			Interval:         interval,
+			Fanout:           0,
+			SuspectTimeout:   0,
+			FailTimeout:      0,
+			ErrorHandler:     nil,
+		})
+		t.Cleanup(membership.Close)
+		memberships = append(memberships, membership)
+	}
+
+	require.Eventually(t, func() bool {
+		return len(memberships[0].Members()) == 2 && len(memberships[1].Members()) == 2
+	}, waitFor, interval)
+	assert.Equal(t, []hash.Range{{Begin: 0, End: hash.MaxHashSlot - 1}}, member(t, memberships[1], transports[0].Address()).Slots)
+}
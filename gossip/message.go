@@ -0,0 +1,128 @@
+package gossip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// messageVersion is the first byte of every message, which is incremented whenever the encoding changes.
+const messageVersion = 1
+
+// record of a member, as gossiped between nodes. Records with a higher heartbeat replace older records of the member.
+type record struct {
+	id            string
+	address       string
+	gossipAddress string
+	primaryID     string
+	heartbeat     uint64
+	epoch         uint64
+	slots         []hash.Range
+}
+
+// encodeMessage of the records of every known member:
+//
+//	version | uvarint count | records...
+//
+// where each record is its strings, prefixed by their uvarint length, then the uvarint heartbeat, epoch, number of
+// slot ranges and the begin and end of each range.
+func encodeMessage(records []record) []byte {
+	message := []byte{messageVersion}
+	message = binary.AppendUvarint(message, uint64(len(records)))
+	for _, record := range records {
+		for _, value := range []string{record.id, record.address, record.gossipAddress, record.primaryID} {
+			message = binary.AppendUvarint(message, uint64(len(value)))
+			message = append(message, value...)
+		}
+		message = binary.AppendUvarint(message, record.heartbeat)
+		message = binary.AppendUvarint(message, record.epoch)
+		message = binary.AppendUvarint(message, uint64(len(record.slots)))
+		for _, slots := range record.slots {
+			message = binary.AppendUvarint(message, uint64(slots.Begin))
+			message = binary.AppendUvarint(message, uint64(slots.End))
+		}
+	}
+	return message
+}
+
+// decodeMessage of records, rejecting claims of slots from the slot count up.
+func decodeMessage(message []byte, slotCount int) ([]record, *errors.Error[GossipErr]) {
+	if len(message) == 0 || message[0] != messageVersion {
+		return nil, errors.New(GossipErrInvalidMessage, "unsupported message version")
+	}
+	reader := bytes.NewReader(message[1:])
+
+	count, err := readCount(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]record, 0, count)
+	for range count {
+		var fields [4]string
+		for index := range fields {
+			length, err := readCount(reader)
+			if err != nil {
+				return nil, err
+			}
+			value := make([]byte, length)
+			if _, readErr := io.ReadFull(reader, value); readErr != nil {
+				return nil, errors.New(GossipErrInvalidMessage, "message cut short")
+			}
+			fields[index] = string(value)
+		}
+
+		heartbeat, heartbeatErr := binary.ReadUvarint(reader)
+		epoch, epochErr := binary.ReadUvarint(reader)
+		if heartbeatErr != nil || epochErr != nil {
+			return nil, errors.New(GossipErrInvalidMessage, "message cut short")
+		}
+
+		rangeCount, err := readCount(reader)
+		if err != nil {
+			return nil, err
+		}
+		slots := make([]hash.Range, 0, rangeCount)
+		for range rangeCount {
+			begin, beginErr := binary.ReadUvarint(reader)
+			end, endErr := binary.ReadUvarint(reader)
+			if beginErr != nil || endErr != nil {
+				return nil, errors.New(GossipErrInvalidMessage, "message cut short")
+			}
+			if begin > end || end >= uint64(slotCount) { //nolint:gosec // reason: slot count is never negative
+				return nil, errors.New(GossipErrInvalidMessage, "invalid slot range %d-%d", begin, end)
+			}
+			slots = append(slots, hash.Range{Begin: hash.Slot(begin), End: hash.Slot(end)})
+		}
+
+		records = append(records, record{
+			id:            fields[0],
+			address:       fields[1],
+			gossipAddress: fields[2],
+			primaryID:     fields[3],
+			heartbeat:     heartbeat,
+			epoch:         epoch,
+			slots:         slots,
+		})
+	}
+
+	if reader.Len() != 0 {
+		return nil, errors.New(GossipErrInvalidMessage, "%d bytes after the last record", reader.Len())
+	}
+	return records, nil
+}
+
+// readCount of the items that follow, which cannot be more than the bytes left since every item takes at least a byte.
+func readCount(reader *bytes.Reader) (int, *errors.Error[GossipErr]) {
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, errors.New(GossipErrInvalidMessage, "message cut short")
+	}
+	if count > uint64(reader.Len()) {
+		return 0, errors.New(GossipErrInvalidMessage, "count %d is longer than the message", count)
+	}
+	return int(count), nil
+}
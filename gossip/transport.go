@@ -0,0 +1,191 @@
+package gossip
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Transport of gossip messages between nodes, which are addressed by the address of their transport.
+// Messages may be lost, duplicated or reordered, which gossip recovers from in later rounds.
+type Transport interface {
+	// Address other nodes send messages to this node at.
+	Address() string
+	// Send a message to the node at the address.
+	Send(ctx context.Context, address string, message []byte) error
+	// Receive the next message sent to the node, until the context is done.
+	Receive(ctx context.Context) ([]byte, error)
+}
+
+// memoryQueueSize of the messages waiting to be received by each in-memory transport, after which messages are dropped.
+const memoryQueueSize = 256
+
+// MemoryNetwork connects in-memory transports in the same process, such as the nodes of a test, and simulates
+// partitions between them.
+type MemoryNetwork struct {
+	transports map[string]*MemoryTransport
+	// partitions of each address. Addresses in different partitions cannot reach each other.
+	partitions map[string]int
+	mutex      sync.Mutex
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		transports: map[string]*MemoryTransport{},
+		partitions: map[string]int{},
+		mutex:      sync.Mutex{},
+	}
+}
+
+// Transport at the address, which is created on first use.
+func (self *MemoryNetwork) Transport(address string) *MemoryTransport {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	transport, exists := self.transports[address]
+	if !exists {
+		transport = &MemoryTransport{
+			network:  self,
+			address:  address,
+			messages: make(chan []byte, memoryQueueSize),
+		}
+		self.transports[address] = transport
+	}
+	return transport
+}
+
+// Partition the network into groups of addresses that can only reach the addresses in the same group. Addresses that
+// are in no group form a group of their own.
+func (self *MemoryNetwork) Partition(groups ...[]string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.partitions = map[string]int{}
+	for index, group := range groups {
+		for _, address := range group {
+			self.partitions[address] = index + 1
+		}
+	}
+}
+
+// Heal every partition, so that every address can reach every other address.
+func (self *MemoryNetwork) Heal() {
+	self.Partition()
+}
+
+func (self *MemoryNetwork) send(from string, to string, message []byte) error {
+	self.mutex.Lock()
+	transport, exists := self.transports[to]
+	reachable := self.partitions[from] == self.partitions[to]
+	self.mutex.Unlock()
+
+	if !exists {
+		return errors.New(GossipErrTransport, "no node at %s", to)
+	}
+	if !reachable {
+		// Messages across a partition are lost, as they would be on a real network.
+		return nil
+	}
+
+	select {
+	case transport.messages <- message:
+	default:
+	}
+	return nil
+}
+
+// MemoryTransport of a node on a MemoryNetwork.
+type MemoryTransport struct {
+	network  *MemoryNetwork
+	address  string
+	messages chan []byte
+}
+
+func (self *MemoryTransport) Address() string {
+	return self.address
+}
+
+func (self *MemoryTransport) Send(_ context.Context, address string, message []byte) error {
+	return self.network.send(self.address, address, message)
+}
+
+func (self *MemoryTransport) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case message := <-self.messages:
+		return message, nil
+	case <-ctx.Done():
+		return nil, errors.NewFromError(GossipErrClosed, ctx.Err())
+	}
+}
+
+// udpMaxMessageBytes that fit in a UDP datagram, which limits the number of nodes gossiped over UDP to a few hundred.
+const udpMaxMessageBytes = 65507
+
+// UDPTransport sends each message in a single UDP datagram.
+type UDPTransport struct {
+	conn net.PacketConn
+}
+
+// ListenUDP for gossip messages on the address, such as ":7946".
+func ListenUDP(address string) (*UDPTransport, *errors.Error[GossipErr]) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, errors.NewFromError(GossipErrTransport, err)
+	}
+	return &UDPTransport{
+		conn: conn,
+	}, nil
+}
+
+func (self *UDPTransport) Address() string {
+	return self.conn.LocalAddr().String()
+}
+
+func (self *UDPTransport) Send(ctx context.Context, address string, message []byte) error {
+	if len(message) > udpMaxMessageBytes {
+		return errors.New(GossipErrTransport, "message of %d bytes does not fit in a datagram", len(message))
+	}
+
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return errors.NewFromError(GossipErrTransport, err)
+	}
+
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		if err := self.conn.SetWriteDeadline(deadline); err != nil {
+			return errors.NewFromError(GossipErrTransport, err)
+		}
+	}
+	if _, err := self.conn.WriteTo(message, udpAddress); err != nil {
+		return errors.NewFromError(GossipErrTransport, err)
+	}
+	return nil
+}
+
+func (self *UDPTransport) Receive(ctx context.Context) ([]byte, error) {
+	stop := context.AfterFunc(ctx, func() {
+		_ = self.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buffer := make([]byte, udpMaxMessageBytes)
+	length, _, err := self.conn.ReadFrom(buffer)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.NewFromError(GossipErrClosed, ctx.Err())
+		}
+		return nil, errors.NewFromError(GossipErrTransport, err)
+	}
+	return buffer[:length], nil
+}
+
+// Close the UDP socket.
+func (self *UDPTransport) Close() error {
+	if err := self.conn.Close(); err != nil {
+		return errors.NewFromError(GossipErrTransport, err)
+	}
+	return nil
+}
@@ -1,15 +1,12 @@
 package hash
 
-import (
-	"github.com/wspowell/datkey/hash/internal/hashtag"
-)
-
 type Slot uint16
 
 const MaxHashSlot Slot = 16384
 
+// ToSlot of a key as Redis Cluster partitions keys, see NewCRC16Partitioner.
 func ToSlot(key string) Slot {
-	return Slot(hashtag.ToSlot(key))
+	return redisPartitioner.Slot(key)
 }
 
 type Range struct {
@@ -21,9 +18,7 @@ func (self Range) Contains(testSlot Slot) bool {
 	return self.Begin <= testSlot && testSlot <= self.End
 }
 
-// TODO: Not tested.
+// Overlaps is true when the ranges share at least one slot.
 func (self Range) Overlaps(other Range) bool {
-	return (other.Begin <= self.Begin && self.Begin <= other.End) ||
-		(other.Begin <= self.End && self.End <= other.End) ||
-		other.Overlaps(self)
+	return self.Begin <= other.End && other.Begin <= self.End
 }
@@ -99,3 +99,29 @@ func Test_Range(t *testing.T) {
 		})
 	}
 }
+
+func Test_Range_Overlaps(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		left     hash.Range
+		right    hash.Range
+		expected bool
+	}{
+		{left: hash.Range{Begin: 0, End: 5}, right: hash.Range{Begin: 6, End: 9}, expected: false},
+		{left: hash.Range{Begin: 0, End: 5}, right: hash.Range{Begin: 5, End: 9}, expected: true},
+		{left: hash.Range{Begin: 0, End: 9}, right: hash.Range{Begin: 3, End: 4}, expected: true},
+		{left: hash.Range{Begin: 3, End: 3}, right: hash.Range{Begin: 3, End: 3}, expected: true},
+		{left: hash.Range{Begin: 3, End: 3}, right: hash.Range{Begin: 4, End: 4}, expected: false},
+		{left: hash.Range{Begin: 0, End: 16383}, right: hash.Range{Begin: 16383, End: 16383}, expected: true},
+	}
+	for index := range testCases {
+		testCase := testCases[index]
+		t.Run(fmt.Sprintf("[%d, %d] overlaps [%d, %d] = %t", testCase.left.Begin, testCase.left.End, testCase.right.Begin, testCase.right.End, testCase.expected), func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, testCase.expected, testCase.left.Overlaps(testCase.right))
+			assert.Equal(t, testCase.expected, testCase.right.Overlaps(testCase.left))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package xxhash implements the 64-bit xxHash algorithm, XXH64 with a seed of zero.
+//
+// See: https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+package xxhash
+
+import (
+	"math/bits"
+)
+
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// Sum64String of the bytes of the string.
+func Sum64String(input string) uint64 {
+	length := len(input)
+	offset := 0
+
+	var hash uint64
+	if length >= 32 {
+		// The accumulators start from the seed, wrapping around as the constants do not fit.
+		primes := [2]uint64{prime1, prime2}
+		accumulator1 := primes[0] + primes[1]
+		accumulator2 := prime2
+		accumulator3 := uint64(0)
+		accumulator4 := -primes[0]
+		for ; offset+32 <= length; offset += 32 {
+			accumulator1 = round(accumulator1, read64(input, offset))
+			accumulator2 = round(accumulator2, read64(input, offset+8))
+			accumulator3 = round(accumulator3, read64(input, offset+16))
+			accumulator4 = round(accumulator4, read64(input, offset+24))
+		}
+
+		hash = bits.RotateLeft64(accumulator1, 1) + bits.RotateLeft64(accumulator2, 7) +
+			bits.RotateLeft64(accumulator3, 12) + bits.RotateLeft64(accumulator4, 18)
+		hash = mergeRound(hash, accumulator1)
+		hash = mergeRound(hash, accumulator2)
+		hash = mergeRound(hash, accumulator3)
+		hash = mergeRound(hash, accumulator4)
+	} else {
+		hash = prime5
+	}
+
+	hash += uint64(length)
+	for ; offset+8 <= length; offset += 8 {
+		hash ^= round(0, read64(input, offset))
+		hash = bits.RotateLeft64(hash, 27)*prime1 + prime4
+	}
+	if offset+4 <= length {
+		hash ^= uint64(read32(input, offset)) * prime1
+		hash = bits.RotateLeft64(hash, 23)*prime2 + prime3
+		offset += 4
+	}
+	for ; offset < length; offset++ {
+		hash ^= uint64(input[offset]) * prime5
+		hash = bits.RotateLeft64(hash, 11) * prime1
+	}
+
+	hash ^= hash >> 33
+	hash *= prime2
+	hash ^= hash >> 29
+	hash *= prime3
+	hash ^= hash >> 32
+	return hash
+}
+
+func round(accumulator uint64, lane uint64) uint64 {
+	accumulator += lane * prime2
+	accumulator = bits.RotateLeft64(accumulator, 31)
+	return accumulator * prime1
+}
+
+func mergeRound(hash uint64, accumulator uint64) uint64 {
+	hash ^= round(0, accumulator)
+	return hash*prime1 + prime4
+}
+
+// read64 little endian bytes of the input at the offset, without copying the string to a byte slice.
+func read64(input string, offset int) uint64 {
+	return uint64(read32(input, offset)) | uint64(read32(input, offset+4))<<32
+}
+
+func read32(input string, offset int) uint32 {
+	return uint32(input[offset]) | uint32(input[offset+1])<<8 | uint32(input[offset+2])<<16 | uint32(input[offset+3])<<24
+}
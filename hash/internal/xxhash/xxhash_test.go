@@ -0,0 +1,35 @@
+package xxhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wspowell/datkey/hash/internal/xxhash"
+)
+
+func Test_Sum64String(t *testing.T) {
+	t.Parallel()
+
+	// Reference values of XXH64 with a seed of zero.
+	testCases := map[string]uint64{
+		"":     0xef46db3751d8e999,
+		"a":    0xd24ec4f1a98c6e5b,
+		"as":   0x1c330fb2d66be179,
+		"asd":  0x631c37ce72a97393,
+		"asdf": 0x415872f599cea71e,
+		"abc":  0x44bc2cf5ad770999,
+		"Nobody inspects the spammish repetition": 0xfbcea83c8a378bf1,
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, xxhash.Sum64String(input), "%q", input)
+	}
+
+	// Every length up to a few blocks hashes without reading past the input.
+	seen := map[uint64]bool{}
+	for length := range 100 {
+		seen[xxhash.Sum64String(strings.Repeat("x", length))] = true
+	}
+	assert.Len(t, seen, 100)
+}
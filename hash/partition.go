@@ -0,0 +1,160 @@
+package hash
+
+import (
+	"fmt"
+
+	"github.com/wspowell/datkey/hash/internal/hashtag"
+	"github.com/wspowell/datkey/hash/internal/xxhash"
+)
+
+// Partitioner of keys into slots.
+//
+// The partitioners of this package hash the tag of a key, see Tag, so that keys with the same tag are in the same
+// slot and commands across them run on one node. Every key, including the empty key, is always in the same slot.
+type Partitioner interface {
+	// Slot of the key, below SlotCount.
+	Slot(key string) Slot
+	// SlotCount keys are partitioned into, from 1 up to MaxHashSlot.
+	SlotCount() int
+}
+
+// redisPartitioner partitions keys as Redis Cluster does, which ToSlot uses.
+var redisPartitioner = NewCRC16Partitioner(int(MaxHashSlot)) //nolint:gochecknoglobals // reason: stateless and never modified
+
+// Tag of a key that is hashed to find its slot, which is the part of the key between the first { and the next },
+// such as "user" of "{user}.name". Keys without a tag, or with an empty tag, are hashed whole.
+func Tag(key string) string {
+	return hashtag.Key(key)
+}
+
+type crc16Partitioner struct {
+	slotCount int
+}
+
+// NewCRC16Partitioner of keys by the CRC16 of their tag, modulo the slot count. With MaxHashSlot slots, keys are in the
+// same slots as in Redis Cluster. Panics if the slot count is not from 1 up to MaxHashSlot.
+func NewCRC16Partitioner(slotCount int) Partitioner {
+	requireSlotCount(slotCount)
+	return crc16Partitioner{
+		slotCount: slotCount,
+	}
+}
+
+func (self crc16Partitioner) Slot(key string) Slot {
+	return Slot(int(crc16(Tag(key))) % self.slotCount)
+}
+
+func (self crc16Partitioner) SlotCount() int {
+	return self.slotCount
+}
+
+type xxhashPartitioner struct {
+	slotCount int
+}
+
+// NewXXHashPartitioner of keys by the 64-bit xxHash of their tag, modulo the slot count, which spreads similar keys more
+// evenly than CRC16. Panics if the slot count is not from 1 up to MaxHashSlot.
+func NewXXHashPartitioner(slotCount int) Partitioner {
+	requireSlotCount(slotCount)
+	return xxhashPartitioner{
+		slotCount: slotCount,
+	}
+}
+
+func (self xxhashPartitioner) Slot(key string) Slot {
+	return Slot(xxhash.Sum64String(Tag(key)) % uint64(self.slotCount))
+}
+
+func (self xxhashPartitioner) SlotCount() int {
+	return self.slotCount
+}
+
+type jumpPartitioner struct {
+	slotCount int
+}
+
+// NewJumpPartitioner of keys by the jump consistent hash of the 64-bit xxHash of their tag. Changing the slot count
+// moves only the keys of the slots added or removed, rather than almost every key as with a modulo.
+// Panics if the slot count is not from 1 up to MaxHashSlot.
+//
+// See: https://arxiv.org/abs/1406.2294
+func NewJumpPartitioner(slotCount int) Partitioner {
+	requireSlotCount(slotCount)
+	return jumpPartitioner{
+		slotCount: slotCount,
+	}
+}
+
+func (self jumpPartitioner) Slot(key string) Slot {
+	return Slot(jump(xxhash.Sum64String(Tag(key)), self.slotCount))
+}
+
+func (self jumpPartitioner) SlotCount() int {
+	return self.slotCount
+}
+
+type funcPartitioner struct {
+	slotCount int
+	hash      func(key string) uint64
+}
+
+// NewFuncPartitioner of keys by a hash function, modulo the slot count. The function is given the whole key, so it
+// should hash the Tag of the key to keep keys with the same tag in the same slot. Panics if the slot count is not from
+// 1 up to MaxHashSlot.
+func NewFuncPartitioner(slotCount int, hash func(key string) uint64) Partitioner {
+	requireSlotCount(slotCount)
+	return funcPartitioner{
+		slotCount: slotCount,
+		hash:      hash,
+	}
+}
+
+func (self funcPartitioner) Slot(key string) Slot {
+	return Slot(self.hash(key) % uint64(self.slotCount))
+}
+
+func (self funcPartitioner) SlotCount() int {
+	return self.slotCount
+}
+
+func requireSlotCount(slotCount int) {
+	if slotCount < 1 || slotCount > int(MaxHashSlot) {
+		panic(fmt.Sprintf("slot count %d is not from 1 up to %d", slotCount, MaxHashSlot))
+	}
+}
+
+// crc16Table of the CRC16-CCITT (XModem) checksum, as used by Redis Cluster.
+var crc16Table = func() [256]uint16 { //nolint:gochecknoglobals // reason: constant table
+	var table [256]uint16
+	for index := range table {
+		crc := uint16(index) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[index] = crc
+	}
+	return table
+}()
+
+func crc16(key string) uint16 {
+	var crc uint16
+	for index := range len(key) {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[index]]
+	}
+	return crc
+}
+
+// jump consistent hash of a key into one of the buckets.
+func jump(key uint64, buckets int) int {
+	bucket, next := int64(-1), int64(0)
+	for next < int64(buckets) {
+		bucket = next
+		key = key*2862933555777941757 + 1
+		next = int64(float64(bucket+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(bucket)
+}
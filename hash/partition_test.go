@@ -0,0 +1,126 @@
+package hash_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey/hash"
+)
+
+func partitioners(slotCount int) map[string]hash.Partitioner {
+	return map[string]hash.Partitioner{
+		"crc16":  hash.NewCRC16Partitioner(slotCount),
+		"xxhash": hash.NewXXHashPartitioner(slotCount),
+		"jump":   hash.NewJumpPartitioner(slotCount),
+		"func": hash.NewFuncPartitioner(slotCount, func(key string) uint64 {
+			return uint64(len(hash.Tag(key)))
+		}),
+	}
+}
+
+func Test_Partitioner(t *testing.T) {
+	t.Parallel()
+
+	for _, slotCount := range []int{1, 7, 1024, int(hash.MaxHashSlot)} {
+		for name, partitioner := range partitioners(slotCount) {
+			t.Run(fmt.Sprintf("%s of %d slots", name, slotCount), func(t *testing.T) {
+				t.Parallel()
+
+				assert.Equal(t, slotCount, partitioner.SlotCount())
+				for index := range 1000 {
+					key := fmt.Sprintf("key-%d", index)
+					slot := partitioner.Slot(key)
+					assert.Less(t, int(slot), slotCount)
+					assert.Equal(t, slot, partitioner.Slot(key))
+
+					// Keys with the same tag are in the same slot.
+					assert.Equal(t, partitioner.Slot("{"+key+"}"), partitioner.Slot("{"+key+"}.other"))
+				}
+
+				// The empty key is always in the same slot.
+				assert.Equal(t, partitioner.Slot(""), partitioner.Slot(""))
+			})
+		}
+	}
+}
+
+func Test_Tag(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "user", hash.Tag("{user}.name"))
+	assert.Equal(t, "user", hash.Tag("name.{user}.{other}"))
+	assert.Equal(t, "{}.name", hash.Tag("{}.name"))
+	assert.Equal(t, "{user", hash.Tag("{user"))
+	assert.Equal(t, "", hash.Tag(""))
+}
+
+func Test_NewCRC16Partitioner(t *testing.T) {
+	t.Parallel()
+
+	redis := hash.NewCRC16Partitioner(int(hash.MaxHashSlot))
+	for index := range 1000 {
+		key := fmt.Sprintf("key-%d", index)
+		assert.Equal(t, hash.ToSlot(key), redis.Slot(key))
+	}
+
+	// The empty key is in slot 0, as in Redis Cluster.
+	assert.Equal(t, hash.Slot(0), hash.ToSlot(""))
+}
+
+func Test_NewXXHashPartitioner(t *testing.T) {
+	t.Parallel()
+
+	// Keys that differ in a single character are spread evenly.
+	const slotCount = 16
+	const keys = 100_000
+	partitioner := hash.NewXXHashPartitioner(slotCount)
+	counts := make([]int, slotCount)
+	for index := range keys {
+		counts[partitioner.Slot(fmt.Sprintf("tenant-a:user:%08d", index))]++
+	}
+	for slot, count := range counts {
+		assert.InEpsilon(t, keys/slotCount, count, 0.05, "slot %d", slot)
+	}
+}
+
+func Test_NewJumpPartitioner(t *testing.T) {
+	t.Parallel()
+
+	// Adding a slot moves keys only to the new slot.
+	before := hash.NewJumpPartitioner(100)
+	after := hash.NewJumpPartitioner(101)
+	moved := 0
+	for index := range 10_000 {
+		key := fmt.Sprintf("key-%d", index)
+		if before.Slot(key) != after.Slot(key) {
+			assert.Equal(t, hash.Slot(100), after.Slot(key))
+			moved++
+		}
+	}
+	assert.InDelta(t, 10_000/101, moved, 50)
+}
+
+func Test_NewFuncPartitioner(t *testing.T) {
+	t.Parallel()
+
+	// Hashes are taken modulo the slot count.
+	partitioner := hash.NewFuncPartitioner(10, func(key string) uint64 {
+		return uint64(len(key))
+	})
+	assert.Equal(t, hash.Slot(3), partitioner.Slot("abc"))
+	assert.Equal(t, hash.Slot(3), partitioner.Slot("0123456789abc"))
+}
+
+func Test_Partitioner_invalidSlotCount(t *testing.T) {
+	t.Parallel()
+
+	for _, slotCount := range []int{-1, 0, int(hash.MaxHashSlot) + 1} {
+		require.Panics(t, func() { hash.NewCRC16Partitioner(slotCount) })
+		require.Panics(t, func() { hash.NewXXHashPartitioner(slotCount) })
+		require.Panics(t, func() { hash.NewJumpPartitioner(slotCount) })
+		require.Panics(t, func() { hash.NewFuncPartitioner(slotCount, nil) })
+	}
+}
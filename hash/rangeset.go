@@ -0,0 +1,239 @@
+package hash
+
+import (
+	"iter"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type RangeErr errors.Cause
+
+const (
+	RangeErrInternal = RangeErr(iota + 1)
+	// RangeErrInvalid is returned when a range set cannot be parsed.
+	RangeErrInvalid
+)
+
+// RangeSet of slots, kept as sorted ranges that neither overlap nor touch, so that equal sets have equal ranges.
+// The zero value is the empty set. Operations return a new set and never modify the sets they are given.
+type RangeSet struct {
+	ranges []Range
+}
+
+// NewRangeSet of the slots in the ranges, which may overlap and be in any order. Ranges that begin after they end are
+// empty, and slots from MaxHashSlot up are dropped.
+func NewRangeSet(ranges ...Range) RangeSet {
+	normalized := make([]Range, 0, len(ranges))
+	for _, slots := range ranges {
+		if slots.Begin > slots.End || slots.Begin >= MaxHashSlot {
+			continue
+		}
+		slots.End = min(slots.End, MaxHashSlot-1)
+		normalized = append(normalized, slots)
+	}
+	slices.SortFunc(normalized, func(left Range, right Range) int {
+		return int(left.Begin) - int(right.Begin)
+	})
+
+	merged := normalized[:0]
+	for _, slots := range normalized {
+		if len(merged) != 0 && int(slots.Begin) <= int(merged[len(merged)-1].End)+1 {
+			merged[len(merged)-1].End = max(merged[len(merged)-1].End, slots.End)
+			continue
+		}
+		merged = append(merged, slots)
+	}
+	return RangeSet{
+		ranges: merged,
+	}
+}
+
+// AllSlots from zero up to the slot count of a partitioner, see Partitioner.SlotCount.
+// Panics if the slot count is not from 1 up to MaxHashSlot.
+func AllSlots(slotCount int) RangeSet {
+	requireSlotCount(slotCount)
+	return NewRangeSet(Range{Begin: 0, End: Slot(slotCount - 1)})
+}
+
+// ParseRangeSet of slots and ranges of slots separated by commas, such as "0-5460,10923-16383". The empty string is
+// the empty set.
+func ParseRangeSet(value string) (RangeSet, *errors.Error[RangeErr]) {
+	if value == "" {
+		return RangeSet{}, nil //nolint:exhaustruct // reason: the empty set
+	}
+
+	fields := strings.Split(value, ",")
+	ranges := make([]Range, 0, len(fields))
+	for _, field := range fields {
+		beginText, endText, isRange := strings.Cut(field, "-")
+		if !isRange {
+			endText = beginText
+		}
+		begin, beginErr := strconv.ParseUint(beginText, 10, 16)
+		end, endErr := strconv.ParseUint(endText, 10, 16)
+		if beginErr != nil || endErr != nil || begin > end || end >= uint64(MaxHashSlot) {
+			return RangeSet{}, errors.New(RangeErrInvalid, "invalid slot range: %q", field) //nolint:exhaustruct // reason: the empty set
+		}
+		ranges = append(ranges, Range{Begin: Slot(begin), End: Slot(end)})
+	}
+	return NewRangeSet(ranges...), nil
+}
+
+// String of the set in the format read by ParseRangeSet, with single slots written without a range.
+func (self RangeSet) String() string {
+	var builder strings.Builder
+	for index, slots := range self.ranges {
+		if index != 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(strconv.Itoa(int(slots.Begin)))
+		if slots.Begin != slots.End {
+			builder.WriteByte('-')
+			builder.WriteString(strconv.Itoa(int(slots.End)))
+		}
+	}
+	return builder.String()
+}
+
+// Ranges of the set, sorted and merged.
+func (self RangeSet) Ranges() []Range {
+	return slices.Clone(self.ranges)
+}
+
+// All slots of the set in ascending order.
+func (self RangeSet) All() iter.Seq[Slot] {
+	return func(yield func(Slot) bool) {
+		for _, slots := range self.ranges {
+			for slot := int(slots.Begin); slot <= int(slots.End); slot++ {
+				if !yield(Slot(slot)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Len is the number of slots in the set.
+func (self RangeSet) Len() int {
+	count := 0
+	for _, slots := range self.ranges {
+		count += int(slots.End-slots.Begin) + 1
+	}
+	return count
+}
+
+func (self RangeSet) IsEmpty() bool {
+	return len(self.ranges) == 0
+}
+
+func (self RangeSet) Equal(other RangeSet) bool {
+	return slices.Equal(self.ranges, other.ranges)
+}
+
+func (self RangeSet) Contains(slot Slot) bool {
+	index := sort.Search(len(self.ranges), func(index int) bool {
+		return self.ranges[index].End >= slot
+	})
+	return index < len(self.ranges) && self.ranges[index].Contains(slot)
+}
+
+// Union of the slots in either set.
+func (self RangeSet) Union(other RangeSet) RangeSet {
+	return NewRangeSet(append(slices.Clone(self.ranges), other.ranges...)...)
+}
+
+// Intersect keeps the slots in both sets.
+func (self RangeSet) Intersect(other RangeSet) RangeSet {
+	var ranges []Range
+	for left, right := 0, 0; left < len(self.ranges) && right < len(other.ranges); {
+		begin := max(self.ranges[left].Begin, other.ranges[right].Begin)
+		end := min(self.ranges[left].End, other.ranges[right].End)
+		if begin <= end {
+			ranges = append(ranges, Range{Begin: begin, End: end})
+		}
+		if self.ranges[left].End < other.ranges[right].End {
+			left++
+		} else {
+			right++
+		}
+	}
+	return RangeSet{
+		ranges: ranges,
+	}
+}
+
+// Subtract removes the slots in the other set.
+func (self RangeSet) Subtract(other RangeSet) RangeSet {
+	var ranges []Range
+	right := 0
+	for _, slots := range self.ranges {
+		// Skip the ranges of the other set that end before this range.
+		for right < len(other.ranges) && other.ranges[right].End < slots.Begin {
+			right++
+		}
+
+		begin := int(slots.Begin)
+		for index := right; index < len(other.ranges) && other.ranges[index].Begin <= slots.End; index++ {
+			if int(other.ranges[index].Begin) > begin {
+				ranges = append(ranges, Range{Begin: Slot(begin), End: other.ranges[index].Begin - 1})
+			}
+			begin = int(other.ranges[index].End) + 1
+		}
+		if begin <= int(slots.End) {
+			ranges = append(ranges, Range{Begin: Slot(begin), End: slots.End})
+		}
+	}
+	return RangeSet{
+		ranges: ranges,
+	}
+}
+
+// Split the set into count sets of adjacent slots, in order, whose sizes differ by at most one slot. Splitting
+// AllSlots in three gives the slots 0-5460, 5461-10922 and 10923-16383, as Redis assigns them to three primaries.
+func (self RangeSet) Split(count int) []RangeSet {
+	if count <= 0 {
+		return nil
+	}
+
+	total := self.Len()
+	parts := make([]RangeSet, 0, count)
+	begin := 0
+	for part := range count {
+		// Round each boundary to the nearest slot, so that the larger parts are spread across the split.
+		end := ((part+1)*total*2 + count) / (2 * count)
+		parts = append(parts, self.slice(begin, end))
+		begin = end
+	}
+	return parts
+}
+
+// SplitEvenly every slot, up to the slot count, between count nodes.
+// Panics if the slot count is not from 1 up to MaxHashSlot.
+func SplitEvenly(slotCount int, count int) []RangeSet {
+	return AllSlots(slotCount).Split(count)
+}
+
+// slice of the set from its begin-th slot up to, but not including, its end-th slot.
+func (self RangeSet) slice(begin int, end int) RangeSet {
+	var ranges []Range
+	offset := 0
+	for _, slots := range self.ranges {
+		length := int(slots.End-slots.Begin) + 1
+		from := max(begin, offset)
+		to := min(end, offset+length)
+		if from < to {
+			ranges = append(ranges, Range{
+				Begin: slots.Begin + Slot(from-offset),
+				End:   slots.Begin + Slot(to-offset-1),
+			})
+		}
+		offset += length
+	}
+	return RangeSet{
+		ranges: ranges,
+	}
+}
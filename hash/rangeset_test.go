@@ -0,0 +1,202 @@
+package hash_test
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// propertyRuns of randomly generated sets each property is checked against.
+const propertyRuns = 500
+
+// slotSet is the model a range set is checked against, with a flag for every slot.
+type slotSet [hash.MaxHashSlot]bool
+
+func (self *slotSet) rangeSet() hash.RangeSet {
+	var ranges []hash.Range
+	for slot, contains := range self {
+		if contains {
+			ranges = append(ranges, hash.Range{Begin: hash.Slot(slot), End: hash.Slot(slot)})
+		}
+	}
+	return hash.NewRangeSet(ranges...)
+}
+
+// randomRanges that may overlap, touch or be empty, clustered at the ends of the slots where edge cases are.
+func randomRanges(random *rand.Rand) ([]hash.Range, *slotSet) {
+	var model slotSet
+	ranges := make([]hash.Range, random.IntN(6))
+	for index := range ranges {
+		begin := hash.Slot(random.IntN(int(hash.MaxHashSlot)))
+		if random.IntN(4) == 0 {
+			begin = hash.Slot(random.IntN(8))
+		}
+		end := begin + hash.Slot(random.IntN(3000))
+		if random.IntN(10) == 0 {
+			end = begin - 1
+		}
+		ranges[index] = hash.Range{Begin: begin, End: end}
+		for slot := int(begin); slot <= int(end) && slot < int(hash.MaxHashSlot); slot++ {
+			model[slot] = true
+		}
+	}
+	return ranges, &model
+}
+
+func requireModel(t *testing.T, model *slotSet, actual hash.RangeSet) {
+	t.Helper()
+
+	ranges := actual.Ranges()
+	for index, slots := range ranges {
+		require.LessOrEqual(t, slots.Begin, slots.End, "ranges %v", ranges)
+		if index != 0 {
+			require.Greater(t, int(slots.Begin), int(ranges[index-1].End)+1, "ranges %v are not merged", ranges)
+		}
+	}
+
+	var actualModel slotSet
+	for slot := range actual.All() {
+		actualModel[slot] = true
+	}
+	require.True(t, *model == actualModel, "%s does not match its model", actual)
+
+	count := 0
+	for slot, contains := range model {
+		// Contains searches the ranges, which is checked at the edges of each range and a sample of other slots.
+		if slot%97 == 0 || (slot > 0 && model[slot-1] != contains) || (slot < len(model)-1 && model[slot+1] != contains) {
+			require.Equal(t, contains, actual.Contains(hash.Slot(slot)), "slot %d of %s", slot, actual)
+		}
+		if contains {
+			count++
+		}
+	}
+	require.Equal(t, count, actual.Len())
+}
+
+func Test_RangeSet_properties(t *testing.T) {
+	t.Parallel()
+
+	random := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // reason: deterministic test data
+	for range propertyRuns {
+		leftRanges, leftModel := randomRanges(random)
+		rightRanges, rightModel := randomRanges(random)
+		left := hash.NewRangeSet(leftRanges...)
+		right := hash.NewRangeSet(rightRanges...)
+
+		requireModel(t, leftModel, left)
+		require.True(t, left.Equal(leftModel.rangeSet()), "%v normalized to %s", leftRanges, left)
+
+		var union, intersection, difference slotSet
+		for slot := range hash.MaxHashSlot {
+			union[slot] = leftModel[slot] || rightModel[slot]
+			intersection[slot] = leftModel[slot] && rightModel[slot]
+			difference[slot] = leftModel[slot] && !rightModel[slot]
+		}
+		requireModel(t, &union, left.Union(right))
+		requireModel(t, &intersection, left.Intersect(right))
+		requireModel(t, &difference, left.Subtract(right))
+
+		// Round trips through its string.
+		parsed, err := hash.ParseRangeSet(left.String())
+		require.Nil(t, err)
+		require.True(t, left.Equal(parsed), "%s parsed as %s", left, parsed)
+
+		// Iterates its slots in order.
+		var slots []hash.Slot
+		for slot := range left.All() {
+			slots = append(slots, slot)
+		}
+		require.Len(t, slots, left.Len())
+		require.True(t, slices.IsSorted(slots))
+
+		// Splits into adjacent parts whose sizes differ by at most one and that cover the set.
+		count := 1 + random.IntN(7)
+		parts := left.Split(count)
+		require.Len(t, parts, count)
+		var covered hash.RangeSet
+		for index, part := range parts {
+			require.InDelta(t, float64(left.Len())/float64(count), part.Len(), 1)
+			require.True(t, covered.Intersect(part).IsEmpty())
+			if index != 0 && !part.IsEmpty() && !parts[index-1].IsEmpty() {
+				previous := parts[index-1].Ranges()
+				require.Less(t, previous[len(previous)-1].End, part.Ranges()[0].Begin)
+			}
+			covered = covered.Union(part)
+		}
+		require.True(t, left.Equal(covered))
+	}
+}
+
+func Test_RangeSet_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "", hash.RangeSet{}.String())
+	assert.Equal(t, "0-16383", hash.AllSlots(int(hash.MaxHashSlot)).String())
+	assert.Equal(t, "0-1023", hash.AllSlots(1024).String())
+	assert.Equal(t, "0-2,5,7-9", hash.NewRangeSet(
+		hash.Range{Begin: 7, End: 9},
+		hash.Range{Begin: 0, End: 1},
+		hash.Range{Begin: 5, End: 5},
+		hash.Range{Begin: 2, End: 2},
+		hash.Range{Begin: 8, End: 8},
+		hash.Range{Begin: 4, End: 3},
+	).String())
+
+	// Slots past the last slot are dropped.
+	assert.Equal(t, "16000-16383", hash.NewRangeSet(
+		hash.Range{Begin: 16000, End: hash.MaxHashSlot},
+		hash.Range{Begin: hash.MaxHashSlot, End: hash.MaxHashSlot},
+	).String())
+}
+
+func Test_ParseRangeSet(t *testing.T) {
+	t.Parallel()
+
+	slots, err := hash.ParseRangeSet("0-5460,10923-16383")
+	require.Nil(t, err)
+	assert.Equal(t, []hash.Range{{Begin: 0, End: 5460}, {Begin: 10923, End: 16383}}, slots.Ranges())
+
+	slots, err = hash.ParseRangeSet("")
+	require.Nil(t, err)
+	assert.True(t, slots.IsEmpty())
+
+	for _, value := range []string{",", "a", "1-", "-1", "5-4", "0-16384", "16384", "1-2-3", " 1"} {
+		_, err := hash.ParseRangeSet(value)
+		var rangeErr *errors.Error[hash.RangeErr]
+		require.ErrorAs(t, err, &rangeErr, value)
+		assert.Equal(t, hash.RangeErrInvalid, rangeErr.Cause)
+	}
+}
+
+func Test_SplitEvenly(t *testing.T) {
+	t.Parallel()
+
+	var formatted []string
+	for _, part := range hash.SplitEvenly(int(hash.MaxHashSlot), 3) {
+		formatted = append(formatted, part.String())
+	}
+	assert.Equal(t, []string{"0-5460", "5461-10922", "10923-16383"}, formatted)
+
+	assert.Nil(t, hash.SplitEvenly(int(hash.MaxHashSlot), 0))
+	assert.Equal(t, []hash.RangeSet{hash.AllSlots(int(hash.MaxHashSlot))}, hash.SplitEvenly(int(hash.MaxHashSlot), 1))
+
+	// Only the slots up to the slot count are split.
+	formatted = nil
+	for _, part := range hash.SplitEvenly(1024, 2) {
+		formatted = append(formatted, part.String())
+	}
+	assert.Equal(t, []string{"0-511", "512-1023"}, formatted)
+	assert.Panics(t, func() {
+		hash.SplitEvenly(0, 1)
+	})
+
+	// More parts than slots leaves some parts empty.
+	parts := hash.NewRangeSet(hash.Range{Begin: 3, End: 4}).Split(4)
+	assert.Equal(t, 2, hash.NewRangeSet().Union(parts[0]).Union(parts[1]).Union(parts[2]).Union(parts[3]).Len())
+}
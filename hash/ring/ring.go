@@ -0,0 +1,187 @@
+// Package ring shards keys between nodes by consistent hashing, for nodes that do not partition keys into slots
+// between themselves, such as independent datkey servers that are not in cluster mode.
+//
+// Each node is hashed to many virtual nodes on a ring of hashes, and each key is served by the first virtual node at
+// or after the hash of the key. Adding or removing a node only moves the keys between the node and its neighbors on the
+// ring, about one in every number of nodes.
+//
+// With a load factor, keys are hashed into a fixed number of partitions instead, and each partition is given to the
+// first node on the ring with room for it, so that no node serves more than the load factor times the mean number of
+// partitions. This bounds the load of each node at the cost of moving a few more keys when nodes change.
+//
+// See: https://arxiv.org/abs/1608.01350
+package ring
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/hash/internal/xxhash"
+)
+
+const (
+	defaultVirtualNodes = 160
+	defaultPartitions   = 271
+)
+
+type Config struct {
+	// VirtualNodes of each node on the ring. More virtual nodes spread keys more evenly between the nodes.
+	// Default: 160
+	VirtualNodes int
+
+	// LoadFactor bounds the partitions of each node to this factor of the mean partitions of a node, such as 1.25.
+	// Must be above 1, if set.
+	// Default: None (0, keys are not partitioned and the load of each node is not bounded)
+	LoadFactor float64
+
+	// Partitions keys are hashed into when the load is bounded. More partitions spread keys more evenly between the
+	// nodes, but take longer to give to the nodes whenever the nodes change.
+	// Default: 271
+	Partitions int
+}
+
+// point of a virtual node on the ring.
+type point struct {
+	hash uint64
+	node string
+}
+
+// Ring of nodes that keys are sharded between. Safe for concurrent use.
+type Ring struct {
+	config Config
+	mutex  sync.RWMutex
+	nodes  []string
+	// points of the virtual nodes, in order of their hashes.
+	points []point
+	// owners of each partition, if the load is bounded.
+	owners []string
+}
+
+// New ring of the nodes, which are named by their address. Panics if the load factor is set and not above 1.
+func New(config Config, nodes ...string) *Ring {
+	if config.VirtualNodes == 0 {
+		config.VirtualNodes = defaultVirtualNodes
+	}
+
+	if config.LoadFactor != 0 && config.LoadFactor <= 1 {
+		panic("ring load factor must be above 1")
+	}
+
+	if config.Partitions == 0 {
+		config.Partitions = defaultPartitions
+	}
+
+	ring := &Ring{
+		config: config,
+		mutex:  sync.RWMutex{},
+		nodes:  nil,
+		points: nil,
+		owners: nil,
+	}
+	ring.Add(nodes...)
+	return ring
+}
+
+// Add nodes to the ring. Nodes already on the ring are not added again.
+func (self *Ring) Add(nodes ...string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, node := range nodes {
+		if slices.Contains(self.nodes, node) {
+			continue
+		}
+		self.nodes = append(self.nodes, node)
+		for virtualNode := range self.config.VirtualNodes {
+			self.points = append(self.points, point{
+				hash: xxhash.Sum64String(node + "#" + strconv.Itoa(virtualNode)),
+				node: node,
+			})
+		}
+	}
+	slices.Sort(self.nodes)
+	// Ties between the hashes of virtual nodes are broken by node, so that the ring does not depend on the order the
+	// nodes were added in.
+	slices.SortFunc(self.points, comparePoints)
+	self.partition()
+}
+
+// Remove nodes from the ring. Nodes that are not on the ring are ignored.
+func (self *Ring) Remove(nodes ...string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.nodes = slices.DeleteFunc(self.nodes, func(node string) bool {
+		return slices.Contains(nodes, node)
+	})
+	self.points = slices.DeleteFunc(self.points, func(point point) bool {
+		return slices.Contains(nodes, point.node)
+	})
+	self.partition()
+}
+
+// Nodes on the ring, in order of their names.
+func (self *Ring) Nodes() []string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	return slices.Clone(self.nodes)
+}
+
+// Node serving the key, which hashes the tag of the key, see hash.Tag, so that keys with the same tag are served by
+// the same node. Empty if the ring has no nodes.
+func (self *Ring) Node(key string) string {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if len(self.points) == 0 {
+		return ""
+	}
+
+	keyHash := xxhash.Sum64String(hash.Tag(key))
+	if self.owners != nil {
+		return self.owners[keyHash%uint64(len(self.owners))]
+	}
+	return self.points[self.search(keyHash)].node
+}
+
+// search for the first virtual node at or after the hash, wrapping around to the first virtual node of the ring.
+func (self *Ring) search(keyHash uint64) int {
+	index, _ := slices.BinarySearchFunc(self.points, keyHash, func(point point, keyHash uint64) int {
+		return cmp.Compare(point.hash, keyHash)
+	})
+	if index == len(self.points) {
+		return 0
+	}
+	return index
+}
+
+// partition the keys between the nodes, if the load is bounded. Each partition is given to the first node on the ring
+// after the hash of the partition that has fewer partitions than the bound.
+func (self *Ring) partition() {
+	if self.config.LoadFactor == 0 || len(self.nodes) == 0 {
+		self.owners = nil
+		return
+	}
+
+	bound := int(math.Ceil(float64(self.config.Partitions) / float64(len(self.nodes)) * self.config.LoadFactor))
+	loads := map[string]int{}
+	owners := make([]string, self.config.Partitions)
+	for partition := range owners {
+		index := self.search(xxhash.Sum64String("partition#" + strconv.Itoa(partition)))
+		for loads[self.points[index].node] >= bound {
+			index = (index + 1) % len(self.points)
+		}
+		owners[partition] = self.points[index].node
+		loads[owners[partition]]++
+	}
+	self.owners = owners
+}
+
+func comparePoints(left point, right point) int {
+	return cmp.Or(cmp.Compare(left.hash, right.hash), cmp.Compare(left.node, right.node))
+}
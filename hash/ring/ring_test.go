@@ -0,0 +1,218 @@
+package ring_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey/hash/ring"
+)
+
+const keys = 100_000
+
+var (
+	unbounded = ring.Config{
+		VirtualNodes: 0,
+		LoadFactor:   0,
+		Partitions:   0,
+	}
+	bounded = ring.Config{
+		VirtualNodes: 0,
+		LoadFactor:   1.25,
+		Partitions:   0,
+	}
+)
+
+func nodes(count int) []string {
+	names := make([]string, count)
+	for index := range names {
+		names[index] = fmt.Sprintf("10.0.0.%d:6379", index+1)
+	}
+	return names
+}
+
+// assign every key to its node.
+func assign(keyRing *ring.Ring) []string {
+	assigned := make([]string, keys)
+	for index := range assigned {
+		assigned[index] = keyRing.Node(fmt.Sprintf("user:%d", index))
+	}
+	return assigned
+}
+
+func loads(assigned []string) map[string]int {
+	loads := map[string]int{}
+	for _, node := range assigned {
+		loads[node]++
+	}
+	return loads
+}
+
+// moved keys between the assignments, by the node each moved to.
+func moved(before []string, after []string) map[string]int {
+	moved := map[string]int{}
+	for index := range before {
+		if before[index] != after[index] {
+			moved[after[index]]++
+		}
+	}
+	return moved
+}
+
+func total(counts map[string]int) int {
+	sum := 0
+	for _, count := range counts {
+		sum += count
+	}
+	return sum
+}
+
+func TestRing_distribution(t *testing.T) {
+	t.Parallel()
+
+	for name, config := range map[string]ring.Config{"unbounded": unbounded, "bounded": bounded} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			keyRing := ring.New(config, nodes(10)...)
+			nodeLoads := loads(assign(keyRing))
+			require.Len(t, nodeLoads, 10)
+			for node, load := range nodeLoads {
+				assert.InEpsilon(t, keys/10, load, 0.3, node)
+			}
+		})
+	}
+}
+
+func TestRing_bounded(t *testing.T) {
+	t.Parallel()
+
+	// Few virtual nodes spread keys unevenly, which the load factor bounds.
+	config := ring.Config{
+		VirtualNodes: 1,
+		LoadFactor:   1.1,
+		Partitions:   1000,
+	}
+	unevenConfig := config
+	unevenConfig.LoadFactor = 0
+
+	mean := float64(keys) / 10
+	maxLoad := func(keyRing *ring.Ring) int {
+		highest := 0
+		for _, load := range loads(assign(keyRing)) {
+			highest = max(highest, load)
+		}
+		return highest
+	}
+	assert.Greater(t, float64(maxLoad(ring.New(unevenConfig, nodes(10)...))), mean*1.5)
+	// Keys are spread evenly between the partitions, so the bound on the partitions of each node bounds its keys.
+	assert.Less(t, float64(maxLoad(ring.New(config, nodes(10)...))), mean*1.1*1.05)
+}
+
+func TestRing_add(t *testing.T) {
+	t.Parallel()
+
+	for name, config := range map[string]ring.Config{"unbounded": unbounded, "bounded": bounded} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			keyRing := ring.New(config, nodes(10)...)
+			before := assign(keyRing)
+			keyRing.Add(nodes(11)...)
+			after := assign(keyRing)
+
+			movedTo := moved(before, after)
+			ideal := float64(keys) / 11
+			newNode := nodes(11)[10]
+			assert.InEpsilon(t, ideal, movedTo[newNode], 0.3)
+			t.Logf("%d keys moved to the new node and %d between other nodes, where %.0f is ideal", movedTo[newNode], total(movedTo)-movedTo[newNode], ideal)
+
+			if config.LoadFactor == 0 {
+				// Keys only move to the new node.
+				assert.Equal(t, movedTo[newNode], total(movedTo))
+			} else {
+				// Bounding the load moves some keys between other nodes as well.
+				assert.Less(t, float64(total(movedTo)), 2*ideal)
+			}
+		})
+	}
+}
+
+func TestRing_remove(t *testing.T) {
+	t.Parallel()
+
+	for name, config := range map[string]ring.Config{"unbounded": unbounded, "bounded": bounded} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			keyRing := ring.New(config, nodes(10)...)
+			before := assign(keyRing)
+			removed := nodes(10)[3]
+			keyRing.Remove(removed)
+			assert.NotContains(t, keyRing.Nodes(), removed)
+			after := assign(keyRing)
+
+			removedKeys := loads(before)[removed]
+			movedKeys := total(moved(before, after))
+			t.Logf("%d keys moved after removing a node of %d keys", movedKeys, removedKeys)
+			if config.LoadFactor == 0 {
+				// Only the keys of the removed node move.
+				assert.Equal(t, removedKeys, movedKeys)
+			} else {
+				assert.Less(t, float64(movedKeys), 2*float64(removedKeys))
+			}
+			assert.NotContains(t, after, removed)
+		})
+	}
+}
+
+func TestRing_Node(t *testing.T) {
+	t.Parallel()
+
+	empty := ring.New(unbounded)
+	assert.Empty(t, empty.Node("key"))
+	assert.Empty(t, empty.Nodes())
+
+	// Keys with the same tag are served by the same node.
+	keyRing := ring.New(unbounded, nodes(10)...)
+	for index := range 100 {
+		assert.Equal(t, keyRing.Node(fmt.Sprintf("{user:%d}", index)), keyRing.Node(fmt.Sprintf("{user:%d}.name", index)))
+	}
+
+	// The ring does not depend on the order nodes are added in, or on nodes added twice.
+	reversed := ring.New(unbounded)
+	for index := 9; index >= 0; index-- {
+		reversed.Add(nodes(10)[index], nodes(10)[index])
+	}
+	assert.Equal(t, keyRing.Nodes(), reversed.Nodes())
+	assert.Equal(t, assign(keyRing), assign(reversed))
+
+	assert.Panics(t, func() {
+		ring.New(ring.Config{VirtualNodes: 0, LoadFactor: 0.5, Partitions: 0})
+	})
+}
+
+func TestRing_concurrent(t *testing.T) {
+	t.Parallel()
+
+	keyRing := ring.New(bounded, nodes(3)...)
+	var wait sync.WaitGroup
+	wait.Add(2)
+	go func() {
+		defer wait.Done()
+		for range 100 {
+			keyRing.Add(nodes(4)[3])
+			keyRing.Remove(nodes(4)[3])
+		}
+	}()
+	go func() {
+		defer wait.Done()
+		for index := range 10_000 {
+			assert.NotEmpty(t, keyRing.Node(fmt.Sprintf("key-%d", index)))
+		}
+	}()
+	wait.Wait()
+}
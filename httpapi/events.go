@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/internal/glob"
+)
+
+type eventData struct {
+	Key  string                   `json:"key"`
+	Type datkey.KeyspaceEventType `json:"type"`
+}
+
+type droppedData struct {
+	Dropped int64 `json:"dropped"`
+}
+
+// events streams changes to keys as server-sent events until the client disconnects or the handler is closed.
+//
+// Each change is sent as an event named after its type with the key as JSON data:
+//
+//	event: set
+//	data: {"key":"user:1","type":"set"}
+//
+// If the client falls behind and events are dropped, a "dropped" event is sent with the total number of dropped events,
+// so that clients relying on the events can resynchronize.
+//
+// Only changes to keys that the user may access are sent.
+func (self *Handler) events(writer http.ResponseWriter, request *http.Request) {
+	user, allowed := self.authorize(writer, request, acl.CategoryRead)
+	if !allowed {
+		return
+	}
+	watchable, ok := self.db.(Watcher)
+	if !ok {
+		writeError(writer, http.StatusNotImplemented, "keyspace events are not supported by the store")
+		return
+	}
+
+	query := request.URL.Query()
+	match := query.Get("match")
+	var types []datkey.KeyspaceEventType
+	if value := query.Get("type"); value != "" {
+		for _, eventType := range strings.Split(value, ",") {
+			types = append(types, datkey.KeyspaceEventType(strings.TrimSpace(eventType)))
+		}
+	}
+
+	controller := http.NewResponseController(writer)
+	// Event streams outlive any write timeout of the server.
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	watcher := watchable.WatchKeyspace(self.config.EventBufferSize, types...)
+	defer watcher.Close()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(self.config.EventHeartbeat)
+	defer heartbeat.Stop()
+
+	var dropped int64
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-self.done:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event := <-watcher.Events():
+			if match != "" && !glob.Match(match, event.Key) {
+				continue
+			}
+			if self.config.ACL != nil && !self.config.ACL.AllowsKey(user, event.Key) {
+				continue
+			}
+			if err := writeEvent(writer, string(event.Type), eventData{
+				Key:  event.Key,
+				Type: event.Type,
+			}); err != nil {
+				return
+			}
+		}
+
+		if total := watcher.Dropped(); total != dropped {
+			dropped = total
+			if err := writeEvent(writer, "dropped", droppedData{
+				Dropped: dropped,
+			}); err != nil {
+				return
+			}
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(writer http.ResponseWriter, name string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", name, encoded)
+	return err
+}
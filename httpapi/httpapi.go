@@ -0,0 +1,567 @@
+// Package httpapi serves a datkey database over HTTP with JSON, for tools and scripts that would rather use curl than a redis client.
+//
+// Routes:
+//
+//	GET    /keys/{key}     value as the body, with the remaining ttl in the X-Datkey-Ttl header if the key expires
+//	PUT    /keys/{key}     set the value to the body, expiring after the X-Datkey-Ttl header if given
+//	DELETE /keys/{key}     delete the key
+//	POST   /batch/get      {"keys": ["a", "b"]} to {"entries": [{"key": "a", "exists": true, "value": "1", "ttl": "30s"}, ...]}
+//	POST   /batch/set      {"entries": [{"key": "a", "value": "1", "ttl": "30s"}, ...]} to {"set": 2}
+//	POST   /batch/delete   {"keys": ["a", "b"]} to {"deleted": 2}
+//	GET    /scan           ?cursor=0&match=user:*&type=string&count=100 to {"cursor": 42, "keys": [...]}
+//	GET    /events         server-sent events for changes to keys, optionally filtered by ?match=user:*&type=set,del
+//	                       (501 Not Implemented if the store is not a Watcher)
+//
+// Ttls are Go durations, such as "1500ms" or "1h", or a whole number of seconds. Values in JSON are strings,
+// unless they are not valid UTF-8, in which case they are given as base64 in "value_base64" instead.
+// Errors are returned as {"error": "message"} with a status code matching the cause.
+//
+// If an ACL is configured, requests authenticate with HTTP basic authentication and are checked against the
+// permissions of the user. Requests without credentials are authenticated as the default user, if it has no password.
+//
+// The handler can be mounted on an existing mux under a prefix:
+//
+//	mux.Handle("/datkey/", http.StripPrefix("/datkey", httpapi.New(db, httpapi.Config{})))
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// HeaderTtl of a key, on requests to set the ttl of a key and on responses with the remaining ttl.
+const HeaderTtl = "X-Datkey-Ttl"
+
+const (
+	defaultMaxBodyBytes   = 512 * 1024 * 1024
+	defaultMaxBatchSize   = 1000
+	defaultEventBuffer    = 1024
+	defaultEventHeartbeat = 15 * time.Second
+)
+
+type Config struct {
+	// MaxBodyBytes of a request, which limits the size of values.
+	// Default: 512MiB
+	MaxBodyBytes int64
+
+	// MaxBatchSize of keys in a batch request.
+	// Default: 1000
+	MaxBatchSize int
+
+	// EventBufferSize of events buffered for each event stream. Events are dropped if a client falls further behind than this.
+	// Default: 1024
+	EventBufferSize int
+
+	// EventHeartbeat interval of comments sent on idle event streams, so proxies do not close them.
+	// Default: 15s
+	EventHeartbeat time.Duration
+
+	// ACL of the users that requests authenticate as.
+	// Default: None (nil, every request may access every key)
+	ACL *acl.ACL
+}
+
+// Watcher of changes to keys, such as *datkey.Datkey. The events route is only served for stores that implement it.
+type Watcher interface {
+	WatchKeyspace(bufferSize int, eventTypes ...datkey.KeyspaceEventType) *datkey.KeyspaceWatcher
+}
+
+// Handler of the HTTP API for a database.
+type Handler struct {
+	db     datkey.Store
+	mux    *http.ServeMux
+	config Config
+
+	// done is closed by Close to end every event stream.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New handler for the database, or any other store such as a decorator from the store package. Events are only
+// served if the store is also a Watcher. The database is not closed by the handler.
+func New(db datkey.Store, config Config) *Handler {
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if config.MaxBatchSize == 0 {
+		config.MaxBatchSize = defaultMaxBatchSize
+	}
+
+	if config.EventBufferSize == 0 {
+		config.EventBufferSize = defaultEventBuffer
+	}
+
+	if config.EventHeartbeat == 0 {
+		config.EventHeartbeat = defaultEventHeartbeat
+	}
+
+	handler := &Handler{
+		db:        db,
+		mux:       http.NewServeMux(),
+		config:    config,
+		done:      make(chan struct{}),
+		closeOnce: sync.Once{},
+	}
+
+	handler.mux.HandleFunc("GET /keys/{key...}", handler.getKey)
+	handler.mux.HandleFunc("PUT /keys/{key...}", handler.putKey)
+	handler.mux.HandleFunc("DELETE /keys/{key...}", handler.deleteKey)
+	handler.mux.HandleFunc("POST /batch/get", handler.batchGet)
+	handler.mux.HandleFunc("POST /batch/set", handler.batchSet)
+	handler.mux.HandleFunc("POST /batch/delete", handler.batchDelete)
+	handler.mux.HandleFunc("GET /scan", handler.scan)
+	handler.mux.HandleFunc("GET /events", handler.events)
+
+	return handler
+}
+
+func (self *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	self.mux.ServeHTTP(writer, request)
+}
+
+// Close every open event stream. Since event streams never end on their own, this must be called before
+// http.Server.Shutdown can complete. Other requests are still served.
+func (self *Handler) Close() {
+	self.closeOnce.Do(func() {
+		close(self.done)
+	})
+}
+
+func (self *Handler) getKey(writer http.ResponseWriter, request *http.Request) {
+	key := request.PathValue("key")
+	if key == "" {
+		writeError(writer, http.StatusBadRequest, "key is required")
+		return
+	}
+	if _, allowed := self.authorize(writer, request, acl.CategoryRead, key); !allowed {
+		return
+	}
+
+	result, err := self.db.Get(request.Context(), key)
+	if err != nil {
+		writeReadError(writer, err)
+		return
+	}
+	if !result.Exists {
+		writeError(writer, http.StatusNotFound, "key not found")
+		return
+	}
+
+	// The ttl is read separately, so the key may have expired or been deleted in between. The value is still returned.
+	ttlResult, err := self.db.Ttl(request.Context(), key)
+	if err == nil && ttlResult.Exists && ttlResult.Ttl > 0 {
+		writer.Header().Set(HeaderTtl, formatTtl(ttlResult.Ttl))
+	}
+
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	writer.Header().Set("Content-Length", strconv.Itoa(len(result.Value)))
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(result.Value)
+}
+
+func (self *Handler) putKey(writer http.ResponseWriter, request *http.Request) {
+	key := request.PathValue("key")
+	if key == "" {
+		writeError(writer, http.StatusBadRequest, "key is required")
+		return
+	}
+	if _, allowed := self.authorize(writer, request, acl.CategoryWrite, key); !allowed {
+		return
+	}
+
+	ttl, valid := parseTtl(request.Header.Get(HeaderTtl))
+	if !valid {
+		writeError(writer, http.StatusBadRequest, "invalid ttl: "+request.Header.Get(HeaderTtl))
+		return
+	}
+
+	value, readErr := io.ReadAll(http.MaxBytesReader(writer, request.Body, self.config.MaxBodyBytes))
+	if readErr != nil {
+		writeBodyError(writer, readErr)
+		return
+	}
+
+	result, err := self.db.Set(request.Context(), key, value, ttl)
+	if err != nil {
+		writeWriteError(writer, err)
+		return
+	}
+
+	if result.Exists {
+		writer.WriteHeader(http.StatusNoContent)
+	} else {
+		writer.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (self *Handler) deleteKey(writer http.ResponseWriter, request *http.Request) {
+	key := request.PathValue("key")
+	if key == "" {
+		writeError(writer, http.StatusBadRequest, "key is required")
+		return
+	}
+	if _, allowed := self.authorize(writer, request, acl.CategoryWrite, key); !allowed {
+		return
+	}
+
+	result, err := self.db.Delete(request.Context(), key)
+	if err != nil {
+		writeWriteError(writer, err)
+		return
+	}
+	if !result.Exists {
+		writeError(writer, http.StatusNotFound, "key not found")
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+type batchKeysRequest struct {
+	Keys []string `json:"keys"`
+}
+
+type batchGetEntry struct {
+	Key         string  `json:"key"`
+	Value       *string `json:"value,omitempty"`
+	ValueBase64 []byte  `json:"value_base64,omitempty"`
+	Ttl         string  `json:"ttl,omitempty"`
+	Exists      bool    `json:"exists"`
+}
+
+type batchGetResponse struct {
+	Entries []batchGetEntry `json:"entries"`
+}
+
+func (self *Handler) batchGet(writer http.ResponseWriter, request *http.Request) {
+	var body batchKeysRequest
+	if !self.readBatch(writer, request, &body, func() int { return len(body.Keys) }) {
+		return
+	}
+	if _, allowed := self.authorize(writer, request, acl.CategoryRead, body.Keys...); !allowed {
+		return
+	}
+
+	entries := make([]batchGetEntry, len(body.Keys))
+	for index, key := range body.Keys {
+		entries[index] = batchGetEntry{
+			Key:         key,
+			Value:       nil,
+			ValueBase64: nil,
+			Ttl:         "",
+			Exists:      false,
+		}
+
+		result, err := self.db.Get(request.Context(), key)
+		if err != nil && err.Cause != datkey.DbReadWrongType {
+			writeReadError(writer, err)
+			return
+		}
+		if err != nil || !result.Exists {
+			// Keys that do not hold a string value are reported as not existing, like MGET.
+			continue
+		}
+
+		entries[index].Exists = true
+		if utf8.Valid(result.Value) {
+			value := string(result.Value)
+			entries[index].Value = &value
+		} else {
+			entries[index].ValueBase64 = result.Value
+		}
+
+		if ttlResult, err := self.db.Ttl(request.Context(), key); err == nil && ttlResult.Exists && ttlResult.Ttl > 0 {
+			entries[index].Ttl = formatTtl(ttlResult.Ttl)
+		}
+	}
+
+	writeJSON(writer, http.StatusOK, batchGetResponse{
+		Entries: entries,
+	})
+}
+
+type batchSetEntry struct {
+	Value       *string `json:"value"`
+	Key         string  `json:"key"`
+	Ttl         string  `json:"ttl"`
+	ValueBase64 []byte  `json:"value_base64"`
+}
+
+type batchSetRequest struct {
+	Entries []batchSetEntry `json:"entries"`
+}
+
+type batchSetResponse struct {
+	Set int `json:"set"`
+}
+
+// batchSet of keys. Every entry is validated before any key is set, but the keys are not set atomically.
+func (self *Handler) batchSet(writer http.ResponseWriter, request *http.Request) {
+	var body batchSetRequest
+	if !self.readBatch(writer, request, &body, func() int { return len(body.Entries) }) {
+		return
+	}
+
+	keys := make([]string, len(body.Entries))
+	values := make([][]byte, len(body.Entries))
+	ttls := make([]time.Duration, len(body.Entries))
+	for index, entry := range body.Entries {
+		keys[index] = entry.Key
+		if entry.Key == "" {
+			writeError(writer, http.StatusBadRequest, "entry "+strconv.Itoa(index)+": key is required")
+			return
+		}
+		switch {
+		case entry.Value != nil && entry.ValueBase64 != nil:
+			writeError(writer, http.StatusBadRequest, "entry "+strconv.Itoa(index)+": only one of value or value_base64 may be set")
+			return
+		case entry.Value != nil:
+			values[index] = []byte(*entry.Value)
+		case entry.ValueBase64 != nil:
+			values[index] = entry.ValueBase64
+		default:
+			writeError(writer, http.StatusBadRequest, "entry "+strconv.Itoa(index)+": value is required")
+			return
+		}
+
+		ttl, valid := parseTtl(entry.Ttl)
+		if !valid {
+			writeError(writer, http.StatusBadRequest, "entry "+strconv.Itoa(index)+": invalid ttl: "+entry.Ttl)
+			return
+		}
+		ttls[index] = ttl
+	}
+	if _, allowed := self.authorize(writer, request, acl.CategoryWrite, keys...); !allowed {
+		return
+	}
+
+	for index, entry := range body.Entries {
+		if _, err := self.db.Set(request.Context(), entry.Key, values[index], ttls[index]); err != nil {
+			writeWriteError(writer, err)
+			return
+		}
+	}
+
+	writeJSON(writer, http.StatusOK, batchSetResponse{
+		Set: len(body.Entries),
+	})
+}
+
+type batchDeleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+func (self *Handler) batchDelete(writer http.ResponseWriter, request *http.Request) {
+	var body batchKeysRequest
+	if !self.readBatch(writer, request, &body, func() int { return len(body.Keys) }) {
+		return
+	}
+	if _, allowed := self.authorize(writer, request, acl.CategoryWrite, body.Keys...); !allowed {
+		return
+	}
+
+	var deleted int
+	for _, key := range body.Keys {
+		result, err := self.db.Delete(request.Context(), key)
+		if err != nil {
+			writeWriteError(writer, err)
+			return
+		}
+		if result.Exists {
+			deleted++
+		}
+	}
+
+	writeJSON(writer, http.StatusOK, batchDeleteResponse{
+		Deleted: deleted,
+	})
+}
+
+// readBatch request body as JSON, writing an error response and returning false if it is invalid or has too many entries.
+func (self *Handler) readBatch(writer http.ResponseWriter, request *http.Request, body any, size func() int) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, self.config.MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		writeBodyError(writer, err)
+		return false
+	}
+
+	if size() > self.config.MaxBatchSize {
+		writeError(writer, http.StatusBadRequest, "batch exceeds the maximum size of "+strconv.Itoa(self.config.MaxBatchSize))
+		return false
+	}
+
+	return true
+}
+
+type scanResponse struct {
+	Keys   []string `json:"keys"`
+	Cursor uint64   `json:"cursor"`
+}
+
+// scan keys, only returning the keys that the user may access.
+func (self *Handler) scan(writer http.ResponseWriter, request *http.Request) {
+	user, allowed := self.authorize(writer, request, acl.CategoryRead)
+	if !allowed {
+		return
+	}
+	query := request.URL.Query()
+
+	var cursor uint64
+	if value := query.Get("cursor"); value != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(value, 10, 64); err != nil {
+			writeError(writer, http.StatusBadRequest, "invalid cursor: "+value)
+			return
+		}
+	}
+
+	var count int
+	if value := query.Get("count"); value != "" {
+		var err error
+		if count, err = strconv.Atoi(value); err != nil || count <= 0 || count > self.config.MaxBatchSize {
+			writeError(writer, http.StatusBadRequest, "invalid count: "+value)
+			return
+		}
+	}
+
+	result, err := self.db.Scan(request.Context(), cursor, datkey.ScanQuery{
+		Match: query.Get("match"),
+		Type:  datkey.ValueType(query.Get("type")),
+		Count: count,
+	})
+	if err != nil {
+		writeReadError(writer, err)
+		return
+	}
+
+	keys := make([]string, 0, len(result.Keys))
+	for _, key := range result.Keys {
+		if self.config.ACL == nil || self.config.ACL.AllowsKey(user, key) {
+			keys = append(keys, key)
+		}
+	}
+	writeJSON(writer, http.StatusOK, scanResponse{
+		Keys:   keys,
+		Cursor: result.Cursor,
+	})
+}
+
+// authorize the request to run a command of the category on the keys, returning the authenticated user.
+// If the request is not authorized, an error response is written and false is returned.
+func (self *Handler) authorize(writer http.ResponseWriter, request *http.Request, category acl.Category, keys ...string) (string, bool) {
+	if self.config.ACL == nil {
+		return "", true
+	}
+
+	name, password, hasCredentials := request.BasicAuth()
+	if !hasCredentials {
+		name, password = acl.DefaultUser, ""
+	}
+	if err := self.config.ACL.Authenticate(name, password); err != nil {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="datkey"`)
+		writeError(writer, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+
+	if err := self.config.ACL.Check(name, category, keys...); err != nil {
+		writeError(writer, http.StatusForbidden, err.Error())
+		return "", false
+	}
+
+	return name, true
+}
+
+// parseTtl as a Go duration or a whole number of seconds. An empty value is no ttl.
+// Returns false if the value is not a positive ttl.
+func parseTtl(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, true
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+
+	ttl, err := time.ParseDuration(value)
+	return ttl, err == nil && ttl > 0
+}
+
+// formatTtl rounded to milliseconds, which is the precision ttls are reported with.
+func formatTtl(ttl time.Duration) string {
+	return max(ttl.Round(time.Millisecond), time.Millisecond).String()
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(writer http.ResponseWriter, status int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(body)
+}
+
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeJSON(writer, status, errorResponse{
+		Error: message,
+	})
+}
+
+// writeBodyError for a request body that could not be read or decoded.
+func writeBodyError(writer http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(writer, http.StatusRequestEntityTooLarge, "request body exceeds "+strconv.FormatInt(maxBytesErr.Limit, 10)+" bytes")
+		return
+	}
+	writeError(writer, http.StatusBadRequest, "invalid request body: "+err.Error())
+}
+
+func writeReadError(writer http.ResponseWriter, err *errors.Error[datkey.DbReadErr]) {
+	var status int
+	switch err.Cause {
+	case datkey.DbReadInvalidArgument:
+		status = http.StatusBadRequest
+	case datkey.DbReadWrongType:
+		status = http.StatusConflict
+	case datkey.DbReadRedirect:
+		status = http.StatusMisdirectedRequest
+	case datkey.DbReadCanceled:
+		status = http.StatusServiceUnavailable
+	case datkey.DbReadInternal:
+		status = http.StatusInternalServerError
+	default:
+		status = http.StatusInternalServerError
+	}
+	writeError(writer, status, err.Error())
+}
+
+func writeWriteError(writer http.ResponseWriter, err *errors.Error[datkey.DbWriteErr]) {
+	var status int
+	switch err.Cause {
+	case datkey.DbWriteInvalidArgument, datkey.DbWriteFilterFull:
+		status = http.StatusBadRequest
+	case datkey.DbWriteWrongType, datkey.DbWriteKeyExists:
+		status = http.StatusConflict
+	case datkey.DbWriteRedirect:
+		status = http.StatusMisdirectedRequest
+	case datkey.DbWriteCanceled:
+		status = http.StatusServiceUnavailable
+	case datkey.DbWriteInternal:
+		status = http.StatusInternalServerError
+	default:
+		status = http.StatusInternalServerError
+	}
+	writeError(writer, status, err.Error())
+}
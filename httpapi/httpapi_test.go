@@ -0,0 +1,385 @@
+package httpapi_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/httpapi"
+	"github.com/wspowell/datkey/store"
+)
+
+func newTestServer(t *testing.T, config httpapi.Config) (*datkey.Datkey, *httptest.Server) {
+	t.Helper()
+
+	var dbConfig datkey.Config
+	db := datkey.New(dbConfig)
+	t.Cleanup(db.Close)
+
+	handler := httpapi.New(db, config)
+	mux := http.NewServeMux()
+	mux.Handle("/datkey/", http.StripPrefix("/datkey", handler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Cleanup(handler.Close)
+
+	return db, server
+}
+
+func do(t *testing.T, method string, url string, body string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response, string(responseBody)
+}
+
+func Test_keys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server := newTestServer(t, httpapi.Config{
+		MaxBodyBytes:    16,
+		MaxBatchSize:    0,
+		EventBufferSize: 0,
+		EventHeartbeat:  0,
+		ACL:             nil,
+	})
+	url := server.URL + "/datkey/keys/"
+
+	{
+		response, body := do(t, http.MethodGet, url+"missing", "", nil)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		assert.JSONEq(t, `{"error":"key not found"}`, body)
+	}
+
+	{
+		response, _ := do(t, http.MethodPut, url+"user/1", "value", nil)
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+	}
+
+	{
+		response, _ := do(t, http.MethodPut, url+"user/1", "updated", http.Header{httpapi.HeaderTtl: {"60"}})
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	}
+
+	{
+		response, body := do(t, http.MethodGet, url+"user/1", "", nil)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "updated", body)
+		ttl, err := time.ParseDuration(response.Header.Get(httpapi.HeaderTtl))
+		require.NoError(t, err)
+		assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+	}
+
+	{
+		response, body := do(t, http.MethodPut, url+"key", "value", http.Header{httpapi.HeaderTtl: {"-1s"}})
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.JSONEq(t, `{"error":"invalid ttl: -1s"}`, body)
+	}
+
+	{
+		response, _ := do(t, http.MethodPut, url+"key", strings.Repeat("x", 17), nil)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode)
+	}
+
+	{
+		_, zaddErr := db.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1})
+		require.Nil(t, zaddErr)
+		response, _ := do(t, http.MethodGet, url+"zset", "", nil)
+		assert.Equal(t, http.StatusConflict, response.StatusCode)
+	}
+
+	{
+		response, _ := do(t, http.MethodDelete, url+"user/1", "", nil)
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+		response, _ = do(t, http.MethodDelete, url+"user/1", "", nil)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	}
+
+	{
+		response, _ := do(t, http.MethodPost, url+"key", "", nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	}
+}
+
+func Test_batch(t *testing.T) {
+	t.Parallel()
+
+	_, server := newTestServer(t, httpapi.Config{
+		MaxBodyBytes:    0,
+		MaxBatchSize:    3,
+		EventBufferSize: 0,
+		EventHeartbeat:  0,
+		ACL:             nil,
+	})
+	url := server.URL + "/datkey/batch/"
+
+	{
+		response, body := do(t, http.MethodPost, url+"set", `{"entries":[{"key":"a","value":"1"},{"key":"b","value_base64":"/w=="},{"key":"t","value":"1","ttl":"1h"}]}`, nil)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.JSONEq(t, `{"set":3}`, body)
+	}
+
+	{
+		response, body := do(t, http.MethodPost, url+"get", `{"keys":["a","b","c"]}`, nil)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.JSONEq(t, `{"entries":[
+			{"key":"a","exists":true,"value":"1"},
+			{"key":"b","exists":true,"value_base64":"/w=="},
+			{"key":"c","exists":false}
+		]}`, body)
+	}
+
+	{
+		response, body := do(t, http.MethodPost, url+"get", `{"keys":["t"]}`, nil)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		var result struct {
+			Entries []struct {
+				Ttl string `json:"ttl"`
+			} `json:"entries"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		require.Len(t, result.Entries, 1)
+		ttl, err := time.ParseDuration(result.Entries[0].Ttl)
+		require.NoError(t, err)
+		assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+	}
+
+	{
+		response, body := do(t, http.MethodPost, url+"set", `{"entries":[{"key":"c","value":"1"},{"key":"d"}]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.JSONEq(t, `{"error":"entry 1: value is required"}`, body)
+	}
+
+	{
+		response, body := do(t, http.MethodPost, url+"delete", `{"keys":["a","b","c"]}`, nil)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.JSONEq(t, `{"deleted":2}`, body)
+	}
+
+	{
+		response, _ := do(t, http.MethodPost, url+"delete", `{"keys":["a","b","c","d"]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	}
+
+	{
+		response, _ := do(t, http.MethodPost, url+"get", `{"keys":`, nil)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	}
+}
+
+func Test_scan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server := newTestServer(t, httpapi.Config{
+		MaxBodyBytes:    0,
+		MaxBatchSize:    0,
+		EventBufferSize: 0,
+		EventHeartbeat:  0,
+		ACL:             nil,
+	})
+
+	for _, key := range []string{"user:1", "user:2", "user:3", "other"} {
+		_, err := db.Set(ctx, key, []byte("value"), 0)
+		require.Nil(t, err)
+	}
+
+	var keys []string
+	cursor := "0"
+	for {
+		response, body := do(t, http.MethodGet, server.URL+"/datkey/scan?count=1&match=user:*&cursor="+cursor, "", nil)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		var result struct {
+			Keys   []string    `json:"keys"`
+			Cursor json.Number `json:"cursor"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		keys = append(keys, result.Keys...)
+
+		cursor = result.Cursor.String()
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []string{"user:1", "user:2", "user:3"}, keys)
+
+	{
+		response, _ := do(t, http.MethodGet, server.URL+"/datkey/scan?cursor=abc", "", nil)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	}
+}
+
+func Test_events(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server := newTestServer(t, httpapi.Config{
+		MaxBodyBytes:    0,
+		MaxBatchSize:    0,
+		EventBufferSize: 0,
+		EventHeartbeat:  0,
+		ACL:             nil,
+	})
+
+	response, err := http.Get(server.URL + "/datkey/events?match=user:*&type=set,del") //nolint:noctx // reason: test
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	_, setErr := db.Set(ctx, "other", []byte("value"), 0)
+	require.Nil(t, setErr)
+	_, setErr = db.Set(ctx, "user:1", []byte("value"), 0)
+	require.Nil(t, setErr)
+	_, expireErr := db.Expire(ctx, "user:1", time.Hour)
+	require.Nil(t, expireErr)
+	_, deleteErr := db.Delete(ctx, "user:1")
+	require.Nil(t, deleteErr)
+
+	reader := bufio.NewReader(response.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	assert.Equal(t, "event: set\ndata: {\"key\":\"user:1\",\"type\":\"set\"}\n", readEvent())
+	assert.Equal(t, "event: del\ndata: {\"key\":\"user:1\",\"type\":\"del\"}\n", readEvent())
+}
+
+func Test_store(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var dbConfig datkey.Config
+	db := datkey.New(dbConfig)
+	t.Cleanup(db.Close)
+
+	handler := httpapi.New(store.Prefixed(db, "tenant:"), httpapi.Config{
+		MaxBodyBytes:    0,
+		MaxBatchSize:    0,
+		EventBufferSize: 0,
+		EventHeartbeat:  0,
+		ACL:             nil,
+	})
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Cleanup(handler.Close)
+
+	response, _ := do(t, http.MethodPut, server.URL+"/keys/key", "value", nil)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	result, err := db.Get(ctx, "tenant:key")
+	require.Nil(t, err)
+	assert.Equal(t, []byte("value"), result.Value)
+
+	// Events need a store that can watch the keyspace.
+	response, body := do(t, http.MethodGet, server.URL+"/events", "", nil)
+	assert.Equal(t, http.StatusNotImplemented, response.StatusCode)
+	assert.JSONEq(t, `{"error":"keyspace events are not supported by the store"}`, body)
+}
+
+func Test_ACL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	users := acl.New()
+	require.Nil(t, users.SetUser(acl.DefaultUser, "off"))
+	require.Nil(t, users.SetUser("alice", "on", ">secret", "~team-a:*", "+@read", "+@write"))
+
+	db, server := newTestServer(t, httpapi.Config{
+		MaxBodyBytes:    0,
+		MaxBatchSize:    0,
+		EventBufferSize: 0,
+		EventHeartbeat:  0,
+		ACL:             users,
+	})
+	for _, key := range []string{"team-a:1", "team-b:1"} {
+		_, err := db.Set(ctx, key, []byte("value"), 0)
+		require.Nil(t, err)
+	}
+
+	alice := func(request *http.Request) {
+		request.SetBasicAuth("alice", "secret")
+	}
+	doAs := func(method string, url string, body string, authenticate func(request *http.Request)) (*http.Response, string) {
+		request, err := http.NewRequest(method, server.URL+"/datkey"+url, strings.NewReader(body))
+		require.NoError(t, err)
+		authenticate(request)
+
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		responseBody, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response, string(responseBody)
+	}
+
+	{
+		response, _ := doAs(http.MethodGet, "/keys/team-a:1", "", func(*http.Request) {})
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.NotEmpty(t, response.Header.Get("WWW-Authenticate"))
+	}
+
+	{
+		response, _ := doAs(http.MethodGet, "/keys/team-a:1", "", func(request *http.Request) {
+			request.SetBasicAuth("alice", "wrong")
+		})
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	}
+
+	{
+		response, body := doAs(http.MethodGet, "/keys/team-a:1", "", alice)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "value", body)
+	}
+
+	{
+		response, body := doAs(http.MethodGet, "/keys/team-b:1", "", alice)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+		assert.JSONEq(t, `{"error":"user alice has no permissions to access the 'team-b:1' key"}`, body)
+	}
+
+	{
+		response, _ := doAs(http.MethodPost, "/batch/set", `{"entries":[{"key":"team-a:2","value":"1"},{"key":"team-b:2","value":"1"}]}`, alice)
+		assert.Equal(t, http.StatusForbidden, response.StatusCode)
+		result, err := db.Get(ctx, "team-a:2")
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+
+	{
+		response, body := doAs(http.MethodGet, "/scan?count=1000", "", alice)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.JSONEq(t, `{"cursor":0,"keys":["team-a:1"]}`, body)
+	}
+}
@@ -0,0 +1,531 @@
+package datkey
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// HyperLogLogs are stored as string values so they can be read and written with Get and Set like any other value.
+// The layout follows redis: a 16 byte header followed by either a sparse or dense set of registers.
+//
+// Header:
+//
+//	magic "HYLL" (4 bytes) | encoding (1 byte) | unused (3 bytes) | cached cardinality, little endian (8 bytes)
+//
+// The most significant bit of the cached cardinality marks the cache as invalid.
+//
+// Sparse registers are a sorted list of (register index uint16 big endian, register value uint8) entries
+// for only the registers that are not zero. Once the sparse list grows beyond hllSparseMaxBytes, the value is
+// converted to the dense encoding of 6 bits per register.
+const (
+	hllMagic          = "HYLL"
+	hllPrecision      = 14
+	hllRegisters      = 1 << hllPrecision
+	hllRegisterMax    = 1<<hllRegisterBits - 1
+	hllRegisterBits   = 6
+	hllQ              = 64 - hllPrecision
+	hllHeaderSize     = 16
+	hllDenseSize      = hllHeaderSize + (hllRegisters*hllRegisterBits+bitsPerByte-1)/bitsPerByte
+	hllSparseEntry    = 3
+	hllSparseMaxBytes = 3000
+	hllEncodingIndex  = 4
+	hllCardIndex      = 8
+	hllCardInvalid    = 0x80
+	// hllHashSeed is the same seed used by redis.
+	hllHashSeed = 0xadc83b19
+)
+
+type hllEncoding byte
+
+const (
+	hllEncodingDense  = hllEncoding(0)
+	hllEncodingSparse = hllEncoding(1)
+)
+
+type commandPFAdd struct {
+	Resp     *pfAddResponse
+	Key      string
+	Elements [][]byte
+}
+
+type pfAddResponse struct {
+	Err     *errors.Error[DbWriteErr]
+	Changed bool
+}
+
+type PFAddResponse struct {
+	// Changed is true if the estimated cardinality may have changed.
+	Changed bool
+}
+
+type commandPFCount struct {
+	Resp *pfCountResponse
+	Key  string
+}
+
+type pfCountResponse struct {
+	Err   *errors.Error[DbReadErr]
+	Count int64
+}
+
+type PFCountResponse struct {
+	Count int64
+}
+
+type commandPFMerge struct {
+	Resp      *pfMergeResponse
+	Key       string
+	Registers []uint8
+}
+
+type pfMergeResponse struct {
+	Err *errors.Error[DbWriteErr]
+}
+
+// PFAdd elements to the HyperLogLog stored at key, creating it if it does not exist.
+func (self *Datkey) PFAdd(ctx context.Context, key string, elements ...[]byte) (PFAddResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return PFAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return pfAddKey(key, elements, self.cache.forContext(ctx))
+}
+
+// PFCount returns the estimated cardinality of the union of the HyperLogLogs stored at keys.
+// Keys that do not exist are treated as empty. The standard error of the estimate is 0.81%.
+func (self *Datkey) PFCount(ctx context.Context, keys ...string) (PFCountResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return PFCountResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return pfCountKeys(keys, self.cache.forContext(ctx))
+}
+
+// PFMerge the HyperLogLogs stored at srcKeys into the HyperLogLog stored at destKey, creating it if it does not exist.
+// The source keys are read before the destination is written, so the operation is not atomic across keys.
+func (self *Datkey) PFMerge(ctx context.Context, destKey string, srcKeys ...string) *errors.Error[DbWriteErr] {
+	if err := self.writeAllowed(ctx); err != nil {
+		return err
+	}
+	return pfMergeKeys(destKey, srcKeys, self.cache.forContext(ctx))
+}
+
+func pfAddKey(key string, elements [][]byte, cache cacheStorage) (PFAddResponse, *errors.Error[DbWriteErr]) {
+	resp := &pfAddResponse{
+		Err:     nil,
+		Changed: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandPFAdd{
+		Key:      key,
+		Elements: elements,
+		Resp:     resp,
+	})
+	if redirect != nil {
+		return PFAddResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return PFAddResponse{
+		Changed: resp.Changed,
+	}, resp.Err
+}
+
+func pfCountKeys(keys []string, cache cacheStorage) (PFCountResponse, *errors.Error[DbReadErr]) {
+	if len(keys) == 0 {
+		return PFCountResponse{}, errors.New(DbReadInvalidArgument, "pfcount requires at least one key") //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if len(keys) == 1 {
+		// A single key can use, and update, the cached cardinality.
+		resp := &pfCountResponse{
+			Err:   nil,
+			Count: 0,
+		}
+
+		redirect := cache.runCommand(cache.slotOf(keys[0]), commandPFCount{
+			Key:  keys[0],
+			Resp: resp,
+		})
+		if redirect != nil {
+			return PFCountResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+		}
+
+		return PFCountResponse{
+			Count: resp.Count,
+		}, resp.Err
+	}
+
+	registers := make([]uint8, hllRegisters)
+	for _, key := range keys {
+		result, err := getKey(key, cache)
+		if err != nil {
+			return PFCountResponse{}, err //nolint:exhaustruct // reason: zero value on error
+		}
+		if !result.Exists {
+			continue
+		}
+		if !isValidHll(result.Value) {
+			return PFCountResponse{}, errors.New(DbReadWrongType, "key is not a valid HyperLogLog: %s", key) //nolint:exhaustruct // reason: zero value on error
+		}
+		hllMergeRegisters(result.Value, registers)
+	}
+
+	return PFCountResponse{
+		Count: int64(hllCount(registers)),
+	}, nil
+}
+
+func pfMergeKeys(destKey string, srcKeys []string, cache cacheStorage) *errors.Error[DbWriteErr] {
+	registers := make([]uint8, hllRegisters)
+	for _, srcKey := range srcKeys {
+		result, err := getKey(srcKey, cache)
+		if err != nil {
+			if err.Cause == DbReadRedirect {
+				return errors.NewFromError(DbWriteRedirect, err)
+			}
+			return errors.New(DbWriteWrongType, "key is not a valid HyperLogLog: %s", srcKey)
+		}
+		if !result.Exists {
+			continue
+		}
+		if !isValidHll(result.Value) {
+			return errors.New(DbWriteWrongType, "key is not a valid HyperLogLog: %s", srcKey)
+		}
+		hllMergeRegisters(result.Value, registers)
+	}
+
+	resp := &pfMergeResponse{
+		Err: nil,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(destKey), commandPFMerge{
+		Key:       destKey,
+		Registers: registers,
+		Resp:      resp,
+	})
+	if redirect != nil {
+		return redirect.writeErr()
+	}
+
+	return resp.Err
+}
+
+func (self *slotStorage) handleCommandPFAdd(cmd commandPFAdd) {
+	data, exists := self.lookupKey(cmd.Key)
+	previousSize := data.sizeInBytes()
+
+	if !exists {
+		data = keyStorage{
+			lastAccessTime: time.Now(),
+			expiresAt:      time.Time{},
+			value:          newSparseHll(),
+			object:         nil,
+			valueShared:    false,
+		}
+	} else if !isValidHll(data.value) {
+		cmd.Resp.Err = errors.New(DbWriteWrongType, "key is not a valid HyperLogLog: %s", cmd.Key)
+		return
+	}
+
+	value := data.ownedValue()
+	changed := !exists
+	for _, element := range cmd.Elements {
+		var registerChanged bool
+		value, registerChanged = hllAdd(value, element)
+		changed = changed || registerChanged
+	}
+
+	if changed {
+		value[hllCardIndex+7] |= hllCardInvalid
+		data.value = value
+		self.storeKey(cmd.Key, previousSize, data)
+	}
+	cmd.Resp.Changed = changed
+}
+
+func (self *slotStorage) handleCommandPFCount(cmd commandPFCount) {
+	data, exists := self.lookupKey(cmd.Key)
+	if !exists {
+		return
+	}
+	if !isValidHll(data.value) {
+		cmd.Resp.Err = errors.New(DbReadWrongType, "key is not a valid HyperLogLog: %s", cmd.Key)
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	if data.value[hllCardIndex+7]&hllCardInvalid == 0 {
+		cmd.Resp.Count = int64(binary.LittleEndian.Uint64(data.value[hllCardIndex:]))
+		self.storage[cmd.Key] = data
+		return
+	}
+
+	registers := make([]uint8, hllRegisters)
+	hllMergeRegisters(data.value, registers)
+	count := hllCount(registers)
+
+	value := data.ownedValue()
+	binary.LittleEndian.PutUint64(value[hllCardIndex:], count)
+	self.storage[cmd.Key] = data
+
+	cmd.Resp.Count = int64(count)
+}
+
+func (self *slotStorage) handleCommandPFMerge(cmd commandPFMerge) {
+	data, exists := self.lookupKey(cmd.Key)
+	previousSize := data.sizeInBytes()
+
+	if !exists {
+		data.lastAccessTime = time.Now()
+	} else {
+		if !isValidHll(data.value) {
+			cmd.Resp.Err = errors.New(DbWriteWrongType, "key is not a valid HyperLogLog: %s", cmd.Key)
+			return
+		}
+		hllMergeRegisters(data.value, cmd.Registers)
+	}
+
+	data.value = hllDenseFromRegisters(cmd.Registers)
+	data.valueShared = false
+	self.storeKey(cmd.Key, previousSize, data)
+}
+
+func newSparseHll() []byte {
+	value := make([]byte, hllHeaderSize)
+	copy(value, hllMagic)
+	value[hllEncodingIndex] = byte(hllEncodingSparse)
+	return value
+}
+
+func isValidHll(value []byte) bool {
+	if len(value) < hllHeaderSize || string(value[:len(hllMagic)]) != hllMagic {
+		return false
+	}
+
+	// Registers are validated too, since any value can be written with SET and registers index the histogram of the
+	// count.
+	switch hllEncoding(value[hllEncodingIndex]) {
+	case hllEncodingDense:
+		if len(value) != hllDenseSize {
+			return false
+		}
+		for index := range hllRegisters {
+			if hllDenseRegister(value, index) > hllQ+1 {
+				return false
+			}
+		}
+		return true
+	case hllEncodingSparse:
+		if (len(value)-hllHeaderSize)%hllSparseEntry != 0 {
+			return false
+		}
+		previous := -1
+		for entry := range (len(value) - hllHeaderSize) / hllSparseEntry {
+			index := hllSparseIndex(value, entry)
+			if index <= previous || index >= hllRegisters || value[hllHeaderSize+entry*hllSparseEntry+2] > hllQ+1 {
+				return false
+			}
+			previous = index
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// hllAdd an element to the HyperLogLog value, which must be safe to modify.
+// Returns the (possibly reallocated) value and whether a register was changed.
+func hllAdd(value []byte, element []byte) ([]byte, bool) {
+	elementHash := murmurHash64A(element, hllHashSeed)
+	index := int(elementHash & (hllRegisters - 1))
+	// The register stores the position of the first set bit in the remaining hash.
+	// Setting bit hllQ guarantees the count never exceeds hllQ+1.
+	count := uint8(1)
+	for remaining := elementHash>>hllPrecision | 1<<hllQ; remaining&1 == 0; remaining >>= 1 {
+		count++
+	}
+
+	if hllEncoding(value[hllEncodingIndex]) == hllEncodingDense {
+		if hllDenseRegister(value, index) >= count {
+			return value, false
+		}
+		hllSetDenseRegister(value, index, count)
+		return value, true
+	}
+
+	entries := (len(value) - hllHeaderSize) / hllSparseEntry
+	position := sort.Search(entries, func(entry int) bool {
+		return hllSparseIndex(value, entry) >= index
+	})
+	offset := hllHeaderSize + position*hllSparseEntry
+
+	if position < entries && hllSparseIndex(value, position) == index {
+		if value[offset+2] >= count {
+			return value, false
+		}
+		value[offset+2] = count
+		return value, true
+	}
+
+	if len(value)-hllHeaderSize+hllSparseEntry > hllSparseMaxBytes {
+		registers := make([]uint8, hllRegisters)
+		hllMergeRegisters(value, registers)
+		registers[index] = count
+		dense := hllDenseFromRegisters(registers)
+		// Preserve the cached cardinality state.
+		copy(dense[hllCardIndex:hllHeaderSize], value[hllCardIndex:hllHeaderSize])
+		return dense, true
+	}
+
+	return slices.Insert(value, offset, byte(index>>bitsPerByte), byte(index), count), true
+}
+
+func hllSparseIndex(value []byte, entry int) int {
+	offset := hllHeaderSize + entry*hllSparseEntry
+	return int(binary.BigEndian.Uint16(value[offset:]))
+}
+
+func hllDenseRegister(value []byte, index int) uint8 {
+	registers := value[hllHeaderSize:]
+	bitOffset := index * hllRegisterBits
+	byteIndex, shift := bitOffset/bitsPerByte, bitOffset%bitsPerByte
+
+	register := registers[byteIndex] >> shift
+	if shift > bitsPerByte-hllRegisterBits {
+		register |= registers[byteIndex+1] << (bitsPerByte - shift)
+	}
+	return register & hllRegisterMax
+}
+
+func hllSetDenseRegister(value []byte, index int, register uint8) {
+	registers := value[hllHeaderSize:]
+	bitOffset := index * hllRegisterBits
+	byteIndex, shift := bitOffset/bitsPerByte, bitOffset%bitsPerByte
+
+	registers[byteIndex] &^= hllRegisterMax << shift
+	registers[byteIndex] |= register << shift
+	if shift > bitsPerByte-hllRegisterBits {
+		registers[byteIndex+1] &^= hllRegisterMax >> (bitsPerByte - shift)
+		registers[byteIndex+1] |= register >> (bitsPerByte - shift)
+	}
+}
+
+// hllMergeRegisters into registers, keeping the maximum of each register.
+func hllMergeRegisters(value []byte, registers []uint8) {
+	if hllEncoding(value[hllEncodingIndex]) == hllEncodingDense {
+		for index := range registers {
+			registers[index] = max(registers[index], hllDenseRegister(value, index))
+		}
+		return
+	}
+
+	for entry := range (len(value) - hllHeaderSize) / hllSparseEntry {
+		index := hllSparseIndex(value, entry)
+		registers[index] = max(registers[index], value[hllHeaderSize+entry*hllSparseEntry+2])
+	}
+}
+
+func hllDenseFromRegisters(registers []uint8) []byte {
+	value := make([]byte, hllDenseSize)
+	copy(value, hllMagic)
+	value[hllEncodingIndex] = byte(hllEncodingDense)
+	value[hllCardIndex+7] |= hllCardInvalid
+	for index, register := range registers {
+		hllSetDenseRegister(value, index, register)
+	}
+	return value
+}
+
+// hllCount estimates the cardinality of the registers.
+//
+// Uses the estimator from "New cardinality estimation algorithms for HyperLogLog sketches" (Otmar Ertl, 2017),
+// which is the same as redis and does not require bias correction for small or large cardinalities.
+func hllCount(registers []uint8) uint64 {
+	var histogram [hllQ + 2]int
+	for _, register := range registers {
+		histogram[register]++
+	}
+
+	const registerCount = float64(hllRegisters)
+	estimate := registerCount * hllTau((registerCount-float64(histogram[hllQ+1]))/registerCount)
+	for count := hllQ; count >= 1; count-- {
+		estimate += float64(histogram[count])
+		estimate *= 0.5 //nolint:mnd // reason: part of the estimator formula
+	}
+	estimate += registerCount * hllSigma(float64(histogram[0])/registerCount)
+
+	alpha := 0.5 / math.Ln2 //nolint:mnd // reason: part of the estimator formula
+	return uint64(math.Round(alpha * registerCount * registerCount / estimate))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		previousZ := z
+		z += x * y
+		y += y
+		if previousZ == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		previousZ := z
+		y *= 0.5                  //nolint:mnd // reason: part of the estimator formula
+		z -= math.Pow(1-x, 2) * y //nolint:mnd // reason: part of the estimator formula
+		if previousZ == z {
+			return z / 3 //nolint:mnd // reason: part of the estimator formula
+		}
+	}
+}
+
+// murmurHash64A is the 64 bit MurmurHash2 by Austin Appleby, as used by redis for HyperLogLogs.
+// The hash must never change since HyperLogLog values may be shared and persisted.
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const multiplier = 0xc6a4a7935bd1e995
+	const shift = 47
+
+	result := seed ^ (uint64(len(key)) * multiplier)
+	for len(key) >= 8 {
+		block := binary.LittleEndian.Uint64(key)
+		block *= multiplier
+		block ^= block >> shift
+		block *= multiplier
+
+		result ^= block
+		result *= multiplier
+		key = key[8:]
+	}
+
+	if len(key) != 0 {
+		for index := len(key) - 1; index >= 0; index-- {
+			result ^= uint64(key[index]) << (bitsPerByte * index)
+		}
+		result *= multiplier
+	}
+
+	result ^= result >> shift
+	result *= multiplier
+	result ^= result >> shift
+
+	return result
+}
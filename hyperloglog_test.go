@@ -0,0 +1,226 @@
+package datkey_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+// hllStandardError of the estimate with 16384 registers.
+const hllStandardError = 0.0081
+
+func TestDatkey_PFAdd_PFCount(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.PFCount(ctx, "test")
+		require.Nil(t, err)
+		assert.Zero(t, result.Count)
+	}
+
+	{
+		result, err := client.PFAdd(ctx, "test", []byte("a"), []byte("b"), []byte("c"))
+		require.Nil(t, err)
+		assert.True(t, result.Changed)
+	}
+
+	{
+		result, err := client.PFAdd(ctx, "test", []byte("a"))
+		require.Nil(t, err)
+		assert.False(t, result.Changed)
+	}
+
+	{
+		result, err := client.PFCount(ctx, "test")
+		require.Nil(t, err)
+		assert.Equal(t, int64(3), result.Count)
+	}
+
+	{
+		// Stored as a string value.
+		result, err := client.Get(ctx, "test")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, []byte("HYLL"), result.Value[:4])
+	}
+}
+
+func TestDatkey_PFCount_error_bounds(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	// Cardinalities cover the sparse encoding, the switch to dense, and large sets.
+	cardinalities := []int{10, 100, 1000, 10000, 100000, 500000}
+	for _, cardinality := range cardinalities {
+		t.Run(fmt.Sprintf("cardinality %d", cardinality), func(t *testing.T) {
+			t.Parallel()
+
+			var config datkey.Config
+			client := datkey.New(config)
+			defer client.Close()
+
+			key := "test" + strconv.Itoa(cardinality)
+			elements := make([][]byte, 0, 1000)
+			for index := range cardinality {
+				elements = append(elements, []byte("element"+strconv.Itoa(index)))
+				if len(elements) == cap(elements) {
+					_, err := client.PFAdd(ctx, key, elements...)
+					require.Nil(t, err)
+					elements = elements[:0]
+				}
+			}
+			_, err := client.PFAdd(ctx, key, elements...)
+			require.Nil(t, err)
+
+			result, countErr := client.PFCount(ctx, key)
+			require.Nil(t, countErr)
+
+			// Three standard errors gives over 99% confidence.
+			relativeError := math.Abs(float64(result.Count)-float64(cardinality)) / float64(cardinality)
+			assert.LessOrEqual(t, relativeError, 3*hllStandardError, "estimated %d", result.Count)
+
+			// The cached cardinality matches.
+			cachedResult, countErr := client.PFCount(ctx, key)
+			require.Nil(t, countErr)
+			assert.Equal(t, result.Count, cachedResult.Count)
+		})
+	}
+}
+
+func TestDatkey_PFCount_multiple_keys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	for index := range 5000 {
+		_, err := client.PFAdd(ctx, "a", []byte(strconv.Itoa(index)))
+		require.Nil(t, err)
+		_, err = client.PFAdd(ctx, "b", []byte(strconv.Itoa(index+2500)))
+		require.Nil(t, err)
+	}
+
+	result, err := client.PFCount(ctx, "a", "b", "missing")
+	require.Nil(t, err)
+	assert.InEpsilon(t, 7500, result.Count, 3*hllStandardError)
+}
+
+func TestDatkey_PFMerge(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	for index := range 1000 {
+		_, err := client.PFAdd(ctx, "a", []byte(strconv.Itoa(index)))
+		require.Nil(t, err)
+		_, err = client.PFAdd(ctx, "b", []byte(strconv.Itoa(index+1000)))
+		require.Nil(t, err)
+	}
+	_, err := client.PFAdd(ctx, "dest", []byte(strconv.Itoa(2000)))
+	require.Nil(t, err)
+
+	require.Nil(t, client.PFMerge(ctx, "dest", "a", "b", "missing"))
+
+	result, countErr := client.PFCount(ctx, "dest")
+	require.Nil(t, countErr)
+	assert.InEpsilon(t, 2001, result.Count, 3*hllStandardError)
+
+	// Merging is idempotent.
+	require.Nil(t, client.PFMerge(ctx, "dest", "a"))
+
+	mergedResult, countErr := client.PFCount(ctx, "dest")
+	require.Nil(t, countErr)
+	assert.Equal(t, result.Count, mergedResult.Count)
+}
+
+func TestDatkey_HyperLogLog_wrong_type(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, _ = client.Set(ctx, "test", []byte("value"), 0)
+
+	{
+		_, err := client.PFAdd(ctx, "test", []byte("a"))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteWrongType, err.Cause)
+	}
+
+	{
+		_, err := client.PFCount(ctx, "test")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadWrongType, err.Cause)
+	}
+
+	{
+		_, err := client.PFCount(ctx, "test", "other")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadWrongType, err.Cause)
+	}
+
+	{
+		err := client.PFMerge(ctx, "dest", "test")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteWrongType, err.Cause)
+	}
+}
+
+func TestDatkey_HyperLogLog_corrupt(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	header := func(encoding byte) []byte {
+		value := make([]byte, 16)
+		copy(value, "HYLL")
+		value[4] = encoding
+		return value
+	}
+	dense := append(header(0), make([]byte, 12288)...)
+	// The first register is 63, above the largest count of 51.
+	dense[16] = 0x3f
+
+	for name, value := range map[string][]byte{
+		"sparse index out of range": append(header(1), 0xff, 0xff, 0x01),
+		"sparse indexes not sorted": append(header(1), 0x00, 0x02, 0x01, 0x00, 0x01, 0x01),
+		"sparse register too large": append(header(1), 0x00, 0x01, 0x34),
+		"dense register too large":  dense,
+		"dense registers cut short": dense[:len(dense)-1],
+		"sparse entries cut short":  append(header(1), 0x00, 0x01),
+		"unknown encoding":          header(2),
+	} {
+		_, err := client.Set(ctx, name, value, 0)
+		require.Nil(t, err)
+
+		_, countErr := client.PFCount(ctx, name)
+		require.NotNil(t, countErr, name)
+		assert.Equal(t, datkey.DbReadWrongType, countErr.Cause, name)
+
+		_, addErr := client.PFAdd(ctx, name, []byte("a"))
+		require.NotNil(t, addErr, name)
+		assert.Equal(t, datkey.DbWriteWrongType, addErr.Cause, name)
+	}
+}
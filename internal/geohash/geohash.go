@@ -0,0 +1,332 @@
+// Package geohash implements the 52 bit geohash scheme used by redis for geospatial indexes.
+//
+// Positions are encoded by interleaving 26 bits of longitude with 26 bits of latitude, which fits
+// exactly in the 53 bit mantissa of a float64 sorted set score. Latitude is limited to the range
+// supported by EPSG:900913 (web mercator) just like redis.
+//
+// See: https://github.com/redis/redis/blob/unstable/src/geohash.c
+package geohash
+
+import (
+	"math"
+)
+
+const (
+	StepMax = 26
+	// Bits of a full precision hash.
+	Bits = StepMax * 2
+
+	LongitudeMin = -180.0
+	LongitudeMax = 180.0
+	LatitudeMin  = -85.05112878
+	LatitudeMax  = 85.05112878
+
+	// EarthRadiusMeters is the same earth radius used by redis, so distances match.
+	EarthRadiusMeters = 6372797.560856
+	mercatorMax       = 20037726.37
+
+	standardLatitudeMin = -90.0
+	standardLatitudeMax = 90.0
+	standardAlphabet    = "0123456789bcdefghjkmnpqrstuvwxyz"
+	standardLength      = 11
+	standardCharBits    = 5
+)
+
+// Hash of a position at a given precision (step). Each step adds one bit of longitude and one bit of latitude.
+type Hash struct {
+	Bits uint64
+	Step uint8
+}
+
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// Area covered by a hash.
+type Area struct {
+	Longitude Range
+	Latitude  Range
+}
+
+// Neighbors of a hash, including the hash itself at the center.
+type Neighbors struct {
+	Center    Hash
+	North     Hash
+	East      Hash
+	West      Hash
+	South     Hash
+	NorthEast Hash
+	SouthEast Hash
+	NorthWest Hash
+	SouthWest Hash
+}
+
+// All neighbors, in a stable order, with the center first.
+func (self Neighbors) All() [9]Hash {
+	return [9]Hash{self.Center, self.North, self.South, self.East, self.West, self.NorthEast, self.NorthWest, self.SouthEast, self.SouthWest}
+}
+
+// Valid returns true if the position can be encoded.
+func Valid(longitude float64, latitude float64) bool {
+	return LongitudeMin <= longitude && longitude <= LongitudeMax && LatitudeMin <= latitude && latitude <= LatitudeMax
+}
+
+// Encode a position into a hash with the given precision. The position must be Valid.
+func Encode(longitude float64, latitude float64, step uint8) Hash {
+	return encode(longitude, latitude, step, LatitudeMin, LatitudeMax)
+}
+
+// EncodeScore of a position at full precision, for use as a sorted set score.
+func EncodeScore(longitude float64, latitude float64) float64 {
+	return float64(Encode(longitude, latitude, StepMax).Bits)
+}
+
+// DecodeScore of a sorted set score into the center of the full precision hash.
+func DecodeScore(score float64) (float64, float64) {
+	return Hash{Bits: uint64(score), Step: StepMax}.Center()
+}
+
+// Standard geohash string of the position, which uses the full [-90, 90] latitude range.
+func Standard(longitude float64, latitude float64) string {
+	hash := encode(longitude, latitude, StepMax, standardLatitudeMin, standardLatitudeMax)
+
+	result := make([]byte, standardLength)
+	for index := range result {
+		var alphabetIndex uint64
+		// Only 52 of the 55 bits needed for 11 characters exist, so the last character is always '0'.
+		if index != standardLength-1 {
+			alphabetIndex = (hash.Bits >> (Bits - (index+1)*standardCharBits)) & (1<<standardCharBits - 1)
+		}
+		result[index] = standardAlphabet[alphabetIndex]
+	}
+	return string(result)
+}
+
+func encode(longitude float64, latitude float64, step uint8, latitudeMin float64, latitudeMax float64) Hash {
+	cells := float64(uint64(1) << step)
+	latitudeOffset := uint32((latitude - latitudeMin) / (latitudeMax - latitudeMin) * cells)
+	longitudeOffset := uint32((longitude - LongitudeMin) / (LongitudeMax - LongitudeMin) * cells)
+
+	// The maximum value of the range is part of the last cell.
+	maxOffset := uint32(cells) - 1
+	latitudeOffset = min(latitudeOffset, maxOffset)
+	longitudeOffset = min(longitudeOffset, maxOffset)
+
+	return Hash{
+		Bits: interleave(latitudeOffset, longitudeOffset),
+		Step: step,
+	}
+}
+
+// Decode the area covered by the hash.
+func (self Hash) Decode() Area {
+	latitudeOffset, longitudeOffset := deinterleave(self.Bits)
+	cells := float64(uint64(1) << self.Step)
+
+	latitudeScale := LatitudeMax - LatitudeMin
+	longitudeScale := LongitudeMax - LongitudeMin
+
+	return Area{
+		Longitude: Range{
+			Min: LongitudeMin + (float64(longitudeOffset)/cells)*longitudeScale,
+			Max: LongitudeMin + (float64(longitudeOffset+1)/cells)*longitudeScale,
+		},
+		Latitude: Range{
+			Min: LatitudeMin + (float64(latitudeOffset)/cells)*latitudeScale,
+			Max: LatitudeMin + (float64(latitudeOffset+1)/cells)*latitudeScale,
+		},
+	}
+}
+
+// Center position (longitude, latitude) of the area covered by the hash.
+func (self Hash) Center() (float64, float64) {
+	area := self.Decode()
+	longitude := min(max((area.Longitude.Min+area.Longitude.Max)/2, LongitudeMin), LongitudeMax) //nolint:mnd // reason: midpoint
+	latitude := min(max((area.Latitude.Min+area.Latitude.Max)/2, LatitudeMin), LatitudeMax)      //nolint:mnd // reason: midpoint
+	return longitude, latitude
+}
+
+// ScoreRange of full precision scores covered by the hash, as [min, max).
+func (self Hash) ScoreRange() (uint64, uint64) {
+	shift := Bits - 2*int(self.Step) //nolint:mnd // reason: two bits per step
+	return self.Bits << shift, (self.Bits + 1) << shift
+}
+
+// Neighbors of the hash at the same precision, wrapping around at the edges of the ranges.
+func (self Hash) Neighbors() Neighbors {
+	return Neighbors{
+		Center:    self,
+		North:     self.move(0, 1),
+		South:     self.move(0, -1),
+		East:      self.move(1, 0),
+		West:      self.move(-1, 0),
+		NorthEast: self.move(1, 1),
+		NorthWest: self.move(-1, 1),
+		SouthEast: self.move(1, -1),
+		SouthWest: self.move(-1, -1),
+	}
+}
+
+func (self Hash) move(longitudeDelta int, latitudeDelta int) Hash {
+	latitudeOffset, longitudeOffset := deinterleave(self.Bits)
+	mask := uint32(uint64(1)<<self.Step - 1)
+
+	return Hash{
+		Bits: interleave((latitudeOffset+uint32(latitudeDelta))&mask, (longitudeOffset+uint32(longitudeDelta))&mask),
+		Step: self.Step,
+	}
+}
+
+// EstimateStepsByRadius returns the precision where a hash and its neighbors cover the radius around a position at the latitude.
+func EstimateStepsByRadius(radiusMeters float64, latitude float64) uint8 {
+	if radiusMeters == 0 {
+		return StepMax
+	}
+
+	step := 1
+	for radiusMeters < mercatorMax {
+		radiusMeters *= 2
+		step++
+	}
+	step -= 2 // Make sure the range is included in most of the base cases.
+
+	// Hashes are narrower towards the poles, so more neighbors are needed to cover the radius.
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+
+	return uint8(min(max(step, 1), StepMax))
+}
+
+// BoundingBox around the position with the given half width and half height, in meters.
+func BoundingBox(longitude float64, latitude float64, halfWidthMeters float64, halfHeightMeters float64) Area {
+	latitudeDelta := radiansToDegrees(halfHeightMeters / EarthRadiusMeters)
+	longitudeDeltaTop := radiansToDegrees(halfWidthMeters / EarthRadiusMeters / math.Cos(degreesToRadians(latitude+latitudeDelta)))
+	longitudeDeltaBottom := radiansToDegrees(halfWidthMeters / EarthRadiusMeters / math.Cos(degreesToRadians(latitude-latitudeDelta)))
+
+	// Longitude degrees are widest on the side of the box closest to the pole.
+	longitudeDelta := longitudeDeltaTop
+	if latitude < 0 {
+		longitudeDelta = longitudeDeltaBottom
+	}
+
+	return Area{
+		Longitude: Range{
+			Min: longitude - longitudeDelta,
+			Max: longitude + longitudeDelta,
+		},
+		Latitude: Range{
+			Min: latitude - latitudeDelta,
+			Max: latitude + latitudeDelta,
+		},
+	}
+}
+
+// Distance, in meters, between two positions using the haversine formula.
+func Distance(longitude1 float64, latitude1 float64, longitude2 float64, latitude2 float64) float64 {
+	latitude1Radians := degreesToRadians(latitude1)
+	latitude2Radians := degreesToRadians(latitude2)
+	u := math.Sin((latitude2Radians - latitude1Radians) / 2)                         //nolint:mnd // reason: haversine formula
+	v := math.Sin((degreesToRadians(longitude2) - degreesToRadians(longitude1)) / 2) //nolint:mnd // reason: haversine formula
+	a := u*u + math.Cos(latitude1Radians)*math.Cos(latitude2Radians)*v*v
+	return 2 * EarthRadiusMeters * math.Asin(math.Sqrt(a)) //nolint:mnd // reason: haversine formula
+}
+
+// LatitudeDistance, in meters, between two latitudes along a meridian.
+func LatitudeDistance(latitude1 float64, latitude2 float64) float64 {
+	return EarthRadiusMeters * math.Abs(degreesToRadians(latitude2)-degreesToRadians(latitude1))
+}
+
+func degreesToRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180 //nolint:mnd // reason: degrees in a half circle
+}
+
+func radiansToDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi //nolint:mnd // reason: degrees in a half circle
+}
+
+// interleave the bits of x and y, with x in the even bits and y in the odd bits.
+func interleave(x uint32, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func deinterleave(interleaved uint64) (uint32, uint32) {
+	return squash(interleaved), squash(interleaved >> 1)
+}
+
+// spread the bits of value into the even bits of the result.
+func spread(value uint32) uint64 {
+	result := uint64(value)
+	result = (result | result<<16) & 0x0000FFFF0000FFFF
+	result = (result | result<<8) & 0x00FF00FF00FF00FF
+	result = (result | result<<4) & 0x0F0F0F0F0F0F0F0F
+	result = (result | result<<2) & 0x3333333333333333
+	result = (result | result<<1) & 0x5555555555555555
+	return result
+}
+
+// squash the even bits of value into the result.
+func squash(value uint64) uint32 {
+	result := value & 0x5555555555555555
+	result = (result | result>>1) & 0x3333333333333333
+	result = (result | result>>2) & 0x0F0F0F0F0F0F0F0F
+	result = (result | result>>4) & 0x00FF00FF00FF00FF
+	result = (result | result>>8) & 0x0000FFFF0000FFFF
+	result = (result | result>>16) & 0x00000000FFFFFFFF
+	return uint32(result)
+}
+
+// SearchAreas returns the hashes that together cover a shape centered on the position.
+// The shape is described by its half width and half height, in meters, and the radius of a circle enclosing it.
+// Duplicate hashes and neighbors that cannot overlap the shape are omitted.
+func SearchAreas(longitude float64, latitude float64, halfWidthMeters float64, halfHeightMeters float64, radiusMeters float64) []Hash {
+	bounds := BoundingBox(longitude, latitude, halfWidthMeters, halfHeightMeters)
+
+	step := EstimateStepsByRadius(radiusMeters, latitude)
+	center := Encode(longitude, latitude, step)
+	neighbors := center.Neighbors()
+
+	// The estimated step may produce neighbors too small to cover the shape, in which case the next larger step is used.
+	coversBounds := neighbors.North.Decode().Latitude.Max >= bounds.Latitude.Max &&
+		neighbors.South.Decode().Latitude.Min <= bounds.Latitude.Min &&
+		neighbors.East.Decode().Longitude.Max >= bounds.Longitude.Max &&
+		neighbors.West.Decode().Longitude.Min <= bounds.Longitude.Min
+	if step > 1 && !coversBounds {
+		step--
+		center = Encode(longitude, latitude, step)
+		neighbors = center.Neighbors()
+	}
+
+	excluded := map[Hash]bool{}
+	if step >= 2 { //nolint:mnd // reason: neighbors at the largest steps always overlap
+		area := center.Decode()
+		if area.Latitude.Min < bounds.Latitude.Min {
+			excluded[neighbors.South], excluded[neighbors.SouthEast], excluded[neighbors.SouthWest] = true, true, true
+		}
+		if area.Latitude.Max > bounds.Latitude.Max {
+			excluded[neighbors.North], excluded[neighbors.NorthEast], excluded[neighbors.NorthWest] = true, true, true
+		}
+		if area.Longitude.Min < bounds.Longitude.Min {
+			excluded[neighbors.West], excluded[neighbors.SouthWest], excluded[neighbors.NorthWest] = true, true, true
+		}
+		if area.Longitude.Max > bounds.Longitude.Max {
+			excluded[neighbors.East], excluded[neighbors.SouthEast], excluded[neighbors.NorthEast] = true, true, true
+		}
+	}
+	excluded[center] = false
+
+	areas := make([]Hash, 0, len(neighbors.All()))
+	for _, neighbor := range neighbors.All() {
+		if excluded[neighbor] {
+			continue
+		}
+		// Mark as seen to drop duplicates, which happen when neighbors wrap around at large steps.
+		excluded[neighbor] = true
+		areas = append(areas, neighbor)
+	}
+	return areas
+}
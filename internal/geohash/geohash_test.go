@@ -0,0 +1,86 @@
+package geohash_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wspowell/datkey/internal/geohash"
+)
+
+func Test_Encode_Decode(t *testing.T) {
+	t.Parallel()
+
+	random := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // reason: deterministic test data
+	for range 10000 {
+		longitude := geohash.LongitudeMin + random.Float64()*(geohash.LongitudeMax-geohash.LongitudeMin)
+		latitude := geohash.LatitudeMin + random.Float64()*(geohash.LatitudeMax-geohash.LatitudeMin)
+
+		decodedLongitude, decodedLatitude := geohash.DecodeScore(geohash.EncodeScore(longitude, latitude))
+		assert.InDelta(t, longitude, decodedLongitude, 0.00001)
+		assert.InDelta(t, latitude, decodedLatitude, 0.00001)
+	}
+}
+
+func Test_Neighbors(t *testing.T) {
+	t.Parallel()
+
+	hash := geohash.Encode(13.361389, 38.115556, 10)
+	area := hash.Decode()
+	neighbors := hash.Neighbors()
+
+	assert.InDelta(t, area.Latitude.Max, neighbors.North.Decode().Latitude.Min, 0.0000001)
+	assert.InDelta(t, area.Latitude.Min, neighbors.South.Decode().Latitude.Max, 0.0000001)
+	assert.InDelta(t, area.Longitude.Max, neighbors.East.Decode().Longitude.Min, 0.0000001)
+	assert.InDelta(t, area.Longitude.Min, neighbors.West.Decode().Longitude.Max, 0.0000001)
+	assert.InDelta(t, area.Longitude.Max, neighbors.NorthEast.Decode().Longitude.Min, 0.0000001)
+	assert.InDelta(t, area.Latitude.Max, neighbors.NorthEast.Decode().Latitude.Min, 0.0000001)
+}
+
+func Test_SearchAreas_cover_radius(t *testing.T) {
+	t.Parallel()
+
+	random := rand.New(rand.NewPCG(3, 4)) //nolint:gosec // reason: deterministic test data
+	for range 1000 {
+		longitude := -170 + random.Float64()*340
+		latitude := -80 + random.Float64()*160
+		radius := 1 + random.Float64()*500000
+
+		// Every point on the bounding box must fall in one of the search areas.
+		bounds := geohash.BoundingBox(longitude, latitude, radius, radius)
+		areas := geohash.SearchAreas(longitude, latitude, radius, radius, radius)
+		corners := [][2]float64{
+			{bounds.Longitude.Min, bounds.Latitude.Min},
+			{bounds.Longitude.Min, bounds.Latitude.Max},
+			{bounds.Longitude.Max, bounds.Latitude.Min},
+			{bounds.Longitude.Max, bounds.Latitude.Max},
+		}
+		for _, corner := range corners {
+			if !geohash.Valid(corner[0], corner[1]) {
+				continue
+			}
+			score := uint64(geohash.EncodeScore(corner[0], corner[1]))
+
+			var covered bool
+			for _, area := range areas {
+				minScore, maxScore := area.ScoreRange()
+				covered = covered || (minScore <= score && score < maxScore)
+			}
+			assert.True(t, covered, "corner %v not covered for %f,%f radius %f", corner, longitude, latitude, radius)
+		}
+	}
+}
+
+func Test_Distance(t *testing.T) {
+	t.Parallel()
+
+	assert.InDelta(t, 166274.2578, geohash.Distance(13.361389, 38.115556, 15.087269, 37.502669), 0.001)
+	assert.Zero(t, geohash.Distance(13.361389, 38.115556, 13.361389, 38.115556))
+}
+
+func Test_Standard(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "sqc8b49rny0", geohash.Standard(13.361389338970184, 38.1155563954963))
+}
@@ -0,0 +1,114 @@
+// Package glob matches strings against redis style glob patterns, as used by KEYS, SCAN and PSUBSCRIBE.
+//
+// Patterns support:
+//   - * matches any sequence of characters, including none
+//   - ? matches any single character
+//   - [abc] matches one of the characters, [^abc] matches any other character, and [a-z] matches a range
+//   - \x matches the character x literally
+//
+// Unlike path.Match, there are no special separator characters and malformed patterns never error,
+// an unterminated class simply matches the characters that were given.
+//
+// See: https://github.com/redis/redis/blob/unstable/src/util.c
+package glob
+
+import "strings"
+
+// Match the value against the pattern.
+func Match(pattern string, value string) bool {
+	// Positions to resume from when the most recent * needs to consume another character.
+	starPattern, starValue := -1, -1
+
+	patternIndex, valueIndex := 0, 0
+	for valueIndex < len(value) {
+		if patternIndex < len(pattern) {
+			switch pattern[patternIndex] {
+			case '*':
+				starPattern, starValue = patternIndex, valueIndex
+				patternIndex++
+				continue
+			case '?':
+				patternIndex++
+				valueIndex++
+				continue
+			case '[':
+				if matched, next := matchClass(pattern, patternIndex, value[valueIndex]); matched {
+					patternIndex = next
+					valueIndex++
+					continue
+				}
+			case '\\':
+				if patternIndex+1 < len(pattern) && pattern[patternIndex+1] == value[valueIndex] {
+					patternIndex += 2
+					valueIndex++
+					continue
+				}
+			default:
+				if pattern[patternIndex] == value[valueIndex] {
+					patternIndex++
+					valueIndex++
+					continue
+				}
+			}
+		}
+
+		if starPattern < 0 {
+			return false
+		}
+		starValue++
+		patternIndex, valueIndex = starPattern+1, starValue
+	}
+
+	for patternIndex < len(pattern) && pattern[patternIndex] == '*' {
+		patternIndex++
+	}
+	return patternIndex == len(pattern)
+}
+
+// matchClass of characters starting at the [ at patternIndex. Returns whether the character matched and the index after the class.
+func matchClass(pattern string, patternIndex int, char byte) (bool, int) {
+	index := patternIndex + 1
+	negate := index < len(pattern) && pattern[index] == '^'
+	if negate {
+		index++
+	}
+
+	var matched bool
+	for index < len(pattern) && pattern[index] != ']' {
+		switch {
+		case pattern[index] == '\\' && index+1 < len(pattern):
+			index++
+			matched = matched || pattern[index] == char
+			index++
+		case index+2 < len(pattern) && pattern[index+1] == '-' && pattern[index+2] != ']':
+			low, high := pattern[index], pattern[index+2]
+			if low > high {
+				low, high = high, low
+			}
+			matched = matched || (char >= low && char <= high)
+			index += 3
+		default:
+			matched = matched || pattern[index] == char
+			index++
+		}
+	}
+	if index < len(pattern) {
+		// Skip the closing ].
+		index++
+	}
+
+	return matched != negate, index
+}
+
+// Escape the special characters of the value, so that it only matches itself.
+func Escape(value string) string {
+	var escaped strings.Builder
+	for index := range len(value) {
+		switch value[index] {
+		case '*', '?', '[', '\\':
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteByte(value[index])
+	}
+	return escaped.String()
+}
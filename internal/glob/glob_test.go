@@ -0,0 +1,60 @@
+package glob_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wspowell/datkey/internal/glob"
+)
+
+func Test_Match(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{pattern: "*", value: "", match: true},
+		{pattern: "*", value: "anything/at:all", match: true},
+		{pattern: "", value: "", match: true},
+		{pattern: "", value: "a", match: false},
+		{pattern: "session:*", value: "session:123", match: true},
+		{pattern: "session:*", value: "sessions:123", match: false},
+		{pattern: "*:name", value: "user:1:name", match: true},
+		{pattern: "*:name", value: "user:1:names", match: false},
+		{pattern: "a*b*c", value: "aXXbYYbZc", match: true},
+		{pattern: "a*b*c", value: "aXXcYYb", match: false},
+		{pattern: "h?llo", value: "hello", match: true},
+		{pattern: "h?llo", value: "hllo", match: false},
+		{pattern: "h[ae]llo", value: "hallo", match: true},
+		{pattern: "h[ae]llo", value: "hillo", match: false},
+		{pattern: "h[^e]llo", value: "hallo", match: true},
+		{pattern: "h[^e]llo", value: "hello", match: false},
+		{pattern: "h[a-c]llo", value: "hbllo", match: true},
+		{pattern: "h[c-a]llo", value: "hbllo", match: true},
+		{pattern: "h[a-c]llo", value: "hdllo", match: false},
+		{pattern: `h\*llo`, value: "h*llo", match: true},
+		{pattern: `h\*llo`, value: "hello", match: false},
+		{pattern: `[\]]`, value: "]", match: true},
+		{pattern: "h[ab", value: "ha", match: true},
+		{pattern: "**a", value: "bba", match: true},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.match, glob.Match(testCase.pattern, testCase.value), "%q %q", testCase.pattern, testCase.value)
+	}
+}
+
+func Test_Escape(t *testing.T) {
+	t.Parallel()
+
+	for _, value := range []string{"", "plain:key", `a*b?c[d]e\f`, "[^x-y]"} {
+		pattern := glob.Escape(value)
+		assert.True(t, glob.Match(pattern, value), "%q %q", pattern, value)
+		assert.True(t, glob.Match(pattern+"*", value+"suffix"), "%q %q", pattern, value)
+	}
+	assert.False(t, glob.Match(glob.Escape("a*"), "abc"))
+	assert.False(t, glob.Match(glob.Escape("a?c"), "abc"))
+	assert.False(t, glob.Match(glob.Escape("[ab]"), "a"))
+}
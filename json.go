@@ -0,0 +1,701 @@
+package datkey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// JSONSetMode controls whether JSONSet may create new values or replace existing ones.
+type JSONSetMode string
+
+const (
+	// JSONSetAlways creates or replaces values.
+	JSONSetAlways = JSONSetMode("")
+	// JSONSetNX only creates values that do not exist.
+	JSONSetNX = JSONSetMode("nx")
+	// JSONSetXX only replaces values that exist.
+	JSONSetXX = JSONSetMode("xx")
+)
+
+type commandJSONSet struct {
+	Resp  *jsonSetResponse
+	Value any
+	Key   string
+	Mode  JSONSetMode
+	Path  jsonPath
+}
+
+type jsonSetResponse struct {
+	Updated     bool
+	WrongType   bool
+	InvalidRoot bool
+}
+
+type JSONSetResponse struct {
+	// Updated is true if any value was created or replaced.
+	Updated bool
+}
+
+type commandJSONGet struct {
+	Resp      *jsonGetResponse
+	Key       string
+	PathNames []string
+	Paths     []jsonPath
+}
+
+type jsonGetResponse struct {
+	Value     []byte
+	Exists    bool
+	WrongType bool
+}
+
+type JSONGetResponse struct {
+	// Value is the JSON text of the matches.
+	// For a single path, this is an array of the values matched by the path.
+	// For multiple paths, this is an object of each path to an array of the values matched by the path.
+	Value  []byte
+	Exists bool
+}
+
+type commandJSONDel struct {
+	Resp *integerResponse
+	Key  string
+	Path jsonPath
+}
+
+type JSONDelResponse struct {
+	// Deleted is the number of values deleted.
+	Deleted int64
+}
+
+type commandJSONArrAppend struct {
+	Resp   *jsonArrAppendResponse
+	Key    string
+	Path   jsonPath
+	Values []any
+}
+
+type jsonArrAppendResponse struct {
+	Lengths   []int64
+	WrongType bool
+}
+
+type JSONArrAppendResponse struct {
+	// Lengths of each array matched by the path after appending, in document order.
+	// The length is -1 for any match that is not an array.
+	Lengths []int64
+}
+
+type commandJSONNumIncrBy struct {
+	Resp      *jsonNumIncrByResponse
+	Key       string
+	Path      jsonPath
+	Increment float64
+}
+
+type jsonNumIncrByResponse struct {
+	Value     []byte
+	Exists    bool
+	WrongType bool
+	Overflow  bool
+}
+
+type JSONNumIncrByResponse struct {
+	// Value is the JSON text of an array of the new value of each match, in document order.
+	// The value is null for any match that is not a number.
+	Value  []byte
+	Exists bool
+}
+
+type commandJSONType struct {
+	Resp *jsonTypeResponse
+	Key  string
+	Path jsonPath
+}
+
+type jsonTypeResponse struct {
+	Types     []string
+	WrongType bool
+}
+
+type JSONTypeResponse struct {
+	// Types of each match, in document order. One of "object", "array", "string", "integer", "number", "boolean", or "null".
+	Types []string
+}
+
+// JSONSet the JSON value at the path of the document stored at key.
+// Values matched by the path are replaced. If nothing matches and the path ends with a member name,
+// the member is added to each object matched by the rest of the path.
+// A new document may only be created at the root path "$".
+func (self *Datkey) JSONSet(ctx context.Context, key string, path string, value []byte, mode JSONSetMode) (JSONSetResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return JSONSetResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return jsonSetKey(key, path, value, mode, self.cache.forContext(ctx))
+}
+
+// JSONGet the values at the paths of the document stored at key. The root path "$" is used if no path is given.
+func (self *Datkey) JSONGet(ctx context.Context, key string, paths ...string) (JSONGetResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return JSONGetResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return jsonGetKey(key, paths, self.cache.forContext(ctx))
+}
+
+// JSONDel the values at the path of the document stored at key. Deleting the root path deletes the key.
+func (self *Datkey) JSONDel(ctx context.Context, key string, path string) (JSONDelResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return JSONDelResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return jsonDelKey(key, path, self.cache.forContext(ctx))
+}
+
+// JSONArrAppend the JSON values to each array at the path of the document stored at key.
+func (self *Datkey) JSONArrAppend(ctx context.Context, key string, path string, values ...[]byte) (JSONArrAppendResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return JSONArrAppendResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return jsonArrAppendKey(key, path, values, self.cache.forContext(ctx))
+}
+
+// JSONNumIncrBy increments each number at the path of the document stored at key.
+// Integers remain integers when the increment is a whole number.
+func (self *Datkey) JSONNumIncrBy(ctx context.Context, key string, path string, increment float64) (JSONNumIncrByResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return JSONNumIncrByResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return jsonNumIncrByKey(key, path, increment, self.cache.forContext(ctx))
+}
+
+// JSONType of each value at the path of the document stored at key.
+func (self *Datkey) JSONType(ctx context.Context, key string, path string) (JSONTypeResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return JSONTypeResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return jsonTypeKey(key, path, self.cache.forContext(ctx))
+}
+
+func jsonSetKey(key string, path string, value []byte, mode JSONSetMode, cache cacheStorage) (JSONSetResponse, *errors.Error[DbWriteErr]) {
+	parsedPath, ok := parseJSONPath(path)
+	if !ok {
+		return JSONSetResponse{}, errors.New(DbWriteInvalidArgument, "invalid json path: %s", path) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	switch mode {
+	case JSONSetAlways, JSONSetNX, JSONSetXX:
+	default:
+		return JSONSetResponse{}, errors.New(DbWriteInvalidArgument, "invalid json set mode: %s", mode) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	decoded, err := decodeJSON(value)
+	if err != nil {
+		return JSONSetResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	resp := &jsonSetResponse{
+		Updated:     false,
+		WrongType:   false,
+		InvalidRoot: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandJSONSet{
+		Key:   key,
+		Path:  parsedPath,
+		Value: decoded,
+		Mode:  mode,
+		Resp:  resp,
+	})
+	if redirect != nil {
+		return JSONSetResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return JSONSetResponse{}, errors.New(DbWriteWrongType, "key does not hold a json document: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+	if resp.InvalidRoot {
+		return JSONSetResponse{}, errors.New(DbWriteInvalidArgument, "new json documents must be created at the root path: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return JSONSetResponse{
+		Updated: resp.Updated,
+	}, nil
+}
+
+func jsonGetKey(key string, paths []string, cache cacheStorage) (JSONGetResponse, *errors.Error[DbReadErr]) {
+	if len(paths) == 0 {
+		paths = []string{"$"}
+	}
+
+	parsedPaths := make([]jsonPath, len(paths))
+	for index, path := range paths {
+		parsedPath, ok := parseJSONPath(path)
+		if !ok {
+			return JSONGetResponse{}, errors.New(DbReadInvalidArgument, "invalid json path: %s", path) //nolint:exhaustruct // reason: zero value on error
+		}
+		parsedPaths[index] = parsedPath
+	}
+
+	resp := &jsonGetResponse{
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandJSONGet{
+		Key:       key,
+		PathNames: paths,
+		Paths:     parsedPaths,
+		Resp:      resp,
+	})
+	if redirect != nil {
+		return JSONGetResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return JSONGetResponse{}, errors.New(DbReadWrongType, "key does not hold a json document: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return JSONGetResponse{
+		Value:  resp.Value,
+		Exists: resp.Exists,
+	}, nil
+}
+
+func jsonDelKey(key string, path string, cache cacheStorage) (JSONDelResponse, *errors.Error[DbWriteErr]) {
+	parsedPath, ok := parseJSONPath(path)
+	if !ok {
+		return JSONDelResponse{}, errors.New(DbWriteInvalidArgument, "invalid json path: %s", path) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandJSONDel{
+		Key:  key,
+		Path: parsedPath,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return JSONDelResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return JSONDelResponse{}, errors.New(DbWriteWrongType, "key does not hold a json document: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return JSONDelResponse{
+		Deleted: resp.Value,
+	}, nil
+}
+
+func jsonArrAppendKey(key string, path string, values [][]byte, cache cacheStorage) (JSONArrAppendResponse, *errors.Error[DbWriteErr]) {
+	parsedPath, ok := parseJSONPath(path)
+	if !ok {
+		return JSONArrAppendResponse{}, errors.New(DbWriteInvalidArgument, "invalid json path: %s", path) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	decodedValues := make([]any, len(values))
+	for index, value := range values {
+		decoded, err := decodeJSON(value)
+		if err != nil {
+			return JSONArrAppendResponse{}, err //nolint:exhaustruct // reason: zero value on error
+		}
+		decodedValues[index] = decoded
+	}
+
+	resp := &jsonArrAppendResponse{
+		Lengths:   nil,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandJSONArrAppend{
+		Key:    key,
+		Path:   parsedPath,
+		Values: decodedValues,
+		Resp:   resp,
+	})
+	if redirect != nil {
+		return JSONArrAppendResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return JSONArrAppendResponse{}, errors.New(DbWriteWrongType, "key does not hold a json document: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return JSONArrAppendResponse{
+		Lengths: resp.Lengths,
+	}, nil
+}
+
+func jsonNumIncrByKey(key string, path string, increment float64, cache cacheStorage) (JSONNumIncrByResponse, *errors.Error[DbWriteErr]) {
+	parsedPath, ok := parseJSONPath(path)
+	if !ok {
+		return JSONNumIncrByResponse{}, errors.New(DbWriteInvalidArgument, "invalid json path: %s", path) //nolint:exhaustruct // reason: zero value on error
+	}
+	if math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return JSONNumIncrByResponse{}, errors.New(DbWriteInvalidArgument, "increment is not a finite number") //nolint:exhaustruct // reason: zero value on error
+	}
+
+	resp := &jsonNumIncrByResponse{
+		Value:     nil,
+		Exists:    false,
+		WrongType: false,
+		Overflow:  false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandJSONNumIncrBy{
+		Key:       key,
+		Path:      parsedPath,
+		Increment: increment,
+		Resp:      resp,
+	})
+	if redirect != nil {
+		return JSONNumIncrByResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return JSONNumIncrByResponse{}, errors.New(DbWriteWrongType, "key does not hold a json document: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+	if resp.Overflow {
+		return JSONNumIncrByResponse{}, errors.New(DbWriteInvalidArgument, "increment would overflow: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return JSONNumIncrByResponse{
+		Value:  resp.Value,
+		Exists: resp.Exists,
+	}, nil
+}
+
+func jsonTypeKey(key string, path string, cache cacheStorage) (JSONTypeResponse, *errors.Error[DbReadErr]) {
+	parsedPath, ok := parseJSONPath(path)
+	if !ok {
+		return JSONTypeResponse{}, errors.New(DbReadInvalidArgument, "invalid json path: %s", path) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	resp := &jsonTypeResponse{
+		Types:     nil,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandJSONType{
+		Key:  key,
+		Path: parsedPath,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return JSONTypeResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return JSONTypeResponse{}, errors.New(DbReadWrongType, "key does not hold a json document: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return JSONTypeResponse{
+		Types: resp.Types,
+	}, nil
+}
+
+// lookupJSONDocument returns the stored data and JSON document for a key.
+// Returns false for wrongType if the key exists but is not a JSON document.
+func (self *slotStorage) lookupJSONDocument(key string) (keyStorage, *jsonDocument, bool, bool) {
+	data, exists := self.lookupKey(key)
+	if !exists {
+		return data, nil, false, false
+	}
+
+	document, ok := data.object.(*jsonDocument)
+	if !ok {
+		return data, nil, true, true
+	}
+
+	return data, document, true, false
+}
+
+func (self *slotStorage) handleCommandJSONSet(cmd commandJSONSet) {
+	data, document, exists, wrongType := self.lookupJSONDocument(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+
+	if !exists {
+		if len(cmd.Path) != 0 {
+			cmd.Resp.InvalidRoot = true
+			return
+		}
+		if cmd.Mode == JSONSetXX {
+			return
+		}
+
+		document = newJSONDocument(cmd.Value)
+		self.storeKey(cmd.Key, 0, keyStorage{
+			lastAccessTime: time.Now(),
+			expiresAt:      time.Time{},
+			value:          nil,
+			object:         document,
+			valueShared:    false,
+		})
+		cmd.Resp.Updated = true
+		return
+	}
+
+	previousSize := data.sizeInBytes()
+	data.lastAccessTime = time.Now()
+
+	if matches := cmd.Path.match(document.root); len(matches) != 0 {
+		if cmd.Mode == JSONSetNX {
+			self.storage[cmd.Key] = data
+			return
+		}
+		for _, match := range matches {
+			document.root = match.replace(document.root, copyJSON(cmd.Value))
+		}
+		cmd.Resp.Updated = true
+	} else if cmd.Mode != JSONSetXX {
+		// Nothing matched, so add the member to each parent object.
+		last := cmd.Path[len(cmd.Path)-1]
+		if last.kind == jsonPathChild && !last.recursive {
+			for _, parent := range cmd.Path[:len(cmd.Path)-1].match(document.root) {
+				if object, ok := parent.value.(map[string]any); ok {
+					object[last.name] = copyJSON(cmd.Value)
+					cmd.Resp.Updated = true
+				}
+			}
+		}
+	}
+	if !cmd.Resp.Updated {
+		self.storage[cmd.Key] = data
+		return
+	}
+
+	document.updateSize()
+	self.storeKey(cmd.Key, previousSize, data)
+}
+
+func (self *slotStorage) handleCommandJSONGet(cmd commandJSONGet) {
+	data, document, exists, wrongType := self.lookupJSONDocument(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+
+	// Values are encoded under the lock since the document may be modified in place once the lock is released.
+	if len(cmd.Paths) == 1 {
+		cmd.Resp.Value = encodeJSON(jsonMatchValues(cmd.Paths[0].match(document.root)))
+	} else {
+		results := make(map[string][]any, len(cmd.Paths))
+		for index, path := range cmd.Paths {
+			results[cmd.PathNames[index]] = jsonMatchValues(path.match(document.root))
+		}
+		cmd.Resp.Value = encodeJSON(results)
+	}
+	cmd.Resp.Exists = true
+}
+
+func (self *slotStorage) handleCommandJSONDel(cmd commandJSONDel) {
+	data, document, exists, wrongType := self.lookupJSONDocument(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	previousSize := data.sizeInBytes()
+	if len(cmd.Path) == 0 {
+		self.removeKey(cmd.Key, previousSize)
+		cmd.Resp.Value = 1
+		return
+	}
+
+	// Delete in reverse document order so that removing an array element does not shift the index of other matches.
+	matches := cmd.Path.match(document.root)
+	data.lastAccessTime = time.Now()
+	if len(matches) == 0 {
+		self.storage[cmd.Key] = data
+		return
+	}
+	for index := len(matches) - 1; index >= 0; index-- {
+		switch parent := matches[index].parent.(type) {
+		case map[string]any:
+			delete(parent, matches[index].key)
+		case *jsonArray:
+			parent.items = append(parent.items[:matches[index].index], parent.items[matches[index].index+1:]...)
+		}
+		cmd.Resp.Value++
+	}
+
+	document.updateSize()
+	self.storeKey(cmd.Key, previousSize, data)
+}
+
+func (self *slotStorage) handleCommandJSONArrAppend(cmd commandJSONArrAppend) {
+	data, document, exists, wrongType := self.lookupJSONDocument(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	previousSize := data.sizeInBytes()
+	for _, match := range cmd.Path.match(document.root) {
+		array, ok := match.value.(*jsonArray)
+		if !ok {
+			cmd.Resp.Lengths = append(cmd.Resp.Lengths, -1)
+			continue
+		}
+		for _, value := range cmd.Values {
+			array.items = append(array.items, copyJSON(value))
+		}
+		cmd.Resp.Lengths = append(cmd.Resp.Lengths, int64(len(array.items)))
+	}
+
+	data.lastAccessTime = time.Now()
+	document.updateSize()
+	self.storeKey(cmd.Key, previousSize, data)
+}
+
+func (self *slotStorage) handleCommandJSONNumIncrBy(cmd commandJSONNumIncrBy) {
+	data, document, exists, wrongType := self.lookupJSONDocument(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	// Compute every result before modifying the document so an overflow leaves the document unchanged.
+	matches := cmd.Path.match(document.root)
+	results := make([]any, len(matches))
+	for index, match := range matches {
+		number, ok := match.value.(json.Number)
+		if !ok {
+			continue
+		}
+		result, ok := incrementJSONNumber(number, cmd.Increment)
+		if !ok {
+			cmd.Resp.Overflow = true
+			return
+		}
+		results[index] = result
+	}
+
+	previousSize := data.sizeInBytes()
+	for index, match := range matches {
+		if results[index] != nil {
+			document.root = match.replace(document.root, results[index])
+		}
+	}
+
+	data.lastAccessTime = time.Now()
+	document.updateSize()
+	self.storeKey(cmd.Key, previousSize, data)
+
+	cmd.Resp.Value = encodeJSON(results)
+	cmd.Resp.Exists = true
+}
+
+func (self *slotStorage) handleCommandJSONType(cmd commandJSONType) {
+	data, document, exists, wrongType := self.lookupJSONDocument(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+	for _, match := range cmd.Path.match(document.root) {
+		cmd.Resp.Types = append(cmd.Resp.Types, jsonTypeOf(match.value))
+	}
+}
+
+// incrementJSONNumber returns false if the result is not a finite number.
+func incrementJSONNumber(number json.Number, increment float64) (json.Number, bool) {
+	if value, err := number.Int64(); err == nil && increment == math.Trunc(increment) && math.Abs(increment) < math.MaxInt64 {
+		delta := int64(increment)
+		result := value + delta
+		// Fall back to floating point if the integer overflows.
+		if (delta > 0 && result > value) || (delta < 0 && result < value) || delta == 0 {
+			return json.Number(strconv.FormatInt(result, 10)), true
+		}
+	}
+
+	value, err := number.Float64()
+	if err != nil {
+		return "", false
+	}
+
+	result := value + increment
+	if math.IsInf(result, 0) {
+		return "", false
+	}
+
+	return json.Number(strconv.FormatFloat(result, 'g', -1, 64)), true
+}
+
+func jsonMatchValues(matches []jsonMatch) []any {
+	values := make([]any, len(matches))
+	for index, match := range matches {
+		values[index] = match.value
+	}
+	return values
+}
+
+func encodeJSON(value any) []byte {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		// Documents only ever hold values decoded from valid JSON, so this should never be hit and would indicate an internal library issue.
+		panic(fmt.Sprintf("failed to encode json document: %v", err))
+	}
+	return encoded
+}
+
+// jsonDocument is a JSON value that can be queried and modified in place by path.
+type jsonDocument struct {
+	root any
+	size int64
+}
+
+func newJSONDocument(root any) *jsonDocument {
+	document := &jsonDocument{
+		root: root,
+		size: 0,
+	}
+	document.updateSize()
+	return document
+}
+
+func (self *jsonDocument) valueType() ValueType {
+	return ValueTypeJSON
+}
+
+func (self *jsonDocument) sizeInBytes() int64 {
+	return self.size
+}
+
+// updateSize to the encoded size of the document. This must be called after every modification.
+func (self *jsonDocument) updateSize() {
+	self.size = int64(len(encodeJSON(self.root)))
+}
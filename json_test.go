@@ -0,0 +1,290 @@
+package datkey_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+const jsonTestDocument = `{"name":"datkey","tags":["cache","kv"],"stats":{"hits":10,"ratio":0.5},"nested":{"name":"inner"}}`
+
+func TestDatkey_JSONSet_JSONGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		_, err := client.JSONSet(ctx, "test", "$.name", []byte(`"x"`), datkey.JSONSetAlways)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	{
+		result, err := client.JSONSet(ctx, "test", "$", []byte(jsonTestDocument), datkey.JSONSetAlways)
+		require.Nil(t, err)
+		assert.True(t, result.Updated)
+		assert.Equal(t, datkey.ValueTypeJSON, typeOf(t, client, "test").Type)
+	}
+
+	{
+		result, err := client.JSONGet(ctx, "test")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.JSONEq(t, "["+jsonTestDocument+"]", string(result.Value))
+	}
+
+	{
+		result, err := client.JSONGet(ctx, "test", "$.tags[-1]")
+		require.Nil(t, err)
+		assert.JSONEq(t, `["kv"]`, string(result.Value))
+	}
+
+	{
+		result, err := client.JSONGet(ctx, "test", "$..name", "$['stats'].*")
+		require.Nil(t, err)
+		assert.JSONEq(t, `{"$..name":["datkey","inner"],"$['stats'].*":[10,0.5]}`, string(result.Value))
+	}
+
+	{
+		// Replace an existing value.
+		result, err := client.JSONSet(ctx, "test", "$.stats.hits", []byte(`11`), datkey.JSONSetAlways)
+		require.Nil(t, err)
+		assert.True(t, result.Updated)
+	}
+
+	{
+		// Add a member to an existing object.
+		result, err := client.JSONSet(ctx, "test", "$.stats.misses", []byte(`{"count":1}`), datkey.JSONSetAlways)
+		require.Nil(t, err)
+		assert.True(t, result.Updated)
+	}
+
+	{
+		result, err := client.JSONSet(ctx, "test", "$.stats.hits", []byte(`0`), datkey.JSONSetNX)
+		require.Nil(t, err)
+		assert.False(t, result.Updated)
+	}
+
+	{
+		result, err := client.JSONSet(ctx, "test", "$.stats.missing", []byte(`0`), datkey.JSONSetXX)
+		require.Nil(t, err)
+		assert.False(t, result.Updated)
+	}
+
+	{
+		result, err := client.JSONGet(ctx, "test", "$.stats")
+		require.Nil(t, err)
+		assert.JSONEq(t, `[{"hits":11,"misses":{"count":1},"ratio":0.5}]`, string(result.Value))
+	}
+
+	{
+		_, err := client.JSONSet(ctx, "test", "$", []byte(`{"invalid"`), datkey.JSONSetAlways)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	{
+		_, err := client.JSONGet(ctx, "test", "name")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadInvalidArgument, err.Cause)
+	}
+
+	{
+		result, err := client.JSONGet(ctx, "missing")
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+}
+
+func TestDatkey_JSONDel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.JSONSet(ctx, "test", "$", []byte(jsonTestDocument), datkey.JSONSetAlways)
+	require.Nil(t, err)
+
+	{
+		result, err := client.JSONDel(ctx, "test", "$.tags[*]")
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), result.Deleted)
+	}
+
+	{
+		result, err := client.JSONDel(ctx, "test", "$..name")
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), result.Deleted)
+	}
+
+	{
+		result, err := client.JSONGet(ctx, "test")
+		require.Nil(t, err)
+		assert.JSONEq(t, `[{"tags":[],"stats":{"hits":10,"ratio":0.5},"nested":{}}]`, string(result.Value))
+	}
+
+	{
+		result, err := client.JSONDel(ctx, "test", "$")
+		require.Nil(t, err)
+		assert.Equal(t, int64(1), result.Deleted)
+		assert.False(t, typeOf(t, client, "test").Exists)
+	}
+}
+
+func TestDatkey_JSON_noMatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.JSONSet(ctx, "test", "$", []byte(jsonTestDocument), datkey.JSONSetAlways)
+	require.Nil(t, err)
+
+	// Commands that change nothing are not a change to the key.
+	watcher := client.WatchKeyspace(10)
+	defer watcher.Close()
+
+	{
+		result, err := client.JSONDel(ctx, "test", "$.missing")
+		require.Nil(t, err)
+		assert.Equal(t, int64(0), result.Deleted)
+	}
+	{
+		result, err := client.JSONSet(ctx, "test", "$.missing", []byte(`1`), datkey.JSONSetXX)
+		require.Nil(t, err)
+		assert.False(t, result.Updated)
+	}
+	{
+		result, err := client.JSONSet(ctx, "test", "$.missing.child", []byte(`1`), datkey.JSONSetAlways)
+		require.Nil(t, err)
+		assert.False(t, result.Updated)
+	}
+	assert.Empty(t, watcher.Events())
+
+	{
+		result, err := client.JSONGet(ctx, "test")
+		require.Nil(t, err)
+		assert.JSONEq(t, "["+jsonTestDocument+"]", string(result.Value))
+	}
+}
+
+func TestDatkey_JSONArrAppend(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.JSONSet(ctx, "test", "$", []byte(jsonTestDocument), datkey.JSONSetAlways)
+	require.Nil(t, err)
+
+	{
+		result, err := client.JSONArrAppend(ctx, "test", "$.tags", []byte(`"fast"`), []byte(`{"a":1}`))
+		require.Nil(t, err)
+		assert.Equal(t, []int64{4}, result.Lengths)
+	}
+
+	{
+		result, err := client.JSONArrAppend(ctx, "test", "$.name", []byte(`1`))
+		require.Nil(t, err)
+		assert.Equal(t, []int64{-1}, result.Lengths)
+	}
+
+	{
+		result, err := client.JSONGet(ctx, "test", "$.tags")
+		require.Nil(t, err)
+		assert.JSONEq(t, `[["cache","kv","fast",{"a":1}]]`, string(result.Value))
+	}
+}
+
+func TestDatkey_JSONNumIncrBy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.JSONSet(ctx, "test", "$", []byte(jsonTestDocument), datkey.JSONSetAlways)
+	require.Nil(t, err)
+
+	{
+		result, err := client.JSONNumIncrBy(ctx, "test", "$.stats.*", 2)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.JSONEq(t, `[12,2.5]`, string(result.Value))
+	}
+
+	{
+		result, err := client.JSONNumIncrBy(ctx, "test", "$.stats.hits", 0.5)
+		require.Nil(t, err)
+		assert.JSONEq(t, `[12.5]`, string(result.Value))
+	}
+
+	{
+		result, err := client.JSONNumIncrBy(ctx, "test", "$.name", 1)
+		require.Nil(t, err)
+		assert.JSONEq(t, `[null]`, string(result.Value))
+	}
+
+	{
+		_, err := client.JSONSet(ctx, "test", "$.stats.max", []byte(`9223372036854775807`), datkey.JSONSetAlways)
+		require.Nil(t, err)
+
+		// Integer overflow falls back to floating point.
+		result, err := client.JSONNumIncrBy(ctx, "test", "$.stats.max", 1)
+		require.Nil(t, err)
+		assert.JSONEq(t, `[9223372036854775808]`, string(result.Value))
+	}
+
+	{
+		_, err := client.JSONSet(ctx, "test", "$.stats.huge", []byte(`1.7e308`), datkey.JSONSetAlways)
+		require.Nil(t, err)
+
+		_, err = client.JSONNumIncrBy(ctx, "test", "$.stats.huge", 1.7e308)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+}
+
+func TestDatkey_JSONType(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.JSONSet(ctx, "test", "$", []byte(`{"a":1,"b":1.5,"c":"s","d":true,"e":null,"f":[],"g":{}}`), datkey.JSONSetAlways)
+	require.Nil(t, err)
+
+	{
+		result, err := client.JSONType(ctx, "test", "$.*")
+		require.Nil(t, err)
+		assert.Equal(t, []string{"integer", "number", "string", "boolean", "null", "array", "object"}, result.Types)
+	}
+
+	{
+		client.Set(ctx, "string", []byte("value"), 0)
+
+		_, err := client.JSONType(ctx, "string", "$")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadWrongType, err.Cause)
+
+		_, setErr := client.JSONSet(ctx, "string", "$", []byte(`1`), datkey.JSONSetAlways)
+		require.NotNil(t, setErr)
+		assert.Equal(t, datkey.DbWriteWrongType, setErr.Cause)
+	}
+}
@@ -0,0 +1,311 @@
+package datkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// JSON documents are decoded into a tree of map[string]any objects, *jsonArray arrays, json.Number numbers,
+// strings, booleans, and nil. Arrays are held by pointer so they can be modified in place when matched by a path.
+//
+// Paths support the following subset of JSONPath:
+//
+//	$           the root
+//	.name       child member
+//	['name']    child member, allowing any characters in the name
+//	[index]     array element, where negative indexes count from the end
+//	.* or [*]   all children of an object or array
+//	..name      recursive descent to all members with the name
+//	..*         recursive descent to all descendants
+type jsonArray struct {
+	items []any
+}
+
+func (self *jsonArray) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.items) //nolint:wrapcheck // reason: implements json.Marshaler
+}
+
+type jsonPathSegmentKind uint8
+
+const (
+	jsonPathChild = jsonPathSegmentKind(iota)
+	jsonPathIndex
+	jsonPathWildcard
+)
+
+type jsonPathSegment struct {
+	name      string
+	index     int
+	kind      jsonPathSegmentKind
+	recursive bool
+}
+
+type jsonPath []jsonPathSegment
+
+// jsonMatch is a value matched by a path along with where it is stored so it can be replaced or deleted.
+// The root document has no parent.
+type jsonMatch struct {
+	parent any
+	value  any
+	key    string
+	index  int
+}
+
+// parseJSONPath returns false if the path is not valid.
+func parseJSONPath(path string) (jsonPath, bool) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, false
+	}
+
+	var segments jsonPath
+	remaining := path[1:]
+	for remaining != "" {
+		var recursive bool
+		switch {
+		case strings.HasPrefix(remaining, ".."):
+			recursive = true
+			remaining = remaining[2:]
+		case remaining[0] == '.':
+			remaining = remaining[1:]
+		case remaining[0] == '[':
+		default:
+			return nil, false
+		}
+
+		if remaining == "" {
+			return nil, false
+		}
+
+		segment := jsonPathSegment{
+			name:      "",
+			index:     0,
+			kind:      jsonPathChild,
+			recursive: recursive,
+		}
+
+		if remaining[0] == '[' {
+			end := strings.IndexByte(remaining, ']')
+			if end == -1 {
+				return nil, false
+			}
+			selector := remaining[1:end]
+			remaining = remaining[end+1:]
+
+			switch {
+			case selector == "*":
+				segment.kind = jsonPathWildcard
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				segment.name = selector[1 : len(selector)-1]
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, false
+				}
+				segment.kind = jsonPathIndex
+				segment.index = index
+			}
+		} else {
+			end := strings.IndexAny(remaining, ".[")
+			if end == -1 {
+				end = len(remaining)
+			}
+			segment.name = remaining[:end]
+			remaining = remaining[end:]
+
+			if segment.name == "*" {
+				segment.kind = jsonPathWildcard
+			} else if segment.name == "" {
+				return nil, false
+			}
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, true
+}
+
+// match all values in the document selected by the path, in document order.
+func (self jsonPath) match(root any) []jsonMatch {
+	matches := []jsonMatch{{
+		parent: nil,
+		value:  root,
+		key:    "",
+		index:  0,
+	}}
+
+	for _, segment := range self {
+		var next []jsonMatch
+		for _, match := range matches {
+			if segment.recursive {
+				for _, descendant := range jsonDescendants(match) {
+					next = append(next, segment.apply(descendant.value)...)
+				}
+			} else {
+				next = append(next, segment.apply(match.value)...)
+			}
+		}
+		matches = next
+	}
+
+	return matches
+}
+
+// apply the segment to a value, returning the matching children.
+func (self jsonPathSegment) apply(value any) []jsonMatch {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		switch self.kind {
+		case jsonPathChild:
+			if child, exists := typedValue[self.name]; exists {
+				return []jsonMatch{{parent: typedValue, value: child, key: self.name, index: 0}}
+			}
+		case jsonPathWildcard:
+			matches := make([]jsonMatch, 0, len(typedValue))
+			for _, key := range jsonSortedKeys(typedValue) {
+				matches = append(matches, jsonMatch{parent: typedValue, value: typedValue[key], key: key, index: 0})
+			}
+			return matches
+		case jsonPathIndex:
+		}
+	case *jsonArray:
+		switch self.kind {
+		case jsonPathIndex:
+			index := self.index
+			if index < 0 {
+				index += len(typedValue.items)
+			}
+			if 0 <= index && index < len(typedValue.items) {
+				return []jsonMatch{{parent: typedValue, value: typedValue.items[index], key: "", index: index}}
+			}
+		case jsonPathWildcard:
+			matches := make([]jsonMatch, len(typedValue.items))
+			for index, item := range typedValue.items {
+				matches[index] = jsonMatch{parent: typedValue, value: item, key: "", index: index}
+			}
+			return matches
+		case jsonPathChild:
+		}
+	}
+
+	return nil
+}
+
+// jsonDescendants of a match, including the match itself, in document order.
+func jsonDescendants(match jsonMatch) []jsonMatch {
+	descendants := []jsonMatch{match}
+	wildcard := jsonPathSegment{
+		name:      "",
+		index:     0,
+		kind:      jsonPathWildcard,
+		recursive: false,
+	}
+	for _, child := range wildcard.apply(match.value) {
+		descendants = append(descendants, jsonDescendants(child)...)
+	}
+	return descendants
+}
+
+func jsonSortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// replace the matched value. Returns the new root, which only changes when the match is the root.
+func (self jsonMatch) replace(root any, value any) any {
+	switch parent := self.parent.(type) {
+	case map[string]any:
+		parent[self.key] = value
+	case *jsonArray:
+		parent.items[self.index] = value
+	default:
+		return value
+	}
+	return root
+}
+
+// decodeJSON text into a document tree.
+func decodeJSON(text []byte) (any, *errors.Error[DbWriteErr]) {
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, errors.NewFromError(DbWriteInvalidArgument, err)
+	}
+	if decoder.More() {
+		return nil, errors.New(DbWriteInvalidArgument, "unexpected data after json value")
+	}
+
+	return toJSONTree(value), nil
+}
+
+func toJSONTree(value any) any {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		for key, child := range typedValue {
+			typedValue[key] = toJSONTree(child)
+		}
+		return typedValue
+	case []any:
+		for index, child := range typedValue {
+			typedValue[index] = toJSONTree(child)
+		}
+		return &jsonArray{
+			items: typedValue,
+		}
+	default:
+		return value
+	}
+}
+
+// copyJSON deep copies a document tree.
+func copyJSON(value any) any {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		object := make(map[string]any, len(typedValue))
+		for key, child := range typedValue {
+			object[key] = copyJSON(child)
+		}
+		return object
+	case *jsonArray:
+		items := make([]any, len(typedValue.items))
+		for index, child := range typedValue.items {
+			items[index] = copyJSON(child)
+		}
+		return &jsonArray{
+			items: items,
+		}
+	default:
+		return value
+	}
+}
+
+func jsonTypeOf(value any) string {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		return "object"
+	case *jsonArray:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := typedValue.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "null"
+	}
+}
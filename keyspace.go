@@ -0,0 +1,188 @@
+package datkey
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyspaceEventType of a change to a key.
+type KeyspaceEventType string
+
+const (
+	// KeyspaceEventSet is emitted when a key is written by any command.
+	KeyspaceEventSet KeyspaceEventType = "set"
+	// KeyspaceEventDel is emitted when a key is deleted by a command.
+	KeyspaceEventDel KeyspaceEventType = "del"
+	// KeyspaceEventExpire is emitted when a ttl is set on a key.
+	KeyspaceEventExpire KeyspaceEventType = "expire"
+	// KeyspaceEventPersist is emitted when the ttl of a key is removed.
+	KeyspaceEventPersist KeyspaceEventType = "persist"
+	// KeyspaceEventExpired is emitted when a key that has expired is deleted, either once it is accessed or by the
+	// expire worker, so it may be emitted some time after the key expired.
+	KeyspaceEventExpired KeyspaceEventType = "expired"
+	// KeyspaceEventEvicted is emitted when a key is evicted to bring the database under DbBytesEvictThreshold.
+	KeyspaceEventEvicted KeyspaceEventType = "evicted"
+)
+
+const (
+	// KeyspaceChannelPrefix of the channel each event is published to, followed by the key, with the event type as
+	// the message.
+	KeyspaceChannelPrefix = "__keyspace@0__:"
+	// KeyeventChannelPrefix of the channel each event is published to, followed by the event type, with the key as
+	// the message.
+	KeyeventChannelPrefix = "__keyevent@0__:"
+)
+
+// validKeyspaceEventType of the events emitted by the database.
+func validKeyspaceEventType(eventType KeyspaceEventType) bool {
+	switch eventType {
+	case KeyspaceEventSet, KeyspaceEventDel, KeyspaceEventExpire, KeyspaceEventPersist, KeyspaceEventExpired, KeyspaceEventEvicted:
+		return true
+	default:
+		return false
+	}
+}
+
+// KeyspaceEvent describes a change to a key.
+type KeyspaceEvent struct {
+	Key  string
+	Type KeyspaceEventType
+}
+
+// KeyspaceWatcher receives the events for changes to the keyspace of the types it watches, in the order they were made
+// to each key.
+type KeyspaceWatcher struct {
+	events   chan KeyspaceEvent
+	notifier *keyspaceNotifier
+	// eventTypes watched, or nil to watch every event.
+	eventTypes map[KeyspaceEventType]empty
+	dropped    atomic.Int64
+	close      sync.Once
+}
+
+// WatchKeyspace for changes to keys, of the event types or of every type if none are given. Events are buffered up to
+// bufferSize, after which new events are dropped rather than blocking commands. The watcher must be closed once it is
+// no longer read from.
+func (self *Datkey) WatchKeyspace(bufferSize int, eventTypes ...KeyspaceEventType) *KeyspaceWatcher {
+	return self.cache.notifier.watch(bufferSize, eventTypes)
+}
+
+// HandleKeyspace events of the types, or of every type if none are given, by calling the handler with each event in
+// turn from another goroutine. Events are buffered up to bufferSize while the handler runs, as by WatchKeyspace.
+// The handler is called with the events buffered before the watcher is closed, and then no more.
+func (self *Datkey) HandleKeyspace(bufferSize int, handler func(event KeyspaceEvent), eventTypes ...KeyspaceEventType) *KeyspaceWatcher {
+	watcher := self.cache.notifier.watch(bufferSize, eventTypes)
+	go func() {
+		for event := range watcher.Events() {
+			handler(event)
+		}
+	}()
+	return watcher
+}
+
+// Events received by the watcher. The channel is closed when the watcher is closed.
+func (self *KeyspaceWatcher) Events() <-chan KeyspaceEvent {
+	return self.events
+}
+
+// Dropped count of events that did not fit in the buffer.
+func (self *KeyspaceWatcher) Dropped() int64 {
+	return self.dropped.Load()
+}
+
+// Close the watcher. Safe to call more than once.
+func (self *KeyspaceWatcher) Close() {
+	self.close.Do(func() {
+		self.notifier.unwatch(self)
+		close(self.events)
+	})
+}
+
+// keyspaceNotifier sends events to every watcher of the keyspace, and publishes them to pub/sub if configured. Events
+// are sent under the slot lock, so they are never blocked on.
+type keyspaceNotifier struct {
+	watchers map[*KeyspaceWatcher]empty
+	mutex    sync.RWMutex
+	// watching is true while there are any watchers, so commands do not take the lock when nobody is watching.
+	watching atomic.Bool
+	// pubSub the published event types are published to.
+	pubSub    *pubSub
+	published map[KeyspaceEventType]bool
+}
+
+func newKeyspaceNotifier(pubSub *pubSub, published []KeyspaceEventType) *keyspaceNotifier {
+	notifier := &keyspaceNotifier{
+		watchers:  map[*KeyspaceWatcher]empty{},
+		mutex:     sync.RWMutex{},
+		watching:  atomic.Bool{},
+		pubSub:    pubSub,
+		published: map[KeyspaceEventType]bool{},
+	}
+	for _, eventType := range published {
+		notifier.published[eventType] = true
+	}
+	return notifier
+}
+
+func (self *keyspaceNotifier) watch(bufferSize int, eventTypes []KeyspaceEventType) *KeyspaceWatcher {
+	watcher := &KeyspaceWatcher{
+		events:     make(chan KeyspaceEvent, bufferSize),
+		notifier:   self,
+		eventTypes: nil,
+		dropped:    atomic.Int64{},
+		close:      sync.Once{},
+	}
+	if len(eventTypes) != 0 {
+		watcher.eventTypes = map[KeyspaceEventType]empty{}
+		for _, eventType := range eventTypes {
+			watcher.eventTypes[eventType] = empty{}
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.watchers[watcher] = empty{}
+	self.watching.Store(true)
+
+	return watcher
+}
+
+func (self *keyspaceNotifier) unwatch(watcher *KeyspaceWatcher) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.watchers, watcher)
+	self.watching.Store(len(self.watchers) != 0)
+}
+
+func (self *keyspaceNotifier) notify(eventType KeyspaceEventType, key string) {
+	if self.published[eventType] {
+		// Publishing never blocks, whatever the overflow policy, since commands must not wait on subscribers.
+		self.pubSub.publish(context.Background(), KeyspaceChannelPrefix+key, []byte(eventType), PubSubDrop)
+		self.pubSub.publish(context.Background(), KeyeventChannelPrefix+string(eventType), []byte(key), PubSubDrop)
+	}
+
+	if !self.watching.Load() {
+		return
+	}
+
+	event := KeyspaceEvent{
+		Key:  key,
+		Type: eventType,
+	}
+
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	for watcher := range self.watchers {
+		if watcher.eventTypes != nil {
+			if _, watched := watcher.eventTypes[eventType]; !watched {
+				continue
+			}
+		}
+		select {
+		case watcher.events <- event:
+		default:
+			watcher.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package datkey_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_WatchKeyspace(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	// Changes before watching are not seen.
+	_, err := client.Set(ctx, "before", []byte("value"), 0)
+	require.Nil(t, err)
+
+	watcher := client.WatchKeyspace(10)
+
+	_, err = client.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = client.Expire(ctx, "key", time.Hour)
+	require.Nil(t, err)
+	_, err = client.Persist(ctx, "key")
+	require.Nil(t, err)
+	_, zaddErr := client.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1})
+	require.Nil(t, zaddErr)
+	_, zremErr := client.ZRem(ctx, "zset", "a")
+	require.Nil(t, zremErr)
+	_, err = client.Delete(ctx, "key")
+	require.Nil(t, err)
+	// Deleting a key that does not exist is not a change.
+	_, err = client.Delete(ctx, "key")
+	require.Nil(t, err)
+
+	expected := []datkey.KeyspaceEvent{
+		{Key: "key", Type: datkey.KeyspaceEventSet},
+		{Key: "key", Type: datkey.KeyspaceEventExpire},
+		{Key: "key", Type: datkey.KeyspaceEventPersist},
+		{Key: "zset", Type: datkey.KeyspaceEventSet},
+		{Key: "zset", Type: datkey.KeyspaceEventDel},
+		{Key: "key", Type: datkey.KeyspaceEventDel},
+	}
+	for _, event := range expected {
+		assert.Equal(t, event, <-watcher.Events())
+	}
+	assert.Empty(t, watcher.Events())
+
+	// Events that do not fit in the buffer are dropped.
+	for range 15 {
+		_, err = client.Set(ctx, "key", []byte("value"), 0)
+		require.Nil(t, err)
+	}
+	assert.Len(t, watcher.Events(), 10)
+	assert.Equal(t, int64(5), watcher.Dropped())
+
+	watcher.Close()
+	watcher.Close()
+	_, err = client.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+	// Buffered events are still received after closing, but nothing newer.
+	var remaining int
+	for range watcher.Events() {
+		remaining++
+	}
+	assert.Equal(t, 10, remaining)
+}
+
+func TestDatkey_WatchKeyspace_expired(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.ExpirationFrequency = 10 * time.Millisecond
+	client := datkey.New(config)
+	defer client.Close()
+
+	watcher := client.WatchKeyspace(10, datkey.KeyspaceEventExpired)
+	defer watcher.Close()
+
+	// Keys are expired once they are accessed.
+	_, err := client.Set(ctx, "lazy", []byte("value"), time.Millisecond)
+	require.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	result, getErr := client.Get(ctx, "lazy")
+	require.Nil(t, getErr)
+	assert.False(t, result.Exists)
+	assert.Equal(t, datkey.KeyspaceEvent{Key: "lazy", Type: datkey.KeyspaceEventExpired}, <-watcher.Events())
+
+	// Keys that are never accessed are expired by the expire worker.
+	_, err = client.Set(ctx, "worker", []byte("value"), time.Millisecond)
+	require.Nil(t, err)
+	select {
+	case event := <-watcher.Events():
+		assert.Equal(t, datkey.KeyspaceEvent{Key: "worker", Type: datkey.KeyspaceEventExpired}, event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the expire worker did not expire the key")
+	}
+
+	// Only the watched event types are received.
+	_, err = client.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = client.Delete(ctx, "key")
+	require.Nil(t, err)
+	assert.Empty(t, watcher.Events())
+}
+
+func TestDatkey_WatchKeyspace_evicted(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.DbBytesEvictThreshold = 5
+	config.EvictionFrequency = 10 * time.Millisecond
+	client := datkey.New(config)
+	defer client.Close()
+
+	evicted := make(chan datkey.KeyspaceEvent, 10)
+	watcher := client.HandleKeyspace(10, func(event datkey.KeyspaceEvent) {
+		evicted <- event
+	}, datkey.KeyspaceEventEvicted)
+	defer watcher.Close()
+
+	_, err := client.Set(ctx, "key", []byte("1234567890"), 0)
+	require.Nil(t, err)
+	select {
+	case event := <-evicted:
+		assert.Equal(t, datkey.KeyspaceEvent{Key: "key", Type: datkey.KeyspaceEventEvicted}, event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the key was not evicted")
+	}
+}
+
+func TestDatkey_NotifyKeyspaceEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.NotifyKeyspaceEvents = []datkey.KeyspaceEventType{datkey.KeyspaceEventSet, datkey.KeyspaceEventExpired}
+	client := datkey.New(config)
+	defer client.Close()
+
+	keyspace := client.PSubscribe("__keyspace@0__:*")
+	defer keyspace.Close()
+	keyevent := client.Subscribe("__keyevent@0__:expired")
+	defer keyevent.Close()
+
+	_, err := client.Set(ctx, "key", []byte("value"), time.Millisecond)
+	require.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, ttlErr := client.Ttl(ctx, "key")
+	require.Nil(t, ttlErr)
+	// Event types that are not configured are not published.
+	_, err = client.Set(ctx, "other", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = client.Delete(ctx, "other")
+	require.Nil(t, err)
+
+	expected := []datkey.Message{
+		{Channel: "__keyspace@0__:key", Pattern: "__keyspace@0__:*", Payload: []byte("set")},
+		{Channel: "__keyspace@0__:key", Pattern: "__keyspace@0__:*", Payload: []byte("expired")},
+		{Channel: "__keyspace@0__:other", Pattern: "__keyspace@0__:*", Payload: []byte("set")},
+	}
+	for _, message := range expected {
+		assert.Equal(t, message, <-keyspace.Messages())
+	}
+	assert.Empty(t, keyspace.Messages())
+	assert.Equal(t, datkey.Message{Channel: "__keyevent@0__:expired", Pattern: "", Payload: []byte("key")}, <-keyevent.Messages())
+	assert.Empty(t, keyevent.Messages())
+
+	var invalid datkey.Config
+	invalid.NotifyKeyspaceEvents = []datkey.KeyspaceEventType{"invalid"}
+	assert.Panics(t, func() {
+		datkey.New(invalid)
+	})
+}
@@ -41,3 +41,8 @@ func (self *Error[T]) Error() string {
 func (self *Error[T]) String() string {
 	return self.err.String()
 }
+
+// Unwrap the error the error was created from with NewFromError, so that errors.Is and errors.As find it.
+func (self *Error[T]) Unwrap() error {
+	return self.err.err
+}
@@ -28,6 +28,20 @@ func TestErrors_NewFromError_Error(t *testing.T) {
 	assert.Equal(t, err.Error(), err.String())
 }
 
+func TestErrors_Unwrap(t *testing.T) {
+	t.Parallel()
+
+	originalErr := goerrors.New("internal") //nolint:err113 // reason: Create golang error for testing.
+	err := errors.NewFromError(errors.CauseCanceled, errors.NewFromError(errors.CauseInternal, originalErr))
+	assert.ErrorIs(t, err, originalErr)
+
+	var causeErr *errors.Error[uint]
+	assert.ErrorAs(t, err, &causeErr)
+	assert.Equal(t, errors.CauseCanceled, causeErr.Cause)
+
+	assert.NoError(t, errors.New(errors.CauseInternal, "internal").Unwrap())
+}
+
 func TestErrors_NewFromError_GoError(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,318 @@
+package datkey
+
+import (
+	"io"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// SlotState of a slot while its keys are moved between nodes.
+//
+// A migration marks the slots as migrating on the source node and importing on the target node, streams the keys
+// with ExportSlots and ImportSlots, then gives the slots to the target with SetSlotsOwner on every node and deletes
+// them from the source.
+type SlotState string
+
+const (
+	// SlotStable serves every command, if the node owns the slot.
+	SlotStable SlotState = "stable"
+	// SlotMigrating is moving its keys to another node. Commands on keys that are still on the node are served, as
+	// by Redis, and commands on keys that are not are redirected to the target node with an ASK redirect.
+	SlotMigrating SlotState = "migrating"
+	// SlotImporting is receiving keys from another node. Commands asked by the source, after an ASK redirect, are
+	// served, and other commands are redirected to the source node until the import is complete.
+	SlotImporting SlotState = "importing"
+)
+
+type commandSetSlotState struct {
+	Resp  empty
+	State SlotState
+	Node  string
+}
+
+type commandSlotState struct {
+	Resp *SlotStateResponse
+}
+
+type commandDeleteSlot struct {
+	Resp *deleteSlotResponse
+}
+
+type deleteSlotResponse struct {
+	Deleted int64
+}
+
+type SlotStateResponse struct {
+	State SlotState
+	// Node the slot is migrating to or importing from. Empty if the slot is stable.
+	Node string
+	// Owner of the slot, if it is owned by another node. Empty if the slot is owned by this node.
+	Owner string
+}
+
+type DeleteSlotsResponse struct {
+	Deleted int64
+}
+
+// slotMigration state of a slot and the node that owns it.
+type slotMigration struct {
+	state SlotState
+	node  string
+	// owner of the slot, if another node. Empty if this node owns the slot.
+	owner string
+}
+
+type commandAccess int
+
+const (
+	// commandAccessInternal commands are run by the database itself and are never redirected.
+	commandAccessInternal commandAccess = iota
+	commandAccessRead
+	commandAccessWrite
+)
+
+func commandAccessOf(command command) commandAccess {
+	switch command.(type) {
+	case commandGet, commandTtl, commandType,
+		commandGetBit, commandBitCount, commandBitPos,
+		commandPFCount,
+		commandZScore, commandZCard, commandZRangeByScore, commandZScores, commandGeoSearch,
+		commandJSONGet, commandJSONType,
+		commandBFExists, commandCFExists:
+		return commandAccessRead
+	case commandSet, commandDelete, commandExpire, commandPersist,
+		commandSetBit, commandBitField,
+		commandPFAdd, commandPFMerge,
+		commandZAdd, commandZRem,
+		commandJSONSet, commandJSONDel, commandJSONArrAppend, commandJSONNumIncrBy,
+		commandBFReserve, commandBFAdd,
+		commandCFReserve, commandCFAdd, commandCFDel:
+		return commandAccessWrite
+	default:
+		return commandAccessInternal
+	}
+}
+
+// keyOf a command, which decides whether a migrating slot still serves it.
+func keyOf(command command) string {
+	switch cmd := command.(type) {
+	case commandGet:
+		return cmd.Key
+	case commandTtl:
+		return cmd.Key
+	case commandType:
+		return cmd.Key
+	case commandGetBit:
+		return cmd.Key
+	case commandBitCount:
+		return cmd.Key
+	case commandBitPos:
+		return cmd.Key
+	case commandPFCount:
+		return cmd.Key
+	case commandZScore:
+		return cmd.Key
+	case commandZCard:
+		return cmd.Key
+	case commandZRangeByScore:
+		return cmd.Key
+	case commandZScores:
+		return cmd.Key
+	case commandGeoSearch:
+		return cmd.Key
+	case commandJSONGet:
+		return cmd.Key
+	case commandJSONType:
+		return cmd.Key
+	case commandBFExists:
+		return cmd.Key
+	case commandCFExists:
+		return cmd.Key
+	case commandSet:
+		return cmd.Key
+	case commandDelete:
+		return cmd.Key
+	case commandExpire:
+		return cmd.Key
+	case commandPersist:
+		return cmd.Key
+	case commandSetBit:
+		return cmd.Key
+	case commandBitField:
+		return cmd.Key
+	case commandPFAdd:
+		return cmd.Key
+	case commandPFMerge:
+		return cmd.Key
+	case commandZAdd:
+		return cmd.Key
+	case commandZRem:
+		return cmd.Key
+	case commandJSONSet:
+		return cmd.Key
+	case commandJSONDel:
+		return cmd.Key
+	case commandJSONArrAppend:
+		return cmd.Key
+	case commandJSONNumIncrBy:
+		return cmd.Key
+	case commandBFReserve:
+		return cmd.Key
+	case commandBFAdd:
+		return cmd.Key
+	case commandCFReserve:
+		return cmd.Key
+	case commandCFAdd:
+		return cmd.Key
+	case commandCFDel:
+		return cmd.Key
+	default:
+		return ""
+	}
+}
+
+// redirect a command that the slot does not serve in its current state. Returns nil if the command should be run.
+// A migrating slot serves the keys that have not moved yet, reads and writes alike, so that a key is only ever
+// written on one node and a client reads its own writes. An importing slot only serves commands asked by the source,
+// after an ASK redirect.
+func (self *slotStorage) redirect(command command, asking bool) *Redirect {
+	if commandAccessOf(command) == commandAccessInternal {
+		return nil
+	}
+
+	switch self.migration.state {
+	case SlotImporting:
+		if asking {
+			return nil
+		}
+		return &Redirect{
+			Node: self.migration.node,
+			Slot: 0,
+			Ask:  false,
+		}
+	case SlotMigrating:
+		if _, exists := self.lookupKey(keyOf(command)); exists {
+			return nil
+		}
+		return &Redirect{
+			Node: self.migration.node,
+			Slot: 0,
+			Ask:  true,
+		}
+	case SlotStable:
+	}
+
+	if self.migration.owner != "" {
+		return &Redirect{
+			Node: self.migration.owner,
+			Slot: 0,
+			Ask:  false,
+		}
+	}
+	return nil
+}
+
+// ExportSlots writes the keys in a range of slots to the writer.
+// Keys are written with their remaining ttl rather than their deadline, so the export does not depend on the clocks of the two nodes agreeing.
+func (self *Datkey) ExportSlots(slots hash.Range, writer io.Writer) *errors.Error[DbReadErr] {
+	return writeSnapshot(writer, snapshotFormatExport, slots, self.cache)
+}
+
+// ImportSlots reads keys written by ExportSlots. Imported keys replace any existing keys, except in importing slots
+// where an existing key was written after the migration began and is kept.
+func (self *Datkey) ImportSlots(reader io.Reader) *errors.Error[DbWriteErr] {
+	return readSnapshot(reader, snapshotFormatExport, self.cache)
+}
+
+// SetSlotsMigrating to the target node. Commands on keys that are still on this node are served, and commands on keys
+// that are not are redirected to the target with an ASK redirect until the slots are stable.
+func (self *Datkey) SetSlotsMigrating(slots hash.Range, target string) {
+	setSlotsState(slots, SlotMigrating, target, self.cache)
+}
+
+// SetSlotsImporting from the source node. Commands on the slots are redirected to the source until the slots are
+// stable, unless they are asked with an Asking context.
+func (self *Datkey) SetSlotsImporting(slots hash.Range, source string) {
+	setSlotsState(slots, SlotImporting, source, self.cache)
+}
+
+// SetSlotsStable so that every command is served, if this node owns the slots.
+func (self *Datkey) SetSlotsStable(slots hash.Range) {
+	setSlotsState(slots, SlotStable, "", self.cache)
+}
+
+// SlotState of a slot. Slots from the slot count up store no keys, and are stable with no owner.
+func (self *Datkey) SlotState(slot hash.Slot) SlotStateResponse {
+	resp := &SlotStateResponse{
+		State: SlotStable,
+		Node:  "",
+		Owner: "",
+	}
+	if slot >= self.cache.slotCount() {
+		return *resp
+	}
+
+	self.cache.runCommand(slot, commandSlotState{
+		Resp: resp,
+	})
+
+	return *resp
+}
+
+// DeleteSlots deletes every key in a range of slots, such as once the slots have been migrated to another node.
+func (self *Datkey) DeleteSlots(slots hash.Range) DeleteSlotsResponse {
+	return DeleteSlotsResponse{
+		Deleted: deleteSlots(slots, self.cache),
+	}
+}
+
+func deleteSlots(slots hash.Range, cache cacheStorage) int64 {
+	var deleted int64
+	for hashSlot := slots.Begin; hashSlot <= slots.End && hashSlot < cache.slotCount(); hashSlot++ {
+		resp := &deleteSlotResponse{
+			Deleted: 0,
+		}
+
+		cache.runCommand(hashSlot, commandDeleteSlot{
+			Resp: resp,
+		})
+
+		deleted += resp.Deleted
+	}
+	return deleted
+}
+
+func setSlotsState(slots hash.Range, state SlotState, node string, cache cacheStorage) {
+	for hashSlot := slots.Begin; hashSlot <= slots.End && hashSlot < cache.slotCount(); hashSlot++ {
+		cache.runCommand(hashSlot, commandSetSlotState{
+			Resp:  empty{},
+			State: state,
+			Node:  node,
+		})
+	}
+}
+
+func (self *slotStorage) handleCommandSetSlotState(cmd commandSetSlotState) {
+	self.migration.state = cmd.State
+	self.migration.node = cmd.Node
+}
+
+func (self *slotStorage) handleCommandSlotState(cmd commandSlotState) {
+	cmd.Resp.State = self.migration.state
+	cmd.Resp.Node = self.migration.node
+	cmd.Resp.Owner = self.migration.owner
+}
+
+func (self *slotStorage) handleCommandDeleteSlot(cmd commandDeleteSlot) {
+	for key, data := range self.storage {
+		if data.isExpired() {
+			// Expired keys no longer exist, so their deletion is neither logged nor notified.
+			self.sizeInBytes -= data.sizeInBytes()
+			delete(self.storage, key)
+			continue
+		}
+		cmd.Resp.Deleted++
+		self.removeKey(key, data.sizeInBytes())
+	}
+}
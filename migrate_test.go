@@ -0,0 +1,250 @@
+package datkey_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+)
+
+func TestDatkey_ExportSlots_ImportSlots(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	source := datkey.New(config)
+	defer source.Close()
+	target := datkey.New(config)
+	defer target.Close()
+
+	_, err := source.Set(ctx, "{a}string", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = source.Set(ctx, "{a}ttl", []byte("value"), time.Hour)
+	require.Nil(t, err)
+	_, zaddErr := source.ZAdd(ctx, "{a}zset", datkey.ZMember{Member: "a", Score: 1})
+	require.Nil(t, zaddErr)
+	_, err = source.Set(ctx, "{b}other", []byte("value"), 0)
+	require.Nil(t, err)
+
+	slot := hash.ToSlot("{a}")
+	require.NotEqual(t, slot, hash.ToSlot("{b}"))
+	slots := hash.Range{Begin: slot, End: slot}
+
+	var export bytes.Buffer
+	require.Nil(t, source.ExportSlots(slots, &export))
+
+	// A snapshot cannot be read as an export.
+	require.NotNil(t, target.Restore(bytes.NewReader(export.Bytes())))
+
+	require.Nil(t, target.ImportSlots(bytes.NewReader(export.Bytes())))
+
+	{
+		result, err := target.Get(ctx, "{a}string")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("value"), result.Value)
+	}
+
+	{
+		result, err := target.Ttl(ctx, "{a}ttl")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Greater(t, result.Ttl, 59*time.Minute)
+	}
+
+	{
+		result, err := target.ZScore(ctx, "{a}zset", "a")
+		require.Nil(t, err)
+		assert.InDelta(t, 1, result.Score, 0)
+	}
+
+	// Only the exported slots are imported.
+	assert.False(t, typeOf(t, target, "{b}other").Exists)
+
+	{
+		result := source.DeleteSlots(slots)
+		assert.Equal(t, int64(3), result.Deleted)
+		assert.False(t, typeOf(t, source, "{a}string").Exists)
+		assert.True(t, typeOf(t, source, "{b}other").Exists)
+	}
+}
+
+func TestDatkey_SetSlotsMigrating(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+
+	slot := hash.ToSlot("key")
+	slots := hash.Range{Begin: slot, End: slot}
+	client.SetSlotsMigrating(slots, "target:6379")
+	assert.Equal(t, datkey.SlotStateResponse{State: datkey.SlotMigrating, Node: "target:6379", Owner: ""}, client.SlotState(slot))
+
+	{
+		// Reads are served until the keys are deleted.
+		result, err := client.Get(ctx, "key")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("value"), result.Value)
+	}
+
+	{
+		// Writes to keys that are still on the node are served, so that they are read back.
+		_, err := client.Set(ctx, "key", []byte("other"), 0)
+		require.Nil(t, err)
+		result, getErr := client.Get(ctx, "key")
+		require.Nil(t, getErr)
+		assert.Equal(t, []byte("other"), result.Value)
+	}
+
+	{
+		// Commands on keys that are not on the node are asked of the target.
+		_, err := client.ZAdd(ctx, "{key}missing", datkey.ZMember{Member: "a", Score: 1})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteRedirect, err.Cause)
+		assert.Contains(t, err.Error(), "target:6379")
+
+		_, getErr := client.Get(ctx, "{key}missing")
+		require.NotNil(t, getErr)
+		assert.Equal(t, datkey.DbReadRedirect, getErr.Cause)
+	}
+
+	{
+		// Commands across keys are redirected if any of the keys is.
+		_, err := client.BitOp(ctx, datkey.BitOpOr, "{key}missing", "key")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteRedirect, err.Cause)
+	}
+
+	client.SetSlotsStable(slots)
+	assert.Equal(t, datkey.SlotStateResponse{State: datkey.SlotStable, Node: "", Owner: ""}, client.SlotState(slot))
+
+	{
+		_, err := client.Set(ctx, "key", []byte("other"), 0)
+		require.Nil(t, err)
+	}
+}
+
+func TestDatkey_SetSlotsImporting(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	source := datkey.New(config)
+	defer source.Close()
+	target := datkey.New(config)
+	defer target.Close()
+
+	_, err := source.Set(ctx, "key", []byte("old"), 0)
+	require.Nil(t, err)
+
+	slot := hash.ToSlot("key")
+	slots := hash.Range{Begin: slot, End: slot}
+	source.SetSlotsMigrating(slots, "target:6379")
+	target.SetSlotsImporting(slots, "source:6379")
+
+	{
+		_, err := target.Get(ctx, "key")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadRedirect, err.Cause)
+		assert.Contains(t, err.Error(), "source:6379")
+	}
+
+	{
+		// Only commands asked by the source are served while importing.
+		_, err := target.Set(ctx, "key", []byte("new"), 0)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteRedirect, err.Cause)
+		assert.Contains(t, err.Error(), "source:6379")
+
+		_, err = target.Set(datkey.Asking(ctx), "key", []byte("new"), 0)
+		require.Nil(t, err)
+	}
+
+	var export bytes.Buffer
+	require.Nil(t, source.ExportSlots(slots, &export))
+	require.Nil(t, target.ImportSlots(bytes.NewReader(export.Bytes())))
+
+	target.SetSlotsStable(slots)
+	source.DeleteSlots(slots)
+
+	{
+		// The key written during the migration is newer than the imported key.
+		result, err := target.Get(ctx, "key")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("new"), result.Value)
+	}
+}
+
+func TestDatkey_SetSlotsMigrating_delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	source := datkey.New(config)
+	defer source.Close()
+	target := datkey.New(config)
+	defer target.Close()
+
+	_, err := source.Set(ctx, "{a}deleted", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = source.Set(ctx, "{a}kept", []byte("value"), 0)
+	require.Nil(t, err)
+
+	slot := hash.ToSlot("{a}")
+	slots := hash.Range{Begin: slot, End: slot}
+	target.SetSlotsImporting(slots, "source:6379")
+	source.SetSlotsMigrating(slots, "target:6379")
+
+	// A key deleted before it is copied is deleted on the source, so the copy does not bring it back.
+	result, err := source.Delete(ctx, "{a}deleted")
+	require.Nil(t, err)
+	assert.True(t, result.Exists)
+	_, err = source.Delete(ctx, "{a}deleted")
+	require.NotNil(t, err)
+	assert.Equal(t, datkey.DbWriteRedirect, err.Cause)
+
+	var export bytes.Buffer
+	require.Nil(t, source.ExportSlots(slots, &export))
+	require.Nil(t, target.ImportSlots(bytes.NewReader(export.Bytes())))
+	target.SetSlotsStable(slots)
+
+	assert.False(t, typeOf(t, target, "{a}deleted").Exists)
+	assert.True(t, typeOf(t, target, "{a}kept").Exists)
+}
+
+func TestDatkey_DeleteSlots_expired(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.ExpirationFrequency = time.Hour
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.Set(ctx, "{a}expired", []byte("value"), time.Millisecond)
+	require.Nil(t, err)
+	_, err = client.Set(ctx, "{a}live", []byte("value"), 0)
+	require.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	watcher := client.WatchKeyspace(10, datkey.KeyspaceEventDel)
+	defer watcher.Close()
+
+	// Keys that have expired are not deleted again.
+	slot := hash.ToSlot("{a}")
+	result := client.DeleteSlots(hash.Range{Begin: slot, End: slot})
+	assert.Equal(t, int64(1), result.Deleted)
+	assert.Equal(t, datkey.KeyspaceEvent{Key: "{a}live", Type: datkey.KeyspaceEventDel}, <-watcher.Events())
+	assert.Empty(t, watcher.Events())
+	assert.Zero(t, client.Stats(ctx).DbSizeInBytes)
+}
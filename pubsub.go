@@ -0,0 +1,366 @@
+package datkey
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wspowell/datkey/internal/glob"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// PubSubOverflow policy for messages published to a subscription whose buffer is full.
+type PubSubOverflow string
+
+const (
+	// PubSubDrop drops messages that do not fit in the buffer of a subscription, so that a slow subscriber never
+	// delays publishers. Dropped messages are counted by Subscription.Dropped.
+	PubSubDrop = PubSubOverflow("drop")
+	// PubSubBlock blocks publishers until every subscription has room for the message, the subscription is closed or
+	// the publish times out.
+	PubSubBlock = PubSubOverflow("block")
+)
+
+const pubSubDefaultBufferSize = 1024
+
+// Message published to a channel.
+type Message struct {
+	Channel string
+	// Pattern the channel matched, for messages received by PSubscribe. Empty for channels subscribed to by name.
+	Pattern string
+	// Payload of the message, which is shared between subscribers and must not be modified.
+	Payload []byte
+}
+
+type PublishResponse struct {
+	// Receivers of the message, counting a subscription once for each of its channels and patterns that matched.
+	Receivers int64
+}
+
+// Publish a message to every subscription of the channel, and of any pattern the channel matches.
+// Messages are only received by subscriptions that exist when they are published, they are not stored.
+func (self *Datkey) Publish(ctx context.Context, channel string, message []byte) (PublishResponse, *errors.Error[DbWriteErr]) {
+	if err := writeCanceled(ctx); err != nil {
+		return PublishResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, self.config.CommandTimeout)
+	defer cancel()
+
+	receivers, err := self.pubSub.publish(ctx, channel, message, self.pubSub.overflow)
+	if err != nil {
+		return PublishResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return PublishResponse{
+		Receivers: receivers,
+	}, nil
+}
+
+// Subscribe to messages published to the channels. More channels and patterns can be subscribed to with the methods of
+// the subscription, which must be closed once it is no longer read from.
+func (self *Datkey) Subscribe(channels ...string) *Subscription {
+	subscription := self.pubSub.subscription()
+	subscription.Subscribe(channels...)
+	return subscription
+}
+
+// PSubscribe to messages published to the channels that match the glob patterns, such as "news.*".
+// The subscription must be closed once it is no longer read from.
+func (self *Datkey) PSubscribe(patterns ...string) *Subscription {
+	subscription := self.pubSub.subscription()
+	subscription.PSubscribe(patterns...)
+	return subscription
+}
+
+// PubSubChannels subscribed to by name that match the glob pattern, in order. An empty pattern matches every channel.
+func (self *Datkey) PubSubChannels(pattern string) []string {
+	self.pubSub.mutex.RLock()
+	defer self.pubSub.mutex.RUnlock()
+
+	var channels []string
+	for channel := range self.pubSub.channels {
+		if pattern == "" || glob.Match(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// PubSubNumSub of each channel, which is the number of subscriptions to the channel by name.
+func (self *Datkey) PubSubNumSub(channels ...string) map[string]int64 {
+	self.pubSub.mutex.RLock()
+	defer self.pubSub.mutex.RUnlock()
+
+	subscribers := make(map[string]int64, len(channels))
+	for _, channel := range channels {
+		subscribers[channel] = int64(len(self.pubSub.channels[channel]))
+	}
+	return subscribers
+}
+
+// PubSubNumPat of the patterns subscribed to, by any subscription.
+func (self *Datkey) PubSubNumPat() int64 {
+	self.pubSub.mutex.RLock()
+	defer self.pubSub.mutex.RUnlock()
+
+	return int64(len(self.pubSub.patterns))
+}
+
+// Subscription to channels and patterns, which receives the messages published to them. Safe for concurrent use.
+type Subscription struct {
+	messages chan Message
+	pubSub   *pubSub
+	// channels and patterns subscribed to, guarded by the mutex of the pubSub.
+	channels map[string]empty
+	patterns map[string]empty
+	dropped  atomic.Int64
+	// done is closed first when the subscription is closed, to release blocked publishers.
+	done chan empty
+	// sending guards the messages channel, which publishers send to while holding it for reading.
+	sending sync.RWMutex
+	closed  bool
+	close   sync.Once
+}
+
+// Messages received by the subscription, in the order they were published to each channel. The channel is closed when
+// the subscription is closed.
+func (self *Subscription) Messages() <-chan Message {
+	return self.messages
+}
+
+// Subscribe to more channels. Channels already subscribed to, or subscribing after the subscription is closed, are
+// ignored.
+func (self *Subscription) Subscribe(channels ...string) {
+	self.pubSub.mutex.Lock()
+	defer self.pubSub.mutex.Unlock()
+
+	if self.isClosed() {
+		return
+	}
+	for _, channel := range channels {
+		self.channels[channel] = empty{}
+		subscribe(self.pubSub.channels, channel, self)
+	}
+}
+
+// PSubscribe to more glob patterns. Patterns already subscribed to, or subscribing after the subscription is closed, are
+// ignored.
+func (self *Subscription) PSubscribe(patterns ...string) {
+	self.pubSub.mutex.Lock()
+	defer self.pubSub.mutex.Unlock()
+
+	if self.isClosed() {
+		return
+	}
+	for _, pattern := range patterns {
+		self.patterns[pattern] = empty{}
+		subscribe(self.pubSub.patterns, pattern, self)
+	}
+}
+
+// Unsubscribe from the channels, or from every channel if none are given. Returns the channels unsubscribed from, in
+// order, which are only those that were subscribed to.
+func (self *Subscription) Unsubscribe(channels ...string) []string {
+	self.pubSub.mutex.Lock()
+	defer self.pubSub.mutex.Unlock()
+
+	return self.unsubscribe(self.channels, self.pubSub.channels, channels)
+}
+
+// PUnsubscribe from the patterns, or from every pattern if none are given. Returns the patterns unsubscribed from, in
+// order, which are only those that were subscribed to.
+func (self *Subscription) PUnsubscribe(patterns ...string) []string {
+	self.pubSub.mutex.Lock()
+	defer self.pubSub.mutex.Unlock()
+
+	return self.unsubscribe(self.patterns, self.pubSub.patterns, patterns)
+}
+
+// Count of the channels and patterns subscribed to.
+func (self *Subscription) Count() int {
+	self.pubSub.mutex.RLock()
+	defer self.pubSub.mutex.RUnlock()
+
+	return len(self.channels) + len(self.patterns)
+}
+
+// Dropped count of messages that did not fit in the buffer, with the PubSubDrop policy.
+func (self *Subscription) Dropped() int64 {
+	return self.dropped.Load()
+}
+
+// Close the subscription, unsubscribing from every channel and pattern. Safe to call more than once.
+func (self *Subscription) Close() {
+	self.close.Do(func() {
+		close(self.done)
+
+		self.pubSub.mutex.Lock()
+		self.unsubscribe(self.channels, self.pubSub.channels, nil)
+		self.unsubscribe(self.patterns, self.pubSub.patterns, nil)
+		self.pubSub.mutex.Unlock()
+
+		self.sending.Lock()
+		self.closed = true
+		close(self.messages)
+		self.sending.Unlock()
+	})
+}
+
+// isClosed once Close has started, after which nothing more is subscribed to.
+func (self *Subscription) isClosed() bool {
+	select {
+	case <-self.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// unsubscribe from the names, or from every name subscribed to if none are given. Must hold the mutex of the pubSub.
+func (self *Subscription) unsubscribe(subscribed map[string]empty, subscriptions map[string]map[*Subscription]empty, names []string) []string {
+	if len(names) == 0 {
+		names = make([]string, 0, len(subscribed))
+		for name := range subscribed {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+	}
+
+	var unsubscribed []string
+	for _, name := range names {
+		if _, exists := subscribed[name]; !exists {
+			continue
+		}
+		delete(subscribed, name)
+		delete(subscriptions[name], self)
+		if len(subscriptions[name]) == 0 {
+			delete(subscriptions, name)
+		}
+		unsubscribed = append(unsubscribed, name)
+	}
+	return unsubscribed
+}
+
+// send the message to the subscription, following the overflow policy once the buffer is full.
+// Returns false if the message was not received.
+func (self *Subscription) send(ctx context.Context, message Message, overflow PubSubOverflow) (bool, *errors.Error[DbWriteErr]) {
+	self.sending.RLock()
+	defer self.sending.RUnlock()
+
+	if self.closed {
+		return false, nil
+	}
+
+	select {
+	case self.messages <- message:
+		return true, nil
+	default:
+	}
+
+	if overflow == PubSubDrop {
+		self.dropped.Add(1)
+		return false, nil
+	}
+
+	select {
+	case self.messages <- message:
+		return true, nil
+	case <-self.done:
+		return false, nil
+	case <-ctx.Done():
+		return false, writeCanceled(ctx)
+	}
+}
+
+func subscribe(subscriptions map[string]map[*Subscription]empty, name string, subscription *Subscription) {
+	if subscriptions[name] == nil {
+		subscriptions[name] = map[*Subscription]empty{}
+	}
+	subscriptions[name][subscription] = empty{}
+}
+
+// pubSub of the subscriptions to each channel and pattern.
+type pubSub struct {
+	bufferSize int
+	overflow   PubSubOverflow
+	mutex      sync.RWMutex
+	channels   map[string]map[*Subscription]empty
+	patterns   map[string]map[*Subscription]empty
+}
+
+func newPubSub(config Config) *pubSub {
+	return &pubSub{
+		bufferSize: config.PubSubBufferSize,
+		overflow:   config.PubSubOverflow,
+		mutex:      sync.RWMutex{},
+		channels:   map[string]map[*Subscription]empty{},
+		patterns:   map[string]map[*Subscription]empty{},
+	}
+}
+
+func (self *pubSub) subscription() *Subscription {
+	return &Subscription{
+		messages: make(chan Message, self.bufferSize),
+		pubSub:   self,
+		channels: map[string]empty{},
+		patterns: map[string]empty{},
+		dropped:  atomic.Int64{},
+		done:     make(chan empty),
+		sending:  sync.RWMutex{},
+		closed:   false,
+		close:    sync.Once{},
+	}
+}
+
+// delivery of a message to a subscription.
+type delivery struct {
+	subscription *Subscription
+	message      Message
+}
+
+// publish the message to the subscriptions of the channel, following the overflow policy for full subscriptions.
+// The subscriptions are collected first, so that a publisher blocked on a full subscription does not block subscribing.
+func (self *pubSub) publish(ctx context.Context, channel string, payload []byte, overflow PubSubOverflow) (int64, *errors.Error[DbWriteErr]) {
+	var deliveries []delivery
+	self.mutex.RLock()
+	for subscription := range self.channels[channel] {
+		deliveries = append(deliveries, delivery{
+			subscription: subscription,
+			message: Message{
+				Channel: channel,
+				Pattern: "",
+				Payload: payload,
+			},
+		})
+	}
+	for pattern, subscriptions := range self.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for subscription := range subscriptions {
+			deliveries = append(deliveries, delivery{
+				subscription: subscription,
+				message: Message{
+					Channel: channel,
+					Pattern: pattern,
+					Payload: payload,
+				},
+			})
+		}
+	}
+	self.mutex.RUnlock()
+
+	var receivers int64
+	for _, delivery := range deliveries {
+		received, err := delivery.subscription.send(ctx, delivery.message, overflow)
+		if err != nil {
+			return receivers, err
+		}
+		if received {
+			receivers++
+		}
+	}
+	return receivers, nil
+}
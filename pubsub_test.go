@@ -0,0 +1,154 @@
+package datkey_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_Publish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	// Messages published before subscribing are not received.
+	result, err := client.Publish(ctx, "news", []byte("before"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), result.Receivers)
+
+	news := client.Subscribe("news", "sport")
+	defer news.Close()
+	patterns := client.PSubscribe("news.*", "n*")
+	defer patterns.Close()
+	assert.Equal(t, 2, news.Count())
+
+	result, err = client.Publish(ctx, "news", []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), result.Receivers)
+	assert.Equal(t, datkey.Message{Channel: "news", Pattern: "", Payload: []byte("hello")}, <-news.Messages())
+	assert.Equal(t, datkey.Message{Channel: "news", Pattern: "n*", Payload: []byte("hello")}, <-patterns.Messages())
+
+	// A subscription receives a message once for every pattern that matches.
+	result, err = client.Publish(ctx, "news.tech", []byte("hi"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), result.Receivers)
+	received := []datkey.Message{<-patterns.Messages(), <-patterns.Messages()}
+	assert.ElementsMatch(t, []datkey.Message{
+		{Channel: "news.tech", Pattern: "news.*", Payload: []byte("hi")},
+		{Channel: "news.tech", Pattern: "n*", Payload: []byte("hi")},
+	}, received)
+	assert.Empty(t, news.Messages())
+
+	assert.Equal(t, []string{"news", "sport"}, client.PubSubChannels(""))
+	assert.Equal(t, []string{"sport"}, client.PubSubChannels("s*"))
+	assert.Equal(t, map[string]int64{"news": 1, "missing": 0}, client.PubSubNumSub("news", "missing"))
+	assert.Equal(t, int64(2), client.PubSubNumPat())
+
+	assert.Equal(t, []string{"news"}, news.Unsubscribe("news", "missing"))
+	assert.Equal(t, []string{"n*", "news.*"}, patterns.PUnsubscribe())
+	result, err = client.Publish(ctx, "news", []byte("hello"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), result.Receivers)
+
+	news.Subscribe("news")
+	news.Close()
+	news.Close()
+	news.Subscribe("news")
+	assert.Empty(t, client.PubSubChannels(""))
+	_, open := <-news.Messages()
+	assert.False(t, open)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.Publish(canceled, "news", []byte("hello"))
+	require.NotNil(t, err)
+	assert.Equal(t, datkey.DbWriteCanceled, err.Cause)
+}
+
+func TestDatkey_Publish_drop(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.PubSubBufferSize = 2
+	client := datkey.New(config)
+	defer client.Close()
+
+	subscription := client.Subscribe("channel")
+	defer subscription.Close()
+
+	// Messages that do not fit in the buffer are dropped rather than blocking the publisher.
+	for range 5 {
+		_, err := client.Publish(ctx, "channel", []byte("message"))
+		require.Nil(t, err)
+	}
+	assert.Len(t, subscription.Messages(), 2)
+	assert.Equal(t, int64(3), subscription.Dropped())
+}
+
+func TestDatkey_Publish_block(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.PubSubBufferSize = 1
+	config.PubSubOverflow = datkey.PubSubBlock
+	config.CommandTimeout = 100 * time.Millisecond
+	client := datkey.New(config)
+	defer client.Close()
+
+	subscription := client.Subscribe("channel")
+	defer subscription.Close()
+
+	result, err := client.Publish(ctx, "channel", []byte("first"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), result.Receivers)
+
+	// The publisher blocks until the subscriber reads from the full buffer.
+	published := make(chan datkey.PublishResponse)
+	go func() {
+		result, err := client.Publish(ctx, "channel", []byte("second"))
+		assert.Nil(t, err)
+		published <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-published:
+		t.Fatal("published to a full subscription")
+	default:
+	}
+	assert.Equal(t, []byte("first"), (<-subscription.Messages()).Payload)
+	assert.Equal(t, int64(1), (<-published).Receivers)
+	assert.Equal(t, []byte("second"), (<-subscription.Messages()).Payload)
+
+	// Publishing times out if the subscriber never reads.
+	_, err = client.Publish(ctx, "channel", []byte("third"))
+	require.Nil(t, err)
+	_, err = client.Publish(ctx, "channel", []byte("fourth"))
+	require.NotNil(t, err)
+	assert.Equal(t, datkey.DbWriteCanceled, err.Cause)
+	assert.Equal(t, int64(0), subscription.Dropped())
+
+	// Closing the subscription releases a blocked publisher.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		subscription.Close()
+	}()
+	result, err = client.Publish(ctx, "channel", []byte("fifth"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), result.Receivers)
+
+	var invalid datkey.Config
+	invalid.PubSubOverflow = "invalid"
+	assert.Panics(t, func() {
+		datkey.New(invalid)
+	})
+}
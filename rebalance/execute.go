@@ -0,0 +1,144 @@
+package rebalance
+
+import (
+	"context"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Cluster whose slots an Executor migrates, by the address of each node. Every method may be run again after it
+// fails or is interrupted, which is how an executor resumes a plan.
+type Cluster interface {
+	// SetSlotsImporting on the node from the source node, as datkey.SetSlotsImporting.
+	SetSlotsImporting(ctx context.Context, node string, slots hash.Range, source string) error
+	// SetSlotsMigrating on the node to the target node, as datkey.SetSlotsMigrating.
+	SetSlotsMigrating(ctx context.Context, node string, slots hash.Range, target string) error
+	// CopySlots from the source node to the target node, as datkey.ExportSlots on the source and datkey.ImportSlots on
+	// the target.
+	CopySlots(ctx context.Context, slots hash.Range, source string, target string) error
+	// SetSlotsOwner on every node of the cluster, as datkey.SetSlotsOwner.
+	SetSlotsOwner(ctx context.Context, slots hash.Range, owner string) error
+	// DeleteSlots on the node, as datkey.DeleteSlots.
+	DeleteSlots(ctx context.Context, node string, slots hash.Range) error
+}
+
+// Phase of a step. The phases of a step run in order, and each phase moves the slots further from the source to the
+// target.
+type Phase int
+
+const (
+	// PhaseImporting marks the slots as importing on the target.
+	PhaseImporting Phase = iota
+	// PhaseMigrating marks the slots as migrating on the source, which serves the keys it still has and sends commands
+	// on the keys it does not have to the target from then on.
+	PhaseMigrating
+	// PhaseCopying copies the keys of the slots from the source to the target.
+	PhaseCopying
+	// PhaseOwning gives the slots to the target on every node, which completes the migration.
+	PhaseOwning
+	// PhaseDeleting deletes the keys of the slots from the source.
+	PhaseDeleting
+)
+
+func (self Phase) String() string {
+	switch self {
+	case PhaseImporting:
+		return "importing"
+	case PhaseMigrating:
+		return "migrating"
+	case PhaseCopying:
+		return "copying"
+	case PhaseOwning:
+		return "owning"
+	case PhaseDeleting:
+		return "deleting"
+	default:
+		return "unknown"
+	}
+}
+
+// Progress through a plan, which is the phase of the step to run next. The zero value starts at the first step.
+type Progress struct {
+	Step  int
+	Phase Phase
+}
+
+// Done once every step of the plan has run.
+func (self Progress) Done(plan Plan) bool {
+	return self.Step >= len(plan.Steps)
+}
+
+type ExecutorConfig struct {
+	// Cluster to migrate the slots of. Required.
+	Cluster Cluster
+
+	// ProgressHandler is called after every phase with the progress to resume the plan from, such as to store it so
+	// that a rebalance interrupted by a restart can be resumed.
+	// Default: does nothing.
+	ProgressHandler func(progress Progress)
+}
+
+// Executor of rebalance plans, which migrates the slots of one step at a time.
+type Executor struct {
+	config ExecutorConfig
+}
+
+// NewExecutor of plans on a cluster. Panics if the config has no cluster.
+func NewExecutor(config ExecutorConfig) *Executor {
+	if config.Cluster == nil {
+		panic("rebalance requires a cluster")
+	}
+
+	if config.ProgressHandler == nil {
+		config.ProgressHandler = func(Progress) {}
+	}
+
+	return &Executor{
+		config: config,
+	}
+}
+
+// Run the plan from the progress, until every step has run, a phase fails or the context is done. Returns the
+// progress to resume the plan from, which runs again the phase that failed.
+func (self *Executor) Run(ctx context.Context, plan Plan, progress Progress) (Progress, *errors.Error[RebalanceErr]) {
+	for !progress.Done(plan) {
+		if err := ctx.Err(); err != nil {
+			return progress, errors.NewFromError(RebalanceErrCanceled, err)
+		}
+
+		step := plan.Steps[progress.Step]
+		if err := self.runPhase(ctx, step, progress.Phase); err != nil {
+			return progress, errors.New(RebalanceErrMigration, "step %d, %s, failed %s: %v", progress.Step, step, progress.Phase, err)
+		}
+
+		if progress.Phase == PhaseDeleting {
+			progress = Progress{
+				Step:  progress.Step + 1,
+				Phase: PhaseImporting,
+			}
+		} else {
+			progress.Phase++
+		}
+		self.config.ProgressHandler(progress)
+	}
+	return progress, nil
+}
+
+func (self *Executor) runPhase(ctx context.Context, step Step, phase Phase) error {
+	cluster := self.config.Cluster
+	switch phase {
+	case PhaseImporting:
+		return cluster.SetSlotsImporting(ctx, step.Target, step.Slots, step.Source)
+	case PhaseMigrating:
+		return cluster.SetSlotsMigrating(ctx, step.Source, step.Slots, step.Target)
+	case PhaseCopying:
+		return cluster.CopySlots(ctx, step.Slots, step.Source, step.Target)
+	case PhaseOwning:
+		return cluster.SetSlotsOwner(ctx, step.Slots, step.Target)
+	case PhaseDeleting:
+		return cluster.DeleteSlots(ctx, step.Source, step.Slots)
+	default:
+		return errors.New(RebalanceErrInternal, "unknown phase %d", phase)
+	}
+}
@@ -0,0 +1,202 @@
+package rebalance_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+	"github.com/wspowell/datkey/rebalance"
+)
+
+var _ rebalance.Cluster = rebalance.Local{}
+
+// newCluster of databases, where the first database owns every slot and stores the keys.
+func newCluster(t *testing.T, keys int, addresses ...string) rebalance.Local {
+	t.Helper()
+
+	cluster := rebalance.Local{}
+	for _, address := range addresses {
+		var config datkey.Config
+		db := datkey.New(config)
+		t.Cleanup(db.Close)
+		cluster[address] = db
+	}
+	require.NoError(t, cluster.SetSlotsOwner(context.Background(), hash.Range{Begin: 0, End: hash.MaxHashSlot - 1}, addresses[0]))
+
+	for index := range keys {
+		_, err := cluster[addresses[0]].Set(context.Background(), fmt.Sprintf("key-%d", index), []byte("value"), 0)
+		require.Nil(t, err)
+	}
+	return cluster
+}
+
+// get a key from the node that owns its slot, following a MOVED redirect.
+func get(t *testing.T, cluster rebalance.Local, address string, key string) datkey.GetResponse {
+	t.Helper()
+
+	result, err := cluster[address].Get(context.Background(), key)
+	if err != nil {
+		var redirect *datkey.Redirect
+		require.ErrorAs(t, err, &redirect)
+		require.False(t, redirect.Ask)
+		result, err = cluster[redirect.Node].Get(context.Background(), key)
+	}
+	require.Nil(t, err)
+	return result
+}
+
+// planCluster from the slots owned by each node and the keys they store.
+func planCluster(t *testing.T, cluster rebalance.Local) rebalance.Plan {
+	t.Helper()
+
+	owners := map[string][]hash.Range{}
+	var stats [][]datkey.SlotStats
+	for address, db := range cluster {
+		for _, owner := range db.SlotOwners() {
+			if owner.Node == "" {
+				owners[address] = append(owners[address], owner.Slots)
+				stats = append(stats, db.SlotStats(owner.Slots))
+			}
+		}
+	}
+
+	var nodes []rebalance.Node
+	for address := range cluster {
+		nodes = append(nodes, node(address, owners[address]...))
+	}
+	plan, err := rebalance.NewPlan(nodes, rebalance.LoadsOf(stats...), defaultPlanConfig)
+	require.Nil(t, err)
+	return plan
+}
+
+func TestExecutor_Run(t *testing.T) {
+	t.Parallel()
+
+	const keys = 1000
+	cluster := newCluster(t, keys, "a:6379", "b:6379", "c:6379")
+	plan := planCluster(t, cluster)
+	require.NotEmpty(t, plan.Steps)
+
+	var progresses []rebalance.Progress
+	executor := rebalance.NewExecutor(rebalance.ExecutorConfig{
+		Cluster: cluster,
+		ProgressHandler: func(progress rebalance.Progress) {
+			progresses = append(progresses, progress)
+		},
+	})
+	progress, err := executor.Run(context.Background(), plan, rebalance.Progress{Step: 0, Phase: rebalance.PhaseImporting})
+	require.Nil(t, err)
+	assert.True(t, progress.Done(plan))
+	assert.Len(t, progresses, 5*len(plan.Steps))
+	assert.Equal(t, rebalance.Progress{Step: 0, Phase: rebalance.PhaseMigrating}, progresses[0])
+	assert.Equal(t, rebalance.Progress{Step: 1, Phase: rebalance.PhaseImporting}, progresses[4])
+
+	// Every key is served by the node it moved to, and is no longer stored on the node it moved from.
+	for index := range keys {
+		result := get(t, cluster, "a:6379", fmt.Sprintf("key-%d", index))
+		assert.True(t, result.Exists)
+	}
+	var stored int64
+	for address, db := range cluster {
+		var nodeKeys int64
+		for _, slotStats := range db.SlotStats(hash.Range{Begin: 0, End: hash.MaxHashSlot - 1}) {
+			assert.Empty(t, db.SlotState(slotStats.Slot).Owner, "%s stores keys of slot %d it does not own", address, slotStats.Slot)
+			nodeKeys += slotStats.Keys
+		}
+		assert.InDelta(t, keys/3, nodeKeys, keys/3*0.2, address)
+		stored += nodeKeys
+	}
+	assert.Equal(t, int64(keys), stored)
+
+	// The balanced cluster needs no more steps.
+	assert.Empty(t, planCluster(t, cluster).Steps)
+}
+
+// failingCluster fails to copy slots the first time, as if the connection to a node was lost.
+type failingCluster struct {
+	rebalance.Local
+	failCopy bool
+}
+
+func (self *failingCluster) CopySlots(ctx context.Context, slots hash.Range, source string, target string) error {
+	if self.failCopy {
+		self.failCopy = false
+		return errors.New(rebalance.RebalanceErrInternal, "connection lost")
+	}
+	return self.Local.CopySlots(ctx, slots, source, target)
+}
+
+func TestExecutor_Run_resume(t *testing.T) {
+	t.Parallel()
+
+	cluster := newCluster(t, 100, "a:6379", "b:6379")
+	plan := planCluster(t, cluster)
+	require.Len(t, plan.Steps, 1)
+	step := plan.Steps[0]
+
+	failing := &failingCluster{
+		Local:    cluster,
+		failCopy: true,
+	}
+	executor := rebalance.NewExecutor(rebalance.ExecutorConfig{
+		Cluster:         failing,
+		ProgressHandler: nil,
+	})
+	progress, err := executor.Run(context.Background(), plan, rebalance.Progress{Step: 0, Phase: rebalance.PhaseImporting})
+	require.NotNil(t, err)
+	assert.Equal(t, rebalance.RebalanceErrMigration, err.Cause)
+	assert.Contains(t, err.Error(), "connection lost")
+	assert.Equal(t, rebalance.Progress{Step: 0, Phase: rebalance.PhaseCopying}, progress)
+	assert.False(t, progress.Done(plan))
+	assert.Equal(t, datkey.SlotMigrating, cluster["a:6379"].SlotState(step.Slots.Begin).State)
+
+	progress, err = executor.Run(context.Background(), plan, progress)
+	require.Nil(t, err)
+	assert.True(t, progress.Done(plan))
+	assert.Equal(t, datkey.SlotStateResponse{State: datkey.SlotStable, Node: "", Owner: "b:6379"}, cluster["a:6379"].SlotState(step.Slots.Begin))
+	assert.Empty(t, cluster["a:6379"].SlotStats(step.Slots))
+	assert.NotEmpty(t, cluster["b:6379"].SlotStats(step.Slots))
+
+	// Running a completed plan does nothing.
+	progress, err = executor.Run(context.Background(), plan, progress)
+	require.Nil(t, err)
+	assert.True(t, progress.Done(plan))
+}
+
+func TestExecutor_Run_canceled(t *testing.T) {
+	t.Parallel()
+
+	cluster := newCluster(t, 0, "a:6379", "b:6379")
+	plan := planCluster(t, cluster)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	executor := rebalance.NewExecutor(rebalance.ExecutorConfig{
+		Cluster:         cluster,
+		ProgressHandler: nil,
+	})
+	progress, err := executor.Run(ctx, plan, rebalance.Progress{Step: 0, Phase: rebalance.PhaseImporting})
+	require.NotNil(t, err)
+	assert.Equal(t, rebalance.RebalanceErrCanceled, err.Cause)
+	assert.Equal(t, rebalance.Progress{Step: 0, Phase: rebalance.PhaseImporting}, progress)
+
+	// A step with an unknown node fails.
+	plan = rebalance.Plan{Steps: []rebalance.Step{{Slots: hash.Range{Begin: 0, End: 0}, Source: "a:6379", Target: "missing:6379"}}}
+	_, err = executor.Run(context.Background(), plan, rebalance.Progress{Step: 0, Phase: rebalance.PhaseImporting})
+	require.NotNil(t, err)
+	assert.Equal(t, rebalance.RebalanceErrMigration, err.Cause)
+}
+
+func TestPhase_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "copying", rebalance.PhaseCopying.String())
+	assert.Equal(t, "unknown", rebalance.Phase(10).String())
+}
@@ -0,0 +1,85 @@
+package rebalance
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Local cluster of databases in this process, by the address of each node, such as to rebalance the databases of a
+// test or of a process that shards its keys between databases.
+type Local map[string]*datkey.Datkey
+
+func (self Local) node(address string) (*datkey.Datkey, *errors.Error[RebalanceErr]) {
+	db, exists := self[address]
+	if !exists {
+		return nil, errors.New(RebalanceErrInvalidNodes, "no node at %s", address)
+	}
+	return db, nil
+}
+
+func (self Local) SetSlotsImporting(_ context.Context, node string, slots hash.Range, source string) error {
+	db, err := self.node(node)
+	if err != nil {
+		return err
+	}
+	db.SetSlotsImporting(slots, source)
+	return nil
+}
+
+func (self Local) SetSlotsMigrating(_ context.Context, node string, slots hash.Range, target string) error {
+	db, err := self.node(node)
+	if err != nil {
+		return err
+	}
+	db.SetSlotsMigrating(slots, target)
+	return nil
+}
+
+func (self Local) CopySlots(_ context.Context, slots hash.Range, source string, target string) error {
+	sourceDb, err := self.node(source)
+	if err != nil {
+		return err
+	}
+	targetDb, err := self.node(target)
+	if err != nil {
+		return err
+	}
+
+	var keys bytes.Buffer
+	if err := sourceDb.ExportSlots(slots, &keys); err != nil {
+		return err
+	}
+	if err := targetDb.ImportSlots(&keys); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetSlotsOwner on every node, which the owner itself records as owning the slots.
+func (self Local) SetSlotsOwner(_ context.Context, slots hash.Range, owner string) error {
+	if _, err := self.node(owner); err != nil {
+		return err
+	}
+
+	for address, db := range self {
+		if address == owner {
+			db.SetSlotsOwner(slots, "")
+		} else {
+			db.SetSlotsOwner(slots, owner)
+		}
+	}
+	return nil
+}
+
+func (self Local) DeleteSlots(_ context.Context, node string, slots hash.Range) error {
+	db, err := self.node(node)
+	if err != nil {
+		return err
+	}
+	db.DeleteSlots(slots)
+	return nil
+}
@@ -0,0 +1,219 @@
+// Package rebalance moves slots between the nodes of a cluster so that every node stores about the same load.
+//
+// NewPlan computes the slots to move from the load of each slot, and an Executor moves them one step at a time with
+// the slot migration of each node, recording its progress so that an interrupted rebalance can be resumed.
+package rebalance
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type RebalanceErr errors.Cause
+
+const (
+	RebalanceErrInternal = RebalanceErr(iota + 1)
+	// RebalanceErrInvalidNodes is returned when the nodes of a cluster are not unique or own the same slots.
+	RebalanceErrInvalidNodes
+	// RebalanceErrCanceled is returned when the context of a rebalance is done before the plan completes.
+	RebalanceErrCanceled
+	// RebalanceErrMigration is returned when a step of a plan fails.
+	RebalanceErrMigration
+)
+
+const defaultTolerance = 0.05
+
+// Node of a cluster and the slots it owns.
+type Node struct {
+	// Address of the node, such as "10.0.0.2:6379", which is the owner given to the slots moved to it.
+	Address string
+	Slots   hash.RangeSet
+}
+
+// Load of a slot.
+type Load struct {
+	Keys  int64
+	Bytes int64
+}
+
+// Loads of slots. Slots that are missing store no keys.
+type Loads map[hash.Slot]Load
+
+// LoadsOf the slots in the stats of each node, such as from datkey.SlotStats.
+func LoadsOf(stats ...[]datkey.SlotStats) Loads {
+	loads := Loads{}
+	for _, nodeStats := range stats {
+		for _, slotStats := range nodeStats {
+			load := loads[slotStats.Slot]
+			load.Keys += slotStats.Keys
+			load.Bytes += slotStats.SizeInBytes
+			loads[slotStats.Slot] = load
+		}
+	}
+	return loads
+}
+
+type PlanConfig struct {
+	// Tolerance of the weight of each node, as a fraction of the mean weight of the nodes, within which the nodes are
+	// balanced and no slots are moved.
+	// Default: 0.05
+	Tolerance float64
+
+	// Weight of a slot, which is spread evenly between the nodes. Weights below one are counted as one.
+	// Default: the bytes of the slot plus one, so that slots without keys are also spread evenly.
+	Weight func(load Load) int64
+}
+
+// Step of a plan, which moves a range of slots from the source node to the target node.
+type Step struct {
+	Slots  hash.Range
+	Source string
+	Target string
+}
+
+func (self Step) String() string {
+	return fmt.Sprintf("slots %s from %s to %s", hash.NewRangeSet(self.Slots), self.Source, self.Target)
+}
+
+// Plan of the steps that balance a cluster, in order of their slots.
+type Plan struct {
+	Steps []Step
+}
+
+// plannedNode while slots are moved to and from it.
+type plannedNode struct {
+	address string
+	weight  int64
+	// slots owned in the order they were gained, so that slots are given away from the end of the original ranges.
+	slots []hash.Slot
+}
+
+// NewPlan that balances the weight of the nodes within the tolerance, moving as little weight as it can. Slots move
+// from the heaviest node to the lightest node, taking the highest slots first so that the moved slots form few
+// ranges, until the nodes are balanced or the heaviest node has no slot that would leave it lighter than the lightest
+// node. Slots that no node owns are not moved.
+func NewPlan(nodes []Node, loads Loads, config PlanConfig) (Plan, *errors.Error[RebalanceErr]) {
+	if config.Tolerance == 0 {
+		config.Tolerance = defaultTolerance
+	}
+
+	if config.Weight == nil {
+		config.Weight = func(load Load) int64 {
+			return load.Bytes + 1
+		}
+	}
+
+	planned := make([]*plannedNode, 0, len(nodes))
+	owners := map[hash.Slot]string{}
+	weights := map[hash.Slot]int64{}
+	var total int64
+	for _, node := range nodes {
+		if slices.ContainsFunc(planned, func(other *plannedNode) bool { return other.address == node.Address }) {
+			return Plan{}, errors.New(RebalanceErrInvalidNodes, "node %s is listed more than once", node.Address) //nolint:exhaustruct // reason: zero value on error
+		}
+
+		plannedNode := &plannedNode{
+			address: node.Address,
+			weight:  0,
+			slots:   make([]hash.Slot, 0, node.Slots.Len()),
+		}
+		for slot := range node.Slots.All() {
+			if owner, exists := owners[slot]; exists {
+				return Plan{}, errors.New(RebalanceErrInvalidNodes, "slot %d is owned by %s and %s", slot, owner, node.Address) //nolint:exhaustruct // reason: zero value on error
+			}
+			owners[slot] = node.Address
+			weights[slot] = max(config.Weight(loads[slot]), 1)
+			plannedNode.slots = append(plannedNode.slots, slot)
+			plannedNode.weight += weights[slot]
+		}
+		total += plannedNode.weight
+		planned = append(planned, plannedNode)
+	}
+	if len(planned) < 2 {
+		return Plan{Steps: nil}, nil
+	}
+
+	mean := float64(total) / float64(len(planned))
+	lower := mean * (1 - config.Tolerance)
+	upper := mean * (1 + config.Tolerance)
+
+	targets := map[hash.Slot]string{}
+	for {
+		slices.SortFunc(planned, func(left *plannedNode, right *plannedNode) int {
+			if left.weight != right.weight {
+				return cmp.Compare(left.weight, right.weight)
+			}
+			return cmp.Compare(left.address, right.address)
+		})
+		lightest := planned[0]
+		heaviest := planned[len(planned)-1]
+		if float64(heaviest.weight) <= upper && float64(lightest.weight) >= lower {
+			break
+		}
+
+		// Slots lighter than the difference between the nodes bring them closer together, which ends the loop since
+		// the spread of the weights shrinks with every move. The first such slot is always moved, and later slots only
+		// while neither node passes the mean, so that the two nodes trade a single range rather than alternate slots
+		// with the other nodes.
+		limit := min(float64(heaviest.weight)-mean, mean-float64(lightest.weight))
+		var moved int64
+		for index := len(heaviest.slots) - 1; index >= 0; index-- {
+			slot := heaviest.slots[index]
+			weight := weights[slot]
+			if weight >= heaviest.weight-lightest.weight {
+				continue
+			}
+			if moved != 0 && float64(moved+weight) > limit {
+				break
+			}
+
+			heaviest.slots = slices.Delete(heaviest.slots, index, index+1)
+			heaviest.weight -= weight
+			lightest.slots = append(lightest.slots, slot)
+			lightest.weight += weight
+			targets[slot] = lightest.address
+			moved += weight
+		}
+		if moved == 0 {
+			break
+		}
+	}
+
+	return Plan{
+		Steps: planSteps(owners, targets),
+	}, nil
+}
+
+// planSteps that move each slot from its owner to its target, with adjacent slots between the same nodes in one step.
+func planSteps(owners map[hash.Slot]string, targets map[hash.Slot]string) []Step {
+	// Only owned slots can move, in order so that adjacent slots are found.
+	slots := slices.Sorted(maps.Keys(owners))
+
+	var steps []Step
+	for _, slot := range slots {
+		target, moved := targets[slot]
+		if !moved || target == owners[slot] {
+			continue
+		}
+
+		if len(steps) != 0 {
+			last := &steps[len(steps)-1]
+			if last.Slots.End == slot-1 && last.Source == owners[slot] && last.Target == target {
+				last.Slots.End = slot
+				continue
+			}
+		}
+		steps = append(steps, Step{
+			Slots:  hash.Range{Begin: slot, End: slot},
+			Source: owners[slot],
+			Target: target,
+		})
+	}
+	return steps
+}
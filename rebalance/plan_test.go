@@ -0,0 +1,213 @@
+package rebalance_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+	"github.com/wspowell/datkey/rebalance"
+)
+
+// slotCount of the plans, as partitioned by Redis Cluster.
+const slotCount = int(hash.MaxHashSlot)
+
+var defaultPlanConfig = rebalance.PlanConfig{
+	Tolerance: 0,
+	Weight:    nil,
+}
+
+func node(address string, slots ...hash.Range) rebalance.Node {
+	return rebalance.Node{
+		Address: address,
+		Slots:   hash.NewRangeSet(slots...),
+	}
+}
+
+// applyPlan to the slots of the nodes, requiring every step to move slots from the node that owns them.
+func applyPlan(t *testing.T, nodes []rebalance.Node, plan rebalance.Plan) map[string]hash.RangeSet {
+	t.Helper()
+
+	owned := map[string]hash.RangeSet{}
+	for _, node := range nodes {
+		owned[node.Address] = node.Slots
+	}
+	moved := hash.NewRangeSet()
+	for _, step := range plan.Steps {
+		slots := hash.NewRangeSet(step.Slots)
+		require.True(t, slots.Intersect(moved).IsEmpty(), "%s moves slots already moved", step)
+		require.True(t, slots.Subtract(owned[step.Source]).IsEmpty(), "%s moves slots the source does not own", step)
+		require.NotEqual(t, step.Source, step.Target)
+
+		owned[step.Source] = owned[step.Source].Subtract(slots)
+		owned[step.Target] = owned[step.Target].Union(slots)
+		moved = moved.Union(slots)
+	}
+	return owned
+}
+
+func weightOf(slots hash.RangeSet, loads rebalance.Loads) int64 {
+	var weight int64
+	for slot := range slots.All() {
+		weight += loads[slot].Bytes + 1
+	}
+	return weight
+}
+
+func TestNewPlan_newNodes(t *testing.T) {
+	t.Parallel()
+
+	nodes := []rebalance.Node{
+		node("a:6379", hash.AllSlots(slotCount).Ranges()...),
+		node("b:6379"),
+		node("c:6379"),
+	}
+	plan, err := rebalance.NewPlan(nodes, rebalance.Loads{}, defaultPlanConfig)
+	require.Nil(t, err)
+
+	// The new nodes take the highest slots of the existing node, in one range each.
+	require.Len(t, plan.Steps, 2)
+	assert.Equal(t, "a:6379", plan.Steps[0].Source)
+	assert.Equal(t, "a:6379", plan.Steps[1].Source)
+	assert.Equal(t, hash.MaxHashSlot-1, plan.Steps[1].Slots.End)
+	assert.Equal(t, plan.Steps[0].Slots.End+1, plan.Steps[1].Slots.Begin)
+
+	owned := applyPlan(t, nodes, plan)
+	for address, slots := range owned {
+		assert.InDelta(t, slotCount/3, slots.Len(), float64(slotCount)/3*0.05, address)
+	}
+
+	// Only the slots the nodes own are planned, however few there are.
+	nodes = []rebalance.Node{
+		node("a:6379", hash.AllSlots(8).Ranges()...),
+		node("b:6379"),
+	}
+	plan, err = rebalance.NewPlan(nodes, rebalance.Loads{}, defaultPlanConfig)
+	require.Nil(t, err)
+	assert.Equal(t, []rebalance.Step{{Slots: hash.Range{Begin: 4, End: 7}, Source: "a:6379", Target: "b:6379"}}, plan.Steps)
+}
+
+func TestNewPlan_balanced(t *testing.T) {
+	t.Parallel()
+
+	split := hash.SplitEvenly(slotCount, 3)
+	nodes := []rebalance.Node{
+		node("a:6379", split[0].Ranges()...),
+		node("b:6379", split[1].Ranges()...),
+		node("c:6379", split[2].Ranges()...),
+	}
+
+	plan, err := rebalance.NewPlan(nodes, rebalance.Loads{}, defaultPlanConfig)
+	require.Nil(t, err)
+	assert.Empty(t, plan.Steps)
+
+	// Load within the tolerance moves nothing.
+	plan, err = rebalance.NewPlan(nodes, rebalance.Loads{0: {Keys: 1, Bytes: 100}}, defaultPlanConfig)
+	require.Nil(t, err)
+	assert.Empty(t, plan.Steps)
+
+	// A single node has nothing to balance with.
+	plan, err = rebalance.NewPlan(nodes[:1], rebalance.Loads{}, defaultPlanConfig)
+	require.Nil(t, err)
+	assert.Empty(t, plan.Steps)
+}
+
+func TestNewPlan_load(t *testing.T) {
+	t.Parallel()
+
+	split := hash.SplitEvenly(slotCount, 2)
+	nodes := []rebalance.Node{
+		node("a:6379", split[0].Ranges()...),
+		node("b:6379", split[1].Ranges()...),
+	}
+
+	// Two slots of a hold most of the load, so b takes over other slots of a.
+	loads := rebalance.LoadsOf(
+		[]datkey.SlotStats{{Slot: 0, Keys: 1, SizeInBytes: 4000}},
+		[]datkey.SlotStats{{Slot: 0, Keys: 1, SizeInBytes: 4000}, {Slot: 99, Keys: 2, SizeInBytes: 8000}},
+	)
+	assert.Equal(t, rebalance.Loads{0: {Keys: 2, Bytes: 8000}, 99: {Keys: 2, Bytes: 8000}}, loads)
+
+	plan, err := rebalance.NewPlan(nodes, loads, defaultPlanConfig)
+	require.Nil(t, err)
+	owned := applyPlan(t, nodes, plan)
+	assert.InEpsilon(t, weightOf(owned["a:6379"], loads), weightOf(owned["b:6379"], loads), 0.1)
+
+	require.Len(t, plan.Steps, 1)
+	assert.Equal(t, "a:6379", plan.Steps[0].Source)
+
+	// A slot heavier than the rest of the cluster cannot be balanced, and stays where it is.
+	loads = rebalance.Loads{0: {Keys: 1, Bytes: 1_000_000}}
+	plan, err = rebalance.NewPlan(nodes, loads, defaultPlanConfig)
+	require.Nil(t, err)
+	owned = applyPlan(t, nodes, plan)
+	assert.True(t, owned["a:6379"].Contains(0))
+	assert.Equal(t, 1, owned["a:6379"].Len())
+}
+
+func TestNewPlan_random(t *testing.T) {
+	t.Parallel()
+
+	random := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // reason: deterministic test data
+	for range 20 {
+		count := 2 + random.IntN(5)
+		var nodes []rebalance.Node
+		for index, slots := range hash.AllSlots(slotCount).Split(count + random.IntN(3)) {
+			// Nodes past the count are new and own no slots, and their slots are added to the first node.
+			if index >= count {
+				nodes[0].Slots = nodes[0].Slots.Union(slots)
+				nodes = append(nodes, node(string(rune('a'+index))))
+				continue
+			}
+			nodes = append(nodes, rebalance.Node{Address: string(rune('a' + index)), Slots: slots})
+		}
+
+		loads := rebalance.Loads{}
+		for range random.IntN(2000) {
+			slot := hash.Slot(random.IntN(slotCount))
+			load := loads[slot]
+			load.Keys++
+			load.Bytes += int64(random.IntN(100))
+			loads[slot] = load
+		}
+
+		plan, err := rebalance.NewPlan(nodes, loads, defaultPlanConfig)
+		require.Nil(t, err)
+		owned := applyPlan(t, nodes, plan)
+
+		var total int64
+		for _, slots := range owned {
+			total += weightOf(slots, loads)
+		}
+		mean := float64(total) / float64(len(nodes))
+		for address, slots := range owned {
+			assert.InDelta(t, mean, weightOf(slots, loads), mean*0.05+1, "node %s of %d", address, len(nodes))
+		}
+	}
+}
+
+func TestNewPlan_invalidNodes(t *testing.T) {
+	t.Parallel()
+
+	for _, nodes := range [][]rebalance.Node{
+		{node("a:6379", hash.Range{Begin: 0, End: 10}), node("a:6379", hash.Range{Begin: 11, End: 20})},
+		{node("a:6379", hash.Range{Begin: 0, End: 10}), node("b:6379", hash.Range{Begin: 10, End: 20})},
+	} {
+		_, err := rebalance.NewPlan(nodes, rebalance.Loads{}, defaultPlanConfig)
+		require.NotNil(t, err)
+		assert.Equal(t, rebalance.RebalanceErrInvalidNodes, err.Cause)
+
+		var rebalanceErr *errors.Error[rebalance.RebalanceErr]
+		assert.ErrorAs(t, err, &rebalanceErr)
+	}
+}
+
+func TestStep_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "slots 0-99 from a:6379 to b:6379", rebalance.Step{Slots: hash.Range{Begin: 0, End: 99}, Source: "a:6379", Target: "b:6379"}.String())
+}
@@ -0,0 +1,667 @@
+package datkey
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Replication streams the records of the append only file from a primary to its replicas:
+//
+//	request:    "DKREPL" | version (uint16) | replication ID (bytes) | offset (varint)
+//	reply:      replySync | replication ID (bytes) | offset (varint) | snapshot
+//	            replyContinue | replication ID (bytes) | offset (varint)
+//	stream:     records and heartbeats, framed as records of the append only file
+//	heartbeat:  offset of the primary (varint)
+//	ack:        offset of the replica (varint), written by the replica for each heartbeat
+//
+// Offsets count the bytes of records in the stream since the replication ID was created, so a replica that
+// reconnects with the ID and offset it has applied continues from the backlog of the primary if the backlog still
+// holds the records after the offset. Otherwise the primary sends a snapshot and the records from the offset the
+// snapshot was started at. Records are idempotent, so records already in the snapshot may be applied again.
+//
+// Since records hold absolute deadlines, keys expire on replicas at the same time as on the primary only as far as
+// the clocks of the hosts agree.
+
+type ReplicationErr errors.Cause
+
+const (
+	ReplicationInternal = ReplicationErr(iota)
+	ReplicationCanceled
+	// ReplicationConnection failed while reading or writing the stream.
+	ReplicationConnection
+	// ReplicationInvalidStream was read, such as a stream that is not a replication stream or a corrupt record.
+	ReplicationInvalidStream
+	// ReplicationBehind is returned to a replica that fell behind the backlog and must sync again.
+	ReplicationBehind
+)
+
+// ReplicationRole of a database.
+type ReplicationRole string
+
+const (
+	ReplicationRolePrimary ReplicationRole = "primary"
+	ReplicationRoleReplica ReplicationRole = "replica"
+)
+
+const (
+	replicationVersion = 1
+
+	replicationReplySync     = 0x01
+	replicationReplyContinue = 0x02
+
+	// replicationHeartbeat frame type, which follows the record types of the append only file.
+	replicationHeartbeat = 0x10
+
+	replicationDefaultBacklogBytes = 1024 * 1024
+	// replicationChunkBytes of the backlog written to a replica at a time.
+	replicationChunkBytes = 64 * 1024
+	replicationIDBytes    = 20
+)
+
+//nolint:gochecknoglobals // reason: constant header
+var replicationMagic = []byte("DKREPL")
+
+// ReplicationDialer connects to the replication stream of a primary, such as a connection on which the PSYNC command
+// of the server package has been sent. The connection is closed once the replica stops reading from it.
+type ReplicationDialer func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// ReplicationStats of a database.
+type ReplicationStats struct {
+	Role ReplicationRole
+	// ID of the replication stream, shared by a primary and the replicas that have synced from it.
+	ID string
+	// Offset of the stream that has been written by a primary or applied by a replica.
+	Offset int64
+	// Connected replica to its primary. Always false on a primary.
+	Connected bool
+	// Lag of a replica, the time since it last applied every record the primary had written. Zero on a primary.
+	Lag time.Duration
+	// Replicas connected to a primary.
+	Replicas []ReplicaStats
+}
+
+// ReplicaStats of a replica connected to a primary.
+type ReplicaStats struct {
+	// Offset the replica has acknowledged applying.
+	Offset int64
+	// LagBytes of records written by the primary that the replica has not acknowledged.
+	LagBytes int64
+}
+
+// ServeReplica the replication stream over the connection, until the context is done, the connection fails or the
+// replica falls too far behind. The connection should be closed once ServeReplica returns.
+func (self *Datkey) ServeReplica(ctx context.Context, conn io.ReadWriter) *errors.Error[ReplicationErr] {
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	id, offset, err := readReplicationRequest(reader)
+	if err != nil {
+		return err
+	}
+
+	backlog := self.replication.backlog
+	backlog.activate()
+
+	if backlog.holds(id, offset) {
+		if _, err := writer.Write(appendReplicationPosition([]byte{replicationReplyContinue}, id, offset)); err != nil {
+			return errors.NewFromError(ReplicationConnection, err)
+		}
+	} else {
+		// Records written while the snapshot is taken are sent after it, from the offset the snapshot started at.
+		id, offset = backlog.position()
+		if _, err := writer.Write(appendReplicationPosition([]byte{replicationReplySync}, id, offset)); err != nil {
+			return errors.NewFromError(ReplicationConnection, err)
+		}
+		if err := writeSnapshot(writer, snapshotFormatFull, self.cache.allSlots(), self.cache); err != nil {
+			return errors.NewFromError(ReplicationConnection, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return errors.NewFromError(ReplicationConnection, err)
+	}
+
+	replica := self.replication.addReplica(offset)
+	defer self.replication.removeReplica(replica)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			ack, err := binary.ReadVarint(reader)
+			if err != nil {
+				return
+			}
+			replica.Store(ack)
+		}
+	}()
+
+	return self.streamBacklog(ctx, writer, id, offset)
+}
+
+// streamBacklog to a replica from the offset, with a heartbeat at every heartbeat interval.
+func (self *Datkey) streamBacklog(ctx context.Context, writer *bufio.Writer, id string, offset int64) *errors.Error[ReplicationErr] {
+	backlog := self.replication.backlog
+
+	heartbeat := time.NewTicker(self.config.ReplicationHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		records, written, holds := backlog.read(id, offset)
+		if !holds {
+			return errors.New(ReplicationBehind, "replica at offset %d is behind the backlog", offset)
+		}
+		if _, err := writer.Write(records); err != nil {
+			return errors.NewFromError(ReplicationConnection, err)
+		}
+		offset += int64(len(records))
+
+		select {
+		case <-heartbeat.C:
+			if err := writeReplicationHeartbeat(writer, offset); err != nil {
+				return err
+			}
+		default:
+		}
+
+		if len(records) == replicationChunkBytes {
+			// More records may follow, which are written before flushing.
+			continue
+		}
+		if err := writer.Flush(); err != nil {
+			return errors.NewFromError(ReplicationConnection, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.NewFromError(ReplicationCanceled, ctx.Err())
+		case <-written:
+		case <-heartbeat.C:
+			if err := writeReplicationHeartbeat(writer, offset); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeReplicationHeartbeat(writer *bufio.Writer, offset int64) *errors.Error[ReplicationErr] {
+	if _, err := writer.Write(encodeAppendOnlyRecord(replicationHeartbeat, binary.AppendVarint(nil, offset))); err != nil {
+		return errors.NewFromError(ReplicationConnection, err)
+	}
+	return nil
+}
+
+// ReplicaOf a primary, replacing every key with the keys of the primary and applying its writes in the background,
+// reconnecting with dial whenever the connection fails. Unless Config.ReplicaWritable is set, writes fail with the
+// ReadOnly cause while replicating.
+//
+// A nil dial stops replicating, keeping the keys. The database becomes a primary that continues the stream of its
+// former primary, so that the other replicas of the former primary can continue from it.
+func (self *Datkey) ReplicaOf(dial ReplicationDialer) {
+	self.replication.stop()
+	if dial == nil {
+		return
+	}
+	self.replication.start(dial, self.cache)
+}
+
+// replication state of a database, as a primary and as a replica.
+type replication struct {
+	backlog *replicationBacklog
+	config  Config
+
+	// replicas connected to the primary, with the offset each has acknowledged.
+	replicas map[*atomic.Int64]struct{}
+
+	// cancel replicating from the primary. Nil if the database is a primary.
+	cancel context.CancelFunc
+	// done once replicating from the primary has stopped.
+	done      <-chan struct{}
+	connected atomic.Bool
+	// syncedAt is the time, in unix nanoseconds, the replica last applied every record the primary had written.
+	syncedAt atomic.Int64
+	mutex    sync.Mutex
+}
+
+func newReplication(config Config) *replication {
+	return &replication{
+		backlog:   newReplicationBacklog(config.ReplicationBacklogBytes),
+		config:    config,
+		replicas:  map[*atomic.Int64]struct{}{},
+		cancel:    nil,
+		done:      nil,
+		connected: atomic.Bool{},
+		syncedAt:  atomic.Int64{},
+		mutex:     sync.Mutex{},
+	}
+}
+
+func (self *replication) isReplica() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.cancel != nil
+}
+
+func (self *replication) readOnly() bool {
+	return !self.config.ReplicaWritable && self.backlog.following.Load()
+}
+
+func (self *replication) addReplica(offset int64) *atomic.Int64 {
+	replica := &atomic.Int64{}
+	replica.Store(offset)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.replicas[replica] = struct{}{}
+	return replica
+}
+
+func (self *replication) removeReplica(replica *atomic.Int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.replicas, replica)
+}
+
+func (self *replication) stats() ReplicationStats {
+	id, offset := self.backlog.position()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	stats := ReplicationStats{
+		Role:      ReplicationRolePrimary,
+		ID:        id,
+		Offset:    offset,
+		Connected: false,
+		Lag:       0,
+		Replicas:  nil,
+	}
+
+	if self.cancel != nil {
+		stats.Role = ReplicationRoleReplica
+		stats.Connected = self.connected.Load()
+		if syncedAt := self.syncedAt.Load(); syncedAt != 0 {
+			stats.Lag = time.Since(time.Unix(0, syncedAt))
+		}
+	}
+
+	for replica := range self.replicas {
+		replicaOffset := replica.Load()
+		stats.Replicas = append(stats.Replicas, ReplicaStats{
+			Offset:   replicaOffset,
+			LagBytes: max(offset-replicaOffset, 0),
+		})
+	}
+
+	return stats
+}
+
+// start replicating from a primary in the background.
+func (self *replication) start(dial ReplicationDialer, cache cacheStorage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	self.mutex.Lock()
+	self.cancel = cancel
+	self.done = done
+	self.mutex.Unlock()
+
+	self.backlog.activate()
+	self.backlog.following.Store(true)
+	self.syncedAt.Store(0)
+
+	go func() {
+		defer close(done)
+
+		for {
+			err := self.replicate(ctx, dial, cache)
+			self.connected.Store(false)
+			if ctx.Err() != nil {
+				return
+			}
+			self.config.ReplicationErrorHandler(err)
+
+			retry := time.NewTimer(self.config.ReplicationHeartbeatInterval)
+			select {
+			case <-ctx.Done():
+				retry.Stop()
+				return
+			case <-retry.C:
+			}
+		}
+	}()
+}
+
+// stop replicating from the primary, if replicating, once the record being applied is complete.
+func (self *replication) stop() {
+	self.mutex.Lock()
+	cancel, done := self.cancel, self.done
+	self.cancel = nil
+	self.done = nil
+	self.mutex.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	self.backlog.following.Store(false)
+}
+
+// replicate from a primary until the context is done or the connection fails.
+func (self *replication) replicate(ctx context.Context, dial ReplicationDialer, cache cacheStorage) *errors.Error[ReplicationErr] {
+	conn, err := dial(ctx)
+	if err != nil {
+		return errors.NewFromError(ReplicationConnection, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	id, offset := self.backlog.position()
+	request := binary.BigEndian.AppendUint16(bytes.Clone(replicationMagic), replicationVersion)
+	if _, err := writer.Write(appendReplicationPosition(request, id, offset)); err != nil {
+		return errors.NewFromError(ReplicationConnection, err)
+	}
+	if err := writer.Flush(); err != nil {
+		return errors.NewFromError(ReplicationConnection, err)
+	}
+
+	if err := self.readReplicationReply(reader, cache); err != nil {
+		return err
+	}
+
+	self.connected.Store(true)
+	self.syncedAt.Store(time.Now().UnixNano())
+
+	for {
+		frameType, payload, length, err := readAppendOnlyFrame(reader)
+		if err != nil {
+			return replicationReadErr(err)
+		}
+
+		if frameType == replicationHeartbeat {
+			// Every record before the heartbeat has been applied.
+			self.syncedAt.Store(time.Now().UnixNano())
+
+			_, offset := self.backlog.position()
+			if _, err := writer.Write(binary.AppendVarint(nil, offset)); err != nil {
+				return errors.NewFromError(ReplicationConnection, err)
+			}
+			if err := writer.Flush(); err != nil {
+				return errors.NewFromError(ReplicationConnection, err)
+			}
+			continue
+		}
+
+		record, decodeErr := decodeAppendOnlyRecord(frameType, payload)
+		if decodeErr != nil {
+			return errors.NewFromError(ReplicationInvalidStream, decodeErr)
+		}
+
+		raw := encodeAppendOnlyRecord(frameType, payload)
+		if len(raw) != length {
+			return errors.New(ReplicationInvalidStream, "record length %d does not match its encoding", length)
+		}
+		cache.runCommand(cache.slotOf(record.key), commandReplayAppendOnly{
+			Resp:   empty{},
+			Record: record,
+			Raw:    raw,
+		})
+	}
+}
+
+// commandReplaceSlot replaces every key of a slot with the keys synced from the primary.
+type commandReplaceSlot struct {
+	Resp    empty
+	Entries []snapshotEntry
+}
+
+func (self *slotStorage) handleCommandReplaceSlot(cmd commandReplaceSlot) {
+	synced := make(map[string]struct{}, len(cmd.Entries))
+	for _, entry := range cmd.Entries {
+		synced[entry.key] = struct{}{}
+	}
+	for key, data := range self.storage {
+		if _, exists := synced[key]; exists {
+			continue
+		}
+		if data.isExpired() {
+			// Expired keys no longer exist, so their deletion is neither logged nor notified.
+			self.sizeInBytes -= data.sizeInBytes()
+			delete(self.storage, key)
+			continue
+		}
+		self.removeKey(key, data.sizeInBytes())
+	}
+
+	self.handleCommandRestoreSlot(commandRestoreSlot{
+		Resp:      empty{},
+		Entries:   cmd.Entries,
+		KeepNewer: false,
+	})
+}
+
+// readReplicationReply of the primary, syncing every key if the replica cannot continue from its offset.
+func (self *replication) readReplicationReply(reader *bufio.Reader, cache cacheStorage) *errors.Error[ReplicationErr] {
+	reply, err := reader.ReadByte()
+	if err != nil {
+		return errors.NewFromError(ReplicationConnection, err)
+	}
+	id, offset, positionErr := readReplicationPosition(reader)
+	if positionErr != nil {
+		return positionErr
+	}
+
+	switch reply {
+	case replicationReplyContinue:
+		if currentID, currentOffset := self.backlog.position(); id != currentID || offset != currentOffset {
+			return errors.New(ReplicationInvalidStream, "primary continued from %s:%d rather than %s:%d", id, offset, currentID, currentOffset)
+		}
+		return nil
+	case replicationReplySync:
+		// Every key is read before any slot is replaced, so that readers are never served an empty database while
+		// syncing, and only the keys that the sync changes are notified.
+		staging := map[hash.Slot][]snapshotEntry{}
+		if err := readSnapshotSections(reader, snapshotFormatFull, cache, staging); err != nil {
+			return errors.NewFromError(ReplicationInvalidStream, err)
+		}
+		for hashSlot := range cache.slotCount() {
+			cache.runCommand(hashSlot, commandReplaceSlot{
+				Resp:    empty{},
+				Entries: staging[hashSlot],
+			})
+		}
+		// Records logged while syncing are not part of the stream of the primary.
+		self.backlog.reset(id, offset)
+		return nil
+	default:
+		return errors.New(ReplicationInvalidStream, "invalid replication reply: %d", reply)
+	}
+}
+
+// replicationReadErr for an error reading a record from the stream.
+func replicationReadErr(err error) *errors.Error[ReplicationErr] {
+	var recordErr *errors.Error[DbWriteErr]
+	if errors.As(err, &recordErr) {
+		return errors.NewFromError(ReplicationInvalidStream, err)
+	}
+	return errors.NewFromError(ReplicationConnection, err)
+}
+
+func readReplicationRequest(reader *bufio.Reader) (string, int64, *errors.Error[ReplicationErr]) {
+	header := make([]byte, len(replicationMagic)+2) //nolint:mnd // reason: size of the version
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", 0, errors.NewFromError(ReplicationConnection, err)
+	}
+	if !bytes.Equal(header[:len(replicationMagic)], replicationMagic) {
+		return "", 0, errors.New(ReplicationInvalidStream, "invalid replication request header")
+	}
+	if version := binary.BigEndian.Uint16(header[len(replicationMagic):]); version != replicationVersion {
+		return "", 0, errors.New(ReplicationInvalidStream, "unsupported replication version: %d", version)
+	}
+	return readReplicationPosition(reader)
+}
+
+func appendReplicationPosition(payload []byte, id string, offset int64) []byte {
+	return binary.AppendVarint(appendSnapshotBytes(payload, []byte(id)), offset)
+}
+
+func readReplicationPosition(reader *bufio.Reader) (string, int64, *errors.Error[ReplicationErr]) {
+	idLength, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", 0, errors.NewFromError(ReplicationConnection, err)
+	}
+	if idLength > uint64(hex.EncodedLen(replicationIDBytes)) {
+		return "", 0, errors.New(ReplicationInvalidStream, "invalid replication ID length: %d", idLength)
+	}
+	id := make([]byte, idLength)
+	if _, err := io.ReadFull(reader, id); err != nil {
+		return "", 0, errors.NewFromError(ReplicationConnection, err)
+	}
+	offset, err := binary.ReadVarint(reader)
+	if err != nil {
+		return "", 0, errors.NewFromError(ReplicationConnection, err)
+	}
+	return string(id), offset, nil
+}
+
+// replicationBacklog of the most recent records, held in a ring buffer so that a replica that reconnects can continue
+// from its offset rather than sync every key again.
+//
+// The backlog is allocated once the first replica connects or the database replicates from a primary, so that
+// records are not encoded until they are needed.
+type replicationBacklog struct {
+	buffer []byte
+	id     string
+	// offset of the end of the stream.
+	offset int64
+	// start offset of the oldest record in the buffer.
+	start int64
+	// written is closed, and replaced, whenever records are appended.
+	written chan struct{}
+	size    int
+	mutex   sync.Mutex
+	// active once records are kept.
+	active atomic.Bool
+	// following a primary, whose records are appended in place of the records of the commands run locally.
+	following atomic.Bool
+}
+
+func newReplicationBacklog(size int) *replicationBacklog {
+	return &replicationBacklog{
+		buffer:    nil,
+		id:        newReplicationID(),
+		offset:    0,
+		start:     0,
+		written:   make(chan struct{}),
+		size:      size,
+		mutex:     sync.Mutex{},
+		active:    atomic.Bool{},
+		following: atomic.Bool{},
+	}
+}
+
+func newReplicationID() string {
+	id := make([]byte, replicationIDBytes)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// recording the records of commands run locally. The backlog is nil while keys are restored on New.
+func (self *replicationBacklog) recording() bool {
+	return self != nil && self.active.Load() && !self.following.Load()
+}
+
+func (self *replicationBacklog) activate() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.buffer == nil {
+		self.buffer = make([]byte, self.size)
+		self.start = self.offset
+		self.active.Store(true)
+	}
+}
+
+func (self *replicationBacklog) position() (string, int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.id, self.offset
+}
+
+// holds the records after the offset of the stream with the ID.
+func (self *replicationBacklog) holds(id string, offset int64) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return id == self.id && offset >= self.start && offset <= self.offset
+}
+
+func (self *replicationBacklog) append(record []byte) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.buffer == nil {
+		return
+	}
+
+	for len(record) != 0 {
+		position := int(self.offset % int64(len(self.buffer)))
+		copied := copy(self.buffer[position:], record)
+		record = record[copied:]
+		self.offset += int64(copied)
+	}
+	self.start = max(self.start, self.offset-int64(len(self.buffer)))
+
+	close(self.written)
+	self.written = make(chan struct{})
+}
+
+// read the records after the offset of the stream with the ID, up to a chunk at a time, and a channel that is closed
+// once more records are appended. Returns false if the backlog no longer holds the offset.
+func (self *replicationBacklog) read(id string, offset int64) ([]byte, <-chan struct{}, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if id != self.id || offset < self.start || offset > self.offset {
+		return nil, nil, false
+	}
+
+	length := min(self.offset-offset, replicationChunkBytes)
+	records := make([]byte, 0, length)
+	for int64(len(records)) < length {
+		position := int((offset + int64(len(records))) % int64(len(self.buffer)))
+		end := min(len(self.buffer), position+int(length)-len(records))
+		records = append(records, self.buffer[position:end]...)
+	}
+	return records, self.written, true
+}
+
+// reset the backlog to continue the stream of a primary from the offset, discarding the records it holds.
+func (self *replicationBacklog) reset(id string, offset int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.id = id
+	self.offset = offset
+	self.start = offset
+
+	close(self.written)
+	self.written = make(chan struct{})
+}
@@ -0,0 +1,282 @@
+package datkey_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+// pipeDialer connects a replica to a primary in the same process, keeping the connections so that tests can break them.
+type pipeDialer struct {
+	primary *datkey.Datkey
+	conns   []net.Conn
+	dials   atomic.Int64
+	// offline fails every dial.
+	offline atomic.Bool
+	mutex   sync.Mutex
+}
+
+func newPipeDialer(primary *datkey.Datkey) *pipeDialer {
+	return &pipeDialer{
+		primary: primary,
+		conns:   nil,
+		dials:   atomic.Int64{},
+		offline: atomic.Bool{},
+		mutex:   sync.Mutex{},
+	}
+}
+
+func (self *pipeDialer) dial(_ context.Context) (io.ReadWriteCloser, error) {
+	self.dials.Add(1)
+	if self.offline.Load() {
+		return nil, net.ErrClosed
+	}
+
+	replicaConn, primaryConn := net.Pipe()
+	go func() {
+		defer primaryConn.Close()
+		_ = self.primary.ServeReplica(context.Background(), primaryConn)
+	}()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.conns = append(self.conns, replicaConn)
+	return replicaConn, nil
+}
+
+// disconnect every connection made so far.
+func (self *pipeDialer) disconnect() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, conn := range self.conns {
+		_ = conn.Close()
+	}
+}
+
+func replicationConfig() datkey.Config {
+	var config datkey.Config
+	config.ReplicationHeartbeatInterval = 10 * time.Millisecond
+	return config
+}
+
+func requireValue(t *testing.T, db *datkey.Datkey, key string, value string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		result, err := db.Get(context.Background(), key)
+		return err == nil && result.Exists && string(result.Value) == value
+	}, 5*time.Second, time.Millisecond, "key %s", key)
+}
+
+func requireMissing(t *testing.T, db *datkey.Datkey, key string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		result, err := db.Get(context.Background(), key)
+		return err == nil && !result.Exists
+	}, 5*time.Second, time.Millisecond, "key %s", key)
+}
+
+func TestDatkey_ReplicaOf(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary := datkey.New(replicationConfig())
+	defer primary.Close()
+	replica := datkey.New(replicationConfig())
+	defer replica.Close()
+
+	_, err := primary.Set(ctx, "before", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = replica.Set(ctx, "replaced", []byte("value"), 0)
+	require.Nil(t, err)
+
+	replica.ReplicaOf(newPipeDialer(primary).dial)
+
+	// The replica syncs every key of the primary, replacing its own.
+	requireValue(t, replica, "before", "value")
+	requireMissing(t, replica, "replaced")
+
+	// Writes to the primary are applied to the replica.
+	_, err = primary.Set(ctx, "after", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = primary.Set(ctx, "ttl", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = primary.Expire(ctx, "ttl", time.Hour)
+	require.Nil(t, err)
+	_, err = primary.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1})
+	require.Nil(t, err)
+	_, err = primary.Delete(ctx, "before")
+	require.Nil(t, err)
+
+	requireValue(t, replica, "after", "value")
+	requireMissing(t, replica, "before")
+	{
+		result, err := replica.Ttl(ctx, "ttl")
+		require.Nil(t, err)
+		assert.Greater(t, result.Ttl, 59*time.Minute)
+	}
+	{
+		result, err := replica.ZScore(ctx, "zset", "a")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+	}
+
+	// Replicas are read only.
+	{
+		_, err := replica.Set(ctx, "key", []byte("value"), 0)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteReadOnly, err.Cause)
+	}
+
+	require.Eventually(t, func() bool {
+		primaryStats := primary.Stats(ctx).Replication
+		replicaStats := replica.Stats(ctx).Replication
+		return len(primaryStats.Replicas) == 1 &&
+			primaryStats.Replicas[0].LagBytes == 0 &&
+			replicaStats.Offset == primaryStats.Offset
+	}, 5*time.Second, time.Millisecond)
+
+	primaryStats := primary.Stats(ctx).Replication
+	assert.Equal(t, datkey.ReplicationRolePrimary, primaryStats.Role)
+	replicaStats := replica.Stats(ctx).Replication
+	assert.Equal(t, datkey.ReplicationRoleReplica, replicaStats.Role)
+	assert.Equal(t, primaryStats.ID, replicaStats.ID)
+	assert.True(t, replicaStats.Connected)
+	assert.Less(t, replicaStats.Lag, time.Second)
+
+	// Promoting the replica keeps its keys and allows writes.
+	replica.ReplicaOf(nil)
+	requireValue(t, replica, "after", "value")
+	{
+		_, err := replica.Set(ctx, "key", []byte("value"), 0)
+		require.Nil(t, err)
+	}
+	assert.Equal(t, datkey.ReplicationRolePrimary, replica.Stats(ctx).Replication.Role)
+}
+
+func TestDatkey_ReplicaOf_keyspaceEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary := datkey.New(replicationConfig())
+	defer primary.Close()
+	replica := datkey.New(replicationConfig())
+	defer replica.Close()
+
+	_, err := primary.Set(ctx, "kept", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = replica.Set(ctx, "kept", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = replica.Set(ctx, "replaced", []byte("value"), 0)
+	require.Nil(t, err)
+
+	watcher := replica.WatchKeyspace(10)
+	defer watcher.Close()
+	replica.ReplicaOf(newPipeDialer(primary).dial)
+	requireMissing(t, replica, "replaced")
+
+	// Keys synced are never deleted first, so that readers are not served an empty database while syncing.
+	events := map[datkey.KeyspaceEvent]bool{}
+	for range 2 {
+		events[<-watcher.Events()] = true
+	}
+	assert.Equal(t, map[datkey.KeyspaceEvent]bool{
+		{Key: "kept", Type: datkey.KeyspaceEventSet}:     true,
+		{Key: "replaced", Type: datkey.KeyspaceEventDel}: true,
+	}, events)
+	requireValue(t, replica, "kept", "value")
+	assert.Empty(t, watcher.Events())
+}
+
+func TestDatkey_ReplicaOf_reconnect(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	for _, testCase := range []struct {
+		name         string
+		backlogBytes int
+		fullSync     bool
+	}{
+		{name: "continue from backlog", backlogBytes: 0, fullSync: false},
+		{name: "behind backlog", backlogBytes: 64, fullSync: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			primaryConfig := replicationConfig()
+			primaryConfig.ReplicationBacklogBytes = testCase.backlogBytes
+			primary := datkey.New(primaryConfig)
+			defer primary.Close()
+
+			// A writable replica keeps its own writes unless it syncs every key again.
+			replicaConfig := replicationConfig()
+			replicaConfig.ReplicaWritable = true
+			replica := datkey.New(replicaConfig)
+			defer replica.Close()
+
+			dialer := newPipeDialer(primary)
+			replica.ReplicaOf(dialer.dial)
+
+			_, err := primary.Set(ctx, "first", []byte("value"), 0)
+			require.Nil(t, err)
+			requireValue(t, replica, "first", "value")
+
+			_, err = replica.Set(ctx, "local", []byte("value"), 0)
+			require.Nil(t, err)
+
+			dialer.offline.Store(true)
+			dialer.disconnect()
+			require.Eventually(t, func() bool {
+				return dialer.dials.Load() >= 2
+			}, 5*time.Second, time.Millisecond)
+
+			// The value does not fit in the smaller backlog.
+			value := strings.Repeat("x", 128)
+			_, err = primary.Set(ctx, "second", []byte(value), 0)
+			require.Nil(t, err)
+			dialer.offline.Store(false)
+
+			requireValue(t, replica, "second", value)
+
+			result, readErr := replica.Get(ctx, "local")
+			require.Nil(t, readErr)
+			assert.Equal(t, !testCase.fullSync, result.Exists)
+		})
+	}
+}
+
+func TestDatkey_ReplicaOf_chained(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	primary := datkey.New(replicationConfig())
+	defer primary.Close()
+	replica := datkey.New(replicationConfig())
+	defer replica.Close()
+	subReplica := datkey.New(replicationConfig())
+	defer subReplica.Close()
+
+	replica.ReplicaOf(newPipeDialer(primary).dial)
+	subReplica.ReplicaOf(newPipeDialer(replica).dial)
+
+	_, err := primary.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+	requireValue(t, subReplica, "key", "value")
+
+	require.Eventually(t, func() bool {
+		return subReplica.Stats(ctx).Replication.Offset == primary.Stats(ctx).Replication.Offset
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, primary.Stats(ctx).Replication.ID, subReplica.Stats(ctx).Replication.ID)
+}
@@ -0,0 +1,103 @@
+package datkey
+
+import (
+	"context"
+	"sort"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/internal/glob"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+const scanDefaultCount = 10
+
+type commandScanSlot struct {
+	Resp  *scanSlotResponse
+	Match string
+	Type  ValueType
+}
+
+type scanSlotResponse struct {
+	Keys []string
+}
+
+// ScanQuery filters the keys returned by Scan.
+type ScanQuery struct {
+	// Match keys against a glob pattern, such as "session:*".
+	// Default: every key
+	Match string
+	// Type of value that keys must hold.
+	// Default: every type
+	Type ValueType
+	// Count of keys to return per call. This is a hint, more keys may be returned.
+	// Default: 10
+	Count int
+}
+
+type ScanResponse struct {
+	Keys []string
+	// Cursor to pass to the next call of Scan. Zero once every key has been scanned.
+	Cursor uint64
+}
+
+// Scan the keys stored in the database, starting with cursor zero and continuing with the returned cursor until it is zero again.
+// Every key that exists for the whole scan is returned exactly once, while keys that are added or deleted during the scan may or may not be returned.
+// Keys are scanned one slot at a time, so the cursor is the next slot to scan. Keys of slots being migrated are scanned wherever they are stored.
+func (self *Datkey) Scan(ctx context.Context, cursor uint64, query ScanQuery) (ScanResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return ScanResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return scanKeys(cursor, query, self.cache)
+}
+
+func scanKeys(cursor uint64, query ScanQuery, cache cacheStorage) (ScanResponse, *errors.Error[DbReadErr]) {
+	if cursor >= uint64(cache.slotCount()) {
+		return ScanResponse{}, errors.New(DbReadInvalidArgument, "invalid cursor: %d", cursor) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	count := query.Count
+	if count <= 0 {
+		count = scanDefaultCount
+	}
+
+	var keys []string
+	for slot := hash.Slot(cursor); slot < cache.slotCount(); slot++ {
+		resp := &scanSlotResponse{
+			Keys: nil,
+		}
+		_ = cache.runCommand(slot, commandScanSlot{
+			Match: query.Match,
+			Type:  query.Type,
+			Resp:  resp,
+		})
+		keys = append(keys, resp.Keys...)
+
+		if len(keys) >= count && slot+1 < cache.slotCount() {
+			return ScanResponse{
+				Keys:   keys,
+				Cursor: uint64(slot + 1),
+			}, nil
+		}
+	}
+
+	return ScanResponse{
+		Keys:   keys,
+		Cursor: 0,
+	}, nil
+}
+
+func (self *slotStorage) handleCommandScanSlot(cmd commandScanSlot) {
+	for key, data := range self.storage {
+		if data.isExpired() {
+			continue
+		}
+		if cmd.Match != "" && !glob.Match(cmd.Match, key) {
+			continue
+		}
+		if cmd.Type != "" && data.valueType() != cmd.Type {
+			continue
+		}
+		cmd.Resp.Keys = append(cmd.Resp.Keys, key)
+	}
+	sort.Strings(cmd.Resp.Keys)
+}
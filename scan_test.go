@@ -0,0 +1,83 @@
+package datkey_test
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_Scan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	var expected []string
+	for index := range 100 {
+		key := "user:" + strconv.Itoa(index)
+		expected = append(expected, key)
+		_, err := client.Set(ctx, key, []byte("value"), 0)
+		require.Nil(t, err)
+	}
+	_, err := client.Set(ctx, "other", []byte("value"), 0)
+	require.Nil(t, err)
+	_, err = client.Set(ctx, "user:expired", []byte("value"), time.Nanosecond)
+	require.Nil(t, err)
+	_, zaddErr := client.ZAdd(ctx, "user:zset", datkey.ZMember{Member: "a", Score: 1})
+	require.Nil(t, zaddErr)
+	time.Sleep(time.Millisecond)
+
+	var keys []string
+	var cursor uint64
+	var calls int
+	for {
+		result, err := client.Scan(ctx, cursor, datkey.ScanQuery{
+			Match: "user:*",
+			Type:  datkey.ValueTypeString,
+			Count: 7,
+		})
+		require.Nil(t, err)
+		keys = append(keys, result.Keys...)
+		calls++
+
+		cursor = result.Cursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	sort.Strings(expected)
+	sort.Strings(keys)
+	assert.Equal(t, expected, keys)
+	assert.Greater(t, calls, 1)
+
+	{
+		result, err := client.Scan(ctx, 0, datkey.ScanQuery{
+			Match: "",
+			Type:  "",
+			Count: 1000,
+		})
+		require.Nil(t, err)
+		assert.Len(t, result.Keys, 102)
+		assert.Zero(t, result.Cursor)
+	}
+
+	{
+		_, err := client.Scan(ctx, 1<<20, datkey.ScanQuery{
+			Match: "",
+			Type:  "",
+			Count: 0,
+		})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadInvalidArgument, err.Cause)
+	}
+}
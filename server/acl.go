@@ -0,0 +1,177 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/wspowell/datkey/acl"
+)
+
+// commandAuth: AUTH [username] password. Without a username, the client authenticates as the default user.
+func (self *Server) commandAuth(client *client, args [][]byte) {
+	if len(args) > 3 { //nolint:mnd // reason: auth username password
+		client.writer.error(errSyntax)
+		return
+	}
+
+	if self.config.ACL == nil {
+		client.writer.error("ERR AUTH called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+
+	name, password := acl.DefaultUser, string(args[1])
+	if len(args) == 3 { //nolint:mnd // reason: auth username password
+		name, password = string(args[1]), string(args[2])
+	}
+
+	if self.authenticate(client, name, password) {
+		client.writer.simpleString("OK")
+	}
+}
+
+// authenticate the client as a user, replying with an error and returning false if the password is wrong.
+func (self *Server) authenticate(client *client, name string, password string) bool {
+	if self.config.ACL == nil {
+		client.writer.error("ERR AUTH called without any password configured for the default user. Are you sure your configuration is correct?")
+		return false
+	}
+
+	if err := self.config.ACL.Authenticate(name, password); err != nil {
+		client.writer.error("WRONGPASS " + err.Error())
+		return false
+	}
+
+	client.user = name
+	client.reader.unauthenticated = false
+	return true
+}
+
+// commandACL: ACL SETUSER | GETUSER | DELUSER | LIST | USERS | WHOAMI | CAT | LOAD | SAVE.
+// Every subcommand other than WHOAMI and CAT requires the admin category.
+//
+//nolint:cyclop // reason: one case per subcommand
+func (self *Server) commandACL(client *client, args [][]byte) {
+	subcommand := strings.ToLower(string(args[1]))
+
+	switch subcommand {
+	case "whoami":
+		if self.config.ACL == nil {
+			client.writer.bulkString(acl.DefaultUser)
+			return
+		}
+		client.writer.bulkString(client.user)
+		return
+	case "cat":
+		categories := []acl.Category{acl.CategoryRead, acl.CategoryWrite, acl.CategoryAdmin, acl.CategoryPubSub}
+		client.writer.array(len(categories))
+		for _, category := range categories {
+			client.writer.bulkString(string(category))
+		}
+		return
+	}
+
+	if self.config.ACL == nil {
+		client.writer.error("ERR ACLs are not enabled")
+		return
+	}
+	if err := self.config.ACL.Check(client.user, acl.CategoryAdmin); err != nil {
+		client.writer.error("NOPERM " + sanitize(err.Error()))
+		return
+	}
+
+	switch subcommand {
+	case "setuser":
+		if len(args) < 3 { //nolint:mnd // reason: acl setuser username
+			client.writer.error("ERR wrong number of arguments for 'acl|setuser' command")
+			return
+		}
+		if err := self.config.ACL.SetUser(string(args[2]), stringArgs(args[3:])...); err != nil {
+			client.writer.error("ERR Error in ACL SETUSER modifier: " + sanitize(err.Error()))
+			return
+		}
+		client.writer.simpleString("OK")
+	case "getuser":
+		if len(args) != 3 { //nolint:mnd // reason: acl getuser username
+			client.writer.error("ERR wrong number of arguments for 'acl|getuser' command")
+			return
+		}
+		user, exists := self.config.ACL.User(string(args[2]))
+		if !exists {
+			client.writer.null()
+			return
+		}
+		self.writeUser(client, user)
+	case "deluser":
+		if len(args) < 3 { //nolint:mnd // reason: acl deluser username
+			client.writer.error("ERR wrong number of arguments for 'acl|deluser' command")
+			return
+		}
+		deleted, err := self.config.ACL.DeleteUsers(stringArgs(args[2:])...)
+		if err != nil {
+			client.writer.error("ERR " + sanitize(err.Error()))
+			return
+		}
+		client.writer.integer(int64(deleted))
+	case "list", "users":
+		values := self.config.ACL.List()
+		if subcommand == "users" {
+			values = self.config.ACL.Users()
+		}
+		client.writer.array(len(values))
+		for _, value := range values {
+			client.writer.bulkString(value)
+		}
+	case "load":
+		if err := self.config.ACL.Reload(); err != nil {
+			client.writer.error("ERR " + sanitize(err.Error()))
+			return
+		}
+		client.writer.simpleString("OK")
+	case "save":
+		if err := self.config.ACL.SaveFile(); err != nil {
+			client.writer.error("ERR " + sanitize(err.Error()))
+			return
+		}
+		client.writer.simpleString("OK")
+	default:
+		client.writer.error("ERR unknown subcommand '" + sanitize(string(args[1])) + "'")
+	}
+}
+
+// writeUser as a map of flags, passwords, commands and keys, like redis.
+func (self *Server) writeUser(client *client, user acl.UserInfo) {
+	var flags []string
+	if user.Enabled {
+		flags = append(flags, "on")
+	} else {
+		flags = append(flags, "off")
+	}
+	if user.NoPass {
+		flags = append(flags, "nopass")
+	}
+
+	var commands, keys []string
+	for _, rule := range user.Rules() {
+		switch {
+		case strings.HasPrefix(rule, "+@"), strings.HasPrefix(rule, "-@"):
+			commands = append(commands, rule)
+		case strings.HasPrefix(rule, "~"):
+			keys = append(keys, rule)
+		}
+	}
+
+	client.writer.mapHeader(4) //nolint:mnd // reason: number of fields
+	client.writer.bulkString("flags")
+	client.writer.array(len(flags))
+	for _, flag := range flags {
+		client.writer.bulkString(flag)
+	}
+	client.writer.bulkString("passwords")
+	client.writer.array(len(user.Passwords))
+	for _, password := range user.Passwords {
+		client.writer.bulkString(password)
+	}
+	client.writer.bulkString("commands")
+	client.writer.bulkString(strings.Join(commands, " "))
+	client.writer.bulkString("keys")
+	client.writer.bulkString(strings.Join(keys, " "))
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"bufio"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/server"
+)
+
+func TestServer_ACL(t *testing.T) {
+	t.Parallel()
+
+	users := acl.New()
+	require.Nil(t, users.SetUser(acl.DefaultUser, "off"))
+	require.Nil(t, users.SetUser("alice", "on", ">secret", "~session:*", "+@read", "+@write"))
+	require.Nil(t, users.SetUser("admin", "on", ">admin", "allkeys", "allcommands"))
+
+	addr := startServerWithConfig(t, "tcp", "127.0.0.1:0", server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     nil,
+		ACL:              users,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+
+	conn := dial(t, addr)
+	roundTrip(t, conn, "GET session:1\r\n", "-NOAUTH Authentication required.\r\n")
+	roundTrip(t, conn, "PING\r\n", "-NOAUTH Authentication required.\r\n")
+	roundTrip(t, conn, "HELLO 2\r\n", "-NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used\r\n")
+	roundTrip(t, conn, "AUTH secret\r\n", "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+	roundTrip(t, conn, "AUTH alice wrong\r\n", "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+	roundTrip(t, conn, "AUTH alice secret\r\n", "+OK\r\n")
+	roundTrip(t, conn, "ACL WHOAMI\r\n", "$5\r\nalice\r\n")
+
+	// Clients that have not authenticated cannot send large commands.
+	roundTrip(t, dial(t, addr), "*1\r\n$16385\r\n", "-ERR Protocol error: unauthenticated bulk length\r\n")
+	roundTrip(t, dial(t, addr), "*11\r\n", "-ERR Protocol error: unauthenticated multibulk length\r\n")
+
+	roundTrip(t, conn, "SET session:1 value\r\n", "+OK\r\n")
+	roundTrip(t, conn, "GET session:1\r\n", "$5\r\nvalue\r\n")
+	roundTrip(t, conn, "GET other:1\r\n", "-NOPERM user alice has no permissions to access the 'other:1' key\r\n")
+	roundTrip(t, conn, "MSET session:2 a other:2 b\r\n", "-NOPERM user alice has no permissions to access the 'other:2' key\r\n")
+	roundTrip(t, conn, "EXISTS session:2\r\n", ":0\r\n")
+	roundTrip(t, conn, "INFO\r\n", "-NOPERM user alice has no permissions to run admin commands\r\n")
+	roundTrip(t, conn, "ACL LIST\r\n", "-NOPERM user alice has no permissions to run admin commands\r\n")
+
+	helloConn := dial(t, addr)
+	_, err := helloConn.Write([]byte("HELLO 2 AUTH admin admin\r\nACL WHOAMI\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(helloConn)
+	for {
+		// The HELLO reply ends with the empty array of modules.
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == "*0\r\n" {
+			break
+		}
+	}
+	whoami := make([]byte, len("$5\r\nadmin\r\n"))
+	_, err = io.ReadFull(reader, whoami)
+	require.NoError(t, err)
+	assert.Equal(t, "$5\r\nadmin\r\n", string(whoami))
+
+	adminConn := dial(t, addr)
+	roundTrip(t, adminConn, "AUTH admin admin\r\n", "+OK\r\n")
+	roundTrip(t, adminConn, "ACL USERS\r\n", "*3\r\n$5\r\nadmin\r\n$5\r\nalice\r\n$7\r\ndefault\r\n")
+	roundTrip(t, adminConn, "ACL SETUSER alice -@write\r\n", "+OK\r\n")
+	roundTrip(t, adminConn, "ACL SETUSER alice +@nothing\r\n", "-ERR Error in ACL SETUSER modifier: unknown command category: +@nothing\r\n")
+	roundTrip(t, adminConn, "ACL GETUSER alice\r\n", "*8\r\n$5\r\nflags\r\n*1\r\n$2\r\non\r\n$9\r\npasswords\r\n*1\r\n$64\r\n2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b\r\n$8\r\ncommands\r\n$6\r\n+@read\r\n$4\r\nkeys\r\n$10\r\n~session:*\r\n")
+	roundTrip(t, adminConn, "ACL GETUSER nobody\r\n", "$-1\r\n")
+
+	// Permission changes apply to the connection that is already authenticated.
+	roundTrip(t, conn, "SET session:1 value\r\n", "-NOPERM user alice has no permissions to run write commands\r\n")
+
+	roundTrip(t, adminConn, "ACL DELUSER alice default\r\n", "-ERR the 'default' user cannot be removed\r\n")
+	roundTrip(t, adminConn, "ACL DELUSER alice\r\n", ":1\r\n")
+	roundTrip(t, conn, "GET session:1\r\n", "-NOPERM user alice does not exist or is disabled\r\n")
+	roundTrip(t, adminConn, "ACL LOAD\r\n", "-ERR no ACL file was loaded\r\n")
+}
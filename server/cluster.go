@@ -0,0 +1,182 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// clustered databases own a set of slots and redirect commands for other slots, such as *datkey.Datkey.
+type clustered interface {
+	SetSlotsOwner(slots hash.Range, node string)
+	SetSlotsMigrating(slots hash.Range, target string)
+	SetSlotsImporting(slots hash.Range, source string)
+	SetSlotsStable(slots hash.Range)
+	SlotOwners() []datkey.SlotOwner
+}
+
+// partitioned databases partition keys into slots of their own, such as *datkey.Datkey. Other databases partition keys
+// as Redis Cluster does.
+type partitioned interface {
+	KeySlot(key string) hash.Slot
+}
+
+// redirectError reply for a command redirected to the node that serves its slot, as MOVED or ASK <slot> <node>.
+func (self *client) redirectError(err error) {
+	var redirect *datkey.Redirect
+	if !errors.As(err, &redirect) {
+		self.writer.error("ERR " + err.Error())
+		return
+	}
+
+	kind := "MOVED"
+	if redirect.Ask {
+		kind = "ASK"
+	}
+	self.writer.error(kind + " " + strconv.Itoa(int(redirect.Slot)) + " " + sanitize(redirect.Node))
+}
+
+// commandAsking runs the next command as asked by the source of an importing slot, after an ASK redirect.
+func (self *Server) commandAsking(client *client, _ [][]byte) {
+	client.asking = true
+	client.writer.simpleString("OK")
+}
+
+func (self *Server) commandCluster(client *client, args [][]byte) {
+	subcommand := strings.ToLower(string(args[1]))
+	if subcommand == "keyslot" {
+		if len(args) != 3 { //nolint:mnd // reason: cluster keyslot key
+			client.writer.error("ERR wrong number of arguments for 'cluster|keyslot' command")
+			return
+		}
+		key := string(args[2])
+		slot := hash.ToSlot(key)
+		if db, isPartitioned := self.db.(partitioned); isPartitioned {
+			slot = db.KeySlot(key)
+		}
+		client.writer.integer(int64(slot))
+		return
+	}
+
+	db, isClustered := self.db.(clustered)
+	if !isClustered {
+		client.writer.error("ERR This instance has cluster support disabled")
+		return
+	}
+
+	switch subcommand {
+	case "slots":
+		self.commandClusterSlots(client, db)
+	case "setslot":
+		if self.config.ACL != nil {
+			if err := self.config.ACL.Check(client.user, acl.CategoryAdmin); err != nil {
+				client.writer.error("NOPERM " + sanitize(err.Error()))
+				return
+			}
+		}
+		self.commandClusterSetSlot(client, db, args)
+	default:
+		client.writer.error("ERR unknown subcommand '" + string(args[1]) + "'")
+	}
+}
+
+// commandClusterSlots replies with every range of slots and the address of the node that owns it:
+// [begin, end, [host, port]]. Ranges owned by nodes that are not named by an address are left out.
+func (self *Server) commandClusterSlots(client *client, db clustered) {
+	type slotRange struct {
+		slots hash.Range
+		host  string
+		port  int64
+	}
+
+	var ranges []slotRange
+	for _, owner := range db.SlotOwners() {
+		address := owner.Node
+		if address == "" {
+			address = self.clusterAddress(client)
+		}
+
+		host, portText, err := net.SplitHostPort(address)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.ParseInt(portText, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ranges = append(ranges, slotRange{
+			slots: owner.Slots,
+			host:  host,
+			port:  port,
+		})
+	}
+
+	client.writer.array(len(ranges))
+	for _, slotRange := range ranges {
+		client.writer.array(3) //nolint:mnd // reason: begin, end and primary
+		client.writer.integer(int64(slotRange.slots.Begin))
+		client.writer.integer(int64(slotRange.slots.End))
+		client.writer.array(2) //nolint:mnd // reason: host and port
+		client.writer.bulkString(slotRange.host)
+		client.writer.integer(slotRange.port)
+	}
+}
+
+// commandClusterSetSlot changes the state of a slot, where nodes are named by their address:
+//
+//	CLUSTER SETSLOT <slot> MIGRATING <node>
+//	CLUSTER SETSLOT <slot> IMPORTING <node>
+//	CLUSTER SETSLOT <slot> STABLE
+//	CLUSTER SETSLOT <slot> NODE <node>
+func (self *Server) commandClusterSetSlot(client *client, db clustered, args [][]byte) {
+	if len(args) != 4 && len(args) != 5 { //nolint:mnd // reason: cluster setslot slot state [node]
+		client.writer.error("ERR wrong number of arguments for 'cluster|setslot' command")
+		return
+	}
+
+	slot, ok := parseInteger(args[2])
+	if !ok || slot < 0 || slot >= int64(hash.MaxHashSlot) {
+		client.writer.error("ERR Invalid or out of range slot")
+		return
+	}
+	slots := hash.Range{Begin: hash.Slot(slot), End: hash.Slot(slot)}
+
+	state := strings.ToLower(string(args[3]))
+	if (state == "stable") != (len(args) == 4) { //nolint:mnd // reason: cluster setslot slot stable
+		client.writer.error(errSyntax)
+		return
+	}
+
+	switch state {
+	case "migrating":
+		db.SetSlotsMigrating(slots, string(args[4]))
+	case "importing":
+		db.SetSlotsImporting(slots, string(args[4]))
+	case "stable":
+		db.SetSlotsStable(slots)
+	case "node":
+		node := string(args[4])
+		if node == self.clusterAddress(client) {
+			node = ""
+		}
+		db.SetSlotsOwner(slots, node)
+	default:
+		client.writer.error(errSyntax)
+		return
+	}
+	client.writer.simpleString("OK")
+}
+
+// clusterAddress of the server, as reached by the client if no address is configured.
+func (self *Server) clusterAddress(client *client) string {
+	if self.config.ClusterAddress != "" {
+		return self.config.ClusterAddress
+	}
+	return client.netConn.LocalAddr().String()
+}
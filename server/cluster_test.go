@@ -0,0 +1,89 @@
+package server_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/server"
+)
+
+func TestServer_Cluster(t *testing.T) {
+	t.Parallel()
+
+	sourceAddr := startServer(t, "tcp", "127.0.0.1:0")
+	targetAddr := startServer(t, "tcp", "127.0.0.1:0")
+	source := dial(t, sourceAddr)
+	target := dial(t, targetAddr)
+
+	slot := hash.ToSlot("{a}")
+	host, port, err := net.SplitHostPort(sourceAddr.String())
+	require.NoError(t, err)
+
+	roundTrip(t, source, "CLUSTER KEYSLOT {a}key\r\n", fmt.Sprintf(":%d\r\n", slot))
+	roundTrip(t, source, "CLUSTER SLOTS\r\n",
+		fmt.Sprintf("*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n", len(host), host, port))
+
+	roundTrip(t, source, "SET {a}kept value\r\n", "+OK\r\n")
+	roundTrip(t, source, fmt.Sprintf("CLUSTER SETSLOT %d MIGRATING %s\r\n", slot, targetAddr), "+OK\r\n")
+	roundTrip(t, target, fmt.Sprintf("CLUSTER SETSLOT %d IMPORTING %s\r\n", slot, sourceAddr), "+OK\r\n")
+
+	// Keys still on the source are served, other keys are asked of the target.
+	roundTrip(t, source, "GET {a}kept\r\n", "$5\r\nvalue\r\n")
+	roundTrip(t, source, "GET {a}moved\r\n", fmt.Sprintf("-ASK %d %s\r\n", slot, targetAddr))
+	roundTrip(t, source, "SET {a}moved value\r\n", fmt.Sprintf("-ASK %d %s\r\n", slot, targetAddr))
+
+	// The target only serves reads after ASKING, which applies to the next command.
+	roundTrip(t, target, "GET {a}moved\r\n", fmt.Sprintf("-MOVED %d %s\r\n", slot, sourceAddr))
+	roundTrip(t, target, "ASKING\r\n", "+OK\r\n")
+	roundTrip(t, target, "GET {a}moved\r\n", "$-1\r\n")
+	roundTrip(t, target, "GET {a}moved\r\n", fmt.Sprintf("-MOVED %d %s\r\n", slot, sourceAddr))
+
+	// Naming the node itself gives it the slot.
+	roundTrip(t, target, fmt.Sprintf("CLUSTER SETSLOT %d NODE %s\r\n", slot, targetAddr), "+OK\r\n")
+	roundTrip(t, source, fmt.Sprintf("CLUSTER SETSLOT %d NODE %s\r\n", slot, targetAddr), "+OK\r\n")
+	roundTrip(t, target, "GET {a}moved\r\n", "$-1\r\n")
+	roundTrip(t, source, "GET {a}kept\r\n", fmt.Sprintf("-MOVED %d %s\r\n", slot, targetAddr))
+
+	roundTrip(t, source, "CLUSTER SETSLOT 16384 STABLE\r\n", "-ERR Invalid or out of range slot\r\n")
+	roundTrip(t, source, fmt.Sprintf("CLUSTER SETSLOT %d STABLE %s\r\n", slot, targetAddr), "-ERR syntax error\r\n")
+	roundTrip(t, source, "CLUSTER UNKNOWN\r\n", "-ERR unknown subcommand 'UNKNOWN'\r\n")
+}
+
+func TestServer_Cluster_partitioner(t *testing.T) {
+	t.Parallel()
+
+	partitioner := hash.NewXXHashPartitioner(1024)
+	var config datkey.Config
+	config.Partitioner = partitioner
+	addr := serveDatabase(t, config, "tcp", "127.0.0.1:0", server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     nil,
+		ACL:              nil,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+	conn := dial(t, addr)
+
+	// Keys are in the slots of the partitioner of the database, and only its slots are owned.
+	slot := partitioner.Slot("{a}key")
+	require.NotEqual(t, hash.ToSlot("{a}key"), slot)
+	roundTrip(t, conn, "CLUSTER KEYSLOT {a}key\r\n", fmt.Sprintf(":%d\r\n", slot))
+	host, port, err := net.SplitHostPort(addr.String())
+	require.NoError(t, err)
+	roundTrip(t, conn, "CLUSTER SLOTS\r\n",
+		fmt.Sprintf("*1\r\n*3\r\n:0\r\n:1023\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n", len(host), host, port))
+
+	roundTrip(t, conn, fmt.Sprintf("CLUSTER SETSLOT %d NODE other:6379\r\n", slot), "+OK\r\n")
+	roundTrip(t, conn, "GET {a}key\r\n", fmt.Sprintf("-MOVED %d other:6379\r\n", slot))
+
+	// Slots past the slot count store no keys, so setting them does nothing.
+	roundTrip(t, conn, "CLUSTER SETSLOT 16383 NODE other:6379\r\n", "+OK\r\n")
+}
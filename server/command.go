@@ -0,0 +1,891 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+const (
+	serverName = "datkey"
+	// redisVersion reported to clients, which some clients use to decide which commands are available.
+	redisVersion = "7.2.0"
+)
+
+type commandHandler func(self *Server, client *client, args [][]byte)
+
+type commandSpec struct {
+	handler commandHandler
+	// category the user must be allowed to run, if ACLs are enabled. Connection commands have no category and can
+	// always be run once authenticated.
+	category acl.Category
+	// arity is the number of arguments, including the command name. A negative arity is the minimum number of arguments.
+	arity int
+	// firstKey, lastKey and keyStep are the positions of the keys in the arguments, which are checked against the key
+	// patterns of the user. A negative lastKey counts back from the last argument. A zero firstKey means there are no keys.
+	firstKey int
+	lastKey  int
+	keyStep  int
+}
+
+// keys named by the arguments of a command.
+func (self commandSpec) keys(args [][]byte) []string {
+	if self.firstKey == 0 {
+		return nil
+	}
+
+	lastKey := self.lastKey
+	if lastKey < 0 {
+		lastKey += len(args)
+	}
+
+	var keys []string
+	for index := self.firstKey; index <= lastKey && index < len(args); index += self.keyStep {
+		keys = append(keys, string(args[index]))
+	}
+	return keys
+}
+
+// newCommandTable of every supported command, keyed by lowercase name.
+//
+//nolint:maintidx // reason: one entry per command
+func newCommandTable() map[string]commandSpec {
+	const (
+		read   = acl.CategoryRead
+		write  = acl.CategoryWrite
+		admin  = acl.CategoryAdmin
+		pubSub = acl.CategoryPubSub
+	)
+
+	return map[string]commandSpec{
+		// Connection
+		"ping":   {handler: (*Server).commandPing, category: "", arity: -1, firstKey: 0, lastKey: 0, keyStep: 0},
+		"echo":   {handler: (*Server).commandEcho, category: "", arity: 2, firstKey: 0, lastKey: 0, keyStep: 0},
+		"hello":  {handler: (*Server).commandHello, category: "", arity: -1, firstKey: 0, lastKey: 0, keyStep: 0},
+		"auth":   {handler: (*Server).commandAuth, category: "", arity: -2, firstKey: 0, lastKey: 0, keyStep: 0},
+		"quit":   {handler: (*Server).commandQuit, category: "", arity: -1, firstKey: 0, lastKey: 0, keyStep: 0},
+		"select": {handler: (*Server).commandSelect, category: "", arity: 2, firstKey: 0, lastKey: 0, keyStep: 0},
+		"client": {handler: (*Server).commandClient, category: "", arity: -2, firstKey: 0, lastKey: 0, keyStep: 0},
+
+		// Server
+		"command": {handler: (*Server).commandCommand, category: "", arity: -1, firstKey: 0, lastKey: 0, keyStep: 0},
+		"info":    {handler: (*Server).commandInfo, category: admin, arity: -1, firstKey: 0, lastKey: 0, keyStep: 0},
+		// ACL checks the admin category itself, since any user may run ACL WHOAMI.
+		"acl": {handler: (*Server).commandACL, category: "", arity: -2, firstKey: 0, lastKey: 0, keyStep: 0},
+
+		// Cluster
+		"asking": {handler: (*Server).commandAsking, category: "", arity: 1, firstKey: 0, lastKey: 0, keyStep: 0},
+		// CLUSTER checks the admin category itself for the subcommands that change the slots.
+		"cluster": {handler: (*Server).commandCluster, category: "", arity: -2, firstKey: 0, lastKey: 0, keyStep: 0},
+
+		// Replication
+		"psync":     {handler: (*Server).commandPSync, category: admin, arity: 1, firstKey: 0, lastKey: 0, keyStep: 0},
+		"replicaof": {handler: (*Server).commandReplicaOf, category: admin, arity: 3, firstKey: 0, lastKey: 0, keyStep: 0},
+		"slaveof":   {handler: (*Server).commandReplicaOf, category: admin, arity: 3, firstKey: 0, lastKey: 0, keyStep: 0},
+
+		// Pub/sub
+		"publish":      {handler: (*Server).commandPublish, category: pubSub, arity: 3, firstKey: 0, lastKey: 0, keyStep: 0},
+		"subscribe":    {handler: (*Server).commandSubscribe, category: pubSub, arity: -2, firstKey: 0, lastKey: 0, keyStep: 0},
+		"psubscribe":   {handler: (*Server).commandPSubscribe, category: pubSub, arity: -2, firstKey: 0, lastKey: 0, keyStep: 0},
+		"unsubscribe":  {handler: (*Server).commandUnsubscribe, category: pubSub, arity: -1, firstKey: 0, lastKey: 0, keyStep: 0},
+		"punsubscribe": {handler: (*Server).commandPUnsubscribe, category: pubSub, arity: -1, firstKey: 0, lastKey: 0, keyStep: 0},
+		"pubsub":       {handler: (*Server).commandPubSub, category: pubSub, arity: -2, firstKey: 0, lastKey: 0, keyStep: 0},
+
+		// Keys
+		"del":     {handler: (*Server).commandDel, category: write, arity: -2, firstKey: 1, lastKey: -1, keyStep: 1},
+		"unlink":  {handler: (*Server).commandDel, category: write, arity: -2, firstKey: 1, lastKey: -1, keyStep: 1},
+		"exists":  {handler: (*Server).commandExists, category: read, arity: -2, firstKey: 1, lastKey: -1, keyStep: 1},
+		"expire":  {handler: (*Server).commandExpire, category: write, arity: 3, firstKey: 1, lastKey: 1, keyStep: 1},
+		"pexpire": {handler: (*Server).commandPExpire, category: write, arity: 3, firstKey: 1, lastKey: 1, keyStep: 1},
+		"persist": {handler: (*Server).commandPersist, category: write, arity: 2, firstKey: 1, lastKey: 1, keyStep: 1},
+		"ttl":     {handler: (*Server).commandTtl, category: read, arity: 2, firstKey: 1, lastKey: 1, keyStep: 1},
+		"pttl":    {handler: (*Server).commandPTtl, category: read, arity: 2, firstKey: 1, lastKey: 1, keyStep: 1},
+		"type":    {handler: (*Server).commandType, category: read, arity: 2, firstKey: 1, lastKey: 1, keyStep: 1},
+
+		// Strings
+		"get":    {handler: (*Server).commandGet, category: read, arity: 2, firstKey: 1, lastKey: 1, keyStep: 1},
+		"getdel": {handler: (*Server).commandGetDel, category: write, arity: 2, firstKey: 1, lastKey: 1, keyStep: 1},
+		"mget":   {handler: (*Server).commandMGet, category: read, arity: -2, firstKey: 1, lastKey: -1, keyStep: 1},
+		"set":    {handler: (*Server).commandSet, category: write, arity: -3, firstKey: 1, lastKey: 1, keyStep: 1},
+		"setex":  {handler: (*Server).commandSetEx, category: write, arity: 4, firstKey: 1, lastKey: 1, keyStep: 1},
+		"psetex": {handler: (*Server).commandPSetEx, category: write, arity: 4, firstKey: 1, lastKey: 1, keyStep: 1},
+		"mset":   {handler: (*Server).commandMSet, category: write, arity: -3, firstKey: 1, lastKey: -1, keyStep: 2},
+
+		// Bitmaps
+		"setbit":   {handler: (*Server).commandSetBit, category: write, arity: 4, firstKey: 1, lastKey: 1, keyStep: 1},
+		"getbit":   {handler: (*Server).commandGetBit, category: read, arity: 3, firstKey: 1, lastKey: 1, keyStep: 1},
+		"bitcount": {handler: (*Server).commandBitCount, category: read, arity: -2, firstKey: 1, lastKey: 1, keyStep: 1},
+
+		// HyperLogLog
+		"pfadd":   {handler: (*Server).commandPFAdd, category: write, arity: -2, firstKey: 1, lastKey: 1, keyStep: 1},
+		"pfcount": {handler: (*Server).commandPFCount, category: read, arity: -2, firstKey: 1, lastKey: -1, keyStep: 1},
+		"pfmerge": {handler: (*Server).commandPFMerge, category: write, arity: -2, firstKey: 1, lastKey: -1, keyStep: 1},
+
+		// Sorted sets
+		"zadd":          {handler: (*Server).commandZAdd, category: write, arity: -4, firstKey: 1, lastKey: 1, keyStep: 1},
+		"zrem":          {handler: (*Server).commandZRem, category: write, arity: -3, firstKey: 1, lastKey: 1, keyStep: 1},
+		"zscore":        {handler: (*Server).commandZScore, category: read, arity: 3, firstKey: 1, lastKey: 1, keyStep: 1},
+		"zcard":         {handler: (*Server).commandZCard, category: read, arity: 2, firstKey: 1, lastKey: 1, keyStep: 1},
+		"zrangebyscore": {handler: (*Server).commandZRangeByScore, category: read, arity: -4, firstKey: 1, lastKey: 1, keyStep: 1},
+	}
+}
+
+const (
+	errSyntax     = "ERR syntax error"
+	errNotInteger = "ERR value is not an integer or out of range"
+	errNotFloat   = "ERR value is not a valid float"
+	errWrongType  = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	errReadOnly   = "READONLY You can't write against a read only replica."
+)
+
+// readError reply for an error returned by a database read.
+func (self *client) readError(err *errors.Error[datkey.DbReadErr]) {
+	switch err.Cause {
+	case datkey.DbReadWrongType:
+		self.writer.error(errWrongType)
+	case datkey.DbReadRedirect:
+		self.redirectError(err)
+	default:
+		self.writer.error("ERR " + err.Error())
+	}
+}
+
+// writeError reply for an error returned by a database write.
+func (self *client) writeError(err *errors.Error[datkey.DbWriteErr]) {
+	switch err.Cause {
+	case datkey.DbWriteWrongType:
+		self.writer.error(errWrongType)
+	case datkey.DbWriteReadOnly:
+		self.writer.error(errReadOnly)
+	case datkey.DbWriteRedirect:
+		self.redirectError(err)
+	default:
+		self.writer.error("ERR " + err.Error())
+	}
+}
+
+func parseInteger(arg []byte) (int64, bool) {
+	value, err := strconv.ParseInt(string(arg), 10, 64)
+	return value, err == nil
+}
+
+func parseFloat(arg []byte) (float64, bool) {
+	switch strings.ToLower(string(arg)) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+
+	value, err := strconv.ParseFloat(string(arg), 64)
+	return value, err == nil && !math.IsNaN(value)
+}
+
+// parseTtl of an expire command in the given unit. The ttl must be positive.
+func parseTtl(arg []byte, unit time.Duration) (time.Duration, bool) {
+	value, ok := parseInteger(arg)
+	if !ok || value <= 0 || value > math.MaxInt64/int64(unit) {
+		return 0, false
+	}
+	return time.Duration(value) * unit, true
+}
+
+func (self *Server) commandPing(client *client, args [][]byte) {
+	// Subscribed RESP2 clients are replied to in the form of a message, so that the reply can be told apart from them.
+	if client.writer.protocol == protocolResp2 && client.subscribed() && len(args) <= 2 {
+		client.writer.array(2) //nolint:mnd // reason: pong and message
+		client.writer.bulkString("pong")
+		if len(args) == 2 { //nolint:mnd // reason: message argument
+			client.writer.bulk(args[1])
+		} else {
+			client.writer.bulkString("")
+		}
+		return
+	}
+
+	switch len(args) {
+	case 1:
+		client.writer.simpleString("PONG")
+	case 2: //nolint:mnd // reason: message argument
+		client.writer.bulk(args[1])
+	default:
+		client.writer.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (self *Server) commandEcho(client *client, args [][]byte) {
+	client.writer.bulk(args[1])
+}
+
+// commandHello negotiates the protocol version: HELLO [protover [AUTH username password] [SETNAME clientname]].
+func (self *Server) commandHello(client *client, args [][]byte) {
+	protocol := client.writer.protocol
+	if len(args) > 1 {
+		version, ok := parseInteger(args[1])
+		if !ok {
+			client.writer.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if version != protocolResp2 && version != protocolResp3 {
+			client.writer.error("NOPROTO unsupported protocol version")
+			return
+		}
+		protocol = int(version)
+	}
+
+	name := client.name
+	var authenticate bool
+	var authName, authPassword string
+	for index := 2; index < len(args); index++ {
+		switch strings.ToLower(string(args[index])) {
+		case "setname":
+			if index+1 >= len(args) {
+				client.writer.error(errSyntax)
+				return
+			}
+			index++
+			name = string(args[index])
+		case "auth":
+			if index+2 >= len(args) {
+				client.writer.error(errSyntax)
+				return
+			}
+			authName, authPassword = string(args[index+1]), string(args[index+2])
+			authenticate = true
+			index += 2
+		default:
+			client.writer.error(errSyntax)
+			return
+		}
+	}
+
+	if authenticate && !self.authenticate(client, authName, authPassword) {
+		return
+	}
+	if self.config.ACL != nil && client.user == "" {
+		client.writer.error("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used")
+		return
+	}
+
+	client.writer.protocol = protocol
+	client.name = name
+
+	client.writer.mapHeader(7) //nolint:mnd // reason: number of fields
+	client.writer.bulkString("server")
+	client.writer.bulkString(serverName)
+	client.writer.bulkString("version")
+	client.writer.bulkString(redisVersion)
+	client.writer.bulkString("proto")
+	client.writer.integer(int64(protocol))
+	client.writer.bulkString("id")
+	client.writer.integer(client.id)
+	client.writer.bulkString("mode")
+	client.writer.bulkString("standalone")
+	client.writer.bulkString("role")
+	client.writer.bulkString("master")
+	client.writer.bulkString("modules")
+	client.writer.array(0)
+}
+
+func (self *Server) commandQuit(client *client, _ [][]byte) {
+	client.writer.simpleString("OK")
+	client.quit = true
+}
+
+// commandSelect only accepts database 0, since there is a single keyspace.
+func (self *Server) commandSelect(client *client, args [][]byte) {
+	database, ok := parseInteger(args[1])
+	if !ok {
+		client.writer.error(errNotInteger)
+		return
+	}
+	if database != 0 {
+		client.writer.error("ERR DB index is out of range")
+		return
+	}
+	client.writer.simpleString("OK")
+}
+
+func (self *Server) commandClient(client *client, args [][]byte) {
+	switch strings.ToLower(string(args[1])) {
+	case "id":
+		client.writer.integer(client.id)
+	case "getname":
+		if client.name == "" {
+			client.writer.null()
+			return
+		}
+		client.writer.bulkString(client.name)
+	case "setname":
+		if len(args) != 3 { //nolint:mnd // reason: client setname name
+			client.writer.error("ERR wrong number of arguments for 'client|setname' command")
+			return
+		}
+		if strings.ContainsAny(string(args[2]), " \r\n") {
+			client.writer.error("ERR Client names cannot contain spaces, newlines or special characters.")
+			return
+		}
+		client.name = string(args[2])
+		client.writer.simpleString("OK")
+	case "tracking":
+		self.commandClientTracking(client, args)
+	case "setinfo":
+		// Library names and versions sent by clients on connect are accepted but not kept.
+		client.writer.simpleString("OK")
+	default:
+		client.writer.error("ERR unknown subcommand '" + string(args[1]) + "'")
+	}
+}
+
+// commandCommand describes no commands, which clients such as redis-cli treat as no command hints being available.
+func (self *Server) commandCommand(client *client, args [][]byte) {
+	if len(args) > 1 && strings.EqualFold(string(args[1]), "count") {
+		client.writer.integer(int64(len(self.commands)))
+		return
+	}
+	client.writer.array(0)
+}
+
+func (self *Server) commandInfo(client *client, _ [][]byte) {
+	var info strings.Builder
+	info.WriteString("# Server\r\n")
+	fmt.Fprintf(&info, "redis_version:%s\r\n", redisVersion)
+	fmt.Fprintf(&info, "datkey_mode:standalone\r\n")
+	fmt.Fprintf(&info, "go_version:%s\r\n", runtime.Version())
+	fmt.Fprintf(&info, "uptime_in_seconds:%d\r\n", int64(time.Since(self.startTime).Seconds()))
+	info.WriteString("\r\n# Clients\r\n")
+	fmt.Fprintf(&info, "connected_clients:%d\r\n", self.connections.Load())
+	stats := self.db.Stats(client.ctx)
+	info.WriteString("\r\n# Memory\r\n")
+	fmt.Fprintf(&info, "used_memory_dataset:%d\r\n", stats.DbSizeInBytes)
+	info.WriteString("\r\n# Stats\r\n")
+	fmt.Fprintf(&info, "total_commands_processed:%d\r\n", self.commandsProcessed.Load())
+	writeReplicationInfo(&info, stats.Replication)
+
+	client.writer.verbatim(info.String())
+}
+
+func (self *Server) commandDel(client *client, args [][]byte) {
+	var deleted int64
+	for _, key := range args[1:] {
+		result, err := self.db.Delete(client.ctx, string(key))
+		if err != nil {
+			client.writeError(err)
+			return
+		}
+		if result.Exists {
+			deleted++
+		}
+	}
+	client.writer.integer(deleted)
+}
+
+func (self *Server) commandExists(client *client, args [][]byte) {
+	var exists int64
+	for _, key := range args[1:] {
+		result, err := self.db.Type(client.ctx, string(key))
+		if err != nil {
+			client.readError(err)
+			return
+		}
+		if result.Exists {
+			exists++
+		}
+	}
+	client.writer.integer(exists)
+}
+
+func (self *Server) commandExpire(client *client, args [][]byte) {
+	self.expire(client, args, time.Second)
+}
+
+func (self *Server) commandPExpire(client *client, args [][]byte) {
+	self.expire(client, args, time.Millisecond)
+}
+
+func (self *Server) expire(client *client, args [][]byte, unit time.Duration) {
+	value, ok := parseInteger(args[2])
+	if !ok {
+		client.writer.error(errNotInteger)
+		return
+	}
+
+	key := string(args[1])
+	if value <= 0 {
+		// A ttl that is not positive expires the key immediately.
+		result, err := self.db.Delete(client.ctx, key)
+		if err != nil {
+			client.writeError(err)
+			return
+		}
+		client.writer.integer(boolInteger(result.Exists))
+		return
+	}
+
+	ttl, ok := parseTtl(args[2], unit)
+	if !ok {
+		client.writer.error("ERR invalid expire time in '" + strings.ToLower(string(args[0])) + "' command")
+		return
+	}
+
+	result, err := self.db.Expire(client.ctx, key, ttl)
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.integer(boolInteger(result.Exists))
+}
+
+func (self *Server) commandPersist(client *client, args [][]byte) {
+	result, err := self.db.Persist(client.ctx, string(args[1]))
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.integer(boolInteger(result.Persisted))
+}
+
+func (self *Server) commandTtl(client *client, args [][]byte) {
+	self.ttl(client, args, time.Second)
+}
+
+func (self *Server) commandPTtl(client *client, args [][]byte) {
+	self.ttl(client, args, time.Millisecond)
+}
+
+func (self *Server) ttl(client *client, args [][]byte, unit time.Duration) {
+	result, err := self.db.Ttl(client.ctx, string(args[1]))
+	if err != nil {
+		client.readError(err)
+		return
+	}
+
+	switch {
+	case !result.Exists:
+		client.writer.integer(-2) //nolint:mnd // reason: key does not exist
+	case result.Ttl == 0:
+		client.writer.integer(-1)
+	default:
+		// Round up so that a key with time remaining never reports a ttl of 0.
+		client.writer.integer(int64((result.Ttl + unit - 1) / unit))
+	}
+}
+
+func (self *Server) commandType(client *client, args [][]byte) {
+	result, err := self.db.Type(client.ctx, string(args[1]))
+	if err != nil {
+		client.readError(err)
+		return
+	}
+	client.writer.simpleString(string(result.Type))
+}
+
+func (self *Server) commandGet(client *client, args [][]byte) {
+	result, err := self.db.Get(client.ctx, string(args[1]))
+	if err != nil {
+		client.readError(err)
+		return
+	}
+	if !result.Exists {
+		client.writer.null()
+		return
+	}
+	client.writer.bulk(result.Value)
+}
+
+// commandGetDel replies with the value of a key and deletes it. The key must hold a string.
+func (self *Server) commandGetDel(client *client, args [][]byte) {
+	result, err := self.db.GetDel(client.ctx, string(args[1]))
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	if !result.Exists {
+		client.writer.null()
+		return
+	}
+	client.writer.bulk(result.DeletedValue)
+}
+
+// commandMGet replies with a null for keys that do not exist or do not hold a string.
+func (self *Server) commandMGet(client *client, args [][]byte) {
+	client.writer.array(len(args) - 1)
+	for _, key := range args[1:] {
+		result, err := self.db.Get(client.ctx, string(key))
+		if err != nil || !result.Exists {
+			client.writer.null()
+			continue
+		}
+		client.writer.bulk(result.Value)
+	}
+}
+
+// commandSet: SET key value [EX seconds | PX milliseconds] [GET].
+func (self *Server) commandSet(client *client, args [][]byte) {
+	var ttl time.Duration
+	var get bool
+	for index := 3; index < len(args); index++ {
+		switch option := strings.ToLower(string(args[index])); option {
+		case "ex", "px":
+			if ttl != 0 || index+1 >= len(args) {
+				client.writer.error(errSyntax)
+				return
+			}
+			unit := time.Second
+			if option == "px" {
+				unit = time.Millisecond
+			}
+			index++
+			var ok bool
+			ttl, ok = parseTtl(args[index], unit)
+			if !ok {
+				client.writer.error("ERR invalid expire time in 'set' command")
+				return
+			}
+		case "get":
+			get = true
+		default:
+			client.writer.error(errSyntax)
+			return
+		}
+	}
+
+	if get {
+		// The previous value must be a string to be returned.
+		if _, err := self.db.Get(client.ctx, string(args[1])); err != nil {
+			client.readError(err)
+			return
+		}
+	}
+
+	result, err := self.db.Set(client.ctx, string(args[1]), args[2], ttl)
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+
+	switch {
+	case !get:
+		client.writer.simpleString("OK")
+	case result.Exists:
+		client.writer.bulk(result.PreviousValue)
+	default:
+		client.writer.null()
+	}
+}
+
+func (self *Server) commandSetEx(client *client, args [][]byte) {
+	self.setEx(client, args, time.Second)
+}
+
+func (self *Server) commandPSetEx(client *client, args [][]byte) {
+	self.setEx(client, args, time.Millisecond)
+}
+
+func (self *Server) setEx(client *client, args [][]byte, unit time.Duration) {
+	ttl, ok := parseTtl(args[2], unit)
+	if !ok {
+		client.writer.error("ERR invalid expire time in '" + strings.ToLower(string(args[0])) + "' command")
+		return
+	}
+
+	if _, err := self.db.Set(client.ctx, string(args[1]), args[3], ttl); err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.simpleString("OK")
+}
+
+func (self *Server) commandMSet(client *client, args [][]byte) {
+	if len(args)%2 != 1 {
+		client.writer.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	for index := 1; index < len(args); index += 2 {
+		if _, err := self.db.Set(client.ctx, string(args[index]), args[index+1], 0); err != nil {
+			client.writeError(err)
+			return
+		}
+	}
+	client.writer.simpleString("OK")
+}
+
+func (self *Server) commandSetBit(client *client, args [][]byte) {
+	offset, ok := parseInteger(args[2])
+	if !ok || offset < 0 {
+		client.writer.error("ERR bit offset is not an integer or out of range")
+		return
+	}
+
+	var value bool
+	switch string(args[3]) {
+	case "0":
+	case "1":
+		value = true
+	default:
+		client.writer.error("ERR bit is not an integer or out of range")
+		return
+	}
+
+	result, err := self.db.SetBit(client.ctx, string(args[1]), offset, value)
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.integer(boolInteger(result.PreviousValue))
+}
+
+func (self *Server) commandGetBit(client *client, args [][]byte) {
+	offset, ok := parseInteger(args[2])
+	if !ok || offset < 0 {
+		client.writer.error("ERR bit offset is not an integer or out of range")
+		return
+	}
+
+	result, err := self.db.GetBit(client.ctx, string(args[1]), offset)
+	if err != nil {
+		client.readError(err)
+		return
+	}
+	client.writer.integer(boolInteger(result.Value))
+}
+
+// commandBitCount: BITCOUNT key [start end [BYTE | BIT]].
+func (self *Server) commandBitCount(client *client, args [][]byte) {
+	key := string(args[1])
+	if len(args) == 2 { //nolint:mnd // reason: no range
+		result, err := self.db.BitCount(client.ctx, key)
+		if err != nil {
+			client.readError(err)
+			return
+		}
+		client.writer.integer(result.Count)
+		return
+	}
+
+	if len(args) != 4 && len(args) != 5 {
+		client.writer.error(errSyntax)
+		return
+	}
+
+	start, startOk := parseInteger(args[2])
+	end, endOk := parseInteger(args[3])
+	if !startOk || !endOk {
+		client.writer.error(errNotInteger)
+		return
+	}
+
+	unit := datkey.BitRangeByte
+	if len(args) == 5 { //nolint:mnd // reason: unit argument
+		switch strings.ToLower(string(args[4])) {
+		case "byte":
+		case "bit":
+			unit = datkey.BitRangeBit
+		default:
+			client.writer.error(errSyntax)
+			return
+		}
+	}
+
+	result, err := self.db.BitCountRange(client.ctx, key, datkey.BitRange{Unit: unit, Start: start, End: end})
+	if err != nil {
+		client.readError(err)
+		return
+	}
+	client.writer.integer(result.Count)
+}
+
+func (self *Server) commandPFAdd(client *client, args [][]byte) {
+	result, err := self.db.PFAdd(client.ctx, string(args[1]), args[2:]...)
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.integer(boolInteger(result.Changed))
+}
+
+func (self *Server) commandPFCount(client *client, args [][]byte) {
+	result, err := self.db.PFCount(client.ctx, stringArgs(args[1:])...)
+	if err != nil {
+		client.readError(err)
+		return
+	}
+	client.writer.integer(result.Count)
+}
+
+func (self *Server) commandPFMerge(client *client, args [][]byte) {
+	if err := self.db.PFMerge(client.ctx, string(args[1]), stringArgs(args[2:])...); err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.simpleString("OK")
+}
+
+// commandZAdd: ZADD key score member [score member ...].
+func (self *Server) commandZAdd(client *client, args [][]byte) {
+	if len(args)%2 != 0 {
+		client.writer.error(errSyntax)
+		return
+	}
+
+	members := make([]datkey.ZMember, 0, (len(args)-2)/2) //nolint:mnd // reason: score and member pairs
+	for index := 2; index < len(args); index += 2 {
+		score, ok := parseFloat(args[index])
+		if !ok {
+			client.writer.error(errNotFloat)
+			return
+		}
+		members = append(members, datkey.ZMember{Member: string(args[index+1]), Score: score})
+	}
+
+	result, err := self.db.ZAdd(client.ctx, string(args[1]), members...)
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.integer(result.Added)
+}
+
+func (self *Server) commandZRem(client *client, args [][]byte) {
+	result, err := self.db.ZRem(client.ctx, string(args[1]), stringArgs(args[2:])...)
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.integer(result.Removed)
+}
+
+func (self *Server) commandZScore(client *client, args [][]byte) {
+	result, err := self.db.ZScore(client.ctx, string(args[1]), string(args[2]))
+	if err != nil {
+		client.readError(err)
+		return
+	}
+	if !result.Exists {
+		client.writer.null()
+		return
+	}
+	client.writer.double(result.Score)
+}
+
+func (self *Server) commandZCard(client *client, args [][]byte) {
+	result, err := self.db.ZCard(client.ctx, string(args[1]))
+	if err != nil {
+		client.readError(err)
+		return
+	}
+	client.writer.integer(result.Count)
+}
+
+// commandZRangeByScore: ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count].
+func (self *Server) commandZRangeByScore(client *client, args [][]byte) {
+	minScore, minExclusive, minOk := parseScoreBound(args[2])
+	maxScore, maxExclusive, maxOk := parseScoreBound(args[3])
+	if !minOk || !maxOk {
+		client.writer.error("ERR min or max is not a float")
+		return
+	}
+
+	var withScores bool
+	offset, count := int64(0), int64(-1)
+	for index := 4; index < len(args); index++ {
+		switch strings.ToLower(string(args[index])) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if index+2 >= len(args) {
+				client.writer.error(errSyntax)
+				return
+			}
+			var offsetOk, countOk bool
+			offset, offsetOk = parseInteger(args[index+1])
+			count, countOk = parseInteger(args[index+2])
+			if !offsetOk || !countOk {
+				client.writer.error(errNotInteger)
+				return
+			}
+			index += 2
+		default:
+			client.writer.error(errSyntax)
+			return
+		}
+	}
+
+	result, err := self.db.ZRangeByScore(client.ctx, string(args[1]), datkey.ScoreRange{
+		Min:          minScore,
+		Max:          maxScore,
+		MinExclusive: minExclusive,
+		MaxExclusive: maxExclusive,
+	})
+	if err != nil {
+		client.readError(err)
+		return
+	}
+
+	members := result.Members
+	if offset < 0 || offset >= int64(len(members)) {
+		members = nil
+	} else {
+		members = members[offset:]
+		if count >= 0 && count < int64(len(members)) {
+			members = members[:count]
+		}
+	}
+
+	if withScores && client.writer.protocol == protocolResp3 {
+		// RESP3 replies with a pair for each member.
+		client.writer.array(len(members))
+		for _, member := range members {
+			client.writer.array(2) //nolint:mnd // reason: member and score
+			client.writer.bulkString(member.Member)
+			client.writer.double(member.Score)
+		}
+		return
+	}
+
+	if withScores {
+		client.writer.array(2 * len(members)) //nolint:mnd // reason: member and score
+	} else {
+		client.writer.array(len(members))
+	}
+	for _, member := range members {
+		client.writer.bulkString(member.Member)
+		if withScores {
+			client.writer.double(member.Score)
+		}
+	}
+}
+
+// parseScoreBound of a score range, where a "(" prefix excludes the bound.
+func parseScoreBound(arg []byte) (float64, bool, bool) {
+	exclusive := len(arg) > 0 && arg[0] == '('
+	if exclusive {
+		arg = arg[1:]
+	}
+
+	score, ok := parseFloat(arg)
+	return score, exclusive, ok
+}
+
+func stringArgs(args [][]byte) []string {
+	values := make([]string, len(args))
+	for index, arg := range args {
+		values[index] = string(arg)
+	}
+	return values
+}
+
+func boolInteger(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// publishing databases publish messages to the subscribers of channels, such as *datkey.Datkey.
+type publishing interface {
+	Publish(ctx context.Context, channel string, message []byte) (datkey.PublishResponse, *errors.Error[datkey.DbWriteErr])
+	Subscribe(channels ...string) *datkey.Subscription
+	PubSubChannels(pattern string) []string
+	PubSubNumSub(channels ...string) map[string]int64
+	PubSubNumPat() int64
+}
+
+// subscribedCommands that a RESP2 client may run while it is subscribed, since any other reply could not be told
+// apart from the messages. RESP3 clients receive messages as push replies and may run any command.
+var subscribedCommands = map[string]bool{ //nolint:gochecknoglobals // reason: constant set
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
+// subscribed if the client receives messages that may be interleaved with the replies to its commands.
+func (self *client) subscribed() bool {
+	return self.subscription != nil && self.subscription.Count() != 0
+}
+
+// commandPublish sends a message to the subscribers of a channel: PUBLISH channel message.
+func (self *Server) commandPublish(client *client, args [][]byte) {
+	db, isPublishing := self.db.(publishing)
+	if !isPublishing {
+		client.writer.error("ERR the database does not support pub/sub")
+		return
+	}
+
+	result, err := db.Publish(client.ctx, string(args[1]), args[2])
+	if err != nil {
+		client.writeError(err)
+		return
+	}
+	client.writer.integer(result.Receivers)
+}
+
+// commandSubscribe to channels: SUBSCRIBE channel [channel ...].
+func (self *Server) commandSubscribe(client *client, args [][]byte) {
+	subscription := self.subscription(client)
+	if subscription == nil {
+		return
+	}
+
+	for _, channel := range args[1:] {
+		subscription.Subscribe(string(channel))
+		client.subscriptionReply("subscribe", string(channel), subscription.Count())
+	}
+}
+
+// commandPSubscribe to glob patterns of channels: PSUBSCRIBE pattern [pattern ...].
+func (self *Server) commandPSubscribe(client *client, args [][]byte) {
+	subscription := self.subscription(client)
+	if subscription == nil {
+		return
+	}
+
+	for _, pattern := range args[1:] {
+		subscription.PSubscribe(string(pattern))
+		client.subscriptionReply("psubscribe", string(pattern), subscription.Count())
+	}
+}
+
+// commandUnsubscribe from channels, or from every channel if none are given: UNSUBSCRIBE [channel ...].
+func (self *Server) commandUnsubscribe(client *client, args [][]byte) {
+	self.unsubscribe(client, "unsubscribe", args[1:], (*datkey.Subscription).Unsubscribe)
+}
+
+// commandPUnsubscribe from patterns, or from every pattern if none are given: PUNSUBSCRIBE [pattern ...].
+func (self *Server) commandPUnsubscribe(client *client, args [][]byte) {
+	self.unsubscribe(client, "punsubscribe", args[1:], (*datkey.Subscription).PUnsubscribe)
+}
+
+// unsubscribe replies once for each name unsubscribed from, with the count of subscriptions left after it.
+func (self *Server) unsubscribe(client *client, kind string, args [][]byte, unsubscribe func(*datkey.Subscription, ...string) []string) {
+	names := stringArgs(args)
+	if client.subscription == nil {
+		for _, name := range names {
+			client.subscriptionReply(kind, name, 0)
+		}
+	} else if len(names) != 0 {
+		for _, name := range names {
+			unsubscribe(client.subscription, name)
+			client.subscriptionReply(kind, name, client.subscription.Count())
+		}
+	} else {
+		names = unsubscribe(client.subscription)
+		count := client.subscription.Count()
+		for index, name := range names {
+			client.subscriptionReply(kind, name, count+len(names)-1-index)
+		}
+	}
+
+	if len(names) == 0 {
+		client.writer.push(3) //nolint:mnd // reason: kind, name and count
+		client.writer.bulkString(kind)
+		client.writer.null()
+		client.writer.integer(0)
+	}
+}
+
+// commandPubSub introspects the channels: PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT.
+func (self *Server) commandPubSub(client *client, args [][]byte) {
+	db, isPublishing := self.db.(publishing)
+	if !isPublishing {
+		client.writer.error("ERR the database does not support pub/sub")
+		return
+	}
+
+	switch strings.ToLower(string(args[1])) {
+	case "channels":
+		if len(args) > 3 { //nolint:mnd // reason: pubsub channels pattern
+			client.writer.error("ERR wrong number of arguments for 'pubsub|channels' command")
+			return
+		}
+		var pattern string
+		if len(args) == 3 { //nolint:mnd // reason: pubsub channels pattern
+			pattern = string(args[2])
+		}
+		channels := db.PubSubChannels(pattern)
+		client.writer.array(len(channels))
+		for _, channel := range channels {
+			client.writer.bulkString(channel)
+		}
+	case "numsub":
+		channels := stringArgs(args[2:])
+		subscribers := db.PubSubNumSub(channels...)
+		client.writer.mapHeader(len(channels))
+		for _, channel := range channels {
+			client.writer.bulkString(channel)
+			client.writer.integer(subscribers[channel])
+		}
+	case "numpat":
+		client.writer.integer(db.PubSubNumPat())
+	default:
+		client.writer.error("ERR unknown subcommand '" + string(args[1]) + "'")
+	}
+}
+
+// subscription of the client, created on its first subscribe along with the goroutine that writes its messages.
+// Replies with an error and returns nil if the database does not support pub/sub.
+func (self *Server) subscription(client *client) *datkey.Subscription {
+	if client.subscription != nil {
+		return client.subscription
+	}
+
+	db, isPublishing := self.db.(publishing)
+	if !isPublishing {
+		client.writer.error("ERR the database does not support pub/sub")
+		return nil
+	}
+
+	client.subscription = db.Subscribe()
+	go self.writeMessages(client, client.subscription)
+	return client.subscription
+}
+
+// writeMessages received by the subscription to the client until the subscription is closed, which happens when the
+// connection is closed.
+func (self *Server) writeMessages(client *client, subscription *datkey.Subscription) {
+	messages := subscription.Messages()
+	for message := range messages {
+		client.writing.Lock()
+		if !self.allowsMessage(client, message) {
+			client.writing.Unlock()
+			continue
+		}
+		if message.Pattern == "" {
+			client.writer.push(3) //nolint:mnd // reason: kind, channel and payload
+			client.writer.bulkString("message")
+		} else {
+			client.writer.push(4) //nolint:mnd // reason: kind, pattern, channel and payload
+			client.writer.bulkString("pmessage")
+			client.writer.bulkString(message.Pattern)
+		}
+		client.writer.bulkString(message.Channel)
+		client.writer.bulk(message.Payload)
+
+		// Messages that have already been received are written before the messages are flushed.
+		var err error
+		if len(messages) == 0 {
+			err = client.writer.writer.Flush()
+		}
+		client.writing.Unlock()
+
+		if err != nil {
+			// The connection is closed, so stop receiving messages rather than blocking publishers.
+			subscription.Close()
+		}
+	}
+}
+
+// allowsMessage to be received by the client, which for keyspace events requires that the user may access the key,
+// so that the key patterns of a user hide the keys of other namespaces. Must hold the writing lock of the client,
+// which guards its user.
+func (self *Server) allowsMessage(client *client, message datkey.Message) bool {
+	if self.config.ACL == nil {
+		return true
+	}
+
+	if key, isKeyspace := strings.CutPrefix(message.Channel, datkey.KeyspaceChannelPrefix); isKeyspace {
+		return self.config.ACL.AllowsKey(client.user, key)
+	}
+	if strings.HasPrefix(message.Channel, datkey.KeyeventChannelPrefix) {
+		return self.config.ACL.AllowsKey(client.user, string(message.Payload))
+	}
+	return true
+}
+
+// subscriptionReply confirming a subscribe or unsubscribe, with the count of subscriptions after it.
+func (self *client) subscriptionReply(kind string, name string, count int) {
+	self.writer.push(3) //nolint:mnd // reason: kind, name and count
+	self.writer.bulkString(kind)
+	self.writer.bulkString(name)
+	self.writer.integer(int64(count))
+}
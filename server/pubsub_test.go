@@ -0,0 +1,139 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/server"
+)
+
+func TestServer_PubSub(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t, "tcp", "127.0.0.1:0")
+	subscriber, publisher := dial(t, addr), dial(t, addr)
+
+	roundTrip(t, subscriber, "SUBSCRIBE news sport\r\n",
+		"*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n"+
+			"*3\r\n$9\r\nsubscribe\r\n$5\r\nsport\r\n:2\r\n")
+	roundTrip(t, subscriber, "PSUBSCRIBE news.*\r\n", "*3\r\n$10\r\npsubscribe\r\n$6\r\nnews.*\r\n:3\r\n")
+
+	roundTrip(t, publisher, "PUBLISH news hello\r\n", ":1\r\n")
+	roundTrip(t, subscriber, "", "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	roundTrip(t, publisher, "PUBLISH news.tech hi\r\n", ":1\r\n")
+	roundTrip(t, subscriber, "", "*4\r\n$8\r\npmessage\r\n$6\r\nnews.*\r\n$9\r\nnews.tech\r\n$2\r\nhi\r\n")
+	roundTrip(t, publisher, "PUBLISH other hello\r\n", ":0\r\n")
+
+	roundTrip(t, publisher, "PUBSUB CHANNELS\r\n", "*2\r\n$4\r\nnews\r\n$5\r\nsport\r\n")
+	roundTrip(t, publisher, "PUBSUB CHANNELS s*\r\n", "*1\r\n$5\r\nsport\r\n")
+	roundTrip(t, publisher, "PUBSUB NUMSUB news missing\r\n", "*4\r\n$4\r\nnews\r\n:1\r\n$7\r\nmissing\r\n:0\r\n")
+	roundTrip(t, publisher, "PUBSUB NUMPAT\r\n", ":1\r\n")
+	roundTrip(t, publisher, "PUBSUB UNKNOWN\r\n", "-ERR unknown subcommand 'UNKNOWN'\r\n")
+
+	// Subscribed RESP2 clients may only run the pub/sub commands, and are replied to PING in the form of a message.
+	roundTrip(t, subscriber, "GET key\r\n", "-ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+	roundTrip(t, subscriber, "PING\r\n", "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+
+	roundTrip(t, subscriber, "UNSUBSCRIBE\r\n",
+		"*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:2\r\n"+
+			"*3\r\n$11\r\nunsubscribe\r\n$5\r\nsport\r\n:1\r\n")
+	roundTrip(t, subscriber, "PUNSUBSCRIBE news.* missing\r\n",
+		"*3\r\n$12\r\npunsubscribe\r\n$6\r\nnews.*\r\n:0\r\n"+
+			"*3\r\n$12\r\npunsubscribe\r\n$7\r\nmissing\r\n:0\r\n")
+	roundTrip(t, subscriber, "UNSUBSCRIBE\r\n", "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+
+	// Once unsubscribed from everything, the client may run any command again.
+	roundTrip(t, subscriber, "PING\r\n", "+PONG\r\n")
+	roundTrip(t, publisher, "PUBLISH news hello\r\n", ":0\r\n")
+	roundTrip(t, publisher, "PUBSUB CHANNELS\r\n", "*0\r\n")
+}
+
+func TestServer_PubSub_resp3(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t, "tcp", "127.0.0.1:0")
+	subscriber := dial(t, addr)
+	roundTrip(t, subscriber, "HELLO 3\r\n",
+		"%7\r\n"+
+			"$6\r\nserver\r\n$6\r\ndatkey\r\n"+
+			"$7\r\nversion\r\n$5\r\n7.2.0\r\n"+
+			"$5\r\nproto\r\n:3\r\n"+
+			"$2\r\nid\r\n:1\r\n"+
+			"$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+			"$4\r\nrole\r\n$6\r\nmaster\r\n"+
+			"$7\r\nmodules\r\n*0\r\n")
+	publisher := dial(t, addr)
+
+	// RESP3 clients receive messages as push replies, and may run any command while subscribed.
+	roundTrip(t, subscriber, "SUBSCRIBE news\r\n", ">3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	roundTrip(t, subscriber, "GET key\r\n", "_\r\n")
+	roundTrip(t, publisher, "PUBLISH news hello\r\n", ":1\r\n")
+	roundTrip(t, subscriber, "", ">3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	roundTrip(t, subscriber, "PING\r\n", "+PONG\r\n")
+}
+
+func TestServer_PubSub_keyspaceEvents(t *testing.T) {
+	t.Parallel()
+
+	var config datkey.Config
+	config.NotifyKeyspaceEvents = []datkey.KeyspaceEventType{datkey.KeyspaceEventSet, datkey.KeyspaceEventDel}
+	addr := serveDatabase(t, config, "tcp", "127.0.0.1:0", server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     nil,
+		ACL:              nil,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+	subscriber, conn := dial(t, addr), dial(t, addr)
+
+	roundTrip(t, subscriber, "SUBSCRIBE __keyevent@0__:del __keyspace@0__:key\r\n",
+		"*3\r\n$9\r\nsubscribe\r\n$18\r\n__keyevent@0__:del\r\n:1\r\n"+
+			"*3\r\n$9\r\nsubscribe\r\n$18\r\n__keyspace@0__:key\r\n:2\r\n")
+
+	roundTrip(t, conn, "SET key value\r\n", "+OK\r\n")
+	roundTrip(t, subscriber, "", "*3\r\n$7\r\nmessage\r\n$18\r\n__keyspace@0__:key\r\n$3\r\nset\r\n")
+	roundTrip(t, conn, "DEL key\r\n", ":1\r\n")
+	roundTrip(t, subscriber, "",
+		"*3\r\n$7\r\nmessage\r\n$18\r\n__keyspace@0__:key\r\n$3\r\ndel\r\n"+
+			"*3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:del\r\n$3\r\nkey\r\n")
+}
+
+func TestServer_PubSub_keyspaceEventsACL(t *testing.T) {
+	t.Parallel()
+
+	users := acl.New()
+	require.Nil(t, users.SetUser(acl.DefaultUser, "off"))
+	require.Nil(t, users.SetUser("alice", "on", ">secret", "~session:*", "+@pubsub"))
+	require.Nil(t, users.SetUser("admin", "on", ">admin", "allkeys", "allcommands"))
+
+	var config datkey.Config
+	config.NotifyKeyspaceEvents = []datkey.KeyspaceEventType{datkey.KeyspaceEventSet}
+	addr := serveDatabase(t, config, "tcp", "127.0.0.1:0", server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     nil,
+		ACL:              users,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+	subscriber, conn := dial(t, addr), dial(t, addr)
+	roundTrip(t, subscriber, "AUTH alice secret\r\n", "+OK\r\n")
+	roundTrip(t, conn, "AUTH admin admin\r\n", "+OK\r\n")
+
+	roundTrip(t, subscriber, "PSUBSCRIBE __key*@0__:*\r\n", "*3\r\n$10\r\npsubscribe\r\n$12\r\n__key*@0__:*\r\n:1\r\n")
+
+	// Events of keys the user may not access are not received.
+	roundTrip(t, conn, "SET other:1 value\r\n", "+OK\r\n")
+	roundTrip(t, conn, "SET session:1 value\r\n", "+OK\r\n")
+	roundTrip(t, subscriber, "",
+		"*4\r\n$8\r\npmessage\r\n$12\r\n__key*@0__:*\r\n$24\r\n__keyspace@0__:session:1\r\n$3\r\nset\r\n"+
+			"*4\r\n$8\r\npmessage\r\n$12\r\n__key*@0__:*\r\n$18\r\n__keyevent@0__:set\r\n$9\r\nsession:1\r\n")
+}
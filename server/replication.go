@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// replicated databases serve replicas and replicate from a primary, such as *datkey.Datkey.
+type replicated interface {
+	ServeReplica(ctx context.Context, conn io.ReadWriter) *errors.Error[datkey.ReplicationErr]
+	ReplicaOf(dial datkey.ReplicationDialer)
+}
+
+// ReplicaOf the server at the address, such as "10.0.0.1:6379", replacing every key with the keys of the primary and
+// applying its writes in the background. The primary is authenticated with and encrypted as set by the Primary
+// settings of the config. An empty address stops replicating, keeping the keys.
+func (self *Server) ReplicaOf(address string) *errors.Error[ServeErr] {
+	db, isReplicated := self.db.(replicated)
+	if !isReplicated {
+		return errors.New(ServeErrInternal, "the database does not support replication")
+	}
+
+	if address == "" {
+		db.ReplicaOf(nil)
+		return nil
+	}
+
+	db.ReplicaOf(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return self.dialPrimary(ctx, address)
+	})
+	return nil
+}
+
+// primaryConn to the replication stream of a primary, reading any data buffered during the handshake first.
+type primaryConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (self *primaryConn) Read(buffer []byte) (int, error) {
+	return self.reader.Read(buffer) //nolint:wrapcheck // reason: passes through the connection
+}
+
+// dialPrimary and switch the connection to the replication stream with PSYNC, after authenticating if needed.
+func (self *Server) dialPrimary(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+	dialer := &net.Dialer{ //nolint:exhaustruct // reason: defaults for every other setting
+		Timeout: defaultHandshakeTimeout,
+	}
+
+	var netConn net.Conn
+	var err error
+	if self.config.PrimaryTLSConfig != nil {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    self.config.PrimaryTLSConfig,
+		}
+		netConn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, errors.NewFromError(ServeErrInternal, err)
+	}
+
+	conn := &primaryConn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+	}
+	if err := self.handshakePrimary(conn); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (self *Server) handshakePrimary(conn *primaryConn) *errors.Error[ServeErr] {
+	if err := conn.SetDeadline(time.Now().Add(defaultHandshakeTimeout)); err != nil {
+		return errors.NewFromError(ServeErrInternal, err)
+	}
+
+	writer := respWriter{
+		writer:   bufio.NewWriter(conn),
+		protocol: protocolResp2,
+	}
+
+	commands := [][]string{{"PSYNC"}}
+	if self.config.PrimaryPassword != "" {
+		auth := []string{"AUTH", self.config.PrimaryPassword}
+		if self.config.PrimaryUsername != "" {
+			auth = []string{"AUTH", self.config.PrimaryUsername, self.config.PrimaryPassword}
+		}
+		commands = append([][]string{auth}, commands...)
+	}
+
+	for _, args := range commands {
+		writer.array(len(args))
+		for _, arg := range args {
+			writer.bulkString(arg)
+		}
+	}
+	if err := writer.writer.Flush(); err != nil {
+		return errors.NewFromError(ServeErrInternal, err)
+	}
+
+	for _, args := range commands {
+		line, err := conn.reader.ReadString('\n')
+		if err != nil {
+			return errors.NewFromError(ServeErrInternal, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, "+") {
+			return errors.New(ServeErrProtocol, "primary replied to %s: %s", args[0], line)
+		}
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return errors.NewFromError(ServeErrInternal, err)
+	}
+	return nil
+}
+
+// commandPSync switches the connection to the replication stream of the database, which is served until the
+// connection is closed.
+func (self *Server) commandPSync(client *client, _ [][]byte) {
+	db, isReplicated := self.db.(replicated)
+	if !isReplicated {
+		client.writer.error("ERR the database does not support replication")
+		return
+	}
+
+	client.writer.simpleString("SYNC")
+	if err := client.writer.writer.Flush(); err != nil {
+		client.quit = true
+		return
+	}
+	_ = client.netConn.SetReadDeadline(time.Time{})
+
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{
+		Reader: client.reader.reader,
+		Writer: client.netConn,
+	}
+	if err := db.ServeReplica(client.ctx, conn); err != nil && err.Cause != datkey.ReplicationCanceled && !self.isClosed() {
+		self.config.ErrorHandler(err)
+	}
+	client.quit = true
+}
+
+// commandReplicaOf replicates from the primary at host and port, or stops replicating with NO ONE.
+func (self *Server) commandReplicaOf(client *client, args [][]byte) {
+	host, port := string(args[1]), string(args[2])
+
+	var address string
+	if !strings.EqualFold(host, "no") || !strings.EqualFold(port, "one") {
+		address = net.JoinHostPort(host, port)
+	}
+
+	if err := self.ReplicaOf(address); err != nil {
+		client.writer.error("ERR " + err.Error())
+		return
+	}
+	client.writer.simpleString("OK")
+}
+
+// writeReplicationInfo section of INFO, using the field names of redis so that existing tools can read them.
+func writeReplicationInfo(info *strings.Builder, stats datkey.ReplicationStats) {
+	info.WriteString("\r\n# Replication\r\n")
+	if stats.Role == datkey.ReplicationRoleReplica {
+		info.WriteString("role:slave\r\n")
+		linkStatus := "down"
+		if stats.Connected {
+			linkStatus = "up"
+		}
+		fmt.Fprintf(info, "master_link_status:%s\r\n", linkStatus)
+		fmt.Fprintf(info, "datkey_replication_lag_ms:%d\r\n", stats.Lag.Milliseconds())
+	} else {
+		info.WriteString("role:master\r\n")
+	}
+	fmt.Fprintf(info, "connected_slaves:%d\r\n", len(stats.Replicas))
+	for index, replica := range stats.Replicas {
+		fmt.Fprintf(info, "slave%d:offset=%d,lag_bytes=%d\r\n", index, replica.Offset, replica.LagBytes)
+	}
+	fmt.Fprintf(info, "master_replid:%s\r\n", stats.ID)
+	fmt.Fprintf(info, "master_repl_offset:%d\r\n", stats.Offset)
+}
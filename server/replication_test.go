@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// info section of a server, read with INFO.
+func info(t *testing.T, conn net.Conn, section string) string {
+	t.Helper()
+
+	_, err := conn.Write([]byte("INFO " + section + "\r\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(header, "$"), header)
+
+	length, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+	require.NoError(t, err)
+	body := make([]byte, length+len("\r\n"))
+	_, err = io.ReadFull(reader, body)
+	require.NoError(t, err)
+	return string(body[:length])
+}
+
+func TestServer_ReplicaOf(t *testing.T) {
+	t.Parallel()
+
+	primaryAddr := startServer(t, "tcp", "127.0.0.1:0")
+	primary := dial(t, primaryAddr)
+	replica := dial(t, startServer(t, "tcp", "127.0.0.1:0"))
+
+	host, port, err := net.SplitHostPort(primaryAddr.String())
+	require.NoError(t, err)
+
+	roundTrip(t, primary, "SET key value\r\n", "+OK\r\n")
+	roundTrip(t, replica, "REPLICAOF "+host+" "+port+"\r\n", "+OK\r\n")
+
+	require.Eventually(t, func() bool {
+		_, err := replica.Write([]byte("GET key\r\n"))
+		require.NoError(t, err)
+		reply := make([]byte, len("$5\r\nvalue\r\n"))
+		require.NoError(t, replica.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, err = replica.Read(reply[:4])
+		require.NoError(t, err)
+		if string(reply[:4]) == "$-1\r" {
+			_, err = replica.Read(reply[:1])
+			require.NoError(t, err)
+			return false
+		}
+		_, err = replica.Read(reply[4:])
+		require.NoError(t, err)
+		return string(reply) == "$5\r\nvalue\r\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	roundTrip(t, replica, "SET key new\r\n", "-READONLY You can't write against a read only replica.\r\n")
+
+	replication := info(t, replica, "replication")
+	assert.Contains(t, replication, "role:slave\r\n")
+	assert.Contains(t, replication, "master_link_status:up\r\n")
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(info(t, primary, "replication"), "connected_slaves:1\r\n")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	roundTrip(t, replica, "REPLICAOF NO ONE\r\n", "+OK\r\n")
+	roundTrip(t, replica, "SET key new\r\n", "+OK\r\n")
+	assert.Contains(t, info(t, replica, "replication"), "role:master\r\n")
+}
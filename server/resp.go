@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Protocol versions of the Redis serialization protocol (RESP).
+const (
+	protocolResp2 = 2
+	protocolResp3 = 3
+)
+
+const (
+	// maxInlineLength of an inline command, which has no length prefix to check against.
+	maxInlineLength = 64 * 1024
+	// unauthenticatedMaxArgs and unauthenticatedMaxBulkLength limit the commands of clients that have not
+	// authenticated, which only need to send AUTH or HELLO, as Redis does.
+	unauthenticatedMaxArgs       = 10
+	unauthenticatedMaxBulkLength = 16 * 1024
+	// bulkChunkSize that bulk strings are read in, so that memory is only allocated as the data arrives rather than
+	// for the length the client claims.
+	bulkChunkSize = 64 * 1024
+)
+
+// respReader reads commands sent by a client, either as an array of bulk strings or as an inline command.
+type respReader struct {
+	reader        *bufio.Reader
+	maxBulkLength int64
+	// unauthenticated clients are limited to small commands until they authenticate.
+	unauthenticated bool
+}
+
+// readCommand arguments. Returns ServeErrProtocol if the client sent an invalid command, after which the connection cannot be read from.
+func (self *respReader) readCommand() ([][]byte, *errors.Error[ServeErr]) {
+	for {
+		prefix, err := self.reader.ReadByte()
+		if err != nil {
+			return nil, errors.NewFromError(ServeErrClosed, err)
+		}
+
+		if prefix != '*' {
+			if err := self.reader.UnreadByte(); err != nil {
+				return nil, errors.NewFromError(ServeErrInternal, err)
+			}
+
+			args, err := self.readInline()
+			if err != nil {
+				return nil, err
+			}
+			if len(args) == 0 {
+				// Empty lines are ignored, as sent by telnet.
+				continue
+			}
+			return args, nil
+		}
+
+		count, readErr := self.readInteger()
+		if readErr != nil {
+			return nil, readErr
+		}
+		if count <= 0 {
+			continue
+		}
+		if count > 1024*1024 { //nolint:mnd // reason: matches the limit of redis
+			return nil, errors.New(ServeErrProtocol, "invalid multibulk length")
+		}
+		if self.unauthenticated && count > unauthenticatedMaxArgs {
+			return nil, errors.New(ServeErrProtocol, "unauthenticated multibulk length")
+		}
+
+		args := make([][]byte, 0, count)
+		for range count {
+			arg, err := self.readBulk()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return args, nil
+	}
+}
+
+func (self *respReader) readInline() ([][]byte, *errors.Error[ServeErr]) {
+	line, err := self.readLine(maxInlineLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.Fields(line), nil
+}
+
+func (self *respReader) readBulk() ([]byte, *errors.Error[ServeErr]) {
+	prefix, err := self.reader.ReadByte()
+	if err != nil {
+		return nil, errors.NewFromError(ServeErrClosed, err)
+	}
+	if prefix != '$' {
+		return nil, errors.New(ServeErrProtocol, "expected '$', got '%c'", prefix)
+	}
+
+	length, readErr := self.readInteger()
+	if readErr != nil {
+		return nil, readErr
+	}
+	if length < 0 || length > self.maxBulkLength {
+		return nil, errors.New(ServeErrProtocol, "invalid bulk length")
+	}
+	if self.unauthenticated && length > unauthenticatedMaxBulkLength {
+		return nil, errors.New(ServeErrProtocol, "unauthenticated bulk length")
+	}
+
+	// The bulk grows as it is read, so a client cannot allocate more than it sends.
+	size := length + 2 //nolint:mnd // reason: size of the trailing \r\n
+	bulk := make([]byte, 0, min(size, bulkChunkSize))
+	for int64(len(bulk)) < size {
+		start := len(bulk)
+		bulk = append(bulk, make([]byte, min(size-int64(start), bulkChunkSize))...)
+		if _, err := io.ReadFull(self.reader, bulk[start:]); err != nil {
+			return nil, errors.NewFromError(ServeErrClosed, err)
+		}
+	}
+	if !bytes.HasSuffix(bulk, []byte("\r\n")) {
+		return nil, errors.New(ServeErrProtocol, "bulk string is not terminated by \\r\\n")
+	}
+
+	return bulk[:length], nil
+}
+
+func (self *respReader) readInteger() (int64, *errors.Error[ServeErr]) {
+	line, err := self.readLine(32) //nolint:mnd // reason: longer than any integer
+	if err != nil {
+		return 0, err
+	}
+
+	value, parseErr := strconv.ParseInt(string(line), 10, 64)
+	if parseErr != nil {
+		return 0, errors.New(ServeErrProtocol, "invalid length: %q", line)
+	}
+	return value, nil
+}
+
+// readLine terminated by \r\n, or by \n for inline commands sent by hand.
+func (self *respReader) readLine(maxLength int) ([]byte, *errors.Error[ServeErr]) {
+	var line []byte
+	for {
+		chunk, err := self.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLength {
+			return nil, errors.New(ServeErrProtocol, "too big inline request")
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, errors.NewFromError(ServeErrClosed, err)
+		}
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), nil
+}
+
+// respWriter writes replies in the protocol version negotiated by the client.
+// Types that only exist in RESP3 are written as their closest RESP2 equivalent.
+// Write errors are kept by the buffered writer and returned on flush.
+type respWriter struct {
+	writer   *bufio.Writer
+	protocol int
+}
+
+func (self *respWriter) simpleString(value string) {
+	self.line('+', value)
+}
+
+// error reply. The message must begin with an error code, such as "ERR".
+func (self *respWriter) error(message string) {
+	self.line('-', sanitize(message))
+}
+
+func (self *respWriter) integer(value int64) {
+	self.line(':', strconv.FormatInt(value, 10))
+}
+
+func (self *respWriter) bulk(value []byte) {
+	self.header('$', len(value))
+	_, _ = self.writer.Write(value)
+	_, _ = self.writer.WriteString("\r\n")
+}
+
+func (self *respWriter) bulkString(value string) {
+	self.header('$', len(value))
+	_, _ = self.writer.WriteString(value)
+	_, _ = self.writer.WriteString("\r\n")
+}
+
+// null bulk string.
+func (self *respWriter) null() {
+	if self.protocol == protocolResp3 {
+		_, _ = self.writer.WriteString("_\r\n")
+		return
+	}
+	_, _ = self.writer.WriteString("$-1\r\n")
+}
+
+// array header followed by length replies.
+func (self *respWriter) array(length int) {
+	self.header('*', length)
+}
+
+// push header followed by length replies, of an out-of-band reply such as a published message. RESP2 writes an array.
+func (self *respWriter) push(length int) {
+	if self.protocol == protocolResp3 {
+		self.header('>', length)
+		return
+	}
+	self.array(length)
+}
+
+// mapHeader followed by length key and value pairs. RESP2 writes a flat array of the pairs.
+func (self *respWriter) mapHeader(length int) {
+	if self.protocol == protocolResp3 {
+		self.header('%', length)
+		return
+	}
+	self.header('*', 2*length) //nolint:mnd // reason: key and value
+}
+
+// double is written as a bulk string in RESP2.
+func (self *respWriter) double(value float64) {
+	var formatted string
+	switch {
+	case math.IsInf(value, 1):
+		formatted = "inf"
+	case math.IsInf(value, -1):
+		formatted = "-inf"
+	default:
+		formatted = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	if self.protocol == protocolResp3 {
+		self.line(',', formatted)
+		return
+	}
+	self.bulkString(formatted)
+}
+
+// verbatim text, such as INFO. This is a bulk string in RESP2.
+func (self *respWriter) verbatim(value string) {
+	if self.protocol == protocolResp3 {
+		self.header('=', len(value)+4) //nolint:mnd // reason: size of the "txt:" format prefix
+		_, _ = self.writer.WriteString("txt:")
+		_, _ = self.writer.WriteString(value)
+		_, _ = self.writer.WriteString("\r\n")
+		return
+	}
+	self.bulkString(value)
+}
+
+func (self *respWriter) header(prefix byte, length int) {
+	self.line(prefix, strconv.Itoa(length))
+}
+
+func (self *respWriter) line(prefix byte, value string) {
+	_ = self.writer.WriteByte(prefix)
+	_, _ = self.writer.WriteString(value)
+	_, _ = self.writer.WriteString("\r\n")
+}
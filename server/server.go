@@ -0,0 +1,403 @@
+// Package server serves a datkey database over the Redis serialization protocol (RESP2 and RESP3),
+// so that redis-cli and existing redis clients can be pointed at it over TCP or Unix sockets.
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type ServeErr errors.Cause
+
+const (
+	ServeErrInternal = ServeErr(iota + 1)
+	// ServeErrClosed is returned once the server or connection is closed.
+	ServeErrClosed
+	// ServeErrProtocol is returned when a client sends data that is not valid RESP.
+	ServeErrProtocol
+)
+
+const (
+	defaultMaxBulkLength = 512 * 1024 * 1024
+
+	bufferSize = 16 * 1024
+)
+
+type Config struct {
+	// MaxBulkLength, in bytes, of each argument of a command. Clients that have not authenticated are limited to 16KiB
+	// and 10 arguments.
+	// Default: 512MiB
+	MaxBulkLength int64
+
+	// IdleTimeout after which a connection that has not sent a command is closed.
+	// Default: None (0, connections are never closed)
+	IdleTimeout time.Duration
+
+	// ErrorHandler is called with any error accepting or serving a connection, other than clients disconnecting.
+	// Default: errors are ignored
+	ErrorHandler func(err error)
+
+	// ACL of the users that clients authenticate as, which decides the commands and keys each client may access.
+	// Clients are authenticated as the default user on connect, if it has no password.
+	// Default: None (nil, every client may run every command on every key)
+	ACL *acl.ACL
+
+	// PrimaryUsername and PrimaryPassword to authenticate with the primary as, once the server replicates from one.
+	// Default: None (the primary is not authenticated with)
+	PrimaryUsername string
+	PrimaryPassword string
+
+	// PrimaryTLSConfig to encrypt the connection to the primary with.
+	// Default: None (nil, the connection is not encrypted)
+	PrimaryTLSConfig *tls.Config
+
+	// ClusterAddress that clients and other nodes reach the server at, such as "10.0.0.1:6379". It is replied for
+	// the slots the server owns in CLUSTER SLOTS, and names the server in CLUSTER SETSLOT NODE.
+	// Default: the local address of the connection of each client
+	ClusterAddress string
+}
+
+type Server struct {
+	db        datkey.Store
+	commands  map[string]commandSpec
+	startTime time.Time
+	config    Config
+
+	mutex     sync.Mutex
+	listeners map[net.Listener]struct{}
+	clients   map[*client]struct{}
+	closed    bool
+	serving   sync.WaitGroup
+
+	// tracking of the keys read by clients, for CLIENT TRACKING.
+	tracking *tracking
+
+	nextClientID      atomic.Int64
+	connections       atomic.Int64
+	commandsProcessed atomic.Int64
+}
+
+// New server for the database, which is usually a *datkey.Datkey. The database is not closed by the server.
+func New(db datkey.Store, config Config) *Server {
+	if config.MaxBulkLength == 0 {
+		config.MaxBulkLength = defaultMaxBulkLength
+	}
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(error) {}
+	}
+
+	return &Server{
+		db:                db,
+		commands:          newCommandTable(),
+		startTime:         time.Now(),
+		config:            config,
+		mutex:             sync.Mutex{},
+		listeners:         map[net.Listener]struct{}{},
+		clients:           map[*client]struct{}{},
+		closed:            false,
+		serving:           sync.WaitGroup{},
+		tracking:          newTracking(config.ACL),
+		nextClientID:      atomic.Int64{},
+		connections:       atomic.Int64{},
+		commandsProcessed: atomic.Int64{},
+	}
+}
+
+// ListenAndServe on a network address, such as "tcp" and ":6379" or "unix" and "/run/datkey.sock".
+func (self *Server) ListenAndServe(network string, address string) *errors.Error[ServeErr] {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return errors.NewFromError(ServeErrInternal, err)
+	}
+
+	return self.Serve(listener)
+}
+
+// Serve connections accepted from the listener until the server is closed, returning ServeErrClosed.
+// The listener is closed when Serve returns.
+func (self *Server) Serve(listener net.Listener) *errors.Error[ServeErr] {
+	if !self.trackListener(listener) {
+		_ = listener.Close()
+		return errors.New(ServeErrClosed, "server closed")
+	}
+	defer self.untrackListener(listener)
+
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			if self.isClosed() {
+				return errors.New(ServeErrClosed, "server closed")
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				self.config.ErrorHandler(err)
+				continue
+			}
+			return errors.NewFromError(ServeErrInternal, err)
+		}
+
+		client := self.newClient(netConn)
+		if !self.trackClient(client) {
+			_ = netConn.Close()
+			return errors.New(ServeErrClosed, "server closed")
+		}
+
+		go func() {
+			defer self.untrackClient(client)
+			self.serveClient(client)
+		}()
+	}
+}
+
+// ServeConn serves a single connection until it is closed, such as one end of a net.Pipe for an embedded server.
+func (self *Server) ServeConn(netConn net.Conn) {
+	client := self.newClient(netConn)
+	if !self.trackClient(client) {
+		_ = netConn.Close()
+		return
+	}
+	defer self.untrackClient(client)
+
+	self.serveClient(client)
+}
+
+// Close all listeners and connections, waiting for commands in progress to complete.
+func (self *Server) Close() {
+	self.mutex.Lock()
+	self.closed = true
+	for listener := range self.listeners {
+		_ = listener.Close()
+	}
+	for client := range self.clients {
+		_ = client.netConn.Close()
+	}
+	self.mutex.Unlock()
+
+	self.tracking.close()
+	self.serving.Wait()
+}
+
+func (self *Server) isClosed() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.closed
+}
+
+func (self *Server) trackListener(listener net.Listener) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.closed {
+		return false
+	}
+	self.listeners[listener] = struct{}{}
+	return true
+}
+
+func (self *Server) untrackListener(listener net.Listener) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	_ = listener.Close()
+	delete(self.listeners, listener)
+}
+
+func (self *Server) trackClient(client *client) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.closed {
+		return false
+	}
+	self.clients[client] = struct{}{}
+	self.serving.Add(1)
+	self.connections.Add(1)
+	return true
+}
+
+func (self *Server) untrackClient(client *client) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	_ = client.netConn.Close()
+	client.cancel()
+	if client.subscription != nil {
+		client.subscription.Close()
+	}
+	self.tracking.disconnect(client)
+	delete(self.clients, client)
+	self.connections.Add(-1)
+	self.serving.Done()
+}
+
+// client connection and the state negotiated by it.
+type client struct {
+	// ctx of the commands of the client, canceled once the connection is closed.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	netConn net.Conn
+	reader  respReader
+	writer  respWriter
+	id      int64
+	name    string
+	// user the client is authenticated as, if ACLs are enabled. Empty until the client authenticates.
+	user string
+	// quit once the replies to the current commands are written.
+	quit bool
+	// asking runs the next command as asked by the source of an importing slot, after ASKING.
+	asking bool
+	// subscription to channels, once the client has subscribed, whose messages are written by another goroutine.
+	subscription *datkey.Subscription
+	// trackingReads records the keys read by the client for CLIENT TRACKING, which is not needed when broadcasting.
+	trackingReads bool
+	// untracked once the client disconnects, after which it is not sent invalidation messages. Guarded by the mutex of
+	// the tracking of the server.
+	untracked bool
+	// writing guards the writer, which the messages of the subscription and invalidation messages are written to
+	// between replies.
+	writing sync.Mutex
+}
+
+func (self *Server) newClient(netConn net.Conn) *client {
+	var user string
+	if self.config.ACL != nil && self.config.ACL.Authenticate(acl.DefaultUser, "") == nil {
+		user = acl.DefaultUser
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &client{
+		ctx:     ctx,
+		cancel:  cancel,
+		netConn: netConn,
+		reader: respReader{
+			reader:          bufio.NewReaderSize(netConn, bufferSize),
+			maxBulkLength:   self.config.MaxBulkLength,
+			unauthenticated: self.config.ACL != nil && user == "",
+		},
+		writer: respWriter{
+			writer:   bufio.NewWriterSize(netConn, bufferSize),
+			protocol: protocolResp2,
+		},
+		id:            self.nextClientID.Add(1),
+		name:          "",
+		user:          user,
+		quit:          false,
+		asking:        false,
+		subscription:  nil,
+		trackingReads: false,
+		untracked:     false,
+		writing:       sync.Mutex{},
+	}
+}
+
+func (self *Server) serveClient(client *client) {
+	if tlsConn, isTLS := client.netConn.(*tls.Conn); isTLS && !self.handshake(client, tlsConn) {
+		return
+	}
+
+	for {
+		if self.config.IdleTimeout != 0 {
+			_ = client.netConn.SetReadDeadline(time.Now().Add(self.config.IdleTimeout))
+		}
+
+		args, err := client.reader.readCommand()
+		if err != nil {
+			if err.Cause == ServeErrProtocol {
+				client.writing.Lock()
+				client.writer.error("ERR Protocol error: " + err.Error())
+				_ = client.writer.writer.Flush()
+				client.writing.Unlock()
+				self.config.ErrorHandler(err)
+			}
+			return
+		}
+
+		client.writing.Lock()
+		self.runCommand(client, args)
+
+		// Pipelined commands that have already been received are answered before the replies are flushed.
+		var flushErr error
+		if client.reader.reader.Buffered() == 0 || client.quit {
+			flushErr = client.writer.writer.Flush()
+		}
+		client.writing.Unlock()
+
+		if flushErr != nil {
+			if !self.isClosed() {
+				self.config.ErrorHandler(flushErr)
+			}
+			return
+		}
+
+		if client.quit {
+			return
+		}
+	}
+}
+
+func (self *Server) runCommand(client *client, args [][]byte) {
+	self.commandsProcessed.Add(1)
+
+	name := strings.ToLower(string(args[0]))
+	if client.asking && name != "asking" {
+		client.asking = false
+		ctx := client.ctx
+		client.ctx = datkey.Asking(ctx)
+		defer func() {
+			client.ctx = ctx
+		}()
+	}
+	spec, exists := self.commands[name]
+	if !exists {
+		client.writer.error("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+
+	if client.writer.protocol == protocolResp2 && !subscribedCommands[name] && client.subscribed() {
+		client.writer.error("ERR Can't execute '" + name + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+		return
+	}
+
+	if (spec.arity > 0 && len(args) != spec.arity) || (spec.arity < 0 && len(args) < -spec.arity) {
+		client.writer.error("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+
+	if self.config.ACL != nil {
+		if client.user == "" && name != "auth" && name != "hello" && name != "quit" {
+			client.writer.error("NOAUTH Authentication required.")
+			return
+		}
+		if spec.category != "" {
+			if err := self.config.ACL.Check(client.user, spec.category, spec.keys(args)...); err != nil {
+				client.writer.error("NOPERM " + sanitize(err.Error()))
+				return
+			}
+		}
+	}
+
+	if client.trackingReads && spec.category == acl.CategoryRead {
+		// Keys are tracked before they are read, so that a change made while reading them is not missed.
+		self.tracking.read(client.id, spec.keys(args))
+	}
+
+	spec.handler(self, client, args)
+}
+
+// sanitize text from a client or an error so that it can be written as a simple string or error.
+func sanitize(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
@@ -0,0 +1,191 @@
+package server_test
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/server"
+)
+
+func startServer(t *testing.T, network string, address string) net.Addr {
+	t.Helper()
+
+	return startServerWithConfig(t, network, address, server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     nil,
+		ACL:              nil,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+}
+
+func startServerWithConfig(t *testing.T, network string, address string, serverConfig server.Config) net.Addr {
+	t.Helper()
+
+	var config datkey.Config
+	return serveDatabase(t, config, network, address, serverConfig)
+}
+
+// serveDatabase created with the config, until the test ends.
+func serveDatabase(t *testing.T, config datkey.Config, network string, address string, serverConfig server.Config) net.Addr {
+	t.Helper()
+
+	db := datkey.New(config)
+	t.Cleanup(db.Close)
+
+	srv := server.New(db, serverConfig)
+	t.Cleanup(srv.Close)
+
+	listener, err := net.Listen(network, address)
+	require.NoError(t, err)
+
+	go func() {
+		err := srv.Serve(listener)
+		assert.Equal(t, server.ServeErrClosed, err.Cause)
+	}()
+
+	return listener.Addr()
+}
+
+// roundTrip sends raw commands and reads exactly the expected raw replies.
+func roundTrip(t *testing.T, conn net.Conn, request string, expected string) {
+	t.Helper()
+
+	_, err := conn.Write([]byte(request))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	reply := make([]byte, len(expected))
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err, "read %q", reply)
+	assert.Equal(t, expected, string(reply))
+}
+
+func dial(t *testing.T, addr net.Addr) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func TestServer_strings(t *testing.T) {
+	t.Parallel()
+
+	conn := dial(t, startServer(t, "tcp", "127.0.0.1:0"))
+
+	roundTrip(t, conn, "*1\r\n$4\r\nPING\r\n", "+PONG\r\n")
+	roundTrip(t, conn, "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", "$-1\r\n")
+	roundTrip(t, conn, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", "+OK\r\n")
+	roundTrip(t, conn, "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", "$5\r\nvalue\r\n")
+	roundTrip(t, conn, "*4\r\n$3\r\nSET\r\n$3\r\nkey\r\n$3\r\nnew\r\n$3\r\nGET\r\n", "$5\r\nvalue\r\n")
+	roundTrip(t, conn, "*2\r\n$3\r\nTTL\r\n$3\r\nkey\r\n", ":-1\r\n")
+	roundTrip(t, conn, "*3\r\n$6\r\nEXPIRE\r\n$3\r\nkey\r\n$3\r\n100\r\n", ":1\r\n")
+	roundTrip(t, conn, "*2\r\n$3\r\nTTL\r\n$3\r\nkey\r\n", ":100\r\n")
+	roundTrip(t, conn, "*2\r\n$7\r\nPERSIST\r\n$3\r\nkey\r\n", ":1\r\n")
+	roundTrip(t, conn, "*2\r\n$7\r\nPERSIST\r\n$3\r\nkey\r\n", ":0\r\n")
+	roundTrip(t, conn, "*3\r\n$6\r\nEXISTS\r\n$3\r\nkey\r\n$7\r\nmissing\r\n", ":1\r\n")
+	roundTrip(t, conn, "*3\r\n$3\r\nDEL\r\n$3\r\nkey\r\n$7\r\nmissing\r\n", ":1\r\n")
+	roundTrip(t, conn, "*2\r\n$3\r\nTTL\r\n$3\r\nkey\r\n", ":-2\r\n")
+	roundTrip(t, conn, "SET key value\r\n", "+OK\r\n")
+	roundTrip(t, conn, "GETDEL key\r\n", "$5\r\nvalue\r\n")
+	roundTrip(t, conn, "GETDEL key\r\n", "$-1\r\n")
+	roundTrip(t, conn, "ZADD zset 1 a\r\n", ":1\r\n")
+	roundTrip(t, conn, "GETDEL zset\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	roundTrip(t, conn, "EXISTS zset\r\n", ":1\r\n")
+}
+
+func TestServer_errors(t *testing.T) {
+	t.Parallel()
+
+	conn := dial(t, startServer(t, "tcp", "127.0.0.1:0"))
+
+	roundTrip(t, conn, "*1\r\n$7\r\nUNKNOWN\r\n", "-ERR unknown command 'UNKNOWN'\r\n")
+	roundTrip(t, conn, "*1\r\n$3\r\nGET\r\n", "-ERR wrong number of arguments for 'get' command\r\n")
+	roundTrip(t, conn, "*4\r\n$4\r\nZADD\r\n$4\r\nzset\r\n$1\r\n1\r\n$1\r\na\r\n", ":1\r\n")
+	roundTrip(t, conn, "*2\r\n$3\r\nGET\r\n$4\r\nzset\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	roundTrip(t, conn, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", "+OK\r\n")
+
+	// Bulk strings larger than a read are read in full.
+	large := strings.Repeat("v", 200*1024)
+	roundTrip(t, conn, "*3\r\n$3\r\nSET\r\n$5\r\nlarge\r\n$204800\r\n"+large+"\r\n", "+OK\r\n")
+	roundTrip(t, conn, "GET large\r\n", "$204800\r\n"+large+"\r\n")
+
+	// A protocol error closes the connection.
+	roundTrip(t, conn, "*1\r\n$x\r\n", "-ERR Protocol error: invalid length: \"x\"\r\n")
+	_, err := conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_pipelining(t *testing.T) {
+	t.Parallel()
+
+	conn := dial(t, startServer(t, "tcp", "127.0.0.1:0"))
+
+	roundTrip(t, conn,
+		"*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n"+
+			"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n"+
+			"*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n"+
+			"PING\r\n",
+		"+OK\r\n+OK\r\n*2\r\n$1\r\n1\r\n$1\r\n2\r\n+PONG\r\n")
+}
+
+func TestServer_inline(t *testing.T) {
+	t.Parallel()
+
+	conn := dial(t, startServer(t, "tcp", "127.0.0.1:0"))
+
+	roundTrip(t, conn, "SET key value\r\n", "+OK\r\n")
+	roundTrip(t, conn, "\r\nGET key\n", "$5\r\nvalue\r\n")
+}
+
+func TestServer_Hello(t *testing.T) {
+	t.Parallel()
+
+	conn := dial(t, startServer(t, "tcp", "127.0.0.1:0"))
+
+	roundTrip(t, conn, "HELLO 4\r\n", "-NOPROTO unsupported protocol version\r\n")
+	roundTrip(t, conn, "HELLO 3 SETNAME test\r\n",
+		"%7\r\n"+
+			"$6\r\nserver\r\n$6\r\ndatkey\r\n"+
+			"$7\r\nversion\r\n$5\r\n7.2.0\r\n"+
+			"$5\r\nproto\r\n:3\r\n"+
+			"$2\r\nid\r\n:1\r\n"+
+			"$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+			"$4\r\nrole\r\n$6\r\nmaster\r\n"+
+			"$7\r\nmodules\r\n*0\r\n")
+	roundTrip(t, conn, "CLIENT GETNAME\r\n", "$4\r\ntest\r\n")
+
+	// RESP3 replies with its own null and double types.
+	roundTrip(t, conn, "GET missing\r\n", "_\r\n")
+	roundTrip(t, conn, "ZADD zset 1.5 a\r\n", ":1\r\n")
+	roundTrip(t, conn, "ZSCORE zset a\r\n", ",1.5\r\n")
+	roundTrip(t, conn, "ZRANGEBYSCORE zset -inf +inf WITHSCORES\r\n", "*1\r\n*2\r\n$1\r\na\r\n,1.5\r\n")
+
+	roundTrip(t, conn, "HELLO 2\r\n", "*14\r\n")
+}
+
+func TestServer_unix(t *testing.T) {
+	t.Parallel()
+
+	conn := dial(t, startServer(t, "unix", filepath.Join(t.TempDir(), "datkey.sock")))
+
+	roundTrip(t, conn, "PING hello\r\n", "$5\r\nhello\r\n")
+	roundTrip(t, conn, "QUIT\r\n", "+OK\r\n")
+	_, err := conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
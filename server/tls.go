@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+const defaultHandshakeTimeout = 10 * time.Second
+
+// ListenAndServeTLS on a network address, encrypting connections with the TLS config.
+func (self *Server) ListenAndServeTLS(network string, address string, config *tls.Config) *errors.Error[ServeErr] {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return errors.NewFromError(ServeErrInternal, err)
+	}
+
+	return self.ServeTLS(listener, config)
+}
+
+// ServeTLS connections accepted from the listener, encrypting them with the TLS config.
+//
+// If the config verifies client certificates and ACLs are enabled, a client that presents a verified certificate is
+// authenticated as the user named by the common name of the certificate, if that user exists and is enabled.
+// Otherwise, the client authenticates with AUTH as usual.
+func (self *Server) ServeTLS(listener net.Listener, config *tls.Config) *errors.Error[ServeErr] {
+	return self.Serve(tls.NewListener(listener, config))
+}
+
+// handshake a TLS connection before any command is read, authenticating the client by its certificate.
+// Returns false if the handshake fails.
+func (self *Server) handshake(client *client, tlsConn *tls.Conn) bool {
+	timeout := defaultHandshakeTimeout
+	if self.config.IdleTimeout != 0 {
+		timeout = self.config.IdleTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		if !self.isClosed() {
+			self.config.ErrorHandler(errors.NewFromError(ServeErrProtocol, err))
+		}
+		return false
+	}
+
+	state := tlsConn.ConnectionState()
+	if self.config.ACL == nil || len(state.VerifiedChains) == 0 {
+		return true
+	}
+
+	// Certificates that were presented but not verified, such as with tls.RequestClientCert, are ignored.
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	if self.config.ACL.AuthenticateVerified(name) == nil {
+		client.user = name
+		client.reader.unauthenticated = false
+	}
+	return true
+}
+
+// CertificateReloader serves a certificate and key from files, reloading them when they change, so that certificates
+// can be rotated without restarting the server. Use GetCertificate as tls.Config.GetCertificate.
+type CertificateReloader struct {
+	certificate *tls.Certificate
+	certFile    string
+	keyFile     string
+	// modified times of the files when they were last loaded.
+	certModified time.Time
+	keyModified  time.Time
+	mutex        sync.RWMutex
+}
+
+// NewCertificateReloader loading the PEM encoded certificate and key files.
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, *errors.Error[ServeErr]) {
+	reloader := &CertificateReloader{
+		certificate:  nil,
+		certFile:     certFile,
+		keyFile:      keyFile,
+		certModified: time.Time{},
+		keyModified:  time.Time{},
+		mutex:        sync.RWMutex{},
+	}
+
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload the certificate and key files. If they cannot be loaded, the previous certificate is kept.
+func (self *CertificateReloader) Reload() *errors.Error[ServeErr] {
+	certModified, keyModified := modifiedTime(self.certFile), modifiedTime(self.keyFile)
+
+	certificate, err := tls.LoadX509KeyPair(self.certFile, self.keyFile)
+	if err != nil {
+		return errors.NewFromError(ServeErrInternal, err)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.certificate = &certificate
+	self.certModified = certModified
+	self.keyModified = keyModified
+	return nil
+}
+
+// GetCertificate for a TLS handshake.
+func (self *CertificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return self.certificate, nil
+}
+
+// Watch the files for changes, checking every interval and reloading once either has been modified, until the context is done.
+// Errors reloading are passed to the error handler and retried on the next change.
+func (self *CertificateReloader) Watch(ctx context.Context, interval time.Duration, errorHandler func(err error)) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				self.mutex.RLock()
+				changed := !modifiedTime(self.certFile).Equal(self.certModified) || !modifiedTime(self.keyFile).Equal(self.keyModified)
+				self.mutex.RUnlock()
+
+				if changed {
+					if err := self.Reload(); err != nil {
+						errorHandler(err)
+					}
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
+// modifiedTime of a file, or the zero time if it cannot be read.
+func modifiedTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,238 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+	"github.com/wspowell/datkey/server"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// newTestCertificate signed by the parent, or self-signed if the parent is nil.
+func newTestCertificate(t *testing.T, commonName string, serial int64, parent *testCertificate) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{ //nolint:exhaustruct // reason: test certificate
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: commonName}, //nolint:exhaustruct // reason: test certificate
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+	}
+}
+
+func (self *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{ //nolint:exhaustruct // reason: test certificate
+		Certificate: [][]byte{self.certificate.Raw},
+		PrivateKey:  self.key,
+	}
+}
+
+func (self *testCertificate) writeFiles(t *testing.T, certFile string, keyFile string) {
+	t.Helper()
+
+	keyDer, err := x509.MarshalECPrivateKey(self.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Headers: nil, Bytes: self.certificate.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Headers: nil, Bytes: keyDer}), 0o600))
+}
+
+func startTLSServer(t *testing.T, users *acl.ACL, config *tls.Config) net.Addr {
+	t.Helper()
+
+	var dbConfig datkey.Config
+	db := datkey.New(dbConfig)
+	t.Cleanup(db.Close)
+
+	srv := server.New(db, server.Config{
+		MaxBulkLength:    0,
+		IdleTimeout:      0,
+		ErrorHandler:     func(error) {},
+		ACL:              users,
+		PrimaryUsername:  "",
+		PrimaryPassword:  "",
+		PrimaryTLSConfig: nil,
+		ClusterAddress:   "",
+	})
+	t.Cleanup(srv.Close)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		err := srv.ServeTLS(listener, config)
+		assert.Equal(t, server.ServeErrClosed, err.Cause)
+	}()
+
+	return listener.Addr()
+}
+
+func dialTLS(t *testing.T, addr net.Addr, rootCAs *x509.CertPool, certificates ...tls.Certificate) *tls.Conn {
+	t.Helper()
+
+	conn, err := tls.Dial(addr.Network(), addr.String(), &tls.Config{ //nolint:exhaustruct // reason: defaults for every other setting
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      rootCAs,
+		Certificates: certificates,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func TestServer_TLS(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCertificate(t, "datkey test CA", 1, nil)
+	otherCA := newTestCertificate(t, "other CA", 2, nil)
+	serverCert := newTestCertificate(t, "127.0.0.1", 3, ca)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.certificate)
+
+	users := acl.New()
+	require.Nil(t, users.SetUser(acl.DefaultUser, "off"))
+	require.Nil(t, users.SetUser("alice", "on", ">secret", "allkeys", "+@all"))
+	require.Nil(t, users.SetUser("bob", "off", "allkeys", "+@all"))
+
+	addr := startTLSServer(t, users, &tls.Config{ //nolint:exhaustruct // reason: defaults for every other setting
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{serverCert.tlsCertificate()},
+		ClientCAs:    rootCAs,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+
+	// A verified client certificate authenticates as the user of its common name.
+	{
+		conn := dialTLS(t, addr, rootCAs, newTestCertificate(t, "alice", 4, ca).tlsCertificate())
+		roundTrip(t, conn, "ACL WHOAMI\r\n", "$5\r\nalice\r\n")
+		roundTrip(t, conn, "PING\r\n", "+PONG\r\n")
+	}
+
+	// Without a certificate, or with a certificate of a disabled user, clients authenticate with AUTH.
+	{
+		conn := dialTLS(t, addr, rootCAs)
+		roundTrip(t, conn, "PING\r\n", "-NOAUTH Authentication required.\r\n")
+		roundTrip(t, conn, "AUTH alice secret\r\n", "+OK\r\n")
+		roundTrip(t, conn, "PING\r\n", "+PONG\r\n")
+
+		conn = dialTLS(t, addr, rootCAs, newTestCertificate(t, "bob", 5, ca).tlsCertificate())
+		roundTrip(t, conn, "PING\r\n", "-NOAUTH Authentication required.\r\n")
+	}
+
+	// Certificates that are not signed by the CA are rejected.
+	{
+		certificate := newTestCertificate(t, "alice", 6, otherCA).tlsCertificate()
+		conn, err := tls.Dial(addr.Network(), addr.String(), &tls.Config{ //nolint:exhaustruct // reason: defaults for every other setting
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    rootCAs,
+			// Send the certificate even though the server does not accept its issuer.
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &certificate, nil
+			},
+		})
+		if err == nil {
+			defer conn.Close()
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			// With TLS 1.3, the server rejects the certificate after the client considers the handshake complete.
+			_, err = conn.Write([]byte("PING\r\n"))
+			if err == nil {
+				_, err = conn.Read(make([]byte, 1))
+			}
+		}
+		require.Error(t, err)
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	ca := newTestCertificate(t, "datkey test CA", 1, nil)
+	newTestCertificate(t, "127.0.0.1", 2, ca).writeFiles(t, certFile, keyFile)
+
+	reloader, err := server.NewCertificateReloader(certFile, keyFile)
+	require.Nil(t, err)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.certificate)
+
+	addr := startTLSServer(t, nil, &tls.Config{ //nolint:exhaustruct // reason: defaults for every other setting
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	})
+
+	serial := func() int64 {
+		conn := dialTLS(t, addr, rootCAs)
+		roundTrip(t, conn, "PING\r\n", "+PONG\r\n")
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	assert.Equal(t, int64(2), serial())
+
+	// An invalid certificate keeps the previous one.
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	require.NotNil(t, reloader.Reload())
+	assert.Equal(t, int64(2), serial())
+
+	// Changed files are reloaded by the watcher.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := reloader.Watch(ctx, 10*time.Millisecond, func(error) {})
+	newTestCertificate(t, "127.0.0.1", 3, ca).writeFiles(t, certFile, keyFile)
+	// Modification times may be coarse, so make sure the rewritten files look changed.
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+
+	assert.Eventually(t, func() bool {
+		return serial() == 3
+	}, 5*time.Second, 20*time.Millisecond)
+
+	cancel()
+	<-done
+}
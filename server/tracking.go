@@ -0,0 +1,383 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/acl"
+)
+
+const (
+	// invalidateChannel that redirected invalidation messages are sent as messages of, as by Redis.
+	invalidateChannel = "__redis__:invalidate"
+	// trackingBufferSize of the keyspace events waiting to be sent as invalidation messages. Once it is full, every
+	// tracking client is told to flush its cache rather than the events being dropped silently.
+	trackingBufferSize = 4096
+	// invalidationQueueSize of the invalidation messages waiting to be written to a client. A client that falls this
+	// far behind is disconnected, since dropping a message would leave it reading stale values.
+	invalidationQueueSize = 1024
+)
+
+// watching databases emit an event for every change to a key, such as *datkey.Datkey, which client tracking sends
+// invalidation messages for.
+type watching interface {
+	WatchKeyspace(bufferSize int, eventTypes ...datkey.KeyspaceEventType) *datkey.KeyspaceWatcher
+}
+
+// trackingOptions of a client, set by CLIENT TRACKING ON.
+type trackingOptions struct {
+	// redirect invalidation messages to another client, or nil to send them to the client itself.
+	redirect *client
+	// bcast invalidates every key starting with one of the prefixes, or every key if there are none, rather than the
+	// keys read by the client.
+	bcast    bool
+	prefixes []string
+	// user the client was authenticated as when it enabled tracking, which may only be sent the keys it may access.
+	user string
+}
+
+// trackedClient that is sent invalidation messages.
+type trackedClient struct {
+	options trackingOptions
+	// recipient of the invalidation messages, which is the client itself unless they are redirected.
+	recipient *client
+	// keys read by the client, so that they are forgotten once the client stops tracking.
+	keys map[string]struct{}
+}
+
+// invalidation message queued to be written to a client.
+type invalidation struct {
+	// keys invalidated, or nil to invalidate every key.
+	keys []string
+	// redirected messages are written as messages of the invalidate channel.
+	redirected bool
+}
+
+// tracking of the clients that are sent invalidation messages once keys change.
+type tracking struct {
+	acl   *acl.ACL
+	mutex sync.Mutex
+	// watcher of the keyspace, started once a client first enables tracking.
+	watcher *datkey.KeyspaceWatcher
+	closed  bool
+	clients map[int64]*trackedClient
+	// keys read by each client that does not broadcast. A key is forgotten once it is invalidated, until it is read
+	// again, or once the client stops tracking.
+	keys map[string]map[int64]struct{}
+	// queues of the invalidation messages of each recipient, which are written to it by a goroutine of its own so that
+	// a slow client does not delay the messages of the others.
+	queues map[*client]chan invalidation
+}
+
+func newTracking(users *acl.ACL) *tracking {
+	return &tracking{
+		acl:     users,
+		mutex:   sync.Mutex{},
+		watcher: nil,
+		closed:  false,
+		clients: map[int64]*trackedClient{},
+		keys:    map[string]map[int64]struct{}{},
+		queues:  map[*client]chan invalidation{},
+	}
+}
+
+// enable tracking for the client, watching the keyspace of the database if nobody was tracking before.
+// Returns the watcher if it was started, which the caller must send invalidation messages for.
+func (self *tracking) enable(db watching, client *client, options trackingOptions) *datkey.KeyspaceWatcher {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.disableClient(client.id)
+	recipient := client
+	if options.redirect != nil {
+		recipient = options.redirect
+	}
+	self.clients[client.id] = &trackedClient{
+		options:   options,
+		recipient: recipient,
+		keys:      map[string]struct{}{},
+	}
+	if _, exists := self.queues[recipient]; !exists && !recipient.untracked {
+		queue := make(chan invalidation, invalidationQueueSize)
+		self.queues[recipient] = queue
+		go recipient.writeInvalidations(queue)
+	}
+
+	if self.watcher != nil || self.closed {
+		return nil
+	}
+	self.watcher = db.WatchKeyspace(trackingBufferSize)
+	return self.watcher
+}
+
+// disable tracking for the client, forgetting the keys it read.
+func (self *tracking) disable(id int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.disableClient(id)
+}
+
+// disconnect the client, which is no longer tracking nor sent invalidation messages of the clients that redirected
+// them to it.
+func (self *tracking) disconnect(client *client) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.disableClient(client.id)
+	client.untracked = true
+	if queue, exists := self.queues[client]; exists {
+		close(queue)
+		delete(self.queues, client)
+	}
+}
+
+// disableClient forgets the keys read by the client. Must hold the mutex.
+func (self *tracking) disableClient(id int64) {
+	tracked, exists := self.clients[id]
+	if !exists {
+		return
+	}
+	for key := range tracked.keys {
+		delete(self.keys[key], id)
+		if len(self.keys[key]) == 0 {
+			delete(self.keys, key)
+		}
+	}
+	delete(self.clients, id)
+}
+
+// read keys by a client, which is sent an invalidation message once any of them changes.
+func (self *tracking) read(id int64, keys []string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	tracked, isTracking := self.clients[id]
+	if !isTracking {
+		return
+	}
+	for _, key := range keys {
+		if self.keys[key] == nil {
+			self.keys[key] = map[int64]struct{}{}
+		}
+		self.keys[key][id] = struct{}{}
+		tracked.keys[key] = struct{}{}
+	}
+}
+
+// invalidate the key for the clients that read it, and the clients broadcasting its prefix.
+func (self *tracking) invalidate(key string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	keys := []string{key}
+	for id := range self.keys[key] {
+		if tracked, isTracking := self.clients[id]; isTracking {
+			delete(tracked.keys, key)
+			self.send(tracked, keys)
+		}
+	}
+	delete(self.keys, key)
+
+	for _, tracked := range self.clients {
+		if !tracked.options.bcast || !hasAnyPrefix(key, tracked.options.prefixes) {
+			continue
+		}
+		if self.acl != nil && !self.acl.AllowsKey(tracked.options.user, key) {
+			// Broadcasting must not reveal the keys of other namespaces, as with keyspace events.
+			continue
+		}
+		self.send(tracked, keys)
+	}
+}
+
+// flush every tracked key, telling every tracking client to flush every key it has read.
+func (self *tracking) flush() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	clear(self.keys)
+	for _, tracked := range self.clients {
+		clear(tracked.keys)
+		self.send(tracked, nil)
+	}
+}
+
+// send an invalidation message of the keys to the recipient of the tracked client, without waiting. A recipient whose
+// queue is full is disconnected, and then reconnects with nothing cached. Must hold the mutex.
+func (self *tracking) send(tracked *trackedClient, keys []string) {
+	queue, exists := self.queues[tracked.recipient]
+	if !exists {
+		return
+	}
+
+	select {
+	case queue <- invalidation{keys: keys, redirected: tracked.options.redirect != nil}:
+	default:
+		close(queue)
+		delete(self.queues, tracked.recipient)
+		_ = tracked.recipient.netConn.Close()
+	}
+}
+
+// close the watcher, after which tracking cannot be enabled again.
+func (self *tracking) close() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.closed = true
+	if self.watcher != nil {
+		self.watcher.Close()
+	}
+}
+
+// hasAnyPrefix if the key starts with any of the prefixes, or there are none.
+func hasAnyPrefix(key string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandClientTracking sends the client invalidation messages once the keys it reads change, so that it can cache
+// them: CLIENT TRACKING ON|OFF [REDIRECT id] [BCAST] [PREFIX prefix ...].
+func (self *Server) commandClientTracking(client *client, args [][]byte) {
+	if len(args) < 3 { //nolint:mnd // reason: client tracking on|off
+		client.writer.error("ERR wrong number of arguments for 'client|tracking' command")
+		return
+	}
+
+	switch strings.ToLower(string(args[2])) {
+	case "on":
+	case "off":
+		self.tracking.disable(client.id)
+		client.trackingReads = false
+		client.writer.simpleString("OK")
+		return
+	default:
+		client.writer.error("ERR syntax error")
+		return
+	}
+
+	db, isWatching := self.db.(watching)
+	if !isWatching {
+		client.writer.error("ERR the database does not support client tracking")
+		return
+	}
+
+	var options trackingOptions
+	for index := 3; index < len(args); index++ {
+		option := strings.ToLower(string(args[index]))
+		switch {
+		case option == "bcast":
+			options.bcast = true
+		case option == "redirect" && index+1 < len(args):
+			index++
+			id, err := strconv.ParseInt(string(args[index]), 10, 64)
+			if err != nil {
+				client.writer.error("ERR value is not an integer or out of range")
+				return
+			}
+			if options.redirect = self.clientByID(id); options.redirect == nil {
+				client.writer.error("ERR The client ID you want redirect to does not exist")
+				return
+			}
+		case option == "prefix" && index+1 < len(args):
+			index++
+			options.prefixes = append(options.prefixes, string(args[index]))
+		default:
+			client.writer.error("ERR syntax error")
+			return
+		}
+	}
+
+	if len(options.prefixes) != 0 && !options.bcast {
+		client.writer.error("ERR PREFIX option requires BCAST mode to be enabled")
+		return
+	}
+	if options.redirect == nil && client.writer.protocol == protocolResp2 {
+		// Invalidation messages could not be told apart from the replies of a RESP2 client.
+		client.writer.error("ERR Tracking without REDIRECT requires RESP3, see HELLO 3")
+		return
+	}
+
+	options.user = client.user
+	if watcher := self.tracking.enable(db, client, options); watcher != nil {
+		go self.writeInvalidations(watcher)
+	}
+	client.trackingReads = !options.bcast
+	client.writer.simpleString("OK")
+}
+
+// writeInvalidations of the keys changed in the keyspace to the clients tracking them, until the watcher is closed,
+// which happens when the server is closed.
+func (self *Server) writeInvalidations(watcher *datkey.KeyspaceWatcher) {
+	var dropped int64
+	for event := range watcher.Events() {
+		if watcher.Dropped() != dropped {
+			// Events were dropped, so any key may have changed.
+			dropped = watcher.Dropped()
+			self.tracking.flush()
+			continue
+		}
+		self.tracking.invalidate(event.Key)
+	}
+}
+
+// writeInvalidations queued for the client until the queue is closed, once the client disconnects or falls behind.
+func (self *client) writeInvalidations(queue <-chan invalidation) {
+	for message := range queue {
+		self.writing.Lock()
+		if !message.redirected {
+			self.writer.push(2) //nolint:mnd // reason: kind and keys
+			self.writer.bulkString("invalidate")
+			self.writeInvalidatedKeys(message.keys)
+		} else if self.writer.protocol == protocolResp3 || self.subscribed() {
+			// Redirected invalidation messages are received as messages of the invalidate channel, which a RESP2
+			// client must be subscribed to for them to be told apart from its replies.
+			self.writer.push(3) //nolint:mnd // reason: kind, channel and keys
+			self.writer.bulkString("message")
+			self.writer.bulkString(invalidateChannel)
+			self.writeInvalidatedKeys(message.keys)
+		}
+
+		// Messages that have already been queued are written before the messages are flushed. A failed flush means
+		// the connection is closed, which its own goroutine handles.
+		if len(queue) == 0 {
+			_ = self.writer.writer.Flush()
+		}
+		self.writing.Unlock()
+	}
+}
+
+// writeInvalidatedKeys as an array, or a null to invalidate every key.
+func (self *client) writeInvalidatedKeys(keys []string) {
+	if keys == nil {
+		self.writer.null()
+		return
+	}
+	self.writer.array(len(keys))
+	for _, key := range keys {
+		self.writer.bulkString(key)
+	}
+}
+
+// clientByID of a connected client, or nil if it is no longer connected.
+func (self *Server) clientByID(id int64) *client {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for client := range self.clients {
+		if client.id == id {
+			return client
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package server_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ClientTracking(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t, "tcp", "127.0.0.1:0")
+	tracker := dial(t, addr)
+	roundTrip(t, tracker, "HELLO 3\r\n",
+		"%7\r\n"+
+			"$6\r\nserver\r\n$6\r\ndatkey\r\n"+
+			"$7\r\nversion\r\n$5\r\n7.2.0\r\n"+
+			"$5\r\nproto\r\n:3\r\n"+
+			"$2\r\nid\r\n:1\r\n"+
+			"$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+			"$4\r\nrole\r\n$6\r\nmaster\r\n"+
+			"$7\r\nmodules\r\n*0\r\n")
+	writer := dial(t, addr)
+
+	roundTrip(t, tracker, "CLIENT TRACKING ON\r\n", "+OK\r\n")
+	roundTrip(t, tracker, "GET key\r\n", "_\r\n")
+
+	// Keys read by the client are invalidated once they change, by any client.
+	roundTrip(t, writer, "SET key value\r\n", "+OK\r\n")
+	roundTrip(t, tracker, "", ">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nkey\r\n")
+
+	// A key is only invalidated once, until it is read again.
+	roundTrip(t, writer, "SET key other\r\n", "+OK\r\n")
+	roundTrip(t, tracker, "GET key\r\n", "$5\r\nother\r\n")
+	roundTrip(t, writer, "DEL key\r\n", ":1\r\n")
+	roundTrip(t, tracker, "", ">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nkey\r\n")
+
+	roundTrip(t, tracker, "CLIENT TRACKING OFF\r\n", "+OK\r\n")
+	roundTrip(t, tracker, "GET key\r\n", "_\r\n")
+	roundTrip(t, writer, "SET key value\r\n", "+OK\r\n")
+	roundTrip(t, tracker, "PING\r\n", "+PONG\r\n")
+}
+
+func TestServer_ClientTracking_bcast(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t, "tcp", "127.0.0.1:0")
+	redirect, tracker, writer := dial(t, addr), dial(t, addr), dial(t, addr)
+
+	roundTrip(t, redirect, "CLIENT ID\r\n", ":1\r\n")
+	roundTrip(t, redirect, "SUBSCRIBE __redis__:invalidate\r\n", "*3\r\n$9\r\nsubscribe\r\n$20\r\n__redis__:invalidate\r\n:1\r\n")
+
+	// RESP2 clients receive invalidation messages on another connection subscribed to the invalidate channel.
+	roundTrip(t, tracker, "CLIENT TRACKING ON\r\n", "-ERR Tracking without REDIRECT requires RESP3, see HELLO 3\r\n")
+	roundTrip(t, tracker, "CLIENT TRACKING ON REDIRECT 99\r\n", "-ERR The client ID you want redirect to does not exist\r\n")
+	roundTrip(t, tracker, "CLIENT TRACKING ON REDIRECT 1 PREFIX user:\r\n", "-ERR PREFIX option requires BCAST mode to be enabled\r\n")
+	roundTrip(t, tracker, "CLIENT TRACKING ON REDIRECT 1 OPTIN\r\n", "-ERR syntax error\r\n")
+	roundTrip(t, tracker, "CLIENT TRACKING ON REDIRECT 1 BCAST PREFIX user: PREFIX group:\r\n", "+OK\r\n")
+
+	// Broadcasting invalidates every key with a prefix, whether or not it was read.
+	roundTrip(t, writer, "SET user:1 value\r\n", "+OK\r\n")
+	roundTrip(t, redirect, "", "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$6\r\nuser:1\r\n")
+	roundTrip(t, writer, "SET other value\r\n", "+OK\r\n")
+	roundTrip(t, writer, "SET group:1 value\r\n", "+OK\r\n")
+	roundTrip(t, redirect, "", "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$7\r\ngroup:1\r\n")
+	roundTrip(t, writer, "PEXPIRE user:1 100000\r\n", ":1\r\n")
+	roundTrip(t, redirect, "", "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$6\r\nuser:1\r\n")
+
+	// A client may redirect the invalidation messages to itself, once it subscribes to the invalidate channel.
+	own := dial(t, addr)
+	roundTrip(t, own, "CLIENT ID\r\n", ":4\r\n")
+	roundTrip(t, own, "CLIENT TRACKING ON REDIRECT 4 BCAST PREFIX self:\r\n", "+OK\r\n")
+	roundTrip(t, own, "SUBSCRIBE __redis__:invalidate\r\n", "*3\r\n$9\r\nsubscribe\r\n$20\r\n__redis__:invalidate\r\n:1\r\n")
+	roundTrip(t, writer, "SET self:1 value\r\n", "+OK\r\n")
+	roundTrip(t, own, "", "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$6\r\nself:1\r\n")
+}
+
+func TestServer_ClientTracking_slowClient(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t, "tcp", "127.0.0.1:0")
+	stalled, tracker, writer := dial(t, addr), dial(t, addr), dial(t, addr)
+	roundTrip(t, stalled, "HELLO 3\r\nCLIENT TRACKING ON BCAST\r\n", "%7\r\n")
+	roundTrip(t, tracker, "CLIENT ID\r\nSUBSCRIBE __redis__:invalidate\r\n", ":2\r\n*3\r\n$9\r\nsubscribe\r\n$20\r\n__redis__:invalidate\r\n:1\r\n")
+	roundTrip(t, writer, "CLIENT TRACKING ON REDIRECT 2 BCAST PREFIX probe\r\n", "+OK\r\n")
+
+	// The stalled client never reads its invalidation messages, until it falls too far behind and is disconnected.
+	key := strings.Repeat("k", 1024)
+	request := "SET " + key + " value\r\n"
+	const sets = 20000
+	go func() {
+		_, _ = writer.Write([]byte(strings.Repeat(request, sets)))
+	}()
+	require.NoError(t, writer.SetReadDeadline(time.Now().Add(30*time.Second)))
+	_, err := io.ReadFull(writer, make([]byte, sets*len("+OK\r\n")))
+	require.NoError(t, err)
+
+	require.NoError(t, stalled.SetReadDeadline(time.Now().Add(30*time.Second)))
+	_, err = io.Copy(io.Discard, stalled)
+	require.NoError(t, err)
+
+	// Other clients are still sent their invalidation messages.
+	roundTrip(t, writer, "SET probe value\r\n", "+OK\r\n")
+	roundTrip(t, tracker, "", "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$5\r\nprobe\r\n")
+}
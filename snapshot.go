@@ -0,0 +1,700 @@
+package datkey
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wspowell/datkey/hash"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// Snapshots are a header followed by one section per non-empty slot and an end section:
+//
+//	header:  "DATKEY" | version (uint16)
+//	slot:    sectionSlot | slot (uvarint) | payload length (uvarint) | payload | crc32 of payload (uint32)
+//	end:     sectionEnd | number of slot sections (uvarint)
+//
+// A slot payload is the number of keys (uvarint) followed by each key:
+//
+//	key length (uvarint) | key | expiresAt in unix nanoseconds, 0 if none (varint) | value type (byte) | value
+//
+// Integers of fixed size are big endian.
+//
+// Slot exports use the same layout with the header "DKSLOT" and write the remaining ttl in nanoseconds in place of expiresAt.
+const (
+	snapshotVersion = 1
+
+	snapshotSectionSlot = 0x01
+	snapshotSectionEnd  = 0xff
+
+	snapshotTypeString       = 0x00
+	snapshotTypeSortedSet    = 0x01
+	snapshotTypeJSON         = 0x02
+	snapshotTypeBloomFilter  = 0x03
+	snapshotTypeCuckooFilter = 0x04
+
+	snapshotFileMode = 0o600
+)
+
+// snapshotFormat of a stream of slot sections. Snapshots and slot exports share the same layout and differ only in their header and how expiry is written.
+type snapshotFormat struct {
+	magic []byte
+	// relativeExpiry writes the time remaining until a key expires rather than its deadline, so that the stream does not depend on the clocks of two nodes agreeing.
+	relativeExpiry bool
+}
+
+var (
+	snapshotFormatFull = snapshotFormat{ //nolint:gochecknoglobals // reason: constant format
+		magic:          []byte("DATKEY"),
+		relativeExpiry: false,
+	}
+	snapshotFormatExport = snapshotFormat{ //nolint:gochecknoglobals // reason: constant format
+		magic:          []byte("DKSLOT"),
+		relativeExpiry: true,
+	}
+)
+
+type commandSnapshotSlot struct {
+	Resp   *snapshotSlotResponse
+	Format snapshotFormat
+}
+
+type snapshotSlotResponse struct {
+	Payload []byte
+	Keys    int
+}
+
+type commandRestoreSlot struct {
+	Resp    empty
+	Entries []snapshotEntry
+	// KeepNewer keys that exist in an importing slot, since they were written after the migration began.
+	KeepNewer bool
+}
+
+type snapshotEntry struct {
+	key  string
+	data keyStorage
+}
+
+// Snapshot writes all keys to the writer.
+// Each slot is locked only while its keys are copied, so the snapshot is consistent per slot but not across slots.
+func (self *Datkey) Snapshot(writer io.Writer) *errors.Error[DbReadErr] {
+	return writeSnapshot(writer, snapshotFormatFull, self.cache.allSlots(), self.cache)
+}
+
+// Restore keys from a snapshot written by Snapshot. Restored keys replace any existing keys and keys that have already expired are skipped.
+// Each slot section is verified before it is restored, so if the snapshot is corrupt the sections before it remain restored.
+func (self *Datkey) Restore(reader io.Reader) *errors.Error[DbWriteErr] {
+	return readSnapshot(reader, snapshotFormatFull, self.cache)
+}
+
+func writeSnapshot(writer io.Writer, format snapshotFormat, slots hash.Range, cache cacheStorage) *errors.Error[DbReadErr] {
+	buffered := bufio.NewWriter(writer)
+
+	header := binary.BigEndian.AppendUint16(bytes.Clone(format.magic), snapshotVersion)
+	if _, err := buffered.Write(header); err != nil {
+		return errors.NewFromError(DbReadInternal, err)
+	}
+
+	var sections uint64
+	for hashSlot := slots.Begin; hashSlot <= slots.End && hashSlot < cache.slotCount(); hashSlot++ {
+		resp := &snapshotSlotResponse{
+			Payload: nil,
+			Keys:    0,
+		}
+
+		cache.runCommand(hashSlot, commandSnapshotSlot{
+			Resp:   resp,
+			Format: format,
+		})
+
+		if resp.Keys == 0 {
+			continue
+		}
+
+		section := []byte{snapshotSectionSlot}
+		section = binary.AppendUvarint(section, uint64(hashSlot))
+		section = binary.AppendUvarint(section, uint64(len(resp.Payload)))
+		if _, err := buffered.Write(section); err != nil {
+			return errors.NewFromError(DbReadInternal, err)
+		}
+		if _, err := buffered.Write(resp.Payload); err != nil {
+			return errors.NewFromError(DbReadInternal, err)
+		}
+		if _, err := buffered.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(resp.Payload))); err != nil {
+			return errors.NewFromError(DbReadInternal, err)
+		}
+		sections++
+	}
+
+	if _, err := buffered.Write(binary.AppendUvarint([]byte{snapshotSectionEnd}, sections)); err != nil {
+		return errors.NewFromError(DbReadInternal, err)
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return errors.NewFromError(DbReadInternal, err)
+	}
+
+	return nil
+}
+
+func readSnapshot(reader io.Reader, format snapshotFormat, cache cacheStorage) *errors.Error[DbWriteErr] {
+	return readSnapshotSections(bufio.NewReader(reader), format, cache, nil)
+}
+
+// readSnapshotSections reads a snapshot from a buffered reader, leaving any data after the snapshot unread.
+// The entries of each slot are appended to staging, to be restored later, or restored at once if staging is nil.
+func readSnapshotSections(buffered *bufio.Reader, format snapshotFormat, cache cacheStorage, staging map[hash.Slot][]snapshotEntry) *errors.Error[DbWriteErr] {
+	header := make([]byte, len(format.magic)+2) //nolint:mnd // reason: size of the version
+	if _, err := io.ReadFull(buffered, header); err != nil {
+		return errors.New(DbWriteInvalidArgument, "invalid snapshot header: %v", err)
+	}
+	if !bytes.Equal(header[:len(format.magic)], format.magic) {
+		return errors.New(DbWriteInvalidArgument, "invalid snapshot header")
+	}
+	if version := binary.BigEndian.Uint16(header[len(format.magic):]); version != snapshotVersion {
+		return errors.New(DbWriteInvalidArgument, "unsupported snapshot version: %d", version)
+	}
+
+	var sections uint64
+	for {
+		sectionType, err := buffered.ReadByte()
+		if err != nil {
+			return errors.New(DbWriteInvalidArgument, "truncated snapshot: %v", err)
+		}
+
+		switch sectionType {
+		case snapshotSectionSlot:
+			if err := readSnapshotSlot(buffered, format, cache, staging); err != nil {
+				return err
+			}
+			sections++
+		case snapshotSectionEnd:
+			expectedSections, err := binary.ReadUvarint(buffered)
+			if err != nil {
+				return errors.New(DbWriteInvalidArgument, "truncated snapshot: %v", err)
+			}
+			if expectedSections != sections {
+				return errors.New(DbWriteInvalidArgument, "snapshot has %d slot sections, expected %d", sections, expectedSections)
+			}
+			return nil
+		default:
+			return errors.New(DbWriteInvalidArgument, "invalid snapshot section: %d", sectionType)
+		}
+	}
+}
+
+func readSnapshotSlot(reader *bufio.Reader, format snapshotFormat, cache cacheStorage, staging map[hash.Slot][]snapshotEntry) *errors.Error[DbWriteErr] {
+	if _, err := binary.ReadUvarint(reader); err != nil {
+		return errors.New(DbWriteInvalidArgument, "truncated snapshot: %v", err)
+	}
+
+	payloadLength, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return errors.New(DbWriteInvalidArgument, "truncated snapshot: %v", err)
+	}
+
+	// Read in chunks so that a corrupt length cannot allocate more than the snapshot holds.
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, reader, int64(payloadLength)); err != nil { //nolint:gosec // reason: overflow results in a failed read
+		return errors.New(DbWriteInvalidArgument, "truncated snapshot: %v", err)
+	}
+
+	checksum := make([]byte, 4) //nolint:mnd // reason: size of a crc32
+	if _, err := io.ReadFull(reader, checksum); err != nil {
+		return errors.New(DbWriteInvalidArgument, "truncated snapshot: %v", err)
+	}
+	if binary.BigEndian.Uint32(checksum) != crc32.ChecksumIEEE(payload.Bytes()) {
+		return errors.New(DbWriteInvalidArgument, "snapshot checksum mismatch")
+	}
+
+	entries, decodeErr := decodeSnapshotPayload(payload.Bytes(), format)
+	if decodeErr != nil {
+		return decodeErr
+	}
+
+	// Keys are routed by their own slot rather than the slot of the section.
+	slotEntries := map[hash.Slot][]snapshotEntry{}
+	for _, entry := range entries {
+		hashSlot := cache.slotOf(entry.key)
+		slotEntries[hashSlot] = append(slotEntries[hashSlot], entry)
+	}
+	if staging != nil {
+		for hashSlot, entries := range slotEntries {
+			staging[hashSlot] = append(staging[hashSlot], entries...)
+		}
+		return nil
+	}
+	for hashSlot, entries := range slotEntries {
+		cache.runCommand(hashSlot, commandRestoreSlot{
+			Resp:      empty{},
+			Entries:   entries,
+			KeepNewer: format.relativeExpiry,
+		})
+	}
+
+	return nil
+}
+
+func (self *slotStorage) handleCommandSnapshotSlot(cmd commandSnapshotSlot) {
+	var payload []byte
+	var keys int
+	for key, data := range self.storage {
+		if data.isExpired() {
+			continue
+		}
+
+		payload = appendSnapshotEntry(payload, key, data, cmd.Format)
+		keys++
+	}
+
+	cmd.Resp.Payload = binary.AppendUvarint(nil, uint64(keys)) //nolint:gosec // reason: count is never negative
+	cmd.Resp.Payload = append(cmd.Resp.Payload, payload...)
+	cmd.Resp.Keys = keys
+}
+
+func (self *slotStorage) handleCommandRestoreSlot(cmd commandRestoreSlot) {
+	for _, entry := range cmd.Entries {
+		if cmd.KeepNewer && self.migration.state == SlotImporting {
+			if _, exists := self.lookupKey(entry.key); exists {
+				continue
+			}
+		}
+
+		previousData := self.storage[entry.key]
+		entry.data.lastAccessTime = time.Now()
+		self.storeKey(entry.key, previousData.sizeInBytes(), entry.data)
+	}
+}
+
+func appendSnapshotEntry(payload []byte, key string, data keyStorage, format snapshotFormat) []byte {
+	payload = appendSnapshotBytes(payload, []byte(key))
+
+	var expiresAt int64
+	if !data.expiresAt.IsZero() {
+		if format.relativeExpiry {
+			// Zero means no expiry, so a key on the verge of expiring keeps the smallest ttl.
+			expiresAt = max(int64(time.Until(data.expiresAt)), 1)
+		} else {
+			expiresAt = data.expiresAt.UnixNano()
+		}
+	}
+	payload = binary.AppendVarint(payload, expiresAt)
+
+	switch object := data.object.(type) {
+	case nil:
+		payload = append(payload, snapshotTypeString)
+		payload = appendSnapshotBytes(payload, data.value)
+	case *sortedSet:
+		payload = append(payload, snapshotTypeSortedSet)
+		payload = binary.AppendUvarint(payload, uint64(object.len())) //nolint:gosec // reason: length is never negative
+		for member, score := range object.scores {
+			payload = appendSnapshotBytes(payload, []byte(member))
+			payload = binary.BigEndian.AppendUint64(payload, math.Float64bits(score))
+		}
+	case *jsonDocument:
+		payload = append(payload, snapshotTypeJSON)
+		payload = appendSnapshotBytes(payload, encodeJSON(object.root))
+	case *bloomFilter:
+		payload = append(payload, snapshotTypeBloomFilter)
+		payload = binary.BigEndian.AppendUint64(payload, math.Float64bits(object.config.ErrorRate))
+		payload = binary.AppendVarint(payload, object.config.Capacity)
+		payload = binary.AppendVarint(payload, object.config.Expansion)
+		payload = appendSnapshotBool(payload, object.config.NonScaling)
+		payload = binary.AppendUvarint(payload, uint64(len(object.layers)))
+		for _, layer := range object.layers {
+			payload = binary.AppendUvarint(payload, layer.numBits)
+			payload = binary.AppendUvarint(payload, layer.hashes)
+			payload = binary.AppendVarint(payload, layer.capacity)
+			payload = binary.AppendVarint(payload, layer.count)
+			payload = binary.BigEndian.AppendUint64(payload, math.Float64bits(layer.errorRate))
+			for _, word := range layer.bits {
+				payload = binary.BigEndian.AppendUint64(payload, word)
+			}
+		}
+	case *cuckooFilter:
+		payload = append(payload, snapshotTypeCuckooFilter)
+		payload = binary.BigEndian.AppendUint64(payload, math.Float64bits(object.config.ErrorRate))
+		payload = binary.AppendVarint(payload, object.config.Capacity)
+		payload = binary.AppendVarint(payload, object.config.BucketSize)
+		payload = binary.AppendVarint(payload, object.config.MaxIterations)
+		payload = binary.AppendVarint(payload, object.config.Expansion)
+		payload = binary.AppendUvarint(payload, uint64(object.fingerprintBits)) //nolint:gosec // reason: fingerprint bits are never negative
+		payload = binary.AppendUvarint(payload, uint64(len(object.layers)))
+		for _, layer := range object.layers {
+			payload = binary.AppendUvarint(payload, layer.bucketMask)
+			payload = binary.AppendUvarint(payload, layer.bucketSize)
+			for _, fingerprint := range layer.fingerprints {
+				payload = binary.BigEndian.AppendUint16(payload, fingerprint)
+			}
+		}
+	default:
+		// This should never be hit and would indicate an internal library issue, so trigger a panic.
+		panic(fmt.Sprintf("unexpected object type: %T", object))
+	}
+
+	return payload
+}
+
+func appendSnapshotBytes(payload []byte, value []byte) []byte {
+	payload = binary.AppendUvarint(payload, uint64(len(value)))
+	return append(payload, value...)
+}
+
+func appendSnapshotBool(payload []byte, value bool) []byte {
+	if value {
+		return append(payload, 1)
+	}
+	return append(payload, 0)
+}
+
+// snapshotDecoder reads from a slot payload. The first error is kept and all later reads return zero values.
+type snapshotDecoder struct {
+	err     *errors.Error[DbWriteErr]
+	payload []byte
+}
+
+func (self *snapshotDecoder) fail() {
+	if self.err == nil {
+		self.err = errors.New(DbWriteInvalidArgument, "invalid snapshot payload")
+	}
+	self.payload = nil
+}
+
+func (self *snapshotDecoder) uvarint() uint64 {
+	value, size := binary.Uvarint(self.payload)
+	if size <= 0 {
+		self.fail()
+		return 0
+	}
+	self.payload = self.payload[size:]
+	return value
+}
+
+func (self *snapshotDecoder) varint() int64 {
+	value, size := binary.Varint(self.payload)
+	if size <= 0 {
+		self.fail()
+		return 0
+	}
+	self.payload = self.payload[size:]
+	return value
+}
+
+// count reads a number of items that each take at least itemSize bytes, failing if the payload is too short to hold them.
+func (self *snapshotDecoder) count(itemSize int) int {
+	value := self.uvarint()
+	if value > uint64(len(self.payload)/itemSize) {
+		self.fail()
+		return 0
+	}
+	return int(value) //nolint:gosec // reason: bounded by the payload length
+}
+
+func (self *snapshotDecoder) bytes() []byte {
+	length := self.count(1)
+	value := bytes.Clone(self.payload[:length])
+	self.payload = self.payload[length:]
+	return value
+}
+
+func (self *snapshotDecoder) byte() byte {
+	if len(self.payload) < 1 {
+		self.fail()
+		return 0
+	}
+	value := self.payload[0]
+	self.payload = self.payload[1:]
+	return value
+}
+
+func (self *snapshotDecoder) uint16() uint16 {
+	if len(self.payload) < 2 { //nolint:mnd // reason: size of a uint16
+		self.fail()
+		return 0
+	}
+	value := binary.BigEndian.Uint16(self.payload)
+	self.payload = self.payload[2:]
+	return value
+}
+
+func (self *snapshotDecoder) uint64() uint64 {
+	if len(self.payload) < 8 { //nolint:mnd // reason: size of a uint64
+		self.fail()
+		return 0
+	}
+	value := binary.BigEndian.Uint64(self.payload)
+	self.payload = self.payload[8:]
+	return value
+}
+
+func (self *snapshotDecoder) float64() float64 {
+	return math.Float64frombits(self.uint64())
+}
+
+func decodeSnapshotPayload(payload []byte, format snapshotFormat) ([]snapshotEntry, *errors.Error[DbWriteErr]) {
+	decoder := &snapshotDecoder{
+		err:     nil,
+		payload: payload,
+	}
+
+	count := decoder.count(1)
+	entries := make([]snapshotEntry, 0, count)
+	for range count {
+		entry := decodeSnapshotEntry(decoder, format)
+		if decoder.err != nil {
+			return nil, decoder.err
+		}
+
+		if entry.data.isExpired() {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if decoder.err == nil && len(decoder.payload) != 0 {
+		decoder.fail()
+	}
+
+	return entries, decoder.err
+}
+
+// decodeSnapshotEntry written by appendSnapshotEntry. The entry is invalid if the decoder has an error.
+func decodeSnapshotEntry(decoder *snapshotDecoder, format snapshotFormat) snapshotEntry {
+	key := string(decoder.bytes())
+
+	var expiresAt time.Time
+	if expiry := decoder.varint(); expiry != 0 {
+		if format.relativeExpiry {
+			expiresAt = time.Now().Add(time.Duration(expiry))
+		} else {
+			expiresAt = time.Unix(0, expiry)
+		}
+	}
+
+	data := keyStorage{
+		lastAccessTime: time.Now(),
+		expiresAt:      expiresAt,
+		value:          nil,
+		object:         nil,
+		valueShared:    false,
+	}
+
+	switch valueType := decoder.byte(); valueType {
+	case snapshotTypeString:
+		data.value = decoder.bytes()
+	case snapshotTypeSortedSet:
+		data.object = decodeSnapshotSortedSet(decoder)
+	case snapshotTypeJSON:
+		root, err := decodeJSON(decoder.bytes())
+		if err != nil {
+			decoder.fail()
+		}
+		data.object = newJSONDocument(root)
+	case snapshotTypeBloomFilter:
+		data.object = decodeSnapshotBloomFilter(decoder)
+	case snapshotTypeCuckooFilter:
+		data.object = decodeSnapshotCuckooFilter(decoder)
+	default:
+		decoder.fail()
+	}
+
+	return snapshotEntry{
+		key:  key,
+		data: data,
+	}
+}
+
+func decodeSnapshotSortedSet(decoder *snapshotDecoder) *sortedSet {
+	set := newSortedSet()
+	members := decoder.count(1 + 8) //nolint:mnd // reason: minimum size of a member and its score
+	for range members {
+		member := string(decoder.bytes())
+		score := decoder.float64()
+		if math.IsNaN(score) {
+			decoder.fail()
+		}
+		if decoder.err != nil {
+			return nil
+		}
+		set.add(member, score)
+	}
+	return set
+}
+
+func decodeSnapshotBloomFilter(decoder *snapshotDecoder) *bloomFilter {
+	filter := &bloomFilter{
+		layers: nil,
+		config: BloomConfig{
+			ErrorRate:  decoder.float64(),
+			Capacity:   decoder.varint(),
+			Expansion:  decoder.varint(),
+			NonScaling: decoder.byte() != 0,
+		},
+	}
+	// Filters are scaled with the config, so it must be as valid as the config of a filter reserved.
+	if filter.config.validate() != nil {
+		decoder.fail()
+	}
+
+	layers := decoder.count(1)
+	if layers == 0 {
+		decoder.fail()
+	}
+	for range layers {
+		layer := &bloomLayer{
+			bits:      nil,
+			numBits:   decoder.uvarint(),
+			hashes:    decoder.uvarint(),
+			capacity:  decoder.varint(),
+			count:     decoder.varint(),
+			errorRate: decoder.float64(),
+		}
+		if layer.numBits == 0 || (layer.numBits+63)/64 > uint64(len(decoder.payload)/8) { //nolint:mnd // reason: size of a uint64
+			decoder.fail()
+		}
+		if layer.hashes == 0 || layer.capacity < 1 || layer.capacity > bloomMaxCapacity || !(0 < layer.errorRate && layer.errorRate < 1) {
+			decoder.fail()
+		}
+		if decoder.err != nil {
+			return nil
+		}
+
+		layer.bits = make([]uint64, (layer.numBits+63)/64)
+		for index := range layer.bits {
+			layer.bits[index] = decoder.uint64()
+		}
+		filter.layers = append(filter.layers, layer)
+	}
+
+	return filter
+}
+
+func decodeSnapshotCuckooFilter(decoder *snapshotDecoder) *cuckooFilter {
+	filter := &cuckooFilter{
+		layers: nil,
+		config: CuckooConfig{
+			ErrorRate:     decoder.float64(),
+			Capacity:      decoder.varint(),
+			BucketSize:    decoder.varint(),
+			MaxIterations: decoder.varint(),
+			Expansion:     decoder.varint(),
+		},
+		fingerprintBits: int(decoder.uvarint()), //nolint:gosec // reason: validated below
+	}
+	if filter.fingerprintBits < 1 || filter.fingerprintBits > cuckooMaxFingerprintBits || filter.config.validate() != nil {
+		decoder.fail()
+	}
+
+	layers := decoder.count(1)
+	if layers == 0 {
+		decoder.fail()
+	}
+	for range layers {
+		layer := &cuckooLayer{
+			fingerprints: nil,
+			bucketMask:   decoder.uvarint(),
+			bucketSize:   decoder.uvarint(),
+		}
+		// The number of buckets must be a power of two.
+		numBuckets := layer.bucketMask + 1
+		if numBuckets&layer.bucketMask != 0 || layer.bucketSize == 0 || layer.bucketSize != uint64(filter.config.BucketSize) || numBuckets > uint64(len(decoder.payload)/2)/layer.bucketSize { //nolint:mnd,gosec // reason: size of a uint16, bucket size is validated
+			decoder.fail()
+		}
+		if decoder.err != nil {
+			return nil
+		}
+
+		layer.fingerprints = make([]uint16, numBuckets*layer.bucketSize)
+		for index := range layer.fingerprints {
+			layer.fingerprints[index] = decoder.uint16()
+		}
+		filter.layers = append(filter.layers, layer)
+	}
+
+	return filter
+}
+
+// writeSnapshotFile atomically replaces the file at path with a new snapshot.
+func writeSnapshotFile(path string, cache cacheStorage) *errors.Error[DbReadErr] {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return errors.NewFromError(DbReadInternal, err)
+	}
+	defer os.Remove(file.Name()) //nolint:errcheck // reason: the file no longer exists once renamed
+
+	if snapshotErr := writeSnapshot(file, snapshotFormatFull, cache.allSlots(), cache); snapshotErr != nil {
+		_ = file.Close()
+		return snapshotErr
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return errors.NewFromError(DbReadInternal, err)
+	}
+	if err := file.Close(); err != nil {
+		return errors.NewFromError(DbReadInternal, err)
+	}
+	if err := os.Chmod(file.Name(), snapshotFileMode); err != nil {
+		return errors.NewFromError(DbReadInternal, err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return errors.NewFromError(DbReadInternal, err)
+	}
+
+	return nil
+}
+
+// readSnapshotFile restores the snapshot at path, if it exists.
+func readSnapshotFile(path string, cache cacheStorage) *errors.Error[DbWriteErr] {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.NewFromError(DbWriteInternal, err)
+	}
+	defer file.Close()
+
+	return readSnapshot(file, snapshotFormatFull, cache)
+}
+
+func startSnapshotWorker(ctx context.Context, config Config, cache cacheStorage) <-chan struct{} {
+	done := make(chan struct{})
+	if config.SnapshotPath == "" || config.SnapshotInterval == 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.SnapshotInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Take a final snapshot so that a clean shutdown loses nothing.
+				if err := writeSnapshotFile(config.SnapshotPath, cache); err != nil {
+					config.PersistenceErrorHandler(err)
+				}
+				close(done)
+				return
+			case <-ticker.C:
+				if err := writeSnapshotFile(config.SnapshotPath, cache); err != nil {
+					config.PersistenceErrorHandler(err)
+				}
+			}
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,201 @@
+package datkey_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_Snapshot_Restore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	client.Set(ctx, "string", []byte("value"), 0)
+	client.Set(ctx, "ttl", []byte("value"), time.Hour)
+	client.Set(ctx, "expiring", []byte("value"), 50*time.Millisecond)
+	_, err := client.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1}, datkey.ZMember{Member: "b", Score: 2})
+	require.Nil(t, err)
+	_, err = client.JSONSet(ctx, "json", "$", []byte(`{"a":[1,2]}`), datkey.JSONSetAlways)
+	require.Nil(t, err)
+	_, err = client.BFAdd(ctx, "bloom", []byte("a"))
+	require.Nil(t, err)
+	require.Nil(t, client.CFAdd(ctx, "cuckoo", []byte("a")))
+	_, err = client.PFAdd(ctx, "hll", []byte("a"), []byte("b"))
+	require.Nil(t, err)
+
+	var snapshot bytes.Buffer
+	require.Nil(t, client.Snapshot(&snapshot))
+
+	time.Sleep(100 * time.Millisecond)
+
+	restored := datkey.New(config)
+	defer restored.Close()
+
+	require.Nil(t, restored.Restore(bytes.NewReader(snapshot.Bytes())))
+
+	{
+		result, err := restored.Get(ctx, "string")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("value"), result.Value)
+	}
+
+	{
+		result, err := restored.Ttl(ctx, "ttl")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Greater(t, result.Ttl, 59*time.Minute)
+	}
+
+	{
+		// Keys that expire before the restore are skipped.
+		assert.False(t, typeOf(t, restored, "expiring").Exists)
+	}
+
+	{
+		result, err := restored.ZRangeByScore(ctx, "zset", datkey.ScoreRange{Min: 0, Max: 10, MinExclusive: false, MaxExclusive: false})
+		require.Nil(t, err)
+		assert.Equal(t, []datkey.ZMember{{Member: "a", Score: 1}, {Member: "b", Score: 2}}, result.Members)
+	}
+
+	{
+		result, err := restored.JSONGet(ctx, "json")
+		require.Nil(t, err)
+		assert.JSONEq(t, `[{"a":[1,2]}]`, string(result.Value))
+	}
+
+	{
+		result, err := restored.BFExists(ctx, "bloom", []byte("a"))
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+	}
+
+	{
+		result, err := restored.CFExists(ctx, "cuckoo", []byte("a"))
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+	}
+
+	{
+		result, err := restored.PFCount(ctx, "hll")
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), result.Count)
+	}
+
+	assert.Equal(t, client.Stats(ctx).DbSizeInBytes-int64(len("value")), restored.Stats(ctx).DbSizeInBytes)
+}
+
+func TestDatkey_Restore_corrupt(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	client.Set(ctx, "key", []byte("value"), 0)
+
+	var snapshot bytes.Buffer
+	require.Nil(t, client.Snapshot(&snapshot))
+
+	{
+		corrupt := bytes.Clone(snapshot.Bytes())
+		corrupt[len(corrupt)/2] ^= 0xff
+
+		err := datkey.New(config).Restore(bytes.NewReader(corrupt))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	{
+		err := datkey.New(config).Restore(bytes.NewReader(snapshot.Bytes()[:snapshot.Len()-1]))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	{
+		err := datkey.New(config).Restore(bytes.NewReader([]byte("not a snapshot")))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+}
+
+func TestDatkey_Restore_invalidCuckooFilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	require.Nil(t, client.CFAdd(ctx, "filter", []byte("item")))
+	var snapshot bytes.Buffer
+	require.Nil(t, client.Snapshot(&snapshot))
+
+	// The only section holds the filter: "DATKEY" | version | section type | slot | payload length | payload | crc32.
+	reader := bytes.NewReader(snapshot.Bytes()[9:])
+	slot, err := binary.ReadUvarint(reader)
+	require.NoError(t, err)
+	payloadLength, err := binary.ReadUvarint(reader)
+	require.NoError(t, err)
+	payloadStart := snapshot.Len() - reader.Len()
+
+	for name, replacement := range map[string][]byte{
+		"bucket size": {0x00, 0x28, 0x02},
+		"expansion":   {0x04, 0x28, 0x00},
+		"iterations":  {0x04, 0xff, 0xff, 0x7f, 0x02},
+	} {
+		payload := bytes.Clone(snapshot.Bytes()[payloadStart : payloadStart+int(payloadLength)])
+		// Bucket size 2, max iterations 20 and expansion 1, as zigzag varints.
+		offset := bytes.Index(payload, []byte{0x04, 0x28, 0x02})
+		require.NotEqual(t, -1, offset)
+		payload = append(payload[:offset:offset], append(replacement, payload[offset+3:]...)...)
+
+		corrupt := bytes.Clone(snapshot.Bytes()[:9])
+		corrupt = binary.AppendUvarint(corrupt, slot)
+		corrupt = binary.AppendUvarint(corrupt, uint64(len(payload)))
+		corrupt = append(corrupt, payload...)
+		corrupt = binary.BigEndian.AppendUint32(corrupt, crc32.ChecksumIEEE(payload))
+		corrupt = append(corrupt, snapshot.Bytes()[payloadStart+int(payloadLength)+4:]...)
+
+		err := datkey.New(config).Restore(bytes.NewReader(corrupt))
+		require.NotNil(t, err, name)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause, name)
+	}
+}
+
+func TestDatkey_SnapshotPath(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	config.SnapshotPath = filepath.Join(t.TempDir(), "datkey.snapshot")
+	config.SnapshotInterval = time.Hour
+	config.PersistenceErrorHandler = func(err error) {
+		t.Error(err)
+	}
+
+	client := datkey.New(config)
+	client.Set(ctx, "key", []byte("value"), 0)
+	// Closing takes a final snapshot.
+	client.Close()
+
+	restored := datkey.New(config)
+	defer restored.Close()
+
+	result, err := restored.Get(ctx, "key")
+	require.Nil(t, err)
+	assert.Equal(t, []byte("value"), result.Value)
+}
@@ -0,0 +1,566 @@
+package datkey
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+	// sortedSetMemberOverhead is the approximate size, in bytes, of each member besides the member itself.
+	sortedSetMemberOverhead = 8
+)
+
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreRange of sorted set scores, inclusive on both ends unless marked exclusive.
+type ScoreRange struct {
+	Min          float64
+	Max          float64
+	MinExclusive bool
+	MaxExclusive bool
+}
+
+func (self ScoreRange) containsMin(score float64) bool {
+	return self.Min < score || (!self.MinExclusive && self.Min == score)
+}
+
+func (self ScoreRange) containsMax(score float64) bool {
+	return score < self.Max || (!self.MaxExclusive && self.Max == score)
+}
+
+type commandZAdd struct {
+	Resp    *integerResponse
+	Key     string
+	Members []ZMember
+}
+
+type ZAddResponse struct {
+	// Added is the number of new members.
+	Added int64
+}
+
+type commandZRem struct {
+	Resp    *integerResponse
+	Key     string
+	Members []string
+}
+
+type ZRemResponse struct {
+	// Removed is the number of members that existed and were removed.
+	Removed int64
+}
+
+type commandZScore struct {
+	Resp   *zScoreResponse
+	Key    string
+	Member string
+}
+
+type zScoreResponse struct {
+	Score     float64
+	Exists    bool
+	WrongType bool
+}
+
+type ZScoreResponse struct {
+	Score  float64
+	Exists bool
+}
+
+type commandZCard struct {
+	Resp *integerResponse
+	Key  string
+}
+
+type ZCardResponse struct {
+	Count int64
+}
+
+type commandZRangeByScore struct {
+	Resp  *zRangeResponse
+	Key   string
+	Range ScoreRange
+}
+
+type zRangeResponse struct {
+	Members   []ZMember
+	WrongType bool
+}
+
+type ZRangeResponse struct {
+	// Members ordered by score, then by member.
+	Members []ZMember
+}
+
+// ZAdd members to the sorted set stored at key, creating it if it does not exist.
+// The score of members that already exist is updated.
+// Returns DbWriteInvalidArgument if no members are given.
+func (self *Datkey) ZAdd(ctx context.Context, key string, members ...ZMember) (ZAddResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return ZAddResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return zAddKey(key, members, self.cache.forContext(ctx))
+}
+
+// ZRem members from the sorted set stored at key. The key is deleted once the sorted set is empty.
+func (self *Datkey) ZRem(ctx context.Context, key string, members ...string) (ZRemResponse, *errors.Error[DbWriteErr]) {
+	if err := self.writeAllowed(ctx); err != nil {
+		return ZRemResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return zRemKey(key, members, self.cache.forContext(ctx))
+}
+
+// ZScore of a member in the sorted set stored at key.
+func (self *Datkey) ZScore(ctx context.Context, key string, member string) (ZScoreResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return ZScoreResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return zScoreKey(key, member, self.cache.forContext(ctx))
+}
+
+// ZCard is the number of members in the sorted set stored at key.
+func (self *Datkey) ZCard(ctx context.Context, key string) (ZCardResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return ZCardResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return zCardKey(key, self.cache.forContext(ctx))
+}
+
+// ZRangeByScore returns the members of the sorted set stored at key with scores in the range.
+func (self *Datkey) ZRangeByScore(ctx context.Context, key string, scoreRange ScoreRange) (ZRangeResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return ZRangeResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return zRangeByScoreKey(key, scoreRange, self.cache.forContext(ctx))
+}
+
+func zAddKey(key string, members []ZMember, cache cacheStorage) (ZAddResponse, *errors.Error[DbWriteErr]) {
+	// Adding nothing would create an empty sorted set.
+	if len(members) == 0 {
+		return ZAddResponse{}, errors.New(DbWriteInvalidArgument, "no members to add: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+	for _, member := range members {
+		if math.IsNaN(member.Score) {
+			return ZAddResponse{}, errors.New(DbWriteInvalidArgument, "score is not a number: %s", member.Member) //nolint:exhaustruct // reason: zero value on error
+		}
+	}
+
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandZAdd{
+		Key:     key,
+		Members: members,
+		Resp:    resp,
+	})
+	if redirect != nil {
+		return ZAddResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return ZAddResponse{}, errors.New(DbWriteWrongType, "key does not hold a sorted set: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return ZAddResponse{
+		Added: resp.Value,
+	}, nil
+}
+
+func zRemKey(key string, members []string, cache cacheStorage) (ZRemResponse, *errors.Error[DbWriteErr]) {
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandZRem{
+		Key:     key,
+		Members: members,
+		Resp:    resp,
+	})
+	if redirect != nil {
+		return ZRemResponse{}, redirect.writeErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return ZRemResponse{}, errors.New(DbWriteWrongType, "key does not hold a sorted set: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return ZRemResponse{
+		Removed: resp.Value,
+	}, nil
+}
+
+func zScoreKey(key string, member string, cache cacheStorage) (ZScoreResponse, *errors.Error[DbReadErr]) {
+	resp := &zScoreResponse{
+		Score:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandZScore{
+		Key:    key,
+		Member: member,
+		Resp:   resp,
+	})
+	if redirect != nil {
+		return ZScoreResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return ZScoreResponse{}, errors.New(DbReadWrongType, "key does not hold a sorted set: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return ZScoreResponse{
+		Score:  resp.Score,
+		Exists: resp.Exists,
+	}, nil
+}
+
+func zCardKey(key string, cache cacheStorage) (ZCardResponse, *errors.Error[DbReadErr]) {
+	resp := &integerResponse{
+		Value:     0,
+		Exists:    false,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandZCard{
+		Key:  key,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return ZCardResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return ZCardResponse{}, errors.New(DbReadWrongType, "key does not hold a sorted set: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return ZCardResponse{
+		Count: resp.Value,
+	}, nil
+}
+
+func zRangeByScoreKey(key string, scoreRange ScoreRange, cache cacheStorage) (ZRangeResponse, *errors.Error[DbReadErr]) {
+	resp := &zRangeResponse{
+		Members:   nil,
+		WrongType: false,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandZRangeByScore{
+		Key:   key,
+		Range: scoreRange,
+		Resp:  resp,
+	})
+	if redirect != nil {
+		return ZRangeResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	if resp.WrongType {
+		return ZRangeResponse{}, errors.New(DbReadWrongType, "key does not hold a sorted set: %s", key) //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return ZRangeResponse{
+		Members: resp.Members,
+	}, nil
+}
+
+// lookupSortedSet returns the stored data and sorted set for a key.
+// Returns false for wrongType if the key exists but is not a sorted set.
+func (self *slotStorage) lookupSortedSet(key string) (keyStorage, *sortedSet, bool, bool) {
+	data, exists := self.lookupKey(key)
+	if !exists {
+		return data, nil, false, false
+	}
+
+	set, ok := data.object.(*sortedSet)
+	if !ok {
+		return data, nil, true, true
+	}
+
+	return data, set, true, false
+}
+
+func (self *slotStorage) handleCommandZAdd(cmd commandZAdd) {
+	data, set, exists, wrongType := self.lookupSortedSet(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+
+	previousSize := data.sizeInBytes()
+	if !exists {
+		set = newSortedSet()
+		data = keyStorage{
+			lastAccessTime: time.Now(),
+			expiresAt:      time.Time{},
+			value:          nil,
+			object:         set,
+			valueShared:    false,
+		}
+	}
+
+	for _, member := range cmd.Members {
+		if set.add(member.Member, member.Score) {
+			cmd.Resp.Value++
+		}
+	}
+
+	self.storeKey(cmd.Key, previousSize, data)
+}
+
+func (self *slotStorage) handleCommandZRem(cmd commandZRem) {
+	data, set, exists, wrongType := self.lookupSortedSet(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	previousSize := data.sizeInBytes()
+	for _, member := range cmd.Members {
+		if set.remove(member) {
+			cmd.Resp.Value++
+		}
+	}
+
+	if set.len() == 0 {
+		self.removeKey(cmd.Key, previousSize)
+		return
+	}
+	self.storeKey(cmd.Key, previousSize, data)
+}
+
+func (self *slotStorage) handleCommandZScore(cmd commandZScore) {
+	data, set, exists, wrongType := self.lookupSortedSet(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+	cmd.Resp.Score, cmd.Resp.Exists = set.score(cmd.Member)
+}
+
+func (self *slotStorage) handleCommandZCard(cmd commandZCard) {
+	_, set, exists, wrongType := self.lookupSortedSet(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	cmd.Resp.Value = int64(set.len())
+	cmd.Resp.Exists = true
+}
+
+func (self *slotStorage) handleCommandZRangeByScore(cmd commandZRangeByScore) {
+	data, set, exists, wrongType := self.lookupSortedSet(cmd.Key)
+	if wrongType {
+		cmd.Resp.WrongType = true
+		return
+	}
+	if !exists {
+		return
+	}
+
+	data.lastAccessTime = time.Now()
+	self.storage[cmd.Key] = data
+	set.rangeByScore(cmd.Range, func(member string, score float64) bool {
+		cmd.Resp.Members = append(cmd.Resp.Members, ZMember{
+			Member: member,
+			Score:  score,
+		})
+		return true
+	})
+}
+
+// sortedSet of unique members ordered by score, and then by member for equal scores.
+type sortedSet struct {
+	scores map[string]float64
+	list   *skipList
+	size   int64
+}
+
+func newSortedSet() *sortedSet {
+	return &sortedSet{
+		scores: map[string]float64{},
+		list:   newSkipList(),
+		size:   0,
+	}
+}
+
+func (self *sortedSet) valueType() ValueType {
+	return ValueTypeSortedSet
+}
+
+func (self *sortedSet) sizeInBytes() int64 {
+	return self.size
+}
+
+func (self *sortedSet) len() int {
+	return len(self.scores)
+}
+
+// add the member with the score, updating the score if the member exists.
+// Returns true if the member is new.
+func (self *sortedSet) add(member string, score float64) bool {
+	previousScore, exists := self.scores[member]
+	if exists {
+		if previousScore == score {
+			return false
+		}
+		self.list.delete(previousScore, member)
+	} else {
+		self.size += int64(len(member)) + sortedSetMemberOverhead
+	}
+
+	self.scores[member] = score
+	self.list.insert(score, member)
+	return !exists
+}
+
+func (self *sortedSet) remove(member string) bool {
+	score, exists := self.scores[member]
+	if !exists {
+		return false
+	}
+
+	delete(self.scores, member)
+	self.list.delete(score, member)
+	self.size -= int64(len(member)) + sortedSetMemberOverhead
+	return true
+}
+
+func (self *sortedSet) score(member string) (float64, bool) {
+	score, exists := self.scores[member]
+	return score, exists
+}
+
+// rangeByScore calls fn in order for each member with a score in the range until fn returns false.
+func (self *sortedSet) rangeByScore(scoreRange ScoreRange, fn func(member string, score float64) bool) {
+	for node := self.list.first(scoreRange); node != nil && scoreRange.containsMax(node.score); node = node.next[0] {
+		if !fn(node.member, node.score) {
+			return
+		}
+	}
+}
+
+type skipListNode struct {
+	member string
+	next   []*skipListNode
+	score  float64
+}
+
+// less is true if the node sorts before the score and member.
+func (self *skipListNode) less(score float64, member string) bool {
+	return self.score < score || (self.score == score && self.member < member)
+}
+
+type skipList struct {
+	head  *skipListNode
+	level int
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head: &skipListNode{
+			member: "",
+			next:   make([]*skipListNode, skipListMaxLevel),
+			score:  0,
+		},
+		level: 1,
+	}
+}
+
+func (self *skipList) insert(score float64, member string) {
+	var update [skipListMaxLevel]*skipListNode
+	node := self.head
+	for level := self.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].less(score, member) {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+
+	newLevel := randomSkipListLevel()
+	for level := self.level; level < newLevel; level++ {
+		update[level] = self.head
+	}
+	self.level = max(self.level, newLevel)
+
+	newNode := &skipListNode{
+		member: member,
+		next:   make([]*skipListNode, newLevel),
+		score:  score,
+	}
+	for level := range newLevel {
+		newNode.next[level] = update[level].next[level]
+		update[level].next[level] = newNode
+	}
+}
+
+func (self *skipList) delete(score float64, member string) {
+	var update [skipListMaxLevel]*skipListNode
+	node := self.head
+	for level := self.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].less(score, member) {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+
+	target := node.next[0]
+	if target == nil || target.score != score || target.member != member {
+		return
+	}
+
+	for level := range self.level {
+		if update[level].next[level] != target {
+			break
+		}
+		update[level].next[level] = target.next[level]
+	}
+	for self.level > 1 && self.head.next[self.level-1] == nil {
+		self.level--
+	}
+}
+
+// first node with a score at or above the minimum of the range.
+func (self *skipList) first(scoreRange ScoreRange) *skipListNode {
+	node := self.head
+	for level := self.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && !scoreRange.containsMin(node.next[level].score) {
+			node = node.next[level]
+		}
+	}
+	return node.next[0]
+}
+
+func randomSkipListLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP { //nolint:gosec // reason: randomness does not need to be secure
+		level++
+	}
+	return level
+}
@@ -0,0 +1,212 @@
+package datkey_test
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+)
+
+func TestDatkey_ZAdd_ZScore_ZCard(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.ZAdd(ctx, "test", datkey.ZMember{Member: "a", Score: 1}, datkey.ZMember{Member: "b", Score: 2})
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), result.Added)
+	}
+
+	{
+		// Updating a score does not add a member.
+		result, err := client.ZAdd(ctx, "test", datkey.ZMember{Member: "a", Score: 3}, datkey.ZMember{Member: "c", Score: 0})
+		require.Nil(t, err)
+		assert.Equal(t, int64(1), result.Added)
+	}
+
+	{
+		result, err := client.ZScore(ctx, "test", "a")
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.InDelta(t, 3.0, result.Score, 0)
+	}
+
+	{
+		result, err := client.ZScore(ctx, "test", "missing")
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+	}
+
+	{
+		result, err := client.ZCard(ctx, "test")
+		require.Nil(t, err)
+		assert.Equal(t, int64(3), result.Count)
+	}
+
+	{
+		_, err := client.ZAdd(ctx, "test", datkey.ZMember{Member: "a", Score: math.NaN()})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+	}
+
+	{
+		_, err := client.ZAdd(ctx, "empty")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteInvalidArgument, err.Cause)
+		assert.False(t, typeOf(t, client, "empty").Exists)
+	}
+}
+
+func TestDatkey_ZRangeByScore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	for index := range 1000 {
+		_, err := client.ZAdd(ctx, "test", datkey.ZMember{Member: strconv.Itoa(index), Score: float64(index % 100)})
+		require.Nil(t, err)
+	}
+
+	{
+		result, err := client.ZRangeByScore(ctx, "test", datkey.ScoreRange{Min: 10, Max: 11, MinExclusive: false, MaxExclusive: false})
+		require.Nil(t, err)
+		require.Len(t, result.Members, 20)
+		// Equal scores are ordered by member.
+		assert.Equal(t, datkey.ZMember{Member: "10", Score: 10}, result.Members[0])
+		assert.Equal(t, datkey.ZMember{Member: "110", Score: 10}, result.Members[1])
+		assert.Equal(t, datkey.ZMember{Member: "911", Score: 11}, result.Members[19])
+	}
+
+	{
+		result, err := client.ZRangeByScore(ctx, "test", datkey.ScoreRange{Min: 10, Max: 12, MinExclusive: true, MaxExclusive: true})
+		require.Nil(t, err)
+		require.Len(t, result.Members, 10)
+		for _, member := range result.Members {
+			assert.InDelta(t, 11.0, member.Score, 0)
+		}
+	}
+
+	{
+		result, err := client.ZRangeByScore(ctx, "test", datkey.ScoreRange{Min: math.Inf(-1), Max: math.Inf(1), MinExclusive: false, MaxExclusive: false})
+		require.Nil(t, err)
+		assert.Len(t, result.Members, 1000)
+	}
+}
+
+func TestDatkey_ZRem(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, err := client.ZAdd(ctx, "test", datkey.ZMember{Member: "a", Score: 1}, datkey.ZMember{Member: "b", Score: 2})
+	require.Nil(t, err)
+
+	{
+		result, err := client.ZRem(ctx, "test", "a", "missing")
+		require.Nil(t, err)
+		assert.Equal(t, int64(1), result.Removed)
+	}
+
+	{
+		result := client.Stats(ctx)
+		assert.Equal(t, int64(len("b")+8), result.DbSizeInBytes)
+	}
+
+	{
+		// Removing the last member deletes the key.
+		result, err := client.ZRem(ctx, "test", "b")
+		require.Nil(t, err)
+		assert.Equal(t, int64(1), result.Removed)
+		assert.False(t, typeOf(t, client, "test").Exists)
+		assert.Zero(t, client.Stats(ctx).DbSizeInBytes)
+	}
+}
+
+func TestDatkey_Type(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	{
+		result, err := client.Type(ctx, "test")
+		require.Nil(t, err)
+		assert.False(t, result.Exists)
+		assert.Equal(t, datkey.ValueTypeNone, result.Type)
+	}
+
+	_, _ = client.Set(ctx, "string", []byte("value"), 0)
+	_, err := client.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1})
+	require.Nil(t, err)
+
+	assert.Equal(t, datkey.ValueTypeString, typeOf(t, client, "string").Type)
+	assert.Equal(t, datkey.ValueTypeSortedSet, typeOf(t, client, "zset").Type)
+}
+
+func TestDatkey_SortedSet_wrong_type(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var config datkey.Config
+	client := datkey.New(config)
+	defer client.Close()
+
+	_, _ = client.Set(ctx, "string", []byte("value"), 0)
+	_, err := client.ZAdd(ctx, "zset", datkey.ZMember{Member: "a", Score: 1})
+	require.Nil(t, err)
+
+	{
+		_, err := client.ZAdd(ctx, "string", datkey.ZMember{Member: "a", Score: 1})
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteWrongType, err.Cause)
+	}
+
+	{
+		_, err := client.ZScore(ctx, "string", "a")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadWrongType, err.Cause)
+	}
+
+	{
+		_, err := client.Get(ctx, "zset")
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbReadWrongType, err.Cause)
+	}
+
+	{
+		_, err := client.SetBit(ctx, "zset", 0, true)
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteWrongType, err.Cause)
+	}
+
+	{
+		_, err := client.PFAdd(ctx, "zset", []byte("a"))
+		require.NotNil(t, err)
+		assert.Equal(t, datkey.DbWriteWrongType, err.Cause)
+	}
+
+	{
+		// Set overwrites any type.
+		result, err := client.Set(ctx, "zset", []byte("value"), 0)
+		require.Nil(t, err)
+		assert.True(t, result.Exists)
+		assert.Equal(t, datkey.ValueTypeString, typeOf(t, client, "zset").Type)
+	}
+}
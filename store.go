@@ -0,0 +1,79 @@
+package datkey
+
+import (
+	"context"
+	"time"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// KeyValue commands shared by every backend, including the network client in the client package, so that code can
+// switch between the embedded database and a remote server by changing how the value is constructed.
+type KeyValue interface {
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) (SetResponse, *errors.Error[DbWriteErr])
+	Delete(ctx context.Context, key string) (DeleteResponse, *errors.Error[DbWriteErr])
+	Get(ctx context.Context, key string) (GetResponse, *errors.Error[DbReadErr])
+	Expire(ctx context.Context, key string, ttl time.Duration) (ExpireResponse, *errors.Error[DbWriteErr])
+	Persist(ctx context.Context, key string) (PersistResponse, *errors.Error[DbWriteErr])
+	Ttl(ctx context.Context, key string) (TtlResponse, *errors.Error[DbReadErr])
+	Ping(ctx context.Context) *errors.Error[DbReadErr]
+	Stats(ctx context.Context) StatsResponse
+	Close()
+}
+
+// Store of every command, implemented by Datkey and by the decorators of the store package, so that code can depend
+// on the interface and be given a mock, a namespaced view or an instrumented database instead.
+//
+// Commands check the context before they are run and return the Canceled cause if it is done.
+type Store interface {
+	KeyValue
+
+	GetDel(ctx context.Context, key string) (DeleteResponse, *errors.Error[DbWriteErr])
+	Type(ctx context.Context, key string) (TypeResponse, *errors.Error[DbReadErr])
+	Scan(ctx context.Context, cursor uint64, query ScanQuery) (ScanResponse, *errors.Error[DbReadErr])
+
+	SetBit(ctx context.Context, key string, offset int64, value bool) (SetBitResponse, *errors.Error[DbWriteErr])
+	GetBit(ctx context.Context, key string, offset int64) (GetBitResponse, *errors.Error[DbReadErr])
+	BitCount(ctx context.Context, key string) (BitCountResponse, *errors.Error[DbReadErr])
+	BitCountRange(ctx context.Context, key string, bitRange BitRange) (BitCountResponse, *errors.Error[DbReadErr])
+	BitPos(ctx context.Context, key string, bit bool) (BitPosResponse, *errors.Error[DbReadErr])
+	BitPosRange(ctx context.Context, key string, bit bool, bitRange BitRange) (BitPosResponse, *errors.Error[DbReadErr])
+	BitOp(ctx context.Context, op BitOperation, destKey string, srcKeys ...string) (BitOpResponse, *errors.Error[DbWriteErr])
+	BitField(ctx context.Context, key string, ops ...BitFieldOp) (BitFieldResponse, *errors.Error[DbWriteErr])
+
+	PFAdd(ctx context.Context, key string, elements ...[]byte) (PFAddResponse, *errors.Error[DbWriteErr])
+	PFCount(ctx context.Context, keys ...string) (PFCountResponse, *errors.Error[DbReadErr])
+	PFMerge(ctx context.Context, destKey string, srcKeys ...string) *errors.Error[DbWriteErr]
+
+	BFReserve(ctx context.Context, key string, config BloomConfig) *errors.Error[DbWriteErr]
+	BFAdd(ctx context.Context, key string, item []byte) (BFAddResponse, *errors.Error[DbWriteErr])
+	BFMAdd(ctx context.Context, key string, items ...[]byte) (BFMAddResponse, *errors.Error[DbWriteErr])
+	BFExists(ctx context.Context, key string, item []byte) (BFExistsResponse, *errors.Error[DbReadErr])
+	BFMExists(ctx context.Context, key string, items ...[]byte) (BFMExistsResponse, *errors.Error[DbReadErr])
+
+	CFReserve(ctx context.Context, key string, config CuckooConfig) *errors.Error[DbWriteErr]
+	CFAdd(ctx context.Context, key string, item []byte) *errors.Error[DbWriteErr]
+	CFDel(ctx context.Context, key string, item []byte) (CFDelResponse, *errors.Error[DbWriteErr])
+	CFExists(ctx context.Context, key string, item []byte) (CFExistsResponse, *errors.Error[DbReadErr])
+
+	GeoAdd(ctx context.Context, key string, locations ...GeoLocation) (GeoAddResponse, *errors.Error[DbWriteErr])
+	GeoPos(ctx context.Context, key string, members ...string) (GeoPosResponse, *errors.Error[DbReadErr])
+	GeoDist(ctx context.Context, key string, member1 string, member2 string, unit GeoUnit) (GeoDistResponse, *errors.Error[DbReadErr])
+	GeoHash(ctx context.Context, key string, members ...string) (GeoHashResponse, *errors.Error[DbReadErr])
+	GeoSearch(ctx context.Context, key string, query GeoSearchQuery) (GeoSearchResponse, *errors.Error[DbReadErr])
+
+	JSONSet(ctx context.Context, key string, path string, value []byte, mode JSONSetMode) (JSONSetResponse, *errors.Error[DbWriteErr])
+	JSONGet(ctx context.Context, key string, paths ...string) (JSONGetResponse, *errors.Error[DbReadErr])
+	JSONDel(ctx context.Context, key string, path string) (JSONDelResponse, *errors.Error[DbWriteErr])
+	JSONArrAppend(ctx context.Context, key string, path string, values ...[]byte) (JSONArrAppendResponse, *errors.Error[DbWriteErr])
+	JSONNumIncrBy(ctx context.Context, key string, path string, increment float64) (JSONNumIncrByResponse, *errors.Error[DbWriteErr])
+	JSONType(ctx context.Context, key string, path string) (JSONTypeResponse, *errors.Error[DbReadErr])
+
+	ZAdd(ctx context.Context, key string, members ...ZMember) (ZAddResponse, *errors.Error[DbWriteErr])
+	ZRem(ctx context.Context, key string, members ...string) (ZRemResponse, *errors.Error[DbWriteErr])
+	ZScore(ctx context.Context, key string, member string) (ZScoreResponse, *errors.Error[DbReadErr])
+	ZCard(ctx context.Context, key string) (ZCardResponse, *errors.Error[DbReadErr])
+	ZRangeByScore(ctx context.Context, key string, scoreRange ScoreRange) (ZRangeResponse, *errors.Error[DbReadErr])
+}
+
+var _ Store = (*Datkey)(nil)
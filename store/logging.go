@@ -0,0 +1,32 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/wspowell/datkey"
+)
+
+// Logging of each command to the logger once it has run: at debug level if it succeeded and at warn level with the
+// error if it failed.
+func Logging(next datkey.Store, logger *slog.Logger) datkey.Store {
+	return &decorated{
+		next:     next,
+		readOnly: false,
+		observe: func(ctx context.Context, command string, duration time.Duration, err error) {
+			if err != nil {
+				logger.LogAttrs(ctx, slog.LevelWarn, "datkey command failed",
+					slog.String("command", command),
+					slog.Duration("duration", duration),
+					slog.String("error", err.Error()),
+				)
+				return
+			}
+			logger.LogAttrs(ctx, slog.LevelDebug, "datkey command",
+				slog.String("command", command),
+				slog.Duration("duration", duration),
+			)
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/wspowell/datkey"
+)
+
+// Metrics of the commands run on a store, counted per command.
+type Metrics struct {
+	decorated
+
+	commands map[string]CommandMetrics
+	mutex    sync.Mutex
+}
+
+var _ datkey.Store = (*Metrics)(nil)
+
+// CommandMetrics of a single command.
+type CommandMetrics struct {
+	// Calls of the command, including the calls that failed.
+	Calls int64
+	// Errors returned by the command.
+	Errors int64
+	// Duration of every call in total. Divide by Calls for the mean.
+	Duration time.Duration
+}
+
+// NewMetrics counting the commands run on the next store.
+func NewMetrics(next datkey.Store) *Metrics {
+	metrics := &Metrics{
+		decorated: decorated{
+			next:     next,
+			readOnly: false,
+			observe:  nil,
+		},
+		commands: map[string]CommandMetrics{},
+		mutex:    sync.Mutex{},
+	}
+	metrics.observe = metrics.record
+
+	return metrics
+}
+
+// Snapshot of the metrics of each command that has been run, by command name such as "Get".
+func (self *Metrics) Snapshot() map[string]CommandMetrics {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return maps.Clone(self.commands)
+}
+
+func (self *Metrics) record(_ context.Context, command string, duration time.Duration, err error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	metrics := self.commands[command]
+	metrics.Calls++
+	if err != nil {
+		metrics.Errors++
+	}
+	metrics.Duration += duration
+	self.commands[command] = metrics
+}
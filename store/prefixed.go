@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/internal/glob"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// prefixed store that namespaces keys.
+type prefixed struct {
+	next   datkey.Store
+	prefix string
+}
+
+var _ datkey.Store = (*prefixed)(nil)
+
+// Prefixed view of a store, where every key is stored with the prefix, such as "tenant:1:". Keys are given and
+// returned without the prefix and keys outside of the prefix cannot be seen, so that several users can share a store.
+func Prefixed(next datkey.Store, prefix string) datkey.Store {
+	return &prefixed{
+		next:   next,
+		prefix: prefix,
+	}
+}
+
+func (self *prefixed) keys(keys []string) []string {
+	prefixedKeys := make([]string, len(keys))
+	for index, key := range keys {
+		prefixedKeys[index] = self.prefix + key
+	}
+	return prefixedKeys
+}
+
+func (self *prefixed) Ping(ctx context.Context) *errors.Error[datkey.DbReadErr] {
+	return self.next.Ping(ctx)
+}
+
+// Stats of the whole store, including keys outside of the prefix.
+func (self *prefixed) Stats(ctx context.Context) datkey.StatsResponse {
+	return self.next.Stats(ctx)
+}
+
+func (self *prefixed) Close() {
+	self.next.Close()
+}
+
+// Scan the keys with the prefix, matching the pattern of the query against the keys without the prefix.
+func (self *prefixed) Scan(ctx context.Context, cursor uint64, query datkey.ScanQuery) (datkey.ScanResponse, *errors.Error[datkey.DbReadErr]) {
+	match := query.Match
+	if match == "" {
+		match = "*"
+	}
+	query.Match = glob.Escape(self.prefix) + match
+
+	response, err := self.next.Scan(ctx, cursor, query)
+	if err != nil {
+		return response, err
+	}
+	for index, key := range response.Keys {
+		response.Keys[index] = strings.TrimPrefix(key, self.prefix)
+	}
+	return response, nil
+}
+
+func (self *prefixed) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (datkey.SetResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.Set(ctx, self.prefix+key, value, ttl)
+}
+
+func (self *prefixed) Delete(ctx context.Context, key string) (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.Delete(ctx, self.prefix+key)
+}
+
+func (self *prefixed) GetDel(ctx context.Context, key string) (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.GetDel(ctx, self.prefix+key)
+}
+
+func (self *prefixed) Get(ctx context.Context, key string) (datkey.GetResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.Get(ctx, self.prefix+key)
+}
+
+func (self *prefixed) Expire(ctx context.Context, key string, ttl time.Duration) (datkey.ExpireResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.Expire(ctx, self.prefix+key, ttl)
+}
+
+func (self *prefixed) Persist(ctx context.Context, key string) (datkey.PersistResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.Persist(ctx, self.prefix+key)
+}
+
+func (self *prefixed) Ttl(ctx context.Context, key string) (datkey.TtlResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.Ttl(ctx, self.prefix+key)
+}
+
+func (self *prefixed) Type(ctx context.Context, key string) (datkey.TypeResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.Type(ctx, self.prefix+key)
+}
+
+func (self *prefixed) SetBit(ctx context.Context, key string, offset int64, value bool) (datkey.SetBitResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.SetBit(ctx, self.prefix+key, offset, value)
+}
+
+func (self *prefixed) GetBit(ctx context.Context, key string, offset int64) (datkey.GetBitResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.GetBit(ctx, self.prefix+key, offset)
+}
+
+func (self *prefixed) BitCount(ctx context.Context, key string) (datkey.BitCountResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.BitCount(ctx, self.prefix+key)
+}
+
+func (self *prefixed) BitCountRange(ctx context.Context, key string, bitRange datkey.BitRange) (datkey.BitCountResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.BitCountRange(ctx, self.prefix+key, bitRange)
+}
+
+func (self *prefixed) BitPos(ctx context.Context, key string, bit bool) (datkey.BitPosResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.BitPos(ctx, self.prefix+key, bit)
+}
+
+func (self *prefixed) BitPosRange(ctx context.Context, key string, bit bool, bitRange datkey.BitRange) (datkey.BitPosResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.BitPosRange(ctx, self.prefix+key, bit, bitRange)
+}
+
+func (self *prefixed) BitOp(ctx context.Context, op datkey.BitOperation, destKey string, srcKeys ...string) (datkey.BitOpResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.BitOp(ctx, op, self.prefix+destKey, self.keys(srcKeys)...)
+}
+
+func (self *prefixed) BitField(ctx context.Context, key string, ops ...datkey.BitFieldOp) (datkey.BitFieldResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.BitField(ctx, self.prefix+key, ops...)
+}
+
+func (self *prefixed) PFAdd(ctx context.Context, key string, elements ...[]byte) (datkey.PFAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.PFAdd(ctx, self.prefix+key, elements...)
+}
+
+func (self *prefixed) PFCount(ctx context.Context, keys ...string) (datkey.PFCountResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.PFCount(ctx, self.keys(keys)...)
+}
+
+func (self *prefixed) PFMerge(ctx context.Context, destKey string, srcKeys ...string) *errors.Error[datkey.DbWriteErr] {
+	return self.next.PFMerge(ctx, self.prefix+destKey, self.keys(srcKeys)...)
+}
+
+func (self *prefixed) BFReserve(ctx context.Context, key string, config datkey.BloomConfig) *errors.Error[datkey.DbWriteErr] {
+	return self.next.BFReserve(ctx, self.prefix+key, config)
+}
+
+func (self *prefixed) BFAdd(ctx context.Context, key string, item []byte) (datkey.BFAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.BFAdd(ctx, self.prefix+key, item)
+}
+
+func (self *prefixed) BFMAdd(ctx context.Context, key string, items ...[]byte) (datkey.BFMAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.BFMAdd(ctx, self.prefix+key, items...)
+}
+
+func (self *prefixed) BFExists(ctx context.Context, key string, item []byte) (datkey.BFExistsResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.BFExists(ctx, self.prefix+key, item)
+}
+
+func (self *prefixed) BFMExists(ctx context.Context, key string, items ...[]byte) (datkey.BFMExistsResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.BFMExists(ctx, self.prefix+key, items...)
+}
+
+func (self *prefixed) CFReserve(ctx context.Context, key string, config datkey.CuckooConfig) *errors.Error[datkey.DbWriteErr] {
+	return self.next.CFReserve(ctx, self.prefix+key, config)
+}
+
+func (self *prefixed) CFAdd(ctx context.Context, key string, item []byte) *errors.Error[datkey.DbWriteErr] {
+	return self.next.CFAdd(ctx, self.prefix+key, item)
+}
+
+func (self *prefixed) CFDel(ctx context.Context, key string, item []byte) (datkey.CFDelResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.CFDel(ctx, self.prefix+key, item)
+}
+
+func (self *prefixed) CFExists(ctx context.Context, key string, item []byte) (datkey.CFExistsResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.CFExists(ctx, self.prefix+key, item)
+}
+
+func (self *prefixed) GeoAdd(ctx context.Context, key string, locations ...datkey.GeoLocation) (datkey.GeoAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.GeoAdd(ctx, self.prefix+key, locations...)
+}
+
+func (self *prefixed) GeoPos(ctx context.Context, key string, members ...string) (datkey.GeoPosResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.GeoPos(ctx, self.prefix+key, members...)
+}
+
+func (self *prefixed) GeoDist(ctx context.Context, key string, member1 string, member2 string, unit datkey.GeoUnit) (datkey.GeoDistResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.GeoDist(ctx, self.prefix+key, member1, member2, unit)
+}
+
+func (self *prefixed) GeoHash(ctx context.Context, key string, members ...string) (datkey.GeoHashResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.GeoHash(ctx, self.prefix+key, members...)
+}
+
+func (self *prefixed) GeoSearch(ctx context.Context, key string, query datkey.GeoSearchQuery) (datkey.GeoSearchResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.GeoSearch(ctx, self.prefix+key, query)
+}
+
+func (self *prefixed) JSONSet(ctx context.Context, key string, path string, value []byte, mode datkey.JSONSetMode) (datkey.JSONSetResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.JSONSet(ctx, self.prefix+key, path, value, mode)
+}
+
+func (self *prefixed) JSONGet(ctx context.Context, key string, paths ...string) (datkey.JSONGetResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.JSONGet(ctx, self.prefix+key, paths...)
+}
+
+func (self *prefixed) JSONDel(ctx context.Context, key string, path string) (datkey.JSONDelResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.JSONDel(ctx, self.prefix+key, path)
+}
+
+func (self *prefixed) JSONArrAppend(ctx context.Context, key string, path string, values ...[]byte) (datkey.JSONArrAppendResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.JSONArrAppend(ctx, self.prefix+key, path, values...)
+}
+
+func (self *prefixed) JSONNumIncrBy(ctx context.Context, key string, path string, increment float64) (datkey.JSONNumIncrByResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.JSONNumIncrBy(ctx, self.prefix+key, path, increment)
+}
+
+func (self *prefixed) JSONType(ctx context.Context, key string, path string) (datkey.JSONTypeResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.JSONType(ctx, self.prefix+key, path)
+}
+
+func (self *prefixed) ZAdd(ctx context.Context, key string, members ...datkey.ZMember) (datkey.ZAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.ZAdd(ctx, self.prefix+key, members...)
+}
+
+func (self *prefixed) ZRem(ctx context.Context, key string, members ...string) (datkey.ZRemResponse, *errors.Error[datkey.DbWriteErr]) {
+	return self.next.ZRem(ctx, self.prefix+key, members...)
+}
+
+func (self *prefixed) ZScore(ctx context.Context, key string, member string) (datkey.ZScoreResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.ZScore(ctx, self.prefix+key, member)
+}
+
+func (self *prefixed) ZCard(ctx context.Context, key string) (datkey.ZCardResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.ZCard(ctx, self.prefix+key)
+}
+
+func (self *prefixed) ZRangeByScore(ctx context.Context, key string, scoreRange datkey.ScoreRange) (datkey.ZRangeResponse, *errors.Error[datkey.DbReadErr]) {
+	return self.next.ZRangeByScore(ctx, self.prefix+key, scoreRange)
+}
@@ -0,0 +1,14 @@
+package store
+
+import (
+	"github.com/wspowell/datkey"
+)
+
+// ReadOnly view of a store, where writes fail with the ReadOnly cause without being run.
+func ReadOnly(next datkey.Store) datkey.Store {
+	return &decorated{
+		next:     next,
+		readOnly: true,
+		observe:  nil,
+	}
+}
@@ -0,0 +1,353 @@
+// Package store has decorators that wrap any datkey.Store, such as the embedded database or a mock, to add logging,
+// metrics, a read-only view or a key prefix without changing the code that uses the store.
+//
+//	db := datkey.New(config)
+//	var keyValue datkey.Store = store.Logging(store.Prefixed(db, "tenant:1:"), slog.Default())
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+// decorated store that runs each command on the next store, rejecting writes if read-only and observing each command
+// once it has run.
+type decorated struct {
+	next datkey.Store
+	// readOnly rejects writes with the ReadOnly cause without running them.
+	readOnly bool
+	// observe a command once it has run, with its error or nil.
+	observe func(ctx context.Context, command string, duration time.Duration, err error)
+}
+
+var _ datkey.Store = (*decorated)(nil)
+
+func read[T any](ctx context.Context, self *decorated, command string, run func() (T, *errors.Error[datkey.DbReadErr])) (T, *errors.Error[datkey.DbReadErr]) {
+	start := time.Now()
+	response, err := run()
+	self.done(ctx, command, start, asError(err))
+	return response, err
+}
+
+func write[T any](ctx context.Context, self *decorated, command string, run func() (T, *errors.Error[datkey.DbWriteErr])) (T, *errors.Error[datkey.DbWriteErr]) {
+	start := time.Now()
+	if self.readOnly {
+		var response T
+		err := errors.New(datkey.DbWriteReadOnly, "%s not allowed on a read-only store", command)
+		self.done(ctx, command, start, err)
+		return response, err
+	}
+
+	response, err := run()
+	self.done(ctx, command, start, asError(err))
+	return response, err
+}
+
+func (self *decorated) done(ctx context.Context, command string, start time.Time, err error) {
+	if self.observe != nil {
+		self.observe(ctx, command, time.Since(start), err)
+	}
+}
+
+// asError as a nil error if the command succeeded, rather than an error holding a nil pointer.
+func asError[T errors.Causer](err *errors.Error[T]) error {
+	if err == nil {
+		return nil
+	}
+	return err
+}
+
+func (self *decorated) Ping(ctx context.Context) *errors.Error[datkey.DbReadErr] {
+	_, err := read(ctx, self, "Ping", func() (struct{}, *errors.Error[datkey.DbReadErr]) {
+		return struct{}{}, self.next.Ping(ctx)
+	})
+	return err
+}
+
+func (self *decorated) Stats(ctx context.Context) datkey.StatsResponse {
+	response, _ := read(ctx, self, "Stats", func() (datkey.StatsResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.Stats(ctx), nil
+	})
+	return response
+}
+
+func (self *decorated) Close() {
+	self.next.Close()
+}
+
+func (self *decorated) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (datkey.SetResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "Set", func() (datkey.SetResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.Set(ctx, key, value, ttl)
+	})
+}
+
+func (self *decorated) Delete(ctx context.Context, key string) (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "Delete", func() (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.Delete(ctx, key)
+	})
+}
+
+func (self *decorated) GetDel(ctx context.Context, key string) (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "GetDel", func() (datkey.DeleteResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.GetDel(ctx, key)
+	})
+}
+
+func (self *decorated) Get(ctx context.Context, key string) (datkey.GetResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "Get", func() (datkey.GetResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.Get(ctx, key)
+	})
+}
+
+func (self *decorated) Expire(ctx context.Context, key string, ttl time.Duration) (datkey.ExpireResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "Expire", func() (datkey.ExpireResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.Expire(ctx, key, ttl)
+	})
+}
+
+func (self *decorated) Persist(ctx context.Context, key string) (datkey.PersistResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "Persist", func() (datkey.PersistResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.Persist(ctx, key)
+	})
+}
+
+func (self *decorated) Ttl(ctx context.Context, key string) (datkey.TtlResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "Ttl", func() (datkey.TtlResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.Ttl(ctx, key)
+	})
+}
+
+func (self *decorated) Type(ctx context.Context, key string) (datkey.TypeResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "Type", func() (datkey.TypeResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.Type(ctx, key)
+	})
+}
+
+func (self *decorated) Scan(ctx context.Context, cursor uint64, query datkey.ScanQuery) (datkey.ScanResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "Scan", func() (datkey.ScanResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.Scan(ctx, cursor, query)
+	})
+}
+
+func (self *decorated) SetBit(ctx context.Context, key string, offset int64, value bool) (datkey.SetBitResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "SetBit", func() (datkey.SetBitResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.SetBit(ctx, key, offset, value)
+	})
+}
+
+func (self *decorated) GetBit(ctx context.Context, key string, offset int64) (datkey.GetBitResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "GetBit", func() (datkey.GetBitResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.GetBit(ctx, key, offset)
+	})
+}
+
+func (self *decorated) BitCount(ctx context.Context, key string) (datkey.BitCountResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "BitCount", func() (datkey.BitCountResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.BitCount(ctx, key)
+	})
+}
+
+func (self *decorated) BitCountRange(ctx context.Context, key string, bitRange datkey.BitRange) (datkey.BitCountResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "BitCountRange", func() (datkey.BitCountResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.BitCountRange(ctx, key, bitRange)
+	})
+}
+
+func (self *decorated) BitPos(ctx context.Context, key string, bit bool) (datkey.BitPosResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "BitPos", func() (datkey.BitPosResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.BitPos(ctx, key, bit)
+	})
+}
+
+func (self *decorated) BitPosRange(ctx context.Context, key string, bit bool, bitRange datkey.BitRange) (datkey.BitPosResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "BitPosRange", func() (datkey.BitPosResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.BitPosRange(ctx, key, bit, bitRange)
+	})
+}
+
+func (self *decorated) BitOp(ctx context.Context, op datkey.BitOperation, destKey string, srcKeys ...string) (datkey.BitOpResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "BitOp", func() (datkey.BitOpResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.BitOp(ctx, op, destKey, srcKeys...)
+	})
+}
+
+func (self *decorated) BitField(ctx context.Context, key string, ops ...datkey.BitFieldOp) (datkey.BitFieldResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "BitField", func() (datkey.BitFieldResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.BitField(ctx, key, ops...)
+	})
+}
+
+func (self *decorated) PFAdd(ctx context.Context, key string, elements ...[]byte) (datkey.PFAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "PFAdd", func() (datkey.PFAddResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.PFAdd(ctx, key, elements...)
+	})
+}
+
+func (self *decorated) PFCount(ctx context.Context, keys ...string) (datkey.PFCountResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "PFCount", func() (datkey.PFCountResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.PFCount(ctx, keys...)
+	})
+}
+
+func (self *decorated) PFMerge(ctx context.Context, destKey string, srcKeys ...string) *errors.Error[datkey.DbWriteErr] {
+	_, err := write(ctx, self, "PFMerge", func() (struct{}, *errors.Error[datkey.DbWriteErr]) {
+		return struct{}{}, self.next.PFMerge(ctx, destKey, srcKeys...)
+	})
+	return err
+}
+
+func (self *decorated) BFReserve(ctx context.Context, key string, config datkey.BloomConfig) *errors.Error[datkey.DbWriteErr] {
+	_, err := write(ctx, self, "BFReserve", func() (struct{}, *errors.Error[datkey.DbWriteErr]) {
+		return struct{}{}, self.next.BFReserve(ctx, key, config)
+	})
+	return err
+}
+
+func (self *decorated) BFAdd(ctx context.Context, key string, item []byte) (datkey.BFAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "BFAdd", func() (datkey.BFAddResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.BFAdd(ctx, key, item)
+	})
+}
+
+func (self *decorated) BFMAdd(ctx context.Context, key string, items ...[]byte) (datkey.BFMAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "BFMAdd", func() (datkey.BFMAddResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.BFMAdd(ctx, key, items...)
+	})
+}
+
+func (self *decorated) BFExists(ctx context.Context, key string, item []byte) (datkey.BFExistsResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "BFExists", func() (datkey.BFExistsResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.BFExists(ctx, key, item)
+	})
+}
+
+func (self *decorated) BFMExists(ctx context.Context, key string, items ...[]byte) (datkey.BFMExistsResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "BFMExists", func() (datkey.BFMExistsResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.BFMExists(ctx, key, items...)
+	})
+}
+
+func (self *decorated) CFReserve(ctx context.Context, key string, config datkey.CuckooConfig) *errors.Error[datkey.DbWriteErr] {
+	_, err := write(ctx, self, "CFReserve", func() (struct{}, *errors.Error[datkey.DbWriteErr]) {
+		return struct{}{}, self.next.CFReserve(ctx, key, config)
+	})
+	return err
+}
+
+func (self *decorated) CFAdd(ctx context.Context, key string, item []byte) *errors.Error[datkey.DbWriteErr] {
+	_, err := write(ctx, self, "CFAdd", func() (struct{}, *errors.Error[datkey.DbWriteErr]) {
+		return struct{}{}, self.next.CFAdd(ctx, key, item)
+	})
+	return err
+}
+
+func (self *decorated) CFDel(ctx context.Context, key string, item []byte) (datkey.CFDelResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "CFDel", func() (datkey.CFDelResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.CFDel(ctx, key, item)
+	})
+}
+
+func (self *decorated) CFExists(ctx context.Context, key string, item []byte) (datkey.CFExistsResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "CFExists", func() (datkey.CFExistsResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.CFExists(ctx, key, item)
+	})
+}
+
+func (self *decorated) GeoAdd(ctx context.Context, key string, locations ...datkey.GeoLocation) (datkey.GeoAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "GeoAdd", func() (datkey.GeoAddResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.GeoAdd(ctx, key, locations...)
+	})
+}
+
+func (self *decorated) GeoPos(ctx context.Context, key string, members ...string) (datkey.GeoPosResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "GeoPos", func() (datkey.GeoPosResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.GeoPos(ctx, key, members...)
+	})
+}
+
+func (self *decorated) GeoDist(ctx context.Context, key string, member1 string, member2 string, unit datkey.GeoUnit) (datkey.GeoDistResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "GeoDist", func() (datkey.GeoDistResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.GeoDist(ctx, key, member1, member2, unit)
+	})
+}
+
+func (self *decorated) GeoHash(ctx context.Context, key string, members ...string) (datkey.GeoHashResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "GeoHash", func() (datkey.GeoHashResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.GeoHash(ctx, key, members...)
+	})
+}
+
+func (self *decorated) GeoSearch(ctx context.Context, key string, query datkey.GeoSearchQuery) (datkey.GeoSearchResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "GeoSearch", func() (datkey.GeoSearchResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.GeoSearch(ctx, key, query)
+	})
+}
+
+func (self *decorated) JSONSet(ctx context.Context, key string, path string, value []byte, mode datkey.JSONSetMode) (datkey.JSONSetResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "JSONSet", func() (datkey.JSONSetResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.JSONSet(ctx, key, path, value, mode)
+	})
+}
+
+func (self *decorated) JSONGet(ctx context.Context, key string, paths ...string) (datkey.JSONGetResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "JSONGet", func() (datkey.JSONGetResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.JSONGet(ctx, key, paths...)
+	})
+}
+
+func (self *decorated) JSONDel(ctx context.Context, key string, path string) (datkey.JSONDelResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "JSONDel", func() (datkey.JSONDelResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.JSONDel(ctx, key, path)
+	})
+}
+
+func (self *decorated) JSONArrAppend(ctx context.Context, key string, path string, values ...[]byte) (datkey.JSONArrAppendResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "JSONArrAppend", func() (datkey.JSONArrAppendResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.JSONArrAppend(ctx, key, path, values...)
+	})
+}
+
+func (self *decorated) JSONNumIncrBy(ctx context.Context, key string, path string, increment float64) (datkey.JSONNumIncrByResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "JSONNumIncrBy", func() (datkey.JSONNumIncrByResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.JSONNumIncrBy(ctx, key, path, increment)
+	})
+}
+
+func (self *decorated) JSONType(ctx context.Context, key string, path string) (datkey.JSONTypeResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "JSONType", func() (datkey.JSONTypeResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.JSONType(ctx, key, path)
+	})
+}
+
+func (self *decorated) ZAdd(ctx context.Context, key string, members ...datkey.ZMember) (datkey.ZAddResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "ZAdd", func() (datkey.ZAddResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.ZAdd(ctx, key, members...)
+	})
+}
+
+func (self *decorated) ZRem(ctx context.Context, key string, members ...string) (datkey.ZRemResponse, *errors.Error[datkey.DbWriteErr]) {
+	return write(ctx, self, "ZRem", func() (datkey.ZRemResponse, *errors.Error[datkey.DbWriteErr]) {
+		return self.next.ZRem(ctx, key, members...)
+	})
+}
+
+func (self *decorated) ZScore(ctx context.Context, key string, member string) (datkey.ZScoreResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "ZScore", func() (datkey.ZScoreResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.ZScore(ctx, key, member)
+	})
+}
+
+func (self *decorated) ZCard(ctx context.Context, key string) (datkey.ZCardResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "ZCard", func() (datkey.ZCardResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.ZCard(ctx, key)
+	})
+}
+
+func (self *decorated) ZRangeByScore(ctx context.Context, key string, scoreRange datkey.ScoreRange) (datkey.ZRangeResponse, *errors.Error[datkey.DbReadErr]) {
+	return read(ctx, self, "ZRangeByScore", func() (datkey.ZRangeResponse, *errors.Error[datkey.DbReadErr]) {
+		return self.next.ZRangeByScore(ctx, key, scoreRange)
+	})
+}
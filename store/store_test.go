@@ -0,0 +1,159 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wspowell/datkey"
+	"github.com/wspowell/datkey/store"
+)
+
+func newDb(t *testing.T) *datkey.Datkey {
+	t.Helper()
+
+	var config datkey.Config
+	db := datkey.New(config)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func Test_Logging(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{ //nolint:exhaustruct // reason: defaults for every other option
+		Level: slog.LevelDebug,
+	}))
+	db := store.Logging(newDb(t), logger)
+
+	_, err := db.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+	assert.Contains(t, output.String(), "level=DEBUG msg=\"datkey command\" command=Set")
+
+	_, err = db.BFAdd(ctx, "key", []byte("item"))
+	require.NotNil(t, err)
+	assert.Equal(t, datkey.DbWriteWrongType, err.Cause)
+	assert.Contains(t, output.String(), "level=WARN msg=\"datkey command failed\" command=BFAdd")
+}
+
+func Test_Metrics(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	metrics := store.NewMetrics(newDb(t))
+
+	_, err := metrics.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+	for range 3 {
+		_, err := metrics.Get(ctx, "key")
+		require.Nil(t, err)
+	}
+	_, readErr := metrics.ZCard(ctx, "key")
+	require.NotNil(t, readErr)
+
+	snapshot := metrics.Snapshot()
+	assert.Len(t, snapshot, 3)
+	assert.Equal(t, int64(1), snapshot["Set"].Calls)
+	assert.Equal(t, int64(3), snapshot["Get"].Calls)
+	assert.Equal(t, int64(0), snapshot["Get"].Errors)
+	assert.Positive(t, snapshot["Get"].Duration)
+	assert.Equal(t, int64(1), snapshot["ZCard"].Calls)
+	assert.Equal(t, int64(1), snapshot["ZCard"].Errors)
+}
+
+func Test_ReadOnly(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := newDb(t)
+	_, err := db.Set(ctx, "key", []byte("value"), 0)
+	require.Nil(t, err)
+
+	readOnly := store.ReadOnly(db)
+
+	getResponse, readErr := readOnly.Get(ctx, "key")
+	require.Nil(t, readErr)
+	assert.Equal(t, []byte("value"), getResponse.Value)
+
+	_, err = readOnly.Set(ctx, "key", []byte("changed"), 0)
+	require.NotNil(t, err)
+	assert.Equal(t, datkey.DbWriteReadOnly, err.Cause)
+
+	err = readOnly.PFMerge(ctx, "dest", "key")
+	require.NotNil(t, err)
+	assert.Equal(t, datkey.DbWriteReadOnly, err.Cause)
+
+	getResponse, readErr = db.Get(ctx, "key")
+	require.Nil(t, readErr)
+	assert.Equal(t, []byte("value"), getResponse.Value)
+}
+
+func Test_Prefixed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := newDb(t)
+	tenant1 := store.Prefixed(db, "tenant*1:")
+	tenant2 := store.Prefixed(db, "tenant:2:")
+
+	_, err := tenant1.Set(ctx, "key", []byte("one"), 0)
+	require.Nil(t, err)
+	_, err = tenant1.Set(ctx, "other", []byte("one"), 0)
+	require.Nil(t, err)
+	_, err = tenant2.Set(ctx, "key", []byte("two"), 0)
+	require.Nil(t, err)
+
+	getResponse, readErr := db.Get(ctx, "tenant*1:key")
+	require.Nil(t, readErr)
+	assert.Equal(t, []byte("one"), getResponse.Value)
+
+	getResponse, readErr = tenant2.Get(ctx, "key")
+	require.Nil(t, readErr)
+	assert.Equal(t, []byte("two"), getResponse.Value)
+
+	getResponse, readErr = tenant2.Get(ctx, "other")
+	require.Nil(t, readErr)
+	assert.False(t, getResponse.Exists)
+
+	// Multiple key commands prefix every key.
+	_, err = tenant1.PFAdd(ctx, "visitors:a", []byte("alice"))
+	require.Nil(t, err)
+	_, err = tenant1.PFAdd(ctx, "visitors:b", []byte("bob"))
+	require.Nil(t, err)
+	countResponse, readErr := tenant1.PFCount(ctx, "visitors:a", "visitors:b")
+	require.Nil(t, readErr)
+	assert.Equal(t, int64(2), countResponse.Count)
+
+	assert.Equal(t, []string{"key", "other", "visitors:a", "visitors:b"}, scanAll(t, tenant1, ""))
+	assert.Equal(t, []string{"visitors:a", "visitors:b"}, scanAll(t, tenant1, "visitors:*"))
+	assert.Equal(t, []string{"key"}, scanAll(t, tenant2, ""))
+}
+
+func scanAll(t *testing.T, db datkey.Store, match string) []string {
+	t.Helper()
+
+	var keys []string
+	var cursor uint64
+	for {
+		response, err := db.Scan(context.Background(), cursor, datkey.ScanQuery{
+			Match: match,
+			Type:  "",
+			Count: 0,
+		})
+		require.Nil(t, err)
+		keys = append(keys, response.Keys...)
+		cursor = response.Cursor
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,73 @@
+package datkey
+
+import (
+	"context"
+
+	"github.com/wspowell/datkey/lib/errors"
+)
+
+type ValueType string
+
+const (
+	ValueTypeNone         = ValueType("none")
+	ValueTypeString       = ValueType("string")
+	ValueTypeSortedSet    = ValueType("zset")
+	ValueTypeJSON         = ValueType("json")
+	ValueTypeBloomFilter  = ValueType("bloom")
+	ValueTypeCuckooFilter = ValueType("cuckoo")
+)
+
+// storedObject is any value that is not stored as a plain string.
+// Objects are only ever accessed under the slot lock and are never handed out to callers, so they may be modified in place.
+type storedObject interface {
+	valueType() ValueType
+	sizeInBytes() int64
+}
+
+type commandType struct {
+	Resp *typeResponse
+	Key  string
+}
+
+type typeResponse struct {
+	Type ValueType
+}
+
+type TypeResponse struct {
+	Type   ValueType
+	Exists bool
+}
+
+// Type of the value stored at a key.
+func (self *Datkey) Type(ctx context.Context, key string) (TypeResponse, *errors.Error[DbReadErr]) {
+	if err := readCanceled(ctx); err != nil {
+		return TypeResponse{}, err //nolint:exhaustruct // reason: zero value on error
+	}
+	return typeKey(key, self.cache.forContext(ctx))
+}
+
+func typeKey(key string, cache cacheStorage) (TypeResponse, *errors.Error[DbReadErr]) {
+	resp := &typeResponse{
+		Type: ValueTypeNone,
+	}
+
+	redirect := cache.runCommand(cache.slotOf(key), commandType{
+		Key:  key,
+		Resp: resp,
+	})
+	if redirect != nil {
+		return TypeResponse{}, redirect.readErr() //nolint:exhaustruct // reason: zero value on error
+	}
+
+	return TypeResponse{
+		Type:   resp.Type,
+		Exists: resp.Type != ValueTypeNone,
+	}, nil
+}
+
+func (self *slotStorage) handleCommandType(cmd commandType) {
+	data, exists := self.lookupKey(cmd.Key)
+	if exists {
+		cmd.Resp.Type = data.valueType()
+	}
+}